@@ -1,199 +1,122 @@
-
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
-	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"time"
 
-	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/embed"
 	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/ingest"
 	"vox-vector-engine/internal/storage"
-	"vox-vector-engine/internal/types"
 )
 
 func main() {
 	var (
-		cmd     = flag.String("cmd", "", "command to run: ingest_message | ingest_document | retrieve")
-		dataDir = flag.String("data", "data", "data directory")
-		dim     = flag.Int("dim", 768, "vector dimension")
-		input   = flag.String("input", "", "JSON input payload (or use stdin if empty)")
+		cmd          = flag.String("cmd", "", "command to run: "+commands.Names)
+		dataDir      = flag.String("data", "data", "data directory")
+		dim          = flag.Int("dim", 768, "vector dimension")
+		input        = flag.String("input", "", "JSON input payload (or use stdin if empty)")
+		path         = flag.String("path", "", "directory or repository for ingest_dir / reindex_git")
+		namespace    = flag.String("namespace", "", "namespace for ingest_dir / reindex_git (default: directory name)")
+		embedSpec    = flag.String("embed", "", "embedding provider for ingest_dir / ingest_jsonl / reindex_git / query_text: ollama:<model> or openai:<model>")
+		embedURL     = flag.String("embed_url", "", "base URL of the embedding provider (default depends on provider)")
+		from         = flag.String("from", "", "source data directory for migrate_embeddings")
+		metaSpec     = flag.String("meta", "bolt", "metadata backend: bolt or sqlite (sqlite needs a binary built with -tags sqlite)")
+		indexKind    = flag.String("index", index.KindHNSW, "vector index searches build: hnsw, or ivf (faster to build, slightly lower recall)")
+		indexDisk    = flag.String("index_disk", "", "keep HNSW neighbor lists in an adjacency file under this directory instead of in memory")
+		indexSeed    = flag.Int64("index_seed", 0, "seed the HNSW level generator so searches are reproducible (0 = random)")
+		to           = flag.String("to", "", "target data directory for migrate_embeddings (-dim is the new dimension)")
+		keepVersions = flag.Int("keep_versions", ingest.DefaultKeepVersions, "prior versions of a changed file kept searchable as <doc_id>@v<n> by ingest_dir / reindex_git; 0 replaces files in place")
+		format       = flag.String("format", commands.FormatJSON, "output of retrieve: json, table (scores colorized on a terminal unless NO_COLOR is set) or markdown")
+		contentLines = flag.Int("show_content_lines", 0, "with -format table or markdown, show at most this many lines of each chunk; 0 shows all")
+		jsonlFile    = flag.String("file", "", "JSON lines file for ingest_jsonl, one /ingest body per line (- reads stdin)")
+		jsonlWorkers = flag.Int("workers", commands.DefaultJSONLWorkers, "how many lines ingest_jsonl embeds at once")
+		jsonlErrors  = flag.String("error_file", "", "where ingest_jsonl reports failed lines (default <file>.errors.jsonl)")
+		normalize    = flag.Bool("normalize", false, "scale vectors to unit length at ingest and queries at search time (must match the server's -normalize)")
+		warnMismatch = flag.Bool("warn_model_mismatch", false, "store and search vectors tagged with another embedding model than their namespace's, with a warning, instead of refusing them")
 	)
 	flag.Parse()
 
-	if *cmd == "" {
-		log.Fatalf("error: -cmd is required")
+	if !commands.ValidFormat(*format) || *contentLines < 0 {
+		log.Fatalf("invalid -format %q or -show_content_lines %d (want json, table or markdown and a count >= 0)", *format, *contentLines)
 	}
 
-	// Setup components
-	if err := os.MkdirAll(*dataDir, 0755); err != nil {
-		log.Fatalf("failed to create data dir: %v", err)
+	if *cmd == "" {
+		log.Fatalf("error: -cmd is required")
 	}
 
-	vecPath := filepath.Join(*dataDir, "vectors.bin")
-	metaPath := filepath.Join(*dataDir, "metadata.db")
-
-	vecs, err := storage.NewMmapVectorStore(vecPath, *dim)
+	backend, err := storage.ParseMetadataBackend(*metaSpec)
 	if err != nil {
-		log.Fatalf("failed to open vector store: %v", err)
+		log.Fatalf("invalid -meta: %v", err)
 	}
-	defer vecs.Close()
-
-	meta, err := storage.NewBoltMetadataStore(metaPath)
-	if err != nil {
-		log.Fatalf("failed to open metadata store: %v", err)
+	indexConfig := index.Config{Kind: *indexKind, DiskDir: *indexDisk, Seed: *indexSeed}
+	if err := indexConfig.Validate(); err != nil {
+		log.Fatalf("invalid -index: %v", err)
 	}
-	defer meta.Close()
 
-	// Only build index for retrieval
-	var idx *index.HnswIndex
-	var eng *engine.Engine
-
-	if *cmd == "retrieve" {
-		idx = index.NewHnswIndex(vecs)
-		// REBUILD INDEX: HNSW is in-memory only.
-		count := vecs.Count()
-		if count > 0 {
-			for i := uint64(0); i < count; i++ {
-				v, err := vecs.Get(i)
-				if err == nil {
-					idx.Add(i, v)
-				}
-			}
+	var provider embed.Provider
+	if *embedSpec != "" {
+		provider, err = embed.FromSpec(*embedSpec, *embedURL, *dim)
+		if err != nil {
+			log.Fatalf("failed to configure embedder: %v", err)
 		}
-		eng = engine.NewEngine(idx, vecs, meta)
 	}
 
-	// Read input
-	var inputBytes []byte
-	if *input != "" {
-		inputBytes = []byte(*input)
-	} else {
-		// Read from stdin
-		stat, _ := os.Stdin.Stat()
-		if stat != nil && (stat.Mode()&os.ModeCharDevice) == 0 {
-			// Actually piped
-			dec := json.NewDecoder(os.Stdin)
-			var raw interface{}
-			dec.Decode(&raw)
-			inputBytes, _ = json.Marshal(raw)
-		}
+	cli := &commands.CLI{
+		DataDir:      *dataDir,
+		Dim:          *dim,
+		MetaBackend:  backend,
+		Index:        indexConfig,
+		Embedder:     provider,
+		Path:         *path,
+		Namespace:    *namespace,
+		From:         *from,
+		To:           *to,
+		KeepVersions: *keepVersions,
+		Normalize:    *normalize,
+		File:         *jsonlFile,
+		Workers:      *jsonlWorkers,
+		ErrorFile:    *jsonlErrors,
+		Format:       *format,
+		ContentLines: *contentLines,
+		Color:        commands.UseColor(),
+
+		WarnModelMismatch: *warnMismatch,
 	}
-
-	switch *cmd {
-	case "ingest_message":
-		var req struct {
-			Namespace      string       `json:"namespace"`
-			ConversationID string       `json:"conversation_id"`
-			MessageID      string       `json:"message_id,omitempty"`
-			Role           string       `json:"role"`
-			Content        string       `json:"content"`
-			Vector         types.Vector `json:"vector"`
-			TokenCount     int          `json:"token_count"`
-			Source         string       `json:"source,omitempty"`
-		}
-		if err := json.Unmarshal(inputBytes, &req); err != nil {
-			log.Fatalf("json decode error: %v", err)
-		}
-
-		msgID := req.MessageID
-		if msgID == "" {
-			msgID = fmt.Sprintf("msg-%d", os.Getpid())
-		}
-		docID := fmt.Sprintf("chat:%s:%s", req.ConversationID, msgID)
-
-		doc := types.Document{
-			ID:        docID,
-			Source:    req.Source,
-			Timestamp: time.Now(),
-			Metadata: types.Metadata{
-				"namespace":       req.Namespace,
-				"conversation_id": req.ConversationID,
-				"role":            req.Role,
-			},
-		}
-		if err := meta.SaveDocument(doc); err != nil {
-			log.Fatalf("save doc error: %v", err)
+	if commands.NeedsStores(*cmd) {
+		// Setup components
+		if err := os.MkdirAll(*dataDir, 0755); err != nil {
+			log.Fatalf("failed to create data dir: %v", err)
 		}
 
-		id, _ := vecs.Append(req.Vector)
-		// No need to add to idx since we are closing immediately
-		
-		meta.SaveChunk(types.Chunk{
-			ID: id, DocID: docID, Content: req.Content, TokenCount: req.TokenCount,
-		})
-		fmt.Printf("{\"status\":\"ok\",\"id\":%d}\n", id)
+		vecPath := filepath.Join(*dataDir, "vectors.bin")
+		metaPath := filepath.Join(*dataDir, "metadata.db")
 
-	case "ingest_document":
-		var req struct {
-			Namespace  string       `json:"namespace"`
-			FilePath   string       `json:"file_path"`
-			Content    string       `json:"content"`
-			Vector     types.Vector `json:"vector"`
-			TokenCount int          `json:"token_count"`
-			StartLine  int          `json:"start_line"`
-			EndLine    int          `json:"end_line"`
+		vecs, err := storage.NewMmapVectorStore(vecPath, *dim)
+		if err != nil {
+			log.Fatalf("failed to open vector store: %v", err)
 		}
-		if err := json.Unmarshal(inputBytes, &req); err != nil {
-			log.Fatalf("json decode error: %v", err)
-		}
-
-		docID := fmt.Sprintf("file:%s:%s", req.Namespace, req.FilePath)
+		defer vecs.Close()
 
-		doc := types.Document{
-			ID:        docID,
-			Source:    req.FilePath,
-			Timestamp: time.Now(),
-			Metadata: types.Metadata{
-				"namespace": req.Namespace,
-				"file_path": req.FilePath,
-				"type":      "code",
-			},
+		meta, err := backend.Open(metaPath)
+		if err != nil {
+			log.Fatalf("failed to open metadata store: %v", err)
 		}
-		if err := meta.SaveDocument(doc); err != nil {
-			log.Fatalf("save doc error: %v", err)
-		}
-
-		id, _ := vecs.Append(req.Vector)
-		
-		meta.SaveChunk(types.Chunk{
-			ID:         id,
-			DocID:      docID,
-			Content:    req.Content,
-			TokenCount: req.TokenCount,
-			StartLine:  req.StartLine,
-			EndLine:    req.EndLine,
-		})
-		fmt.Printf("{\"status\":\"ok\",\"id\":%d}\n", id)
+		defer meta.Close()
 
-	case "retrieve":
-		var req struct {
-			Namespace string       `json:"namespace"`
-			Query     types.Vector `json:"query"`
-			MaxTokens int          `json:"max_tokens"`
-		}
-		if err := json.Unmarshal(inputBytes, &req); err != nil {
-			log.Fatalf("json decode error: %v", err)
-		}
-
-		cfg := engine.RetrievalConfig{
-			MaxTokens:        req.MaxTokens,
-			Namespace:        req.Namespace,
-			TopKCandidates:   40,
-			SimilarityWeight: 0.7,
-			RecencyWeight:    0.3,
-		}
-		if req.MaxTokens > 40 {
-			cfg.TopKCandidates = req.MaxTokens
-		}
-		res, _ := eng.Retrieve(req.Query, cfg)
-		json.NewEncoder(os.Stdout).Encode(res)
-
-	default:
-		log.Fatalf("unknown command: %s", *cmd)
+		cli.Vectors, cli.Meta = vecs, meta
+	}
+	defer cli.Close()
+	err = cli.Run(context.Background(), *cmd, commands.ReadInput(*input))
+	if errors.Is(err, commands.ErrConfirmRequired) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", *cmd, err)
 	}
 }
@@ -1,17 +1,33 @@
-
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"vox-vector-engine/internal/api"
+	"vox-vector-engine/internal/compact"
+	"vox-vector-engine/internal/daemon"
+	"vox-vector-engine/internal/embed"
 	"vox-vector-engine/internal/engine"
 	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/ingest"
+	"vox-vector-engine/internal/listen"
+	"vox-vector-engine/internal/maintenance"
+	"vox-vector-engine/internal/remote"
+	"vox-vector-engine/internal/replication"
+	"vox-vector-engine/internal/scrub"
 	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/tokens"
+	"vox-vector-engine/internal/tracing"
+	"vox-vector-engine/internal/watch"
 )
 
 func main() {
@@ -23,6 +39,76 @@ func main() {
 		efSearch       = flag.Int("ef_search", 64, "HNSW ef_search (unused; kept for CLI compat)")
 		efConstruction = flag.Int("ef_construction", 200, "HNSW ef_construction (unused; kept for CLI compat)")
 		m              = flag.Int("m", 16, "HNSW M (unused; kept for CLI compat)")
+		flushEvery     = flag.Int("flush_every", 0, "fsync vectors.bin after this many appends (0 = off)")
+		flushInterval  = flag.Duration("flush_interval", 0, "fsync vectors.bin at this interval when dirty, e.g. 5s (0 = off)")
+		countEvery     = flag.Int("count_every", 0, "write the vectors.bin header count once per this many appends instead of after each (0 = every append); faster bulk ingest, but a crash loses up to this many recent vectors")
+		initialCap     = flag.Int("initial_capacity", storage.DefaultInitialCapacity, "vectors a new vectors.bin has room for before it first grows")
+		growthFactor   = flag.Float64("growth_factor", storage.DefaultGrowthFactor, "fraction of its size a full vectors.bin grows by (each growth remaps the file and stalls readers)")
+		preallocate    = flag.Int("preallocate", 0, "grow each vectors.bin on open to hold this many vectors, e.g. 1000000 before a large ingest (0 = off)")
+		sparseVecs     = flag.Bool("sparse_vectors", false, "extend vectors.bin sparsely instead of reserving its disk blocks as it grows (no disk used up front by -preallocate, but the file may fragment)")
+		mapWindowMB    = flag.Int("map_window_mb", 0, "map each vectors.bin in windows of this many MiB instead of whole, bounding the address space huge stores need (0 = map the whole file); pair with -count_every, as each header write then syncs the file")
+		mapWindows     = flag.Int("map_windows", storage.DefaultMapWindows, "windows kept mapped per vectors.bin with -map_window_mb")
+		segmentVectors = flag.Uint64("segment_vectors", 0, "store vectors in segment files of this many vectors each under <data>/vectors instead of one vectors.bin, so a corrupt file only loses its own segment (only for a new data directory, which then keeps its segment size; snapshots need the single file)")
+		tokenizer      = flag.String("tokenizer", "", "tiktoken vocabulary file (e.g. cl100k_base.tiktoken); empty uses a heuristic counter")
+		embedSpec      = flag.String("embed", "", "server-side embedding provider: ollama:<model> or openai:<model> (empty = callers send vectors)")
+		embedURL       = flag.String("embed_url", "", "base URL of the embedding provider (default depends on provider)")
+		scrubSets      = flag.String("scrub", "", "redact built-in rule sets from chunk content before it is stored, comma-separated: secrets (API keys, tokens, private keys), emails")
+		scrubRules     = flag.String("scrub_rules", "", "JSON file of extra redaction rules, [{\"name\": ..., \"pattern\": <regexp>, \"replacement\": ...}], run after -scrub")
+		scrubURL       = flag.String("scrub_url", "", "external scrubber run after the rules: POST {\"texts\": [...]} answered with {\"texts\": [...], \"redactions\": [...]}; ingest fails while it is unreachable")
+		normalize      = flag.Bool("normalize", false, "scale vectors to unit length at ingest (keeping each chunk's original norm in its metadata) and queries at search time, so the index ranks by cosine similarity; set it for a new data directory, as vectors stored without it are not rescaled")
+		warnMismatch   = flag.Bool("warn_model_mismatch", false, "store and search vectors tagged (\"embedding_model\") with another embedding model than their namespace's, with a model_warning in the response, instead of refusing them with 409")
+		shortTerm      = flag.Int("short_term", 0, "keep the last N messages of each conversation in memory, searched without the index, and store a message once N newer ones arrive or the server stops (0 = store every message at once)")
+		watchDir       = flag.String("watch", "", "project directory to keep indexed (requires -embed)")
+		watchNS        = flag.String("watch_namespace", "", "namespace for -watch (default: directory name)")
+		isolate        = flag.Bool("isolate_namespaces", false, "give each namespace its own vectors file, metadata db and index under <data>/namespaces")
+		tenants        = flag.Bool("tenants", false, "multi-tenant mode: requests with an X-Vox-Tenant header or a /v1/t/<tenant>/ path prefix get their own stores under <data>/tenants/<tenant>")
+		maxTenants     = flag.Int("max_tenants", api.DefaultMaxTenants, "with -tenants, how many tenants may be open at once; the least recently used idle one is closed to make room")
+		tenantIdle     = flag.Duration("tenant_idle", api.DefaultTenantIdle, "with -tenants, close a tenant after this long without requests (0 = never)")
+		summarizeSpec  = flag.String("summarize", "", "LLM that compacts old chat messages into summaries: ollama:<model> or openai:<model> (requires -embed and -compact_age, -compact_keep or -summary_every)")
+		summarizeURL   = flag.String("summarize_url", "", "base URL of the summarization endpoint (OpenAI-compatible; default depends on provider)")
+		compactEvery   = flag.Duration("compact_every", time.Hour, "how often to run chat compaction when -summarize is set")
+		compactAge     = flag.Duration("compact_age", 0, "compact chat messages older than this, e.g. 168h (0 = no age limit)")
+		compactKeep    = flag.Int("compact_keep", 0, "compact all but the newest N messages of each conversation (0 = no count limit)")
+		summaryEvery   = flag.Int("summary_every", 0, "with -summarize, refresh a rolling summary document of each conversation every N new messages (GET /conversations/{id}/summary; 0 = off)")
+		maintSpec      = flag.String("maintenance", "", "cron schedule (minute hour day month weekday) of maintenance windows, e.g. \"0 2 * * *\" for 02:00 daily (GET /maintenance)")
+		maintWindow    = flag.Duration("maintenance_window", maintenance.DefaultWindow, "how long each maintenance window stays open")
+		maintTasks     = flag.String("maintenance_tasks", "", "comma-separated tasks for maintenance windows, from compact, summarize, reindex, snapshot (empty = every available one)")
+		maintQuiet     = flag.Duration("maintenance_quiet", maintenance.DefaultQuiet, "how long no query may arrive before a maintenance task starts; a query pauses the running task")
+		maxBody        = flag.Int64("max_body", api.DefaultMaxBodyBytes, "maximum request body in bytes; larger requests get 413 (0 = unlimited; /ingest_stream is exempt)")
+		rateLimit      = flag.Float64("rate_limit", 0, "requests per second allowed per client IP; excess gets 429 (0 = unlimited)")
+		rateBurst      = flag.Int("rate_burst", 0, "burst size for -rate_limit (default: the rate rounded up)")
+		searchTimeout  = flag.Duration("search_timeout", api.DefaultSearchTimeout, "cut short each /retrieve, /context and /similar search after this long with 504 and how far it got (0 = unlimited)")
+		listenSpec     = flag.String("listen", "", "listen on tcp://host:port, unix:///path/vox.sock or npipe:////./pipe/vox instead of -addr (sockets and pipes are private to the current user)")
+		tlsCert        = flag.String("tls_cert", "", "PEM certificate for HTTPS (with -tls_key)")
+		tlsKey         = flag.String("tls_key", "", "PEM private key for -tls_cert")
+		tlsClientCA    = flag.String("tls_client_ca", "", "PEM CA bundle; when set, clients must present a certificate it signed (mutual TLS)")
+		authToken      = flag.String("auth_token", "", "require \"Authorization: Bearer <token>\" on every request but /healthz and /readyz; auto generates a token, which local clients read from <data>/engine.json")
+		strictPort     = flag.Bool("strict_port", false, "fail when the -addr port is taken instead of listening on a free port (the address in use is written to <data>/engine.json either way)")
+		remoteURL      = flag.String("remote", "", "S3-compatible bucket for snapshots, s3://bucket/prefix: every /snapshot is uploaded there, and an empty -data starts from the newest one (credentials from AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY)")
+		remoteEnd      = flag.String("remote_endpoint", "", "object storage URL for -remote, e.g. http://localhost:9000 for MinIO (default $AWS_ENDPOINT_URL or AWS S3 in -remote_region)")
+		remoteRegion   = flag.String("remote_region", "", "region for -remote (default $AWS_REGION or us-east-1)")
+		replicaOf      = flag.String("replica_of", "", "run as a read-only replica of the primary server at this URL, e.g. http://primary:8080: its vectors and metadata changes are copied into -data, which must be empty or an earlier replica of the same primary (shared stores only; not with -isolate_namespaces, -tenants or -models)")
+		replicaToken   = flag.String("replica_token", "", "with -replica_of, the -auth_token of the primary")
+		replicaEvery   = flag.Duration("replica_interval", replication.DefaultInterval, "with -replica_of, how often to poll the primary for changes")
+		trashRetention = flag.Duration("trash_retention", api.DefaultTrashRetention, "how long documents deleted with ?soft=true stay restorable before the janitor purges them (0 = keep until deleted by hand)")
+		keepVersions   = flag.Int("keep_versions", ingest.DefaultKeepVersions, "prior versions of a changed file kept searchable as <doc_id>@v<n> when it is re-indexed (watch, ingest_dir, reindex_git); 0 replaces files in place")
+		ingestWorkers  = flag.Int("ingest_workers", 0, "bound concurrent ingest writes to this many workers so indexing bursts do not starve /retrieve; large /ingest batches are then queued and answered 202 with a job ID (GET /jobs/{id}); 0 ingests in the request, unbounded")
+		ingestBacklog  = flag.Int("ingest_queue", 64, "with -ingest_workers, how many background jobs (large /ingest batches, /ingest_dir, /compact, async purges) may wait for a worker before the request answers 503")
+		asyncChunks    = flag.Int("async_ingest_chunks", api.DefaultAsyncIngestChunks, "with -ingest_workers, /ingest batches of at least this many chunks are queued (202) instead of answered when done; 0 never queues")
+		daemonMode     = flag.Bool("daemon", false, "run as a background service: write <data>/vox.pid, log to the rotating <data>/vox.log (reopened on SIGHUP) and shut down cleanly on SIGTERM, Ctrl-C or -cmd stop (not with -readonly)")
+		logMaxMB       = flag.Int("log_max_mb", daemon.DefaultLogMaxBytes>>20, "with -daemon, rotate vox.log once it reaches this many MiB")
+		logKeep        = flag.Int("log_keep", daemon.DefaultLogKeep, "with -daemon, rotated logs kept (vox.log.1 is the newest)")
+		metaSpec       = flag.String("meta", "bolt", "metadata backend: bolt or sqlite (sqlite needs a binary built with -tags sqlite)")
+		indexKind      = flag.String("index", index.KindHNSW, "vector index: hnsw, or ivf (k-means lists scanned exactly) which builds an order of magnitude faster and takes less memory at slightly lower recall, for large one-shot indexing jobs")
+		indexDisk      = flag.String("index_disk", "", "keep HNSW neighbor lists in adjacency files under this directory instead of in memory, so index memory follows the nodes searches visit rather than the corpus (files are deleted on exit; ones left by a crash can be removed while no server runs)")
+		indexCache     = flag.Int("index_cache", index.DefaultCacheNodes, "with -index_disk, how many graph nodes each index keeps decoded in memory")
+		indexSeed      = flag.Int64("index_seed", 0, "seed the HNSW level generator so rebuilding the same vectors gives the same graph and search results, e.g. for benchmarks and bug reports (0 = random per index)")
+		otlpEndpoint   = flag.String("otlp_endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "export OpenTelemetry traces to this OTLP/HTTP collector, e.g. http://localhost:4318 (needs a binary built with -tags otel; default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+		traceSample    = flag.Float64("trace_sample", 1, "fraction of requests traced with -otlp_endpoint; callers' sampled traceparents are always followed")
+		readOnly       = flag.Bool("readonly", false, "open the data directory read-only, e.g. next to a server that owns it; writes get 403 (bolt refuses while a writer is running, sqlite does not)")
+		force          = flag.Bool("force", false, "start even if another process seems to hold the data directory lock (vox.lock); only for recovering from a crashed process on a filesystem that kept its lock, since two live writers corrupt the data")
+		followEvery    = flag.Duration("follow_interval", 5*time.Second, "with -readonly, how often to index vectors appended by the writer (0 = never)")
+		models         = flag.String("models", "", "extra embedding spaces selected by the request \"model\" field, e.g. code=768,chat=1536 (stored under <data>/models)")
 	)
 	_ = maxElements
 	_ = efSearch
@@ -31,24 +117,106 @@ func main() {
 
 	flag.Parse()
 
-	if err := os.MkdirAll(*dataDir, 0o755); err != nil {
-		log.Fatalf("failed to create data dir: %v", err)
+	// stopping is closed when a -daemon is asked to stop; nil otherwise.
+	var stopping <-chan struct{}
+
+	backend, err := storage.ParseMetadataBackend(*metaSpec)
+	if err != nil {
+		log.Fatalf("invalid -meta: %v", err)
+	}
+	indexConfig := index.Config{Kind: *indexKind, DiskDir: *indexDisk, CacheNodes: *indexCache, Seed: *indexSeed}
+	if err := indexConfig.Validate(); err != nil {
+		log.Fatalf("invalid -index: %v", err)
+	}
+
+	if *readOnly && (*watchDir != "" || *summarizeSpec != "") {
+		log.Fatalf("-readonly cannot be combined with -watch or -summarize")
+	}
+	if *replicaOf != "" && (*readOnly || *isolate || *tenants || *models != "" || *watchDir != "" || *summarizeSpec != "") {
+		log.Fatalf("-replica_of cannot be combined with -readonly, -isolate_namespaces, -tenants, -models, -watch or -summarize")
+	}
+	if !*readOnly {
+		if err := os.MkdirAll(*dataDir, 0o755); err != nil {
+			log.Fatalf("failed to create data dir: %v", err)
+		}
+		lock, err := storage.LockDir(*dataDir)
+		if err != nil {
+			if !*force {
+				log.Fatalf("%v; stop the other engine, point -data elsewhere, or start with -readonly (-force overrides a lock left behind by a dead process)", err)
+			}
+			log.Printf("ignoring data directory lock (-force): %v", err)
+		}
+		defer lock.Close()
+	}
+	if *daemonMode {
+		if *readOnly {
+			log.Fatalf("-daemon cannot be combined with -readonly")
+		}
+		d, err := daemon.Start(*dataDir, daemon.Options{LogMaxBytes: int64(*logMaxMB) << 20, LogKeep: *logKeep})
+		if err != nil {
+			log.Fatalf("failed to start daemon: %v", err)
+		}
+		defer d.Close()
+		stopping = d.Done()
+		log.Printf("daemon pid=%d log=%s", os.Getpid(), d.Log().Path())
+	}
+
+	var remoteClient *remote.Client
+	if *remoteURL != "" {
+		cfg := remote.Config{Endpoint: *remoteEnd, Region: *remoteRegion}
+		if err := cfg.ParseURL(*remoteURL); err != nil {
+			log.Fatalf("invalid -remote: %v", err)
+		}
+		cfg.FromEnv()
+		remoteClient, err = remote.New(cfg)
+		if err != nil {
+			log.Fatalf("invalid -remote: %v", err)
+		}
+		if !*readOnly {
+			name, err := remote.Bootstrap(context.Background(), remoteClient, *dataDir, *dim)
+			if err != nil {
+				log.Fatalf("failed to bootstrap from %s: %v", remoteClient, err)
+			}
+			if name != "" {
+				log.Printf("bootstrapped %s from snapshot %s on %s", *dataDir, name, remoteClient)
+			}
+		}
 	}
 
-	vecPath := filepath.Join(*dataDir, "vectors.bin")
 	metaPath := filepath.Join(*dataDir, "metadata.db")
 
-	vecs, err := storage.NewMmapVectorStore(vecPath, *dim)
+	if hazard := storage.MmapHazard(*dataDir); hazard != "" {
+		log.Printf("WARNING: %s is not safe for memory-mapped vector files: %s", *dataDir, hazard)
+		log.Printf("WARNING: vectors may be lost or corrupted and the server may crash on reads; move -data to a local, unsynced disk")
+	}
+	growth := storage.GrowthPolicy{InitialCapacity: *initialCap, Factor: *growthFactor, Preallocate: *preallocate, Sparse: *sparseVecs, MapWindow: int64(*mapWindowMB) << 20, MapWindows: *mapWindows}
+	if err := growth.Validate(); err != nil {
+		log.Fatalf("invalid vector file sizing: %v", err)
+	}
+	vecs, err := storage.OpenVectorFiles(*dataDir, *dim, *segmentVectors, growth, *readOnly)
 	if err != nil {
 		log.Fatalf("failed to open vector store: %v", err)
 	}
+	if segs, ok := vecs.(*storage.SegmentedVectorStore); ok {
+		for _, seg := range segs.Segments() {
+			if seg.Err != nil {
+				log.Printf("vector segment %s unavailable, ids %d-%d will fail: %v", seg.Path, seg.FirstID, seg.FirstID+segs.SegmentVectors()-1, seg.Err)
+			}
+		}
+	}
+	flushPolicy := storage.FlushPolicy{EveryAppends: *flushEvery, Interval: *flushInterval, CountEvery: *countEvery}
+	vecs.SetFlushPolicy(flushPolicy)
 	defer func() {
 		if err := vecs.Close(); err != nil {
 			log.Printf("vector store close error: %v", err)
 		}
 	}()
 
-	meta, err := storage.NewBoltMetadataStore(metaPath)
+	openMeta := backend.Open
+	if *readOnly {
+		openMeta = backend.OpenReadOnly
+	}
+	meta, err := openMeta(metaPath)
 	if err != nil {
 		log.Fatalf("failed to open metadata store: %v", err)
 	}
@@ -59,15 +227,249 @@ func main() {
 	}()
 
 	// In-memory ANN index (uses vecs as the vector source of truth).
-	idx := index.NewHnswIndex(vecs)
+	idx, err := index.New(indexConfig, vecs)
+	if err != nil {
+		log.Fatalf("failed to create index: %v", err)
+	}
 
 	// Engine wires index + stores together (used by retrieval logic).
 	eng := engine.NewEngine(idx, vecs, meta)
 
 	srv := api.NewServer(eng, idx, meta, vecs)
+	srv.SetDataDir(*dataDir, *dim)
+	srv.SetMetadataBackend(backend)
+	srv.SetIndexConfig(indexConfig)
+	srv.SetKeepVersions(*keepVersions)
+	srv.SetNormalize(*normalize)
+	srv.SetWarnModelMismatch(*warnMismatch)
+	srv.SetShortTerm(*shortTerm)
+	srv.SetReadOnly(*readOnly || *replicaOf != "")
+	if !*readOnly {
+		if err := srv.PersistJobs(filepath.Join(*dataDir, "jobs.json")); err != nil {
+			log.Printf("job history not kept: %v", err)
+		}
+	}
+	if remoteClient != nil {
+		srv.SetRemote(remoteClient)
+		log.Printf("snapshots are uploaded to %s", remoteClient)
+	}
+
+	if *embedSpec != "" {
+		provider, err := embed.FromSpec(*embedSpec, *embedURL, *dim)
+		if err != nil {
+			log.Fatalf("failed to configure embedder: %v", err)
+		}
+		srv.SetEmbedder(provider)
+		log.Printf("server-side embedding with %s", provider.Name())
+	}
+
+	if *tokenizer != "" {
+		counter, err := tokens.LoadBPE(*tokenizer)
+		if err != nil {
+			log.Fatalf("failed to load tokenizer: %v", err)
+		}
+		srv.SetTokenCounter(counter)
+		log.Printf("token counting with %s", counter.Name())
+	}
+
+	var scrubSpec []string
+	if *scrubSets != "" {
+		scrubSpec = strings.Split(*scrubSets, ",")
+	}
+	scrubber, err := scrub.New(scrub.Options{Builtin: scrubSpec, RulesFile: *scrubRules, URL: *scrubURL})
+	if err != nil {
+		log.Fatalf("invalid -scrub: %v", err)
+	}
+	if len(scrubber) > 0 {
+		srv.SetScrubber(scrubber)
+		log.Printf("scrubbing ingest content with %s", scrubber.Name())
+	}
+
+	specs, err := api.ParseModels(*models)
+	if err != nil {
+		log.Fatalf("invalid -models: %v", err)
+	}
+	for _, m := range specs {
+		if err := srv.AddModel(m.Name, m.Dim); err != nil {
+			log.Fatalf("failed to open model space: %v", err)
+		}
+		log.Printf("model space %s dim=%d", m.Name, m.Dim)
+	}
+
+	if *isolate {
+		shards, err := engine.NewShardManager(filepath.Join(*dataDir, "namespaces"), *dim)
+		if err != nil {
+			log.Fatalf("failed to open namespace shards: %v", err)
+		}
+		defer func() {
+			if err := shards.Close(); err != nil {
+				log.Printf("namespace shards close error: %v", err)
+			}
+		}()
+		shards.SetFlushPolicy(flushPolicy)
+		shards.SetGrowthPolicy(growth)
+		shards.SetReadOnly(*readOnly)
+		shards.SetMetadataBackend(backend)
+		shards.SetIndexConfig(indexConfig)
+		srv.EnableNamespaceIsolation(shards)
+		log.Printf("namespace isolation enabled (shards=%s)", shards.Root())
+	}
+
+	if *tenants {
+		srv.EnableTenants(api.TenantOptions{MaxOpen: *maxTenants, Idle: *tenantIdle})
+		log.Printf("multi-tenant mode (tenants=%s max_open=%d idle=%s)", filepath.Join(*dataDir, "tenants"), *maxTenants, *tenantIdle)
+	}
+
+	if *summarizeSpec != "" {
+		sum, err := compact.FromSpec(*summarizeSpec, *summarizeURL)
+		if err != nil {
+			log.Fatalf("failed to configure summarizer: %v", err)
+		}
+		if *embedSpec == "" {
+			log.Fatalf("-summarize requires -embed")
+		}
+		if *compactAge <= 0 && *compactKeep <= 0 && *summaryEvery <= 0 {
+			log.Fatalf("-summarize requires -compact_age, -compact_keep or -summary_every")
+		}
+		if *compactAge > 0 || *compactKeep > 0 {
+			c := srv.Compactor(sum, compact.Policy{MaxAge: *compactAge, KeepRecent: *compactKeep})
+			go c.Run(context.Background(), *compactEvery)
+			log.Printf("chat compaction with %s every %s (age=%s keep=%d)", sum.Name(), *compactEvery, *compactAge, *compactKeep)
+		}
+		if *summaryEvery > 0 {
+			srv.EnableRollingSummaries(sum, *summaryEvery)
+			log.Printf("rolling conversation summaries with %s every %d messages", sum.Name(), *summaryEvery)
+		}
+	}
+
+	if *maintSpec != "" {
+		sched, err := maintenance.ParseSchedule(*maintSpec)
+		if err != nil {
+			log.Fatalf("invalid -maintenance: %v", err)
+		}
+		var names []string
+		for _, name := range strings.Split(*maintTasks, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		m, err := srv.EnableMaintenance(sched, *maintWindow, *maintQuiet, names)
+		if err != nil {
+			log.Fatalf("failed to configure maintenance: %v", err)
+		}
+		log.Printf("maintenance windows at %q for %s (tasks=%s quiet=%s)", sched, *maintWindow, strings.Join(m.Status().Tasks, ","), *maintQuiet)
+	}
+
+	if *watchDir != "" {
+		ns := *watchNS
+		if ns == "" {
+			abs, _ := filepath.Abs(*watchDir)
+			ns = filepath.Base(abs)
+		}
+		w, err := watch.New(*watchDir, ns, srv.Indexer())
+		if err != nil {
+			log.Fatalf("failed to start watcher: %v", err)
+		}
+		go func() {
+			if err := w.Run(context.Background()); err != nil {
+				log.Printf("watcher stopped: %v", err)
+			}
+		}()
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{Endpoint: *otlpEndpoint, Service: "vox-vector-engine", SampleRatio: *traceSample})
+	if err != nil {
+		log.Fatalf("failed to configure tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+	if *otlpEndpoint != "" {
+		log.Printf("exporting traces to %s (sample=%g)", *otlpEndpoint, *traceSample)
+	}
 
-	log.Printf("vox-vector-engine listening on %s (data=%s dim=%d)", *addr, *dataDir, *dim)
-	if err := http.ListenAndServe(*addr, srv.Router()); err != nil {
+	srv.SetLimits(api.Limits{MaxBodyBytes: *maxBody, RatePerSec: *rateLimit, Burst: *rateBurst, SearchTimeout: *searchTimeout})
+	srv.Warm()
+	if *readOnly {
+		if *followEvery > 0 {
+			srv.FollowWriter(*followEvery)
+		}
+		log.Printf("read-only mode (follow_interval=%s)", *followEvery)
+	}
+	if *replicaOf != "" {
+		f, err := srv.Follower(*replicaOf)
+		if err != nil {
+			log.Fatalf("failed to start replication: %v", err)
+		}
+		f.Token = *replicaToken
+		go f.Run(context.Background(), *replicaEvery)
+		log.Printf("replica of %s (replica_interval=%s)", *replicaOf, *replicaEvery)
+	}
+	if *trashRetention > 0 && !*readOnly && *replicaOf == "" {
+		srv.StartTrashJanitor(*trashRetention)
+	}
+	if *ingestWorkers > 0 {
+		srv.EnableIngestQueue(*ingestWorkers, *ingestBacklog, *asyncChunks)
+		log.Printf("ingest queue: workers=%d queue=%d async_ingest_chunks=%d", *ingestWorkers, *ingestBacklog, *asyncChunks)
+	}
+
+	listenAddr := *addr
+	if *listenSpec != "" {
+		listenAddr = *listenSpec
+	}
+	token := *authToken
+	if token == "auto" {
+		if token, err = api.NewAuthToken(); err != nil {
+			log.Fatalf("failed to generate an auth token: %v", err)
+		}
+	}
+	if token != "" {
+		srv.SetAuthToken(token)
+		log.Printf("requests need a bearer token")
+	}
+
+	var ln net.Listener
+	if *strictPort {
+		ln, err = listen.Listen(listenAddr)
+	} else {
+		var fellBack bool
+		ln, fellBack, err = listen.ListenFallback(listenAddr)
+		if fellBack {
+			log.Printf("%s is in use, listening on a free port instead", listenAddr)
+		}
+	}
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", listenAddr, err)
+	}
+	tlsOpts := listen.TLSOptions{CertFile: *tlsCert, KeyFile: *tlsKey, ClientCA: *tlsClientCA}
+	discovery := listen.NewDiscovery(listenAddr, ln, tlsOpts.Enabled(), token)
+	if ln, err = listen.WrapTLS(ln, tlsOpts); err != nil {
+		log.Fatalf("failed to configure TLS: %v", err)
+	}
+	if tlsOpts.Enabled() {
+		log.Printf("serving HTTPS (mutual TLS: %v)", tlsOpts.ClientCA != "")
+	}
+	log.Printf("vox-vector-engine listening on %s (data=%s dim=%d)", discovery.Addr, *dataDir, *dim)
+	// A -readonly server shares the directory with its writer, whose file
+	// this is.
+	if !*readOnly {
+		if err := listen.WriteDiscovery(*dataDir, discovery); err != nil {
+			log.Printf("discovery file not written: %v", err)
+		}
+		defer listen.RemoveDiscovery(*dataDir)
+	}
+	httpSrv := &http.Server{Handler: srv.Router()}
+	go func() {
+		<-stopping
+		ctx, cancel := context.WithTimeout(context.Background(), daemon.DefaultStopTimeout)
+		defer cancel()
+		if err := httpSrv.Shutdown(ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+	if err := httpSrv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server failed: %v", err)
 	}
+	if err := srv.Close(); err != nil {
+		log.Printf("close stores: %v", err)
+	}
+	log.Printf("vox-vector-engine stopped")
 }
@@ -0,0 +1,92 @@
+// voxctl manages the engine as a system service, so the memory engine
+// survives IDE restarts and reboots:
+//
+//	voxctl service install -data /var/lib/vox [-name vox-engine] [-exe path] [-- engine flags]
+//	voxctl service start|stop|uninstall [-name vox-engine]
+//	voxctl service unit -data /var/lib/vox [-- engine flags]
+//
+// install registers a Windows service or a systemd unit (-user for a user
+// unit) that runs the engine with -daemon; unit prints that systemd unit
+// instead of installing it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"vox-vector-engine/internal/service"
+)
+
+const usage = "usage: voxctl service install|uninstall|start|stop|unit [flags] [-- engine flags]"
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 3 || os.Args[1] != "service" {
+		log.Fatal(usage)
+	}
+	action := os.Args[2]
+
+	fs := flag.NewFlagSet("voxctl service "+action, flag.ExitOnError)
+	var (
+		name    = fs.String("name", service.DefaultName, "service name")
+		dataDir = fs.String("data", "", "engine data directory (install, unit)")
+		exe     = fs.String("exe", defaultExe(), "engine binary (install, unit)")
+		user    = fs.Bool("user", false, "systemd user unit (systemctl --user) instead of a system one; ignored on Windows")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	// Flags after "--" belong to the engine.
+	fs.Parse(os.Args[3:])
+	cfg := service.Config{Name: *name, Exe: *exe, DataDir: *dataDir, Args: fs.Args(), User: *user}
+
+	switch action {
+	case "install":
+		where, err := service.Install(cfg)
+		if err != nil {
+			log.Fatalf("install: %v", err)
+		}
+		fmt.Printf("installed %s (%s); start it with: voxctl service start -name %s\n", cfg.Name, where, cfg.Name)
+	case "unit":
+		c, err := service.Resolve(cfg)
+		if err != nil {
+			log.Fatalf("unit: %v", err)
+		}
+		fmt.Print(service.SystemdUnit(c))
+	case "uninstall":
+		if err := service.Uninstall(cfg); err != nil {
+			log.Fatalf("uninstall: %v", err)
+		}
+		fmt.Printf("uninstalled %s\n", cfg.Name)
+	case "start":
+		if err := service.Start(cfg); err != nil {
+			log.Fatalf("start: %v", err)
+		}
+		fmt.Printf("started %s\n", cfg.Name)
+	case "stop":
+		if err := service.Stop(cfg); err != nil {
+			log.Fatalf("stop: %v", err)
+		}
+		fmt.Printf("stopped %s\n", cfg.Name)
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// defaultExe is the engine binary next to voxctl.
+func defaultExe() string {
+	self, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	name := "vox-vector-engine"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(filepath.Dir(self), name)
+}
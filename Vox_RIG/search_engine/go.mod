@@ -2,6 +2,19 @@ module vox-vector-engine
 
 go 1.21
 
-require go.etcd.io/bbolt v1.3.8
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	go.etcd.io/bbolt v1.3.8
+	golang.org/x/sys v0.15.0 // For mmap
+	modernc.org/sqlite v1.28.0
+)
 
-require golang.org/x/sys v0.15.0 // indirect; For mmap
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/mattn/go-isatty v0.0.16 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	modernc.org/libc v1.29.0 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.7.2 // indirect
+)
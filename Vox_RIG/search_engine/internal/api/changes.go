@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleChanges serves GET /changes?since=<seq>[&limit=&namespace=&model=]:
+// the ingest, update and delete events recorded after since, for tools that
+// mirror the store incrementally. Pass the returned "next" as the following
+// since; "more" says whether to ask again right away.
+func (s *Server) HandleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	req := commands.ChangesRequest{Namespace: q.Get("namespace"), Model: q.Get("model")}
+	since, ok := queryUint(w, q.Get("since"), "since")
+	if !ok {
+		return
+	}
+	req.Since = since
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "limit must be an integer", http.StatusBadRequest)
+			return
+		}
+		req.Limit = n
+	}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "changes", err)
+		return
+	}
+	res, err := commands.Changes(env, req)
+	if err != nil {
+		writeCommandError(w, "changes", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
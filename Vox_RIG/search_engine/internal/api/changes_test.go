@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"vox-vector-engine/internal/commands"
+)
+
+func TestChangeFeed(t *testing.T) {
+	s, h := newTestServer(t)
+	for i, ns := range []string{"a", "b", "a"} {
+		if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"`+ns+`","conversation_id":"c","role":"user","content":"message `+strconv.Itoa(i)+`","vector":[1,0]}`); code != http.StatusOK {
+			t.Fatalf("Ingest failed: %d %v", code, out)
+		}
+	}
+	if _, err := s.engine.PurgeNamespace("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := func(query string) commands.ChangesResult {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/changes"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /changes%s failed: %d %s", query, w.Code, w.Body)
+		}
+		var res commands.ChangesResult
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := feed("?since=0&limit=2")
+	if len(res.Changes) != 2 || res.Next != 2 || res.LastChange != 4 || !res.More {
+		t.Fatalf("Expected the first 2 of 4 changes, got %+v", res)
+	}
+	res = feed("?since=2")
+	if len(res.Changes) != 2 || res.Changes[1].Op != "delete_namespace" || res.Next != 4 || res.More {
+		t.Fatalf("Expected the last 2 changes, ending with the purge, got %+v", res)
+	}
+
+	res = feed("?namespace=a&limit=1&since=1")
+	if len(res.Changes) != 1 || res.Changes[0].Seq != 3 || res.Next != 3 || !res.More {
+		t.Fatalf("Expected change 3 of namespace a, skipping b's, got %+v", res)
+	}
+	if res = feed("?namespace=a&since=3"); len(res.Changes) != 0 || res.Next != 4 || res.More {
+		t.Errorf("Expected no more changes of namespace a and next past the purge of b, got %+v", res)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/changes?since=x", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad since, got %d", w.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/jobs"
+)
+
+// HandleClusters serves the "memory map" of a namespace. POST /clusters
+// {namespace, k, iterations, exemplars, seed} runs k-means over the stored
+// vectors as a job and saves cluster assignments and exemplar chunks;
+// GET /clusters?namespace=[&chunk_ids=true] returns the saved clustering.
+func (s *Server) HandleClusters(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req := commands.ClustersRequest{Namespace: q.Get("namespace"), ChunkIDs: q.Get("chunk_ids") == "true", Model: q.Get("model")}
+		noteNamespace(r, req.Namespace)
+		env, err := s.envFor(req.Model)
+		if err != nil {
+			writeCommandError(w, "clusters", err)
+			return
+		}
+		res, err := commands.Clusters(env, req)
+		if err != nil {
+			writeCommandError(w, "clusters", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	case http.MethodPost:
+		var req commands.ClusterRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		noteNamespace(r, req.Namespace)
+		if err := req.Validate(); err != nil {
+			writeCommandError(w, "clusters", err)
+			return
+		}
+		env, err := s.envFor(req.Model)
+		if err != nil {
+			writeCommandError(w, "clusters", err)
+			return
+		}
+		s.submitJob(w, "clustering", req.Namespace, func(ctx context.Context) (any, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			res, err := commands.Cluster(ctx, env, req, func(f float64) { jobs.SetProgress(ctx, f) })
+			if err != nil {
+				log.Printf("[clusters] namespace=%s: %v", req.Namespace, err)
+				return nil, errors.New(commands.Message(err))
+			}
+			log.Printf("[clusters] ok namespace=%s chunks=%d k=%d iterations=%d (job)", res.Namespace, res.Chunks, res.K, res.Iterations)
+			for i := range res.Clusters {
+				res.Clusters[i].ChunkIDs = nil
+			}
+			return res, nil
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/jobs"
+)
+
+func TestClusters(t *testing.T) {
+	s, h := newTestServer(t)
+	t.Cleanup(s.jobQueue.Close)
+
+	get := func(path string) (int, []byte) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.Bytes()
+	}
+
+	// Two well separated topics of three documents each.
+	for i := 0; i < 6; i++ {
+		x, y, src := 10.0, 0.0, "server"
+		if i%2 == 1 {
+			x, y, src = 0, 10, "ui"
+		}
+		var chunks []string
+		for j := 0; j < 3; j++ {
+			chunks = append(chunks, fmt.Sprintf(`{"doc_id":"d%d","content":"c%d","vector":[%g,%g]}`, i, j, x+float64(j)/10, y-float64(i)/10))
+		}
+		body := fmt.Sprintf(`{"namespace":"ns","document":{"id":"d%d","source":"%s/f%d.go"},"chunks":[%s]}`, i, src, i, strings.Join(chunks, ","))
+		if code, out := post(t, h, "/v1/ingest", body); code != http.StatusOK {
+			t.Fatalf("Expected ingest to succeed, got %d %v", code, out)
+		}
+	}
+
+	if code, _ := get("/v1/clusters?namespace=ns"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 before clustering, got %d", code)
+	}
+	if code, _ := post(t, h, "/v1/clusters", `{"namespace":"ns","k":-1}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative k, got %d", code)
+	}
+
+	code, out := post(t, h, "/v1/clusters", `{"namespace":"ns","k":2,"exemplars":2}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("Expected the clustering to be queued, got %d %v", code, out)
+	}
+	var job jobs.Job
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && !job.Status.Finished(); time.Sleep(10 * time.Millisecond) {
+		_, body := get("/v1/jobs/" + out["job_id"].(string))
+		json.Unmarshal(body, &job)
+	}
+	if job.Status != jobs.Done || job.Kind != "clustering" {
+		t.Fatalf("Expected the clustering job to finish, got %+v", job)
+	}
+
+	code, body := get("/v1/clusters?namespace=ns&chunk_ids=true")
+	var res engine.Clustering
+	if err := json.Unmarshal(body, &res); err != nil || code != http.StatusOK {
+		t.Fatalf("Expected the saved clustering, got %d %s", code, body)
+	}
+	if res.K != 2 || res.Chunks != 18 || len(res.Clusters) != 2 {
+		t.Fatalf("Expected 18 chunks in 2 clusters, got %+v", res)
+	}
+	for _, cl := range res.Clusters {
+		if cl.Size != 9 || cl.Documents != 3 || len(cl.ChunkIDs) != 9 || len(cl.Exemplars) != 2 {
+			t.Errorf("Expected 9 chunks of 3 documents with 2 exemplars, got %+v", cl)
+		}
+		topic := strings.Split(cl.Sources[0], "/")[0]
+		for _, src := range cl.Sources {
+			if !strings.HasPrefix(src, topic+"/") {
+				t.Errorf("Expected cluster %d to hold one topic, got sources %v", cl.ID, cl.Sources)
+			}
+		}
+	}
+
+	_, body = get("/v1/clusters?namespace=ns")
+	if strings.Contains(string(body), "chunk_ids") {
+		t.Errorf("Expected no assignments without chunk_ids=true, got %s", body)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/namespaces/ns?confirm="+engine.PurgeConfirmToken("ns"), nil))
+	if code, _ := get("/v1/clusters?namespace=ns"); w.Code != http.StatusOK || code != http.StatusNotFound {
+		t.Errorf("Expected a purge to drop the clusters, got %d then %d", w.Code, code)
+	}
+}
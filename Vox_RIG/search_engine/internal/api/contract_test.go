@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"vox-vector-engine/internal/types"
+)
+
+// snakeCase is the casing of every response field (SchemaVersion 2).
+var snakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// dataKeyed fields are maps keyed by user data (metadata keys, namespace
+// and model names), not by schema fields.
+var dataKeyed = map[string]bool{
+	"metadata": true, "namespaces": true, "namespace_counts": true, "shards": true, "models": true, "boosts": true,
+}
+
+// checkKeys reports every object key under path that is not snake_case.
+func checkKeys(t *testing.T, path string, v any) {
+	t.Helper()
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if !snakeCase.MatchString(k) {
+				t.Errorf("%s: field %q is not snake_case", path, k)
+			}
+			if dataKeyed[k] {
+				if m, ok := child.(map[string]any); ok {
+					for _, inner := range m {
+						checkKeys(t, path+"."+k+".*", inner)
+					}
+				}
+				continue
+			}
+			checkKeys(t, path+"."+k, child)
+		}
+	case []any:
+		for _, child := range v {
+			checkKeys(t, path+"[]", child)
+		}
+	}
+}
+
+func TestSchemaFieldsSnakeCase(t *testing.T) {
+	for name, def := range OpenAPI()["components"].(map[string]any)["schemas"].(map[string]any) {
+		props, _ := def.(map[string]any)["properties"].(map[string]any)
+		for field := range props {
+			if !snakeCase.MatchString(field) {
+				t.Errorf("%s: field %q is not snake_case", name, field)
+			}
+		}
+	}
+	// Inline (anonymous) response objects are not components.
+	for _, ep := range endpoints {
+		for _, v := range []any{ep.Request, ep.Response} {
+			if v == nil {
+				continue
+			}
+			typ := reflect.TypeOf(v)
+			if typ.Name() != "" {
+				continue
+			}
+			for i := 0; i < typ.NumField(); i++ {
+				name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+				if !snakeCase.MatchString(name) {
+					t.Errorf("%s %s: inline field %q is not snake_case", ep.Method, ep.Path, name)
+				}
+			}
+		}
+	}
+}
+
+// TestResponseContract drives the endpoints of a live server and checks
+// that every field of every JSON answer is snake_case.
+func TestResponseContract(t *testing.T) {
+	_, h := newTestServer(t)
+	call := func(method, path, body string) any {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if w.Code >= 300 {
+			t.Fatalf("%s %s: expected success, got %d %s", method, path, w.Code, w.Body.String())
+		}
+		var out any
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s %s: expected JSON, got %q", method, path, w.Body.String())
+		}
+		checkKeys(t, method+" "+path, out)
+		return out
+	}
+
+	call(http.MethodPost, "/v1/ingest", `{"namespace":"ns","document":{"id":"d1","source":"a.go","metadata":{"Lang":"go"}},"chunks":[{"doc_id":"d1","content":"alpha","vector":[1,0]},{"doc_id":"d1","content":"beta","vector":[0,1]}]}`)
+	call(http.MethodPost, "/v1/ingest_message", `{"namespace":"ns","conversation_id":"c1","role":"user","content":"hi","vector":[1,1]}`)
+	call(http.MethodPost, "/v1/ingest_document", `{"namespace":"ns","file_path":"a.go","content":"gamma","vector":[1,0],"start_line":1,"end_line":2}`)
+	call(http.MethodPost, "/v1/pins", `{"namespace":"ns","doc_id":"d1"}`)
+	call(http.MethodPut, "/v1/templates", `{"namespace":"ns","chunk":"{{.Content}}"}`)
+	call(http.MethodPost, "/v1/feedback", `{"namespace":"ns","chunk_id":1,"signal":"used"}`)
+	call(http.MethodPatch, "/v1/documents/d1/tags", `{"namespace":"ns","add":["x"]}`)
+	call(http.MethodPatch, "/v1/documents/d1", `{"namespace":"ns","metadata":{"k":"v"}}`)
+	call(http.MethodPut, "/v1/quotas", `{"namespace":"ns","max_chunks":100,"policy":"least_retrieved"}`)
+
+	for _, c := range []struct{ method, path, body string }{
+		{http.MethodGet, "/v1/", ""},
+		{http.MethodGet, "/health", ""},
+		{http.MethodGet, "/readyz", ""},
+		{http.MethodGet, "/v1/stats", ""},
+		{http.MethodPost, "/v1/retrieve", `{"namespace":"ns","query":[1,0],"max_tokens":100}`},
+		{http.MethodPost, "/v1/context", `{"namespace":"ns","query":[1,0],"max_tokens":100}`},
+		{http.MethodPost, "/v1/similar", `{"namespace":"ns","chunk_id":1}`},
+		{http.MethodPost, "/v1/warm", `{"namespace":"ns","queries":[[1,0]]}`},
+		{http.MethodPost, "/v1/index/verify", `{"namespace":"ns"}`},
+		{http.MethodGet, "/v1/search_text?q=alpha&namespace=ns", ""},
+		{http.MethodGet, "/v1/pins?namespace=ns", ""},
+		{http.MethodGet, "/v1/templates", ""},
+		{http.MethodGet, "/v1/quotas", ""},
+		{http.MethodGet, "/v1/quotas?namespace=ns", ""},
+		{http.MethodGet, "/v1/documents/d1/versions?namespace=ns", ""},
+		{http.MethodGet, "/v1/documents/d1?namespace=ns", ""},
+		{http.MethodGet, "/v1/chunks/1?namespace=ns", ""},
+		{http.MethodGet, "/v1/changes", ""},
+		{http.MethodGet, "/v1/jobs", ""},
+		{http.MethodGet, "/v1/replication/status", ""},
+		{http.MethodGet, "/v1/replication/changes", ""},
+		{http.MethodGet, "/v1/replication/document?id=d1", ""},
+		{http.MethodGet, "/v1/replication/chunks?ids=1,2", ""},
+		{http.MethodPost, "/v1/flush", ""},
+		{http.MethodDelete, "/v1/documents/d1?namespace=ns&soft=true", ""},
+		{http.MethodGet, "/v1/trash?namespace=ns", ""},
+		{http.MethodPost, "/v1/documents/d1/restore?namespace=ns", ""},
+		{http.MethodPost, "/v1/reset", `{}`},
+	} {
+		call(c.method, c.path, c.body)
+	}
+}
+
+func keysOf(v any) []string {
+	m, _ := v.(map[string]any)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestRetrieveContract locks the exact fields of the most used answers.
+func TestRetrieveContract(t *testing.T) {
+	_, h := newTestServer(t)
+	decode := func(code int, body map[string]any) map[string]any {
+		t.Helper()
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d %v", code, body)
+		}
+		return body
+	}
+
+	ing := decode(post(t, h, "/v1/ingest", `{"document":{"id":"d1","source":"a.go"},"chunks":[{"doc_id":"d1","content":"alpha","vector":[1,0]}]}`))
+	if got, want := keysOf(ing), []string{"chunk_ids", "doc_id", "status", "vector_count"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected ingest fields %v, got %v", want, got)
+	}
+
+	res := decode(post(t, h, "/v1/retrieve", `{"query":[1,0],"max_tokens":100}`))
+	if got, want := keysOf(res), []string{"chunks", "total_tokens", "truncated"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected retrieve fields %v, got %v", want, got)
+	}
+	chunks, _ := res["chunks"].([]any)
+	if len(chunks) != 1 {
+		t.Fatalf("Expected 1 chunk, got %v", res["chunks"])
+	}
+	if got, want := keysOf(chunks[0]), []string{"chunk", "recency", "similarity"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected scored chunk fields %v, got %v", want, got)
+	}
+	chunk := chunks[0].(map[string]any)["chunk"]
+	if got, want := keysOf(chunk), []string{"content", "doc_id", "end_line", "id", "start_line", "token_count"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected chunk fields %v, got %v", want, got)
+	}
+
+	// The retrieval shows in the access log of the chunk and its document.
+	for _, path := range []string{"/v1/chunks/" + fmt.Sprint(chunk.(map[string]any)["id"]), "/v1/documents/d1"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var got struct {
+			Access *types.ChunkAccess `json:"access"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Access == nil || got.Access.Count != 1 || got.Access.Last.IsZero() {
+			t.Errorf("Expected one access on %s, got %s", path, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/", nil))
+	var info map[string]any
+	json.Unmarshal(w.Body.Bytes(), &info)
+	if info["api_schema"] != float64(SchemaVersion) {
+		t.Errorf("Expected api_schema %d, got %v", SchemaVersion, info["api_schema"])
+	}
+}
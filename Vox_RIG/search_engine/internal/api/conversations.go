@@ -0,0 +1,87 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/compact"
+)
+
+// ConversationSummary is the rolling summary of a conversation.
+type ConversationSummary struct {
+	ConversationID string `json:"conversation_id"`
+	Namespace      string `json:"namespace"`
+	// DocID is the summary document, e.g. for POST /pins.
+	DocID   string `json:"doc_id"`
+	Summary string `json:"summary"`
+	// Messages counts the messages summarized; Through is the timestamp of
+	// the newest one.
+	Messages int    `json:"messages"`
+	Through  string `json:"through"`
+}
+
+// HandleConversations serves the rolling summary of a conversation (see
+// EnableRollingSummaries):
+//
+//	GET  /conversations/{id}/summary?namespace=<ns>  the stored summary
+//	POST /conversations/{id}/summary?namespace=<ns>  refresh it now
+func (s *Server) HandleConversations(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/conversations/")
+	if !strings.HasSuffix(rest, "/summary") {
+		http.NotFound(w, r)
+		return
+	}
+	conv, err := url.PathUnescape(strings.TrimSuffix(rest, "/summary"))
+	if err != nil || conv == "" {
+		http.Error(w, "conversation id is required: /conversations/{id}/summary", http.StatusBadRequest)
+		return
+	}
+	ns := r.URL.Query().Get("namespace")
+	noteNamespace(r, ns)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if s.roller == nil {
+			http.Error(w, "rolling summaries are off (start with -summarize and -summary_every)", http.StatusConflict)
+			return
+		}
+		// The request already holds the store lock.
+		if _, err := s.roller.With(s.shardFor, nil).Refresh(r.Context(), ns, conv); err != nil {
+			writeCommandError(w, "summary", &commands.Error{Kind: commands.Upstream, Msg: "Failed to refresh summary", Err: err})
+			return
+		}
+		log.Printf("[summary] refreshed namespace=%s conversation_id=%s", ns, conv)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sh, err := s.shardFor(ns)
+	if err != nil {
+		writeCommandError(w, "summary", err)
+		return
+	}
+	doc, text, err := compact.RollingSummary(sh, conv)
+	if err != nil {
+		writeCommandError(w, "summary", err)
+		return
+	}
+	if doc == nil || doc.Metadata["namespace"] != ns {
+		http.Error(w, "conversation has no summary yet", http.StatusNotFound)
+		return
+	}
+	messages, _ := doc.Metadata["messages"].(float64)
+	through, _ := doc.Metadata["through"].(string)
+	writeJSON(w, http.StatusOK, ConversationSummary{
+		ConversationID: conv,
+		Namespace:      ns,
+		DocID:          doc.ID,
+		Summary:        text,
+		Messages:       int(messages),
+		Through:        through,
+	})
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleDocuments reads, edits, deletes and restores stored documents
+// without re-ingesting them:
+//
+//	GET    /documents/{id}           the document with all its chunks
+//	PATCH  /documents/{id}           {namespace, metadata, touch | timestamp, model}
+//	PATCH  /documents/{id}/tags      {namespace, tags | add | remove, model}
+//	DELETE /documents/{id}           ?soft=true moves it to the trash (GET /trash)
+//	POST   /documents/{id}/restore   brings it back from the trash
+//	GET    /documents/{id}/versions  the kept versions of a re-indexed file
+//
+// Document IDs often contain slashes (file paths); they may be sent raw or
+// escaped. GET, DELETE, restore and versions take namespace and model as
+// query parameters.
+func (s *Server) HandleDocuments(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/documents/")
+	var action string
+	switch {
+	case r.Method == http.MethodPatch && strings.HasSuffix(rest, "/tags"):
+		action = "/tags"
+	case r.Method == http.MethodPost && strings.HasSuffix(rest, "/restore"):
+		action = "/restore"
+	case r.Method == http.MethodGet && strings.HasSuffix(rest, "/versions"):
+		action = "/versions"
+	case r.Method == http.MethodGet, r.Method == http.MethodPatch, r.Method == http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := url.PathUnescape(strings.TrimSuffix(rest, action))
+	if err != nil || id == "" {
+		http.Error(w, "document id is required: "+r.Method+" /documents/{id}"+action, http.StatusBadRequest)
+		return
+	}
+	switch {
+	case action == "/tags":
+		s.patchTags(w, r, id)
+		return
+	case action == "/restore":
+		s.restoreDocument(w, r, id)
+		return
+	case action == "/versions":
+		s.documentVersions(w, r, id)
+		return
+	case r.Method == http.MethodGet:
+		s.getDocument(w, r, id)
+		return
+	case r.Method == http.MethodDelete:
+		s.deleteDocument(w, r, id)
+		return
+	}
+
+	var req commands.UpdateDocumentRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.DocID = id
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	res, err := commands.UpdateDocument(env, req)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	log.Printf("[documents] updated doc_id=%s namespace=%s keys=%d", id, req.Namespace, len(req.Metadata))
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) patchTags(w http.ResponseWriter, r *http.Request, id string) {
+	var req commands.TagsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.DocID = id
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "tags", err)
+		return
+	}
+	res, err := commands.SetTags(env, req)
+	if err != nil {
+		writeCommandError(w, "tags", err)
+		return
+	}
+	log.Printf("[tags] doc_id=%s namespace=%s tags=%v", id, req.Namespace, res.Tags)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// documentVersions serves GET /documents/{id}/versions[?namespace=&model=].
+func (s *Server) documentVersions(w http.ResponseWriter, r *http.Request, id string) {
+	q := r.URL.Query()
+	req := commands.DocumentVersionsRequest{DocID: id, Namespace: q.Get("namespace"), Model: q.Get("model")}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	res, err := commands.DocumentVersions(env, req)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// getDocument serves GET /documents/{id}[?namespace=&model=].
+func (s *Server) getDocument(w http.ResponseWriter, r *http.Request, id string) {
+	q := r.URL.Query()
+	req := commands.GetDocumentRequest{DocID: id, Namespace: q.Get("namespace"), Model: q.Get("model")}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	res, err := commands.GetDocument(env, req)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleChunks serves GET /chunks/{id}[?namespace=&model=]: one stored chunk
+// with its document, e.g. to re-fetch a retrieved snippet by ID.
+func (s *Server) HandleChunks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/chunks/"), 10, 64)
+	if err != nil {
+		http.Error(w, "chunk id must be a number: GET /chunks/{id}", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	req := commands.GetChunkRequest{ChunkID: id, Namespace: q.Get("namespace"), Model: q.Get("model")}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "chunks", err)
+		return
+	}
+	res, err := commands.GetChunk(env, req)
+	if err != nil {
+		writeCommandError(w, "chunks", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
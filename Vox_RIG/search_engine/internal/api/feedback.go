@@ -0,0 +1,35 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleFeedback serves POST /feedback {namespace, chunk_id, signal}: the
+// IDE reports after each agent turn whether a retrieved chunk was used,
+// ignored or harmful, which later retrievals weigh in (feedback_weight).
+func (s *Server) HandleFeedback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req commands.FeedbackRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	noteNamespace(r, req.Namespace)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "feedback", err)
+		return
+	}
+	res, err := commands.Feedback(env, req)
+	if err != nil {
+		writeCommandError(w, "feedback", err)
+		return
+	}
+	log.Printf("[feedback] namespace=%s chunk_id=%d signal=%s score=%.3f", req.Namespace, res.ChunkID, req.Signal, res.Score)
+	writeJSON(w, http.StatusOK, res)
+}
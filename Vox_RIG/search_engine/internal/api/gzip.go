@@ -0,0 +1,105 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// gzipResponseWriter compresses the body once the handler starts writing it.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code != http.StatusNoContent && code != http.StatusNotModified {
+			h := w.Header()
+			h.Del("Content-Length")
+			h.Set("Content-Encoding", "gzip")
+			w.gz = gzipWriters.Get().(*gzip.Writer)
+			w.gz.Reset(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		_ = w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding
+// without disabling it (q=0).
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			q := strings.ReplaceAll(params, " ", "")
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
+	}
+	return false
+}
+
+// withGzip decompresses request bodies sent with Content-Encoding: gzip and
+// compresses responses for clients that accept it. It sits outside
+// withLimits, so the body size limit applies to the decompressed stream.
+func (s *Server) withGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch enc := strings.TrimSpace(r.Header.Get("Content-Encoding")); {
+		case strings.EqualFold(enc, "gzip"):
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "bad_gzip", "request body is not valid gzip: "+err.Error())
+				return
+			}
+			defer zr.Close()
+			r.Body = zr
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		case enc != "" && !strings.EqualFold(enc, "identity"):
+			writeAPIError(w, http.StatusUnsupportedMediaType, "unsupported_encoding", "unsupported Content-Encoding: "+enc)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithGzip(t *testing.T) {
+	s := &Server{}
+	s.SetLimits(Limits{MaxBodyBytes: 64})
+	h := s.withGzip(s.withLimits(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]any
+		if decodeJSON(w, r, &v) {
+			writeJSON(w, http.StatusOK, v)
+		}
+	})))
+
+	gz := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return &buf
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/retrieve", gz(`{"namespace":"ns"}`))
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set("Accept-Encoding", "br, gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzipped 200, got %d %v", w.Code, w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Response is not gzip: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !strings.Contains(string(body), `"namespace":"ns"`) {
+		t.Errorf("Unexpected response body: %s", body)
+	}
+
+	// The limit applies to the decompressed body.
+	r = httptest.NewRequest(http.MethodPost, "/retrieve", gz(`{"a":"`+strings.Repeat("x", 200)+`"}`))
+	r.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large decompressed body, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/retrieve", strings.NewReader("not gzip"))
+	r.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a corrupt gzip body, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/retrieve", strings.NewReader(`{}`))
+	r.Header.Set("Accept-Encoding", "gzip;q=0")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "" || strings.TrimSpace(w.Body.String()) != "{}" {
+		t.Errorf("Expected an uncompressed response with gzip;q=0, got %v %q", w.Header(), w.Body)
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIngestDocument(t *testing.T) {
+	_, h := newTestServer(t)
+
+	code, out := post(t, h, "/v1/ingest_document", `{"namespace":"ns","file_path":"src/a.go","content":"func a() {}","vector":[1,0],"start_line":3,"end_line":5}`)
+	if code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+	// The same document ID as `-cmd ingest_document`.
+	if out["doc_id"] != "file:ns:src/a.go:3-5" || out["status"] != "ingested" {
+		t.Errorf("Unexpected result %v", out)
+	}
+	if code, out := post(t, h, "/v1/retrieve", `{"namespace":"ns","query":[1,0],"max_tokens":100}`); code != http.StatusOK || len(out["chunks"].([]any)) != 1 {
+		t.Errorf("Expected the chunk to be retrievable, got %d %v", code, out)
+	}
+
+	if code, _ := post(t, h, "/v1/ingest_document", `{"namespace":"ns","content":"x","vector":[1,0]}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without file_path, got %d", code)
+	}
+}
+
+func TestIngestDocumentChunks(t *testing.T) {
+	_, h := newTestServer(t)
+	get := func(path string) (int, map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var out map[string]any
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+
+	if code, out := post(t, h, "/v1/ingest_document", `{"namespace":"ns","file_path":"a.go","content":"old","vector":[1,0],"start_line":1,"end_line":1}`); code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+
+	// The second chunk starts after the first and ends with its content;
+	// the third is placed explicitly past a gap.
+	body := `{"namespace":"ns","file_path":"a.go","chunks":[
+		{"content":"package a\n\nimport \"fmt\"\n","vector":[1,0],"end_line":3},
+		{"content":"func a() {\n}\n","vector":[0,1]},
+		{"content":"func b() {}","vector":[1,1],"start_line":8}]}`
+	code, out := post(t, h, "/v1/ingest_document", body)
+	if code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+	if out["doc_id"] != "file:ns:a.go" || len(out["chunk_ids"].([]any)) != 3 || out["replaced"] != float64(1) {
+		t.Errorf("Unexpected result %v", out)
+	}
+
+	code, out = get("/v1/documents/file:ns:a.go?namespace=ns")
+	if code != http.StatusOK {
+		t.Fatalf("Get failed: %d %v", code, out)
+	}
+	doc := out["document"].(map[string]any)
+	if hash, _ := doc["metadata"].(map[string]any)["content_sha256"].(string); len(hash) != 64 {
+		t.Errorf("Expected a content hash on the document, got %v", doc["metadata"])
+	}
+	var lines []string
+	for _, c := range out["chunks"].([]any) {
+		c := c.(map[string]any)
+		lines = append(lines, fmt.Sprintf("%v-%v", c["start_line"], c["end_line"]))
+	}
+	if got := strings.Join(lines, " "); got != "1-3 4-5 8-8" {
+		t.Errorf("Expected stitched lines 1-3 4-5 8-8, got %s", got)
+	}
+	if code, out := get("/v1/documents/file:ns:a.go:1-1?namespace=ns"); code != http.StatusNotFound {
+		t.Errorf("Expected the range document to be replaced, got %d %v", code, out)
+	}
+
+	// Storing the file again replaces its chunks.
+	if code, out := post(t, h, "/v1/ingest_document", `{"namespace":"ns","file_path":"a.go","content_hash":"abc","chunks":[{"content":"x","vector":[1,0]}]}`); code != http.StatusOK || out["replaced"] != float64(3) {
+		t.Errorf("Expected 3 chunks replaced, got %d %v", code, out)
+	}
+
+	for _, bad := range []string{
+		`{"namespace":"ns","file_path":"a.go","chunks":[{"content":"x","vector":[1,0],"end_line":4},{"content":"y","vector":[1,0],"start_line":3}]}`,
+		`{"namespace":"ns","file_path":"a.go","chunks":[{"content":"x","vector":[1,0],"start_line":5,"end_line":4}]}`,
+		`{"namespace":"ns","file_path":"a.go","content":"x","vector":[1,0],"chunks":[{"content":"x","vector":[1,0]}]}`,
+		`{"namespace":"ns","file_path":"a.go","chunks":[{"content":"x","vector":[1,0,0]}]}`,
+	} {
+		if code, out := post(t, h, "/v1/ingest_document", bad); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d %v", bad, code, out)
+		}
+	}
+	// The rejected requests left the file alone.
+	if code, out := get("/v1/documents/file:ns:a.go?namespace=ns"); code != http.StatusOK || len(out["chunks"].([]any)) != 1 {
+		t.Errorf("Expected the file to keep its chunk, got %d %v", code, out)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/types"
+)
+
+// IngestStreamRecord is one line of a POST /ingest_stream body.
+//
+// A record carrying a document saves it and makes it the current document;
+// the chunk (if any) is then ingested into the current document's shard.
+// chunk.doc_id defaults to the current document's ID, so a stream usually
+// looks like one document record followed by chunk-only records.
+type IngestStreamRecord struct {
+	Namespace string          `json:"namespace,omitempty"`
+	Model     string          `json:"model,omitempty"` // embedding space; read with the document
+	Document  *types.Document `json:"document,omitempty"`
+	Chunk     *IngestChunk    `json:"chunk,omitempty"`
+}
+
+// ingestStreamStatus is written back as one NDJSON line per input record.
+type ingestStreamStatus struct {
+	Line    int     `json:"line"`
+	Status  string  `json:"status"`
+	DocID   string  `json:"doc_id,omitempty"`
+	ChunkID *uint64 `json:"chunk_id,omitempty"`
+	Error   string  `json:"error,omitempty"`
+	// Scrubbed reports what was redacted from the chunk.
+	Scrubbed *scrub.Report `json:"scrubbed,omitempty"`
+	Summary  *summary      `json:"summary,omitempty"`
+}
+
+type summary struct {
+	Records     int    `json:"records"`
+	Documents   int    `json:"documents"`
+	Chunks      int    `json:"chunks"`
+	Errors      int    `json:"errors"`
+	VectorCount uint64 `json:"vector_count"`
+	Redactions  int    `json:"redactions,omitempty"`
+}
+
+// HandleIngestStream serves POST /ingest_stream. The body is newline-delimited
+// JSON (IngestStreamRecord per line) and may be sent chunked; records are
+// processed as they arrive and a status line is streamed back for each one,
+// followed by a final "done" line with totals. A bad record does not end the
+// stream; the client canceling the request does, without a "done" line.
+func (s *Server) HandleIngestStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Status lines are written while the body is still being read.
+	rc := http.NewResponseController(w)
+	_ = rc.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	emit := func(st ingestStreamStatus) {
+		_ = enc.Encode(st)
+		_ = rc.Flush()
+	}
+
+	var st streamState
+	br := bufio.NewReader(r.Body)
+	for {
+		raw, readErr := br.ReadBytes('\n')
+		if err := r.Context().Err(); err != nil {
+			// The client is gone: stop before ingesting anything more.
+			log.Printf("[ingest_stream] canceled after line=%d: %v", st.line, err)
+			return
+		}
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 {
+			emit(s.ingestStreamLine(r.Context(), &st, raw))
+		}
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				log.Printf("[ingest_stream] read error after line=%d: %v", st.line, readErr)
+				emit(ingestStreamStatus{Line: st.line, Status: "error", Error: "read error: " + readErr.Error()})
+				st.sum.Errors++
+			}
+			break
+		}
+	}
+
+	sum := st.sum
+	sum.VectorCount = s.vectorCount()
+	log.Printf("[ingest_stream] done records=%d documents=%d chunks=%d errors=%d",
+		sum.Records, sum.Documents, sum.Chunks, sum.Errors)
+	emit(ingestStreamStatus{Line: st.line, Status: "done", Summary: &sum})
+}
+
+// streamState is carried from one record of a stream to the next.
+type streamState struct {
+	line  int
+	env   commands.Env
+	sh    *engine.Shard
+	docID string
+	sum   summary
+}
+
+func (s *Server) ingestStreamLine(ctx context.Context, st *streamState, raw []byte) ingestStreamStatus {
+	st.line++
+	st.sum.Records++
+
+	fail := func(msg string) ingestStreamStatus {
+		st.sum.Errors++
+		return ingestStreamStatus{Line: st.line, Status: "error", DocID: st.docID, Error: msg}
+	}
+
+	var rec IngestStreamRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return fail(err.Error())
+	}
+
+	if rec.Document != nil {
+		env, err := s.envFor(rec.Model)
+		if err != nil {
+			return fail(commands.Message(err))
+		}
+		sh, err := commands.SaveDocument(ctx, env, rec.Namespace, rec.Document)
+		if err != nil {
+			log.Printf("[ingest_stream] line=%d %v", st.line, err)
+			return fail(commands.Message(err))
+		}
+		st.env, st.sh, st.docID = env, sh, rec.Document.ID
+		st.sum.Documents++
+	}
+
+	res := ingestStreamStatus{Line: st.line, Status: "ok", DocID: st.docID}
+	if rec.Chunk == nil {
+		return res
+	}
+	if st.sh == nil {
+		return fail("chunk record before any document record")
+	}
+	if rec.Chunk.DocID == "" {
+		rec.Chunk.DocID = st.docID
+	}
+	chunks := []IngestChunk{*rec.Chunk}
+	scrubbed, err := commands.ScrubChunks(ctx, st.env, chunks)
+	if err != nil {
+		log.Printf("[ingest_stream] line=%d %v", st.line, err)
+		return fail(commands.Message(err))
+	}
+	ids, err := commands.AppendChunks(ctx, st.env, st.sh, chunks)
+	if err != nil {
+		log.Printf("[ingest_stream] line=%d %v", st.line, err)
+		return fail(commands.Message(err))
+	}
+	res.ChunkID = &ids[0]
+	res.Scrubbed = scrubbed
+	st.sum.Chunks++
+	st.sum.Redactions += scrubbed.Total()
+	return res
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamLines decodes the NDJSON status lines of an /ingest_stream response.
+func streamLines(t *testing.T, body string) []ingestStreamStatus {
+	t.Helper()
+	var out []ingestStreamStatus
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		var st ingestStreamStatus
+		if err := json.Unmarshal(sc.Bytes(), &st); err != nil {
+			t.Fatalf("bad status line %q: %v", sc.Text(), err)
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+func TestIngestStream(t *testing.T) {
+	_, h := newTestServer(t)
+	body := strings.Join([]string{
+		`{"namespace":"ns","document":{"id":"d1","source":"a.go"},"chunk":{"content":"one","vector":[1,0]}}`,
+		``,
+		`{"chunk":{"content":"two","vector":[0,1]}}`,
+	}, "\n")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/ingest_stream", strings.NewReader(body)))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Stream failed: %d %s", w.Code, w.Body)
+	}
+
+	lines := streamLines(t, w.Body.String())
+	if len(lines) != 3 {
+		t.Fatalf("Expected two records and a done line, got %s", w.Body)
+	}
+	for i, st := range lines[:2] {
+		if st.Line != i+1 || st.Status != "ok" || st.DocID != "d1" || st.ChunkID == nil {
+			t.Errorf("Unexpected status for line %d: %+v", i+1, st)
+		}
+	}
+	done := lines[2]
+	if done.Status != "done" || done.Summary == nil {
+		t.Fatalf("Expected a done line, got %+v", done)
+	}
+	if sum := *done.Summary; sum.Records != 2 || sum.Documents != 1 || sum.Chunks != 2 || sum.Errors != 0 || sum.VectorCount != 2 {
+		t.Errorf("Unexpected summary %+v", sum)
+	}
+	if code, out := post(t, h, "/v1/retrieve", `{"namespace":"ns","query":[0,1],"max_tokens":100}`); code != http.StatusOK || len(out["chunks"].([]any)) != 2 {
+		t.Errorf("Expected both chunks to be retrievable, got %d %v", code, out)
+	}
+}
+
+func TestIngestStreamMalformedRecord(t *testing.T) {
+	_, h := newTestServer(t)
+	body := strings.Join([]string{
+		`{"chunk":{"content":"orphan","vector":[1,0]}}`,
+		`{"namespace":"ns","document":{"id":"d1","source":"a.go"}}`,
+		`{"chunk":{"content":"one",`,
+		`{"chunk":{"content":"two","vector":[0,1]}}`,
+	}, "\n")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/ingest_stream", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Stream failed: %d %s", w.Code, w.Body)
+	}
+
+	lines := streamLines(t, w.Body.String())
+	if len(lines) != 5 {
+		t.Fatalf("Expected four records and a done line, got %s", w.Body)
+	}
+	want := []string{"error", "ok", "error", "ok", "done"}
+	for i, st := range lines {
+		if st.Status != want[i] {
+			t.Errorf("Line %d: expected %s, got %+v", i+1, want[i], st)
+		}
+	}
+	if lines[2].Error == "" || lines[2].DocID != "d1" {
+		t.Errorf("Expected the malformed record to be reported against d1, got %+v", lines[2])
+	}
+	if lines[3].ChunkID == nil {
+		t.Errorf("Expected the record after the malformed one to be ingested, got %+v", lines[3])
+	}
+	if sum := lines[4].Summary; sum == nil || sum.Records != 4 || sum.Chunks != 1 || sum.Errors != 2 {
+		t.Errorf("Unexpected summary %+v", sum)
+	}
+}
+
+func TestIngestStreamClientCancel(t *testing.T) {
+	s, h := newTestServer(t)
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/ingest_stream", pr).WithContext(ctx)
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		h.ServeHTTP(w, req)
+	}()
+
+	if _, err := io.WriteString(pw, `{"namespace":"ns","document":{"id":"d1","source":"a.go"},"chunk":{"content":"one","vector":[1,0]}}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.vecs.Count() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the first record was never ingested")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	// The body is never closed: the handler must stop on the canceled
+	// context rather than wait for the end of the stream.
+	go io.WriteString(pw, `{"chunk":{"content":"two","vector":[0,1]}}`+"\n")
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler kept reading after the client canceled")
+	}
+
+	if n := s.vecs.Count(); n != 1 {
+		t.Errorf("Expected nothing ingested after the cancel, got %d vectors", n)
+	}
+	for _, st := range streamLines(t, w.Body.String()) {
+		if st.Status == "done" {
+			t.Errorf("Expected no done line for a canceled stream, got %+v", st)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/chunker"
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/embed"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/types"
+)
+
+// IngestTextRequest carries a whole file; the server chunks and embeds it.
+type IngestTextRequest struct {
+	Namespace string         `json:"namespace,omitempty"`
+	Document  types.Document `json:"document"`
+	Content   string         `json:"content"`
+	// Strategy is "line", "paragraph" or "code"; empty picks one from Document.Source.
+	Strategy string `json:"strategy,omitempty"`
+	MaxLines int    `json:"max_lines,omitempty"`
+	Overlap  int    `json:"overlap,omitempty"`
+}
+
+// SetEmbedder configures the provider used to embed server-side chunks.
+func (s *Server) SetEmbedder(p embed.Provider) {
+	s.embedder = p
+}
+
+// HandleIngestText serves POST /ingest_text. Without an embedding provider the
+// chunks are returned unembedded (status "chunked") so the caller can embed
+// them itself and send them to /ingest.
+func (s *Server) HandleIngestText(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req IngestTextRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	noteNamespace(r, req.Namespace)
+	if req.Content == "" {
+		http.Error(w, "content is required", http.StatusBadRequest)
+		return
+	}
+	if req.Document.ID == "" {
+		if req.Document.Source == "" {
+			http.Error(w, "document.id or document.source is required", http.StatusBadRequest)
+			return
+		}
+		req.Document.ID = ids.File(req.Namespace, req.Document.Source)
+	}
+
+	opts := chunker.Options{MaxLines: req.MaxLines, Overlap: req.Overlap}
+	strategy := chunker.ForPath(req.Document.Source, opts)
+	if req.Strategy != "" {
+		var err error
+		if strategy, err = chunker.ForName(req.Strategy, opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pieces := strategy.Chunk(req.Content)
+
+	// Scrub before anything leaves the request: the chunks echoed back,
+	// the embedder and the stores only ever see redacted content.
+	texts := make([]string, len(pieces))
+	for i, p := range pieces {
+		texts[i] = p.Content
+	}
+	scrubbed, err := commands.ScrubTexts(r.Context(), s.env(), texts)
+	if err != nil {
+		writeCommandError(w, "ingest_text", err)
+		return
+	}
+	for i := range pieces {
+		pieces[i].Content = texts[i]
+	}
+
+	if s.embedder == nil {
+		writeJSON(w, http.StatusOK, withScrubbed(map[string]any{
+			"status":   "chunked",
+			"doc_id":   req.Document.ID,
+			"strategy": strategy.Name(),
+			"chunks":   pieces,
+		}, scrubbed))
+		return
+	}
+
+	vecs, err := s.embedder.Embed(r.Context(), texts)
+	if err != nil {
+		log.Printf("[ingest_text] embed failed doc_id=%s provider=%s: %v", req.Document.ID, s.embedder.Name(), err)
+		http.Error(w, "Failed to embed chunks", http.StatusBadGateway)
+		return
+	}
+	if len(vecs) != len(pieces) {
+		log.Printf("[ingest_text] provider=%s returned %d vectors for %d chunks", s.embedder.Name(), len(vecs), len(pieces))
+		http.Error(w, "Failed to embed chunks", http.StatusBadGateway)
+		return
+	}
+	if len(vecs) > 0 && len(vecs[0]) != s.vecs.Dim() {
+		log.Printf("[ingest_text] provider=%s returned dimension %d, store expects %d", s.embedder.Name(), len(vecs[0]), s.vecs.Dim())
+		http.Error(w, fmt.Sprintf("Embedding provider returned dimension %d, expected %d", len(vecs[0]), s.vecs.Dim()), http.StatusBadGateway)
+		return
+	}
+
+	chunks := make([]IngestChunk, len(pieces))
+	for i, p := range pieces {
+		var md types.Metadata
+		if p.Symbol != "" {
+			md = types.Metadata{"symbol": p.Symbol, "kind": p.Kind}
+		}
+		chunks[i] = IngestChunk{
+			DocID:      req.Document.ID,
+			Vector:     vecs[i],
+			Content:    p.Content,
+			StartLine:  p.StartLine,
+			EndLine:    p.EndLine,
+			TokenCount: s.tokens.Count(p.Content),
+			Metadata:   md,
+		}
+	}
+
+	log.Printf("[ingest_text] doc_id=%s source=%s strategy=%s chunks=%d namespace=%v",
+		req.Document.ID, req.Document.Source, strategy.Name(), len(chunks), req.Namespace)
+
+	release, err := s.acquireIngest(r.Context())
+	if err != nil {
+		http.Error(w, "Request canceled", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+	if req.Document.Metadata == nil {
+		req.Document.Metadata = types.Metadata{}
+	}
+	req.Document.Metadata[engine.MetaEmbeddingModel] = s.embedder.Name()
+	sh, err := commands.SaveDocument(r.Context(), s.env(), req.Namespace, &req.Document)
+	if err != nil {
+		writeCommandError(w, "ingest_text", err)
+		return
+	}
+	chunkIDs, err := commands.AppendChunks(r.Context(), s.env(), sh, chunks)
+	if err != nil {
+		writeCommandError(w, "ingest_text", err)
+		return
+	}
+	ns, _ := req.Document.Metadata["namespace"].(string)
+	if _, err := sh.Engine.ClaimModelTag(ns, s.embedder.Name()); err != nil {
+		log.Printf("[ingest_text] recording embedding model namespace=%s: %v", ns, err)
+	}
+
+	writeJSON(w, http.StatusOK, withScrubbed(map[string]any{
+		"status":       "ingested",
+		"doc_id":       req.Document.ID,
+		"strategy":     strategy.Name(),
+		"chunk_ids":    chunkIDs,
+		"chunks":       pieces,
+		"vector_count": sh.Vectors.Count(),
+	}, scrubbed))
+}
+
+// withScrubbed adds the scrub report to a response, when there is one.
+func withScrubbed(out map[string]any, rep *scrub.Report) map[string]any {
+	if rep != nil {
+		out["scrubbed"] = rep
+	}
+	return out
+}
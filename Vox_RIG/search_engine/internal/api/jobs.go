@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/ingest"
+	"vox-vector-engine/internal/jobs"
+)
+
+// DefaultAsyncIngestChunks is the batch size from which /ingest answers 202
+// with a job ID instead of waiting, when the ingest queue is enabled.
+const DefaultAsyncIngestChunks = 256
+
+// EnableIngestQueue bounds concurrent ingest writes to workers, so bursts
+// from repository indexing cannot starve /retrieve of the vector store
+// lock. /ingest batches of at least asyncChunks chunks (0 = never) become
+// jobs, and the job queue holds up to backlog waiting jobs of any kind;
+// smaller batches wait for a worker slot in the request. Tenants ingest
+// synchronously, as before. Call it before the first job is submitted.
+func (s *Server) EnableIngestQueue(workers, backlog, asyncChunks int) {
+	workers = max(workers, 1)
+	s.ingestSlots = make(chan struct{}, workers)
+	s.jobQueue.Workers = max(workers, jobs.DefaultWorkers)
+	s.jobQueue.Backlog = max(backlog, 1)
+	s.asyncIngestChunks = asyncChunks
+}
+
+// PersistJobs keeps job records in the JSON file path, so GET /jobs still
+// answers for jobs finished before a restart; jobs cut short by the restart
+// are reported as failed.
+func (s *Server) PersistJobs(path string) error {
+	return s.jobQueue.Persist(path)
+}
+
+// acquireIngest waits for an ingest slot and returns its release; a no-op
+// without an ingest queue. Callers hold s.mu for reading, so a slot holder
+// never waits on the store lock.
+func (s *Server) acquireIngest(ctx context.Context) (func(), error) {
+	if s.ingestSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.ingestSlots <- struct{}{}:
+		return func() { <-s.ingestSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// submitJob queues fn and answers 202 with the job ID, or 503 when the
+// backlog is full. Jobs run outside any request, so fn takes the store lock
+// itself when it needs it.
+func (s *Server) submitJob(w http.ResponseWriter, kind, ns string, fn jobs.Func) (jobs.Job, bool) {
+	job, err := s.jobQueue.Submit(kind, ns, fn)
+	if err != nil {
+		log.Printf("[jobs] kind=%s namespace=%s not queued: %v", kind, ns, err)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Job queue is full, retry later", http.StatusServiceUnavailable)
+		return job, false
+	}
+	log.Printf("[jobs] queued id=%s kind=%s namespace=%s pending=%d", job.ID, kind, ns, s.jobQueue.Pending())
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "queued", "job_id": job.ID})
+	return job, true
+}
+
+// queueIngest runs req as a background job and answers 202 with its ID, or
+// 503 when the backlog is full.
+func (s *Server) queueIngest(w http.ResponseWriter, req IngestRequest) {
+	s.submitJob(w, "ingest", req.Namespace, func(ctx context.Context) (any, error) {
+		// Take the store lock before a slot (see acquireIngest).
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		release, err := s.acquireIngest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		env, err := s.envFor(req.Model)
+		if err == nil {
+			var res commands.IngestResult
+			if res, err = commands.Ingest(ctx, env, req); err == nil {
+				log.Printf("[ingest] ok doc_id=%s ingested=%d vec_count=%d (async)", res.DocID, len(res.ChunkIDs), res.VectorCount)
+				return res, nil
+			}
+		}
+		log.Printf("[ingest] doc_id=%s async: %v", req.Document.ID, err)
+		return nil, errors.New(commands.Message(err))
+	})
+}
+
+// HandleJobs serves GET /jobs (every remembered job, newest first, filtered
+// by ?kind= and ?status=), GET /jobs/{id} and DELETE /jobs/{id}, which
+// cancels a queued or running job.
+func (s *Server) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	if strings.Contains(id, "/") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		kind, status := r.URL.Query().Get("kind"), jobs.Status(r.URL.Query().Get("status"))
+		list := []jobs.Job{}
+		for _, job := range s.jobQueue.List() {
+			if (kind == "" || job.Kind == kind) && (status == "" || job.Status == status) {
+				list = append(list, job)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"jobs": list})
+	case id != "" && r.Method == http.MethodGet:
+		job, ok := s.jobQueue.Get(id)
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case id != "" && r.Method == http.MethodDelete:
+		job, err := s.jobQueue.Cancel(id)
+		switch {
+		case errors.Is(err, jobs.ErrNotFound):
+			http.Error(w, "job not found", http.StatusNotFound)
+		case errors.Is(err, jobs.ErrFinished):
+			http.Error(w, "job already "+string(job.Status), http.StatusConflict)
+		default:
+			log.Printf("[jobs] cancel id=%s kind=%s status=%s", job.ID, job.Kind, job.Status)
+			writeJSON(w, http.StatusOK, job)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCompact serves POST /compact: one chat compaction pass over every
+// namespace, run as a job (see Compactor).
+func (s *Server) HandleCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.compactor == nil {
+		http.Error(w, "compaction is off (start with -summarize and -compact_age or -compact_keep)", http.StatusConflict)
+		return
+	}
+	c := s.compactor
+	s.submitJob(w, "compaction", "", func(ctx context.Context) (any, error) {
+		// The compactor takes the store lock itself, around store access only.
+		res, err := c.Compact(ctx)
+		if err != nil {
+			log.Printf("[compact] failed: %v", err)
+			return nil, err
+		}
+		log.Printf("[compact] conversations=%d summaries=%d messages=%d skipped=%d (job)",
+			res.Conversations, res.Summaries, res.Messages, res.Skipped)
+		return res, nil
+	})
+}
+
+// IngestDirRequest is the body of POST /ingest_dir.
+type IngestDirRequest struct {
+	Namespace string `json:"namespace"`
+	// Path is a directory on the server's machine.
+	Path string `json:"path"`
+}
+
+// HandleIngestDir serves POST /ingest_dir {namespace, path}: it indexes
+// every text file under path, as `vox ingest_dir` does, in a job whose
+// progress is the share of files handled.
+func (s *Server) HandleIngestDir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req IngestDirRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	noteNamespace(r, req.Namespace)
+	if req.Path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	if s.embedder == nil {
+		http.Error(w, ingest.ErrNoEmbedder.Error(), http.StatusConflict)
+		return
+	}
+	ix := s.Indexer()
+	s.submitJob(w, "ingest_dir", req.Namespace, func(ctx context.Context) (any, error) {
+		// The indexer takes the store lock itself, around each file.
+		res, err := ix.IndexDir(ctx, req.Namespace, req.Path, func(p ingest.DirProgress) {
+			jobs.SetProgress(ctx, float64(p.Done)/float64(p.Total))
+		})
+		if err != nil {
+			log.Printf("[ingest_dir] path=%s namespace=%s: %v", req.Path, req.Namespace, err)
+			return nil, err
+		}
+		log.Printf("[ingest_dir] ok path=%s namespace=%s files=%d indexed=%d chunks=%d errors=%d",
+			res.Root, res.Namespace, res.Files, res.Indexed, res.Chunks, len(res.Errors))
+		return res, nil
+	})
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/jobs"
+)
+
+func TestIngestQueue(t *testing.T) {
+	s, h := newTestServer(t)
+	s.EnableIngestQueue(1, 4, 2)
+	t.Cleanup(s.jobQueue.Close)
+
+	getJob := func(id string) (int, jobs.Job) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/jobs/"+id, nil))
+		var job jobs.Job
+		json.Unmarshal(w.Body.Bytes(), &job)
+		return w.Code, job
+	}
+
+	code, out := post(t, h, "/v1/ingest", `{"namespace":"a","document":{"id":"small"},"chunks":[{"doc_id":"small","vector":[0,1],"content":"x"}]}`)
+	if code != http.StatusOK || out["status"] != "ingested" {
+		t.Fatalf("Expected a small batch to be ingested in the request, got %d %v", code, out)
+	}
+
+	code, out = post(t, h, "/v1/ingest", `{"namespace":"a","document":{"id":"big"},"chunks":[`+
+		`{"doc_id":"big","vector":[1,0],"content":"one"},{"doc_id":"big","vector":[1,0.1],"content":"two"}]}`)
+	if code != http.StatusAccepted || out["status"] != "queued" {
+		t.Fatalf("Expected a large batch to be queued, got %d %v", code, out)
+	}
+	id := out["job_id"].(string)
+
+	var job jobs.Job
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if code, job = getJob(id); code != http.StatusOK {
+			t.Fatalf("Expected the job to be found, got %d", code)
+		}
+		if job.Status == jobs.Done || job.Status == jobs.Failed {
+			break
+		}
+	}
+	if job.Status != jobs.Done || job.Kind != "ingest" || job.Namespace != "a" || job.Finished == nil {
+		t.Fatalf("Expected the job to finish, got %+v", job)
+	}
+	if res, _ := job.Result.(map[string]any); len(res["chunk_ids"].([]any)) != 2 {
+		t.Errorf("Expected 2 chunk IDs in the result, got %v", job.Result)
+	}
+	if _, out := post(t, h, "/v1/retrieve", `{"namespace":"a","query":[1,0]}`); len(out["chunks"].([]any)) != 3 {
+		t.Errorf("Expected the queued chunks to be retrievable, got %v", out["chunks"])
+	}
+
+	if code, _ := getJob("nope"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", code)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	s, h := newTestServer(t)
+	t.Cleanup(s.jobQueue.Close)
+
+	do := func(method, path string) (int, []byte) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code, w.Body.Bytes()
+	}
+
+	post(t, h, "/v1/ingest", `{"namespace":"gone","document":{"id":"d"},"chunks":[{"doc_id":"d","vector":[0,1],"content":"x"}]}`)
+	_, body := do(http.MethodDelete, "/v1/namespaces/gone")
+	var confirm map[string]any
+	json.Unmarshal(body, &confirm)
+	code, body := do(http.MethodDelete, "/v1/namespaces/gone?async=true&confirm="+confirm["confirm_token"].(string))
+	var queued map[string]any
+	json.Unmarshal(body, &queued)
+	if code != http.StatusAccepted || queued["job_id"] == nil {
+		t.Fatalf("Expected an async purge to be queued, got %d %s", code, body)
+	}
+	id := queued["job_id"].(string)
+
+	var job jobs.Job
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && !job.Status.Finished(); time.Sleep(10 * time.Millisecond) {
+		_, body = do(http.MethodGet, "/v1/jobs/"+id)
+		json.Unmarshal(body, &job)
+	}
+	if res, _ := job.Result.(map[string]any); job.Status != jobs.Done || job.Progress != 100 || res["documents"] != 1.0 {
+		t.Fatalf("Expected the purge job to finish, got %+v", job)
+	}
+
+	code, body = do(http.MethodGet, "/v1/jobs?kind=namespace_purge")
+	var list struct{ Jobs []jobs.Job }
+	json.Unmarshal(body, &list)
+	if code != http.StatusOK || len(list.Jobs) != 1 || list.Jobs[0].ID != id {
+		t.Errorf("Expected the purge job listed, got %d %s", code, body)
+	}
+	if code, _ := do(http.MethodDelete, "/v1/jobs/"+id); code != http.StatusConflict {
+		t.Errorf("Expected 409 canceling a finished job, got %d", code)
+	}
+	if code, _ := do(http.MethodDelete, "/v1/jobs/nope"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 canceling an unknown job, got %d", code)
+	}
+	if code, _ := post(t, h, "/v1/compact", `{}`); code != http.StatusConflict {
+		t.Errorf("Expected 409 from /compact without a compactor, got %d", code)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/tracing"
+)
+
+// DefaultMaxBodyBytes caps request bodies unless SetLimits says otherwise.
+// A 1536-d vector is ~30 KB of JSON, so this still admits ~2000 of them.
+const DefaultMaxBodyBytes = 64 << 20
+
+// DefaultSearchTimeout bounds each search unless SetLimits says otherwise.
+const DefaultSearchTimeout = 2 * time.Second
+
+// Limits protects the server from oversized bodies and chatty clients.
+type Limits struct {
+	// MaxBodyBytes rejects larger bodies with 413 (0 = unlimited).
+	// /ingest_stream is exempt: it decodes one record at a time.
+	MaxBodyBytes int64
+	// RatePerSec is the sustained number of requests each client IP may make
+	// per second, with bursts up to Burst (0 = unlimited). /healthz and
+	// /readyz are exempt.
+	RatePerSec float64
+	Burst      int
+	// SearchTimeout cuts short the index search and scoring of /retrieve,
+	// /context and /similar with 504 (0 = unlimited). A client that hangs
+	// up cancels its search either way.
+	SearchTimeout time.Duration
+}
+
+// SetLimits replaces the body size and rate limits.
+func (s *Server) SetLimits(l Limits) {
+	if l.RatePerSec > 0 && l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.RatePerSec))
+	}
+	s.limits = l
+	s.buckets = &rateBuckets{m: map[string]*bucket{}}
+}
+
+// writeAPIError answers with a JSON error body: {"error": code, "message": msg}.
+func writeAPIError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, map[string]any{"error": code, "message": msg, "status": status})
+}
+
+// decodeJSON decodes the request body into v. On failure it answers 413 for
+// a body over the limit and 400 otherwise, and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	_, span := tracing.Start(r.Context(), "json.decode")
+	err := json.NewDecoder(r.Body).Decode(v)
+	span.End()
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "body_too_large",
+			fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+	return false
+}
+
+// bucket is a token bucket refilled at Limits.RatePerSec.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateBuckets struct {
+	mu sync.Mutex
+	m  map[string]*bucket
+}
+
+// take spends one token of client's bucket. When none is left it returns
+// how long until the next one.
+func (b *rateBuckets) take(client string, rate float64, burst int) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	bk, ok := b.m[client]
+	if !ok {
+		if len(b.m) >= 4096 {
+			b.evictFull(now, rate, burst)
+		}
+		bk = &bucket{tokens: float64(burst), last: now}
+		b.m[client] = bk
+	}
+	bk.tokens = math.Min(float64(burst), bk.tokens+now.Sub(bk.last).Seconds()*rate)
+	bk.last = now
+	if bk.tokens < 1 {
+		return false, time.Duration((1 - bk.tokens) / rate * float64(time.Second))
+	}
+	bk.tokens--
+	return true, 0
+}
+
+// evictFull drops buckets that have refilled completely; they carry no state.
+func (b *rateBuckets) evictFull(now time.Time, rate float64, burst int) {
+	for k, bk := range b.m {
+		if bk.tokens+now.Sub(bk.last).Seconds()*rate >= float64(burst) {
+			delete(b.m, k)
+		}
+	}
+}
+
+// withLimits enforces s.limits in front of next.
+func (s *Server) withLimits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := s.limits
+		if l.RatePerSec > 0 && r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+			client, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				client = r.RemoteAddr
+			}
+			if ok, wait := s.buckets.take(client, l.RatePerSec, l.Burst); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeAPIError(w, http.StatusTooManyRequests, "rate_limited",
+					fmt.Sprintf("rate limit of %g requests/s exceeded; retry in %s", l.RatePerSec, wait.Round(time.Millisecond)))
+				return
+			}
+		}
+		if l.MaxBodyBytes > 0 && r.URL.Path != "/ingest_stream" {
+			if r.ContentLength > l.MaxBodyBytes {
+				writeAPIError(w, http.StatusRequestEntityTooLarge, "body_too_large",
+					fmt.Sprintf("request body exceeds %d bytes", l.MaxBodyBytes))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, l.MaxBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLimits(t *testing.T) {
+	s := &Server{}
+	s.SetLimits(Limits{MaxBodyBytes: 16, RatePerSec: 1, Burst: 2})
+	h := s.withLimits(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]any
+		if decodeJSON(w, r, &v) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	do := func(remote, body string, chunked bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+		r.RemoteAddr = remote
+		if chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("1.1.1.1:1", `{"a":1}`, false); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if w := do("1.1.1.1:1", `{"a":"0123456789abcdef"}`, false); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a declared large body, got %d", w.Code)
+	}
+	w := do("3.3.3.3:1", `{"a":"0123456789abcdef"}`, true)
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), `"body_too_large"`) {
+		t.Errorf("Expected structured 413 for a streamed large body, got %d %s", w.Code, w.Body)
+	}
+
+	w = do("1.1.1.1:1", `{}`, false)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After once the burst is spent, got %d", w.Code)
+	}
+	if w := do("2.2.2.2:1", `{}`, false); w.Code != http.StatusNoContent {
+		t.Errorf("Expected another client to have its own budget, got %d", w.Code)
+	}
+}
+
+func TestSearchTimeout(t *testing.T) {
+	s, h := newTestServer(t)
+	if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"ns","conversation_id":"c","role":"user","content":"hi","vector":[1,0]}`); code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+	s.SetLimits(Limits{SearchTimeout: time.Nanosecond})
+	code, out := post(t, h, "/v1/retrieve", `{"namespace":"ns","query":[1,0],"max_tokens":100}`)
+	if code != http.StatusGatewayTimeout || out["error"] != "timeout" || out["stage"] == "" || out["elapsed_ms"] == nil {
+		t.Errorf("Expected 504 with diagnostics, got %d %v", code, out)
+	}
+
+	s.SetLimits(Limits{})
+	if code, out := post(t, h, "/v1/retrieve", `{"namespace":"ns","query":[1,0],"max_tokens":100}`); code != http.StatusOK {
+		t.Errorf("Expected the search to succeed without a deadline, got %d %v", code, out)
+	}
+}
+
+func TestWithAuth(t *testing.T) {
+	s := &Server{}
+	token, err := NewAuthToken()
+	if err != nil || len(token) != 64 {
+		t.Fatalf("Expected a 64 character token, got %q (%v)", token, err)
+	}
+	s.SetAuthToken(token)
+	h := s.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	do := func(path, auth string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := do("/stats", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", code)
+	}
+	if code := do("/stats", "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", code)
+	}
+	if code := do("/stats", "Bearer "+token); code != http.StatusNoContent {
+		t.Errorf("Expected 204 with the token, got %d", code)
+	}
+	if code := do("/healthz", ""); code != http.StatusNoContent {
+		t.Errorf("Expected /healthz to need no token, got %d", code)
+	}
+}
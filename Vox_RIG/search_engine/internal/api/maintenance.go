@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/maintenance"
+)
+
+// MaintenanceTasks are the tasks a maintenance window can run, in the order
+// it runs them: compaction first so the rebuilt index and the snapshot
+// leave out the compacted messages.
+var MaintenanceTasks = []string{"compact", "summarize", "reindex", "snapshot"}
+
+// queryPaths are the requests that count as query traffic, which pauses
+// maintenance.
+var queryPaths = map[string]bool{
+	"/retrieve":    true,
+	"/context":     true,
+	"/similar":     true,
+	"/search_text": true,
+}
+
+// withQueryClock records when the last query arrived and finished, for the
+// maintenance scheduler. It sits outside withTenants so tenant queries count.
+func (s *Server) withQueryClock(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, path, _, _ := tenantOf(r); queryPaths[path] {
+			s.lastQuery.Store(time.Now().UnixNano())
+			defer func() { s.lastQuery.Store(time.Now().UnixNano()) }()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LastQuery returns when the last query arrived or finished; zero if none has.
+func (s *Server) LastQuery() time.Time {
+	n := s.lastQuery.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// EnableMaintenance runs the named tasks (every available one when names is
+// empty) in a window of length window at every time sched matches, each
+// once no query has arrived for quiet (see maintenance.Scheduler). compact
+// needs Compactor, summarize EnableRollingSummaries and snapshot a data
+// directory. The scheduler stops when the server closes.
+func (s *Server) EnableMaintenance(sched *maintenance.Schedule, window, quiet time.Duration, names []string) (*maintenance.Scheduler, error) {
+	available := map[string]func(context.Context) error{
+		"reindex": s.maintainIndexes,
+	}
+	if s.compactor != nil {
+		available["compact"] = s.maintainCompaction
+	}
+	if s.roller != nil {
+		available["summarize"] = s.maintainSummaries
+	}
+	if s.dataDir != "" {
+		available["snapshot"] = s.maintainSnapshot
+	}
+
+	var tasks []maintenance.Task
+	if len(names) == 0 {
+		for _, name := range MaintenanceTasks {
+			if run, ok := available[name]; ok {
+				tasks = append(tasks, maintenance.Task{Name: name, Run: run})
+			}
+		}
+	}
+	for _, name := range names {
+		run, ok := available[name]
+		switch {
+		case ok:
+			tasks = append(tasks, maintenance.Task{Name: name, Run: run})
+		case name == "compact":
+			return nil, errors.New("maintenance task compact needs compaction (-summarize with -compact_age or -compact_keep)")
+		case name == "summarize":
+			return nil, errors.New("maintenance task summarize needs rolling summaries (-summarize with -summary_every)")
+		case name == "snapshot":
+			return nil, errors.New("maintenance task snapshot needs a data directory")
+		default:
+			return nil, fmt.Errorf("unknown maintenance task %q (want one of %v)", name, MaintenanceTasks)
+		}
+	}
+
+	m := &maintenance.Scheduler{Schedule: sched, Window: window, Quiet: quiet, Tasks: tasks, LastQuery: s.LastQuery}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.maintenance, s.stopMaintenance = m, cancel
+	go func() {
+		if err := m.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("[maintenance] stopped: %v", err)
+		}
+	}()
+	return m, nil
+}
+
+func (s *Server) maintainCompaction(ctx context.Context) error {
+	// The compactor takes the store lock itself, around store access only.
+	res, err := s.compactor.Compact(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("[compact] conversations=%d summaries=%d messages=%d skipped=%d (maintenance)",
+		res.Conversations, res.Summaries, res.Messages, res.Skipped)
+	return nil
+}
+
+func (s *Server) maintainSummaries(ctx context.Context) error {
+	n, err := s.roller.RefreshPending(ctx)
+	if n > 0 {
+		log.Printf("[summary] refreshed conversations=%d (maintenance)", n)
+	}
+	return err
+}
+
+// maintainIndexes rebuilds the index of every shard and model space; shards
+// already being rebuilt are left alone.
+func (s *Server) maintainIndexes(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shards, err := s.namespaceShards()
+	if err != nil {
+		return err
+	}
+	more, err := s.modelShards()
+	if err != nil {
+		return err
+	}
+	for _, sh := range append(shards, more...) {
+		res, err := sh.Engine.Reindex(ctx, nil)
+		if errors.Is(err, engine.ErrReindexRunning) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("namespace %s: %w", sh.Namespace, err)
+		}
+		log.Printf("[reindex] ok namespace=%s nodes=%d caught_up=%d (maintenance)", sh.Namespace, res.Nodes, res.CaughtUp)
+	}
+	return nil
+}
+
+// maintainSnapshot takes a snapshot as POST /snapshot does. It holds the
+// stores for writing and cannot be interrupted.
+func (s *Server) maintainSnapshot(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.createSnapshot()
+	if err != nil {
+		return err
+	}
+	log.Printf("[snapshot] ok name=%s vec_count=%d namespaces=%d (maintenance)", m.Name, m.VectorCount, len(m.Namespaces))
+	if s.remote != nil {
+		go s.pushSnapshot(m.Name)
+	}
+	return nil
+}
+
+// HandleMaintenance serves GET /maintenance: the schedule, whether a window
+// is open and what the last one did.
+func (s *Server) HandleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.maintenance == nil {
+		http.Error(w, "maintenance is off (start with -maintenance)", http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.maintenance.Status())
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/storage"
+)
+
+// ModelSpec names an extra embedding space and its vector dimension.
+type ModelSpec struct {
+	Name string
+	Dim  int
+}
+
+// ParseModels parses a -models flag value such as "code=768,chat=1536".
+func ParseModels(spec string) ([]ModelSpec, error) {
+	var out []ModelSpec
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, dimStr, ok := strings.Cut(part, "=")
+		dim, err := strconv.Atoi(dimStr)
+		if !ok || err != nil || dim <= 0 {
+			return nil, fmt.Errorf("invalid model spec %q (want name=dim)", part)
+		}
+		if !engine.ValidModelName(name) {
+			return nil, fmt.Errorf("invalid model name: %q", name)
+		}
+		out = append(out, ModelSpec{Name: name, Dim: dim})
+	}
+	return out, nil
+}
+
+func (s *Server) modelsRoot() string {
+	return filepath.Join(s.dataDir, "models")
+}
+
+// AddModel serves an extra embedding space of the given dimension under
+// <data>/models/<name>. Requests with "model": name are routed to it; requests
+// without a model keep using the default stores. SetDataDir must be called first.
+func (s *Server) AddModel(name string, dim int) error {
+	if s.dataDir == "" {
+		return fmt.Errorf("model %q: data dir not set", name)
+	}
+	if s.readOnly {
+		if _, err := os.Stat(filepath.Join(s.modelsRoot(), name, engine.ModelManifestFile)); err != nil {
+			return fmt.Errorf("model %q does not exist and cannot be created read-only", name)
+		}
+	}
+	sp, err := engine.OpenModelSpace(s.modelsRoot(), name, dim)
+	if err != nil {
+		return err
+	}
+	sp.Shards.SetReadOnly(s.readOnly)
+	if vecs, ok := s.vecs.(storage.FileVectorStore); ok {
+		sp.Shards.SetFlushPolicy(vecs.FlushPolicy())
+		sp.Shards.SetGrowthPolicy(vecs.GrowthPolicy())
+	}
+	sp.Shards.SetMetadataBackend(s.metaBackend)
+	sp.Shards.SetIndexConfig(s.indexConfig)
+	if s.models == nil {
+		s.models = map[string]*engine.ModelSpace{}
+	}
+	s.models[name] = sp
+	return nil
+}
+
+// envFor returns the command environment of model ("" is the default space).
+func (s *Server) envFor(model string) (commands.Env, error) {
+	if model == "" {
+		return s.env(), nil
+	}
+	sp, ok := s.models[model]
+	if !ok {
+		return commands.Env{}, &commands.Error{Kind: commands.Invalid, Msg: fmt.Sprintf("unknown model: %q", model)}
+	}
+	env := commands.Env{
+		Resolve: sp.Shards.Get,
+		Tokens:  s.tokens,
+		Dim:     sp.Dim,
+		Scrub:   s.scrubber,
+
+		SearchTimeout:     s.limits.SearchTimeout,
+		Normalize:         s.normalize,
+		WarnModelMismatch: s.warnModelMismatch,
+		ShortTerm:         s.shortTerm,
+		KeepVersions:      s.keepVersions,
+	}
+	// query_text can only be embedded if the provider produces this space's vectors.
+	if s.embedder != nil && s.embedder.Dim() == sp.Dim {
+		env.Embedder = s.embedder
+	}
+	return env, nil
+}
+
+// modelShards opens every namespace shard of every model space.
+func (s *Server) modelShards() ([]*engine.Shard, error) {
+	var out []*engine.Shard
+	for _, sp := range s.models {
+		shards, err := sp.Shards.All()
+		if err != nil {
+			return nil, fmt.Errorf("model %q: %w", sp.Name, err)
+		}
+		out = append(out, shards...)
+	}
+	return out, nil
+}
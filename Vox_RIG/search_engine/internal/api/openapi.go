@@ -0,0 +1,307 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/jobs"
+	"vox-vector-engine/internal/maintenance"
+	"vox-vector-engine/internal/replication"
+	"vox-vector-engine/internal/types"
+)
+
+// APIVersion is the path prefix of the current API.
+const APIVersion = "/v1"
+
+// SchemaVersion numbers the response schema served under APIVersion. In
+// version 2 every JSON field of every response, typed or ad hoc, is
+// snake_case; contract_test.go holds it to that.
+const SchemaVersion = 2
+
+// endpoint describes one operation for the OpenAPI document. Request and
+// Response are zero values of the body types; nil means a free-form object.
+type endpoint struct {
+	Path     string
+	Method   string
+	Summary  string
+	Query    []string
+	Request  any
+	Response any
+	// NDJSON marks newline-delimited JSON bodies (Request/Response are one line).
+	NDJSON bool
+	// OptionalBody marks a request body that may be omitted.
+	OptionalBody bool
+}
+
+var endpoints = []endpoint{
+	{Path: "/", Method: "get", Summary: "Service info and endpoint list"},
+	{Path: "/health", Method: "get", Summary: "Vector count and dimension"},
+	{Path: "/healthz", Method: "get", Summary: "Liveness: the process is serving HTTP"},
+	{Path: "/readyz", Method: "get", Summary: "Readiness: stores open, indexes warm, embedder reachable (503 until then)"},
+	{Path: "/stats", Method: "get", Summary: "Store, index, storage, namespace, model, cache and memory statistics, and uptime"},
+	{Path: "/stats/vectors", Method: "get", Summary: "Running statistics of ingested vectors per namespace and the batches that drifted from them (dims=true adds per-dimension variance)", Query: []string{"namespace", "model", "dims"}, Response: engine.VectorStats{}},
+	{Path: "/reset", Method: "post", Summary: "Clear in-memory indexes, rebuild one namespace's index, or wipe its data (confirm token)", Query: []string{"namespace"}, Request: resetRequest{}, OptionalBody: true},
+	{Path: "/ingest", Method: "post", Summary: "Store a document and pre-embedded chunks", Request: commands.IngestRequest{}, Response: commands.IngestResult{}},
+	{Path: "/ingest_message", Method: "post", Summary: "Store one chat message (idempotent)", Request: commands.IngestMessageRequest{}, Response: commands.IngestMessageResult{}},
+	{Path: "/ingest_document", Method: "post", Summary: "Store one embedded chunk of a file under its line-range document ID, or all its chunks under the file's, replacing what was stored for it", Request: commands.IngestDocumentRequest{}, Response: commands.IngestResult{}},
+	{Path: "/ingest_stream", Method: "post", Summary: "Ingest NDJSON records, streaming a status line per record", Request: IngestStreamRecord{}, Response: ingestStreamStatus{}, NDJSON: true},
+	{Path: "/ingest_text", Method: "post", Summary: "Chunk (and, with -embed, embed and store) a whole file", Request: IngestTextRequest{}},
+	{Path: "/retrieve", Method: "post", Summary: "Nearest chunks packed into a token budget", Request: commands.RetrieveRequest{}, Response: engine.RetrievalResult{}},
+	{Path: "/context", Method: "post", Summary: "Retrieve and format chunks as a prompt-ready block (markdown or json)", Request: commands.ContextRequest{}, Response: commands.ContextResult{}},
+	{Path: "/warm", Method: "post", Summary: "Walk the index toward representative queries and prefetch the vectors they reach", Request: commands.WarmRequest{}, Response: commands.WarmResult{}},
+	{Path: "/similar", Method: "post", Summary: "Documents nearest a stored document or chunk, queried with its stored vectors", Request: commands.SimilarRequest{}, Response: commands.SimilarResult{}},
+	{Path: "/clusters", Method: "get", Summary: "Saved topic clusters of a namespace with exemplar chunks (chunk_ids=true adds assignments)", Query: []string{"namespace", "chunk_ids", "model"}, Response: engine.Clustering{}},
+	{Path: "/clusters", Method: "post", Summary: "Cluster a namespace's stored vectors with k-means as a job and save the result", Request: commands.ClusterRequest{}},
+	{Path: "/index/verify", Method: "post", Summary: "Check the HNSW graph of a namespace against itself and the stores; repair=true fixes what it finds", Request: commands.VerifyIndexRequest{}, Response: engine.IndexReport{}},
+	{Path: "/reindex", Method: "post", Summary: "Rebuild the index of a namespace as a job and swap it in when done; the old index serves meanwhile", Request: commands.ReindexRequest{}},
+	{Path: "/search_text", Method: "get", Summary: "Substring, regex or BM25 match over chunk content (no vectors)", Query: []string{"q", "namespace", "mode", "case_sensitive", "limit", "model"}, Response: engine.TextResult{}},
+	{Path: "/namespaces/{namespace}", Method: "delete", Summary: "Purge a namespace (two-step, confirm token; async=true runs it as a job)", Query: []string{"confirm", "async"}},
+	{Path: "/flush", Method: "post", Summary: "fsync every vector store"},
+	{Path: "/snapshot", Method: "get", Summary: "List snapshots"},
+	{Path: "/snapshot", Method: "post", Summary: "Create a snapshot"},
+	{Path: "/restore", Method: "post", Summary: "Restore a snapshot", Request: restoreRequest{}},
+	{Path: "/conversations/{id}/summary", Method: "get", Summary: "Rolling summary of a conversation (-summary_every)", Query: []string{"namespace"}, Response: ConversationSummary{}},
+	{Path: "/conversations/{id}/summary", Method: "post", Summary: "Refresh the rolling summary of a conversation now", Query: []string{"namespace"}, Response: ConversationSummary{}},
+	{Path: "/pins", Method: "get", Summary: "List pins of a namespace", Query: []string{"namespace", "model"}},
+	{Path: "/pins", Method: "post", Summary: "Pin a document or chunk", Request: commands.PinRequest{}, Response: types.Pin{}},
+	{Path: "/pins", Method: "delete", Summary: "Remove a pin", Request: commands.PinRequest{}},
+	{Path: "/feedback", Method: "post", Summary: "Report whether a retrieved chunk was used, ignored or harmful", Request: commands.FeedbackRequest{}, Response: commands.FeedbackResult{}},
+	{Path: "/templates", Method: "get", Summary: "List context templates, or the one of namespace", Query: []string{"namespace", "model"}},
+	{Path: "/templates", Method: "put", Summary: "Set the context template of a namespace", Request: commands.TemplateRequest{}, Response: types.ContextTemplate{}},
+	{Path: "/templates", Method: "delete", Summary: "Remove the context template of a namespace", Request: commands.TemplateRequest{}},
+	{Path: "/quotas", Method: "get", Summary: "List namespace quotas with usage and evictions, or the one of namespace", Query: []string{"namespace", "model"}, Response: engine.QuotaStatus{}},
+	{Path: "/quotas", Method: "put", Summary: "Set a namespace quota (max chunks, bytes or tokens) and its eviction policy; evicts at once when over it", Request: commands.QuotaRequest{}, Response: engine.QuotaStatus{}},
+	{Path: "/quotas", Method: "delete", Summary: "Remove the quota of a namespace", Request: commands.QuotaRequest{}},
+	{Path: "/documents/{id}", Method: "get", Summary: "A stored document with all its chunks in line order", Query: []string{"namespace", "model"}, Response: commands.DocumentResult{}},
+	{Path: "/chunks/{id}", Method: "get", Summary: "A stored chunk with its document", Query: []string{"namespace", "model"}, Response: commands.ChunkResult{}},
+	{Path: "/documents/{id}", Method: "patch", Summary: "Merge document metadata and optionally bump its timestamp", Request: commands.UpdateDocumentRequest{}, Response: commands.UpdateDocumentResult{}},
+	{Path: "/documents/{id}/tags", Method: "patch", Summary: "Replace, add or remove document tags", Request: commands.TagsRequest{}, Response: commands.TagsResult{}},
+	{Path: "/jobs", Method: "get", Summary: "Background jobs, newest first", Query: []string{"kind", "status"}, Response: struct {
+		Jobs []jobs.Job `json:"jobs"`
+	}{}},
+	{Path: "/jobs/{id}", Method: "get", Summary: "Status, progress and result of a background job", Response: jobs.Job{}},
+	{Path: "/jobs/{id}", Method: "delete", Summary: "Cancel a queued or running job", Response: jobs.Job{}},
+	{Path: "/compact", Method: "post", Summary: "Run one chat compaction pass as a job (-summarize with -compact_age or -compact_keep)"},
+	{Path: "/maintenance", Method: "get", Summary: "Maintenance schedule, the open window and what the last one did (-maintenance)", Response: maintenance.Status{}},
+	{Path: "/ingest_dir", Method: "post", Summary: "Index every text file under a server-side directory as a job (needs -embed)", Request: IngestDirRequest{}},
+	{Path: "/changes", Method: "get", Summary: "Ingest, update and delete events after a sequence number, for incremental mirrors", Query: []string{"since", "limit", "namespace", "model"}, Response: commands.ChangesResult{}},
+	{Path: "/replication/status", Method: "get", Summary: "Vector count and newest change log entry, for replicas", Response: replication.Status{}},
+	{Path: "/replication/changes", Method: "get", Summary: "Metadata change log entries after a sequence number", Query: []string{"since", "limit"}, Response: replication.ChangesPage{}},
+	{Path: "/replication/vectors", Method: "get", Summary: "Stored vectors as raw little-endian float32s", Query: []string{"from", "limit"}},
+	{Path: "/replication/document", Method: "get", Summary: "A document with all its chunks", Query: []string{"id"}, Response: replication.DocumentState{}},
+	{Path: "/replication/chunks", Method: "get", Summary: "Chunks by comma-separated ID", Query: []string{"ids"}, Response: replication.ChunksPage{}},
+	{Path: "/documents/{id}", Method: "delete", Summary: "Delete a document, or move it to the trash with soft=true", Query: []string{"soft", "namespace", "model"}, Response: commands.DeleteDocumentResult{}},
+	{Path: "/documents/{id}/restore", Method: "post", Summary: "Restore a document from the trash", Query: []string{"namespace", "model"}, Response: commands.RestoreDocumentResult{}},
+	{Path: "/documents/{id}/versions", Method: "get", Summary: "The latest and kept prior versions of a re-indexed file", Query: []string{"namespace", "model"}, Response: commands.DocumentVersionsResult{}},
+	{Path: "/trash", Method: "get", Summary: "Soft-deleted documents of a namespace and when they are purged", Query: []string{"namespace", "model"}},
+	{Path: "/openapi.json", Method: "get", Summary: "This document"},
+}
+
+// unversioned paths are probe endpoints that stay canonical without /v1.
+var unversioned = map[string]bool{"/health": true, "/healthz": true, "/readyz": true}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]any
+)
+
+// OpenAPI returns the OpenAPI 3 document of the /v1 API, generated from the
+// request and response types.
+func OpenAPI() map[string]any {
+	openAPIOnce.Do(func() {
+		g := &schemaGen{defs: map[string]any{}}
+		paths := map[string]any{}
+		for _, ep := range endpoints {
+			op := map[string]any{"summary": ep.Summary}
+			var params []any
+			for _, name := range []string{"namespace", "id"} {
+				if strings.Contains(ep.Path, "{"+name+"}") {
+					params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+				}
+			}
+			for _, q := range ep.Query {
+				params = append(params, map[string]any{"name": q, "in": "query", "schema": map[string]any{"type": "string"}})
+			}
+			if params != nil {
+				op["parameters"] = params
+			}
+			mediaType := "application/json"
+			if ep.NDJSON {
+				mediaType = "application/x-ndjson"
+			}
+			if ep.Request != nil {
+				op["requestBody"] = map[string]any{
+					"required": !ep.OptionalBody,
+					"content":  map[string]any{mediaType: map[string]any{"schema": g.schema(reflect.TypeOf(ep.Request))}},
+				}
+			}
+			resp := map[string]any{"type": "object"}
+			if ep.Response != nil {
+				resp = g.schema(reflect.TypeOf(ep.Response))
+			}
+			op["responses"] = map[string]any{
+				"200":     map[string]any{"description": "OK", "content": map[string]any{mediaType: map[string]any{"schema": resp}}},
+				"default": map[string]any{"description": "Error (plain text, or JSON {error, message, status})"},
+			}
+
+			path := APIVersion + ep.Path
+			item, _ := paths[path].(map[string]any)
+			if item == nil {
+				item = map[string]any{}
+				paths[path] = item
+			}
+			item[ep.Method] = op
+		}
+		openAPIDoc = map[string]any{
+			"openapi": "3.0.3",
+			"info": map[string]any{
+				"title":        "vox-vector-engine",
+				"version":      strings.TrimPrefix(APIVersion, "/"),
+				"x-api-schema": SchemaVersion,
+			},
+			"paths": paths,
+			"components": map[string]any{
+				"schemas": g.defs,
+				// Not required globally: the token is only checked when the
+				// server runs with -auth_token.
+				"securitySchemes": map[string]any{
+					"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "description": "required on every endpoint but /healthz and /readyz when the server runs with -auth_token"},
+				},
+			},
+		}
+	})
+	return openAPIDoc
+}
+
+// schemaGen turns Go types into OpenAPI schemas. Named structs become
+// components referenced by $ref.
+type schemaGen struct {
+	defs map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		s := g.schema(t.Elem())
+		if _, isRef := s["$ref"]; !isRef {
+			s["nullable"] = true
+		}
+		return s
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return g.object(t)
+		}
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = map[string]any{} // placeholder for recursive types
+			g.defs[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object describes a struct by its JSON field names. Fields without
+// omitempty are listed as required.
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			// Embedded structs are flattened by encoding/json.
+			inner := g.object(f.Type)
+			for name, p := range inner["properties"].(map[string]any) {
+				props[name] = p
+			}
+			if req, ok := inner["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+	obj := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// HandleOpenAPI serves GET /v1/openapi.json.
+func (s *Server) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, OpenAPI())
+}
+
+// withVersion serves the API under /v1 by stripping the prefix. The legacy
+// unprefixed routes keep working but carry Deprecation and successor Link
+// headers; the probe endpoints stay canonical without a prefix.
+func (s *Server) withVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if path == APIVersion || strings.HasPrefix(path, APIVersion+"/") {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = strings.TrimPrefix(path, APIVersion)
+			if r2.URL.Path == "" {
+				r2.URL.Path = "/"
+			}
+			// Keep the escaping of the rest of the path, so %2F inside a
+			// segment is not decoded into a separator.
+			r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, APIVersion)
+			if r.URL.RawPath == "" || r2.URL.RawPath == "" {
+				r2.URL.RawPath = ""
+			}
+			next.ServeHTTP(w, r2)
+			return
+		}
+		if !unversioned[path] {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+APIVersion+path+`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
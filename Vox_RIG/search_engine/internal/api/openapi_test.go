@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithVersion(t *testing.T) {
+	s := &Server{}
+	var seen string
+	h := s.withVersion(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.Path
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/retrieve", nil))
+	if seen != "/retrieve" || w.Header().Get("Deprecation") != "" {
+		t.Errorf("Expected /v1/retrieve served as /retrieve without Deprecation, got %q %v", seen, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/retrieve", nil))
+	if seen != "/retrieve" || w.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected legacy /retrieve with Deprecation, got %q %v", seen, w.Header())
+	}
+	if got := w.Header().Get("Link"); got != `</v1/retrieve>; rel="successor-version"` {
+		t.Errorf("Unexpected Link header: %q", got)
+	}
+
+	var escaped string
+	esc := s.withVersion(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, escaped = r.URL.Path, r.URL.EscapedPath()
+	}))
+	esc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/v1/namespaces/org%2Frepo", nil))
+	if seen != "/namespaces/org/repo" || escaped != "/namespaces/org%2Frepo" {
+		t.Errorf("Expected the escaping kept under /v1, got %q %q", seen, escaped)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Header().Get("Deprecation") != "" {
+		t.Errorf("Probe endpoints should not be deprecated, got %v", w.Header())
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	data, err := json.Marshal(OpenAPI())
+	if err != nil {
+		t.Fatalf("Failed to marshal spec: %v", err)
+	}
+	var doc struct {
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to decode spec: %v", err)
+	}
+
+	if _, ok := doc.Paths["/v1/retrieve"]["post"]; !ok {
+		t.Errorf("Expected POST /v1/retrieve in paths")
+	}
+	if _, ok := doc.Paths["/v1/pins"]["delete"]; !ok {
+		t.Errorf("Expected DELETE /v1/pins in paths")
+	}
+
+	req, ok := doc.Components.Schemas["RetrieveRequest"]
+	if !ok {
+		t.Fatalf("Expected RetrieveRequest schema")
+	}
+	if req.Properties["query"]["type"] != "array" {
+		t.Errorf("Expected query to be an array, got %v", req.Properties["query"])
+	}
+	if _, ok := req.Properties["boosts"]["additionalProperties"]; !ok {
+		t.Errorf("Expected boosts to be a map, got %v", req.Properties["boosts"])
+	}
+	for _, name := range req.Required {
+		if name == "conversation_id" {
+			t.Errorf("omitempty field conversation_id should not be required")
+		}
+	}
+	if pin := doc.Components.Schemas["Pin"]; pin.Properties["created_at"]["format"] != "date-time" {
+		t.Errorf("Expected Pin.created_at as date-time, got %v", pin.Properties["created_at"])
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandlePins manages always-included context for a namespace:
+//
+//	GET    /pins?namespace=<ns>[&model=<m>]  list pins
+//	POST   /pins {namespace, doc_id | chunk_id, note}  add a pin
+//	DELETE /pins {namespace, doc_id | chunk_id}  remove a pin
+func (s *Server) HandlePins(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		env, err := s.envFor(q.Get("model"))
+		if err != nil {
+			writeCommandError(w, "pins", err)
+			return
+		}
+		pins, err := commands.ListPins(env, q.Get("namespace"))
+		if err != nil {
+			writeCommandError(w, "pins", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"namespace": q.Get("namespace"), "pins": pins})
+
+	case http.MethodPost, http.MethodDelete:
+		var req commands.PinRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		noteNamespace(r, req.Namespace)
+		env, err := s.envFor(req.Model)
+		if err != nil {
+			writeCommandError(w, "pins", err)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			pin, err := commands.Pin(env, req)
+			if err != nil {
+				writeCommandError(w, "pins", err)
+				return
+			}
+			log.Printf("[pins] pinned namespace=%s doc_id=%s chunk_id=%v", req.Namespace, req.DocID, fmtChunkID(req.ChunkID))
+			writeJSON(w, http.StatusOK, map[string]any{"status": "pinned", "pin": pin})
+			return
+		}
+
+		found, err := commands.Unpin(env, req)
+		if err != nil {
+			writeCommandError(w, "pins", err)
+			return
+		}
+		if !found {
+			http.Error(w, "pin not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[pins] unpinned namespace=%s doc_id=%s chunk_id=%v", req.Namespace, req.DocID, fmtChunkID(req.ChunkID))
+		writeJSON(w, http.StatusOK, map[string]any{"status": "unpinned"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// fmtChunkID renders an optional chunk ID for logs.
+func fmtChunkID(id *uint64) any {
+	if id == nil {
+		return "-"
+	}
+	return *id
+}
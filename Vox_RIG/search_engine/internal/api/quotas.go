@@ -0,0 +1,83 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleQuotas manages per-namespace storage quotas (see commands.SetQuota):
+//
+//	GET    /quotas[?model=<m>]                    list quotas with usage
+//	GET    /quotas?namespace=<ns>[&model=<m>]     one namespace's quota
+//	PUT    /quotas {namespace, max_chunks, max_bytes, max_tokens, policy}
+//	DELETE /quotas {namespace}                    remove a quota
+//
+// Writes that take a namespace over its quota evict documents by the
+// quota's policy; /stats reports the totals.
+func (s *Server) HandleQuotas(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		env, err := s.envFor(q.Get("model"))
+		if err != nil {
+			writeCommandError(w, "quotas", err)
+			return
+		}
+		if !q.Has("namespace") {
+			quotas, err := commands.Quotas(env, "")
+			if err != nil {
+				writeCommandError(w, "quotas", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"quotas": quotas})
+			return
+		}
+		quotas, err := commands.Quotas(env, q.Get("namespace"))
+		if err != nil {
+			writeCommandError(w, "quotas", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, quotas[0])
+
+	case http.MethodPut, http.MethodDelete:
+		var req commands.QuotaRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		noteNamespace(r, req.Namespace)
+		env, err := s.envFor(req.Model)
+		if err != nil {
+			writeCommandError(w, "quotas", err)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			st, err := commands.SetQuota(env, req)
+			if err != nil {
+				writeCommandError(w, "quotas", err)
+				return
+			}
+			log.Printf("[quotas] set namespace=%s max_chunks=%d max_bytes=%d max_tokens=%d policy=%s chunks=%d",
+				req.Namespace, st.MaxChunks, st.MaxBytes, st.MaxTokens, st.Policy, st.Usage.Chunks)
+			writeJSON(w, http.StatusOK, map[string]any{"status": "saved", "quota": st})
+			return
+		}
+
+		found, err := commands.DeleteQuota(env, req.Namespace)
+		if err != nil {
+			writeCommandError(w, "quotas", err)
+			return
+		}
+		if !found {
+			http.Error(w, "quota not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[quotas] deleted namespace=%s", req.Namespace)
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/storage"
+)
+
+// readOnlyPOST lists the POST endpoints that only read the stores.
+var readOnlyPOST = map[string]bool{"/retrieve": true, "/context": true, "/similar": true, "/warm": true, "/index/verify": true, "/reindex": true}
+
+// SetReadOnly marks the server as serving stores opened read-only (-readonly):
+// every endpoint that would write answers 403.
+func (s *Server) SetReadOnly(ro bool) {
+	s.readOnly = ro
+	s.engine.SetAccessLog(!ro)
+}
+
+// withReadOnly rejects writes up front, so a read-only server fails fast
+// with a clear status instead of a store error halfway through a request.
+func (s *Server) withReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead && !readOnlyPOST[r.URL.Path] {
+			http.Error(w, "server is read-only (-readonly)", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// FollowWriter keeps a read-only server current with the process that owns
+// its data directory: every interval it re-reads each vectors file and
+// indexes the vectors appended since. Metadata needs no polling; SQLite
+// readers see each commit, and Bolt does not admit a live writer at all.
+func (s *Server) FollowWriter(every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for range t.C {
+			s.followWriter()
+		}
+	}()
+}
+
+func (s *Server) followWriter() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shards, err := s.namespaceShards()
+	if err != nil {
+		log.Printf("[follow] failed to open shards: %v", err)
+		return
+	}
+	for _, sp := range s.models {
+		if more, err := sp.Shards.All(); err == nil {
+			shards = append(shards, more...)
+		}
+	}
+	for _, sh := range shards {
+		vecs, ok := sh.Vectors.(storage.FileVectorStore)
+		if !ok {
+			continue
+		}
+		before := vecs.Count()
+		after, err := vecs.Refresh()
+		if err != nil {
+			log.Printf("[follow] namespace=%s refresh failed: %v", sh.Namespace, err)
+			continue
+		}
+		if after > before {
+			engine.RebuildIndexProgress(sh.Index, sh.Vectors, nil)
+			log.Printf("[follow] namespace=%s indexed %d new vectors (vec_count=%d)", sh.Namespace, after-before, after)
+		}
+	}
+}
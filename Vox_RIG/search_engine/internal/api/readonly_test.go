@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReadOnlyRejectsWrites(t *testing.T) {
+	s, h := newTestServer(t)
+	code, out := post(t, h, "/v1/ingest_message", `{"namespace":"a","conversation_id":"c","role":"user","content":"hi","vector":[1,0]}`)
+	if code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+	docID, _ := out["doc_id"].(string)
+	s.SetReadOnly(true)
+
+	if code, _ := post(t, h, "/v1/ingest_message", `{"namespace":"a","conversation_id":"c","role":"user","content":"again","vector":[1,0]}`); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for an ingest on a read-only server, got %d", code)
+	}
+	if code, _ := post(t, h, "/v1/flush", ""); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a flush on a read-only server, got %d", code)
+	}
+	if code, out := post(t, h, "/v1/retrieve", `{"namespace":"a","query":[1,0]}`); code != http.StatusOK {
+		t.Errorf("Expected retrieve to work read-only, got %d %v", code, out)
+	}
+	if code, out := post(t, h, "/v1/similar", `{"namespace":"a","doc_id":"`+docID+`"}`); code != http.StatusOK {
+		t.Errorf("Expected similar to work read-only, got %d %v", code, out)
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/jobs"
+)
+
+// embedProbeTTL is how long an embedding provider check is reused, so
+// supervisors polling /readyz do not hammer the provider.
+const embedProbeTTL = 30 * time.Second
+
+// warmup tracks the startup index rebuild started by Warm.
+type warmup struct {
+	mu         sync.Mutex
+	started    bool
+	finished   bool
+	stores     int
+	storesDone int
+	current    float64 // fraction of the store being rebuilt
+	err        error
+}
+
+// probe caches the last embedding provider check.
+type probe struct {
+	mu  sync.Mutex
+	at  time.Time
+	err error
+}
+
+// Warm rebuilds the in-memory indexes of the shared stores, every namespace
+// shard and every model space in the background. /readyz reports progress
+// and turns ready when it finishes; requests are served meanwhile, with
+// retrieval only seeing what has been indexed so far. The rebuild is also
+// listed at GET /jobs as an "index_rebuild" job.
+func (s *Server) Warm() {
+	s.warm.mu.Lock()
+	s.warm.started = true
+	s.warm.mu.Unlock()
+
+	_, err := s.jobQueue.Start("index_rebuild", "", func(ctx context.Context) (any, error) {
+		start := time.Now()
+		err := s.warmIndexes(ctx)
+
+		s.warm.mu.Lock()
+		s.warm.finished = true
+		s.warm.err = err
+		s.warm.mu.Unlock()
+		if err != nil {
+			log.Printf("[warm] failed: %v", err)
+			return nil, err
+		}
+		log.Printf("[warm] indexes ready in %s (vec_count=%d)", time.Since(start).Round(time.Millisecond), s.vectorCount())
+		return map[string]any{"vec_count": s.vectorCount()}, nil
+	})
+	if err != nil {
+		log.Printf("[warm] not started: %v", err)
+	}
+}
+
+// warmIndexes rebuilds the indexes, reporting progress to /readyz and to
+// the job running under ctx, if any.
+func (s *Server) warmIndexes(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type lazy struct {
+		name string
+		get  func(string) (*engine.Shard, error)
+	}
+	var pending []lazy
+	if s.shards != nil {
+		nss, err := s.shards.Namespaces()
+		if err != nil {
+			return err
+		}
+		for _, ns := range nss {
+			pending = append(pending, lazy{ns, s.shards.Get})
+		}
+	}
+	for _, sp := range s.models {
+		nss, err := sp.Shards.Namespaces()
+		if err != nil {
+			return err
+		}
+		for _, ns := range nss {
+			pending = append(pending, lazy{ns, sp.Shards.Get})
+		}
+	}
+
+	s.warm.mu.Lock()
+	s.warm.stores = 1 + len(pending)
+	s.warm.mu.Unlock()
+
+	engine.RebuildIndexProgress(s.index, s.vecs, func(done, total uint64) {
+		s.warm.mu.Lock()
+		if total > 0 {
+			s.warm.current = float64(done) / float64(total)
+		}
+		fraction := s.warm.fractionLocked()
+		s.warm.mu.Unlock()
+		jobs.SetProgress(ctx, fraction)
+	})
+	s.warmStoreDone(ctx)
+
+	// Shards rebuild their index when first opened.
+	for _, p := range pending {
+		if _, err := p.get(p.name); err != nil {
+			return err
+		}
+		s.warmStoreDone(ctx)
+	}
+	return nil
+}
+
+func (s *Server) warmStoreDone(ctx context.Context) {
+	s.warm.mu.Lock()
+	s.warm.storesDone++
+	s.warm.current = 0
+	fraction := s.warm.fractionLocked()
+	s.warm.mu.Unlock()
+	jobs.SetProgress(ctx, fraction)
+}
+
+// fractionLocked returns how much of the rebuild is done, from 0 to 1.
+func (w *warmup) fractionLocked() float64 {
+	if w.finished || w.stores == 0 {
+		return 1
+	}
+	return (float64(w.storesDone) + w.current) / float64(w.stores)
+}
+
+// HandleHealthz serves GET /healthz: the process is up and serving HTTP.
+func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":       true,
+		"time_utc": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// HandleReadyz serves GET /readyz: 200 once retrieval is usable (stores
+// open, startup index rebuild complete, embedding provider reachable when
+// one is configured), 503 with the failing checks and rebuild progress
+// otherwise.
+func (s *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ready := true
+	checks := map[string]any{}
+
+	stores := map[string]any{"ok": true}
+	if _, err := s.meta.GetState("ready_probe"); err != nil {
+		stores = map[string]any{"ok": false, "error": err.Error()}
+		ready = false
+	}
+	checks["stores"] = stores
+
+	s.warm.mu.Lock()
+	index := map[string]any{"ok": true, "progress_percent": 100.0}
+	if s.warm.started {
+		pct := 100 * s.warm.fractionLocked()
+		index = map[string]any{
+			"ok":               s.warm.finished && s.warm.err == nil,
+			"progress_percent": float64(int(pct*10)) / 10,
+			"stores":           s.warm.stores,
+			"stores_done":      s.warm.storesDone,
+		}
+		if s.warm.err != nil {
+			index["error"] = s.warm.err.Error()
+		}
+	}
+	s.warm.mu.Unlock()
+	if ok, _ := index["ok"].(bool); !ok {
+		ready = false
+	}
+	checks["index"] = index
+
+	if s.embedder != nil {
+		embedder := map[string]any{"ok": true, "provider": s.embedder.Name()}
+		if err := s.probeEmbedder(r.Context()); err != nil {
+			embedder["ok"] = false
+			embedder["error"] = err.Error()
+			ready = false
+		}
+		checks["embedder"] = embedder
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]any{
+		"ready":     ready,
+		"time_utc":  time.Now().UTC().Format(time.RFC3339),
+		"vec_count": s.vectorCount(),
+		"checks":    checks,
+	})
+}
+
+// probeEmbedder embeds a short text, reusing the result for embedProbeTTL.
+func (s *Server) probeEmbedder(ctx context.Context) error {
+	s.embedProbe.mu.Lock()
+	defer s.embedProbe.mu.Unlock()
+	if !s.embedProbe.at.IsZero() && time.Since(s.embedProbe.at) < embedProbeTTL {
+		return s.embedProbe.err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.embedder.Embed(ctx, []string{"ping"})
+	s.embedProbe.at = time.Now()
+	s.embedProbe.err = err
+	return err
+}
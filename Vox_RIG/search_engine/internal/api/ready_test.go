@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// downEmbedder is an embedding provider that cannot be reached.
+type downEmbedder struct{ calls atomic.Int32 }
+
+func (e *downEmbedder) Name() string { return "down" }
+func (e *downEmbedder) Dim() int     { return 2 }
+func (e *downEmbedder) Embed(ctx context.Context, texts []string) ([]types.Vector, error) {
+	e.calls.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+func getJSON(t *testing.T, h http.Handler, path string) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var out map[string]any
+	json.Unmarshal(w.Body.Bytes(), &out)
+	return w.Code, out
+}
+
+func TestHealthz(t *testing.T) {
+	s, h := newTestServer(t)
+	if code, out := getJSON(t, h, "/healthz"); code != http.StatusOK || out["ok"] != true {
+		t.Fatalf("Expected 200 ok, got %d %v", code, out)
+	}
+	if code, _ := post(t, h, "/healthz", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", code)
+	}
+
+	// A restore holds the stores for writing; /healthz, and its log line,
+	// must not wait for it.
+	var logBuf bytes.Buffer
+	s.SetRequestLog(&logBuf)
+	s.mu.Lock()
+	done := make(chan int)
+	go func() {
+		code, _ := getJSON(t, h, "/healthz")
+		done <- code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("Expected 200 while the stores are locked, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("/healthz blocked on the store lock")
+	}
+	s.mu.Unlock()
+	if !bytes.Contains(logBuf.Bytes(), []byte(`"path":"/healthz"`)) {
+		t.Errorf("Expected the request to be logged, got %q", logBuf.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	s, h := newTestServer(t)
+	if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"ns","conversation_id":"c","message_id":"m","role":"user","content":"hi","vector":[1,0]}`); code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+
+	// Without a warm-up the index is built as vectors arrive.
+	code, out := getJSON(t, h, "/readyz")
+	if code != http.StatusOK || out["ready"] != true || out["vec_count"] != float64(1) {
+		t.Fatalf("Expected ready, got %d %v", code, out)
+	}
+
+	// Halfway through a warm-up of four stores.
+	s.warm.mu.Lock()
+	s.warm.started, s.warm.stores, s.warm.storesDone, s.warm.current = true, 4, 1, 0.5
+	s.warm.mu.Unlock()
+	code, out = getJSON(t, h, "/readyz")
+	index, _ := out["checks"].(map[string]any)["index"].(map[string]any)
+	if code != http.StatusServiceUnavailable || out["ready"] != false || index["ok"] != false || index["progress_percent"] != 37.5 {
+		t.Errorf("Expected 503 at 37.5%%, got %d %v", code, out)
+	}
+
+	// A real warm-up finishes and turns the server ready.
+	s.warm = warmup{}
+	s.Warm()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, out = getJSON(t, h, "/readyz")
+		if code == http.StatusOK || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	index, _ = out["checks"].(map[string]any)["index"].(map[string]any)
+	if code != http.StatusOK || index["progress_percent"] != 100.0 || index["stores_done"] != index["stores"] {
+		t.Errorf("Expected ready after the warm-up, got %d %v", code, out)
+	}
+}
+
+func TestReadyzEmbedderDown(t *testing.T) {
+	s, h := newTestServer(t)
+	emb := &downEmbedder{}
+	s.SetEmbedder(emb)
+
+	for i := 0; i < 2; i++ {
+		code, out := getJSON(t, h, "/readyz")
+		check, _ := out["checks"].(map[string]any)["embedder"].(map[string]any)
+		if code != http.StatusServiceUnavailable || check["ok"] != false || check["provider"] != "down" || check["error"] != "connection refused" {
+			t.Fatalf("Expected 503 with the embedder error, got %d %v", code, out)
+		}
+	}
+	if n := emb.calls.Load(); n != 1 {
+		t.Errorf("Expected the provider check to be reused, got %d calls", n)
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/jobs"
+)
+
+// HandleReindex rebuilds the index of a namespace as a job. The old index
+// keeps serving until the new one is swapped in, and only the in-memory
+// graph changes, so read-only servers allow it too.
+func (s *Server) HandleReindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req commands.ReindexRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	noteNamespace(r, req.Namespace)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "reindex", err)
+		return
+	}
+	s.submitJob(w, "reindex", req.Namespace, func(ctx context.Context) (any, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		res, err := commands.Reindex(ctx, env, req, func(f float64) { jobs.SetProgress(ctx, f) })
+		if err != nil {
+			log.Printf("[reindex] namespace=%s: %v", req.Namespace, err)
+			return nil, errors.New(commands.Message(err))
+		}
+		log.Printf("[reindex] ok namespace=%s nodes=%d caught_up=%d elapsed_ms=%.0f (job)", req.Namespace, res.Nodes, res.CaughtUp, res.ElapsedMS)
+		return res, nil
+	})
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vox-vector-engine/internal/replication"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// HandleReplication serves what a replica needs to follow this server (see
+// package replication):
+//
+//	GET /replication/status                     {vec_count, last_change, dim}
+//	GET /replication/changes?since=&limit=      change log entries after since
+//	GET /replication/vectors?from=&limit=       raw little-endian float32s
+//	GET /replication/document?id=               a document with its chunks
+//	GET /replication/chunks?ids=1,2,3           chunks by ID
+//
+// Only the shared stores replicate; with -isolate_namespaces every path
+// answers 409.
+func (s *Server) HandleReplication(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.shards != nil {
+		http.Error(w, "replication serves the shared stores only (not -isolate_namespaces)", http.StatusConflict)
+		return
+	}
+	q := r.URL.Query()
+	switch strings.TrimPrefix(r.URL.Path, "/replication/") {
+	case "status":
+		last, err := s.meta.LastChange()
+		if err != nil {
+			writeCommandError(w, "replication", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, replication.Status{VecCount: s.vecs.Count(), LastChange: last, Dim: s.vecs.Dim()})
+
+	case "changes":
+		since, ok := queryUint(w, q.Get("since"), "since")
+		if !ok {
+			return
+		}
+		limit, ok := queryUint(w, q.Get("limit"), "limit")
+		if !ok {
+			return
+		}
+		changes, err := s.meta.Changes(since, int(min(limit, storage.DefaultChangesLimit)))
+		if err != nil {
+			writeCommandError(w, "replication", err)
+			return
+		}
+		last, err := s.meta.LastChange()
+		if err != nil {
+			writeCommandError(w, "replication", err)
+			return
+		}
+		if changes == nil {
+			changes = []types.Change{}
+		}
+		writeJSON(w, http.StatusOK, replication.ChangesPage{Changes: changes, LastChange: last})
+
+	case "vectors":
+		from, ok := queryUint(w, q.Get("from"), "from")
+		if !ok {
+			return
+		}
+		limit, ok := queryUint(w, q.Get("limit"), "limit")
+		if !ok {
+			return
+		}
+		if limit == 0 {
+			limit = replication.DefaultVectorBatch
+		}
+		to := min(from+min(limit, replication.MaxVectorBatch), s.vecs.Count())
+		var vectors []types.Vector
+		for id := from; id < to; id++ {
+			v, err := s.vecs.Get(id)
+			if err != nil {
+				writeCommandError(w, "replication", err)
+				return
+			}
+			vectors = append(vectors, v)
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		replication.EncodeVectors(w, vectors)
+
+	case "document":
+		doc, err := s.meta.GetDocument(q.Get("id"))
+		if err != nil || doc == nil {
+			http.Error(w, "document not found", http.StatusNotFound)
+			return
+		}
+		chunks, err := s.meta.DocumentChunks(doc.ID)
+		if err != nil {
+			writeCommandError(w, "replication", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, replication.DocumentState{Document: *doc, Chunks: chunks})
+
+	case "chunks":
+		var ids []uint64
+		for _, part := range strings.Split(q.Get("ids"), ",") {
+			if part == "" {
+				continue
+			}
+			id, ok := queryUint(w, part, "ids")
+			if !ok {
+				return
+			}
+			ids = append(ids, id)
+		}
+		found, err := s.meta.GetChunks(ids)
+		if err != nil {
+			writeCommandError(w, "replication", err)
+			return
+		}
+		chunks := []types.Chunk{}
+		for _, id := range ids {
+			if c, ok := found[id]; ok {
+				chunks = append(chunks, c)
+			}
+		}
+		writeJSON(w, http.StatusOK, replication.ChunksPage{Chunks: chunks})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// queryUint parses an optional unsigned query value ("" is 0), answering 400
+// for anything else.
+func queryUint(w http.ResponseWriter, v, name string) (uint64, bool) {
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid "+name+": "+v, http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// Follower returns a replication follower that copies the primary at url
+// into this server's shared stores, under the server's store lock. It fails
+// with -isolate_namespaces, which replication does not cover.
+func (s *Server) Follower(url string) (*replication.Follower, error) {
+	if s.shards != nil {
+		return nil, errors.New("replication does not support -isolate_namespaces")
+	}
+	return &replication.Follower{Primary: url, Shard: s.shared, Guard: &s.mu}, nil
+}
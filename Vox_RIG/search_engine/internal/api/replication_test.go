@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vox-vector-engine/internal/replication"
+)
+
+func TestReplication(t *testing.T) {
+	primary, h := newTestServer(t)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	for _, ns := range []string{"a", "b"} {
+		if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"`+ns+`","conversation_id":"c","role":"user","content":"hi `+ns+`","vector":[1,0]}`); code != http.StatusOK {
+			t.Fatalf("Ingest failed: %d %v", code, out)
+		}
+	}
+	if code, out := post(t, h, "/v1/pins", `{"namespace":"b","chunk_id":1}`); code != http.StatusOK {
+		t.Fatalf("Pin failed: %d %v", code, out)
+	}
+
+	replica, rh := newTestServer(t)
+	replica.SetReadOnly(true)
+	f, err := replica.Follower(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := f.Sync(context.Background())
+	if err != nil || res.Vectors != 2 || res.Changes != 3 {
+		t.Fatalf("Expected 2 vectors and 3 changes, got %+v, %v", res, err)
+	}
+	if code, out := post(t, rh, "/v1/retrieve", `{"namespace":"a","query":[1,0]}`); code != http.StatusOK || len(out["chunks"].([]any)) != 1 {
+		t.Fatalf("Expected the replica to serve the replicated chunk, got %d %v", code, out)
+	}
+	if pins, _ := replica.meta.ListPins("b"); len(pins) != 1 {
+		t.Errorf("Expected the pin to replicate, got %+v", pins)
+	}
+
+	if _, err := primary.engine.PurgeNamespace("a"); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := f.Sync(context.Background()); err != nil || res.Vectors != 0 || res.Changes != 1 {
+		t.Fatalf("Expected one change and no vectors, got %+v, %v", res, err)
+	}
+	if docs, _ := replica.meta.ListDocuments("a"); len(docs) != 0 || replica.index.Contains(0) {
+		t.Errorf("Expected the purge to replicate, got %+v", docs)
+	}
+	if res, err := f.Sync(context.Background()); err != nil || res.Changes != 0 {
+		t.Errorf("Expected a caught-up replica to do nothing, got %+v, %v", res, err)
+	}
+
+	// A replica with vectors the primary does not have has diverged.
+	other, _ := newTestServer(t)
+	for i := 0; i < 3; i++ {
+		other.vecs.Append([]float32{0, 1})
+	}
+	f, _ = other.Follower(ts.URL)
+	if _, err := f.Sync(context.Background()); !errors.Is(err, replication.ErrDiverged) {
+		t.Errorf("Expected ErrDiverged for a replica ahead of the primary, got %v", err)
+	}
+}
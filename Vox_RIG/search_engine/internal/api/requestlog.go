@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey int
+
+const requestInfoKey ctxKey = 0
+
+// requestInfo collects what handlers learn about a request for its log line.
+type requestInfo struct {
+	mu        sync.Mutex
+	id        string
+	namespace string
+	tenant    string
+}
+
+// RequestID returns the ID assigned to the request carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// noteNamespace records the namespace a handler decoded from the body, for
+// the request's log line.
+func noteNamespace(r *http.Request, ns string) {
+	if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok && ns != "" {
+		info.mu.Lock()
+		info.namespace = ns
+		info.mu.Unlock()
+	}
+}
+
+// noteTenant records the tenant that served the request.
+func noteTenant(r *http.Request, tenant string) {
+	if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+		info.mu.Lock()
+		info.tenant = tenant
+		info.mu.Unlock()
+	}
+}
+
+// SetRequestLog sends the per-request JSON lines to w (stderr by default);
+// nil turns them off.
+func (s *Server) SetRequestLog(w io.Writer) {
+	if w == nil {
+		s.requestLog = nil
+		return
+	}
+	s.requestLog = log.New(w, "", 0)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// validRequestID accepts caller IDs that are short and printable ASCII, so
+// they are safe to echo in headers and logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// withRequestLog assigns or propagates X-Request-ID, echoes it in the
+// response and writes one JSON line per request once it completes. The line
+// leaves out vec_count when the stores are locked for writing.
+func (s *Server) withRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := &requestInfo{id: id, namespace: r.URL.Query().Get("namespace")}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)))
+
+		if s.requestLog == nil {
+			return
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		info.mu.Lock()
+		ns, tenant := info.namespace, info.tenant
+		info.mu.Unlock()
+		line, _ := json.Marshal(struct {
+			Time       string  `json:"time"`
+			RequestID  string  `json:"request_id"`
+			Method     string  `json:"method"`
+			Path       string  `json:"path"`
+			Status     int     `json:"status"`
+			LatencyMS  float64 `json:"latency_ms"`
+			Tenant     string  `json:"tenant,omitempty"`
+			Namespace  string  `json:"namespace,omitempty"`
+			VecCount   *uint64 `json:"vec_count,omitempty"`
+			RemoteAddr string  `json:"remote_addr"`
+		}{
+			Time:       start.UTC().Format(time.RFC3339Nano),
+			RequestID:  id,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     rec.status,
+			LatencyMS:  float64(time.Since(start).Microseconds()) / 1000,
+			Tenant:     tenant,
+			Namespace:  ns,
+			VecCount:   s.lockedVectorCount(),
+			RemoteAddr: r.RemoteAddr,
+		})
+		s.requestLog.Print(string(line))
+	})
+}
+
+// lockedVectorCount is vectorCount for callers outside the store lock. It
+// returns nil rather than wait while a snapshot or restore holds the stores,
+// so requests that skip the lock (/healthz) are not held up by their log line.
+func (s *Server) lockedVectorCount() *uint64 {
+	if !s.mu.TryRLock() {
+		return nil
+	}
+	defer s.mu.RUnlock()
+	n := s.vectorCount()
+	return &n
+}
+
+// defaultRequestLog is where request lines go unless SetRequestLog changes it.
+func defaultRequestLog() *log.Logger {
+	return log.New(os.Stderr, "", 0)
+}
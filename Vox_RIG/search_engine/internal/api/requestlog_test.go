@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDEcho(t *testing.T) {
+	s, h := newTestServer(t)
+	var logBuf bytes.Buffer
+	s.SetRequestLog(&logBuf)
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(RequestIDHeader, "client-id-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get(RequestIDHeader); got != "client-id-42" {
+		t.Errorf("Expected the caller's request ID to be echoed, got %q", got)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(logBuf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected one JSON log line, got %q: %v", logBuf.String(), err)
+	}
+	if line["request_id"] != "client-id-42" {
+		t.Errorf("Expected the caller's request ID in the log, got %v", line["request_id"])
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	_, h := newTestServer(t)
+	seen := map[string]bool{}
+	// Absent, containing a space, and too long: each gets a fresh ID.
+	for _, id := range []string{"", "has space", strings.Repeat("x", 129)} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		got := w.Header().Get(RequestIDHeader)
+		if len(got) != 32 || strings.Trim(got, "0123456789abcdef") != "" {
+			t.Errorf("Caller ID %q: expected a generated 32-digit hex ID, got %q", id, got)
+		}
+		if seen[got] {
+			t.Errorf("Generated ID %q twice", got)
+		}
+		seen[got] = true
+	}
+}
+
+func TestRequestLogFields(t *testing.T) {
+	s, h := newTestServer(t)
+	var logBuf bytes.Buffer
+	s.SetRequestLog(&logBuf)
+
+	body := `{"namespace":"ns","conversation_id":"c","message_id":"m","role":"user","content":"hi","vector":[1,0]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/ingest_message", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/ingest_message", nil))
+
+	lines := strings.Split(strings.TrimSpace(logBuf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one log line per request, got %q", logBuf.String())
+	}
+	var ingest struct {
+		Time       string   `json:"time"`
+		RequestID  string   `json:"request_id"`
+		Method     string   `json:"method"`
+		Path       string   `json:"path"`
+		Status     int      `json:"status"`
+		LatencyMS  *float64 `json:"latency_ms"`
+		Namespace  string   `json:"namespace"`
+		VecCount   uint64   `json:"vec_count"`
+		RemoteAddr string   `json:"remote_addr"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &ingest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, ingest.Time); err != nil {
+		t.Errorf("Expected an RFC 3339 time, got %q", ingest.Time)
+	}
+	if ingest.RequestID == "" || ingest.Method != http.MethodPost || ingest.Path != "/v1/ingest_message" || ingest.Status != http.StatusOK {
+		t.Errorf("Unexpected request fields %s", lines[0])
+	}
+	if ingest.LatencyMS == nil || *ingest.LatencyMS < 0 || ingest.Namespace != "ns" || ingest.VecCount != 1 || ingest.RemoteAddr != "192.0.2.1:1234" {
+		t.Errorf("Unexpected latency, namespace, count or address in %s", lines[0])
+	}
+
+	var rejected map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected["status"] != float64(http.StatusMethodNotAllowed) || rejected["method"] != http.MethodGet {
+		t.Errorf("Expected the 405 to be logged, got %s", lines[1])
+	}
+	if _, ok := rejected["namespace"]; ok {
+		t.Errorf("Expected no namespace field without one, got %s", lines[1])
+	}
+}
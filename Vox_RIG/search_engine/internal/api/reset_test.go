@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+)
+
+func newTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vecs.Close() })
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	idx := index.NewHnswIndex(vecs)
+	s := NewServer(engine.NewEngine(idx, vecs, meta), idx, meta, vecs)
+	s.SetRequestLog(nil)
+	return s, s.Router()
+}
+
+func post(t *testing.T, h http.Handler, path, body string) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	var out map[string]any
+	json.Unmarshal(w.Body.Bytes(), &out)
+	return w.Code, out
+}
+
+func TestScopedReset(t *testing.T) {
+	s, h := newTestServer(t)
+	for _, ns := range []string{"a", "b"} {
+		if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"`+ns+`","conversation_id":"c","role":"user","content":"hi","vector":[1,0]}`); code != http.StatusOK {
+			t.Fatalf("Ingest failed: %d %v", code, out)
+		}
+	}
+
+	if code, _ := post(t, h, "/v1/reset", ""); code != http.StatusOK {
+		t.Fatalf("Reset failed: %d", code)
+	}
+	if s.index.Contains(0) || s.index.Contains(1) {
+		t.Fatalf("Expected an empty index after a full reset")
+	}
+
+	if code, out := post(t, h, "/v1/reset", `{"namespace":"a"}`); code != http.StatusOK || out["namespace"] != "a" {
+		t.Fatalf("Namespace reset failed: %d %v", code, out)
+	}
+	if !s.index.Contains(0) || s.index.Contains(1) {
+		t.Errorf("Expected only namespace a's chunk rebuilt")
+	}
+
+	code, out := post(t, h, "/v1/reset", `{"namespace":"a","wipe_data":true}`)
+	if code != http.StatusPreconditionFailed || out["confirm_token"] != engine.PurgeConfirmToken("a") {
+		t.Fatalf("Expected 412 with a confirm token, got %d %v", code, out)
+	}
+	code, out = post(t, h, "/v1/reset", `{"namespace":"a","wipe_data":true,"confirm":"`+engine.PurgeConfirmToken("a")+`"}`)
+	if code != http.StatusOK || out["status"] != "wiped" || out["documents"] != float64(1) {
+		t.Fatalf("Expected namespace a wiped, got %d %v", code, out)
+	}
+	if ids, _ := s.meta.NamespaceChunkIDs("b"); len(ids) != 1 {
+		t.Errorf("Expected namespace b to survive the wipe, got %v", ids)
+	}
+
+	if code, _ := post(t, h, "/v1/reset", `{"wipe_data":true}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for wipe_data without a namespace, got %d", code)
+	}
+}
+
+func TestPurgeEscapedNamespace(t *testing.T) {
+	_, h := newTestServer(t)
+	del := func(path string) (int, map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, path, nil))
+		var out map[string]any
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+
+	// Both the /v1 route and the deprecated one.
+	for _, prefix := range []string{"/v1", ""} {
+		if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"org/repo","conversation_id":"c","role":"user","content":"hi `+prefix+`","vector":[1,0]}`); code != http.StatusOK {
+			t.Fatalf("Ingest failed: %d %v", code, out)
+		}
+		code, out := del(prefix + "/namespaces/org%2Frepo")
+		if code != http.StatusPreconditionFailed || out["namespace"] != "org/repo" {
+			t.Fatalf("%s: expected a confirm token for org/repo, got %d %v", prefix, code, out)
+		}
+		code, out = del(prefix + "/namespaces/org%2Frepo?confirm=" + engine.PurgeConfirmToken("org/repo"))
+		if code != http.StatusOK || out["documents"] != float64(1) {
+			t.Errorf("%s: expected org/repo purged, got %d %v", prefix, code, out)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleSearchText serves GET /search_text?q=...&namespace=...: substring,
+// regex or BM25 matching over chunk content, without vectors.
+func (s *Server) HandleSearchText(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	req := commands.SearchTextRequest{
+		Query:     q.Get("q"),
+		Namespace: q.Get("namespace"),
+		Mode:      q.Get("mode"),
+		Model:     q.Get("model"),
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "limit must be an integer", http.StatusBadRequest)
+			return
+		}
+		req.Limit = n
+	}
+	if v := q.Get("case_sensitive"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "case_sensitive must be a boolean", http.StatusBadRequest)
+			return
+		}
+		req.CaseSensitive = b
+	}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "search_text", err)
+		return
+	}
+	res, err := commands.SearchText(env, req)
+	if err != nil {
+		writeCommandError(w, "search_text", err)
+		return
+	}
+	log.Printf("[search_text] namespace=%s mode=%s matches=%d scanned=%d", req.Namespace, res.Mode, res.Total, res.Scanned)
+	writeJSON(w, http.StatusOK, res)
+}
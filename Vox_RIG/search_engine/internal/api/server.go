@@ -1,79 +1,339 @@
-
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/compact"
+	"vox-vector-engine/internal/embed"
 	"vox-vector-engine/internal/engine"
 	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/ingest"
+	"vox-vector-engine/internal/jobs"
+	"vox-vector-engine/internal/maintenance"
+	"vox-vector-engine/internal/remote"
+	"vox-vector-engine/internal/scrub"
 	"vox-vector-engine/internal/storage"
-	"vox-vector-engine/internal/types"
+	"vox-vector-engine/internal/tokens"
+	"vox-vector-engine/internal/tracing"
 )
 
 type Server struct {
+	// mu is held for reading by every request and for writing by snapshot and
+	// restore, which need the stores quiescent (restore swaps them out).
+	mu sync.RWMutex
+
 	engine *engine.Engine
-	index  *index.HnswIndex
-	meta   *storage.BoltMetadataStore
+	index  index.Index
+	meta   storage.MetadataStore
 	vecs   storage.VectorStore
+
+	// shared wraps the global stores above; used unless shards is set.
+	shared *engine.Shard
+	// shards, when set, gives every namespace its own stores and index.
+	shards *engine.ShardManager
+	// models holds extra embedding spaces selected by the request "model" field.
+	models map[string]*engine.ModelSpace
+
+	// embedder, when set, embeds text chunked on the server (/ingest_text).
+	embedder embed.Provider
+	// tokens fills in missing TokenCount values and recounts at retrieve time.
+	tokens tokens.Counter
+
+	// dataDir and dim locate the on-disk stores; required by snapshot/restore.
+	dataDir string
+	dim     int
+	// metaBackend reopens the metadata store after a restore and opens the
+	// stores of model spaces.
+	metaBackend storage.MetadataBackend
+	// indexConfig configures the indexes the server builds.
+	indexConfig index.Config
+
+	// limits and buckets back withLimits.
+	limits  Limits
+	buckets *rateBuckets
+	// authToken, when set, is the bearer token withAuth requires.
+	authToken string
+
+	// requestLog receives one JSON line per request; nil disables it.
+	requestLog *log.Logger
+
+	// warm and embedProbe back /readyz.
+	warm       warmup
+	embedProbe probe
+
+	// started is reported as uptime by /stats.
+	started time.Time
+
+	// readOnly rejects every write (see withReadOnly).
+	readOnly bool
+
+	// tenants, when set, serves requests that name a tenant from that
+	// tenant's own stores (see EnableTenants).
+	tenants *tenantPool
+
+	// remote, when set, receives a copy of every snapshot (see SetRemote).
+	remote *remote.Client
+
+	// trashRetention is how long soft-deleted documents are kept (see
+	// StartTrashJanitor); 0 keeps them until purged by hand.
+	trashRetention time.Duration
+
+	// keepVersions is passed to the file indexer (see SetKeepVersions).
+	keepVersions int
+
+	// jobQueue runs long operations in the background (see jobs.go).
+	jobQueue *jobs.Queue
+	// ingestSlots, when set, bounds concurrent ingest writes and large
+	// /ingest batches become jobs (see EnableIngestQueue).
+	ingestSlots       chan struct{}
+	asyncIngestChunks int
+
+	// compactor, when set, backs POST /compact.
+	compactor *compact.Compactor
+
+	// roller, when set, keeps rolling conversation summaries (see
+	// EnableRollingSummaries).
+	roller *compact.Roller
+
+	// scrubber redacts chunk content before it is stored (see SetScrubber).
+	scrubber scrub.Chain
+
+	// normalize stores unit vectors and searches unit queries (see
+	// SetNormalize).
+	normalize bool
+	// warnModelMismatch only warns about requests tagged with another
+	// embedding model than their namespace's (see SetWarnModelMismatch).
+	warnModelMismatch bool
+	// shortTerm is how many messages of each conversation stay in memory
+	// before they are stored (see SetShortTerm).
+	shortTerm int
+
+	// lastQuery is when the last query arrived or finished, in Unix
+	// nanoseconds (see withQueryClock).
+	lastQuery atomic.Int64
+	// maintenance, when set, runs housekeeping in scheduled idle windows
+	// until stopMaintenance is called (see EnableMaintenance).
+	maintenance     *maintenance.Scheduler
+	stopMaintenance context.CancelFunc
 }
 
-func NewServer(e *engine.Engine, idx *index.HnswIndex, meta *storage.BoltMetadataStore, vecs storage.VectorStore) *Server {
+func NewServer(e *engine.Engine, idx index.Index, meta storage.MetadataStore, vecs storage.VectorStore) *Server {
 	return &Server{
 		engine: e,
 		index:  idx,
 		meta:   meta,
 		vecs:   vecs,
+		shared: &engine.Shard{
+			Vectors: vecs,
+			Meta:    meta,
+			Index:   idx,
+			Engine:  e,
+		},
+		tokens:     tokens.Heuristic(),
+		requestLog: defaultRequestLog(),
+		limits:     Limits{MaxBodyBytes: DefaultMaxBodyBytes, SearchTimeout: DefaultSearchTimeout},
+		buckets:    &rateBuckets{m: map[string]*bucket{}},
+		started:    time.Now(),
+		jobQueue:   &jobs.Queue{},
 	}
 }
 
-// IngestChunk is used only for receiving data via API
-type IngestChunk struct {
-	DocID      string       `json:"doc_id"`
-	Vector     types.Vector `json:"vector"`
-	Content    string       `json:"content"`
-	StartLine  int          `json:"start_line"`
-	EndLine    int          `json:"end_line"`
-	TokenCount int          `json:"token_count"`
+// SetTokenCounter replaces the default heuristic token counter.
+func (s *Server) SetTokenCounter(c tokens.Counter) {
+	s.tokens = c
 }
 
-type IngestRequest struct {
-	// Namespace is an optional logical partition. If set, it will be copied into
-	// Document.Metadata["namespace"] unless already present.
-	Namespace string         `json:"namespace,omitempty"`
-	Document  types.Document `json:"document"`
-	Chunks    []IngestChunk  `json:"chunks"`
+// SetKeepVersions sets how many prior versions of a re-indexed file are kept
+// searchable (ingest.Indexer.KeepVersions); 0 replaces files in place.
+func (s *Server) SetKeepVersions(n int) {
+	s.keepVersions = n
 }
 
-type RetrieveRequest struct {
-	// Namespace: if provided, only returns chunks whose Document.Metadata["namespace"] matches.
-	Namespace string       `json:"namespace,omitempty"`
-	Query     types.Vector `json:"query"`
-	MaxTokens int          `json:"max_tokens"`
+// EnableNamespaceIsolation routes every request to the shard of its namespace
+// instead of the shared stores. Requests without a namespace go to
+// engine.DefaultNamespace.
+func (s *Server) EnableNamespaceIsolation(m *engine.ShardManager) {
+	s.shards = m
 }
 
-// IngestMessageRequest is a convenience endpoint for chat/memory style ingestion.
-// It ingests exactly one chunk (the message content) and stores namespace + conversation
-// metadata on the Document.
-//
-// Recommended IDs:
-// - namespace: stable project/workspace id (e.g. repo path hash, workspace UUID)
-// - conversation_id: stable chat/thread id
-type IngestMessageRequest struct {
-	Namespace      string       `json:"namespace"`
-	ConversationID string       `json:"conversation_id"`
-	MessageID      string       `json:"message_id,omitempty"` // optional; if empty server generates
-	Role           string       `json:"role"`                 // "user" | "assistant" | "system"
-	Content        string       `json:"content"`
-	Vector         types.Vector `json:"vector"`
-	TokenCount     int          `json:"token_count"`
-	TimestampUTC   string       `json:"timestamp_utc,omitempty"` // optional RFC3339; if empty server uses now
-	Source         string       `json:"source,omitempty"`        // optional; default "chat"
+// SetScrubber makes every ingest path redact chunk content with c before
+// it is embedded or stored; ingest responses report what was redacted.
+func (s *Server) SetScrubber(c scrub.Chain) {
+	s.scrubber = c
+}
+
+// SetNormalize makes every ingest path scale vectors to unit length before
+// they are stored, recording the original norm on each chunk, and every
+// search scale its query, so the index ranks by cosine similarity. It must
+// be called before Indexer, Compactor and EnableRollingSummaries.
+func (s *Server) SetNormalize(on bool) {
+	s.normalize = on
+}
+
+// SetWarnModelMismatch makes ingests and searches tagged with another
+// embedding model than their namespace's go ahead with a model_warning in
+// the response instead of being refused with 409.
+func (s *Server) SetWarnModelMismatch(on bool) {
+	s.warnModelMismatch = on
+}
+
+// SetShortTerm keeps the last n messages of every conversation in a
+// short-term buffer, searched by brute force and stored only as newer
+// messages push them out or the server closes; 0 stores messages at once.
+func (s *Server) SetShortTerm(n int) {
+	s.shortTerm = n
+}
+
+// SetDataDir tells the server where its stores live so it can snapshot and
+// reopen them.
+func (s *Server) SetDataDir(dir string, dim int) {
+	s.dataDir = dir
+	s.dim = dim
+}
+
+// SetMetadataBackend selects the metadata store used when the server opens
+// stores itself (restore, model spaces). Bolt by default.
+func (s *Server) SetMetadataBackend(b storage.MetadataBackend) {
+	s.metaBackend = b
+}
+
+// SetIndexConfig selects the index (see index.New) the server builds when
+// it opens stores itself (restore, tenants, model spaces). In-memory HNSW
+// by default.
+func (s *Server) SetIndexConfig(c index.Config) {
+	s.indexConfig = c
+}
+
+// Indexer returns a file ingest pipeline that writes through this server's
+// shards, embedder and token counter, under the server's store lock.
+func (s *Server) Indexer() *ingest.Indexer {
+	return &ingest.Indexer{
+		Resolve:      s.shardFor,
+		Embedder:     s.embedder,
+		Tokens:       s.tokens,
+		Scrub:        s.scrubber,
+		Guard:        &s.mu,
+		KeepVersions: s.keepVersions,
+		Normalize:    s.normalize,
+	}
+}
+
+// Compactor returns a chat-memory compactor over this server's namespace
+// stores (model spaces are left alone), using the server's embedder and
+// token counter under the store lock. POST /compact runs it on demand.
+func (s *Server) Compactor(sum compact.Summarizer, p compact.Policy) *compact.Compactor {
+	s.compactor = &compact.Compactor{
+		Shards:     s.namespaceShards,
+		Summarizer: sum,
+		Embedder:   s.embedder,
+		Tokens:     s.tokens,
+		Policy:     p,
+		Guard:      &s.mu,
+		Normalize:  s.normalize,
+	}
+	return s.compactor
+}
+
+// EnableRollingSummaries keeps a summary document per conversation, refreshed
+// with sum every `every` messages ingested through /ingest_message, using
+// the server's embedder (see compact.Roller and GET /conversations/{id}/summary).
+func (s *Server) EnableRollingSummaries(sum compact.Summarizer, every int) {
+	s.roller = &compact.Roller{
+		Resolve:    s.shardFor,
+		Summarizer: sum,
+		Embedder:   s.embedder,
+		Tokens:     s.tokens,
+		Every:      every,
+		Guard:      &s.mu,
+		Normalize:  s.normalize,
+	}
+}
+
+// namespaceShards returns the shared stores, or every namespace shard in
+// isolated mode.
+func (s *Server) namespaceShards() ([]*engine.Shard, error) {
+	if s.shards == nil {
+		return []*engine.Shard{s.shared}, nil
+	}
+	return s.shards.All()
+}
+
+// openShards returns the shared stores, or the namespace shards opened so
+// far in isolated mode. Unlike namespaceShards it never opens a shard, so
+// health checks and statistics stay cheap with many cold namespaces.
+func (s *Server) openShards() []*engine.Shard {
+	if s.shards == nil {
+		return []*engine.Shard{s.shared}
+	}
+	return s.shards.Open()
+}
+
+// shardFor resolves the stores that serve ns.
+func (s *Server) shardFor(ns string) (*engine.Shard, error) {
+	if s.shards == nil {
+		return s.shared, nil
+	}
+	return s.shards.Get(ns)
 }
 
+// flushShortTerm stores the messages still held in short-term memory (see
+// SetShortTerm) by the shared engine and every open shard, so a flush or a
+// snapshot covers all that /ingest_message acknowledged. Shards that were
+// never opened hold none.
+func (s *Server) flushShortTerm() error {
+	engines := []*engine.Engine{s.engine}
+	if s.shards != nil {
+		for _, sh := range s.shards.Open() {
+			engines = append(engines, sh.Engine)
+		}
+	}
+	for _, sp := range s.models {
+		for _, sh := range sp.Shards.Open() {
+			engines = append(engines, sh.Engine)
+		}
+	}
+	for _, e := range engines {
+		if err := e.FlushShortTerm(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vectorCount reports the number of stored vectors across all open shards.
+func (s *Server) vectorCount() uint64 {
+	if s.shards == nil {
+		return s.vecs.Count()
+	}
+	var total uint64
+	for _, sh := range s.shards.Open() {
+		total += sh.Vectors.Count()
+	}
+	return total
+}
+
+// Request types are shared with the CLI; see package commands.
+type (
+	IngestChunk          = commands.IngestChunk
+	IngestRequest        = commands.IngestRequest
+	RetrieveRequest      = commands.RetrieveRequest
+	ContextRequest       = commands.ContextRequest
+	IngestMessageRequest = commands.IngestMessageRequest
+	// IngestDocumentRequest is one chunk of a file, as for `-cmd ingest_document`.
+	IngestDocumentRequest = commands.IngestDocumentRequest
+)
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -89,8 +349,8 @@ func (s *Server) HandleRoot(w http.ResponseWriter, r *http.Request) {
 		"service":    "vox-vector-engine",
 		"ok":         true,
 		"time_utc":   time.Now().UTC().Format(time.RFC3339),
-		"endpoints":  []string{"/health", "/stats", "/ingest", "/ingest_message", "/retrieve", "/reset"},
-		"api_schema": 1,
+		"endpoints":  []string{"/health", "/healthz", "/readyz", "/v1/stats", "/v1/stats/vectors", "/v1/ingest", "/v1/ingest_message", "/v1/ingest_document", "/v1/ingest_stream", "/v1/ingest_text", "/v1/retrieve", "/v1/context", "/v1/similar", "/v1/clusters", "/v1/index/verify", "/v1/reindex", "/v1/search_text", "/v1/reset", "/v1/namespaces/{ns}", "/v1/flush", "/v1/snapshot", "/v1/restore", "/v1/pins", "/v1/quotas", "/v1/documents/{id}", "/v1/documents/{id}/tags", "/v1/chunks/{id}", "/v1/openapi.json"},
+		"api_schema": SchemaVersion,
 	})
 }
 
@@ -102,222 +362,436 @@ func (s *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{
 		"ok":        true,
 		"time_utc":  time.Now().UTC().Format(time.RFC3339),
-		"vec_count": s.vecs.Count(),
+		"vec_count": s.vectorCount(),
+		"dim":       s.vecs.Dim(),
 	})
 }
 
-func (s *Server) HandleStats(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"vec_count": s.vecs.Count(),
-	})
+type resetResponse struct {
+	Status    string `json:"status"`
+	Namespace string `json:"namespace,omitempty"`
 }
 
-type resetResponse struct {
-	Status string `json:"status"`
+// resetRequest is the optional body of POST /reset. WipeData also deletes
+// the namespace's vectors and metadata and needs the namespace's purge
+// confirm token, as DELETE /namespaces/{ns} does.
+type resetRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	WipeData  bool   `json:"wipe_data,omitempty"`
+	Confirm   string `json:"confirm,omitempty"`
 }
 
+// HandleReset serves POST /reset. Without a namespace it clears every
+// in-memory index and leaves disk alone (intended for dev/test). With one it
+// rebuilds only that namespace's index from disk, or wipes its data.
 func (s *Server) HandleReset(w http.ResponseWriter, r *http.Request) {
-	// Resets the in-memory ANN index only (does not delete on-disk vectors/metadata).
-	// Intended for dev/test. Production should isolate via namespaces.
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	var req resetRequest
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Namespace == "" {
+		req.Namespace = r.URL.Query().Get("namespace")
+	}
+	ns := req.Namespace
+	noteNamespace(r, ns)
+
+	if req.WipeData {
+		if ns == "" {
+			http.Error(w, "wipe_data requires a namespace", http.StatusBadRequest)
+			return
+		}
+		token := engine.PurgeConfirmToken(ns)
+		if req.Confirm != token {
+			writeJSON(w, http.StatusPreconditionFailed, map[string]any{
+				"status":        "confirm_required",
+				"namespace":     ns,
+				"confirm_token": token,
+			})
+			return
+		}
+		res, err := s.purgeNamespace(ns)
+		if err != nil {
+			log.Printf("[reset] wipe failed namespace=%s: %v", ns, err)
+			http.Error(w, "Failed to wipe namespace", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[reset] wiped namespace=%s documents=%d chunks=%d", ns, res.Documents, res.Chunks)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":    "wiped",
+			"namespace": ns,
+			"documents": res.Documents,
+			"chunks":    res.Chunks,
+		})
+		return
+	}
+
+	if ns != "" {
+		if err := s.rebuildNamespace(ns); err != nil {
+			log.Printf("[reset] rebuild failed namespace=%s: %v", ns, err)
+			http.Error(w, "Failed to rebuild namespace index", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, resetResponse{Status: "reset_ok", Namespace: ns})
+		return
+	}
+
+	if s.shards != nil {
+		if shards, err := s.shards.All(); err == nil {
+			for _, sh := range shards {
+				sh.Index.Reset()
+			}
+		}
+	}
+	if shards, err := s.modelShards(); err == nil {
+		for _, sh := range shards {
+			sh.Index.Reset()
+		}
+	}
 	s.index.Reset()
 	writeJSON(w, http.StatusOK, resetResponse{Status: "reset_ok"})
 }
 
-func (s *Server) HandleIngest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// rebuildNamespace reloads the index entries of ns from disk in the default
+// space and in every model space that has the namespace.
+func (s *Server) rebuildNamespace(ns string) error {
+	if s.shards != nil {
+		if err := s.shards.Rebuild(ns); err != nil {
+			return err
+		}
+	} else if _, err := s.engine.RebuildNamespace(ns); err != nil {
+		return err
+	}
+	for _, sp := range s.models {
+		names, err := sp.Shards.Namespaces()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if name == ns {
+				if err := sp.Shards.Rebuild(ns); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// purgeNamespace deletes ns from the shared stores and drops its shards.
+func (s *Server) purgeNamespace(ns string) (engine.PurgeResult, error) {
+	res, err := s.engine.PurgeNamespace(ns)
+	if err != nil {
+		return res, err
+	}
+	if s.shards != nil {
+		if err := s.shards.Drop(ns); err != nil {
+			return res, fmt.Errorf("drop shard: %w", err)
+		}
+	}
+	for _, sp := range s.models {
+		if err := sp.Shards.Drop(ns); err != nil {
+			return res, fmt.Errorf("drop shard model=%s: %w", sp.Name, err)
+		}
+	}
+	return res, nil
+}
+
+// HandleNamespace serves DELETE /namespaces/{ns}?confirm=<token>[&async=true].
+//
+// Without a matching confirm token nothing is deleted; the response carries
+// the token to send back. In isolated mode the namespace shard directory is
+// removed entirely; in shared mode documents, chunks and index entries are
+// deleted but vectors.bin is not compacted. With async=true the purge runs
+// as a job and the response is 202 with its ID.
+func (s *Server) HandleNamespace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req IngestRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	ns, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/namespaces/"))
+	if err != nil || ns == "" {
+		http.Error(w, "namespace is required: DELETE /namespaces/{ns}", http.StatusBadRequest)
 		return
 	}
 
-	// Apply namespace to document metadata if provided.
-	if req.Namespace != "" {
-		if req.Document.Metadata == nil {
-			req.Document.Metadata = types.Metadata{}
-		}
-		if _, exists := req.Document.Metadata["namespace"]; !exists {
-			req.Document.Metadata["namespace"] = req.Namespace
-		}
+	noteNamespace(r, ns)
+
+	token := engine.PurgeConfirmToken(ns)
+	if r.URL.Query().Get("confirm") != token {
+		writeJSON(w, http.StatusPreconditionFailed, map[string]any{
+			"status":        "confirm_required",
+			"namespace":     ns,
+			"confirm_token": token,
+		})
+		return
 	}
 
-	log.Printf("[ingest] doc_id=%s source=%s chunks=%d namespace=%v",
-		req.Document.ID, req.Document.Source, len(req.Chunks), req.Document.Metadata["namespace"])
+	if r.URL.Query().Get("async") == "true" {
+		s.submitJob(w, "namespace_purge", ns, func(context.Context) (any, error) {
+			// A purge cannot stop halfway, so canceling only helps while
+			// the job waits.
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			res, err := s.purgeNamespace(ns)
+			if err != nil {
+				log.Printf("[purge] failed namespace=%s: %v", ns, err)
+				return nil, errors.New("failed to purge namespace")
+			}
+			log.Printf("[purge] ok namespace=%s documents=%d chunks=%d (async)", ns, res.Documents, res.Chunks)
+			return map[string]any{"namespace": ns, "documents": res.Documents, "chunks": res.Chunks, "shard_dropped": s.shards != nil}, nil
+		})
+		return
+	}
 
-	if err := s.meta.SaveDocument(req.Document); err != nil {
-		log.Printf("[ingest] failed saving document id=%s: %v", req.Document.ID, err)
-		http.Error(w, "Failed to save document", http.StatusInternalServerError)
+	res, err := s.purgeNamespace(ns)
+	if err != nil {
+		log.Printf("[purge] failed namespace=%s: %v", ns, err)
+		http.Error(w, "Failed to purge namespace", http.StatusInternalServerError)
 		return
 	}
 
-	ingestedIDs := make([]uint64, 0, len(req.Chunks))
+	log.Printf("[purge] ok namespace=%s documents=%d chunks=%d", ns, res.Documents, res.Chunks)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":        "purged",
+		"namespace":     ns,
+		"documents":     res.Documents,
+		"chunks":        res.Chunks,
+		"shard_dropped": s.shards != nil,
+	})
+}
+
+// HandleFlush stores the short-term messages and forces every vector store
+// (shared and namespace shards) to disk.
+func (s *Server) HandleFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	for _, ic := range req.Chunks {
-		id, err := s.vecs.Append(ic.Vector)
+	if err := s.flushShortTerm(); err != nil {
+		log.Printf("[flush] short-term failed: %v", err)
+		http.Error(w, "Failed to store short-term messages", http.StatusInternalServerError)
+		return
+	}
+	if err := s.vecs.Sync(); err != nil {
+		log.Printf("[flush] failed: %v", err)
+		http.Error(w, "Failed to flush vector store", http.StatusInternalServerError)
+		return
+	}
+	var shards []*engine.Shard
+	if s.shards != nil {
+		nsShards, err := s.shards.All()
 		if err != nil {
-			log.Printf("[ingest] failed append vector doc_id=%s: %v", ic.DocID, err)
-			http.Error(w, "Failed to append vector", http.StatusInternalServerError)
+			http.Error(w, "Failed to open namespace shards", http.StatusInternalServerError)
 			return
 		}
+		shards = nsShards
+	}
+	modelShards, err := s.modelShards()
+	if err != nil {
+		log.Printf("[flush] failed: %v", err)
+		http.Error(w, "Failed to open namespace shards", http.StatusInternalServerError)
+		return
+	}
+	shards = append(shards, modelShards...)
 
-		chunk := types.Chunk{
-			ID:         id,
-			DocID:      ic.DocID,
-			Content:    ic.Content,
-			StartLine:  ic.StartLine,
-			EndLine:    ic.EndLine,
-			TokenCount: ic.TokenCount,
-		}
-
-		s.index.Add(id, ic.Vector)
-
-		if err := s.meta.SaveChunk(chunk); err != nil {
-			log.Printf("[ingest] failed save chunk metadata id=%d doc_id=%s: %v", id, ic.DocID, err)
-			http.Error(w, "Failed to save chunk metadata", http.StatusInternalServerError)
+	for _, sh := range shards {
+		if err := sh.Vectors.Sync(); err != nil {
+			log.Printf("[flush] failed namespace=%s: %v", sh.Namespace, err)
+			http.Error(w, "Failed to flush vector store", http.StatusInternalServerError)
 			return
 		}
-
-		ingestedIDs = append(ingestedIDs, id)
 	}
-
-	log.Printf("[ingest] ok doc_id=%s ingested=%d vec_count=%d", req.Document.ID, len(ingestedIDs), s.vecs.Count())
+	// The access log is best effort: a read-only store cannot take it.
+	if err := s.engine.FlushAccess(); err != nil {
+		log.Printf("[flush] access log failed: %v", err)
+	}
+	for _, sh := range shards {
+		if err := sh.Engine.FlushAccess(); err != nil {
+			log.Printf("[flush] access log failed namespace=%s: %v", sh.Namespace, err)
+		}
+	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"status":       "ingested",
-		"doc_id":       req.Document.ID,
-		"chunk_ids":    ingestedIDs,
-		"vector_count": s.vecs.Count(),
+		"status": "flushed",
+		"stores": 1 + len(shards),
 	})
 }
 
-func (s *Server) HandleIngestMessage(w http.ResponseWriter, r *http.Request) {
+// env is the command environment backed by this server's shards.
+func (s *Server) env() commands.Env {
+	return commands.Env{
+		Resolve:  s.shardFor,
+		Embedder: s.embedder,
+		Tokens:   s.tokens,
+		Dim:      s.vecs.Dim(),
+		Scrub:    s.scrubber,
+
+		SearchTimeout:     s.limits.SearchTimeout,
+		Normalize:         s.normalize,
+		WarnModelMismatch: s.warnModelMismatch,
+		ShortTerm:         s.shortTerm,
+		KeepVersions:      s.keepVersions,
+	}
+}
+
+// writeCommandError logs err and answers with its client-facing message and
+// the status that matches its kind.
+func writeCommandError(w http.ResponseWriter, tag string, err error) {
+	log.Printf("[%s] %v", tag, err)
+	status := http.StatusInternalServerError
+	switch commands.KindOf(err) {
+	case commands.Invalid:
+		status = http.StatusBadRequest
+	case commands.Upstream:
+		status = http.StatusBadGateway
+	case commands.NotFound:
+		status = http.StatusNotFound
+	case commands.Conflict:
+		status = http.StatusConflict
+	case commands.Timeout:
+		var ie *engine.Interrupted
+		if errors.As(err, &ie) {
+			writeJSON(w, http.StatusGatewayTimeout, map[string]any{
+				"error": "timeout", "message": commands.Message(err), "status": http.StatusGatewayTimeout,
+				"stage": ie.Stage, "candidates": ie.Candidates, "scored": ie.Scored, "elapsed_ms": ie.Elapsed.Milliseconds(),
+			})
+			return
+		}
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, commands.Message(err), status)
+}
+
+func (s *Server) HandleIngest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req IngestMessageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req IngestRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
+	noteNamespace(r, req.Namespace)
 
-	if req.Namespace == "" {
-		http.Error(w, "namespace is required", http.StatusBadRequest)
+	log.Printf("[ingest] doc_id=%s source=%s chunks=%d namespace=%v",
+		req.Document.ID, req.Document.Source, len(req.Chunks), req.Namespace)
+
+	if s.ingestSlots != nil && s.asyncIngestChunks > 0 && len(req.Chunks) >= s.asyncIngestChunks {
+		s.queueIngest(w, req)
 		return
 	}
-	if req.ConversationID == "" {
-		http.Error(w, "conversation_id is required", http.StatusBadRequest)
+	release, err := s.acquireIngest(r.Context())
+	if err != nil {
+		http.Error(w, "Request canceled", http.StatusServiceUnavailable)
 		return
 	}
-	if req.Role == "" {
-		http.Error(w, "role is required", http.StatusBadRequest)
+	defer release()
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "ingest", err)
 		return
 	}
-	if req.Content == "" {
-		http.Error(w, "content is required", http.StatusBadRequest)
+	res, err := commands.Ingest(r.Context(), env, req)
+	if err != nil {
+		writeCommandError(w, "ingest", err)
 		return
 	}
-	if len(req.Vector) == 0 {
-		http.Error(w, "vector is required", http.StatusBadRequest)
+
+	log.Printf("[ingest] ok doc_id=%s ingested=%d vec_count=%d", res.DocID, len(res.ChunkIDs), res.VectorCount)
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) HandleIngestMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	ts := time.Now().UTC()
-	if req.TimestampUTC != "" {
-		parsed, err := time.Parse(time.RFC3339, req.TimestampUTC)
-		if err != nil {
-			http.Error(w, "timestamp_utc must be RFC3339", http.StatusBadRequest)
-			return
-		}
-		ts = parsed.UTC()
+	var req IngestMessageRequest
+	if !decodeJSON(w, r, &req) {
+		return
 	}
+	noteNamespace(r, req.Namespace)
 
-	source := req.Source
-	if source == "" {
-		source = "chat"
-	}
+	log.Printf("[ingest_message] start namespace=%s conversation_id=%s message_id=%s role=%s",
+		req.Namespace, req.ConversationID, req.MessageID, req.Role)
 
-	msgID := req.MessageID
-	if msgID == "" {
-		// time-based id; caller can also supply a stable UUID.
-		msgID = fmt.Sprintf("msg-%d", time.Now().UTC().UnixNano())
+	release, err := s.acquireIngest(r.Context())
+	if err != nil {
+		http.Error(w, "Request canceled", http.StatusServiceUnavailable)
+		return
 	}
+	defer release()
 
-	// One message == one document + one chunk.
-	// DocID is stable across retries if message_id is stable.
-	docID := fmt.Sprintf("chat:%s:%s", req.ConversationID, msgID)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "ingest_message", err)
+		return
+	}
+	res, err := commands.IngestMessage(r.Context(), env, req)
+	if err != nil {
+		writeCommandError(w, "ingest_message", err)
+		return
+	}
 
-	doc := types.Document{
-		ID:        docID,
-		Source:    source,
-		Timestamp: ts,
-		Metadata: types.Metadata{
-			"namespace":       req.Namespace,
-			"conversation_id": req.ConversationID,
-			"message_id":      msgID,
-			"role":            req.Role,
-			"type":            "chat_message",
-		},
+	log.Printf("[ingest_message] ok doc_id=%s chunk_id=%d vec_count=%d", res.DocID, res.ChunkID, res.VectorCount)
+	if s.roller != nil && req.Model == "" && !res.Duplicate {
+		s.roller.Note(req.Namespace, req.ConversationID)
 	}
 
-	log.Printf("[ingest_message] start namespace=%s conversation_id=%s message_id=%s role=%s",
-		req.Namespace, req.ConversationID, msgID, req.Role)
+	writeJSON(w, http.StatusOK, res)
+}
 
-	if err := s.meta.SaveDocument(doc); err != nil {
-		log.Printf("[ingest_message] failed saving document id=%s: %v", doc.ID, err)
-		http.Error(w, "Failed to save document", http.StatusInternalServerError)
+// HandleIngestDocument stores one embedded chunk of a file, or all of a
+// file's chunks, under the same document IDs as `-cmd ingest_document`
+// (see commands.IngestDocumentRequest).
+func (s *Server) HandleIngestDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	vecID, err := s.vecs.Append(req.Vector)
-	if err != nil {
-		log.Printf("[ingest_message] failed append vector doc_id=%s: %v", doc.ID, err)
-		http.Error(w, "Failed to append vector", http.StatusInternalServerError)
+	var req IngestDocumentRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
+	noteNamespace(r, req.Namespace)
 
-	chunk := types.Chunk{
-		ID:         vecID,
-		DocID:      doc.ID,
-		Content:    req.Content,
-		StartLine:  0,
-		EndLine:    0,
-		TokenCount: req.TokenCount,
-	}
+	log.Printf("[ingest_document] start namespace=%s file_path=%s lines=%d-%d chunks=%d",
+		req.Namespace, req.FilePath, req.StartLine, req.EndLine, len(req.Chunks))
 
-	s.index.Add(vecID, req.Vector)
+	release, err := s.acquireIngest(r.Context())
+	if err != nil {
+		http.Error(w, "Request canceled", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
 
-	if err := s.meta.SaveChunk(chunk); err != nil {
-		log.Printf("[ingest_message] failed save chunk metadata id=%d doc_id=%s: %v", vecID, doc.ID, err)
-		http.Error(w, "Failed to save chunk metadata", http.StatusInternalServerError)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "ingest_document", err)
+		return
+	}
+	res, err := commands.IngestDocument(r.Context(), env, req)
+	if err != nil {
+		writeCommandError(w, "ingest_document", err)
 		return
 	}
 
-	log.Printf("[ingest_message] ok doc_id=%s chunk_id=%d vec_count=%d", doc.ID, vecID, s.vecs.Count())
+	log.Printf("[ingest_document] ok doc_id=%s ingested=%d replaced=%d vec_count=%d", res.DocID, len(res.ChunkIDs), res.Replaced, res.VectorCount)
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"status":         "ingested_message",
-		"doc_id":         doc.ID,
-		"chunk_id":       vecID,
-		"vector_count":   s.vecs.Count(),
-		"message_id":     msgID,
-		"conversation_id": req.ConversationID,
-		"namespace":      req.Namespace,
-	})
+	writeJSON(w, http.StatusOK, res)
 }
 
 func (s *Server) HandleRetrieve(w http.ResponseWriter, r *http.Request) {
@@ -327,50 +801,122 @@ func (s *Server) HandleRetrieve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req RetrieveRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
+	noteNamespace(r, req.Namespace)
 
-	if len(req.Query) == 0 {
-		http.Error(w, "query vector is required", http.StatusBadRequest)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "retrieve", err)
+		return
+	}
+	res, err := commands.Retrieve(r.Context(), env, req)
+	if err != nil {
+		writeCommandError(w, "retrieve", err)
 		return
 	}
-	if req.MaxTokens <= 0 {
-		req.MaxTokens = 2000
+
+	_, span := tracing.Start(r.Context(), "json.encode")
+	writeJSON(w, http.StatusOK, res)
+	span.End()
+}
+
+// HandleContext is /retrieve with the chunks formatted for a prompt:
+// markdown headed by file path and line range, or JSON sources.
+func (s *Server) HandleContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	cfg := engine.RetrievalConfig{
-		MaxTokens:        req.MaxTokens,
-		SimilarityWeight: 0.8,
-		RecencyWeight:    0.2,
-		TopKCandidates:   50,
-		Namespace:        req.Namespace,
+	var req ContextRequest
+	if !decodeJSON(w, r, &req) {
+		return
 	}
+	noteNamespace(r, req.Namespace)
 
-	res, err := s.engine.Retrieve(req.Query, cfg)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "context", err)
+		return
+	}
+	res, err := commands.Context(r.Context(), env, req)
 	if err != nil {
-		http.Error(w, "retrieval failed", http.StatusInternalServerError)
+		writeCommandError(w, "context", err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"chunks":       res.Chunks,
-		"total_tokens": res.TotalTokens,
-		"truncated":    res.Truncated,
-	})
+	_, span := tracing.Start(r.Context(), "json.encode")
+	writeJSON(w, http.StatusOK, res)
+	span.End()
 }
 
 func (s *Server) Router() http.Handler {
+	return s.withRequestLog(s.withTracing(s.withVersion(s.withAuth(s.withGzip(s.withLimits(s.withQueryClock(s.withTenants(s.routes()))))))))
+}
+
+// routes returns the endpoints behind the per-request middleware of Router;
+// tenants are served through their own routes.
+func (s *Server) routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.HandleRoot)
 	mux.HandleFunc("/health", s.HandleHealth)
+	mux.HandleFunc("/healthz", s.HandleHealthz)
+	mux.HandleFunc("/readyz", s.HandleReadyz)
 	mux.HandleFunc("/stats", s.HandleStats)
+	mux.HandleFunc("/stats/vectors", s.HandleVectorStats)
 	mux.HandleFunc("/reset", s.HandleReset)
 	mux.HandleFunc("/ingest", s.HandleIngest)
 	mux.HandleFunc("/ingest_message", s.HandleIngestMessage)
+	mux.HandleFunc("/ingest_document", s.HandleIngestDocument)
+	mux.HandleFunc("/ingest_stream", s.HandleIngestStream)
+	mux.HandleFunc("/ingest_text", s.HandleIngestText)
 	mux.HandleFunc("/retrieve", s.HandleRetrieve)
-	return mux
+	mux.HandleFunc("/context", s.HandleContext)
+	mux.HandleFunc("/warm", s.HandleWarm)
+	mux.HandleFunc("/similar", s.HandleSimilar)
+	mux.HandleFunc("/clusters", s.HandleClusters)
+	mux.HandleFunc("/index/verify", s.HandleIndexVerify)
+	mux.HandleFunc("/reindex", s.HandleReindex)
+	mux.HandleFunc("/namespaces/", s.HandleNamespace)
+	mux.HandleFunc("/flush", s.HandleFlush)
+	mux.HandleFunc("/snapshot", s.HandleSnapshot)
+	mux.HandleFunc("/restore", s.HandleRestore)
+	mux.HandleFunc("/search_text", s.HandleSearchText)
+	mux.HandleFunc("/conversations/", s.HandleConversations)
+	mux.HandleFunc("/pins", s.HandlePins)
+	mux.HandleFunc("/feedback", s.HandleFeedback)
+	mux.HandleFunc("/templates", s.HandleTemplates)
+	mux.HandleFunc("/quotas", s.HandleQuotas)
+	mux.HandleFunc("/documents/", s.HandleDocuments)
+	mux.HandleFunc("/chunks/", s.HandleChunks)
+	mux.HandleFunc("/changes", s.HandleChanges)
+	mux.HandleFunc("/jobs", s.HandleJobs)
+	mux.HandleFunc("/jobs/", s.HandleJobs)
+	mux.HandleFunc("/compact", s.HandleCompact)
+	mux.HandleFunc("/maintenance", s.HandleMaintenance)
+	mux.HandleFunc("/ingest_dir", s.HandleIngestDir)
+	mux.HandleFunc("/trash", s.HandleTrash)
+	mux.HandleFunc("/replication/", s.HandleReplication)
+	mux.HandleFunc("/openapi.json", s.HandleOpenAPI)
+	return s.withReadOnly(s.withStoreLock(mux))
+}
+
+// withStoreLock holds the read side of s.mu around every request except the
+// ones that take the write side themselves and /healthz, which must answer
+// even while a restore holds the stores.
+func (s *Server) withStoreLock(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/snapshot", "/restore", "/healthz":
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) Start(addr string) error {
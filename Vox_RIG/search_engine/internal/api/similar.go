@@ -0,0 +1,35 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleSimilar serves POST /similar {namespace, doc_id | chunk_id, limit}:
+// the documents nearest a stored document or chunk, queried with its stored
+// vectors, for "find code related to this file" without a new embedding.
+func (s *Server) HandleSimilar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req commands.SimilarRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	noteNamespace(r, req.Namespace)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "similar", err)
+		return
+	}
+	res, err := commands.Similar(r.Context(), env, req)
+	if err != nil {
+		writeCommandError(w, "similar", err)
+		return
+	}
+	log.Printf("[similar] namespace=%s doc_id=%s vectors=%d documents=%d", req.Namespace, res.DocID, res.Vectors, len(res.Documents))
+	writeJSON(w, http.StatusOK, res)
+}
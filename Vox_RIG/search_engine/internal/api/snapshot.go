@@ -0,0 +1,310 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/remote"
+	"vox-vector-engine/internal/snapshot"
+	"vox-vector-engine/internal/storage"
+)
+
+type restoreRequest struct {
+	Snapshot string `json:"snapshot"`
+}
+
+func (s *Server) snapshotRoot() string {
+	return filepath.Join(s.dataDir, "snapshots")
+}
+
+// HandleSnapshot serves POST /snapshot (create) and GET /snapshot (list).
+func (s *Server) HandleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.dataDir == "" {
+		http.Error(w, "snapshots are not configured", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		names, err := snapshot.List(s.snapshotRoot())
+		if err != nil {
+			http.Error(w, "Failed to list snapshots", http.StatusInternalServerError)
+			return
+		}
+		if names == nil {
+			names = []string{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"snapshots": names})
+	case http.MethodPost:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		m, err := s.createSnapshot()
+		if err != nil {
+			log.Printf("[snapshot] failed: %v", err)
+			http.Error(w, "Failed to create snapshot", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[snapshot] ok name=%s vec_count=%d namespaces=%d", m.Name, m.VectorCount, len(m.Namespaces))
+		resp := map[string]any{
+			"status":   "snapshot_ok",
+			"snapshot": m,
+		}
+		if s.remote != nil {
+			// The snapshot directory never changes once written, so the
+			// upload does not need to hold up writers.
+			go s.pushSnapshot(m.Name)
+			resp["remote"] = s.remote.String()
+		}
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createSnapshot must be called with s.mu held for writing.
+func (s *Server) createSnapshot() (*snapshot.Manifest, error) {
+	vecs, ok := s.vecs.(*storage.MmapVectorStore)
+	if !ok {
+		return nil, fmt.Errorf("vector store %T does not support snapshots", s.vecs)
+	}
+
+	// Buffered messages are acknowledged; the snapshot must hold them.
+	if err := s.flushShortTerm(); err != nil {
+		return nil, fmt.Errorf("store short-term messages: %w", err)
+	}
+	dir, name, err := snapshot.NewDir(s.snapshotRoot(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := snapshot.Write(dir, vecs, s.meta, s.index); err != nil {
+		return nil, err
+	}
+
+	m := snapshot.Manifest{
+		Name:        name,
+		CreatedUTC:  time.Now().UTC().Format(time.RFC3339),
+		Dim:         s.dim,
+		VectorCount: vecs.Count(),
+	}
+
+	if s.shards != nil {
+		shards, err := s.shards.All()
+		if err != nil {
+			return nil, err
+		}
+		for _, sh := range shards {
+			shVecs, ok := sh.Vectors.(*storage.MmapVectorStore)
+			if !ok {
+				return nil, fmt.Errorf("namespace %q: vector store %T does not support snapshots", sh.Namespace, sh.Vectors)
+			}
+			shDir := filepath.Join(dir, snapshot.ShardsDir, filepath.Base(sh.Dir))
+			if err := snapshot.Write(shDir, shVecs, sh.Meta, sh.Index); err != nil {
+				return nil, fmt.Errorf("namespace %q: %w", sh.Namespace, err)
+			}
+			m.Namespaces = append(m.Namespaces, sh.Namespace)
+		}
+	}
+
+	for _, sp := range s.models {
+		if err := snapshot.WriteModel(dir, sp); err != nil {
+			return nil, err
+		}
+		if m.Models == nil {
+			m.Models = map[string]int{}
+		}
+		m.Models[sp.Name] = sp.Dim
+	}
+
+	if err := snapshot.WriteManifest(dir, m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SetRemote uploads every snapshot created through /snapshot to c (-remote).
+func (s *Server) SetRemote(c *remote.Client) {
+	s.remote = c
+}
+
+func (s *Server) pushSnapshot(name string) {
+	start := time.Now()
+	res, err := remote.Push(context.Background(), s.remote, filepath.Join(s.snapshotRoot(), name), name)
+	if err != nil {
+		log.Printf("[remote] push failed snapshot=%s remote=%s: %v", name, s.remote, err)
+		return
+	}
+	log.Printf("[remote] pushed snapshot=%s remote=%s files=%d bytes=%d took=%s", name, s.remote, res.Files, res.Bytes, time.Since(start).Round(time.Millisecond))
+}
+
+// HandleRestore serves POST /restore {"snapshot":"<name>"}. It replaces the
+// live stores with the named snapshot; all other requests wait until it ends.
+func (s *Server) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.dataDir == "" {
+		http.Error(w, "snapshots are not configured", http.StatusNotImplemented)
+		return
+	}
+
+	var req restoreRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	dir, err := snapshot.Resolve(s.snapshotRoot(), req.Snapshot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	m, err := snapshot.ReadManifest(dir)
+	if err != nil {
+		http.Error(w, "Failed to read snapshot manifest", http.StatusInternalServerError)
+		return
+	}
+	if m.Dim != 0 && m.Dim != s.dim {
+		http.Error(w, fmt.Sprintf("snapshot dim=%d does not match server dim=%d", m.Dim, s.dim), http.StatusConflict)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.vecs.(*storage.MmapVectorStore); !ok {
+		http.Error(w, fmt.Sprintf("vector store %T does not support snapshots", s.vecs), http.StatusConflict)
+		return
+	}
+	if err := s.restoreFrom(dir); err != nil {
+		log.Printf("[restore] failed snapshot=%s: %v", req.Snapshot, err)
+		http.Error(w, "Failed to restore snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[restore] ok snapshot=%s vec_count=%d", req.Snapshot, s.vecs.Count())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":    "restore_ok",
+		"snapshot":  req.Snapshot,
+		"vec_count": s.vecs.Count(),
+	})
+}
+
+// restoreFrom must be called with s.mu held for writing. The stores are always
+// reopened; a failed copy leaves the previous files in place, so the server
+// keeps running on the data it had.
+func (s *Server) restoreFrom(dir string) error {
+	var (
+		policy storage.FlushPolicy
+		growth storage.GrowthPolicy
+	)
+	if old, ok := s.vecs.(*storage.MmapVectorStore); ok {
+		policy, growth = old.FlushPolicy(), old.GrowthPolicy()
+	}
+	// The engine goes with its stores. Its buffered messages are stored
+	// first, as on Close, so a failed restore keeps them; the shards flush
+	// theirs when they close below.
+	if err := s.engine.FlushShortTerm(); err != nil {
+		log.Printf("[restore] short-term flush failed: %v", err)
+	}
+	_ = s.index.Close()
+	_ = s.vecs.Close()
+	_ = s.meta.Close()
+	restoreErr := snapshot.RestoreFiles(dir, s.dataDir)
+
+	vecs, err := storage.NewMmapVectorStoreWithGrowth(filepath.Join(s.dataDir, snapshot.VectorsFile), s.dim, growth)
+	if err != nil {
+		return fmt.Errorf("reopen vector store: %w", err)
+	}
+	vecs.SetFlushPolicy(policy)
+	meta, err := s.metaBackend.Open(filepath.Join(s.dataDir, snapshot.MetadataFile))
+	if err != nil {
+		_ = vecs.Close()
+		return fmt.Errorf("reopen metadata store: %w", err)
+	}
+
+	idx, err := index.New(s.indexConfig, vecs)
+	if err != nil {
+		_ = meta.Close()
+		_ = vecs.Close()
+		return err
+	}
+	loaded := false
+	if restoreErr == nil {
+		loaded, _ = snapshot.LoadIndex(dir, idx)
+	}
+	if !loaded {
+		idx.Reset()
+		engine.RebuildIndex(idx, vecs)
+	}
+
+	eng := engine.NewEngine(idx, vecs, meta)
+	s.engine = eng
+	s.index = idx
+	s.meta = meta
+	s.vecs = vecs
+	s.shared = &engine.Shard{Vectors: vecs, Meta: meta, Index: idx, Engine: eng}
+
+	if restoreErr != nil {
+		return restoreErr
+	}
+
+	if s.shards != nil {
+		if err := s.shards.Close(); err != nil {
+			return err
+		}
+		if err := snapshot.RestoreShards(dir, s.shards.Root()); err != nil {
+			return err
+		}
+	}
+
+	for _, sp := range s.models {
+		if err := sp.Shards.Close(); err != nil {
+			return err
+		}
+	}
+	restoreErr = snapshot.RestoreModels(dir, s.modelsRoot())
+	for name, sp := range s.models {
+		if err := s.AddModel(name, sp.Dim); err != nil {
+			return err
+		}
+	}
+	return restoreErr
+}
+
+// Close closes the stores currently owned by the server. After a restore these
+// differ from the ones passed to NewServer.
+func (s *Server) Close() error {
+	if s.tenants != nil {
+		s.tenants.closeAll()
+	}
+	if s.stopMaintenance != nil {
+		s.stopMaintenance()
+	}
+	s.jobQueue.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.engine.FlushShortTerm(); err != nil {
+		log.Printf("[short-term] flush failed: %v", err)
+	}
+	if err := s.engine.FlushAccess(); err != nil {
+		log.Printf("[access] flush failed: %v", err)
+	}
+	for _, sp := range s.models {
+		_ = sp.Shards.Close()
+	}
+	_ = s.index.Close()
+	vErr := s.vecs.Close()
+	mErr := s.meta.Close()
+	if vErr != nil {
+		return vErr
+	}
+	return mErr
+}
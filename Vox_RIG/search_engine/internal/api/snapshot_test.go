@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+)
+
+// newSnapshotServer is a test server with its stores in a data directory,
+// so it can snapshot and restore them, keeping chat messages in short-term
+// memory.
+func newSnapshotServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := index.NewHnswIndex(vecs)
+	s := NewServer(engine.NewEngine(idx, vecs, meta), idx, meta, vecs)
+	s.SetRequestLog(nil)
+	s.SetDataDir(dir, 2)
+	s.SetShortTerm(5)
+	// A restore replaces the stores; Close closes whichever are current.
+	t.Cleanup(func() { s.Close() })
+	return s, s.Router()
+}
+
+// ingestShortTerm ingests a chat message and checks it stayed in memory.
+func ingestShortTerm(t *testing.T, h http.Handler, messageID, vector string) string {
+	t.Helper()
+	code, out := post(t, h, "/v1/ingest_message", `{"namespace":"ns","conversation_id":"c","message_id":"`+messageID+`","role":"user","content":"`+messageID+`","vector":`+vector+`}`)
+	if code != http.StatusOK || out["short_term"] != true {
+		t.Fatalf("Expected %s in short-term memory, got %d %v", messageID, code, out)
+	}
+	return out["doc_id"].(string)
+}
+
+func TestFlushStoresShortTerm(t *testing.T) {
+	s, h := newSnapshotServer(t)
+	docID := ingestShortTerm(t, h, "m1", "[1,0]")
+	if _, err := s.meta.GetDocument(docID); err == nil {
+		t.Fatal("Expected the message to be held in memory only")
+	}
+
+	if code, out := post(t, h, "/v1/flush", ""); code != http.StatusOK || out["status"] != "flushed" {
+		t.Fatalf("Flush failed: %d %v", code, out)
+	}
+	if _, err := s.meta.GetDocument(docID); err != nil {
+		t.Errorf("Expected the flush to store the message: %v", err)
+	}
+	if n := s.vecs.Count(); n != 1 {
+		t.Errorf("Expected the message's vector to be stored, got %d vectors", n)
+	}
+}
+
+func TestSnapshotIncludesShortTerm(t *testing.T) {
+	s, h := newSnapshotServer(t)
+	m1 := ingestShortTerm(t, h, "m1", "[1,0]")
+
+	code, out := post(t, h, "/v1/snapshot", "")
+	if code != http.StatusOK {
+		t.Fatalf("Snapshot failed: %d %v", code, out)
+	}
+	m, _ := out["snapshot"].(map[string]any)
+	if m["vector_count"] != float64(1) {
+		t.Errorf("Expected the buffered message in the snapshot, got %v", m)
+	}
+
+	// Buffered after the snapshot, so the restore drops it.
+	m2 := ingestShortTerm(t, h, "m2", "[0,1]")
+	if code, out := post(t, h, "/v1/restore", `{"snapshot":"`+m["name"].(string)+`"}`); code != http.StatusOK {
+		t.Fatalf("Restore failed: %d %v", code, out)
+	}
+
+	// The restored engine starts with empty buffers, so whatever retrieval
+	// finds came from the snapshot.
+	if _, ok := s.engine.ShortTermMessage(m1); ok {
+		t.Fatal("Expected no short-term messages after the restore")
+	}
+	if _, err := s.meta.GetDocument(m1); err != nil {
+		t.Errorf("Expected the restored store to hold %s: %v", m1, err)
+	}
+	if _, err := s.meta.GetDocument(m2); err == nil {
+		t.Errorf("Expected %s, ingested after the snapshot, to be gone", m2)
+	}
+	code, out = post(t, h, "/v1/retrieve", `{"namespace":"ns","query":[1,0],"max_tokens":100}`)
+	chunks, _ := out["chunks"].([]any)
+	if code != http.StatusOK || len(chunks) != 1 {
+		t.Errorf("Expected the snapshot's message to be retrieved, got %d %v", code, out)
+	}
+}
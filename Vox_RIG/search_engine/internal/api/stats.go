@@ -0,0 +1,196 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// storeStats describes the stores of one shard, or of several summed.
+type storeStats struct {
+	VecCount   uint64 `json:"vec_count"`
+	ChunkCount int    `json:"chunk_count"`
+	IndexNodes int    `json:"index_nodes"`
+	// IndexDrift is chunk_count - index_nodes. Purged vectors stay in
+	// vectors.bin, so live chunks are what the index should hold; a
+	// non-zero drift once /readyz is ready means the index needs a rebuild
+	// (POST /reset with the namespace).
+	IndexDrift int64 `json:"index_drift"`
+	// VectorsBytes is the length of the vectors files and VectorsDiskBytes
+	// the disk they occupy: less while they are sparse, e.g. after
+	// -preallocate with -sparse_vectors.
+	VectorsBytes     int64 `json:"vectors_bytes"`
+	VectorsDiskBytes int64 `json:"vectors_disk_bytes"`
+	MetadataBytes    int64 `json:"metadata_bytes"`
+	// MmapCapacity is how many vectors fit before vectors.bin grows.
+	MmapCapacity uint64 `json:"mmap_capacity"`
+}
+
+func (st *storeStats) add(o storeStats) {
+	st.VecCount += o.VecCount
+	st.ChunkCount += o.ChunkCount
+	st.IndexNodes += o.IndexNodes
+	st.IndexDrift += o.IndexDrift
+	st.VectorsBytes += o.VectorsBytes
+	st.VectorsDiskBytes += o.VectorsDiskBytes
+	st.MetadataBytes += o.MetadataBytes
+	st.MmapCapacity += o.MmapCapacity
+}
+
+type namespaceCounts struct {
+	Documents int `json:"documents"`
+	Chunks    int `json:"chunks"`
+}
+
+type memoryStats struct {
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapInuse  uint64 `json:"heap_inuse_bytes"`
+	Sys        uint64 `json:"sys_bytes"`
+	NumGC      uint32 `json:"num_gc"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// HandleStats serves GET /stats: vector, index and storage figures (summed
+// and, with -isolate_namespaces, per shard), per-namespace document and
+// chunk counts, namespace quotas with their usage and evictions, cache and
+// model statistics, memory usage and uptime. Namespace shards that have not
+// been opened yet are left out rather than opened.
+func (s *Server) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := map[string]any{
+		"vec_count":          s.vectorCount(),
+		"dim":                s.vecs.Dim(),
+		"namespace_isolated": s.shards != nil,
+		"started_at":         s.started.Format(time.RFC3339),
+		"uptime_seconds":     int64(time.Since(s.started).Seconds()),
+		"memory":             readMemoryStats(),
+	}
+	if s.dataDir != "" {
+		if hazard := storage.MmapHazard(s.dataDir); hazard != "" {
+			resp["mmap_warning"] = "memory-mapping the data directory is unsafe: " + hazard
+		}
+	}
+	var (
+		total  storeStats
+		cache  engine.CacheStats
+		counts = map[string]namespaceCounts{}
+		quotas = []engine.QuotaStatus{}
+	)
+	perShard := map[string]storeStats{}
+	for _, sh := range s.openShards() {
+		st := shardStats(sh)
+		total.add(st)
+		perShard[sh.Namespace] = st
+		addNamespaceCounts(counts, sh)
+
+		if qs, err := sh.Engine.Quotas(""); err == nil {
+			quotas = append(quotas, qs...)
+		}
+
+		cs := sh.Engine.CacheStats()
+		cache.Entries += cs.Entries
+		cache.Hits += cs.Hits
+		cache.Misses += cs.Misses
+	}
+	resp["storage"] = total
+	resp["namespace_counts"] = counts
+	resp["retrieve_cache"] = cache
+	resp["quotas"] = quotas
+	if s.shards != nil {
+		vecCounts := map[string]uint64{}
+		for ns, st := range perShard {
+			vecCounts[ns] = st.VecCount
+		}
+		resp["namespaces"] = vecCounts
+		resp["shards"] = perShard
+	}
+	if len(s.models) > 0 {
+		models := map[string]any{}
+		for name, sp := range s.models {
+			var total storeStats
+			for _, sh := range sp.Shards.Open() {
+				total.add(shardStats(sh))
+			}
+			models[name] = map[string]any{"dim": sp.Dim, "vec_count": total.VecCount, "storage": total}
+		}
+		resp["models"] = models
+	}
+	if s.tenants != nil {
+		// Per-tenant figures come from each tenant's own /stats.
+		resp["tenants_open"] = s.tenants.openNames()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// shardStats measures one shard. File sizes are read from disk, so stores
+// without a backing file (test fakes) report 0.
+func shardStats(sh *engine.Shard) storeStats {
+	st := storeStats{VecCount: sh.Vectors.Count(), IndexNodes: sh.Index.Len()}
+	if n, err := sh.Meta.ChunkCount(); err == nil {
+		st.ChunkCount = n
+	}
+	st.IndexDrift = int64(st.ChunkCount) - int64(st.IndexNodes)
+	if v, ok := sh.Vectors.(interface {
+		DiskUsage() (int64, int64, error)
+	}); ok {
+		st.VectorsBytes, st.VectorsDiskBytes, _ = v.DiskUsage()
+	}
+	if c, ok := sh.Vectors.(interface{ Capacity() uint64 }); ok {
+		st.MmapCapacity = c.Capacity()
+	}
+	if m, ok := sh.Meta.(interface{ Path() string }); ok {
+		// SQLite keeps recent writes in a write-ahead log next to the file.
+		st.MetadataBytes = fileSize(m.Path()) + fileSize(m.Path()+"-wal")
+	}
+	return st
+}
+
+// addNamespaceCounts adds the documents and chunks of every namespace in
+// sh's metadata store to counts.
+func addNamespaceCounts(counts map[string]namespaceCounts, sh *engine.Shard) {
+	docs := map[string]int{}
+	err := sh.Meta.ForEachDocument(func(doc types.Document) error {
+		ns, _ := doc.Metadata["namespace"].(string)
+		docs[ns]++
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for ns, n := range docs {
+		c := counts[ns]
+		c.Documents += n
+		if ids, err := sh.Meta.NamespaceChunkIDs(ns); err == nil {
+			c.Chunks += len(ids)
+		}
+		counts[ns] = c
+	}
+}
+
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+func readMemoryStats() memoryStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return memoryStats{
+		HeapAlloc:  m.HeapAlloc,
+		HeapInuse:  m.HeapInuse,
+		Sys:        m.Sys,
+		NumGC:      m.NumGC,
+		Goroutines: runtime.NumGoroutine(),
+	}
+}
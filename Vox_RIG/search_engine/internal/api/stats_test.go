@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/engine"
+)
+
+func TestStats(t *testing.T) {
+	s, h := newTestServer(t)
+	for i, ns := range []string{"a", "a", "b"} {
+		body := fmt.Sprintf(`{"namespace":%q,"conversation_id":"c","message_id":"m%d","role":"user","content":"hi","vector":[1,0]}`, ns, i)
+		if code, out := post(t, h, "/v1/ingest_message", body); code != http.StatusOK {
+			t.Fatalf("Ingest failed: %d %v", code, out)
+		}
+	}
+	s.index.Remove(2) // as if the index had not caught up
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Stats failed: %d %s", w.Code, w.Body)
+	}
+	var out struct {
+		VecCount        uint64                     `json:"vec_count"`
+		Uptime          *int64                     `json:"uptime_seconds"`
+		Storage         storeStats                 `json:"storage"`
+		NamespaceCounts map[string]namespaceCounts `json:"namespace_counts"`
+		Memory          memoryStats                `json:"memory"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	st := out.Storage
+	if out.VecCount != 3 || st.VecCount != 3 || st.ChunkCount != 3 || st.IndexNodes != 2 || st.IndexDrift != 1 {
+		t.Errorf("Expected 3 vectors and chunks with one missing from the index, got %+v", st)
+	}
+	if st.VectorsBytes == 0 || st.MetadataBytes == 0 || st.MmapCapacity < 3 {
+		t.Errorf("Expected storage sizes and mmap capacity, got %+v", st)
+	}
+	if out.NamespaceCounts["a"] != (namespaceCounts{Documents: 2, Chunks: 2}) || out.NamespaceCounts["b"] != (namespaceCounts{Documents: 1, Chunks: 1}) {
+		t.Errorf("Unexpected namespace counts %v", out.NamespaceCounts)
+	}
+	if out.Uptime == nil || out.Memory.HeapAlloc == 0 || out.Memory.Goroutines == 0 {
+		t.Errorf("Expected uptime and memory usage, got %s", w.Body)
+	}
+}
+
+func TestStatsSkipsUnopenedShards(t *testing.T) {
+	s, h := newTestServer(t)
+	m, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	s.EnableNamespaceIsolation(m)
+
+	body := `{"namespace":"warm","conversation_id":"c","message_id":"m","role":"user","content":"hi","vector":[1,0]}`
+	if code, out := post(t, h, "/v1/ingest_message", body); code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+	// A namespace left on disk by an earlier run.
+	if err := os.MkdirAll(filepath.Join(m.Root(), "cold"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/v1/health", "/v1/stats"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s failed: %d %s", path, w.Code, w.Body)
+		}
+		var out struct {
+			VecCount   uint64            `json:"vec_count"`
+			Namespaces map[string]uint64 `json:"namespaces"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.VecCount != 1 {
+			t.Errorf("%s: expected vec_count 1, got %s", path, w.Body)
+		}
+		if _, ok := out.Namespaces["cold"]; ok {
+			t.Errorf("%s: reported the unopened namespace: %s", path, w.Body)
+		}
+	}
+	if open := m.Open(); len(open) != 1 || open[0].Namespace != "warm" {
+		t.Errorf("Expected only warm to be open, got %d shards", len(open))
+	}
+}
+
+func TestVectorStats(t *testing.T) {
+	_, h := newTestServer(t)
+	for i, v := range []string{"[3,4]", "[6,8]"} {
+		body := fmt.Sprintf(`{"namespace":"a","conversation_id":"c","message_id":"m%d","role":"user","content":"hi","vector":%s}`, i, v)
+		if code, out := post(t, h, "/v1/ingest_message", body); code != http.StatusOK {
+			t.Fatalf("Ingest failed: %d %v", code, out)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/stats/vectors?dims=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Vector stats failed: %d %s", w.Code, w.Body)
+	}
+	var out struct {
+		Namespaces []engine.VectorStats `json:"namespaces"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Namespaces) != 1 {
+		t.Fatalf("Expected one namespace, got %s", w.Body)
+	}
+	st := out.Namespaces[0]
+	if st.Namespace != "a" || st.Count != 2 || st.MeanNorm != 7.5 || len(st.Variance) != 2 || st.Variance[0] != 4.5 {
+		t.Errorf("Unexpected vector stats %+v", st)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/stats/vectors?model=nope", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown model, got %d", w.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleTemplates manages the per-namespace templates /context formats
+// with (see commands.SetTemplate):
+//
+//	GET    /templates[?model=<m>]                      list templates
+//	GET    /templates?namespace=<ns>[&model=<m>]       one namespace's template
+//	PUT    /templates {namespace, chunk, chat, separator}  set a template
+//	DELETE /templates {namespace}                      remove a template
+func (s *Server) HandleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		env, err := s.envFor(q.Get("model"))
+		if err != nil {
+			writeCommandError(w, "templates", err)
+			return
+		}
+		if !q.Has("namespace") {
+			templates, err := commands.ListTemplates(env, "")
+			if err != nil {
+				writeCommandError(w, "templates", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"templates": templates})
+			return
+		}
+		t, err := commands.GetTemplate(env, q.Get("namespace"))
+		if err != nil {
+			writeCommandError(w, "templates", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+
+	case http.MethodPut, http.MethodDelete:
+		var req commands.TemplateRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		noteNamespace(r, req.Namespace)
+		env, err := s.envFor(req.Model)
+		if err != nil {
+			writeCommandError(w, "templates", err)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			t, err := commands.SetTemplate(env, req)
+			if err != nil {
+				writeCommandError(w, "templates", err)
+				return
+			}
+			log.Printf("[templates] set namespace=%s chat=%t", req.Namespace, req.Chat != "")
+			writeJSON(w, http.StatusOK, map[string]any{"status": "saved", "template": t})
+			return
+		}
+
+		found, err := commands.DeleteTemplate(env, req.Namespace)
+		if err != nil {
+			writeCommandError(w, "templates", err)
+			return
+		}
+		if !found {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[templates] deleted namespace=%s", req.Namespace)
+		writeJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
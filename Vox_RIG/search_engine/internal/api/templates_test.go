@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContextTemplates(t *testing.T) {
+	_, h := newTestServer(t)
+	do := func(method, path, body string) (int, map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var out map[string]any
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+
+	if code, out := post(t, h, "/v1/ingest", `{"namespace":"a","document":{"id":"f","source":"main.go"},"chunks":[{"doc_id":"f","vector":[1,0],"content":"package main","start_line":1,"end_line":3}]}`); code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+	if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"a","conversation_id":"c","role":"user","content":"hi","vector":[0,1]}`); code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+
+	if code, _ := do(http.MethodPut, "/v1/templates", `{"namespace":"a","chunk":"{{.Nope}}"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a template with an unknown field, got %d", code)
+	}
+	if code, _ := do(http.MethodPut, "/v1/templates", `{"namespace":"a","chunk":"{{.Content"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a template that does not parse, got %d", code)
+	}
+	body := `{"namespace":"a","chunk":"// {{.Source}}:{{.StartLine}}-{{.EndLine}}\n{{.Content}}","chat":"[{{.Role}}] {{.Content}}","separator":"\n---\n"}`
+	if code, out := do(http.MethodPut, "/v1/templates", body); code != http.StatusOK {
+		t.Fatalf("Setting the template failed: %d %v", code, out)
+	}
+	if code, out := do(http.MethodGet, "/v1/templates", ""); code != http.StatusOK || len(out["templates"].([]any)) != 1 {
+		t.Errorf("Expected one template listed, got %d %v", code, out)
+	}
+
+	code, out := post(t, h, "/v1/context", `{"namespace":"a","query":[1,0]}`)
+	if code != http.StatusOK || out["format"] != "template" {
+		t.Fatalf("Expected the namespace template by default, got %d %v", code, out)
+	}
+	if got, want := out["context"], "// main.go:1-3\npackage main\n---\n[user] hi"; got != want {
+		t.Errorf("Expected context %q, got %q", want, got)
+	}
+	if _, out := post(t, h, "/v1/context", `{"namespace":"a","query":[1,0],"format":"markdown"}`); !strings.Contains(out["context"].(string), "### main.go:1-3\n```go") {
+		t.Errorf("Expected an explicit markdown format to win, got %v", out["context"])
+	}
+	if code, _ := post(t, h, "/v1/context", `{"namespace":"b","query":[1,0],"format":"template"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for format=template without a template, got %d", code)
+	}
+
+	if code, _ := do(http.MethodDelete, "/v1/templates", `{"namespace":"a"}`); code != http.StatusOK {
+		t.Fatalf("Deleting the template failed: %d", code)
+	}
+	if _, out := post(t, h, "/v1/context", `{"namespace":"a","query":[1,0]}`); out["format"] != "markdown" {
+		t.Errorf("Expected markdown once the template is gone, got %v", out["format"])
+	}
+	if code, _ := do(http.MethodGet, "/v1/templates?namespace=a", ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted template, got %d", code)
+	}
+}
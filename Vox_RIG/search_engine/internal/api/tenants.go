@@ -0,0 +1,423 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+)
+
+// TenantHeader selects the tenant of a request. The same can be done in the
+// path: /v1/t/<tenant>/retrieve is /v1/retrieve for that tenant.
+const TenantHeader = "X-Vox-Tenant"
+
+const tenantPrefix = "/t/"
+
+// Defaults for zero TenantOptions fields.
+const (
+	DefaultMaxTenants  = 16
+	DefaultTenantIdle  = 10 * time.Minute
+	tenantSweepMinimum = time.Second
+)
+
+// TenantOptions bound the tenants a server keeps open.
+type TenantOptions struct {
+	// MaxOpen is how many tenants may have their stores open at once; the
+	// least recently used idle one is closed to make room.
+	MaxOpen int
+	// Idle closes a tenant after this long without requests (0 = never).
+	Idle time.Duration
+}
+
+// errNoTenant is returned for a tenant that does not exist on a read-only
+// server, which cannot create it.
+var errNoTenant = errors.New("unknown tenant")
+
+// tenantPool opens tenants on first use and closes them when idle or
+// evicted. Every tenant is a Server of its own over <data>/tenants/<name>,
+// so its namespaces, model spaces, snapshots and indexes never mix with
+// another tenant's.
+type tenantPool struct {
+	parent *Server
+	root   string
+	opts   TenantOptions
+
+	mu   sync.Mutex
+	open map[string]*tenant
+	lru  *list.List // of *tenant, most recently used first
+}
+
+type tenant struct {
+	name string
+	// ready is closed once srv (or err) is set; requests that arrive while
+	// the tenant is opening wait on it.
+	ready   chan struct{}
+	srv     *Server
+	handler http.Handler
+	err     error
+
+	// Guarded by tenantPool.mu.
+	loaded   bool
+	inflight int
+	lastUsed time.Time
+	elem     *list.Element
+}
+
+// EnableTenants routes requests that name a tenant (TenantHeader or the
+// /t/<tenant>/ prefix) to stores under <data>/tenants/<tenant>, created on
+// first use with this server's settings. Requests without a tenant keep
+// using the server's own stores. SetDataDir must be called first, and
+// AddModel and EnableNamespaceIsolation before, so tenants inherit them.
+func (s *Server) EnableTenants(opts TenantOptions) {
+	if opts.MaxOpen <= 0 {
+		opts.MaxOpen = DefaultMaxTenants
+	}
+	s.tenants = &tenantPool{
+		parent: s,
+		root:   filepath.Join(s.dataDir, "tenants"),
+		opts:   opts,
+		open:   map[string]*tenant{},
+		lru:    list.New(),
+	}
+	if opts.Idle > 0 {
+		go s.tenants.sweep(max(opts.Idle/2, tenantSweepMinimum))
+	}
+}
+
+// tenantOf returns the tenant a request names and its path without the
+// tenant prefix. ok is false for a request without a tenant.
+func tenantOf(r *http.Request) (name, path string, ok bool, err error) {
+	name, path = r.Header.Get(TenantHeader), r.URL.Path
+	if rest, found := strings.CutPrefix(path, tenantPrefix); found {
+		fromPath, sub, _ := strings.Cut(rest, "/")
+		if fromPath == "" {
+			return "", "", false, errors.New("missing tenant in path")
+		}
+		if name != "" && name != fromPath {
+			return "", "", false, fmt.Errorf("tenant %q in the path does not match %s %q", fromPath, TenantHeader, name)
+		}
+		name, path = fromPath, "/"+sub
+	}
+	if name == "" {
+		return "", path, false, nil
+	}
+	// Tenant names are directory names, under the same rules as model names.
+	if !engine.ValidModelName(name) {
+		return "", "", false, fmt.Errorf("invalid tenant: %q", name)
+	}
+	return name, path, true, nil
+}
+
+// withTenants hands requests that name a tenant to that tenant's handlers.
+// It sits inside the request log, gzip and limits, which apply once per
+// request whichever stores serve it.
+func (s *Server) withTenants(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.tenants == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, path, ok, err := tenantOf(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t, err := s.tenants.acquire(name)
+		if err != nil {
+			log.Printf("[tenant] tenant=%s open failed: %v", name, err)
+			if errors.Is(err, errNoTenant) {
+				http.Error(w, fmt.Sprintf("unknown tenant: %q", name), http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to open tenant", http.StatusInternalServerError)
+			return
+		}
+		defer s.tenants.release(t)
+
+		noteTenant(r, name)
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		t.handler.ServeHTTP(w, r2)
+	})
+}
+
+// acquire returns the open tenant called name, opening it if needed. Every
+// successful acquire must be paired with release.
+func (p *tenantPool) acquire(name string) (*tenant, error) {
+	p.mu.Lock()
+	t, ok := p.open[name]
+	if !ok {
+		t = &tenant{name: name, ready: make(chan struct{})}
+		t.elem = p.lru.PushFront(t)
+		p.open[name] = t
+	}
+	t.inflight++
+	t.lastUsed = time.Now()
+	p.lru.MoveToFront(t.elem)
+	p.mu.Unlock()
+
+	if !ok {
+		// Open outside the pool lock: rebuilding a large tenant's index must
+		// not stall requests to the others.
+		t.srv, t.err = p.parent.openTenant(filepath.Join(p.root, name))
+		if t.err == nil {
+			t.handler = t.srv.routes()
+		}
+		close(t.ready)
+		p.mu.Lock()
+		if t.err == nil {
+			t.loaded = true
+			log.Printf("[tenant] tenant=%s opened (open=%d)", name, len(p.open))
+		} else {
+			p.removeLocked(t)
+		}
+		evicted := p.evictLocked()
+		p.mu.Unlock()
+		closeTenants(evicted, "evicted")
+	}
+
+	<-t.ready
+	if t.err != nil {
+		p.release(t)
+		return nil, t.err
+	}
+	return t, nil
+}
+
+func (p *tenantPool) release(t *tenant) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.inflight--
+	t.lastUsed = time.Now()
+}
+
+func (p *tenantPool) removeLocked(t *tenant) {
+	if p.open[t.name] == t {
+		delete(p.open, t.name)
+		p.lru.Remove(t.elem)
+	}
+}
+
+// evictLocked removes least recently used idle tenants until at most
+// MaxOpen remain and returns them for closing. Busy tenants are skipped, so
+// the pool can exceed MaxOpen while all of them are serving requests.
+func (p *tenantPool) evictLocked() []*tenant {
+	var out []*tenant
+	for e := p.lru.Back(); e != nil && len(p.open) > p.opts.MaxOpen; {
+		t := e.Value.(*tenant)
+		e = e.Prev()
+		if t.loaded && t.inflight == 0 {
+			p.removeLocked(t)
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// sweep closes tenants that have been idle for longer than opts.Idle.
+func (p *tenantPool) sweep(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for range tick.C {
+		cutoff := time.Now().Add(-p.opts.Idle)
+		var idle []*tenant
+		p.mu.Lock()
+		for e := p.lru.Back(); e != nil; {
+			t := e.Value.(*tenant)
+			e = e.Prev()
+			if t.loaded && t.inflight == 0 && t.lastUsed.Before(cutoff) {
+				p.removeLocked(t)
+				idle = append(idle, t)
+			}
+		}
+		p.mu.Unlock()
+		closeTenants(idle, "idle")
+	}
+}
+
+// closeAll closes every open tenant; used when the server shuts down.
+func (p *tenantPool) closeAll() {
+	p.mu.Lock()
+	var all []*tenant
+	for _, t := range p.open {
+		if t.loaded {
+			p.removeLocked(t)
+			all = append(all, t)
+		}
+	}
+	p.mu.Unlock()
+	closeTenants(all, "shutdown")
+}
+
+// each calls fn with the server of every open tenant, which stays open
+// meanwhile. It does not count as use: idle tenants still expire.
+func (p *tenantPool) each(fn func(*Server)) {
+	p.mu.Lock()
+	var ts []*tenant
+	for _, t := range p.open {
+		if t.loaded {
+			t.inflight++
+			ts = append(ts, t)
+		}
+	}
+	p.mu.Unlock()
+	for _, t := range ts {
+		fn(t.srv)
+	}
+	p.mu.Lock()
+	for _, t := range ts {
+		t.inflight--
+	}
+	p.mu.Unlock()
+}
+
+// openNames lists the tenants whose stores are open.
+func (p *tenantPool) openNames() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []string
+	for e := p.lru.Front(); e != nil; e = e.Next() {
+		if t := e.Value.(*tenant); t.loaded {
+			out = append(out, t.name)
+		}
+	}
+	return out
+}
+
+func closeTenants(ts []*tenant, why string) {
+	for _, t := range ts {
+		if err := t.srv.closeTenant(); err != nil {
+			log.Printf("[tenant] tenant=%s close failed: %v", t.name, err)
+			continue
+		}
+		log.Printf("[tenant] tenant=%s closed (%s)", t.name, why)
+	}
+}
+
+// openTenant opens (or, unless read-only, creates) a server over dir with
+// the stores and settings of s: metadata backend, vector file layout, flush
+// and growth policies, namespace isolation, model spaces, embedder, token
+// counter, scrubber and search timeout. Its index is rebuilt before it returns, so the first
+// request sees every vector.
+func (s *Server) openTenant(dir string) (*Server, error) {
+	if s.readOnly {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, errNoTenant
+		}
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var (
+		policy storage.FlushPolicy
+		growth storage.GrowthPolicy
+	)
+	var segmentVectors uint64
+	if vecs, ok := s.vecs.(storage.FileVectorStore); ok {
+		policy, growth = vecs.FlushPolicy(), vecs.GrowthPolicy()
+	}
+	if vecs, ok := s.vecs.(*storage.SegmentedVectorStore); ok {
+		segmentVectors = vecs.SegmentVectors()
+	}
+	metaPath := filepath.Join(dir, "metadata.db")
+	var meta storage.MetadataStore
+	vecs, err := storage.OpenVectorFiles(dir, s.dim, segmentVectors, growth, s.readOnly)
+	if err != nil {
+		return nil, fmt.Errorf("open vector store: %w", err)
+	}
+	vecs.SetFlushPolicy(policy)
+	if s.readOnly {
+		meta, err = s.metaBackend.OpenReadOnly(metaPath)
+	} else {
+		meta, err = s.metaBackend.Open(metaPath)
+	}
+	if err != nil {
+		_ = vecs.Close()
+		return nil, fmt.Errorf("open metadata store: %w", err)
+	}
+
+	idx, err := index.New(s.indexConfig, vecs)
+	if err != nil {
+		_ = meta.Close()
+		_ = vecs.Close()
+		return nil, err
+	}
+	t := NewServer(engine.NewEngine(idx, vecs, meta), idx, meta, vecs)
+	t.SetDataDir(dir, s.dim)
+	t.metaBackend = s.metaBackend
+	t.indexConfig = s.indexConfig
+	t.SetReadOnly(s.readOnly)
+	t.embedder = s.embedder
+	t.tokens = s.tokens
+	t.scrubber = s.scrubber
+	t.normalize = s.normalize
+	t.warnModelMismatch = s.warnModelMismatch
+	t.shortTerm = s.shortTerm
+	t.limits.SearchTimeout = s.limits.SearchTimeout
+	t.trashRetention = s.trashRetention
+	t.keepVersions = s.keepVersions
+	if s.roller != nil {
+		t.roller = s.roller.With(t.shardFor, &t.mu)
+	}
+	// The parent logs and rate-limits tenant requests.
+	t.requestLog = nil
+
+	if s.shards != nil {
+		shards, err := engine.NewShardManager(filepath.Join(dir, "namespaces"), s.dim)
+		if err != nil {
+			_ = t.Close()
+			return nil, err
+		}
+		shards.SetFlushPolicy(policy)
+		shards.SetGrowthPolicy(growth)
+		shards.SetReadOnly(s.readOnly)
+		shards.SetMetadataBackend(s.metaBackend)
+		shards.SetIndexConfig(s.indexConfig)
+		t.EnableNamespaceIsolation(shards)
+	}
+	for name, sp := range s.models {
+		if err := t.AddModel(name, sp.Dim); err != nil {
+			if s.readOnly {
+				// A tenant that never used this model has no space for it.
+				continue
+			}
+			_ = t.closeTenant()
+			return nil, err
+		}
+	}
+	if err := t.warmIndexes(context.Background()); err != nil {
+		_ = t.closeTenant()
+		return nil, err
+	}
+	t.warm.mu.Lock()
+	t.warm.started, t.warm.finished = true, true
+	t.warm.mu.Unlock()
+	return t, nil
+}
+
+// closeTenant closes a tenant server's stores, including its namespace shards.
+func (s *Server) closeTenant() error {
+	err := s.Close()
+	if s.shards != nil {
+		if serr := s.shards.Close(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTenantsAreIsolated(t *testing.T) {
+	s, h := newTestServer(t)
+	s.SetDataDir(t.TempDir(), 2)
+	s.EnableTenants(TenantOptions{MaxOpen: 1})
+	t.Cleanup(s.tenants.closeAll)
+
+	send := func(tenant, path, body string) (int, map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if tenant != "" {
+			r.Header.Set(TenantHeader, tenant)
+		}
+		h.ServeHTTP(w, r)
+		var out map[string]any
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+	ingest := `{"namespace":"n","conversation_id":"c","role":"user","content":"hi","vector":[1,0]}`
+	if code, out := send("a", "/v1/ingest_message", ingest); code != http.StatusOK {
+		t.Fatalf("Ingest via header failed: %d %v", code, out)
+	}
+	if code, out := send("", "/v1/t/b/ingest_message", ingest); code != http.StatusOK {
+		t.Fatalf("Ingest via path failed: %d %v", code, out)
+	}
+	if open := s.tenants.openNames(); len(open) != 1 || open[0] != "b" {
+		t.Errorf("Expected only tenant b open with MaxOpen 1, got %v", open)
+	}
+
+	chunks := func(tenant, path string) int {
+		t.Helper()
+		code, out := send(tenant, path, `{"namespace":"n","query":[1,0]}`)
+		if code != http.StatusOK {
+			t.Fatalf("Retrieve %s (tenant %q) failed: %d %v", path, tenant, code, out)
+		}
+		list, _ := out["chunks"].([]any)
+		return len(list)
+	}
+	// Tenant a was evicted above; reopening it must find its data again.
+	if n := chunks("a", "/v1/retrieve"); n != 1 {
+		t.Errorf("Expected tenant a to see its own chunk, got %d", n)
+	}
+	if n := chunks("", "/v1/t/b/retrieve"); n != 1 {
+		t.Errorf("Expected tenant b to see its own chunk, got %d", n)
+	}
+	if n := chunks("", "/v1/retrieve"); n != 0 {
+		t.Errorf("Expected the default stores to see no tenant data, got %d chunks", n)
+	}
+
+	if code, _ := send("a", "/v1/t/b/retrieve", `{}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when header and path name different tenants, got %d", code)
+	}
+	if code, _ := send("../x", "/v1/retrieve", `{}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid tenant name, got %d", code)
+	}
+}
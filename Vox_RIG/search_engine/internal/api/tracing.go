@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vox-vector-engine/internal/tracing"
+)
+
+// withTracing starts the server span of every request, continuing the
+// caller's trace when it sends a traceparent header. Handlers pass
+// r.Context() down so engine, index and store spans nest under it.
+func (s *Server) withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := spanRoute(r.URL.Path)
+		ctx, span := tracing.StartServer(r.Context(), r.Header, r.Method+" "+route,
+			tracing.String("http.method", r.Method),
+			tracing.String("http.route", route),
+			tracing.String("request_id", RequestID(r.Context())))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(tracing.Int("http.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.RecordError(&httpStatusError{rec.status})
+		}
+	})
+}
+
+// spanRoute names a request path by its route, so span names stay few:
+// the API version and tenant prefixes are dropped and path IDs replaced.
+func spanRoute(path string) string {
+	path = strings.TrimPrefix(path, APIVersion)
+	if rest, ok := strings.CutPrefix(path, tenantPrefix); ok {
+		_, sub, _ := strings.Cut(rest, "/")
+		path = "/" + sub
+	}
+	switch {
+	case strings.HasPrefix(path, "/documents/"):
+		if strings.HasSuffix(path, "/tags") {
+			return "/documents/{id}/tags"
+		}
+		return "/documents/{id}"
+	case strings.HasPrefix(path, "/namespaces/"):
+		return "/namespaces/{ns}"
+	case path == "":
+		return "/"
+	}
+	return path
+}
+
+type httpStatusError struct{ status int }
+
+func (e *httpStatusError) Error() string {
+	return "HTTP " + strconv.Itoa(e.status) + " " + http.StatusText(e.status)
+}
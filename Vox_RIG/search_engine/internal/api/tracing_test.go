@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"vox-vector-engine/internal/tracing"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name, parent string
+	attrs        map[string]any
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...tracing.Attr) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *recordedSpan) RecordError(err error) { s.attrs["error"] = err.Error() }
+func (s *recordedSpan) End()                  {}
+
+// recorder is a tracing.Tracer that keeps every span with its parent's name.
+type recorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *recorder) Start(ctx context.Context, name string, attrs ...tracing.Attr) (context.Context, tracing.Span) {
+	s := &recordedSpan{name: name, attrs: map[string]any{}}
+	if p, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = p.name
+	}
+	s.SetAttributes(attrs...)
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (r *recorder) StartServer(ctx context.Context, h http.Header, name string, attrs ...tracing.Attr) (context.Context, tracing.Span) {
+	return r.Start(ctx, name, append(attrs, tracing.String("traceparent", h.Get("traceparent")))...)
+}
+
+func (r *recorder) find(name string) *recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestRetrieveSpans(t *testing.T) {
+	_, h := newTestServer(t)
+	if code, out := post(t, h, "/v1/ingest_message", `{"namespace":"a","conversation_id":"c","role":"user","content":"hi","vector":[1,0]}`); code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+
+	rec := &recorder{}
+	prev := tracing.SetTracer(rec)
+	defer tracing.SetTracer(prev)
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	r := httptest.NewRequest(http.MethodPost, "/v1/retrieve", strings.NewReader(`{"namespace":"a","query":[1,0]}`))
+	r.Header.Set("traceparent", parent)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Retrieve failed: %d %s", w.Code, w.Body)
+	}
+
+	server := rec.find("POST /retrieve")
+	if server == nil {
+		t.Fatalf("Expected a server span named by route, got %d spans", len(rec.spans))
+	}
+	if server.attrs["traceparent"] != parent || server.attrs["http.status_code"] != http.StatusOK {
+		t.Errorf("Unexpected server span attributes: %v", server.attrs)
+	}
+	for name, wantParent := range map[string]string{
+		"json.decode":         "POST /retrieve",
+		"engine.retrieve":     "POST /retrieve",
+		"index.search":        "engine.retrieve",
+		"metadata.get_chunks": "engine.retrieve",
+		"engine.score":        "engine.retrieve",
+		"json.encode":         "POST /retrieve",
+	} {
+		s := rec.find(name)
+		if s == nil {
+			t.Errorf("Missing span %s", name)
+			continue
+		}
+		if s.parent != wantParent {
+			t.Errorf("Span %s has parent %q, want %q", name, s.parent, wantParent)
+		}
+	}
+	if got := rec.find("index.search").attrs["results"]; got != 1 {
+		t.Errorf("Expected index.search to record 1 result, got %v", got)
+	}
+}
+
+func TestSpanRoute(t *testing.T) {
+	for path, want := range map[string]string{
+		"/v1/retrieve":             "/retrieve",
+		"/retrieve":                "/retrieve",
+		"/v1/documents/doc%201":    "/documents/{id}",
+		"/v1/documents/d/tags":     "/documents/{id}/tags",
+		"/v1/t/acme/namespaces/ns": "/namespaces/{ns}",
+		"/v1":                      "/",
+	} {
+		if got := spanRoute(path); got != want {
+			t.Errorf("spanRoute(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
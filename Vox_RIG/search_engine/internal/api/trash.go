@@ -0,0 +1,129 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// DefaultTrashRetention is how long soft-deleted documents stay restorable.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// trashJanitorInterval is how often the janitor looks for expired trash.
+const trashJanitorInterval = time.Hour
+
+// deleteDocument serves DELETE /documents/{id}[?soft=true&namespace=&model=].
+func (s *Server) deleteDocument(w http.ResponseWriter, r *http.Request, id string) {
+	q := r.URL.Query()
+	req := commands.DeleteDocumentRequest{DocID: id, Namespace: q.Get("namespace"), Model: q.Get("model")}
+	if v := q.Get("soft"); v != "" {
+		soft, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "soft must be a boolean", http.StatusBadRequest)
+			return
+		}
+		req.Soft = soft
+	}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	res, err := commands.DeleteDocument(env, req)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	log.Printf("[documents] %s doc_id=%s namespace=%s chunks=%d", res.Status, id, req.Namespace, res.Chunks)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// restoreDocument serves POST /documents/{id}/restore[?namespace=&model=].
+func (s *Server) restoreDocument(w http.ResponseWriter, r *http.Request, id string) {
+	q := r.URL.Query()
+	req := commands.RestoreDocumentRequest{DocID: id, Namespace: q.Get("namespace"), Model: q.Get("model")}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	res, err := commands.RestoreDocument(env, req)
+	if err != nil {
+		writeCommandError(w, "documents", err)
+		return
+	}
+	log.Printf("[documents] restored doc_id=%s namespace=%s chunks=%d", id, req.Namespace, res.Chunks)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleTrash serves GET /trash?namespace=<ns>[&model=<m>]: the soft-deleted
+// documents of a namespace, oldest first, with when the janitor purges them.
+func (s *Server) HandleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	env, err := s.envFor(q.Get("model"))
+	if err != nil {
+		writeCommandError(w, "trash", err)
+		return
+	}
+	trash, err := commands.ListTrash(env, q.Get("namespace"), s.trashRetention)
+	if err != nil {
+		writeCommandError(w, "trash", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"namespace": q.Get("namespace"), "trash": trash})
+}
+
+// StartTrashJanitor purges soft-deleted documents once they have been in the
+// trash for longer than retention, checking every hour. Open tenants are
+// swept too.
+func (s *Server) StartTrashJanitor(retention time.Duration) {
+	s.trashRetention = retention
+	go func() {
+		t := time.NewTicker(trashJanitorInterval)
+		defer t.Stop()
+		for range t.C {
+			s.purgeTrash(time.Now().Add(-retention))
+			if s.tenants != nil {
+				s.tenants.each(func(ts *Server) { ts.purgeTrash(time.Now().Add(-retention)) })
+			}
+		}
+	}()
+}
+
+// purgeTrash drops the documents trashed before the given time from every
+// shard and model space.
+func (s *Server) purgeTrash(before time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shards, err := s.namespaceShards()
+	if err != nil {
+		log.Printf("[trash] failed to open shards: %v", err)
+		return
+	}
+	more, err := s.modelShards()
+	if err != nil {
+		log.Printf("[trash] failed to open model spaces: %v", err)
+	}
+	for _, sh := range append(shards, more...) {
+		ids, err := sh.Meta.PurgeTrash(before)
+		if err != nil {
+			log.Printf("[trash] namespace=%s purge failed: %v", sh.Namespace, err)
+			continue
+		}
+		if len(ids) > 0 {
+			log.Printf("[trash] namespace=%s purged %d documents", sh.Namespace, len(ids))
+		}
+	}
+}
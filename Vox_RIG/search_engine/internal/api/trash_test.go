@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	s, h := newTestServer(t)
+	code, out := post(t, h, "/v1/ingest_message", `{"namespace":"a","conversation_id":"c","role":"user","content":"hi","vector":[1,0]}`)
+	if code != http.StatusOK {
+		t.Fatalf("Ingest failed: %d %v", code, out)
+	}
+	id := url.PathEscape(out["doc_id"].(string))
+	do := func(method, path string) (int, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code, w.Body.String()
+	}
+	retrieved := func() int {
+		t.Helper()
+		_, out := post(t, h, "/v1/retrieve", `{"namespace":"a","query":[1,0]}`)
+		return len(out["chunks"].([]any))
+	}
+
+	if code, body := do(http.MethodDelete, "/v1/documents/"+id+"?soft=true&namespace=a"); code != http.StatusOK {
+		t.Fatalf("Soft delete failed: %d %s", code, body)
+	}
+	if n := retrieved(); n != 0 {
+		t.Errorf("Expected a trashed document not to be retrieved, got %d chunks", n)
+	}
+	s.trashRetention = DefaultTrashRetention
+	if code, body := do(http.MethodGet, "/v1/trash?namespace=a"); code != http.StatusOK || !strings.Contains(body, `"chunks":1`) || !strings.Contains(body, `"purge_at"`) {
+		t.Errorf("Expected the document in the trash, got %d %s", code, body)
+	}
+
+	if code, body := do(http.MethodPost, "/v1/documents/"+id+"/restore?namespace=a"); code != http.StatusOK {
+		t.Fatalf("Restore failed: %d %s", code, body)
+	}
+	if n := retrieved(); n != 1 {
+		t.Errorf("Expected the restored document to be retrieved, got %d chunks", n)
+	}
+	if code, _ := do(http.MethodPost, "/v1/documents/"+id+"/restore?namespace=a"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 restoring a document that is not in the trash, got %d", code)
+	}
+
+	if code, body := do(http.MethodDelete, "/v1/documents/"+id+"?namespace=a"); code != http.StatusOK {
+		t.Fatalf("Delete failed: %d %s", code, body)
+	}
+	if code, _ := do(http.MethodDelete, "/v1/documents/"+id+"?namespace=a"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting a missing document, got %d", code)
+	}
+	if trash, _ := s.meta.ListTrash("a"); len(trash) != 0 {
+		t.Errorf("Expected an empty trash after a hard delete, got %+v", trash)
+	}
+}
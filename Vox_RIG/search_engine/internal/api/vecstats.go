@@ -0,0 +1,68 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"vox-vector-engine/internal/engine"
+)
+
+// HandleVectorStats serves GET /stats/vectors[?namespace=&model=&dims=true]:
+// the running statistics of the vectors ingested into each namespace since
+// the server started (mean norm, per-dimension variance) and the batches
+// that drifted from them, in every model space unless model names one
+// ("default" is the default space). dims=true lists every dimension's
+// variance.
+func (s *Server) HandleVectorStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	ns, model, dims := q.Get("namespace"), q.Get("model"), q.Get("dims") == "true"
+	noteNamespace(r, ns)
+	if model != "" && model != "default" {
+		if _, ok := s.models[model]; !ok {
+			http.Error(w, "unknown model: "+model, http.StatusBadRequest)
+			return
+		}
+	}
+
+	out := []engine.VectorStats{}
+	if model == "" || model == "default" {
+		shards, err := s.namespaceShards()
+		if err != nil {
+			log.Printf("[stats] vectors: %v", err)
+			http.Error(w, "Failed to open namespace shards", http.StatusInternalServerError)
+			return
+		}
+		for _, sh := range shards {
+			out = append(out, sh.Engine.VectorStats(ns, dims)...)
+		}
+	}
+	for name, sp := range s.models {
+		if model != "" && model != name {
+			continue
+		}
+		shards, err := sp.Shards.All()
+		if err != nil {
+			log.Printf("[stats] vectors model=%s: %v", name, err)
+			http.Error(w, "Failed to open namespace shards", http.StatusInternalServerError)
+			return
+		}
+		for _, sh := range shards {
+			for _, vs := range sh.Engine.VectorStats(ns, dims) {
+				vs.Model = name
+				out = append(out, vs)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		return out[i].Namespace < out[j].Namespace
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"namespaces": out})
+}
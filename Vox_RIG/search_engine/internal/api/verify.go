@@ -0,0 +1,38 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleIndexVerify checks the HNSW graph of a namespace for broken links,
+// level errors and vectors it lost track of, and repairs them when asked.
+// Only the in-memory graph changes, so read-only servers allow it too.
+func (s *Server) HandleIndexVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req commands.VerifyIndexRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	noteNamespace(r, req.Namespace)
+
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "index_verify", err)
+		return
+	}
+	rep, err := commands.VerifyIndex(r.Context(), env, req)
+	if err != nil {
+		writeCommandError(w, "index_verify", err)
+		return
+	}
+	log.Printf("[index_verify] namespace=%s repair=%v ok=%v nodes=%d vectors=%d dangling=%d asymmetric=%d duplicate=%d levels=%d no_vector=%d no_node=%d bad_entry=%v",
+		req.Namespace, req.Repair, rep.OK, rep.Nodes, rep.Vectors, rep.DanglingLinks, rep.AsymmetricLinks, rep.DuplicateLinks,
+		rep.LevelMismatches, rep.NodesWithoutVectors, rep.VectorsWithoutNodes, rep.BadEntryPoint)
+	writeJSON(w, http.StatusOK, rep)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"vox-vector-engine/internal/commands"
+)
+
+// HandleWarm serves POST /warm {namespace, queries | query_texts, ef}: it
+// walks the index toward representative queries (e.g. the open file's
+// embedding) and prefetches the vectors they reach, so the first real query
+// after startup does not pay for cold pages.
+func (s *Server) HandleWarm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req commands.WarmRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	noteNamespace(r, req.Namespace)
+	env, err := s.envFor(req.Model)
+	if err != nil {
+		writeCommandError(w, "warm", err)
+		return
+	}
+	res, err := commands.Warm(r.Context(), env, req)
+	if err != nil {
+		writeCommandError(w, "warm", err)
+		return
+	}
+	log.Printf("[warm] namespace=%s queries=%d nodes=%d prefetched_bytes=%d elapsed_ms=%.1f",
+		req.Namespace, res.Queries, res.Nodes, res.PrefetchedBytes, res.ElapsedMS)
+	writeJSON(w, http.StatusOK, res)
+}
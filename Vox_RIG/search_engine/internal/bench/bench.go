@@ -0,0 +1,282 @@
+// Package bench measures HNSW recall and query latency against exact
+// brute-force search, so the index parameters can be tuned for a corpus.
+// Queries are held out of the corpus; their exact nearest neighbours are the
+// labels the index is scored against.
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// Defaults for zero Options fields.
+const (
+	DefaultVectors  = 10000
+	DefaultQueries  = 100
+	DefaultK        = 10
+	DefaultClusters = 32
+)
+
+// DefaultEfs are the search beam widths tried when Options.Efs is empty.
+var DefaultEfs = []int{10, 20, 50, 100, 200}
+
+// Options describes one benchmark. Without Vectors a clustered synthetic
+// corpus of N vectors of Dim dimensions is generated from Seed. Seed also
+// picks the queries and the levels of the graph, so two runs with the same
+// options build the same index and report the same recall.
+type Options struct {
+	Vectors  []types.Vector
+	N        int
+	Dim      int
+	Clusters int
+	Queries  int
+	K        int
+	Efs      []int
+	Seed     int64
+	// Progress, if set, is called while the index is built.
+	Progress func(done, total int)
+}
+
+// Params are the compiled-in HNSW construction parameters.
+type Params struct {
+	M              int `json:"m"`
+	M0             int `json:"m0"`
+	EfConstruction int `json:"ef_construction"`
+	EfSearch       int `json:"ef_search"`
+}
+
+// Latency summarises per-query search times.
+type Latency struct {
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	QPS   float64 `json:"qps"`
+}
+
+// Run is the outcome of searching every query with one ef.
+type Run struct {
+	Ef     int     `json:"ef"`
+	Recall float64 `json:"recall"`
+	Latency
+}
+
+type Result struct {
+	Dataset string  `json:"dataset"`
+	Vectors int     `json:"vectors"`
+	Queries int     `json:"queries"`
+	Dim     int     `json:"dim"`
+	K       int     `json:"k"`
+	Params  Params  `json:"params"`
+	BuildMs float64 `json:"build_ms"`
+	// Exact is the brute-force baseline the runs are compared with.
+	Exact Latency `json:"exact"`
+	Runs  []Run   `json:"runs"`
+}
+
+// Bench builds an index over the corpus and reports recall@K and latency
+// for every ef in opts.Efs.
+func Bench(opts Options) (*Result, error) {
+	if opts.Queries <= 0 {
+		opts.Queries = DefaultQueries
+	}
+	if opts.K <= 0 {
+		opts.K = DefaultK
+	}
+	if len(opts.Efs) == 0 {
+		opts.Efs = DefaultEfs
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	res := &Result{Dataset: "loaded", K: opts.K, Params: Params{index.M, index.M0, index.EfConstruction, index.EfSearch}}
+	all := opts.Vectors
+	if all == nil {
+		if opts.N <= 0 {
+			opts.N = DefaultVectors
+		}
+		if opts.Dim <= 0 {
+			return nil, errors.New("dim is required for a synthetic dataset")
+		}
+		if opts.Clusters <= 0 {
+			opts.Clusters = DefaultClusters
+		}
+		res.Dataset = "synthetic"
+		all = Synthetic(rng, opts.N+opts.Queries, opts.Dim, opts.Clusters)
+	}
+	if len(all) < opts.Queries+opts.K {
+		return nil, fmt.Errorf("dataset has %d vectors; need at least queries+k=%d", len(all), opts.Queries+opts.K)
+	}
+
+	// Hold the queries out of the corpus so they are not their own neighbours.
+	perm := rng.Perm(len(all))
+	queries := make([]types.Vector, opts.Queries)
+	for i := range queries {
+		queries[i] = all[perm[i]]
+	}
+	corpus := make(memVectors, 0, len(all)-opts.Queries)
+	for _, p := range perm[opts.Queries:] {
+		corpus = append(corpus, all[p])
+	}
+	res.Vectors, res.Queries, res.Dim = len(corpus), len(queries), len(corpus[0])
+
+	idx := index.NewHnswIndex(corpus)
+	idx.SetSeed(rng.Int63())
+	start := time.Now()
+	for i, v := range corpus {
+		idx.Add(uint64(i), v)
+		if opts.Progress != nil && ((i+1)%1000 == 0 || i+1 == len(corpus)) {
+			opts.Progress(i+1, len(corpus))
+		}
+	}
+	res.BuildMs = ms(time.Since(start))
+
+	truth := make([]map[uint64]bool, len(queries))
+	times := make([]time.Duration, len(queries))
+	for i, q := range queries {
+		start := time.Now()
+		truth[i] = exact(corpus, q, opts.K)
+		times[i] = time.Since(start)
+	}
+	res.Exact = latency(times)
+
+	for _, ef := range opts.Efs {
+		var recall float64
+		for i, q := range queries {
+			start := time.Now()
+			ids, _ := idx.SearchEf(q, opts.K, ef)
+			times[i] = time.Since(start)
+			hits := 0
+			for _, id := range ids {
+				if truth[i][id] {
+					hits++
+				}
+			}
+			recall += float64(hits) / float64(len(truth[i]))
+		}
+		res.Runs = append(res.Runs, Run{Ef: ef, Recall: recall / float64(len(queries)), Latency: latency(times)})
+	}
+	return res, nil
+}
+
+// Synthetic returns n vectors scattered around clusters random centres,
+// which resembles embedding corpora better than uniform noise.
+func Synthetic(rng *rand.Rand, n, dim, clusters int) []types.Vector {
+	centres := make([]types.Vector, clusters)
+	for i := range centres {
+		centres[i] = make(types.Vector, dim)
+		for j := range centres[i] {
+			centres[i][j] = float32(rng.Float64()*2 - 1)
+		}
+	}
+	out := make([]types.Vector, n)
+	for i := range out {
+		c := centres[rng.Intn(clusters)]
+		v := make(types.Vector, dim)
+		for j := range v {
+			v[j] = c[j] + float32(rng.NormFloat64()*0.1)
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// LoadVectors reads every vector of a vectors.bin file, or of the
+// vectors.bin in a data directory.
+func LoadVectors(path string, dim int) ([]types.Vector, error) {
+	if fi, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		path = filepath.Join(path, "vectors.bin")
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+	vecs, err := storage.NewMmapVectorStore(path, dim)
+	if err != nil {
+		return nil, err
+	}
+	defer vecs.Close()
+	out := make([]types.Vector, vecs.Count())
+	for i := range out {
+		if out[i], err = vecs.Get(uint64(i)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// exact returns the IDs of the k vectors nearest to q by brute force.
+func exact(corpus memVectors, q types.Vector, k int) map[uint64]bool {
+	type scored struct {
+		id   uint64
+		dist float32
+	}
+	all := make([]scored, len(corpus))
+	for i, v := range corpus {
+		var sum float32
+		for j := range v {
+			d := v[j] - q[j]
+			sum += d * d
+		}
+		all[i] = scored{uint64(i), sum}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].dist < all[j].dist })
+	out := make(map[uint64]bool, k)
+	for _, s := range all[:k] {
+		out[s.id] = true
+	}
+	return out
+}
+
+func latency(times []time.Duration) Latency {
+	sorted := append([]time.Duration(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, t := range sorted {
+		total += t
+	}
+	l := Latency{
+		P50Ms: ms(sorted[len(sorted)*50/100]),
+		P95Ms: ms(sorted[min(len(sorted)-1, len(sorted)*95/100)]),
+	}
+	if total > 0 {
+		l.QPS = float64(len(sorted)) / total.Seconds()
+	}
+	return l
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// memVectors is an in-memory storage.VectorStore for the benchmark corpus.
+type memVectors []types.Vector
+
+func (m memVectors) Append(types.Vector) (uint64, error) {
+	return 0, errors.New("bench corpus is read-only")
+}
+
+func (m memVectors) Get(id uint64) (types.Vector, error) {
+	if id >= uint64(len(m)) {
+		return nil, fmt.Errorf("vector %d out of range", id)
+	}
+	return m[id], nil
+}
+
+func (m memVectors) Dim() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return len(m[0])
+}
+
+func (m memVectors) Count() uint64 { return uint64(len(m)) }
+func (m memVectors) Sync() error   { return nil }
+func (m memVectors) Close() error  { return nil }
@@ -0,0 +1,52 @@
+package bench
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/storage"
+)
+
+func TestBenchSynthetic(t *testing.T) {
+	res, err := Bench(Options{N: 1000, Dim: 8, Queries: 20, K: 5, Efs: []int{5, 100}, Seed: 1})
+	if err != nil {
+		t.Fatalf("Bench failed: %v", err)
+	}
+	if res.Dataset != "synthetic" || res.Vectors != 1000 || res.Queries != 20 || len(res.Runs) != 2 {
+		t.Fatalf("Unexpected result %+v", res)
+	}
+	low, high := res.Runs[0], res.Runs[1]
+	if high.Recall < 0.9 || high.Recall < low.Recall {
+		t.Errorf("Expected recall to rise with ef and reach 0.9, got ef=5 %.2f ef=100 %.2f", low.Recall, high.Recall)
+	}
+	if high.P95Ms < high.P50Ms || high.QPS <= 0 {
+		t.Errorf("Unexpected latency %+v", high.Latency)
+	}
+}
+
+func TestBenchLoaded(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range Synthetic(rand.New(rand.NewSource(2)), 200, 4, 4) {
+		if _, err := vecs.Append(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vecs.Close()
+
+	loaded, err := LoadVectors(dir, 4)
+	if err != nil || len(loaded) != 200 {
+		t.Fatalf("Expected 200 vectors, got %d, %v", len(loaded), err)
+	}
+	res, err := Bench(Options{Vectors: loaded, Queries: 10, K: 3, Efs: []int{50}})
+	if err != nil || res.Dataset != "loaded" || res.Vectors != 190 || res.Runs[0].Recall < 0.9 {
+		t.Errorf("Unexpected result %+v, %v", res, err)
+	}
+	if _, err := Bench(Options{Vectors: loaded[:5], Queries: 10}); err == nil {
+		t.Errorf("Expected an error for a dataset smaller than queries+k")
+	}
+}
@@ -0,0 +1,136 @@
+// Package chunker splits file content into line-addressed chunks ready for
+// embedding. Line numbers are 1-based and inclusive, matching Chunk.StartLine
+// and Chunk.EndLine in the metadata store.
+package chunker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultMaxLines = 40
+	DefaultOverlap  = 5
+)
+
+// Chunk is one piece of a file produced by a Strategy.
+type Chunk struct {
+	Content   string `json:"content"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	// Symbol and Kind are filled by syntax-aware strategies (e.g. "Retrieve", "func").
+	Symbol string `json:"symbol,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+}
+
+// Options tunes the built-in strategies. Zero values select the defaults.
+type Options struct {
+	// MaxLines caps the size of a chunk; larger blocks are windowed.
+	MaxLines int
+	// Overlap is how many lines consecutive windows share.
+	Overlap int
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxLines <= 0 {
+		o.MaxLines = DefaultMaxLines
+	}
+	if o.Overlap < 0 || o.Overlap >= o.MaxLines {
+		o.Overlap = 0
+	} else if o.Overlap == 0 {
+		o.Overlap = min(DefaultOverlap, o.MaxLines/4)
+	}
+	return o
+}
+
+// Strategy turns a whole file into chunks.
+type Strategy interface {
+	Name() string
+	Chunk(content string) []Chunk
+}
+
+// ForName returns the strategy called name ("line", "paragraph", "code" or "go").
+func ForName(name string, opts Options) (Strategy, error) {
+	switch name {
+	case "line":
+		return LineWindow(opts), nil
+	case "paragraph", "markdown":
+		return Paragraph(opts), nil
+	case "code":
+		return Code(opts), nil
+	case "go":
+		return GoAST(opts), nil
+	default:
+		return nil, fmt.Errorf("unknown chunking strategy: %q", name)
+	}
+}
+
+// ForPath picks a strategy from the file extension of path.
+func ForPath(path string, opts Options) Strategy {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".txt", ".rst":
+		return Paragraph(opts)
+	case ".go":
+		return GoAST(opts)
+	case ".py", ".js", ".ts", ".tsx", ".jsx", ".java", ".kt", ".c", ".h", ".cc", ".cpp", ".hpp",
+		".cs", ".rs", ".rb", ".php", ".swift", ".scala", ".lua", ".sh", ".ps1":
+		return Code(opts)
+	default:
+		return LineWindow(opts)
+	}
+}
+
+// splitLines splits content into lines without their terminators. A trailing
+// newline does not produce an extra empty line.
+func splitLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// window cuts lines[from:to] (0-based, exclusive end) into chunks of at most
+// opts.MaxLines lines with opts.Overlap lines shared between neighbours.
+func window(lines []string, from, to int, opts Options) []Chunk {
+	var out []Chunk
+	step := opts.MaxLines - opts.Overlap
+	for start := from; start < to; start += step {
+		end := min(start+opts.MaxLines, to)
+		if c, ok := makeChunk(lines, start, end); ok {
+			out = append(out, c)
+		}
+		if end == to {
+			break
+		}
+	}
+	return out
+}
+
+// makeChunk builds a chunk from lines[start:end], trimming blank lines at
+// either edge. It reports false if nothing but whitespace is left.
+func makeChunk(lines []string, start, end int) (Chunk, bool) {
+	for start < end && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	if start >= end {
+		return Chunk{}, false
+	}
+	return Chunk{
+		Content:   strings.Join(lines[start:end], "\n"),
+		StartLine: start + 1,
+		EndLine:   end,
+	}, true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,130 @@
+package chunker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLineWindow(t *testing.T) {
+	var b strings.Builder
+	for i := 1; i <= 25; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+
+	chunks := LineWindow(Options{MaxLines: 10, Overlap: 2}).Chunk(b.String())
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+	want := [][2]int{{1, 10}, {9, 18}, {17, 25}}
+	for i, c := range chunks {
+		if c.StartLine != want[i][0] || c.EndLine != want[i][1] {
+			t.Errorf("Chunk %d: expected lines %d-%d, got %d-%d", i, want[i][0], want[i][1], c.StartLine, c.EndLine)
+		}
+	}
+	if !strings.HasPrefix(chunks[1].Content, "line 9\n") {
+		t.Errorf("Chunk 1 content mismatch: %q", chunks[1].Content)
+	}
+}
+
+func TestParagraphHeadingsStartNewChunk(t *testing.T) {
+	content := "# Title\n\nIntro text.\n\n## Section\n\nBody one.\n\nBody two.\n"
+
+	chunks := Paragraph(Options{}).Chunk(content)
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d: %+v", len(chunks), chunks)
+	}
+	if chunks[0].StartLine != 1 || chunks[0].EndLine != 3 {
+		t.Errorf("Chunk 0: expected lines 1-3, got %d-%d", chunks[0].StartLine, chunks[0].EndLine)
+	}
+	if chunks[1].StartLine != 5 || chunks[1].EndLine != 9 {
+		t.Errorf("Chunk 1: expected lines 5-9, got %d-%d", chunks[1].StartLine, chunks[1].EndLine)
+	}
+}
+
+func TestCodeSplitsOnTopLevelDeclarations(t *testing.T) {
+	content := `package demo
+
+// A does a.
+func A() {
+	println("a")
+}
+
+// B does b.
+func B() {
+	println("b")
+}
+`
+	chunks := Code(Options{MaxLines: 5}).Chunk(content)
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d: %+v", len(chunks), chunks)
+	}
+	if chunks[1].StartLine != 3 || chunks[1].EndLine != 6 {
+		t.Errorf("Expected func A with its comment at lines 3-6, got %d-%d", chunks[1].StartLine, chunks[1].EndLine)
+	}
+	if !strings.HasPrefix(chunks[2].Content, "// B does b.") {
+		t.Errorf("Expected func B chunk to start with its comment, got %q", chunks[2].Content)
+	}
+}
+
+func TestForPath(t *testing.T) {
+	cases := map[string]string{
+		"README.md":   "paragraph",
+		"main.go":     "go",
+		"script.py":   "code",
+		"config.yaml": "line",
+	}
+	for path, want := range cases {
+		if got := ForPath(path, Options{}).Name(); got != want {
+			t.Errorf("ForPath(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestGoASTSplitsOnDeclarations(t *testing.T) {
+	content := `// Package demo is a demo.
+package demo
+
+import "fmt"
+
+// Greeter greets.
+type Greeter struct{ name string }
+
+// Greet prints a greeting.
+func (g *Greeter) Greet() {
+	fmt.Println("hi", g.name)
+}
+
+func helper() {}
+`
+	chunks := GoAST(Options{}).Chunk(content)
+	want := []struct {
+		symbol, kind string
+		start, end   int
+	}{
+		{"demo", "package", 1, 4},
+		{"Greeter", "type", 6, 7},
+		{"Greeter.Greet", "method", 9, 12},
+		{"helper", "func", 14, 14},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Expected %d chunks, got %d: %+v", len(want), len(chunks), chunks)
+	}
+	for i, w := range want {
+		c := chunks[i]
+		if c.Symbol != w.symbol || c.Kind != w.kind || c.StartLine != w.start || c.EndLine != w.end {
+			t.Errorf("Chunk %d: expected %s %s %d-%d, got %s %s %d-%d",
+				i, w.kind, w.symbol, w.start, w.end, c.Kind, c.Symbol, c.StartLine, c.EndLine)
+		}
+	}
+}
+
+func TestGoASTFallsBackOnParseError(t *testing.T) {
+	chunks := GoAST(Options{}).Chunk("package demo\n\nfunc broken( {\n")
+	if len(chunks) == 0 {
+		t.Fatalf("Expected fallback chunks for unparsable source")
+	}
+	if chunks[0].Symbol != "" {
+		t.Errorf("Expected no symbol from fallback strategy, got %q", chunks[0].Symbol)
+	}
+}
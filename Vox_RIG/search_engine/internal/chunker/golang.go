@@ -0,0 +1,132 @@
+package chunker
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// maxGoDeclLines is the largest declaration kept as one chunk. Anything longer
+// is windowed, with every window still carrying the declaration's symbol.
+const maxGoDeclLines = 400
+
+type goAST struct {
+	opts     Options
+	fallback Strategy
+}
+
+// GoAST splits Go source on declaration boundaries using go/parser: one chunk
+// for the package clause and imports, then one per func, method, type, const
+// or var declaration including its doc comment. Chunks carry the symbol name
+// ("Engine.Retrieve" for methods) and kind. Files that fail to parse fall
+// back to Code.
+func GoAST(opts Options) Strategy {
+	opts = opts.withDefaults()
+	return goAST{opts: opts, fallback: Code(opts)}
+}
+
+func (goAST) Name() string { return "go" }
+
+func (s goAST) Chunk(content string) []Chunk {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return s.fallback.Chunk(content)
+	}
+
+	lines := splitLines(content)
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	var out []Chunk
+
+	// Header: package clause (with its doc comment) through the last import.
+	hdrStart := line(file.Package)
+	if file.Doc != nil {
+		hdrStart = line(file.Doc.Pos())
+	}
+	hdrEnd := line(file.Name.End())
+	for _, d := range file.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			hdrEnd = line(gd.End())
+		}
+	}
+	if c, ok := makeChunk(lines, hdrStart-1, hdrEnd); ok {
+		c.Symbol, c.Kind = file.Name.Name, "package"
+		out = append(out, c)
+	}
+
+	for _, d := range file.Decls {
+		var (
+			start, end   int
+			symbol, kind string
+		)
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			start, end = line(d.Pos()), line(d.End())
+			if d.Doc != nil {
+				start = line(d.Doc.Pos())
+			}
+			symbol, kind = d.Name.Name, "func"
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				symbol, kind = receiverName(d.Recv.List[0].Type)+"."+d.Name.Name, "method"
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			start, end = line(d.Pos()), line(d.End())
+			if d.Doc != nil {
+				start = line(d.Doc.Pos())
+			}
+			symbol, kind = genDeclNames(d), d.Tok.String()
+		default:
+			continue
+		}
+
+		if end-start+1 <= maxGoDeclLines {
+			if c, ok := makeChunk(lines, start-1, end); ok {
+				c.Symbol, c.Kind = symbol, kind
+				out = append(out, c)
+			}
+			continue
+		}
+		for _, c := range window(lines, start-1, end, s.opts) {
+			c.Symbol, c.Kind = symbol, kind
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// receiverName renders a method receiver type as "T" for both T and *T,
+// dropping type parameters.
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// genDeclNames joins the names declared by a type/const/var block.
+func genDeclNames(d *ast.GenDecl) string {
+	var names []string
+	for _, spec := range d.Specs {
+		switch sp := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, sp.Name.Name)
+		case *ast.ValueSpec:
+			for _, n := range sp.Names {
+				names = append(names, n.Name)
+			}
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,167 @@
+package chunker
+
+import (
+	"strings"
+)
+
+type lineWindow struct{ opts Options }
+
+// LineWindow cuts the file into fixed windows of MaxLines with Overlap lines
+// shared between neighbours. It works for any content.
+func LineWindow(opts Options) Strategy {
+	return lineWindow{opts.withDefaults()}
+}
+
+func (lineWindow) Name() string { return "line" }
+
+func (s lineWindow) Chunk(content string) []Chunk {
+	lines := splitLines(content)
+	return window(lines, 0, len(lines), s.opts)
+}
+
+type paragraph struct{ opts Options }
+
+// Paragraph groups blank-line separated paragraphs into chunks of up to
+// MaxLines. Markdown headings always start a new chunk and fenced code blocks
+// are never split at their inner blank lines. Paragraphs larger than MaxLines
+// are windowed.
+func Paragraph(opts Options) Strategy {
+	return paragraph{opts.withDefaults()}
+}
+
+func (paragraph) Name() string { return "paragraph" }
+
+func (s paragraph) Chunk(content string) []Chunk {
+	lines := splitLines(content)
+
+	// Collect [start,end) paragraph spans.
+	type span struct {
+		start, end int
+		heading    bool
+	}
+	var spans []span
+	inFence := false
+	start := -1
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			inFence = !inFence
+		}
+		isHeading := !inFence && strings.HasPrefix(t, "#")
+		if isHeading && start >= 0 {
+			spans = append(spans, span{start, i, strings.HasPrefix(strings.TrimSpace(lines[start]), "#")})
+			start = -1
+		}
+		if t == "" && !inFence {
+			if start >= 0 {
+				spans = append(spans, span{start, i, strings.HasPrefix(strings.TrimSpace(lines[start]), "#")})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(lines), strings.HasPrefix(strings.TrimSpace(lines[start]), "#")})
+	}
+
+	// Merge consecutive spans up to MaxLines; a heading span starts a new group.
+	var out []Chunk
+	gStart, gEnd := -1, -1
+	flush := func() {
+		if gStart >= 0 {
+			out = append(out, window(lines, gStart, gEnd, s.opts)...)
+		}
+		gStart, gEnd = -1, -1
+	}
+	for _, sp := range spans {
+		if gStart >= 0 && (sp.heading || sp.end-gStart > s.opts.MaxLines) {
+			flush()
+		}
+		if gStart < 0 {
+			gStart = sp.start
+		}
+		gEnd = sp.end
+	}
+	flush()
+	return out
+}
+
+type code struct{ opts Options }
+
+// Code is a language-agnostic code strategy. It splits on top-level
+// declarations: an unindented line that follows a blank line, a comment, or
+// a closing brace starts a new block. Small blocks are merged and large ones
+// windowed so chunks stay within MaxLines.
+func Code(opts Options) Strategy {
+	return code{opts.withDefaults()}
+}
+
+func (code) Name() string { return "code" }
+
+func (s code) Chunk(content string) []Chunk {
+	lines := splitLines(content)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	// Boundaries are indexes where a new top-level block begins. Leading
+	// comment lines are pulled into the block they document.
+	boundaries := []int{0}
+	for i := 1; i < len(lines); i++ {
+		if !isTopLevelStart(lines[i]) {
+			continue
+		}
+		prev := strings.TrimSpace(lines[i-1])
+		if prev != "" && !isClosing(prev) && !isComment(prev) {
+			continue
+		}
+		b := i
+		for b > 0 && isComment(strings.TrimSpace(lines[b-1])) && isTopLevelStart(lines[b-1]) {
+			b--
+		}
+		if b > boundaries[len(boundaries)-1] {
+			boundaries = append(boundaries, b)
+		}
+	}
+	boundaries = append(boundaries, len(lines))
+
+	var out []Chunk
+	gStart := boundaries[0]
+	for i := 1; i < len(boundaries); i++ {
+		blockEnd := boundaries[i]
+		next := len(lines)
+		if i+1 < len(boundaries) {
+			next = boundaries[i+1]
+		}
+		// Keep growing the group while the next block still fits.
+		if i+1 < len(boundaries) && next-gStart <= s.opts.MaxLines {
+			continue
+		}
+		out = append(out, window(lines, gStart, blockEnd, s.opts)...)
+		gStart = blockEnd
+	}
+	return out
+}
+
+func isTopLevelStart(l string) bool {
+	if l == "" {
+		return false
+	}
+	switch l[0] {
+	case ' ', '\t', '}', ')', ']':
+		return false
+	}
+	return true
+}
+
+func isClosing(t string) bool {
+	return strings.HasPrefix(t, "}") || strings.HasPrefix(t, ")") || strings.HasPrefix(t, "]") || t == "end"
+}
+
+func isComment(t string) bool {
+	return strings.HasPrefix(t, "//") || strings.HasPrefix(t, "#") || strings.HasPrefix(t, "/*") ||
+		strings.HasPrefix(t, "*") || strings.HasPrefix(t, "--") || strings.HasPrefix(t, `"""`)
+}
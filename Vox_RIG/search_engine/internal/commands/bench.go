@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"vox-vector-engine/internal/bench"
+)
+
+// BenchRequest configures the bench command. Dataset is a data directory or
+// vectors.bin file whose vectors (of -dim dimensions) are benchmarked;
+// empty generates N synthetic vectors of Dim (default -dim) dimensions.
+type BenchRequest struct {
+	Dataset  string `json:"dataset,omitempty"`
+	N        int    `json:"n,omitempty"`
+	Dim      int    `json:"dim,omitempty"`
+	Clusters int    `json:"clusters,omitempty"`
+	Queries  int    `json:"queries,omitempty"`
+	K        int    `json:"k,omitempty"`
+	Ef       []int  `json:"ef,omitempty"`
+	Seed     int64  `json:"seed,omitempty"`
+}
+
+// bench reports HNSW recall@k and latency against brute force. It reads the
+// dataset itself, so it runs without the stores of DataDir being opened.
+func (c *CLI) bench(input []byte) error {
+	var req BenchRequest
+	if len(input) > 0 {
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+	}
+	for _, ef := range req.Ef {
+		if ef <= 0 {
+			return invalid("ef values must be positive")
+		}
+	}
+	opts := bench.Options{
+		N:        req.N,
+		Dim:      req.Dim,
+		Clusters: req.Clusters,
+		Queries:  req.Queries,
+		K:        req.K,
+		Efs:      req.Ef,
+		Seed:     req.Seed,
+		Progress: func(done, total int) {
+			if done%10000 == 0 || done == total {
+				log.Printf("[bench] indexed %d/%d", done, total)
+			}
+		},
+	}
+	if opts.Dim == 0 {
+		opts.Dim = c.Dim
+	}
+	if req.Dataset != "" {
+		vecs, err := bench.LoadVectors(req.Dataset, c.Dim)
+		if err != nil {
+			return fmt.Errorf("bench error: %w", err)
+		}
+		opts.Vectors = vecs
+	}
+	log.Printf("[bench] dataset=%q", req.Dataset)
+
+	res, err := bench.Bench(opts)
+	if err != nil {
+		return fmt.Errorf("bench error: %w", err)
+	}
+	return c.write(res)
+}
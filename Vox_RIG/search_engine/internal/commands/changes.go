@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"fmt"
+
+	"vox-vector-engine/internal/types"
+)
+
+// Change feed page sizes.
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// ChangesRequest reads the change log after Since, optionally only the
+// entries of one namespace.
+type ChangesRequest struct {
+	Since     uint64 `json:"since,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// ChangesResult is one page of the change feed. Next is the since of the
+// following page: it moves past entries of other namespaces too, so a
+// filtered reader does not scan them again. More reports whether entries
+// after Next already exist.
+type ChangesResult struct {
+	Changes    []types.Change `json:"changes"`
+	Next       uint64         `json:"next"`
+	LastChange uint64         `json:"last_change"`
+	More       bool           `json:"more"`
+}
+
+// Changes returns the change log entries of req's stores after req.Since,
+// oldest first. With -isolate_namespaces every namespace has its own log
+// and sequence numbers.
+func Changes(env Env, req ChangesRequest) (*ChangesResult, error) {
+	if req.Limit <= 0 {
+		req.Limit = defaultChangesLimit
+	}
+	req.Limit = min(req.Limit, maxChangesLimit)
+
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	last, err := sh.Meta.LastChange()
+	if err != nil {
+		return nil, &Error{Internal, "Failed to read the change log", err}
+	}
+	res := &ChangesResult{Changes: []types.Change{}, Next: req.Since, LastChange: last}
+	for len(res.Changes) < req.Limit && res.Next < last {
+		page, err := sh.Meta.Changes(res.Next, req.Limit)
+		if err != nil {
+			return nil, &Error{Internal, "Failed to read the change log", err}
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, c := range page {
+			if len(res.Changes) == req.Limit {
+				break
+			}
+			res.Next = c.Seq
+			if req.Namespace == "" || c.Namespace == req.Namespace {
+				res.Changes = append(res.Changes, c)
+			}
+		}
+	}
+	res.More = res.Next < last
+	return res, nil
+}
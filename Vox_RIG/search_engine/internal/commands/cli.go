@@ -0,0 +1,738 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"vox-vector-engine/internal/embed"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/ingest"
+	"vox-vector-engine/internal/migrate"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/snapshot"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/tokens"
+)
+
+// Names lists the CLI commands, for flag help.
+const Names = "ingest_message | ingest_document | retrieve | context | similar | cluster | clusters | search_text | changes | tag | update_document | document_versions | get_document | get_chunk | delete_document | restore_document | feedback | purge_namespace | restore | reindex_git | ingest_dir | ingest_jsonl | migrate_embeddings | bench | stats | fsck | doctor | stop | uninstall"
+
+// ErrConfirmRequired is returned by purge_namespace when the confirm token is
+// missing; the token has already been written to the output.
+var ErrConfirmRequired = errors.New("confirmation required")
+
+// NeedsStores reports whether cmd works on the stores of DataDir. Commands
+// that do not (migrate_embeddings, bench) must run without them being opened,
+// since their source may be that same directory and bolt holds an exclusive
+// lock. stats, fsck and doctor open every store of DataDir themselves, so
+// they also work on stores that refuse to open normally. stop and uninstall
+// only talk to the daemon that holds them.
+func NeedsStores(cmd string) bool {
+	switch cmd {
+	case "migrate_embeddings", "bench", "stats", "fsck", "doctor", "stop", "uninstall":
+		return false
+	}
+	return true
+}
+
+// CLI runs single-shot commands against the stores of one data directory.
+// main.go and cmd/cli both drive it, so the two binaries accept the same
+// commands and print the same JSON as the HTTP API.
+type CLI struct {
+	DataDir string
+	Dim     int
+	Vectors storage.VectorStore
+	Meta    storage.MetadataStore
+	// MetaBackend opens the metadata stores of model spaces (-meta).
+	MetaBackend storage.MetadataBackend
+	// Index configures the index searches build over the stores (-index,
+	// -index_disk).
+	Index    index.Config
+	Embedder embed.Provider
+	Tokens   tokens.Counter
+	// Scrub redacts chunk content before it is stored (-scrub).
+	Scrub scrub.Chain
+	// Normalize stores unit vectors and searches unit queries (-normalize;
+	// see Env.Normalize).
+	Normalize bool
+	// WarnModelMismatch only warns about requests tagged with another
+	// embedding model than their namespace's (-warn_model_mismatch).
+	WarnModelMismatch bool
+	// Path and Namespace come from -path / -namespace and are the defaults
+	// for ingest_dir and reindex_git.
+	Path      string
+	Namespace string
+	// From and To come from -from / -to and name the source and target data
+	// directories of migrate_embeddings.
+	From string
+	To   string
+	// KeepVersions is passed to the file indexer of ingest_dir and
+	// reindex_git (see ingest.Indexer) and to ingest_document (see
+	// Env.KeepVersions).
+	KeepVersions int
+	// File, Workers and ErrorFile come from -file / -workers / -error_file:
+	// the JSON lines ingest_jsonl reads ("-" is stdin), how many lines it
+	// embeds at once, and where it reports the lines that failed.
+	File      string
+	Workers   int
+	ErrorFile string
+	// Format is how retrieve prints its result (-format: json, table or
+	// markdown; "" is JSON). ContentLines caps the content lines shown per
+	// chunk in table and markdown output (0 shows all), and Color colorizes
+	// tables (see UseColor).
+	Format       string
+	ContentLines int
+	Color        bool
+	// Out receives the JSON result (os.Stdout when nil).
+	Out io.Writer
+
+	shard   *engine.Shard
+	indexed bool
+	models  map[string]*engine.ModelSpace
+}
+
+// ReadInput returns raw if set, otherwise the JSON document piped on stdin.
+func ReadInput(raw string) []byte {
+	if raw != "" {
+		return []byte(raw)
+	}
+	stat, _ := os.Stdin.Stat()
+	if stat == nil || (stat.Mode()&os.ModeCharDevice) != 0 {
+		return nil
+	}
+	var v any
+	if err := json.NewDecoder(os.Stdin).Decode(&v); err != nil {
+		return nil
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// Run executes cmd with the JSON input and writes its result to Out.
+func (c *CLI) Run(ctx context.Context, cmd string, input []byte) error {
+	switch cmd {
+	case "ingest_message":
+		var req IngestMessageRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := IngestMessage(ctx, env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "ingest_document":
+		var req IngestDocumentRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := IngestDocument(ctx, env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "retrieve":
+		var req RetrieveRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, true)
+		if err != nil {
+			return err
+		}
+		res, err := Retrieve(ctx, env, req)
+		if err != nil {
+			return err
+		}
+		return c.writeRetrieval(env, req.Namespace, res)
+
+	case "context":
+		var req ContextRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, true)
+		if err != nil {
+			return err
+		}
+		res, err := Context(ctx, env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "similar":
+		var req SimilarRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := Similar(ctx, env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "cluster":
+		var req ClusterRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := Cluster(ctx, env, req, nil)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "clusters":
+		var req ClustersRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := Clusters(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "tag":
+		var req TagsRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := SetTags(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "update_document":
+		var req UpdateDocumentRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := UpdateDocument(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "document_versions":
+		var req DocumentVersionsRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := DocumentVersions(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "get_document":
+		var req GetDocumentRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := GetDocument(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "get_chunk":
+		var req GetChunkRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := GetChunk(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "delete_document":
+		var req DeleteDocumentRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := DeleteDocument(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "restore_document":
+		var req RestoreDocumentRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := RestoreDocument(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "feedback":
+		var req FeedbackRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := Feedback(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "search_text":
+		var req SearchTextRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := SearchText(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "changes":
+		var req ChangesRequest
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+		env, err := c.envFor(req.Model, false)
+		if err != nil {
+			return err
+		}
+		res, err := Changes(env, req)
+		if err != nil {
+			return err
+		}
+		return c.write(res)
+
+	case "purge_namespace":
+		return c.purgeNamespace(input)
+
+	case "restore":
+		return c.restore(input)
+
+	case "reindex_git":
+		return c.reindexGit(ctx, input)
+
+	case "ingest_dir":
+		return c.ingestDir(ctx)
+
+	case "ingest_jsonl":
+		return c.ingestJSONL(ctx)
+
+	case "migrate_embeddings":
+		return c.migrateEmbeddings(ctx)
+
+	case "bench":
+		return c.bench(input)
+
+	case "stats":
+		return c.stats()
+
+	case "fsck":
+		return c.fsck()
+
+	case "doctor":
+		return c.doctor(input)
+
+	case "stop":
+		return c.stopDaemon(input)
+
+	case "uninstall":
+		return c.uninstallDaemon(input)
+
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+}
+
+// env serves every namespace from the shared stores. The index is only
+// rebuilt when the command searches; ingest just needs somewhere to add to.
+func (c *CLI) env(search bool) Env {
+	if c.shard == nil || (search && !c.indexed) {
+		idx, err := index.New(c.Index, c.Vectors)
+		if err != nil {
+			// main validates -index, so only -index_disk can fail here.
+			log.Printf("index in memory: %v", err)
+			idx = index.NewHnswIndex(c.Vectors)
+		}
+		if c.shard != nil {
+			_ = c.shard.Index.Close()
+		}
+		if search {
+			engine.RebuildIndex(idx, c.Vectors)
+			c.indexed = true
+		}
+		c.shard = &engine.Shard{
+			Vectors: c.Vectors,
+			Meta:    c.Meta,
+			Index:   idx,
+			Engine:  engine.NewEngine(idx, c.Vectors, c.Meta),
+		}
+	}
+	sh := c.shard
+	return Env{
+		Resolve:  func(string) (*engine.Shard, error) { return sh, nil },
+		Embedder: c.Embedder,
+		Tokens:   c.Tokens,
+		Dim:      c.Vectors.Dim(),
+		Scrub:    c.Scrub,
+
+		Normalize:         c.Normalize,
+		WarnModelMismatch: c.WarnModelMismatch,
+		KeepVersions:      c.KeepVersions,
+	}
+}
+
+// envFor routes to the model space called model, created earlier by a server
+// started with -models; "" is the default stores.
+func (c *CLI) envFor(model string, search bool) (Env, error) {
+	if model == "" {
+		return c.env(search), nil
+	}
+	sp, ok := c.models[model]
+	if !ok {
+		var err error
+		sp, err = engine.OpenModelSpace(filepath.Join(c.DataDir, "models"), model, 0)
+		if err != nil {
+			return Env{}, invalid(err.Error())
+		}
+		sp.Shards.SetMetadataBackend(c.MetaBackend)
+		sp.Shards.SetIndexConfig(c.Index)
+		if c.models == nil {
+			c.models = map[string]*engine.ModelSpace{}
+		}
+		c.models[model] = sp
+	}
+	env := Env{Resolve: sp.Shards.Get, Tokens: c.Tokens, Dim: sp.Dim, Scrub: c.Scrub, Normalize: c.Normalize, WarnModelMismatch: c.WarnModelMismatch, KeepVersions: c.KeepVersions}
+	if c.Embedder != nil && c.Embedder.Dim() == sp.Dim {
+		env.Embedder = c.Embedder
+	}
+	return env, nil
+}
+
+// Close writes out the access log of retrievals and releases the index and
+// the model spaces opened by commands.
+func (c *CLI) Close() error {
+	var firstErr error
+	if c.shard != nil {
+		firstErr = c.shard.Engine.FlushAccess()
+		if err := c.shard.Index.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, sp := range c.models {
+		if err := sp.Shards.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *CLI) indexer() *ingest.Indexer {
+	env := c.env(true)
+	return &ingest.Indexer{Resolve: env.Resolve, Embedder: c.Embedder, Tokens: c.Tokens, Scrub: c.Scrub, KeepVersions: c.KeepVersions, Normalize: c.Normalize}
+}
+
+func (c *CLI) out() io.Writer {
+	if c.Out == nil {
+		return os.Stdout
+	}
+	return c.Out
+}
+
+func (c *CLI) write(v any) error {
+	return json.NewEncoder(c.out()).Encode(v)
+}
+
+// writeRetrieval prints res in c.Format, looking up the source of each
+// chunk's document for the human-readable formats.
+func (c *CLI) writeRetrieval(env Env, ns string, res *engine.RetrievalResult) error {
+	if c.Format == "" || c.Format == FormatJSON {
+		return c.write(res)
+	}
+	view := RetrievalView{Result: res, Sources: map[string]string{}, ContentLines: c.ContentLines, Color: c.Color}
+	if sh, err := env.Resolve(ns); err == nil {
+		for _, sc := range res.Chunks {
+			id := sc.Chunk.DocID
+			if _, ok := view.Sources[id]; ok {
+				continue
+			}
+			if doc, err := sh.Meta.GetDocument(id); err == nil {
+				view.Sources[id] = doc.Source
+			} else {
+				view.Sources[id] = ""
+			}
+		}
+	}
+	switch c.Format {
+	case FormatTable:
+		return view.WriteTable(c.out())
+	case FormatMarkdown:
+		return view.WriteMarkdown(c.out())
+	default:
+		return invalid(fmt.Sprintf("unknown output format %q (want json, table or markdown)", c.Format))
+	}
+}
+
+func decode(input []byte, v any) error {
+	if err := json.Unmarshal(input, v); err != nil {
+		return fmt.Errorf("json decode error: %w", err)
+	}
+	return nil
+}
+
+func (c *CLI) purgeNamespace(input []byte) error {
+	var req struct {
+		Namespace string `json:"namespace"`
+		Confirm   string `json:"confirm"`
+	}
+	if err := decode(input, &req); err != nil {
+		return err
+	}
+	if req.Namespace == "" {
+		return invalid("namespace is required")
+	}
+
+	token := engine.PurgeConfirmToken(req.Namespace)
+	if req.Confirm != token {
+		if err := c.write(map[string]any{
+			"status":        "confirm_required",
+			"namespace":     req.Namespace,
+			"confirm_token": token,
+		}); err != nil {
+			return err
+		}
+		return ErrConfirmRequired
+	}
+
+	eng := engine.NewEngine(index.NewHnswIndex(c.Vectors), c.Vectors, c.Meta)
+	res, err := eng.PurgeNamespace(req.Namespace)
+	if err != nil {
+		return fmt.Errorf("purge error: %w", err)
+	}
+
+	// Also drop the isolated shard, if the server was ever run with -isolate_namespaces.
+	shards, err := engine.NewShardManager(filepath.Join(c.DataDir, "namespaces"), c.Dim)
+	if err != nil {
+		return fmt.Errorf("open shards error: %w", err)
+	}
+	if err := shards.Drop(req.Namespace); err != nil {
+		return fmt.Errorf("drop shard error: %w", err)
+	}
+	modelsRoot := filepath.Join(c.DataDir, "models")
+	models, err := engine.ListModelSpaces(modelsRoot)
+	if err != nil {
+		return fmt.Errorf("list models error: %w", err)
+	}
+	for _, name := range models {
+		sp, err := engine.OpenModelSpace(modelsRoot, name, 0)
+		if err != nil {
+			return fmt.Errorf("open model error: %w", err)
+		}
+		err = sp.Shards.Drop(req.Namespace)
+		sp.Shards.Close()
+		if err != nil {
+			return fmt.Errorf("drop shard error: %w", err)
+		}
+	}
+	return c.write(res)
+}
+
+func (c *CLI) restore(input []byte) error {
+	var req struct {
+		Snapshot string `json:"snapshot"`
+	}
+	if err := decode(input, &req); err != nil {
+		return err
+	}
+
+	snapDir, err := snapshot.Resolve(filepath.Join(c.DataDir, "snapshots"), req.Snapshot)
+	if err != nil {
+		return fmt.Errorf("restore error: %w", err)
+	}
+	m, err := snapshot.ReadManifest(snapDir)
+	if err != nil {
+		return fmt.Errorf("restore error: %w", err)
+	}
+	if m.Dim != 0 && m.Dim != c.Dim {
+		return fmt.Errorf("restore error: snapshot dim=%d does not match -dim=%d", m.Dim, c.Dim)
+	}
+
+	// Files must not be mapped/locked while they are replaced.
+	c.Vectors.Close()
+	c.Meta.Close()
+	if err := snapshot.RestoreFiles(snapDir, c.DataDir); err != nil {
+		return fmt.Errorf("restore error: %w", err)
+	}
+	if err := snapshot.RestoreShards(snapDir, filepath.Join(c.DataDir, "namespaces")); err != nil {
+		return fmt.Errorf("restore error: %w", err)
+	}
+	if err := snapshot.RestoreModels(snapDir, filepath.Join(c.DataDir, "models")); err != nil {
+		return fmt.Errorf("restore error: %w", err)
+	}
+	return c.write(map[string]any{
+		"status":    "restore_ok",
+		"snapshot":  m.Name,
+		"vec_count": m.VectorCount,
+	})
+}
+
+// target resolves the directory and namespace of ingest_dir / reindex_git;
+// the namespace defaults to the directory name.
+func target(path, ns string) (string, string) {
+	if ns == "" {
+		abs, _ := filepath.Abs(path)
+		ns = filepath.Base(abs)
+	}
+	return path, ns
+}
+
+func (c *CLI) reindexGit(ctx context.Context, input []byte) error {
+	req := struct {
+		Namespace string `json:"namespace"`
+		Path      string `json:"path"`
+	}{c.Namespace, c.Path}
+	if len(input) > 0 {
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+	}
+	if req.Path == "" {
+		req.Path = "."
+	}
+	path, ns := target(req.Path, req.Namespace)
+
+	res, err := c.indexer().ReindexGit(ctx, ns, path)
+	if werr := c.write(res); werr != nil && err == nil {
+		err = werr
+	}
+	if err != nil {
+		return fmt.Errorf("reindex_git error: %w", err)
+	}
+	return nil
+}
+
+func (c *CLI) ingestDir(ctx context.Context) error {
+	if c.Path == "" {
+		return invalid("ingest_dir requires -path")
+	}
+	if c.Embedder == nil {
+		return invalid("ingest_dir requires -embed")
+	}
+	path, ns := target(c.Path, c.Namespace)
+
+	res, err := c.indexer().IndexDir(ctx, ns, path, func(p ingest.DirProgress) {
+		if p.Err != nil {
+			log.Printf("[ingest_dir] %d/%d %s error: %v", p.Done, p.Total, p.Path, p.Err)
+			return
+		}
+		log.Printf("[ingest_dir] %d/%d %s %s chunks=%d", p.Done, p.Total, p.Path, p.Status, p.Chunks)
+	})
+	if err != nil {
+		return fmt.Errorf("ingest_dir error: %w", err)
+	}
+	if err := c.write(res); err != nil {
+		return err
+	}
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("ingest_dir: %d file(s) failed", len(res.Errors))
+	}
+	return nil
+}
+
+func (c *CLI) migrateEmbeddings(ctx context.Context) error {
+	if c.From == "" || c.To == "" {
+		return invalid("migrate_embeddings requires -from and -to")
+	}
+	if c.Embedder == nil {
+		return invalid("migrate_embeddings requires -embed")
+	}
+	log.Printf("[migrate] from=%s to=%s provider=%s dim=%d", c.From, c.To, c.Embedder.Name(), c.Embedder.Dim())
+
+	res, err := migrate.Embeddings(ctx, c.From, c.To, c.Embedder, migrate.Options{
+		Backend: c.MetaBackend,
+		Progress: func(p migrate.Progress) {
+			store := p.Store
+			if store == "" {
+				store = "default"
+			}
+			log.Printf("[migrate] store=%s %d/%d chunks", store, p.Done, p.Total)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("migrate_embeddings error: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.From, "models")); err == nil {
+		log.Printf("[migrate] %s/models not migrated; model spaces keep their own embeddings", c.From)
+	}
+	return c.write(res)
+}
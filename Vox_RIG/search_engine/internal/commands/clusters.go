@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"vox-vector-engine/internal/engine"
+)
+
+// ClusterRequest runs k-means over the stored vectors of a namespace (see
+// engine.ClusterNamespace).
+type ClusterRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	// K is the number of clusters; 0 picks one from the namespace size.
+	K int `json:"k,omitempty"`
+	// Iterations bounds the k-means rounds; 0 uses the default.
+	Iterations int `json:"iterations,omitempty"`
+	// Exemplars is how many representative chunks each cluster keeps.
+	Exemplars int `json:"exemplars,omitempty"`
+	// Seed makes the clustering repeatable.
+	Seed int64 `json:"seed,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// Validate checks req without touching the stores, so a server can reject
+// it before queuing the job.
+func (req ClusterRequest) Validate() error {
+	if req.K < 0 || req.K > engine.MaxClusters {
+		return invalid(fmt.Sprintf("k must be between 0 and %d", engine.MaxClusters))
+	}
+	if req.Iterations < 0 || req.Exemplars < 0 {
+		return invalid("iterations and exemplars must not be negative")
+	}
+	return nil
+}
+
+// Cluster clusters req.Namespace and saves the result, which Clusters then
+// serves. progress, if set, receives the share of the work done.
+func Cluster(ctx context.Context, env Env, req ClusterRequest, progress func(float64)) (*engine.Clustering, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	res, err := sh.Engine.ClusterNamespace(ctx, engine.ClusterConfig{
+		Namespace:  req.Namespace,
+		K:          req.K,
+		Iterations: req.Iterations,
+		Exemplars:  req.Exemplars,
+		Seed:       req.Seed,
+		Progress:   progress,
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		return nil, &Error{Internal, "clustering failed", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	return res, nil
+}
+
+// ClustersRequest reads the saved clustering of a namespace.
+type ClustersRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	// ChunkIDs also returns every chunk's assignment, which can be large.
+	ChunkIDs bool `json:"chunk_ids,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// Clusters returns the clustering saved by the last Cluster run of
+// req.Namespace.
+func Clusters(env Env, req ClustersRequest) (*engine.Clustering, error) {
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	res, err := sh.Engine.Clusters(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to load clusters", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	if res == nil {
+		return nil, &Error{NotFound, fmt.Sprintf("namespace %q has not been clustered; POST /clusters first", req.Namespace), nil}
+	}
+	if !req.ChunkIDs {
+		for i := range res.Clusters {
+			res.Clusters[i].ChunkIDs = nil
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,164 @@
+// Package commands implements the engine operations shared by the HTTP API
+// and the single-shot CLI: typed requests in, typed results out. Keeping them
+// here means /ingest_message and `-cmd ingest_message` cannot drift apart.
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"vox-vector-engine/internal/embed"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/tokens"
+	"vox-vector-engine/internal/types"
+)
+
+// Env is what a command runs against.
+type Env struct {
+	// Resolve returns the shard that stores namespace ns.
+	Resolve func(ns string) (*engine.Shard, error)
+	// Embedder embeds query_text when a request carries no vector (optional).
+	Embedder embed.Provider
+	// Tokens fills in missing token counts; nil uses tokens.Heuristic.
+	Tokens tokens.Counter
+	// Dim is the vector length the stores expect; 0 skips the check.
+	Dim int
+	// Scrub redacts chunk content before it is stored (optional).
+	Scrub scrub.Chain
+	// SearchTimeout bounds each index search and scoring pass (0 = none);
+	// the caller's context is honored either way.
+	SearchTimeout time.Duration
+	// Normalize scales vectors to unit length before they are stored,
+	// keeping each chunk's original norm under engine.MetaNorm, and queries
+	// before they are searched, so distances rank by cosine similarity.
+	Normalize bool
+	// WarnModelMismatch stores and searches vectors tagged with another
+	// embedding model than their namespace's, with a warning, instead of
+	// refusing them (see checkModelTag).
+	WarnModelMismatch bool
+	// ShortTerm keeps the last ShortTerm messages of every conversation in
+	// memory, searched without the index, and stores a message only once
+	// it falls out of them (see engine.RememberMessage); 0 stores every
+	// message at once.
+	ShortTerm int
+	// KeepVersions is how many prior versions of a file re-ingested with
+	// ingest_document chunks stay searchable (see engine.ArchiveDocument);
+	// 0 replaces the file in place.
+	KeepVersions int
+}
+
+func (env Env) counter() tokens.Counter {
+	if env.Tokens == nil {
+		return tokens.Heuristic()
+	}
+	return env.Tokens
+}
+
+// Kind classifies a command failure so callers can map it to a status.
+type Kind int
+
+const (
+	// Internal is a store failure (HTTP 500).
+	Internal Kind = iota
+	// Invalid is a malformed or incomplete request (HTTP 400).
+	Invalid
+	// Upstream is a failure of the embedding provider or the external
+	// scrubber (HTTP 502).
+	Upstream
+	// NotFound names a document or chunk that does not exist (HTTP 404).
+	NotFound
+	// Conflict is a request the current state of the store refuses (HTTP 409).
+	Conflict
+	// Timeout is a search cut short by its deadline or by the client going
+	// away (HTTP 504); the cause is an *engine.Interrupted.
+	Timeout
+)
+
+// Error carries the client-facing message for a failed command alongside the
+// underlying cause, which is only logged.
+type Error struct {
+	Kind Kind
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func invalid(msg string) error {
+	return &Error{Kind: Invalid, Msg: msg}
+}
+
+// checkVector rejects a vector whose length does not match env.Dim, naming
+// the expected dimension so clients can fix their embedding model, and an
+// all-zero vector, which has no direction: stored, it sits at the same
+// distance from every unit query and crowds out real neighbors.
+func (env Env) checkVector(field string, v types.Vector) error {
+	if env.Dim > 0 && len(v) != env.Dim {
+		return invalid(fmt.Sprintf("%s has dimension %d, expected %d", field, len(v), env.Dim))
+	}
+	if engine.Norm(v) == 0 {
+		return invalid(field + " is all zeros")
+	}
+	return nil
+}
+
+// query returns q as it should be searched: scaled to unit length when
+// env.Normalize is set.
+func (env Env) query(q types.Vector) types.Vector {
+	if !env.Normalize {
+		return q
+	}
+	q, _ = engine.Unit(q)
+	return q
+}
+
+// searchContext bounds a search by env.SearchTimeout.
+func (env Env) searchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if env.SearchTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, env.SearchTimeout)
+}
+
+// searchFailed wraps the error of a search: Timeout when it was interrupted,
+// Internal with msg otherwise.
+func searchFailed(msg string, err error) error {
+	var ie *engine.Interrupted
+	if !errors.As(err, &ie) {
+		return &Error{Internal, msg, err}
+	}
+	what := "timed out"
+	if errors.Is(ie.Err, context.Canceled) {
+		what = "was canceled"
+	}
+	return &Error{Timeout, fmt.Sprintf("search %s after %s in %s (%d candidates, %d scored)",
+		what, ie.Elapsed.Round(time.Millisecond), ie.Stage, ie.Candidates, ie.Scored), err}
+}
+
+// Message returns the client-facing message of err.
+func Message(err error) string {
+	var ce *Error
+	if errors.As(err, &ce) {
+		return ce.Msg
+	}
+	return err.Error()
+}
+
+// KindOf returns the Kind of err; errors not raised by this package are Internal.
+func KindOf(err error) Kind {
+	var ce *Error
+	if errors.As(err, &ce) {
+		return ce.Kind
+	}
+	return Internal
+}
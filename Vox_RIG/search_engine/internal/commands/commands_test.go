@@ -0,0 +1,1486 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func newEnv(t *testing.T) Env {
+	t.Helper()
+	shards, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("Failed to create shards: %v", err)
+	}
+	t.Cleanup(func() { shards.Close() })
+	return Env{Resolve: shards.Get}
+}
+
+func TestIngestMessageValidation(t *testing.T) {
+	env := newEnv(t)
+	_, err := IngestMessage(context.Background(), env, IngestMessageRequest{Namespace: "ns", ConversationID: "c", Role: "user", Content: "hi"})
+	if KindOf(err) != Invalid || Message(err) != "vector is required" {
+		t.Errorf("Expected invalid 'vector is required', got %v", err)
+	}
+	_, err = IngestMessage(context.Background(), env, IngestMessageRequest{Namespace: "ns", ConversationID: "c", Role: "user", Content: "hi",
+		Vector: types.Vector{1, 0}, TimestampUTC: "yesterday"})
+	if KindOf(err) != Invalid {
+		t.Errorf("Expected invalid timestamp error, got %v", err)
+	}
+}
+
+func TestIngestAndRetrieve(t *testing.T) {
+	env := newEnv(t)
+
+	msg, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c1", MessageID: "m1", Role: "user",
+		Content: "hello world", Vector: types.Vector{1, 0},
+	})
+	if err != nil {
+		t.Fatalf("IngestMessage failed: %v", err)
+	}
+	if msg.DocID != "chat:c1:m1" || msg.Status != "ingested_message" {
+		t.Errorf("Unexpected message result: %+v", msg)
+	}
+
+	doc, err := IngestDocument(context.Background(), env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "main.go", Content: "package main",
+		Vector: types.Vector{0, 1}, StartLine: 1, EndLine: 1,
+	})
+	if err != nil {
+		t.Fatalf("IngestDocument failed: %v", err)
+	}
+	if doc.DocID != "file:ns:main.go:1-1" || len(doc.ChunkIDs) != 1 {
+		t.Errorf("Unexpected document result: %+v", doc)
+	}
+
+	res, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(res.Chunks) == 0 || res.Chunks[0].Chunk.DocID != "chat:c1:m1" {
+		t.Errorf("Expected chat message first, got %+v", res.Chunks)
+	}
+
+	if _, err := Retrieve(context.Background(), env, RetrieveRequest{QueryText: "no embedder"}); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error without vector or embedder, got %v", err)
+	}
+}
+
+func TestCLIRun(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer vecs.Close()
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer meta.Close()
+
+	var out bytes.Buffer
+	cli := &CLI{DataDir: dir, Dim: 2, Vectors: vecs, Meta: meta, Out: &out}
+	ctx := context.Background()
+
+	in := `{"namespace":"ns","conversation_id":"c","message_id":"m","role":"user","content":"hi","vector":[1,0]}`
+	if err := cli.Run(ctx, "ingest_message", []byte(in)); err != nil {
+		t.Fatalf("ingest_message failed: %v", err)
+	}
+	var msg IngestMessageResult
+	if err := json.Unmarshal(out.Bytes(), &msg); err != nil || msg.DocID != "chat:c:m" {
+		t.Errorf("Unexpected ingest_message output %q (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := cli.Run(ctx, "retrieve", []byte(`{"namespace":"ns","query":[1,0]}`)); err != nil {
+		t.Fatalf("retrieve failed: %v", err)
+	}
+	var res engine.RetrievalResult
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil || len(res.Chunks) != 1 {
+		t.Errorf("Unexpected retrieve output %q (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := cli.Run(ctx, "purge_namespace", []byte(`{"namespace":"ns"}`)); !errors.Is(err, ErrConfirmRequired) {
+		t.Errorf("Expected ErrConfirmRequired, got %v", err)
+	}
+
+	if err := cli.Run(ctx, "bogus", nil); err == nil {
+		t.Errorf("Expected error for unknown command")
+	}
+}
+
+func TestIngestMessageIsIdempotent(t *testing.T) {
+	env := newEnv(t)
+	req := IngestMessageRequest{Namespace: "ns", ConversationID: "c", Role: "user", Content: "same", Vector: types.Vector{1, 0}}
+
+	first, err := IngestMessage(context.Background(), env, req)
+	if err != nil {
+		t.Fatalf("First IngestMessage failed: %v", err)
+	}
+	second, err := IngestMessage(context.Background(), env, req)
+	if err != nil {
+		t.Fatalf("Second IngestMessage failed: %v", err)
+	}
+	if !second.Duplicate || second.DocID != first.DocID || second.ChunkID != first.ChunkID || second.VectorCount != 1 {
+		t.Errorf("Expected duplicate no-op, got first=%+v second=%+v", first, second)
+	}
+
+	// Same message_id with new content replaces the stored chunk.
+	req.MessageID = first.MessageID
+	req.Content = "edited"
+	third, err := IngestMessage(context.Background(), env, req)
+	if err != nil {
+		t.Fatalf("Third IngestMessage failed: %v", err)
+	}
+	if third.Duplicate || third.DocID != first.DocID || third.ChunkID == first.ChunkID {
+		t.Errorf("Expected replacement, got %+v", third)
+	}
+	sh, _ := env.Resolve("ns")
+	if _, err := sh.Meta.GetChunk(first.ChunkID); err == nil {
+		t.Errorf("Old chunk %d should have been removed", first.ChunkID)
+	}
+}
+
+func TestDimensionValidation(t *testing.T) {
+	env := newEnv(t)
+	env.Dim = 2
+
+	_, err := IngestMessage(context.Background(), env, IngestMessageRequest{Namespace: "ns", ConversationID: "c", Role: "user",
+		Content: "hi", Vector: types.Vector{1, 0, 0}})
+	if KindOf(err) != Invalid || Message(err) != "vector has dimension 3, expected 2" {
+		t.Errorf("Expected dimension error, got %v", err)
+	}
+
+	_, err = Ingest(context.Background(), env, IngestRequest{
+		Document: types.Document{ID: "d"},
+		Chunks:   []IngestChunk{{DocID: "d", Vector: types.Vector{1, 0}}, {DocID: "d", Vector: types.Vector{1}}},
+	})
+	if KindOf(err) != Invalid {
+		t.Errorf("Expected dimension error for chunks[1], got %v", err)
+	}
+	sh, _ := env.Resolve("")
+	if _, err := sh.Meta.GetDocument("d"); err == nil || sh.Vectors.Count() != 0 {
+		t.Errorf("Nothing should be written when a chunk has the wrong dimension")
+	}
+
+	if _, err := Retrieve(context.Background(), env, RetrieveRequest{Query: types.Vector{1}}); KindOf(err) != Invalid {
+		t.Errorf("Expected dimension error for query, got %v", err)
+	}
+}
+
+func TestNormalizeOnIngest(t *testing.T) {
+	env := newEnv(t)
+	env.Normalize = true
+	ctx := context.Background()
+
+	_, err := IngestMessage(ctx, env, IngestMessageRequest{Namespace: "ns", ConversationID: "c", Role: "user",
+		Content: "zero", Vector: types.Vector{0, 0}})
+	if KindOf(err) != Invalid || Message(err) != "vector is all zeros" {
+		t.Errorf("Expected all-zero error, got %v", err)
+	}
+	if _, err := Retrieve(ctx, env, RetrieveRequest{Query: types.Vector{0, 0}}); KindOf(err) != Invalid {
+		t.Errorf("Expected all-zero error for query, got %v", err)
+	}
+
+	res, err := Ingest(ctx, env, IngestRequest{
+		Namespace: "ns",
+		Document:  types.Document{ID: "d"},
+		Chunks:    []IngestChunk{{DocID: "d", Vector: types.Vector{3, 4}, Content: "long"}, {DocID: "d", Vector: types.Vector{0.1, 0}, Content: "short"}},
+	})
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	sh, _ := env.Resolve("ns")
+	v, err := sh.Vectors.Get(res.ChunkIDs[0])
+	if err != nil || v[0] != 0.6 || v[1] != 0.8 {
+		t.Errorf("Expected stored unit vector [0.6 0.8], got %v (%v)", v, err)
+	}
+	c, err := sh.Meta.GetChunk(res.ChunkIDs[0])
+	if err != nil || fmt.Sprint(c.Metadata[engine.MetaNorm]) != "5" {
+		t.Errorf("Expected original norm 5 in chunk metadata, got %v (%v)", c, err)
+	}
+
+	// By raw distance [3, 4] is nearer [10, 1]; by direction [0.1, 0] is.
+	out, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{10, 1}})
+	if err != nil || len(out.Chunks) != 2 || out.Chunks[0].Chunk.Content != "short" {
+		t.Errorf("Expected the chunk with the nearest direction first, got %+v (%v)", out, err)
+	}
+}
+
+func TestModelTagEnforced(t *testing.T) {
+	env := newEnv(t)
+	ctx := context.Background()
+
+	ingest := func(tag string) error {
+		_, err := Ingest(ctx, env, IngestRequest{
+			Namespace:      "ns",
+			Document:       types.Document{ID: "d-" + tag},
+			Chunks:         []IngestChunk{{DocID: "d-" + tag, Vector: types.Vector{1, 0}, Content: tag}},
+			EmbeddingModel: tag,
+		})
+		return err
+	}
+	if err := ingest("model-a"); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	sh, _ := env.Resolve("ns")
+	if tag, err := sh.Engine.ModelTag("ns"); err != nil || tag != "model-a" {
+		t.Errorf("Expected namespace tagged model-a, got %q (%v)", tag, err)
+	}
+	if err := ingest("model-b"); KindOf(err) != Conflict {
+		t.Errorf("Expected Conflict ingesting another model's vectors, got %v", err)
+	}
+	if _, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, EmbeddingModel: "model-b"}); KindOf(err) != Conflict {
+		t.Errorf("Expected Conflict searching with another model's query, got %v", err)
+	}
+	if out, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, EmbeddingModel: "model-a"}); err != nil || out.ModelWarning != "" || len(out.Chunks) != 1 {
+		t.Errorf("Expected a clean search with the namespace's model, got %+v (%v)", out, err)
+	}
+
+	env.WarnModelMismatch = true
+	out, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, EmbeddingModel: "model-b"})
+	if err != nil || out.ModelWarning == "" {
+		t.Errorf("Expected a model warning, got %+v (%v)", out, err)
+	}
+}
+
+func TestNamedVectors(t *testing.T) {
+	env := newEnv(t)
+	ctx := context.Background()
+
+	_, err := Ingest(ctx, env, IngestRequest{
+		Namespace: "ns",
+		Document:  types.Document{ID: "d"},
+		Chunks: []IngestChunk{
+			{DocID: "d", Vector: types.Vector{1, 0}, Content: "documented", Vectors: map[string]types.Vector{"docstring": {0, 1}}},
+			{DocID: "d", Vector: types.Vector{0.2, 1}, Content: "plain"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	_, err = Ingest(ctx, env, IngestRequest{
+		Namespace: "ns",
+		Document:  types.Document{ID: "bad"},
+		Chunks:    []IngestChunk{{DocID: "bad", Vector: types.Vector{1, 0}, Vectors: map[string]types.Vector{"content": {0, 1}}}},
+	})
+	if KindOf(err) != Invalid {
+		t.Errorf("Expected the reserved name to be refused, got %v", err)
+	}
+
+	contents := func(weights map[string]float32) []string {
+		t.Helper()
+		res, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{0, 1}, VectorWeights: weights})
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		var out []string
+		for _, c := range res.Chunks {
+			out = append(out, c.Chunk.Content)
+		}
+		return out
+	}
+	// The docstring matches the query exactly; the chunk is returned once.
+	if got := contents(nil); fmt.Sprint(got) != "[documented plain]" {
+		t.Errorf("Expected the chunk with the matching docstring first, got %v", got)
+	}
+	if got := contents(map[string]float32{"content": 1}); fmt.Sprint(got) != "[plain documented]" {
+		t.Errorf("Expected ranking by chunk vectors alone, got %v", got)
+	}
+	if got := contents(map[string]float32{"docstring": 1}); fmt.Sprint(got) != "[documented]" {
+		t.Errorf("Expected only chunks with a docstring vector, got %v", got)
+	}
+	if _, err := Retrieve(ctx, env, RetrieveRequest{Query: types.Vector{0, 1}, VectorWeights: map[string]float32{"content": -1}}); KindOf(err) != Invalid {
+		t.Errorf("Expected a negative weight to be refused, got %v", err)
+	}
+
+	sh, _ := env.Resolve("ns")
+	if _, err := sh.Engine.PurgeNamespace("ns"); err != nil {
+		t.Fatalf("PurgeNamespace failed: %v", err)
+	}
+	if n := sh.Index.Len(); n != 0 {
+		t.Errorf("Expected purge to unindex every vector, %d left", n)
+	}
+}
+
+func TestDeleteDocumentNamedVectors(t *testing.T) {
+	env := newEnv(t)
+	ctx := context.Background()
+
+	res, err := Ingest(ctx, env, IngestRequest{
+		Namespace: "ns",
+		Document:  types.Document{ID: "gone"},
+		Chunks:    []IngestChunk{{DocID: "gone", Vector: types.Vector{1, 0}, Content: "gone", Vectors: map[string]types.Vector{"docstring": {0, 1}}}},
+	})
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if _, err := Ingest(ctx, env, IngestRequest{Namespace: "ns", Document: types.Document{ID: "kept"}, Chunks: []IngestChunk{{DocID: "kept", Vector: types.Vector{1, 0.1}, Content: "kept"}}}); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	sh, _ := env.Resolve("ns")
+	chunk, err := sh.Meta.GetChunk(res.ChunkIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := engine.NamedVectors(chunk.Metadata)["docstring"]
+
+	if _, err := sh.Engine.DeleteDocument("gone"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	// The docstring vector matches the query exactly; it must not lead
+	// anywhere once its chunk is gone.
+	for _, weights := range []map[string]float32{nil, {"docstring": 1}} {
+		out, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{0, 1}, VectorWeights: weights})
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		for _, c := range out.Chunks {
+			if c.Chunk.DocID == "gone" {
+				t.Errorf("weights %v: deleted chunk retrieved through its named vector", weights)
+			}
+		}
+	}
+	if sh.Index.Contains(named) || sh.Index.Len() != 1 {
+		t.Errorf("Expected only the kept chunk indexed, got %d vectors (named %d indexed: %v)", sh.Index.Len(), named, sh.Index.Contains(named))
+	}
+	if link, _ := sh.Meta.GetState("vector_of:" + fmt.Sprint(named)); link != "" {
+		t.Errorf("Expected the named vector's link dropped, got %q", link)
+	}
+}
+
+func TestSparseHybrid(t *testing.T) {
+	env := newEnv(t)
+	ctx := context.Background()
+
+	ids := map[string]uint64{}
+	for _, c := range []IngestChunk{
+		{DocID: "a", Vector: types.Vector{1, 0}, Content: "a", Sparse: types.SparseVector{"parseConfig": 2}},
+		{DocID: "b", Vector: types.Vector{0.9, 0.1}, Content: "b"},
+		{DocID: "c", Vector: types.Vector{0, 1}, Content: "c", Sparse: types.SparseVector{"parseConfig": 1, "load": 1}},
+	} {
+		res, err := Ingest(ctx, env, IngestRequest{Namespace: "ns", Document: types.Document{ID: c.DocID}, Chunks: []IngestChunk{c}})
+		if err != nil {
+			t.Fatalf("Ingest failed: %v", err)
+		}
+		ids[c.DocID] = res.ChunkIDs[0]
+	}
+	_, err := Ingest(ctx, env, IngestRequest{Namespace: "ns", Document: types.Document{ID: "bad"},
+		Chunks: []IngestChunk{{DocID: "bad", Vector: types.Vector{1, 0}, Sparse: types.SparseVector{"x": -1}}}})
+	if KindOf(err) != Invalid {
+		t.Errorf("Expected a negative sparse weight to be refused, got %v", err)
+	}
+
+	order := func(req RetrieveRequest) string {
+		t.Helper()
+		req.Namespace, req.Query = "ns", types.Vector{1, 0}
+		res, err := Retrieve(ctx, env, req)
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		var out []string
+		for _, c := range res.Chunks {
+			out = append(out, c.Chunk.Content)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := order(RetrieveRequest{}); got != "a,b,c" {
+		t.Errorf("Expected dense order a,b,c, got %s", got)
+	}
+	// c shares the query's term, b none.
+	if got := order(RetrieveRequest{SparseQuery: types.SparseVector{"parseConfig": 1}, SparseWeight: 0.9}); got != "a,c,b" {
+		t.Errorf("Expected hybrid order a,c,b, got %s", got)
+	}
+	if _, err := Retrieve(ctx, env, RetrieveRequest{Query: types.Vector{1, 0}, SparseWeight: 2}); KindOf(err) != Invalid {
+		t.Errorf("Expected sparse_weight above 1 to be refused, got %v", err)
+	}
+
+	sh, _ := env.Resolve("ns")
+	if _, err := sh.Engine.DeleteDocument("a"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	got, scores, err := sh.Engine.SparseCandidates(types.SparseVector{"parseConfig": 1}, "ns", 10)
+	if err != nil || len(got) != 1 || got[0] != ids["c"] || scores[0] != 1 {
+		t.Errorf("Expected only c after deleting a, got %v %v (%v)", got, scores, err)
+	}
+}
+
+func TestShortTermMemory(t *testing.T) {
+	env := newEnv(t)
+	env.ShortTerm = 2
+	ctx := context.Background()
+
+	send := func(id, content string) IngestMessageResult {
+		t.Helper()
+		res, err := IngestMessage(ctx, env, IngestMessageRequest{Namespace: "ns", ConversationID: "c", MessageID: id,
+			Role: "user", Content: content, Vector: types.Vector{1, float32(len(content))}})
+		if err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+		return res
+	}
+	send("m1", "one")
+	send("m2", "two")
+	if res := send("m3", "three"); !res.ShortTerm || res.Promoted != 1 {
+		t.Errorf("Expected m3 buffered and m1 promoted, got %+v", res)
+	}
+	if res := send("m3", "three"); !res.Duplicate {
+		t.Errorf("Expected a re-sent buffered message to be a duplicate, got %+v", res)
+	}
+
+	sh, _ := env.Resolve("ns")
+	if _, err := sh.Meta.GetDocument("chat:c:m1"); err != nil {
+		t.Errorf("Expected m1 stored, got %v", err)
+	}
+	if _, err := sh.Meta.GetDocument("chat:c:m3"); err == nil {
+		t.Error("Expected m3 to stay in memory")
+	}
+	res, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", ConversationID: "c", Query: types.Vector{1, 3}})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	buffered := 0
+	for _, c := range res.Chunks {
+		if c.ShortTerm {
+			buffered++
+		}
+	}
+	if len(res.Chunks) != 3 || buffered != 2 {
+		t.Errorf("Expected 3 messages, 2 of them buffered, got %+v", res.Chunks)
+	}
+
+	if err := sh.Engine.FlushShortTerm(); err != nil {
+		t.Fatalf("FlushShortTerm failed: %v", err)
+	}
+	if n := sh.Index.Len(); n != 3 {
+		t.Errorf("Expected every message indexed after the flush, got %d", n)
+	}
+	if doc, err := sh.Meta.GetDocument("chat:c:m3"); err != nil || doc.Metadata["chunk_id"] == nil {
+		t.Errorf("Expected m3 stored with its chunk ID, got %+v (%v)", doc, err)
+	}
+}
+
+func TestCLIModelSpaces(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer vecs.Close()
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer meta.Close()
+
+	// A server started with -models chat=3 creates the space.
+	sp, err := engine.OpenModelSpace(filepath.Join(dir, "models"), "chat", 3)
+	if err != nil {
+		t.Fatalf("OpenModelSpace failed: %v", err)
+	}
+	sp.Shards.Close()
+
+	var out bytes.Buffer
+	cli := &CLI{DataDir: dir, Dim: 2, Vectors: vecs, Meta: meta, Out: &out}
+	defer cli.Close()
+	ctx := context.Background()
+
+	in := `{"model":"chat","namespace":"ns","conversation_id":"c","role":"user","content":"hi","vector":[1,0,0]}`
+	if err := cli.Run(ctx, "ingest_message", []byte(in)); err != nil {
+		t.Fatalf("ingest_message into model space failed: %v", err)
+	}
+	if vecs.Count() != 0 {
+		t.Errorf("Default store should be untouched, has %d vectors", vecs.Count())
+	}
+
+	out.Reset()
+	if err := cli.Run(ctx, "retrieve", []byte(`{"model":"chat","namespace":"ns","query":[1,0,0]}`)); err != nil {
+		t.Fatalf("retrieve from model space failed: %v", err)
+	}
+	var res engine.RetrievalResult
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil || len(res.Chunks) != 1 {
+		t.Errorf("Unexpected retrieve output %q (%v)", out.String(), err)
+	}
+
+	if err := cli.Run(ctx, "retrieve", []byte(`{"model":"chat","query":[1,0]}`)); KindOf(err) != Invalid {
+		t.Errorf("Expected dimension error for 2-d query into 3-d model, got %v", err)
+	}
+	if err := cli.Run(ctx, "retrieve", []byte(`{"model":"nope","query":[1,0]}`)); KindOf(err) != Invalid {
+		t.Errorf("Expected unknown model error, got %v", err)
+	}
+}
+
+func TestRetrieveBoosts(t *testing.T) {
+	env := newEnv(t)
+	if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c1", MessageID: "m1", Role: "user",
+		Content: "hello world", Vector: types.Vector{1, 0},
+	}); err != nil {
+		t.Fatalf("IngestMessage failed: %v", err)
+	}
+	if _, err := IngestDocument(context.Background(), env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "main.go", Content: "package main",
+		Vector: types.Vector{0.6, 0.8}, StartLine: 1, EndLine: 1,
+	}); err != nil {
+		t.Fatalf("IngestDocument failed: %v", err)
+	}
+
+	req := RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}}
+	res, err := Retrieve(context.Background(), env, req)
+	if err != nil || len(res.Chunks) != 2 || res.Chunks[0].Chunk.DocID != "chat:c1:m1" {
+		t.Fatalf("Expected chat message first without boosts, got %+v (%v)", res, err)
+	}
+
+	req.Boosts = map[string]map[string]float32{"type": {"code": 3}, "role": {"assistant": 5}}
+	res, err = Retrieve(context.Background(), env, req)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if res.Chunks[0].Chunk.DocID != "file:ns:main.go:1-1" {
+		t.Errorf("Expected boosted code chunk first, got %+v", res.Chunks)
+	}
+
+	req.Boosts = map[string]map[string]float32{"type": {"code": -1}}
+	if _, err := Retrieve(context.Background(), env, req); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error for a negative boost, got %v", err)
+	}
+}
+
+func TestRetrieveImportance(t *testing.T) {
+	env := newEnv(t)
+	ts := time.Now().UTC().Format(time.RFC3339)
+	for _, req := range []IngestMessageRequest{
+		{MessageID: "chat", Content: "ok thanks"},
+		{MessageID: "rule", Content: "always use tabs", Tags: []string{"user_instruction"}},
+		{MessageID: "note", Content: "fyi", Importance: 0.5},
+	} {
+		req.Namespace, req.ConversationID, req.Role = "ns", "c", "user"
+		req.Vector, req.TimestampUTC = types.Vector{1, 0}, ts
+		if _, err := IngestMessage(context.Background(), env, req); err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+	}
+
+	res, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}})
+	if err != nil || len(res.Chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %+v (%v)", res, err)
+	}
+	var order []string
+	for _, c := range res.Chunks {
+		order = append(order, c.Chunk.DocID)
+	}
+	if strings.Join(order, ",") != "chat:c:rule,chat:c:note,chat:c:chat" {
+		t.Errorf("Expected chunks ordered by importance at equal similarity, got %v", order)
+	}
+	if got := engine.Importance(res.Chunks[0].Chunk.Metadata, nil); got != 1 {
+		t.Errorf("Expected inferred importance 1 stored on the chunk, got %v", got)
+	}
+
+	_, err = IngestMessage(context.Background(), env, IngestMessageRequest{Namespace: "ns", ConversationID: "c", Role: "user",
+		Content: "x", Vector: types.Vector{1, 0}, Importance: 1.5})
+	if KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error for importance 1.5, got %v", err)
+	}
+}
+
+func TestRetrieveFeedback(t *testing.T) {
+	env := newEnv(t)
+	ts := time.Now().UTC().Format(time.RFC3339)
+	chunkIDs := map[string]uint64{}
+	for _, id := range []string{"a", "b"} {
+		res, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+			Namespace: "ns", ConversationID: "c", MessageID: id, Role: "user",
+			Content: "message " + id, Vector: types.Vector{1, 0}, TimestampUTC: ts,
+		})
+		if err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+		chunkIDs[id] = res.ChunkID
+	}
+
+	first := func() string {
+		t.Helper()
+		res, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}})
+		if err != nil || len(res.Chunks) != 2 {
+			t.Fatalf("Expected 2 chunks, got %+v (%v)", res, err)
+		}
+		return res.Chunks[0].Chunk.DocID
+	}
+
+	a, b := chunkIDs["a"], chunkIDs["b"]
+	if _, err := Feedback(env, FeedbackRequest{Namespace: "ns", ChunkID: &a, Signal: "harmful"}); err != nil {
+		t.Fatalf("Feedback failed: %v", err)
+	}
+	if got := first(); got != "chat:c:b" {
+		t.Errorf("Expected the unharmed message first, got %s", got)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := Feedback(env, FeedbackRequest{Namespace: "ns", ChunkID: &a, Signal: "used"}); err != nil {
+			t.Fatalf("Feedback failed: %v", err)
+		}
+	}
+	res, err := Feedback(env, FeedbackRequest{Namespace: "ns", ChunkID: &b, Signal: "ignored"})
+	if err != nil || res.Ignored != 1 || res.DocID != "chat:c:b" {
+		t.Fatalf("Expected 1 ignored on chat:c:b, got %+v (%v)", res, err)
+	}
+	if got := first(); got != "chat:c:a" {
+		t.Errorf("Expected the used message first, got %s", got)
+	}
+
+	if _, err := Feedback(env, FeedbackRequest{Namespace: "ns", ChunkID: &a, Signal: "meh"}); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error for an unknown signal, got %v", err)
+	}
+	missing := uint64(999)
+	if _, err := Feedback(env, FeedbackRequest{Namespace: "ns", ChunkID: &missing, Signal: "used"}); KindOf(err) != NotFound {
+		t.Errorf("Expected not found for a missing chunk, got %v", err)
+	}
+}
+
+func TestRetrieveTimeWindow(t *testing.T) {
+	env := newEnv(t)
+	for _, m := range []struct{ id, ts string }{
+		{"old", "2024-01-01T10:00:00Z"},
+		{"new", "2024-01-01T12:00:00Z"},
+	} {
+		if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+			Namespace: "ns", ConversationID: "c", MessageID: m.id, Role: "user",
+			Content: m.id, Vector: types.Vector{1, 0}, TimestampUTC: m.ts,
+		}); err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+	}
+
+	docs := func(req RetrieveRequest) []string {
+		t.Helper()
+		req.Namespace, req.Query = "ns", types.Vector{1, 0}
+		res, err := Retrieve(context.Background(), env, req)
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		var out []string
+		for _, c := range res.Chunks {
+			out = append(out, c.Chunk.DocID)
+		}
+		return out
+	}
+
+	if got := docs(RetrieveRequest{After: "2024-01-01T11:00:00Z"}); len(got) != 1 || got[0] != "chat:c:new" {
+		t.Errorf("Expected only the newer message after 11:00, got %v", got)
+	}
+	if got := docs(RetrieveRequest{Before: "2024-01-01T12:00:00Z"}); len(got) != 1 || got[0] != "chat:c:old" {
+		t.Errorf("Expected only the older message before 12:00, got %v", got)
+	}
+	if got := docs(RetrieveRequest{After: "2024-01-01T09:00:00+01:00", Before: "2024-01-01T13:00:00Z"}); len(got) != 2 {
+		t.Errorf("Expected both messages in the window, got %v", got)
+	}
+
+	if _, err := Retrieve(context.Background(), env, RetrieveRequest{Query: types.Vector{1, 0}, After: "last hour"}); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error for a malformed bound, got %v", err)
+	}
+	if _, err := Retrieve(context.Background(), env, RetrieveRequest{Query: types.Vector{1, 0},
+		After: "2024-01-02T00:00:00Z", Before: "2024-01-01T00:00:00Z"}); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error for an empty window, got %v", err)
+	}
+}
+
+func TestRetrieveConversation(t *testing.T) {
+	env := newEnv(t)
+	for _, conv := range []string{"c1", "c2"} {
+		if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+			Namespace: "ns", ConversationID: conv, MessageID: "m", Role: "user",
+			Content: "hi from " + conv, Vector: types.Vector{1, 0},
+		}); err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+	}
+
+	res, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", ConversationID: "c2", Query: types.Vector{1, 0}})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(res.Chunks) != 1 || res.Chunks[0].Chunk.DocID != "chat:c2:m" {
+		t.Errorf("Expected only conversation c2, got %+v", res.Chunks)
+	}
+
+	res, err = Retrieve(context.Background(), env, RetrieveRequest{Namespace: "other", ConversationID: "c2", Query: types.Vector{1, 0}})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(res.Chunks) != 0 {
+		t.Errorf("Expected namespace and conversation filters to combine, got %+v", res.Chunks)
+	}
+}
+
+func TestPinnedContext(t *testing.T) {
+	env := newEnv(t)
+	note, err := IngestDocument(context.Background(), env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "ARCHITECTURE.md", Content: "layers",
+		Vector: types.Vector{0, 1}, StartLine: 1, EndLine: 1,
+	})
+	if err != nil {
+		t.Fatalf("IngestDocument failed: %v", err)
+	}
+	if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c", MessageID: "m", Role: "user",
+		Content: "close match", Vector: types.Vector{1, 0},
+	}); err != nil {
+		t.Fatalf("IngestMessage failed: %v", err)
+	}
+
+	if _, err := Pin(env, PinRequest{Namespace: "ns"}); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error without a target, got %v", err)
+	}
+	if _, err := Pin(env, PinRequest{Namespace: "ns", DocID: "missing"}); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error for a missing document, got %v", err)
+	}
+	if _, err := Pin(env, PinRequest{Namespace: "ns", DocID: note.DocID, Note: "always"}); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	pins, err := ListPins(env, "ns")
+	if err != nil || len(pins) != 1 || pins[0].Note != "always" {
+		t.Fatalf("Unexpected pins: %+v (%v)", pins, err)
+	}
+
+	// "layers" counts as 1 token and "close match" as 2, so a budget of 2
+	// fits one of them: the pin wins even though the message is closer.
+	res, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, MaxTokens: 2})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(res.Chunks) != 1 || !res.Chunks[0].Pinned || res.Chunks[0].Chunk.DocID != note.DocID || !res.Truncated {
+		t.Errorf("Expected only the pinned chunk, got %+v", res)
+	}
+
+	found, err := Unpin(env, PinRequest{Namespace: "ns", DocID: note.DocID})
+	if err != nil || !found {
+		t.Fatalf("Unpin failed: found=%v err=%v", found, err)
+	}
+	res, err = Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, MaxTokens: 2})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(res.Chunks) != 1 || res.Chunks[0].Pinned || res.Chunks[0].Chunk.DocID != "chat:c:m" {
+		t.Errorf("Expected the closest message after unpinning, got %+v", res)
+	}
+}
+
+func TestRetrieveExclusions(t *testing.T) {
+	env := newEnv(t)
+	doc, err := IngestDocument(context.Background(), env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "open.go", Content: "package open",
+		Vector: types.Vector{1, 0}, StartLine: 1, EndLine: 1,
+	})
+	if err != nil {
+		t.Fatalf("IngestDocument failed: %v", err)
+	}
+	msg, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c", MessageID: "m", Role: "user",
+		Content: "about open.go", Vector: types.Vector{1, 0},
+	})
+	if err != nil {
+		t.Fatalf("IngestMessage failed: %v", err)
+	}
+	if _, err := Pin(env, PinRequest{Namespace: "ns", DocID: doc.DocID}); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+
+	res, err := Retrieve(context.Background(), env, RetrieveRequest{
+		Namespace: "ns", Query: types.Vector{1, 0}, ExcludeDocIDs: []string{doc.DocID},
+	})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(res.Chunks) != 1 || res.Chunks[0].Chunk.DocID != msg.DocID {
+		t.Errorf("Expected the excluded (pinned) document to be omitted, got %+v", res.Chunks)
+	}
+
+	res, err = Retrieve(context.Background(), env, RetrieveRequest{
+		Namespace: "ns", Query: types.Vector{1, 0}, ExcludeChunkIDs: []uint64{msg.ChunkID},
+	})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(res.Chunks) != 1 || res.Chunks[0].Chunk.DocID != doc.DocID {
+		t.Errorf("Expected the excluded chunk to be omitted, got %+v", res.Chunks)
+	}
+}
+
+func TestContextFormats(t *testing.T) {
+	env := newEnv(t)
+	if _, err := IngestDocument(context.Background(), env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "internal/api/server.go", Content: "func main() {}\n",
+		Vector: types.Vector{1, 0}, StartLine: 10, EndLine: 12,
+	}); err != nil {
+		t.Fatalf("IngestDocument failed: %v", err)
+	}
+	if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c", MessageID: "m", Role: "user",
+		Content: "use ```fences```", Vector: types.Vector{0.9, 0.1},
+	}); err != nil {
+		t.Fatalf("IngestMessage failed: %v", err)
+	}
+
+	if _, err := Context(context.Background(), env, ContextRequest{Format: "xml", RetrieveRequest: RetrieveRequest{Query: types.Vector{1, 0}}}); KindOf(err) != Invalid {
+		t.Errorf("Expected invalid error for an unknown format, got %v", err)
+	}
+
+	res, err := Context(context.Background(), env, ContextRequest{RetrieveRequest: RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}}})
+	if err != nil {
+		t.Fatalf("Context failed: %v", err)
+	}
+	if res.Format != FormatMarkdown || len(res.Sources) != 2 {
+		t.Fatalf("Expected 2 markdown sources, got %+v", res)
+	}
+	for _, want := range []string{"### internal/api/server.go:10-12\n```go\nfunc main() {}\n```\n", "### user @ ", "use ```fences```"} {
+		if !strings.Contains(res.Context, want) {
+			t.Errorf("Expected context to contain %q, got:\n%s", want, res.Context)
+		}
+	}
+	if res.Sources[0].Content != "" {
+		t.Errorf("Markdown sources should not repeat the content")
+	}
+
+	res, err = Context(context.Background(), env, ContextRequest{Format: FormatJSON, RetrieveRequest: RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}}})
+	if err != nil {
+		t.Fatalf("Context failed: %v", err)
+	}
+	if res.Context != "" || res.Sources[0].Path != "internal/api/server.go" || res.Sources[0].Content == "" {
+		t.Errorf("Expected JSON sources with paths and content, got %+v", res)
+	}
+}
+
+func TestTagFilteredRetrieval(t *testing.T) {
+	env := newEnv(t)
+	ingest := func(id string, tags ...string) {
+		t.Helper()
+		if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+			Namespace: "ns", ConversationID: "c", MessageID: id, Role: "user",
+			Content: id, Vector: types.Vector{1, 0}, Tags: tags,
+		}); err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+	}
+	ingest("decision", "Decision", " architecture ")
+	ingest("bug", "bug")
+	ingest("plain")
+
+	docs := func(req RetrieveRequest) string {
+		t.Helper()
+		req.Namespace, req.Query = "ns", types.Vector{1, 0}
+		res, err := Retrieve(context.Background(), env, req)
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		var ids []string
+		for _, sc := range res.Chunks {
+			ids = append(ids, sc.Chunk.Content)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	if got := docs(RetrieveRequest{TagsAny: []string{"bug", "DECISION"}}); got != "bug,decision" {
+		t.Errorf("tags_any = %q", got)
+	}
+	if got := docs(RetrieveRequest{TagsAll: []string{"decision", "architecture"}}); got != "decision" {
+		t.Errorf("tags_all = %q", got)
+	}
+	if got := docs(RetrieveRequest{TagsAll: []string{"decision", "bug"}}); got != "" {
+		t.Errorf("tags_all with disjoint tags = %q", got)
+	}
+
+	res, err := SetTags(env, TagsRequest{Namespace: "ns", DocID: "chat:c:plain", Add: []string{"bug"}})
+	if err != nil || strings.Join(res.Tags, ",") != "bug" {
+		t.Fatalf("SetTags add = %+v, %v", res, err)
+	}
+	if _, err := SetTags(env, TagsRequest{Namespace: "ns", DocID: "chat:c:bug", Tags: []string{}}); err != nil {
+		t.Fatalf("SetTags clear failed: %v", err)
+	}
+	if got := docs(RetrieveRequest{TagsAny: []string{"bug"}}); got != "plain" {
+		t.Errorf("tags_any after retagging = %q", got)
+	}
+	res, err = SetTags(env, TagsRequest{Namespace: "ns", DocID: "chat:c:decision", Remove: []string{"architecture"}})
+	if err != nil || strings.Join(res.Tags, ",") != "decision" {
+		t.Errorf("SetTags remove = %+v, %v", res, err)
+	}
+
+	if _, err := SetTags(env, TagsRequest{Namespace: "ns", DocID: "missing", Add: []string{"x"}}); KindOf(err) != NotFound {
+		t.Errorf("Expected NotFound for a missing document, got %v", err)
+	}
+	if _, err := SetTags(env, TagsRequest{Namespace: "ns", DocID: "chat:c:bug"}); KindOf(err) != Invalid {
+		t.Errorf("Expected Invalid for an empty edit, got %v", err)
+	}
+}
+
+func TestUpdateDocument(t *testing.T) {
+	env := newEnv(t)
+	msg, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c", MessageID: "m", Role: "user",
+		Content: "crash on save", Vector: types.Vector{1, 0}, TimestampUTC: "2024-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("IngestMessage failed: %v", err)
+	}
+
+	res, err := UpdateDocument(env, UpdateDocumentRequest{
+		Namespace: "ns", DocID: msg.DocID, Timestamp: "2024-06-01T00:00:00Z",
+		Metadata: types.Metadata{"issue": "https://example.com/issues/7", "resolved": true, "role": nil},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDocument failed: %v", err)
+	}
+	md := res.Document.Metadata
+	if md["issue"] != "https://example.com/issues/7" || md["resolved"] != true || md["role"] != nil || md["conversation_id"] != "c" {
+		t.Errorf("Unexpected merged metadata %v", md)
+	}
+	if got := res.Document.Timestamp.Format(time.RFC3339); got != "2024-06-01T00:00:00Z" {
+		t.Errorf("Expected bumped timestamp, got %s", got)
+	}
+
+	// The chunk and its vector are untouched, so the message still retrieves.
+	out, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}})
+	if err != nil || len(out.Chunks) != 1 || out.Chunks[0].Chunk.ID != msg.ChunkID {
+		t.Errorf("Expected the updated document to retrieve as before, got %+v, %v", out, err)
+	}
+
+	if _, err := UpdateDocument(env, UpdateDocumentRequest{Namespace: "ns", DocID: "missing", Touch: true}); KindOf(err) != NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+	if _, err := UpdateDocument(env, UpdateDocumentRequest{Namespace: "ns", DocID: msg.DocID}); KindOf(err) != Invalid {
+		t.Errorf("Expected Invalid for an empty update, got %v", err)
+	}
+}
+
+func TestGetDocumentAndChunk(t *testing.T) {
+	env := newEnv(t)
+	ing, err := Ingest(context.Background(), env, IngestRequest{
+		Namespace: "ns",
+		Document:  types.Document{ID: "main.go", Source: "main.go"},
+		Chunks: []IngestChunk{
+			{DocID: "main.go", Content: "func b() {}", Vector: types.Vector{0, 1}, StartLine: 10, EndLine: 12, TokenCount: 4},
+			{DocID: "main.go", Content: "package main", Vector: types.Vector{1, 0}, StartLine: 1, EndLine: 1, TokenCount: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	doc, err := GetDocument(env, GetDocumentRequest{Namespace: "ns", DocID: "main.go"})
+	if err != nil {
+		t.Fatalf("GetDocument failed: %v", err)
+	}
+	if doc.Namespace != "ns" || doc.TokenCount != 6 || len(doc.Chunks) != 2 || doc.Chunks[0].Content != "package main" {
+		t.Errorf("Expected both chunks in line order, got %+v", doc)
+	}
+
+	chunk, err := GetChunk(env, GetChunkRequest{Namespace: "ns", ChunkID: ing.ChunkIDs[0]})
+	if err != nil {
+		t.Fatalf("GetChunk failed: %v", err)
+	}
+	if chunk.Chunk.Content != "func b() {}" || chunk.Chunk.StartLine != 10 || chunk.Namespace != "ns" || chunk.Document == nil || chunk.Document.ID != "main.go" {
+		t.Errorf("Unexpected chunk result %+v", chunk)
+	}
+
+	if _, err := GetDocument(env, GetDocumentRequest{Namespace: "ns", DocID: "missing"}); KindOf(err) != NotFound {
+		t.Errorf("Expected NotFound for a missing document, got %v", err)
+	}
+	if _, err := GetChunk(env, GetChunkRequest{Namespace: "ns", ChunkID: 999}); KindOf(err) != NotFound {
+		t.Errorf("Expected NotFound for a missing chunk, got %v", err)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	env := newEnv(t)
+	ingest := func(ns, id string, vecs ...types.Vector) []uint64 {
+		t.Helper()
+		req := IngestRequest{Namespace: ns, Document: types.Document{ID: id, Source: id}}
+		for i, v := range vecs {
+			req.Chunks = append(req.Chunks, IngestChunk{DocID: id, Content: id, Vector: v, StartLine: i})
+		}
+		res, err := Ingest(context.Background(), env, req)
+		if err != nil {
+			t.Fatalf("Ingest %s failed: %v", id, err)
+		}
+		return res.ChunkIDs
+	}
+	ids := ingest("ns", "a.go", types.Vector{1, 0}, types.Vector{0.8, 0.2})
+	ingest("ns", "near.go", types.Vector{0.9, 0.1})
+	ingest("ns", "far.go", types.Vector{0, 1})
+	ingest("other", "other.go", types.Vector{0.9, 0.1})
+
+	res, err := Similar(context.Background(), env, SimilarRequest{Namespace: "ns", DocID: "a.go"})
+	if err != nil {
+		t.Fatalf("Similar failed: %v", err)
+	}
+	var got []string
+	for _, d := range res.Documents {
+		got = append(got, d.Document.ID)
+	}
+	if res.Vectors != 2 || strings.Join(got, ",") != "near.go,far.go" {
+		t.Errorf("Expected near.go then far.go from 2 averaged vectors, got %v (%d vectors)", got, res.Vectors)
+	}
+
+	// A chunk query leaves out its own document too.
+	res, err = Similar(context.Background(), env, SimilarRequest{Namespace: "ns", ChunkID: &ids[0], Limit: 1})
+	if err != nil {
+		t.Fatalf("Similar by chunk failed: %v", err)
+	}
+	if res.DocID != "a.go" || len(res.Documents) != 1 || res.Documents[0].Document.ID != "near.go" {
+		t.Errorf("Expected near.go for chunk %d, got %+v", ids[0], res)
+	}
+
+	if _, err := Similar(context.Background(), env, SimilarRequest{DocID: "a.go", ChunkID: &ids[0]}); KindOf(err) != Invalid {
+		t.Errorf("Expected Invalid with both doc_id and chunk_id, got %v", err)
+	}
+	if _, err := Similar(context.Background(), env, SimilarRequest{DocID: "missing"}); KindOf(err) != NotFound {
+		t.Errorf("Expected NotFound for a missing document, got %v", err)
+	}
+}
+
+func TestSearchText(t *testing.T) {
+	env := newEnv(t)
+	ingest := func(ns, id, content string, startLine int) {
+		t.Helper()
+		_, err := Ingest(context.Background(), env, IngestRequest{
+			Namespace: ns,
+			Document:  types.Document{ID: id, Source: id},
+			Chunks: []IngestChunk{{
+				DocID: id, Vector: types.Vector{1, 0}, Content: content,
+				StartLine: startLine, EndLine: startLine + strings.Count(content, "\n"),
+			}},
+		})
+		if err != nil {
+			t.Fatalf("Ingest %s failed: %v", id, err)
+		}
+	}
+	ingest("ns", "main.go", "package main\n\nfunc main() {\n\tpanic(\"ErrNoShard: shard missing\")\n}", 10)
+	ingest("ns", "shard.go", "// shard lookup\nvar ErrNoShard = errors.New(\"no shard\")", 1)
+	ingest("other", "other.go", "ErrNoShard lives here too", 1)
+
+	res, err := SearchText(env, SearchTextRequest{Query: "errnoshard", Namespace: "ns"})
+	if err != nil {
+		t.Fatalf("SearchText failed: %v", err)
+	}
+	if res.Total != 2 || res.Scanned != 2 {
+		t.Fatalf("Expected 2 matches of 2 chunks in ns, got %+v", res)
+	}
+	for _, m := range res.Matches {
+		if m.DocID == "main.go" && (m.Line != 13 || m.Snippet != `panic("ErrNoShard: shard missing")` || m.Source != "main.go") {
+			t.Errorf("Unexpected match location %+v", m)
+		}
+	}
+
+	if res, err := SearchText(env, SearchTextRequest{Query: "errnoshard", Namespace: "ns", CaseSensitive: true}); err != nil || res.Total != 0 {
+		t.Errorf("Expected no case-sensitive matches, got %+v, %v", res, err)
+	}
+	res, err = SearchText(env, SearchTextRequest{Query: `Err\w+ =`, Mode: "regex", Namespace: "ns"})
+	if err != nil || res.Total != 1 || res.Matches[0].DocID != "shard.go" || res.Matches[0].Line != 2 {
+		t.Errorf("Expected the regex to match shard.go line 2, got %+v, %v", res, err)
+	}
+
+	// "shard" appears twice in shard.go's shorter chunk, so it ranks first.
+	res, err = SearchText(env, SearchTextRequest{Query: "shard lookup", Mode: "bm25", Namespace: "ns"})
+	if err != nil || res.Total != 2 || res.Matches[0].DocID != "shard.go" || res.Matches[0].Score <= res.Matches[1].Score {
+		t.Errorf("Expected shard.go to rank first under bm25, got %+v, %v", res, err)
+	}
+
+	if _, err := SearchText(env, SearchTextRequest{Query: "(", Mode: "regex"}); KindOf(err) != Invalid {
+		t.Errorf("Expected Invalid for a bad regex, got %v", err)
+	}
+	if _, err := SearchText(env, SearchTextRequest{Query: "x", Mode: "fuzzy"}); KindOf(err) != Invalid {
+		t.Errorf("Expected Invalid for an unknown mode, got %v", err)
+	}
+	if _, err := SearchText(env, SearchTextRequest{}); KindOf(err) != Invalid {
+		t.Errorf("Expected Invalid for an empty query, got %v", err)
+	}
+}
+
+func TestCLIFsckDoctor(t *testing.T) {
+	dir := t.TempDir()
+	vecPath := filepath.Join(dir, "vectors.bin")
+	vecs, err := storage.NewMmapVectorStore(vecPath, 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	var out bytes.Buffer
+	cli := &CLI{DataDir: dir, Dim: 2, Vectors: vecs, Meta: meta, Out: &out}
+	ctx := context.Background()
+	for _, in := range []string{
+		`{"namespace":"ns","conversation_id":"c","message_id":"m1","role":"user","content":"one","vector":[1,0]}`,
+		`{"namespace":"ns","conversation_id":"c","message_id":"m2","role":"user","content":"two","vector":[0,1]}`,
+	} {
+		if err := cli.Run(ctx, "ingest_message", []byte(in)); err != nil {
+			t.Fatalf("ingest_message failed: %v", err)
+		}
+	}
+	vecs.Close()
+	meta.Close()
+
+	// stats, fsck and doctor open the stores themselves.
+	cli = &CLI{DataDir: dir, Dim: 2, Out: &out}
+	out.Reset()
+	if err := cli.Run(ctx, "stats", nil); err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	var stats StatsResult
+	if err := json.Unmarshal(out.Bytes(), &stats); err != nil || stats.Vectors != 2 || stats.Chunks != 2 || stats.Documents != 2 || len(stats.Namespaces) != 1 {
+		t.Errorf("Unexpected stats output %q (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := cli.Run(ctx, "fsck", nil); err != nil {
+		t.Fatalf("Expected a clean fsck, got %v: %s", err, out.String())
+	}
+
+	// Cut the file after the first vector: the header still counts two.
+	if err := os.Truncate(vecPath, storage.HeaderSize+2*4); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := cli.Run(ctx, "fsck", nil); !errors.Is(err, ErrProblemsFound) {
+		t.Fatalf("Expected ErrProblemsFound, got %v", err)
+	}
+	var res FsckResult
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil || len(res.Issues) != 1 || res.Issues[0].Check != CheckTornTail {
+		t.Fatalf("Expected one torn_tail issue, got %s (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := cli.Run(ctx, "doctor", []byte(`{"fix":true}`)); !errors.Is(err, ErrProblemsFound) {
+		t.Fatalf("Expected the lost vector to remain a problem, got %v", err)
+	}
+	res = FsckResult{}
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Repaired) != 1 || len(res.Issues) != 1 || res.Issues[0].Check != CheckChunkWithoutVector || res.Issues[0].Fix == "" {
+		t.Errorf("Expected the tail truncated and the chunk past it reported, got %s", out.String())
+	}
+	if c, err := storage.CheckVectorFile(vecPath, 2); err != nil || c.Count != 1 {
+		t.Errorf("Expected the header count lowered to 1, got %+v %v", c, err)
+	}
+}
+
+func TestCLIRetrieveFormats(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer vecs.Close()
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer meta.Close()
+
+	var out bytes.Buffer
+	cli := &CLI{DataDir: dir, Dim: 2, Vectors: vecs, Meta: meta, Out: &out, ContentLines: 2}
+	ctx := context.Background()
+	in := `{"namespace":"ns","conversation_id":"c","message_id":"m","role":"user","content":"one\ntwo\nthree\nfour","vector":[1,0]}`
+	if err := cli.Run(ctx, "ingest_message", []byte(in)); err != nil {
+		t.Fatalf("ingest_message failed: %v", err)
+	}
+
+	for format, want := range map[string][]string{
+		FormatTable:    {"SIM", "1.000", "chat:c:m", "| one", "| two", "… 2 more lines", "1 chunks"},
+		FormatMarkdown: {"### 1.", "similarity 1.000", "```\none\ntwo\n```", "_… 2 more lines_"},
+	} {
+		out.Reset()
+		cli.Format = format
+		if err := cli.Run(ctx, "retrieve", []byte(`{"namespace":"ns","query":[1,0]}`)); err != nil {
+			t.Fatalf("retrieve -format %s failed: %v", format, err)
+		}
+		for _, s := range want {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("Expected %q in -format %s output, got:\n%s", s, format, out.String())
+			}
+		}
+		if strings.Contains(out.String(), "three") || strings.Contains(out.String(), "\x1b[") {
+			t.Errorf("Expected truncated, uncolored -format %s output, got:\n%s", format, out.String())
+		}
+	}
+}
+
+// lengthEmbedder maps every text to a 2-d vector derived from its length.
+type lengthEmbedder struct{}
+
+func (lengthEmbedder) Name() string { return "fake" }
+func (lengthEmbedder) Dim() int     { return 2 }
+func (lengthEmbedder) Embed(_ context.Context, texts []string) ([]types.Vector, error) {
+	out := make([]types.Vector, len(texts))
+	for i, t := range texts {
+		out[i] = types.Vector{float32(len(t)), 1}
+	}
+	return out, nil
+}
+
+func TestCLIIngestJSONL(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer vecs.Close()
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer meta.Close()
+
+	file := filepath.Join(dir, "dump.jsonl")
+	dump := strings.Join([]string{
+		`{"document":{"id":"a"},"chunks":[{"doc_id":"a","content":"embed me"},{"doc_id":"a","content":"given","vector":[0,1]}]}`,
+		``,
+		`{"document":{"id":"b"},"chunks":[{"doc_id":"b","content":"too","vector":[1,2,3]}]}`,
+		`not json`,
+		`{"namespace":"other","document":{"id":"c"},"chunks":[{"doc_id":"c","content":"three"}]}`,
+	}, "\n")
+	if err := os.WriteFile(file, []byte(dump), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	cli := &CLI{DataDir: dir, Dim: 2, Vectors: vecs, Meta: meta, Embedder: lengthEmbedder{}, Namespace: "ns", File: file, Workers: 3, Out: &out}
+	err = cli.Run(context.Background(), "ingest_jsonl", nil)
+	if err == nil {
+		t.Fatalf("Expected an error for the failed lines")
+	}
+	var res IngestJSONLResult
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatalf("Unexpected output %q: %v", out.String(), err)
+	}
+	if res.Lines != 4 || res.Documents != 2 || res.Chunks != 3 || res.Embedded != 2 || res.Errors != 2 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if res.ErrorFile != file+".errors.jsonl" {
+		t.Fatalf("Expected the default error file, got %q", res.ErrorFile)
+	}
+	report, err := os.ReadFile(res.ErrorFile)
+	if err != nil {
+		t.Fatalf("Failed to read error report: %v", err)
+	}
+	var failed []int
+	for _, line := range strings.Split(strings.TrimSpace(string(report)), "\n") {
+		var e jsonlError
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Error == "" {
+			t.Fatalf("Unexpected error report line %q (%v)", line, err)
+		}
+		failed = append(failed, e.Line)
+	}
+	sort.Ints(failed)
+	if len(failed) != 2 || failed[0] != 3 || failed[1] != 4 {
+		t.Errorf("Expected lines 3 and 4 to fail, got %v", failed)
+	}
+
+	if doc, err := meta.GetDocument("a"); err != nil || doc.Metadata["namespace"] != "ns" {
+		t.Errorf("Expected document a in the default namespace, got %+v (%v)", doc, err)
+	}
+	if doc, err := meta.GetDocument("c"); err != nil || doc.Metadata["namespace"] != "other" {
+		t.Errorf("Expected document c in its own namespace, got %+v (%v)", doc, err)
+	}
+}
+
+func TestIngestScrubs(t *testing.T) {
+	env := newEnv(t)
+	rules, err := scrub.Builtin("emails")
+	if err != nil {
+		t.Fatalf("Builtin failed: %v", err)
+	}
+	env.Scrub = scrub.Chain{rules}
+
+	res, err := Ingest(context.Background(), env, IngestRequest{
+		Namespace: "ns",
+		Document:  types.Document{ID: "d1", Source: "a.txt"},
+		Chunks: []IngestChunk{
+			{DocID: "d1", Content: "write to alice@example.com", Vector: types.Vector{1, 0}},
+			{DocID: "d1", Content: "nothing here", Vector: types.Vector{0, 1}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if res.Scrubbed == nil || res.Scrubbed.Chunks != 1 || res.Scrubbed.Total() != 1 {
+		t.Errorf("Expected one redaction reported, got %+v", res.Scrubbed)
+	}
+	sh, _ := env.Resolve("ns")
+	c, err := sh.Meta.GetChunk(res.ChunkIDs[0])
+	if err != nil || c.Content != "write to [REDACTED:email]" {
+		t.Errorf("Expected redacted content stored, got %+v %v", c, err)
+	}
+
+	msg, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c", Role: "user", Content: "I am bob@example.org", Vector: types.Vector{1, 1},
+	})
+	if err != nil || msg.Scrubbed.Total() != 1 {
+		t.Fatalf("Expected the message scrubbed, got %+v %v", msg, err)
+	}
+	if c, _ := sh.Meta.GetChunk(msg.ChunkID); c.Content != "I am [REDACTED:email]" {
+		t.Errorf("Expected redacted message stored, got %q", c.Content)
+	}
+}
+
+func TestRetrieveTimeout(t *testing.T) {
+	env := newEnv(t)
+	if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+		Namespace: "ns", ConversationID: "c", Role: "user", Content: "hello", Vector: types.Vector{1, 0},
+	}); err != nil {
+		t.Fatalf("IngestMessage failed: %v", err)
+	}
+
+	env.SearchTimeout = time.Nanosecond
+	_, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}})
+	var ie *engine.Interrupted
+	if KindOf(err) != Timeout || !errors.As(err, &ie) || !strings.HasPrefix(Message(err), "search timed out after") {
+		t.Errorf("Expected a search timeout, got %v", err)
+	}
+
+	env.SearchTimeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{0, 1}}); KindOf(err) != Timeout || !strings.Contains(Message(err), "canceled") {
+		t.Errorf("Expected a canceled search, got %v", err)
+	}
+	if res, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}}); err != nil || len(res.Chunks) != 1 {
+		t.Errorf("Expected the search to succeed without a deadline, got %+v %v", res, err)
+	}
+}
+
+func TestRetrieveVisitBudget(t *testing.T) {
+	env := newEnv(t)
+	for i, v := range []types.Vector{{1, 0}, {0, 1}, {1, 1}} {
+		if _, err := IngestMessage(context.Background(), env, IngestMessageRequest{
+			Namespace: "ns", ConversationID: "c", Role: "user", Content: fmt.Sprint("message ", i), Vector: v,
+		}); err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+	}
+	res, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, MaxVisits: 1})
+	if err != nil || !res.Partial || len(res.Chunks) != 1 {
+		t.Errorf("Expected one partial result, got %+v %v", res, err)
+	}
+	res, err = Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}})
+	if err != nil || res.Partial || len(res.Chunks) != 3 {
+		t.Errorf("Expected every message within the default budget, got %+v %v", res, err)
+	}
+	if _, err := Retrieve(context.Background(), env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, SearchBudgetMS: -1}); KindOf(err) != Invalid {
+		t.Errorf("Expected a negative budget to be invalid, got %v", err)
+	}
+}
+
+func TestIngestDocumentChunksFailureKeepsOld(t *testing.T) {
+	env := newEnv(t)
+	ctx := context.Background()
+	if _, err := IngestDocument(ctx, env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "a.go", EmbeddingModel: "model-a",
+		Chunks: []IngestChunk{{Content: "old", Vector: types.Vector{1, 0}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace belongs to model-a, so this fails inside the ingest,
+	// after the request itself was accepted.
+	if _, err := IngestDocument(ctx, env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "a.go", EmbeddingModel: "model-b",
+		Chunks: []IngestChunk{{Content: "new", Vector: types.Vector{1, 0}}},
+	}); KindOf(err) != Conflict {
+		t.Fatalf("Expected a model conflict, got %v", err)
+	}
+	out, err := Retrieve(ctx, env, RetrieveRequest{Namespace: "ns", Query: types.Vector{1, 0}, MaxTokens: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Chunks) != 1 || out.Chunks[0].Chunk.Content != "old" {
+		t.Errorf("Expected the old chunk to stay searchable, got %+v", out.Chunks)
+	}
+}
+
+func TestIngestDocumentChunksKeepVersions(t *testing.T) {
+	env := newEnv(t)
+	env.KeepVersions = 1
+	ctx := context.Background()
+	sh, _ := env.Resolve("ns")
+	docID := ids.File("ns", "a.go")
+	ingest := func(content string) IngestResult {
+		t.Helper()
+		res, err := IngestDocument(ctx, env, IngestDocumentRequest{
+			Namespace: "ns", FilePath: "a.go",
+			Chunks: []IngestChunk{{Content: content, Vector: types.Vector{1, 0}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	contents := func(id string) []string {
+		t.Helper()
+		chunks, err := sh.Meta.DocumentChunks(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, c := range chunks {
+			out = append(out, c.Content)
+		}
+		return out
+	}
+
+	// A line-range document of the file is replaced by the whole file.
+	if _, err := IngestDocument(ctx, env, IngestDocumentRequest{
+		Namespace: "ns", FilePath: "a.go", Content: "range", Vector: types.Vector{1, 0}, StartLine: 1, EndLine: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if res := ingest("v1"); res.Replaced != 1 {
+		t.Errorf("Expected the line-range chunk to be replaced, got %+v", res)
+	}
+	if got := contents(ids.Version(ids.FileRange("ns", "a.go", 1, 1), 1)); fmt.Sprint(got) != "[range]" {
+		t.Errorf("Expected the line-range document kept as a prior version, got %v", got)
+	}
+	if v, _ := sh.Engine.FileRanges(docID); len(v) != 0 {
+		t.Errorf("Expected the line ranges to be forgotten, got %q", v)
+	}
+
+	// Changed content keeps the previous version; the same content does not.
+	if res := ingest("v2"); res.Replaced != 1 {
+		t.Errorf("Expected one chunk replaced, got %+v", res)
+	}
+	if got := contents(ids.Version(docID, 1)); fmt.Sprint(got) != "[v1]" {
+		t.Errorf("Expected version 1 to keep its chunk, got %v", got)
+	}
+	ingest("v2")
+	if _, err := sh.Meta.GetDocument(ids.Version(docID, 2)); err == nil {
+		t.Error("Expected unchanged content not to be archived")
+	}
+	ingest("v3")
+	if _, err := sh.Meta.GetDocument(ids.Version(docID, 1)); err == nil {
+		t.Error("Expected version 1 to be pruned beyond KeepVersions")
+	}
+	if got := contents(ids.Version(docID, 2)); fmt.Sprint(got) != "[v2]" {
+		t.Errorf("Expected version 2 to keep its chunk, got %v", got)
+	}
+	doc, err := sh.Meta.GetDocument(docID)
+	if err != nil || engine.DocumentVersion(*doc) != 3 || fmt.Sprint(contents(docID)) != "[v3]" {
+		t.Errorf("Expected the live document at version 3 with v3, got %+v %v", doc, err)
+	}
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"vox-vector-engine/internal/storage"
+)
+
+// Context output formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+	FormatTemplate = "template"
+)
+
+// ContextRequest is a retrieval whose results come back ready to paste into
+// a prompt. Format is "markdown", "json" or "template" (the namespace's
+// context template, see SetTemplate); by default the template when the
+// namespace has one, else markdown.
+type ContextRequest struct {
+	RetrieveRequest
+	Format string `json:"format,omitempty"`
+}
+
+// ContextSource is one retrieved chunk with the location it came from.
+type ContextSource struct {
+	DocID     string  `json:"doc_id"`
+	ChunkID   uint64  `json:"chunk_id"`
+	Path      string  `json:"path"`
+	StartLine int     `json:"start_line,omitempty"`
+	EndLine   int     `json:"end_line,omitempty"`
+	Role      string  `json:"role,omitempty"`
+	Timestamp string  `json:"timestamp,omitempty"`
+	Score     float32 `json:"score"`
+	Pinned    bool    `json:"pinned,omitempty"`
+	Content   string  `json:"content,omitempty"`
+}
+
+// ContextResult carries the formatted block (markdown, template) or the
+// sources with their content (json).
+type ContextResult struct {
+	Format      string          `json:"format"`
+	Context     string          `json:"context,omitempty"`
+	Sources     []ContextSource `json:"sources"`
+	TotalTokens int             `json:"total_tokens"`
+	Truncated   bool            `json:"truncated"`
+	// Partial is set when the index search ran out of its budget.
+	Partial bool `json:"partial,omitempty"`
+	// ModelWarning: see engine.RetrievalResult.ModelWarning.
+	ModelWarning string `json:"model_warning,omitempty"`
+}
+
+// Context embeds, retrieves and packs like Retrieve, then formats the chunks
+// with their file paths and line numbers.
+func Context(ctx context.Context, env Env, req ContextRequest) (*ContextResult, error) {
+	if req.Format != "" && req.Format != FormatMarkdown && req.Format != FormatJSON && req.Format != FormatTemplate {
+		return nil, invalid("format must be markdown, json or template")
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	var tmpl *contextTemplate
+	if req.Format == "" || req.Format == FormatTemplate {
+		t, err := sh.Meta.GetTemplate(req.Namespace)
+		switch {
+		case err == nil:
+			if tmpl, err = parseContextTemplate(*t); err != nil {
+				return nil, &Error{Internal, "Stored context template is invalid", err}
+			}
+			req.Format = FormatTemplate
+		case !errors.Is(err, storage.ErrNotFound):
+			return nil, &Error{Internal, "Failed to read template", err}
+		case req.Format == FormatTemplate:
+			return nil, invalid(fmt.Sprintf("namespace %q has no context template (PUT /templates)", req.Namespace))
+		default:
+			req.Format = FormatMarkdown
+		}
+	}
+	res, err := Retrieve(ctx, env, req.RetrieveRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ContextResult{Format: req.Format, Sources: []ContextSource{}, TotalTokens: res.TotalTokens, Truncated: res.Truncated, Partial: res.Partial, ModelWarning: res.ModelWarning}
+	for _, sc := range res.Chunks {
+		src := ContextSource{
+			DocID:     sc.Chunk.DocID,
+			ChunkID:   sc.Chunk.ID,
+			Path:      sc.Chunk.DocID,
+			StartLine: sc.Chunk.StartLine,
+			EndLine:   sc.Chunk.EndLine,
+			Score:     sc.Similarity,
+			Pinned:    sc.Pinned,
+			Content:   sc.Chunk.Content,
+		}
+		if doc, err := sh.Meta.GetDocument(sc.Chunk.DocID); err == nil {
+			if doc.Source != "" {
+				src.Path = doc.Source
+			}
+			src.Role, _ = doc.Metadata["role"].(string)
+			if src.Role != "" && !doc.Timestamp.IsZero() {
+				src.Timestamp = doc.Timestamp.UTC().Format(time.RFC3339)
+			}
+		}
+		out.Sources = append(out.Sources, src)
+	}
+
+	switch req.Format {
+	case FormatMarkdown:
+		out.Context = FormatMarkdownContext(out.Sources)
+	case FormatTemplate:
+		if out.Context, err = tmpl.render(out.Sources); err != nil {
+			return nil, &Error{Invalid, "Failed to render context template", err}
+		}
+	}
+	if req.Format != FormatJSON {
+		for i := range out.Sources {
+			out.Sources[i].Content = ""
+		}
+	}
+	return out, nil
+}
+
+// FormatMarkdownContext renders sources as headed, fenced blocks:
+//
+//	### internal/api/server.go:10-42
+//	```go
+//	...
+//	```
+//
+// Chat messages are headed by their role and time instead of a path.
+func FormatMarkdownContext(sources []ContextSource) string {
+	var b strings.Builder
+	for i, src := range sources {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("### ")
+		switch {
+		case src.Role != "":
+			b.WriteString(src.Role)
+			if src.Timestamp != "" {
+				b.WriteString(" @ " + src.Timestamp)
+			}
+			b.WriteString(" (" + src.Path + ")")
+		case src.StartLine > 0:
+			fmt.Fprintf(&b, "%s:%d-%d", src.Path, src.StartLine, src.EndLine)
+		default:
+			b.WriteString(src.Path)
+		}
+		if src.Pinned {
+			b.WriteString(" (pinned)")
+		}
+		b.WriteString("\n")
+
+		content := strings.TrimRight(src.Content, "\n")
+		if src.Role != "" {
+			b.WriteString(content + "\n")
+			continue
+		}
+		// A fence longer than any backtick run in the content cannot be
+		// closed early by it.
+		fence := "```"
+		for strings.Contains(content, fence) {
+			fence += "`"
+		}
+		b.WriteString(fence + strings.TrimPrefix(path.Ext(src.Path), ".") + "\n")
+		b.WriteString(content + "\n")
+		b.WriteString(fence + "\n")
+	}
+	return b.String()
+}
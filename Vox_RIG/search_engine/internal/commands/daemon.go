@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"vox-vector-engine/internal/daemon"
+)
+
+// daemonInput is the optional input of stop and uninstall, e.g.
+// {"timeout":"1m"}; the default is daemon.DefaultStopTimeout.
+type daemonInput struct {
+	Timeout string `json:"timeout"`
+}
+
+func parseDaemonInput(input []byte) (time.Duration, error) {
+	var req daemonInput
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &req); err != nil {
+			return 0, invalid("invalid JSON input")
+		}
+	}
+	if req.Timeout == "" {
+		return daemon.DefaultStopTimeout, nil
+	}
+	d, err := time.ParseDuration(req.Timeout)
+	if err != nil || d <= 0 {
+		return 0, invalid("invalid timeout: " + req.Timeout)
+	}
+	return d, nil
+}
+
+// stopDaemon stops the server started with -daemon on DataDir and waits for
+// it to exit.
+func (c *CLI) stopDaemon(input []byte) error {
+	timeout, err := parseDaemonInput(input)
+	if err != nil {
+		return err
+	}
+	pid, err := daemon.Stop(c.DataDir, timeout)
+	if errors.Is(err, daemon.ErrNotRunning) {
+		return c.write(map[string]any{"status": "not_running", "detail": err.Error()})
+	}
+	if err != nil {
+		return fmt.Errorf("stop error: %w", err)
+	}
+	return c.write(map[string]any{"status": "stopped", "pid": pid})
+}
+
+// uninstallDaemon stops the daemon of DataDir and removes its PID file and
+// logs, leaving the data itself alone.
+func (c *CLI) uninstallDaemon(input []byte) error {
+	timeout, err := parseDaemonInput(input)
+	if err != nil {
+		return err
+	}
+	removed, err := daemon.Uninstall(c.DataDir, timeout)
+	if err != nil {
+		return fmt.Errorf("uninstall error: %w", err)
+	}
+	return c.write(map[string]any{"status": "uninstalled", "removed": removed})
+}
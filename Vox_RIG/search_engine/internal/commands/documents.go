@@ -0,0 +1,272 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/types"
+)
+
+// UpdateDocumentRequest edits a stored document without re-ingesting it.
+// Metadata is merged into the document's metadata; a null value removes the
+// key. Touch sets the timestamp to now; Timestamp (RFC3339) sets it
+// explicitly.
+type UpdateDocumentRequest struct {
+	// Namespace locates the document (its shard under -isolate_namespaces).
+	Namespace string         `json:"namespace,omitempty"`
+	DocID     string         `json:"doc_id"`
+	Metadata  types.Metadata `json:"metadata,omitempty"`
+	Touch     bool           `json:"touch,omitempty"`
+	Timestamp string         `json:"timestamp,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+type UpdateDocumentResult struct {
+	Status   string         `json:"status"`
+	Document types.Document `json:"document"`
+}
+
+// UpdateDocument merges req into the stored document. Moving a document to
+// a namespace served by another shard is refused, since its vectors would
+// stay behind. Pins stay with the old namespace.
+func UpdateDocument(env Env, req UpdateDocumentRequest) (*UpdateDocumentResult, error) {
+	if req.DocID == "" {
+		return nil, invalid("doc_id is required")
+	}
+	if len(req.Metadata) == 0 && !req.Touch && req.Timestamp == "" {
+		return nil, invalid("one of metadata, touch and timestamp is required")
+	}
+	if req.Touch && req.Timestamp != "" {
+		return nil, invalid("touch and timestamp are mutually exclusive")
+	}
+	ts := time.Now().UTC()
+	if req.Timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339, req.Timestamp)
+		if err != nil {
+			return nil, invalid("timestamp must be RFC3339")
+		}
+		ts = parsed.UTC()
+	}
+
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	if _, err := sh.Meta.GetDocument(req.DocID); err != nil {
+		return nil, &Error{NotFound, fmt.Sprintf("document %s not found", req.DocID), err}
+	}
+
+	if v, ok := req.Metadata["namespace"]; ok {
+		ns, _ := v.(string)
+		target, err := env.Resolve(ns)
+		if err != nil {
+			return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+		}
+		if target != sh {
+			return nil, invalid("namespace cannot change across isolated namespaces; re-ingest the document instead")
+		}
+	}
+
+	doc, err := sh.Meta.UpdateDocument(req.DocID, func(doc *types.Document) error {
+		if doc.Metadata == nil {
+			doc.Metadata = types.Metadata{}
+		}
+		for k, v := range req.Metadata {
+			if v == nil {
+				delete(doc.Metadata, k)
+			} else {
+				doc.Metadata[k] = v
+			}
+		}
+		if req.Touch || req.Timestamp != "" {
+			doc.Timestamp = ts
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &Error{Internal, "Failed to update document", fmt.Errorf("doc_id=%s: %w", req.DocID, err)}
+	}
+	return &UpdateDocumentResult{Status: "updated", Document: *doc}, nil
+}
+
+// DocumentVersionsRequest names a document whose versions to list.
+type DocumentVersionsRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	DocID     string `json:"doc_id"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// DocumentVersion is one version of a document. ID is the live document ID
+// for the latest version and <doc_id>@v<n> for prior ones.
+type DocumentVersion struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	Latest    bool      `json:"latest"`
+	Timestamp time.Time `json:"timestamp"`
+	Chunks    int       `json:"chunks"`
+}
+
+type DocumentVersionsResult struct {
+	DocID    string            `json:"doc_id"`
+	Latest   int               `json:"latest"`
+	Versions []DocumentVersion `json:"versions"`
+}
+
+// DocumentVersions lists a document and its kept prior versions, newest
+// first. Files are versioned when re-indexed with -keep_versions.
+func DocumentVersions(env Env, req DocumentVersionsRequest) (*DocumentVersionsResult, error) {
+	if req.DocID == "" {
+		return nil, invalid("doc_id is required")
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	doc, err := sh.Meta.GetDocument(req.DocID)
+	if err != nil {
+		return nil, &Error{NotFound, fmt.Sprintf("document %s not found", req.DocID), err}
+	}
+	ns, _ := doc.Metadata["namespace"].(string)
+	docs, err := sh.Engine.DocumentVersions(ns, req.DocID)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to list versions", err}
+	}
+
+	res := &DocumentVersionsResult{DocID: req.DocID, Latest: engine.DocumentVersion(*doc), Versions: []DocumentVersion{}}
+	for _, d := range docs {
+		chunks, err := sh.Meta.DocumentChunks(d.ID)
+		if err != nil {
+			return nil, &Error{Internal, "Failed to list versions", err}
+		}
+		res.Versions = append(res.Versions, DocumentVersion{
+			ID:        d.ID,
+			Version:   engine.DocumentVersion(d),
+			Latest:    d.ID == req.DocID,
+			Timestamp: d.Timestamp,
+			Chunks:    len(chunks),
+		})
+	}
+	return res, nil
+}
+
+// GetDocumentRequest names a stored document to fetch.
+type GetDocumentRequest struct {
+	// Namespace locates the document (its shard under -isolate_namespaces).
+	Namespace string `json:"namespace,omitempty"`
+	DocID     string `json:"doc_id"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// DocumentResult is a stored document with all of its chunks, in line
+// order, so a retrieved snippet can be expanded to the whole file. Access
+// totals the retrieval access log of its chunks; it is absent when none was
+// ever retrieved.
+type DocumentResult struct {
+	Namespace  string             `json:"namespace"`
+	Document   types.Document     `json:"document"`
+	Chunks     []DocumentChunk    `json:"chunks"`
+	TokenCount int                `json:"token_count"`
+	Access     *types.ChunkAccess `json:"access,omitempty"`
+}
+
+// DocumentChunk is a stored chunk with its access log, if it was ever
+// retrieved.
+type DocumentChunk struct {
+	types.Chunk
+	Access *types.ChunkAccess `json:"access,omitempty"`
+}
+
+// GetDocument returns req.DocID and its chunks as stored.
+func GetDocument(env Env, req GetDocumentRequest) (*DocumentResult, error) {
+	if req.DocID == "" {
+		return nil, invalid("doc_id is required")
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	doc, err := sh.Meta.GetDocument(req.DocID)
+	if err != nil {
+		return nil, &Error{NotFound, fmt.Sprintf("document %s not found", req.DocID), err}
+	}
+	chunks, err := sh.Meta.DocumentChunks(req.DocID)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to load chunks", fmt.Errorf("doc_id=%s: %w", req.DocID, err)}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].StartLine < chunks[j].StartLine })
+	ids := make([]uint64, len(chunks))
+	for i, c := range chunks {
+		ids[i] = c.ID
+	}
+	access, err := sh.Engine.ChunkAccess(ids)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to read access log", fmt.Errorf("doc_id=%s: %w", req.DocID, err)}
+	}
+
+	ns, _ := doc.Metadata["namespace"].(string)
+	res := &DocumentResult{Namespace: ns, Document: *doc, Chunks: make([]DocumentChunk, len(chunks))}
+	for i, c := range chunks {
+		res.Chunks[i].Chunk = c
+		res.TokenCount += c.TokenCount
+		if a, ok := access[c.ID]; ok {
+			res.Chunks[i].Access = &a
+			if res.Access == nil {
+				res.Access = &types.ChunkAccess{}
+			}
+			res.Access.Count += a.Count
+			if a.Last.After(res.Access.Last) {
+				res.Access.Last = a.Last
+			}
+		}
+	}
+	return res, nil
+}
+
+// GetChunkRequest names a stored chunk to fetch. Chunk IDs are those of
+// retrieval results; under -isolate_namespaces they are only unique within
+// a namespace, so Namespace must be the one the chunk was retrieved from.
+type GetChunkRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	ChunkID   uint64 `json:"chunk_id"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// ChunkResult is a stored chunk with the document it belongs to and its
+// access log, absent when retrieval never returned it.
+type ChunkResult struct {
+	Namespace string             `json:"namespace"`
+	Chunk     types.Chunk        `json:"chunk"`
+	Document  *types.Document    `json:"document,omitempty"`
+	Access    *types.ChunkAccess `json:"access,omitempty"`
+}
+
+// GetChunk returns req.ChunkID as stored.
+func GetChunk(env Env, req GetChunkRequest) (*ChunkResult, error) {
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	chunk, err := sh.Meta.GetChunk(req.ChunkID)
+	if err != nil {
+		return nil, &Error{NotFound, fmt.Sprintf("chunk %d not found", req.ChunkID), err}
+	}
+	access, err := sh.Engine.ChunkAccess([]uint64{chunk.ID})
+	if err != nil {
+		return nil, &Error{Internal, "Failed to read access log", fmt.Errorf("chunk_id=%d: %w", chunk.ID, err)}
+	}
+	res := &ChunkResult{Chunk: *chunk}
+	if a, ok := access[chunk.ID]; ok {
+		res.Access = &a
+	}
+	if doc, err := sh.Meta.GetDocument(chunk.DocID); err == nil {
+		res.Document = doc
+		res.Namespace, _ = doc.Metadata["namespace"].(string)
+	}
+	return res, nil
+}
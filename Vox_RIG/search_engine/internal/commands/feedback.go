@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// FeedbackRequest reports whether a retrieved chunk helped an agent turn:
+// signal is "used", "ignored" or "harmful". The counts decay into a score
+// that raises or lowers the chunk in later retrievals.
+type FeedbackRequest struct {
+	Namespace string  `json:"namespace,omitempty"`
+	ChunkID   *uint64 `json:"chunk_id"`
+	Signal    string  `json:"signal"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// FeedbackResult is the feedback recorded on the chunk after the request.
+type FeedbackResult struct {
+	ChunkID uint64 `json:"chunk_id"`
+	DocID   string `json:"doc_id"`
+	engine.Feedback
+}
+
+// Feedback records a signal on a chunk.
+func Feedback(env Env, req FeedbackRequest) (*FeedbackResult, error) {
+	if req.ChunkID == nil {
+		return nil, invalid("chunk_id is required")
+	}
+	switch req.Signal {
+	case engine.SignalUsed, engine.SignalIgnored, engine.SignalHarmful:
+	default:
+		return nil, invalid("signal must be used, ignored or harmful")
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	now := time.Now()
+	chunk, err := sh.Meta.UpdateChunk(*req.ChunkID, func(c *types.Chunk) error {
+		md := types.Metadata{}
+		for k, v := range c.Metadata {
+			md[k] = v
+		}
+		var err error
+		c.Metadata, err = engine.AddFeedback(md, req.Signal, now, engine.DefaultFeedbackHalfLife)
+		return err
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, &Error{NotFound, fmt.Sprintf("chunk %d not found", *req.ChunkID), err}
+	}
+	if err != nil {
+		return nil, &Error{Internal, "Failed to record feedback", fmt.Errorf("chunk_id=%d: %w", *req.ChunkID, err)}
+	}
+	return &FeedbackResult{ChunkID: chunk.ID, DocID: chunk.DocID, Feedback: engine.ChunkFeedback(chunk.Metadata)}, nil
+}
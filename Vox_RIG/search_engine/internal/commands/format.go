@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"vox-vector-engine/internal/engine"
+)
+
+// FormatTable is the terminal output of the retrieve command; -format also
+// takes FormatJSON and FormatMarkdown.
+const FormatTable = "table"
+
+// ValidFormat reports whether f is an output format of retrieve; "" means
+// JSON.
+func ValidFormat(f string) bool {
+	switch f {
+	case "", FormatJSON, FormatTable, FormatMarkdown:
+		return true
+	}
+	return false
+}
+
+// UseColor reports whether stdout is a terminal and NO_COLOR
+// (https://no-color.org) is unset, i.e. whether tables may be colorized.
+func UseColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ANSI colors for similarity scores.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+)
+
+// RetrievalView is a retrieval result with what a human needs to judge it:
+// the source of each chunk's document.
+type RetrievalView struct {
+	Result *engine.RetrievalResult
+	// Sources maps document IDs to Document.Source.
+	Sources map[string]string
+	// ContentLines caps the content lines shown per chunk; 0 shows all.
+	ContentLines int
+	Color        bool
+}
+
+// WriteTable writes v as a numbered list of chunks, each with its scores,
+// source and line range followed by its content, indented.
+func (v RetrievalView) WriteTable(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-3s %-6s %-7s %-30s %-11s %s\n", "#", "SIM", "RECENCY", "SOURCE", "LINES", "DOC")
+	for i, sc := range v.Result.Chunks {
+		sim := fmt.Sprintf("%-6.3f", sc.Similarity)
+		if v.Color {
+			sim = similarityColor(sc.Similarity) + sim + ansiReset
+		}
+		doc := sc.Chunk.DocID
+		if sc.Pinned {
+			doc += " (pinned)"
+		}
+		fmt.Fprintf(&b, "%-3d %s %-7.3f %-30s %-11s %s\n", i+1, sim, sc.Recency, v.source(sc.Chunk.DocID), lineRange(sc), doc)
+		lines, more := v.content(sc.Chunk.Content)
+		for _, line := range lines {
+			fmt.Fprintf(&b, "    | %s\n", line)
+		}
+		if more > 0 {
+			note := fmt.Sprintf("    | … %d more lines", more)
+			if v.Color {
+				note = ansiDim + note + ansiReset
+			}
+			b.WriteString(note + "\n")
+		}
+	}
+	b.WriteString(v.summary() + "\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMarkdown writes v as one section per chunk with its content fenced,
+// ready to paste into a bug report or a prompt.
+func (v RetrievalView) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	for i, sc := range v.Result.Chunks {
+		fmt.Fprintf(&b, "### %d. %s", i+1, v.source(sc.Chunk.DocID))
+		if r := lineRange(sc); r != "" {
+			fmt.Fprintf(&b, ":%s", r)
+		}
+		fmt.Fprintf(&b, "\n\nsimilarity %.3f · recency %.3f · `%s`", sc.Similarity, sc.Recency, sc.Chunk.DocID)
+		if sc.Pinned {
+			b.WriteString(" · pinned")
+		}
+		lines, more := v.content(sc.Chunk.Content)
+		fence := "```"
+		if strings.Contains(sc.Chunk.Content, fence) {
+			fence = "~~~~"
+		}
+		fmt.Fprintf(&b, "\n\n%s\n%s\n%s\n", fence, strings.Join(lines, "\n"), fence)
+		if more > 0 {
+			fmt.Fprintf(&b, "\n_… %d more lines_\n", more)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("_" + v.summary() + "_\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (v RetrievalView) source(docID string) string {
+	if s := v.Sources[docID]; s != "" {
+		return s
+	}
+	return "-"
+}
+
+// content splits s into lines, keeping the first ContentLines, and returns
+// how many were left out.
+func (v RetrievalView) content(s string) ([]string, int) {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if v.ContentLines > 0 && len(lines) > v.ContentLines {
+		return lines[:v.ContentLines], len(lines) - v.ContentLines
+	}
+	return lines, 0
+}
+
+func (v RetrievalView) summary() string {
+	s := fmt.Sprintf("%d chunks, %d tokens", len(v.Result.Chunks), v.Result.TotalTokens)
+	if v.Result.Truncated {
+		s += " (truncated to the token budget)"
+	}
+	if v.Result.Partial {
+		s += " (partial: the search ran out of its budget)"
+	}
+	return s
+}
+
+func lineRange(sc engine.ScoredChunk) string {
+	if sc.Chunk.EndLine <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", sc.Chunk.StartLine, sc.Chunk.EndLine)
+}
+
+func similarityColor(sim float32) string {
+	switch {
+	case sim >= 0.8:
+		return ansiGreen
+	case sim >= 0.5:
+		return ansiYellow
+	default:
+		return ansiRed
+	}
+}
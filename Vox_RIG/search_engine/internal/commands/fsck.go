@@ -0,0 +1,464 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// ErrProblemsFound is returned by fsck and doctor when the data directory
+// has problems left; the report has already been written to the output.
+var ErrProblemsFound = errors.New("problems found")
+
+// maxListed caps the document IDs listed in one issue.
+const maxListed = 10
+
+// storeDir is one set of stores in the data directory: the default stores,
+// a namespace shard (-isolate_namespaces) or a namespace of a model space.
+type storeDir struct {
+	Name string
+	Dir  string
+	Dim  int
+}
+
+// storeDirs lists every set of stores under DataDir that has a metadata
+// file.
+func (c *CLI) storeDirs() ([]storeDir, error) {
+	dirs := []storeDir{{Name: "default", Dir: c.DataDir, Dim: c.Dim}}
+	shards, err := shardDirs(filepath.Join(c.DataDir, "namespaces"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range shards {
+		dirs = append(dirs, storeDir{Name: "namespaces/" + name, Dir: filepath.Join(c.DataDir, "namespaces", name), Dim: c.Dim})
+	}
+
+	modelsRoot := filepath.Join(c.DataDir, "models")
+	models, err := engine.ListModelSpaces(modelsRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, model := range models {
+		sp, err := engine.OpenModelSpace(modelsRoot, model, 0)
+		if err != nil {
+			return nil, err
+		}
+		sp.Shards.Close()
+		shards, err := shardDirs(filepath.Join(modelsRoot, model))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range shards {
+			dirs = append(dirs, storeDir{Name: "models/" + model + "/" + name, Dir: filepath.Join(modelsRoot, model, name), Dim: sp.Dim})
+		}
+	}
+	return dirs, nil
+}
+
+// shardDirs returns the subdirectories of root holding a metadata file.
+func shardDirs(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(root, e.Name(), "metadata.db")); e.IsDir() && err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// NamespaceStats counts the records of one namespace.
+type NamespaceStats struct {
+	Documents int `json:"documents"`
+	Chunks    int `json:"chunks"`
+}
+
+// StoreStats describes one set of stores.
+type StoreStats struct {
+	Name      string `json:"name"`
+	Dim       int    `json:"dim"`
+	Vectors   uint64 `json:"vectors"`
+	Documents int    `json:"documents"`
+	Chunks    int    `json:"chunks"`
+	// UnreferencedVectors counts vectors no chunk points at. Deletes,
+	// purges and the trash leave them behind, since vectors files are never
+	// compacted, so they are not a problem by themselves.
+	UnreferencedVectors uint64                    `json:"unreferenced_vectors"`
+	VectorsBytes        int64                     `json:"vectors_bytes"`
+	MetadataBytes       int64                     `json:"metadata_bytes"`
+	Namespaces          map[string]NamespaceStats `json:"namespaces"`
+}
+
+// StatsResult is the output of the stats command.
+type StatsResult struct {
+	DataDir       string         `json:"data_dir"`
+	Dim           int            `json:"dim"`
+	Vectors       uint64         `json:"vectors"`
+	Documents     int            `json:"documents"`
+	Chunks        int            `json:"chunks"`
+	VectorsBytes  int64          `json:"vectors_bytes"`
+	MetadataBytes int64          `json:"metadata_bytes"`
+	Namespaces    []string       `json:"namespaces"`
+	Stores        []StoreStats   `json:"stores"`
+	Errors        map[string]any `json:"errors,omitempty"`
+}
+
+// Issue is one problem found by fsck. Fix, filled in by doctor, proposes a
+// repair; Auto marks the ones doctor applies with {"fix": true}.
+type Issue struct {
+	Store  string `json:"store"`
+	Check  string `json:"check"`
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+	Auto   bool   `json:"auto,omitempty"`
+}
+
+// Issue checks.
+const (
+	CheckVectorsHeader        = "vectors_header"
+	CheckTornTail             = "torn_tail"
+	CheckMetadata             = "metadata"
+	CheckMetadataIndex        = "metadata_index"
+	CheckChunkWithoutVector   = "chunk_without_vector"
+	CheckChunkWithoutDocument = "chunk_without_document"
+)
+
+// FsckResult is the output of fsck and doctor.
+type FsckResult struct {
+	// Status is "ok" or "problems".
+	Status string       `json:"status"`
+	Stores []StoreStats `json:"stores"`
+	Issues []Issue      `json:"issues"`
+	// Repaired lists what doctor fixed before checking again.
+	Repaired []string `json:"repaired,omitempty"`
+	// Advice lists follow-up steps doctor recommends.
+	Advice []string `json:"advice,omitempty"`
+}
+
+// stats reports counts and sizes of every set of stores in the data
+// directory. Like fsck it opens them read-only itself.
+func (c *CLI) stats() error {
+	dirs, err := c.storeDirs()
+	if err != nil {
+		return fmt.Errorf("stats error: %w", err)
+	}
+	res := StatsResult{DataDir: c.DataDir, Dim: c.Dim, Namespaces: []string{}, Stores: []StoreStats{}}
+	seen := map[string]bool{}
+	for _, sd := range dirs {
+		st, _, err := c.checkStore(sd, false)
+		if err != nil {
+			if res.Errors == nil {
+				res.Errors = map[string]any{}
+			}
+			res.Errors[sd.Name] = err.Error()
+			continue
+		}
+		res.Vectors += st.Vectors
+		res.Documents += st.Documents
+		res.Chunks += st.Chunks
+		res.VectorsBytes += st.VectorsBytes
+		res.MetadataBytes += st.MetadataBytes
+		for ns := range st.Namespaces {
+			if !seen[ns] {
+				seen[ns] = true
+				res.Namespaces = append(res.Namespaces, ns)
+			}
+		}
+		res.Stores = append(res.Stores, st)
+	}
+	sort.Strings(res.Namespaces)
+	return c.write(res)
+}
+
+// fsck checks every set of stores in the data directory: vectors file
+// headers (magic, dimension, a count the file can hold), that the metadata
+// store opens and its indexes agree with its records, and that every chunk
+// has a vector and a document. It only reads.
+func (c *CLI) fsck() error {
+	res, err := c.runFsck(false)
+	if err != nil {
+		return fmt.Errorf("fsck error: %w", err)
+	}
+	if err := c.write(res); err != nil {
+		return err
+	}
+	if res.Status != "ok" {
+		return ErrProblemsFound
+	}
+	return nil
+}
+
+// doctor runs fsck and proposes a fix for each issue. With {"fix": true} it
+// first applies the fixes that need no judgement (truncating a torn tail,
+// rebuilding metadata indexes), then checks again.
+func (c *CLI) doctor(input []byte) error {
+	var req struct {
+		Fix bool `json:"fix"`
+	}
+	if len(input) > 0 {
+		if err := decode(input, &req); err != nil {
+			return err
+		}
+	}
+	res, err := c.runFsck(true)
+	if err != nil {
+		return fmt.Errorf("doctor error: %w", err)
+	}
+	if req.Fix {
+		var repaired []string
+		for _, is := range res.Issues {
+			if !is.Auto {
+				continue
+			}
+			if err := c.repair(is); err != nil {
+				return fmt.Errorf("doctor error: %s %s: %w", is.Store, is.Check, err)
+			}
+			log.Printf("[doctor] store=%s fixed %s", is.Store, is.Check)
+			repaired = append(repaired, is.Store+": "+is.Fix)
+		}
+		if len(repaired) > 0 {
+			if res, err = c.runFsck(true); err != nil {
+				return fmt.Errorf("doctor error: %w", err)
+			}
+			res.Repaired = repaired
+			// The server rebuilds its in-memory index from the stores on
+			// start, so that is all the index needs.
+			res.Advice = append(res.Advice, "restart the server so its search index is rebuilt from the repaired stores")
+		}
+	}
+	if err := c.write(res); err != nil {
+		return err
+	}
+	if res.Status != "ok" {
+		return ErrProblemsFound
+	}
+	return nil
+}
+
+func (c *CLI) runFsck(propose bool) (FsckResult, error) {
+	dirs, err := c.storeDirs()
+	if err != nil {
+		return FsckResult{}, err
+	}
+	res := FsckResult{Status: "ok", Stores: []StoreStats{}, Issues: []Issue{}}
+	for _, sd := range dirs {
+		st, issues, err := c.checkStore(sd, true)
+		if err == nil {
+			res.Stores = append(res.Stores, st)
+		}
+		res.Issues = append(res.Issues, issues...)
+	}
+	if propose {
+		for i := range res.Issues {
+			proposeFix(&res.Issues[i])
+		}
+		for _, is := range res.Issues {
+			if is.Check == CheckChunkWithoutVector {
+				res.Advice = append(res.Advice, "re-ingest the documents listed under chunk_without_vector; their chunks cannot be retrieved")
+				break
+			}
+		}
+	}
+	if len(res.Issues) > 0 {
+		res.Status = "problems"
+	}
+	return res, nil
+}
+
+func proposeFix(is *Issue) {
+	switch is.Check {
+	case CheckTornTail:
+		is.Fix, is.Auto = "truncate the header count to the vectors the file holds; chunks past it must be re-ingested", true
+	case CheckMetadataIndex:
+		is.Fix, is.Auto = "rebuild the metadata indexes from the records", true
+	case CheckVectorsHeader, CheckMetadata:
+		is.Fix = "restore the latest snapshot (-cmd restore)"
+	case CheckChunkWithoutVector:
+		is.Fix = "delete the listed documents (-cmd delete_document) and ingest them again"
+	case CheckChunkWithoutDocument:
+		is.Fix = "purge the namespace or restore the latest snapshot; retrieval skips these chunks"
+	}
+}
+
+func (c *CLI) repair(is Issue) error {
+	switch is.Check {
+	case CheckTornTail:
+		_, err := storage.TruncateTornTail(is.Path)
+		return err
+	case CheckMetadataIndex:
+		meta, err := c.MetaBackend.Open(is.Path)
+		if err != nil {
+			return err
+		}
+		defer meta.Close()
+		ic, ok := meta.(storage.IndexChecker)
+		if !ok {
+			return nil
+		}
+		return ic.RebuildIndexes()
+	}
+	return nil
+}
+
+// checkStore opens the stores of sd read-only and measures them. With
+// check it also looks for the problems fsck reports; an error means the
+// stores could not be measured at all.
+func (c *CLI) checkStore(sd storeDir, check bool) (StoreStats, []Issue, error) {
+	st := StoreStats{Name: sd.Name, Dim: sd.Dim, Namespaces: map[string]NamespaceStats{}}
+	var issues []Issue
+	report := func(check, path, detail string) {
+		issues = append(issues, Issue{Store: sd.Name, Check: check, Path: path, Detail: detail})
+	}
+
+	files, err := storage.VectorFiles(sd.Dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return st, nil, err
+	}
+	vectorsOK := true
+	for _, path := range files {
+		fc, err := storage.CheckVectorFile(path, sd.Dim)
+		st.VectorsBytes += fc.Bytes
+		switch {
+		case errors.Is(err, storage.ErrTornTail):
+			report(CheckTornTail, path, err.Error())
+			vectorsOK = false
+		case err != nil:
+			report(CheckVectorsHeader, path, err.Error())
+			vectorsOK = false
+		}
+	}
+	if vectorsOK && len(files) > 0 {
+		vecs, err := storage.OpenVectorFiles(sd.Dir, sd.Dim, 0, storage.GrowthPolicy{}, true)
+		if err != nil {
+			report(CheckVectorsHeader, sd.Dir, err.Error())
+			vectorsOK = false
+		} else {
+			st.Vectors = vecs.Count()
+			vecs.Close()
+		}
+	}
+
+	metaPath := filepath.Join(sd.Dir, "metadata.db")
+	if _, err := os.Stat(metaPath); errors.Is(err, os.ErrNotExist) && len(files) == 0 {
+		// A data directory no server has used yet.
+		return st, nil, nil
+	}
+	st.MetadataBytes = fileSize(metaPath) + fileSize(metaPath+"-wal")
+	meta, err := c.MetaBackend.OpenReadOnly(metaPath)
+	if err != nil {
+		if !check {
+			return st, nil, err
+		}
+		report(CheckMetadata, metaPath, err.Error())
+		return st, issues, errors.New("metadata store did not open")
+	}
+	defer meta.Close()
+
+	docNS := map[string]string{}
+	if err := meta.ForEachDocument(func(doc types.Document) error {
+		ns, _ := doc.Metadata["namespace"].(string)
+		docNS[doc.ID] = ns
+		n := st.Namespaces[ns]
+		n.Documents++
+		st.Namespaces[ns] = n
+		return nil
+	}); err != nil {
+		report(CheckMetadata, metaPath, err.Error())
+		return st, issues, err
+	}
+	st.Documents = len(docNS)
+
+	var (
+		refs            = make([]uint64, (st.Vectors+63)/64)
+		referenced      uint64
+		noVector, noDoc int
+		noVectorDocs    = map[string]bool{}
+		noDocIDs        = map[string]bool{}
+	)
+	if err := meta.ForEachChunk(func(ch types.Chunk) error {
+		st.Chunks++
+		ns, ok := docNS[ch.DocID]
+		if !ok {
+			noDoc++
+			noDocIDs[ch.DocID] = true
+		} else {
+			n := st.Namespaces[ns]
+			n.Chunks++
+			st.Namespaces[ns] = n
+		}
+		if ch.ID >= st.Vectors {
+			noVector++
+			noVectorDocs[ch.DocID] = true
+			return nil
+		}
+		if w, bit := ch.ID/64, uint64(1)<<(ch.ID%64); refs[w]&bit == 0 {
+			refs[w] |= bit
+			referenced++
+		}
+		return nil
+	}); err != nil {
+		report(CheckMetadata, metaPath, err.Error())
+		return st, issues, err
+	}
+	st.UnreferencedVectors = st.Vectors - referenced
+
+	if !check {
+		return st, nil, nil
+	}
+	if noVector > 0 && vectorsOK {
+		report(CheckChunkWithoutVector, "", fmt.Sprintf("%d chunks point past the %d stored vectors (documents: %s)", noVector, st.Vectors, listed(noVectorDocs)))
+	}
+	if noDoc > 0 {
+		report(CheckChunkWithoutDocument, "", fmt.Sprintf("%d chunks belong to missing documents (%s)", noDoc, listed(noDocIDs)))
+	}
+	if ic, ok := meta.(storage.IndexChecker); ok {
+		problems, err := ic.CheckIndexes()
+		if err != nil {
+			report(CheckMetadataIndex, metaPath, err.Error())
+		}
+		if len(problems) > 0 {
+			report(CheckMetadataIndex, metaPath, fmt.Sprintf("%d index entries disagree with the records: %s", len(problems), listedStrings(problems)))
+		}
+	}
+	return st, issues, nil
+}
+
+// listed returns up to maxListed of the keys of ids, sorted.
+func listed(ids map[string]bool) string {
+	keys := make([]string, 0, len(ids))
+	for id := range ids {
+		keys = append(keys, id)
+	}
+	sort.Strings(keys)
+	return listedStrings(keys)
+}
+
+func listedStrings(s []string) string {
+	out := fmt.Sprintf("%q", s[:min(len(s), maxListed)])
+	if len(s) > maxListed {
+		out += fmt.Sprintf(" and %d more", len(s)-maxListed)
+	}
+	return out
+}
+
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
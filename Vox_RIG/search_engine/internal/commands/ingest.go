@@ -0,0 +1,832 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/tracing"
+	"vox-vector-engine/internal/types"
+)
+
+// IngestChunk is one embedded chunk sent by a client.
+type IngestChunk struct {
+	DocID      string         `json:"doc_id"`
+	Vector     types.Vector   `json:"vector"`
+	Content    string         `json:"content"`
+	StartLine  int            `json:"start_line"`
+	EndLine    int            `json:"end_line"`
+	TokenCount int            `json:"token_count"`
+	Metadata   types.Metadata `json:"metadata,omitempty"`
+	// Vectors are extra embeddings of the chunk by name, e.g. a code chunk's
+	// docstring or symbol names embedded apart from its body. Each is stored
+	// and indexed on its own and leads searches to the chunk; retrieval
+	// weighs them with vector_weights, Vector going by "content".
+	Vectors map[string]types.Vector `json:"vectors,omitempty"`
+	// Sparse is the chunk's sparse term-weight vector (e.g. from SPLADE),
+	// searched by retrieval's sparse_query.
+	Sparse types.SparseVector `json:"sparse,omitempty"`
+}
+
+type IngestRequest struct {
+	// Namespace is an optional logical partition. If set, it will be copied into
+	// Document.Metadata["namespace"] unless already present.
+	Namespace string         `json:"namespace,omitempty"`
+	Document  types.Document `json:"document"`
+	Chunks    []IngestChunk  `json:"chunks"`
+	// Importance (0..1) is stored on every chunk without an "importance" of
+	// its own; when 0 it is inferred from the metadata and tags (see
+	// engine.InferImportance).
+	Importance float32 `json:"importance,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+	// EmbeddingModel names the model the vectors were made with, e.g.
+	// "openai:text-embedding-3-small". It is stored on the document, the
+	// first one sent to a namespace becomes the namespace's, and vectors or
+	// queries tagged with another are refused (see Env.WarnModelMismatch).
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+
+	// scrubbed is set when the chunks were already scrubbed (before being
+	// embedded), with what that redacted.
+	scrubbed    bool
+	scrubReport *scrub.Report
+}
+
+type IngestResult struct {
+	Status      string   `json:"status"`
+	DocID       string   `json:"doc_id"`
+	ChunkIDs    []uint64 `json:"chunk_ids"`
+	VectorCount uint64   `json:"vector_count"`
+	// Scrubbed reports what the ingest filters redacted from the chunks
+	// (see Env.Scrub); absent when nothing was.
+	Scrubbed *scrub.Report `json:"scrubbed,omitempty"`
+	// Drift warns that the vectors do not look like the ones the namespace
+	// already holds (see engine.ObserveVectors); they were stored anyway.
+	Drift *engine.DriftWarning `json:"drift,omitempty"`
+	// ModelWarning is set when the vectors were stored despite being tagged
+	// with another embedding model than the namespace's.
+	ModelWarning string `json:"model_warning,omitempty"`
+	// Replaced counts the chunks of the file's earlier documents that a
+	// multi-chunk ingest_document replaced, deleting them or keeping them
+	// as a prior version.
+	Replaced int `json:"replaced,omitempty"`
+}
+
+// IngestMessageRequest is a convenience request for chat/memory style ingestion.
+// It ingests exactly one chunk (the message content) and stores namespace + conversation
+// metadata on the Document.
+//
+// Recommended IDs:
+// - namespace: stable project/workspace id (e.g. repo path hash, workspace UUID)
+// - conversation_id: stable chat/thread id
+type IngestMessageRequest struct {
+	Namespace      string       `json:"namespace"`
+	ConversationID string       `json:"conversation_id"`
+	MessageID      string       `json:"message_id,omitempty"` // optional; if empty derived from namespace, conversation and content
+	Role           string       `json:"role"`                 // "user" | "assistant" | "system"
+	Content        string       `json:"content"`
+	Vector         types.Vector `json:"vector"`
+	TokenCount     int          `json:"token_count"`
+	TimestampUTC   string       `json:"timestamp_utc,omitempty"`   // optional RFC3339; if empty now is used
+	Source         string       `json:"source,omitempty"`          // optional; default "chat"
+	Model          string       `json:"model,omitempty"`           // optional embedding space (see IngestRequest.Model)
+	EmbeddingModel string       `json:"embedding_model,omitempty"` // optional model the vector was made with (see IngestRequest.EmbeddingModel)
+	Tags           []string     `json:"tags,omitempty"`            // optional labels (see Document.Tags)
+	Importance     float32      `json:"importance,omitempty"`      // optional 0..1; if 0 inferred from tags (see IngestRequest.Importance)
+}
+
+type IngestMessageResult struct {
+	Status         string `json:"status"`
+	DocID          string `json:"doc_id"`
+	ChunkID        uint64 `json:"chunk_id"`
+	VectorCount    uint64 `json:"vector_count"`
+	MessageID      string `json:"message_id"`
+	ConversationID string `json:"conversation_id"`
+	Namespace      string `json:"namespace"`
+	// Duplicate is set when the message was already stored with the same
+	// content; nothing was written.
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Scrubbed reports what the ingest filters redacted from the content.
+	Scrubbed *scrub.Report `json:"scrubbed,omitempty"`
+	// Drift warns that the vector does not look like the namespace's (see
+	// IngestResult.Drift).
+	Drift *engine.DriftWarning `json:"drift,omitempty"`
+	// ModelWarning: see IngestResult.ModelWarning.
+	ModelWarning string `json:"model_warning,omitempty"`
+	// ShortTerm is set when the message went to its conversation's
+	// short-term buffer (see Env.ShortTerm); it has no chunk ID until it
+	// is stored. Promoted counts the older messages stored to make room.
+	ShortTerm bool `json:"short_term,omitempty"`
+	Promoted  int  `json:"promoted,omitempty"`
+}
+
+// IngestDocumentRequest stores one embedded chunk of a file. The document ID
+// is "file:<namespace>:<file_path>:<start_line>-<end_line>".
+//
+// With Chunks instead of Content and Vector it stores the whole file in one
+// call under the file's document ID, "file:<namespace>:<file_path>", and
+// replaces every chunk stored for the file before, whole-file or by range.
+type IngestDocumentRequest struct {
+	Namespace  string       `json:"namespace"`
+	FilePath   string       `json:"file_path"`
+	Content    string       `json:"content"`
+	Vector     types.Vector `json:"vector"`
+	TokenCount int          `json:"token_count"`
+	StartLine  int          `json:"start_line"`
+	EndLine    int          `json:"end_line"`
+	Model      string       `json:"model,omitempty"`
+	// EmbeddingModel: see IngestRequest.EmbeddingModel.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// Chunks are the file's chunks in file order. One without start_line
+	// starts on the line after the previous chunk ends (line 1 for the
+	// first), and one without end_line ends on the last line of its content.
+	// Line ranges may not overlap.
+	Chunks []IngestChunk `json:"chunks,omitempty"`
+	// ContentHash is the hex SHA-256 of the file, recorded with Chunks as
+	// the document's content_sha256 for change detection; by default the
+	// hash of the chunk contents joined by newlines.
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// SaveDocument applies ns to the document metadata (unless already present),
+// resolves the shard that owns it and stores the document there.
+func SaveDocument(ctx context.Context, env Env, ns string, doc *types.Document) (*engine.Shard, error) {
+	sh, err := resolveDocument(env, ns, doc)
+	if err != nil {
+		return nil, err
+	}
+	_, span := tracing.Start(ctx, "metadata.save_document")
+	err = sh.Meta.SaveDocument(*doc)
+	span.End()
+	if err != nil {
+		return nil, &Error{Internal, "Failed to save document", fmt.Errorf("document id=%s: %w", doc.ID, err)}
+	}
+	return sh, nil
+}
+
+// resolveDocument applies ns to the document metadata (unless already
+// present), normalizes its tags and returns the shard that owns it.
+func resolveDocument(env Env, ns string, doc *types.Document) (*engine.Shard, error) {
+	doc.Tags = NormalizeTags(doc.Tags)
+	if ns != "" {
+		if doc.Metadata == nil {
+			doc.Metadata = types.Metadata{}
+		}
+		if _, exists := doc.Metadata["namespace"]; !exists {
+			doc.Metadata["namespace"] = ns
+		}
+	}
+
+	docNS, _ := doc.Metadata["namespace"].(string)
+	sh, err := env.Resolve(docNS)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", docNS, err)}
+	}
+	return sh, nil
+}
+
+// checkChunkVectors validates every chunk vector before anything is written.
+func checkChunkVectors(env Env, chunks []IngestChunk) error {
+	for i, ic := range chunks {
+		if err := env.checkVector(fmt.Sprintf("chunks[%d].vector", i), ic.Vector); err != nil {
+			return err
+		}
+		for name, v := range ic.Vectors {
+			if name == "" || name == engine.ContentVector {
+				return invalid(fmt.Sprintf("chunks[%d].vectors: %q is not a valid vector name", i, name))
+			}
+			if err := env.checkVector(fmt.Sprintf("chunks[%d].vectors.%s", i, name), v); err != nil {
+				return err
+			}
+		}
+		if err := checkSparse(fmt.Sprintf("chunks[%d].sparse", i), ic.Sparse); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSparse validates a sparse vector: terms must be named and weights
+// positive.
+func checkSparse(field string, v types.SparseVector) error {
+	for term, w := range v {
+		if term == "" {
+			return invalid(field + " has an empty term")
+		}
+		if !(w > 0) || math.IsInf(float64(w), 1) {
+			return invalid(fmt.Sprintf("%s.%s must be a positive weight", field, term))
+		}
+	}
+	return nil
+}
+
+// AppendChunks appends each chunk vector, saves the chunk metadata in one
+// transaction and then links the vectors into the index, enforcing the
+// quotas of the chunks' namespaces. Content is stored as given: run
+// ScrubChunks first. On failure it returns the IDs written so far.
+func AppendChunks(ctx context.Context, env Env, sh *engine.Shard, chunks []IngestChunk) ([]uint64, error) {
+	stored, err := appendVectors(ctx, env, sh, chunks)
+	if err != nil {
+		return chunkIDs(stored), err
+	}
+	_, span := tracing.Start(ctx, "metadata.save_chunks", tracing.Int("chunks", len(stored)))
+	err = sh.Meta.SaveChunks(stored)
+	span.End()
+	if err != nil {
+		return nil, &Error{Internal, "Failed to save chunk metadata", fmt.Errorf("chunks=%d: %w", len(stored), err)}
+	}
+	indexChunks(ctx, sh, stored)
+	byNamespace := map[string][]types.Chunk{}
+	for _, c := range stored {
+		if doc, err := sh.Meta.GetDocument(c.DocID); err == nil {
+			ns, _ := doc.Metadata["namespace"].(string)
+			byNamespace[ns] = append(byNamespace[ns], c)
+		}
+	}
+	for ns, chunks := range byNamespace {
+		observeVectors(sh, ns, chunks)
+		enforceQuota(sh, ns)
+	}
+	return chunkIDs(stored), nil
+}
+
+// observeVectors adds chunks stored in namespace ns to the vector
+// statistics of sh, logging the warning when they drift.
+func observeVectors(sh *engine.Shard, ns string, chunks []types.Chunk) *engine.DriftWarning {
+	w := sh.Engine.ObserveVectors(ns, chunks)
+	if w != nil {
+		log.Printf("[drift] namespace=%s vectors=%d: %s", ns, w.Vectors, w.Message)
+	}
+	return w
+}
+
+// appendVectors validates and appends the chunk vectors (normalized when
+// env.Normalize is set) and returns the chunks to store, with their IDs and
+// token counts filled in. Nothing is written to the metadata store or the
+// index.
+func appendVectors(ctx context.Context, env Env, sh *engine.Shard, chunks []IngestChunk) ([]types.Chunk, error) {
+	out := make([]types.Chunk, 0, len(chunks))
+	if err := checkChunkVectors(env, chunks); err != nil {
+		return out, err
+	}
+	_, span := tracing.Start(ctx, "vectors.append", tracing.Int("vectors", len(chunks)))
+	defer span.End()
+
+	for _, ic := range chunks {
+		ic = prepareChunk(env, ic)
+		id, err := sh.Vectors.Append(ic.Vector)
+		if err != nil {
+			return out, &Error{Internal, "Failed to append vector", fmt.Errorf("doc_id=%s: %w", ic.DocID, err)}
+		}
+		if len(ic.Vectors) > 0 {
+			named, err := appendNamedVectors(env, sh, ic.Vectors)
+			if err != nil {
+				return out, &Error{Internal, "Failed to append vector", fmt.Errorf("doc_id=%s: %w", ic.DocID, err)}
+			}
+			ic.Metadata = engine.WithNamedVectors(ic.Metadata, named)
+		}
+		if len(ic.Sparse) > 0 {
+			ic.Metadata = engine.WithSparse(ic.Metadata, ic.Sparse)
+		}
+
+		out = append(out, types.Chunk{
+			ID:         id,
+			DocID:      ic.DocID,
+			Vector:     ic.Vector,
+			Content:    ic.Content,
+			StartLine:  ic.StartLine,
+			EndLine:    ic.EndLine,
+			TokenCount: ic.TokenCount,
+			Metadata:   ic.Metadata,
+		})
+	}
+	return out, nil
+}
+
+// prepareChunk fills in a missing token count and scales the vector to unit
+// length when env.Normalize is set, as the chunk is to be stored.
+func prepareChunk(env Env, ic IngestChunk) IngestChunk {
+	if ic.TokenCount <= 0 {
+		ic.TokenCount = env.counter().Count(ic.Content)
+	}
+	if env.Normalize {
+		var norm float32
+		ic.Vector, norm = engine.Unit(ic.Vector)
+		ic.Metadata = engine.WithNorm(ic.Metadata, norm)
+	}
+	return ic
+}
+
+// appendNamedVectors appends the extra vectors of a chunk, in name order,
+// and returns their IDs.
+func appendNamedVectors(env Env, sh *engine.Shard, vectors map[string]types.Vector) (map[string]uint64, error) {
+	names := make([]string, 0, len(vectors))
+	for name := range vectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ids := make(map[string]uint64, len(names))
+	for _, name := range names {
+		v := vectors[name]
+		if env.Normalize {
+			v, _ = engine.Unit(v)
+		}
+		id, err := sh.Vectors.Append(v)
+		if err != nil {
+			return ids, fmt.Errorf("vector %q: %w", name, err)
+		}
+		ids[name] = id
+	}
+	return ids, nil
+}
+
+// indexChunks links stored chunks into the index. It runs after their
+// metadata is committed so searches never return an ID without a chunk.
+func indexChunks(ctx context.Context, sh *engine.Shard, chunks []types.Chunk) {
+	_, span := tracing.Start(ctx, "index.add", tracing.Int("vectors", len(chunks)))
+	defer span.End()
+	if err := sh.Engine.LinkNamedVectors(chunks); err != nil {
+		// The chunks still rank by their extra vectors through
+		// vector_weights; only searches that find one first skip it.
+		log.Printf("[ingest] namespace=%s: %v", sh.Namespace, err)
+	}
+	for _, c := range chunks {
+		sh.Index.Add(c.ID, c.Vector)
+	}
+	sh.Engine.IndexNamedVectors(chunks)
+}
+
+// saveDocumentWithChunks writes a document and its chunks in one transaction.
+func saveDocumentWithChunks(ctx context.Context, sh *engine.Shard, doc types.Document, chunks []types.Chunk) error {
+	_, span := tracing.Start(ctx, "metadata.save_document", tracing.Int("chunks", len(chunks)))
+	defer span.End()
+	if err := sh.Meta.SaveDocumentWithChunks(doc, chunks); err != nil {
+		span.RecordError(err)
+		return &Error{Internal, "Failed to save document", fmt.Errorf("document id=%s: %w", doc.ID, err)}
+	}
+	return nil
+}
+
+// checkImportance validates an importance sent by a client.
+func checkImportance(v float32) error {
+	if v < 0 || v > 1 {
+		return invalid("importance must be between 0 and 1")
+	}
+	return nil
+}
+
+// applyImportance stores importance, or else the one inferred from the
+// document, on every chunk that has none; nothing is stored when it is 0.
+func applyImportance(doc types.Document, chunks []types.Chunk, importance float32) {
+	for i := range chunks {
+		if _, ok := chunks[i].Metadata[engine.MetaImportance]; ok {
+			continue
+		}
+		v := importance
+		if v == 0 {
+			v = max(engine.InferImportance(chunks[i].Metadata, doc.Tags), engine.InferImportance(doc.Metadata, nil))
+		}
+		if v == 0 {
+			continue
+		}
+		md := types.Metadata{}
+		for k, val := range chunks[i].Metadata {
+			md[k] = val
+		}
+		md[engine.MetaImportance] = v
+		chunks[i].Metadata = md
+	}
+}
+
+func chunkIDs(chunks []types.Chunk) []uint64 {
+	ids := make([]uint64, len(chunks))
+	for i, c := range chunks {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// Ingest stores a document and its chunks, writing the metadata in one
+// transaction.
+func Ingest(ctx context.Context, env Env, req IngestRequest) (IngestResult, error) {
+	res := IngestResult{Status: "ingested", DocID: req.Document.ID}
+	if err := checkChunkVectors(env, req.Chunks); err != nil {
+		return res, err
+	}
+	if err := checkImportance(req.Importance); err != nil {
+		return res, err
+	}
+	if req.scrubbed {
+		res.Scrubbed = req.scrubReport
+	} else {
+		rep, err := ScrubChunks(ctx, env, req.Chunks)
+		if err != nil {
+			return res, err
+		}
+		res.Scrubbed = rep
+	}
+
+	sh, err := resolveDocument(env, req.Namespace, &req.Document)
+	if err != nil {
+		return res, err
+	}
+	ns, _ := req.Document.Metadata["namespace"].(string)
+	if res.ModelWarning, err = checkModelTag(env, sh, ns, req.EmbeddingModel); err != nil {
+		return res, err
+	}
+	claimTag := tagDocument(sh, ns, req.EmbeddingModel, &req.Document)
+	stored, err := appendVectors(ctx, env, sh, req.Chunks)
+	res.VectorCount = sh.Vectors.Count()
+	if err != nil {
+		return res, err
+	}
+	applyImportance(req.Document, stored, req.Importance)
+	if err := saveDocumentWithChunks(ctx, sh, req.Document, stored); err != nil {
+		return res, err
+	}
+	indexChunks(ctx, sh, stored)
+	claimTag()
+	res.ChunkIDs = chunkIDs(stored)
+	res.Drift = observeVectors(sh, ns, stored)
+	enforceQuota(sh, ns)
+	return res, nil
+}
+
+// IngestMessage stores one chat message as a document with a single chunk.
+// Without a message_id the ID is derived from namespace, conversation and
+// content (ids.MessageID), so retries and repeated sends are idempotent.
+func IngestMessage(ctx context.Context, env Env, req IngestMessageRequest) (IngestMessageResult, error) {
+	res := IngestMessageResult{
+		Status:         "ingested_message",
+		ConversationID: req.ConversationID,
+		Namespace:      req.Namespace,
+	}
+
+	switch {
+	case req.Namespace == "":
+		return res, invalid("namespace is required")
+	case req.ConversationID == "":
+		return res, invalid("conversation_id is required")
+	case req.Role == "":
+		return res, invalid("role is required")
+	case req.Content == "":
+		return res, invalid("content is required")
+	case len(req.Vector) == 0:
+		return res, invalid("vector is required")
+	}
+	if err := env.checkVector("vector", req.Vector); err != nil {
+		return res, err
+	}
+	if err := checkImportance(req.Importance); err != nil {
+		return res, err
+	}
+
+	ts := time.Now().UTC()
+	if req.TimestampUTC != "" {
+		parsed, err := time.Parse(time.RFC3339, req.TimestampUTC)
+		if err != nil {
+			return res, invalid("timestamp_utc must be RFC3339")
+		}
+		ts = parsed.UTC()
+	}
+
+	source := req.Source
+	if source == "" {
+		source = "chat"
+	}
+
+	res.MessageID = req.MessageID
+	if res.MessageID == "" {
+		res.MessageID = ids.MessageID(req.Namespace, req.ConversationID, req.Content)
+	}
+	res.DocID = ids.Message(req.ConversationID, res.MessageID)
+	hash := ids.ContentHash(req.Content)
+
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return res, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	if res.ModelWarning, err = checkModelTag(env, sh, req.Namespace, req.EmbeddingModel); err != nil {
+		return res, err
+	}
+
+	// Re-sending a stored message is a no-op; new content under the same
+	// message_id replaces the old chunk.
+	if m, ok := sh.Engine.ShortTermMessage(res.DocID); ok && m.Document.Metadata["content_sha256"] == hash {
+		res.ShortTerm = true
+		res.Duplicate = true
+		return res, nil
+	}
+	prev, err := sh.Meta.GetDocument(res.DocID)
+	replace := err == nil
+	if replace {
+		if chunkID, ok := storedChunkID(prev.Metadata); ok && prev.Metadata["content_sha256"] == hash {
+			res.ChunkID = chunkID
+			res.VectorCount = sh.Vectors.Count()
+			res.Duplicate = true
+			return res, nil
+		}
+	}
+
+	// The ID and hash above are of the content as sent, so a re-send of a
+	// scrubbed message is still recognised.
+	chunks := []IngestChunk{{
+		Vector:     req.Vector,
+		Content:    req.Content,
+		TokenCount: req.TokenCount,
+	}}
+	if res.Scrubbed, err = ScrubChunks(ctx, env, chunks); err != nil {
+		return res, err
+	}
+	if replace {
+		if _, err := sh.Engine.DeleteDocument(res.DocID); err != nil {
+			return res, &Error{Internal, "Failed to replace message", fmt.Errorf("doc_id=%s: %w", res.DocID, err)}
+		}
+	}
+
+	doc := types.Document{
+		ID:        res.DocID,
+		Source:    source,
+		Timestamp: ts,
+		Metadata: types.Metadata{
+			"namespace":       req.Namespace,
+			"conversation_id": req.ConversationID,
+			"message_id":      res.MessageID,
+			"role":            req.Role,
+			"type":            "chat_message",
+			"content_sha256":  hash,
+		},
+		Tags: NormalizeTags(req.Tags),
+	}
+	claimTag := tagDocument(sh, req.Namespace, req.EmbeddingModel, &doc)
+	chunks[0].DocID = doc.ID
+	if env.ShortTerm > 0 {
+		return rememberMessage(env, sh, doc, chunks[0], req.Importance, claimTag, res)
+	}
+	stored, err := appendVectors(ctx, env, sh, chunks)
+	if err != nil {
+		return res, err
+	}
+	res.ChunkID = stored[0].ID
+	res.VectorCount = sh.Vectors.Count()
+	applyImportance(doc, stored, req.Importance)
+
+	// Record the chunk so a duplicate can be answered without a scan.
+	doc.Metadata["chunk_id"] = res.ChunkID
+	if err := saveDocumentWithChunks(ctx, sh, doc, stored); err != nil {
+		return res, err
+	}
+	indexChunks(ctx, sh, stored)
+	claimTag()
+	res.Drift = observeVectors(sh, req.Namespace, stored)
+	enforceQuota(sh, req.Namespace)
+	return res, nil
+}
+
+// rememberMessage puts a message in its conversation's short-term buffer,
+// storing the messages that fall out of it.
+func rememberMessage(env Env, sh *engine.Shard, doc types.Document, ic IngestChunk, importance float32, claimTag func(), res IngestMessageResult) (IngestMessageResult, error) {
+	ic = prepareChunk(env, ic)
+	chunk := []types.Chunk{{DocID: doc.ID, Vector: ic.Vector, Content: ic.Content, TokenCount: ic.TokenCount, Metadata: ic.Metadata}}
+	applyImportance(doc, chunk, importance)
+	promoted, err := sh.Engine.RememberMessage(engine.ShortTermMessage{Document: doc, Chunk: chunk[0]}, env.ShortTerm)
+	res.ShortTerm = true
+	res.Promoted = len(promoted)
+	res.VectorCount = sh.Vectors.Count()
+	claimTag()
+	if err != nil {
+		return res, &Error{Internal, "Failed to store messages leaving short-term memory", fmt.Errorf("namespace=%s: %w", res.Namespace, err)}
+	}
+	if len(promoted) > 0 {
+		res.Drift = observeVectors(sh, res.Namespace, promoted)
+		enforceQuota(sh, res.Namespace)
+	}
+	return res, nil
+}
+
+// storedChunkID reads the "chunk_id" a message document was saved with.
+// Metadata round-trips through JSON, so numbers come back as float64.
+func storedChunkID(md types.Metadata) (uint64, bool) {
+	switch v := md["chunk_id"].(type) {
+	case float64:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	}
+	return 0, false
+}
+
+// IngestDocument stores one embedded chunk of a file, or all of them (see
+// IngestDocumentRequest.Chunks).
+func IngestDocument(ctx context.Context, env Env, req IngestDocumentRequest) (IngestResult, error) {
+	if req.FilePath == "" {
+		return IngestResult{}, invalid("file_path is required")
+	}
+	if len(req.Chunks) > 0 {
+		if req.Content != "" || len(req.Vector) > 0 {
+			return IngestResult{}, invalid("give either content and vector or chunks, not both")
+		}
+		return ingestFile(ctx, env, req)
+	}
+	if len(req.Vector) == 0 {
+		return IngestResult{}, invalid("vector is required")
+	}
+
+	docID := ids.FileRange(req.Namespace, req.FilePath, req.StartLine, req.EndLine)
+	res, err := Ingest(ctx, env, IngestRequest{
+		Namespace:      req.Namespace,
+		EmbeddingModel: req.EmbeddingModel,
+		Document: types.Document{
+			ID:        docID,
+			Source:    req.FilePath,
+			Timestamp: time.Now(),
+			Metadata: types.Metadata{
+				"namespace": req.Namespace,
+				"file_path": req.FilePath,
+				"type":      "code",
+			},
+		},
+		Chunks: []IngestChunk{{
+			DocID:      docID,
+			Vector:     req.Vector,
+			Content:    req.Content,
+			StartLine:  req.StartLine,
+			EndLine:    req.EndLine,
+			TokenCount: req.TokenCount,
+		}},
+	})
+	if err != nil {
+		return res, err
+	}
+	if sh, err := env.Resolve(req.Namespace); err == nil {
+		if err := sh.Engine.AddFileRange(ids.File(req.Namespace, req.FilePath), docID); err != nil {
+			log.Printf("[ingest_document] recording %s under %s failed: %v", docID, req.FilePath, err)
+		}
+	}
+	return res, nil
+}
+
+// ingestFile stores req.Chunks as the whole file req.FilePath, replacing the
+// documents stored for it before. The new chunks are stored first, so a
+// failed ingest leaves the old ones searchable; then the earlier version
+// is kept as a prior version (Env.KeepVersions, when its content changed)
+// or deleted, along with the file's line-range documents.
+func ingestFile(ctx context.Context, env Env, req IngestDocumentRequest) (IngestResult, error) {
+	docID := ids.File(req.Namespace, req.FilePath)
+	chunks, err := stitchLines(req.Chunks, docID)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	hash := req.ContentHash
+	if hash == "" {
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = c.Content
+		}
+		hash = ids.ContentHash(strings.Join(texts, "\n"))
+	}
+
+	doc := types.Document{
+		ID:        docID,
+		Source:    req.FilePath,
+		Timestamp: time.Now(),
+		Metadata: types.Metadata{
+			"namespace":      req.Namespace,
+			"file_path":      req.FilePath,
+			"type":           "code",
+			"content_sha256": hash,
+		},
+	}
+	sh, err := resolveDocument(env, req.Namespace, &doc)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	// The document is looked up by its ID and the line-range documents by
+	// the list kept for the path; nothing else can hold the file's chunks.
+	var (
+		prev      *types.Document
+		oldChunks []types.Chunk
+		keep      int
+	)
+	if p, err := sh.Meta.GetDocument(docID); err == nil {
+		prev = p
+		if oldChunks, err = sh.Meta.DocumentChunks(docID); err != nil {
+			return IngestResult{}, &Error{Internal, "Failed to read the file's previous chunks", fmt.Errorf("document id=%s: %w", docID, err)}
+		}
+		// Tags are set by users, not derived from the file; keep them.
+		doc.Tags = prev.Tags
+		version := engine.DocumentVersion(*prev)
+		if env.KeepVersions > 0 && prev.Metadata["content_sha256"] != hash {
+			keep = env.KeepVersions
+			version++
+		}
+		if env.KeepVersions > 0 {
+			doc.Metadata[engine.MetaVersion] = version
+		}
+	} else if env.KeepVersions > 0 {
+		doc.Metadata[engine.MetaVersion] = 1
+	}
+	ranges, err := sh.Engine.FileRanges(docID)
+	if err != nil {
+		return IngestResult{}, &Error{Internal, "Failed to list the file's line ranges", fmt.Errorf("document id=%s: %w", docID, err)}
+	}
+
+	res, err := Ingest(ctx, env, IngestRequest{
+		Namespace:      req.Namespace,
+		EmbeddingModel: req.EmbeddingModel,
+		Document:       doc,
+		Chunks:         chunks,
+	})
+	if err != nil {
+		return res, err
+	}
+
+	if prev != nil {
+		if err := sh.Engine.SupersedeChunks(*prev, oldChunks, keep); err != nil {
+			return res, &Error{Internal, "Failed to replace the file's previous chunks", fmt.Errorf("document id=%s: %w", docID, err)}
+		}
+		res.Replaced += len(oldChunks)
+	}
+	// Only the ranges retired here are forgotten; one stored meanwhile is
+	// newer than this ingest and stays listed.
+	var retired []string
+	for _, id := range ranges {
+		n, err := retireFileRange(sh, id, env.KeepVersions)
+		if err != nil {
+			forgetFileRanges(sh, req.FilePath, docID, retired)
+			return res, &Error{Internal, "Failed to replace the file's previous chunks", fmt.Errorf("document id=%s: %w", id, err)}
+		}
+		retired = append(retired, id)
+		res.Replaced += n
+	}
+	forgetFileRanges(sh, req.FilePath, docID, retired)
+	return res, nil
+}
+
+// forgetFileRanges drops the retired line-range documents from the list of
+// fileID. A failure only leaves IDs of documents that are gone, which a
+// later whole-file ingest skips.
+func forgetFileRanges(sh *engine.Shard, path, fileID string, retired []string) {
+	if err := sh.Engine.ForgetFileRanges(fileID, retired); err != nil {
+		log.Printf("[ingest_document] forgetting the line ranges of %s failed: %v", path, err)
+	}
+}
+
+// retireFileRange removes the line-range document id once its file has been
+// stored whole, keeping it as a prior version when keep > 0, and returns how
+// many chunks it had.
+func retireFileRange(sh *engine.Shard, id string, keep int) (int, error) {
+	if keep <= 0 {
+		return sh.Engine.DeleteDocument(id)
+	}
+	doc, err := sh.Meta.GetDocument(id)
+	if err != nil {
+		return 0, nil // already gone
+	}
+	chunks, err := sh.Meta.DocumentChunks(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := sh.Engine.SupersedeChunks(*doc, chunks, keep); err != nil {
+		return 0, err
+	}
+	// The chunks now belong to the prior version; this drops the document.
+	if _, err := sh.Engine.DeleteDocument(id); err != nil {
+		return 0, err
+	}
+	return len(chunks), nil
+}
+
+// stitchLines fills in the line ranges chunks of one file leave out (see
+// IngestDocumentRequest.Chunks), rejects ranges that overlap and assigns
+// the chunks to docID.
+func stitchLines(chunks []IngestChunk, docID string) ([]IngestChunk, error) {
+	out := make([]IngestChunk, len(chunks))
+	end := 0
+	for i, c := range chunks {
+		if c.StartLine == 0 {
+			c.StartLine = end + 1
+		}
+		if c.EndLine == 0 {
+			c.EndLine = c.StartLine + strings.Count(strings.TrimSuffix(c.Content, "\n"), "\n")
+		}
+		switch {
+		case c.StartLine < 1 || c.EndLine < c.StartLine:
+			return nil, invalid(fmt.Sprintf("chunks[%d]: invalid line range %d-%d", i, c.StartLine, c.EndLine))
+		case c.StartLine <= end:
+			return nil, invalid(fmt.Sprintf("chunks[%d]: lines %d-%d overlap chunks[%d], which ends on line %d (chunks go in file order)", i, c.StartLine, c.EndLine, i-1, end))
+		}
+		c.DocID = docID
+		out[i] = c
+		end = c.EndLine
+	}
+	return out, nil
+}
@@ -0,0 +1,254 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultJSONLWorkers is how many records ingest_jsonl parses and embeds at
+// once when -workers is not set.
+const DefaultJSONLWorkers = 4
+
+// jsonlProgressEvery is how often ingest_jsonl logs its progress.
+const jsonlProgressEvery = 5 * time.Second
+
+// IngestJSONLResult summarises one ingest_jsonl run.
+type IngestJSONLResult struct {
+	File      string `json:"file"`
+	Lines     int    `json:"lines"`
+	Documents int    `json:"documents"`
+	Chunks    int    `json:"chunks"`
+	// Embedded counts the chunks whose vector came from the provider.
+	Embedded int `json:"embedded"`
+	// Redactions counts what -scrub redacted from the content.
+	Redactions int `json:"redactions,omitempty"`
+	Errors     int `json:"errors"`
+	// ErrorFile holds one JSON line per failed input line; it is only
+	// written when a line fails.
+	ErrorFile string `json:"error_file,omitempty"`
+}
+
+// jsonlError is one line of the error report.
+type jsonlError struct {
+	Line   int             `json:"line"`
+	Error  string          `json:"error"`
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// jsonlRecord is one input line on its way from the reader to the store.
+type jsonlRecord struct {
+	line     int
+	raw      []byte
+	req      IngestRequest
+	embedded int
+	err      error
+}
+
+// ingestJSONL ingests c.File (or stdin for "-"), one POST /ingest body
+// (IngestRequest) per line, with -namespace as the default namespace.
+// Chunks with content but no vector are embedded with c.Embedder. Parsing and embedding run on c.Workers goroutines;
+// records are then written to the stores one at a time, in whatever order
+// they finish. Failed lines go to c.ErrorFile (<file>.errors.jsonl by
+// default) and do not stop the run.
+func (c *CLI) ingestJSONL(ctx context.Context) error {
+	if c.File == "" {
+		return invalid("ingest_jsonl requires -file")
+	}
+	var in io.Reader = os.Stdin
+	if c.File != "-" {
+		f, err := os.Open(c.File)
+		if err != nil {
+			return fmt.Errorf("ingest_jsonl error: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	errPath := c.ErrorFile
+	if errPath == "" {
+		errPath = "ingest_jsonl.errors.jsonl"
+		if c.File != "-" {
+			errPath = c.File + ".errors.jsonl"
+		}
+	}
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultJSONLWorkers
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines := make(chan *jsonlRecord, workers*2)
+	done := make(chan *jsonlRecord, workers*2)
+
+	var readErr error
+	go func() {
+		defer close(lines)
+		br := bufio.NewReader(in)
+		for n := 1; ; n++ {
+			raw, err := br.ReadBytes('\n')
+			if raw = bytes.TrimSpace(raw); len(raw) > 0 {
+				select {
+				case lines <- &jsonlRecord{line: n, raw: raw}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr = err
+				}
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range lines {
+				c.prepareJSONL(ctx, rec)
+				done <- rec
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	res := IngestJSONLResult{File: c.File}
+	var (
+		errFile *os.File
+		errEnc  *json.Encoder
+		last    = time.Now()
+	)
+	fail := func(rec *jsonlRecord, err error) error {
+		res.Errors++
+		if errFile == nil {
+			f, err := os.Create(errPath)
+			if err != nil {
+				return err
+			}
+			errFile, errEnc, res.ErrorFile = f, json.NewEncoder(f), errPath
+		}
+		entry := jsonlError{Line: rec.line, Error: Message(err)}
+		if json.Valid(rec.raw) {
+			entry.Record = rec.raw
+		}
+		return errEnc.Encode(entry)
+	}
+
+	var writeErr error
+	for rec := range done {
+		res.Lines++
+		if writeErr != nil {
+			continue // drain the workers
+		}
+		err := rec.err
+		if err == nil {
+			var (
+				env Env
+				out IngestResult
+			)
+			if env, err = c.envFor(rec.req.Model, false); err == nil {
+				out, err = Ingest(ctx, env, rec.req)
+				res.Redactions += out.Scrubbed.Total()
+			}
+		}
+		if err != nil {
+			log.Printf("[ingest_jsonl] line=%d %v", rec.line, err)
+			if werr := fail(rec, err); werr != nil {
+				writeErr = fmt.Errorf("write error report: %w", werr)
+				cancel()
+			}
+		} else {
+			res.Documents++
+			res.Chunks += len(rec.req.Chunks)
+			res.Embedded += rec.embedded
+		}
+		if time.Since(last) >= jsonlProgressEvery {
+			last = time.Now()
+			log.Printf("[ingest_jsonl] lines=%d documents=%d chunks=%d embedded=%d errors=%d",
+				res.Lines, res.Documents, res.Chunks, res.Embedded, res.Errors)
+		}
+	}
+	if errFile != nil {
+		if err := errFile.Close(); err != nil && writeErr == nil {
+			writeErr = fmt.Errorf("write error report: %w", err)
+		}
+	}
+	if writeErr == nil && readErr != nil {
+		writeErr = fmt.Errorf("read %s: %w", c.File, readErr)
+	}
+	log.Printf("[ingest_jsonl] done lines=%d documents=%d chunks=%d embedded=%d errors=%d",
+		res.Lines, res.Documents, res.Chunks, res.Embedded, res.Errors)
+	if err := c.write(res); err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return fmt.Errorf("ingest_jsonl error: %w", writeErr)
+	}
+	if res.Errors > 0 {
+		return fmt.Errorf("ingest_jsonl: %d line(s) failed, see %s", res.Errors, res.ErrorFile)
+	}
+	return nil
+}
+
+// prepareJSONL parses rec, scrubs its chunks and embeds the content of
+// those that have no vector, recording any failure in rec.err.
+func (c *CLI) prepareJSONL(ctx context.Context, rec *jsonlRecord) {
+	if err := json.Unmarshal(rec.raw, &rec.req); err != nil {
+		rec.err = invalid("invalid JSON: " + err.Error())
+		return
+	}
+	if rec.req.Namespace == "" {
+		rec.req.Namespace = c.Namespace
+	}
+	// Scrub before embedding, so the vectors never see what is redacted.
+	rep, err := ScrubChunks(ctx, Env{Scrub: c.Scrub}, rec.req.Chunks)
+	if err != nil {
+		rec.err = err
+		return
+	}
+	rec.req.scrubbed, rec.req.scrubReport = true, rep
+	var (
+		texts []string
+		at    []int
+	)
+	for i, ch := range rec.req.Chunks {
+		if len(ch.Vector) == 0 && ch.Content != "" {
+			texts = append(texts, ch.Content)
+			at = append(at, i)
+		}
+	}
+	if len(texts) == 0 {
+		return
+	}
+	if c.Embedder == nil {
+		rec.err = invalid("chunks without a vector need -embed")
+		return
+	}
+	vecs, err := c.Embedder.Embed(ctx, texts)
+	if err == nil && len(vecs) != len(texts) {
+		err = fmt.Errorf("got %d vectors for %d texts", len(vecs), len(texts))
+	}
+	if err != nil {
+		rec.err = &Error{Upstream, "Failed to embed chunks", fmt.Errorf("provider=%s: %w", c.Embedder.Name(), err)}
+		return
+	}
+	for j, i := range at {
+		rec.req.Chunks[i].Vector = vecs[j]
+	}
+	rec.embedded = len(texts)
+}
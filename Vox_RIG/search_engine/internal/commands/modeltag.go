@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/types"
+)
+
+// checkModelTag compares tag, the embedding model a request's vectors were
+// made with, to the one recorded for namespace ns (see
+// engine.ClaimModelTag). A mismatch is a Conflict, or with
+// env.WarnModelMismatch the returned warning. Untagged requests and
+// namespaces always pass.
+func checkModelTag(env Env, sh *engine.Shard, ns, tag string) (string, error) {
+	if tag == "" {
+		return "", nil
+	}
+	cur, err := sh.Engine.ModelTag(ns)
+	if err != nil {
+		return "", &Error{Internal, "Failed to read the namespace's embedding model", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	if cur == "" || cur == tag {
+		return "", nil
+	}
+	msg := fmt.Sprintf("embedding_model %q does not match %q, the model namespace %q was ingested with", tag, cur, ns)
+	if env.WarnModelMismatch {
+		log.Printf("[model] %s", msg)
+		return msg, nil
+	}
+	return "", &Error{Kind: Conflict, Msg: msg}
+}
+
+// tagDocument records tag on doc and, once its vectors are stored, claims it
+// for namespace ns with the returned func.
+func tagDocument(sh *engine.Shard, ns, tag string, doc *types.Document) func() {
+	if tag == "" {
+		return func() {}
+	}
+	if doc.Metadata == nil {
+		doc.Metadata = types.Metadata{}
+	}
+	doc.Metadata[engine.MetaEmbeddingModel] = tag
+	return func() {
+		if _, err := sh.Engine.ClaimModelTag(ns, tag); err != nil {
+			log.Printf("[model] namespace=%s: recording embedding model %q failed: %v", ns, tag, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// PinRequest names a document or a single chunk to pin (or unpin) in a
+// namespace. Exactly one of DocID and ChunkID must be set.
+type PinRequest struct {
+	Namespace string  `json:"namespace,omitempty"`
+	DocID     string  `json:"doc_id,omitempty"`
+	ChunkID   *uint64 `json:"chunk_id,omitempty"`
+	Note      string  `json:"note,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+func (req PinRequest) pin() (types.Pin, error) {
+	if (req.DocID == "") == (req.ChunkID == nil) {
+		return types.Pin{}, invalid("exactly one of doc_id and chunk_id is required")
+	}
+	return types.Pin{Namespace: req.Namespace, DocID: req.DocID, ChunkID: req.ChunkID, Note: req.Note}, nil
+}
+
+// Pin marks a document or chunk as always included in retrieval results for
+// its namespace. The target must exist.
+func Pin(env Env, req PinRequest) (*types.Pin, error) {
+	p, err := req.pin()
+	if err != nil {
+		return nil, err
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	if p.ChunkID != nil {
+		if _, err := sh.Meta.GetChunk(*p.ChunkID); err != nil {
+			return nil, invalid(fmt.Sprintf("chunk %d not found", *p.ChunkID))
+		}
+	} else if _, err := sh.Meta.GetDocument(p.DocID); err != nil {
+		return nil, invalid(fmt.Sprintf("document %s not found", p.DocID))
+	}
+	p.CreatedAt = time.Now().UTC()
+	if err := sh.Meta.SavePin(p); err != nil {
+		return nil, &Error{Internal, "Failed to save pin", err}
+	}
+	return &p, nil
+}
+
+// Unpin removes a pin and reports whether it existed.
+func Unpin(env Env, req PinRequest) (bool, error) {
+	p, err := req.pin()
+	if err != nil {
+		return false, err
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return false, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	found, err := sh.Meta.DeletePin(p)
+	if err != nil {
+		return false, &Error{Internal, "Failed to delete pin", err}
+	}
+	return found, nil
+}
+
+// ListPins returns the pins of namespace ns, oldest first.
+func ListPins(env Env, ns string) ([]types.Pin, error) {
+	sh, err := env.Resolve(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	pins, err := sh.Meta.ListPins(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to list pins", err}
+	}
+	if pins == nil {
+		pins = []types.Pin{}
+	}
+	return pins, nil
+}
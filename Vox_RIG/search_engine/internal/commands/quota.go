@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"vox-vector-engine/internal/engine"
+)
+
+// QuotaRequest sets or, for DeleteQuota, names the quota of a namespace
+// (see engine.Quota). At least one limit is required; 0 leaves it unbounded.
+type QuotaRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	MaxChunks int    `json:"max_chunks,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	MaxTokens int64  `json:"max_tokens,omitempty"`
+	// Policy picks what is evicted first: oldest (the default),
+	// lowest_importance or least_retrieved.
+	Policy string `json:"policy,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// SetQuota stores the quota of req.Namespace and evicts at once whatever
+// is over it.
+func SetQuota(env Env, req QuotaRequest) (*engine.QuotaStatus, error) {
+	if req.MaxChunks < 0 || req.MaxBytes < 0 || req.MaxTokens < 0 {
+		return nil, invalid("quota limits must not be negative")
+	}
+	if req.MaxChunks == 0 && req.MaxBytes == 0 && req.MaxTokens == 0 {
+		return nil, invalid("one of max_chunks, max_bytes and max_tokens is required")
+	}
+	if req.Policy == "" {
+		req.Policy = engine.EvictOldest
+	}
+	if !slices.Contains(engine.EvictionPolicies, req.Policy) {
+		return nil, invalid("policy must be one of " + strings.Join(engine.EvictionPolicies, ", "))
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	st, err := sh.Engine.SetQuota(engine.Quota{
+		Namespace: req.Namespace,
+		MaxChunks: req.MaxChunks,
+		MaxBytes:  req.MaxBytes,
+		MaxTokens: req.MaxTokens,
+		Policy:    req.Policy,
+	})
+	if err != nil {
+		return nil, &Error{Internal, "Failed to set quota", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	return st, nil
+}
+
+// Quotas returns the quotas stored in the shared stores with each
+// namespace's usage and evictions, or the one of ns (a NotFound error when
+// it has none).
+func Quotas(env Env, ns string) ([]engine.QuotaStatus, error) {
+	sh, err := env.Resolve(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	out, err := sh.Engine.Quotas(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to read quotas", err}
+	}
+	if ns != "" && len(out) == 0 {
+		return nil, &Error{NotFound, fmt.Sprintf("namespace %q has no quota", ns), nil}
+	}
+	return out, nil
+}
+
+// DeleteQuota removes the quota of namespace ns and reports whether it
+// existed; nothing is evicted after that.
+func DeleteQuota(env Env, ns string) (bool, error) {
+	sh, err := env.Resolve(ns)
+	if err != nil {
+		return false, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	found, err := sh.Engine.DeleteQuota(ns)
+	if err != nil {
+		return false, &Error{Internal, "Failed to delete quota", err}
+	}
+	return found, nil
+}
+
+// enforceQuota evicts from ns after a write took it over its quota. The
+// write has succeeded by then, so failures are logged, not returned.
+func enforceQuota(sh *engine.Shard, ns string) {
+	if _, err := sh.Engine.EnforceQuota(ns); err != nil {
+		log.Printf("[quota] namespace=%s enforcement failed: %v", ns, err)
+	}
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"vox-vector-engine/internal/engine"
+)
+
+// ReindexRequest rebuilds the index of a namespace (see engine.Reindex).
+type ReindexRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// Reindex rebuilds the index of req.Namespace and swaps it in. progress, if
+// set, receives the share of the build done.
+func Reindex(ctx context.Context, env Env, req ReindexRequest, progress func(float64)) (*engine.ReindexResult, error) {
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	res, err := sh.Engine.Reindex(ctx, progress)
+	switch {
+	case errors.Is(err, engine.ErrReindexRunning):
+		return nil, &Error{Conflict, err.Error(), nil}
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err != nil:
+		return nil, &Error{Internal, "reindex failed", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	return res, nil
+}
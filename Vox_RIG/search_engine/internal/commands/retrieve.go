@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/tracing"
+	"vox-vector-engine/internal/types"
+)
+
+// DefaultMaxTokens is the context budget used when a request sets none.
+const DefaultMaxTokens = 2000
+
+// DefaultImportanceWeight scales chunk importance (0..1) in retrieval
+// scores when a request sets no importance_weight.
+const DefaultImportanceWeight = 0.1
+
+// DefaultFeedbackWeight scales the feedback recorded with /feedback in
+// retrieval scores when a request sets no feedback_weight.
+const DefaultFeedbackWeight = 0.1
+
+type RetrieveRequest struct {
+	// Namespace: if provided, only returns chunks whose Document.Metadata["namespace"] matches.
+	Namespace string `json:"namespace,omitempty"`
+	// ConversationID: if provided, only returns chat messages from that
+	// conversation (within Namespace, when both are set).
+	ConversationID string       `json:"conversation_id,omitempty"`
+	Query          types.Vector `json:"query"`
+	// QueryText is embedded server-side when Query is empty (requires -embed).
+	QueryText string `json:"query_text,omitempty"`
+	MaxTokens int    `json:"max_tokens"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+	// EmbeddingModel names the model Query was made with; a namespace
+	// ingested with another is refused (see IngestRequest.EmbeddingModel).
+	// A query_text embedded by the server is tagged with its embedder.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// Boosts multiplies scores by metadata value, e.g.
+	// {"role":{"user":1.2},"type":{"code":1.5}}.
+	Boosts map[string]map[string]float32 `json:"boosts,omitempty"`
+	// VectorWeights ranks chunks ingested with extra vectors by their
+	// weighted similarities, "content" being the chunk's own vector, e.g.
+	// {"content": 1, "docstring": 0.5}; chunks with none of the weighted
+	// vectors are left out. Empty ranks by the nearest of a chunk's vectors.
+	VectorWeights map[string]float32 `json:"vector_weights,omitempty"`
+	// SparseQuery is the query's sparse term-weight vector: chunks ingested
+	// with sparse vectors that share its terms become candidates, and
+	// SparseWeight (0..1, 0 uses engine.DefaultSparseWeight) of the
+	// similarity comes from the sparse score.
+	SparseQuery  types.SparseVector `json:"sparse_query,omitempty"`
+	SparseWeight float32            `json:"sparse_weight,omitempty"`
+	// ImportanceWeight scales the importance stored at ingest in the score;
+	// 0 uses DefaultImportanceWeight.
+	ImportanceWeight float32 `json:"importance_weight,omitempty"`
+	// FeedbackWeight scales the decayed feedback of each chunk in the score;
+	// 0 uses DefaultFeedbackWeight.
+	FeedbackWeight float32 `json:"feedback_weight,omitempty"`
+	// AccessWeight scales how often and how lately each chunk was retrieved
+	// (see engine.AccessScore) in the score; 0 leaves it out.
+	AccessWeight float32 `json:"access_weight,omitempty"`
+	// After and Before (RFC3339) restrict results to documents whose
+	// timestamp lies in [After, Before).
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+	// ExcludeDocIDs and ExcludeChunkIDs omit content the caller already has
+	// in its prompt.
+	ExcludeDocIDs   []string `json:"exclude_doc_ids,omitempty"`
+	ExcludeChunkIDs []uint64 `json:"exclude_chunk_ids,omitempty"`
+	// TagsAny keeps documents with at least one of these tags, TagsAll those
+	// with every one (see Document.Tags).
+	TagsAny []string `json:"tags_any,omitempty"`
+	TagsAll []string `json:"tags_all,omitempty"`
+	// IncludeVersions also searches prior versions of re-indexed files
+	// (<doc_id>@v<n>); by default only the latest version is returned.
+	IncludeVersions bool `json:"include_versions,omitempty"`
+	// TwoStage first picks the TopDocs documents nearest the query by their
+	// centroid vectors, then searches chunks only within them. TopDocs 0
+	// uses engine.DefaultTopDocs.
+	TwoStage bool `json:"two_stage,omitempty"`
+	TopDocs  int  `json:"top_docs,omitempty"`
+	// MaxVisits and SearchBudgetMS bound the index search, which then
+	// answers with its best candidates so far and "partial": true. 0 uses
+	// index.DefaultMaxVisits and no time budget.
+	MaxVisits      int `json:"max_visits,omitempty"`
+	SearchBudgetMS int `json:"search_budget_ms,omitempty"`
+}
+
+// Retrieve returns the best chunks for the query that fit in MaxTokens.
+func Retrieve(ctx context.Context, env Env, req RetrieveRequest) (*engine.RetrievalResult, error) {
+	if len(req.Query) == 0 && req.QueryText != "" && env.Embedder != nil {
+		ectx, span := tracing.Start(ctx, "embed.query", tracing.String("provider", env.Embedder.Name()))
+		vecs, err := env.Embedder.Embed(ectx, []string{req.QueryText})
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		if err == nil && len(vecs) != 1 {
+			err = fmt.Errorf("got %d vectors for 1 query", len(vecs))
+		}
+		if err != nil {
+			return nil, &Error{Upstream, "Failed to embed query_text", fmt.Errorf("provider=%s: %w", env.Embedder.Name(), err)}
+		}
+		req.Query = vecs[0]
+		if req.EmbeddingModel == "" {
+			req.EmbeddingModel = env.Embedder.Name()
+		}
+	}
+	if len(req.Query) == 0 {
+		return nil, invalid("query vector is required")
+	}
+	if err := env.checkVector("query", req.Query); err != nil {
+		return nil, err
+	}
+	req.Query = env.query(req.Query)
+	for key, byValue := range req.Boosts {
+		for value, m := range byValue {
+			if m < 0 {
+				return nil, invalid(fmt.Sprintf("boosts.%s.%s must not be negative", key, value))
+			}
+		}
+	}
+	for name, w := range req.VectorWeights {
+		if w < 0 {
+			return nil, invalid(fmt.Sprintf("vector_weights.%s must not be negative", name))
+		}
+	}
+	if err := checkSparse("sparse_query", req.SparseQuery); err != nil {
+		return nil, err
+	}
+	if req.SparseWeight < 0 || req.SparseWeight > 1 {
+		return nil, invalid("sparse_weight must be between 0 and 1")
+	}
+	after, err := parseBound("after", req.After)
+	if err != nil {
+		return nil, err
+	}
+	before, err := parseBound("before", req.Before)
+	if err != nil {
+		return nil, err
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return nil, invalid("after must be earlier than before")
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = DefaultMaxTokens
+	}
+	if req.ImportanceWeight < 0 {
+		return nil, invalid("importance_weight must not be negative")
+	}
+	if req.ImportanceWeight == 0 {
+		req.ImportanceWeight = DefaultImportanceWeight
+	}
+	if req.FeedbackWeight < 0 {
+		return nil, invalid("feedback_weight must not be negative")
+	}
+	if req.FeedbackWeight == 0 {
+		req.FeedbackWeight = DefaultFeedbackWeight
+	}
+	if req.AccessWeight < 0 {
+		return nil, invalid("access_weight must not be negative")
+	}
+	if req.TopDocs < 0 {
+		return nil, invalid("top_docs must not be negative")
+	}
+	if req.MaxVisits < 0 || req.SearchBudgetMS < 0 {
+		return nil, invalid("max_visits and search_budget_ms must not be negative")
+	}
+
+	cfg := engine.RetrievalConfig{
+		MaxTokens:        req.MaxTokens,
+		SimilarityWeight: 0.8,
+		RecencyWeight:    0.2,
+		ImportanceWeight: req.ImportanceWeight,
+		FeedbackWeight:   req.FeedbackWeight,
+		AccessWeight:     req.AccessWeight,
+		TopKCandidates:   50,
+		Namespace:        req.Namespace,
+		ConversationID:   req.ConversationID,
+		Tokens:           env.counter(),
+		Boosts:           req.Boosts,
+		After:            after,
+		Before:           before,
+		ExcludeDocIDs:    req.ExcludeDocIDs,
+		ExcludeChunkIDs:  req.ExcludeChunkIDs,
+		TagsAny:          NormalizeTags(req.TagsAny),
+		TagsAll:          NormalizeTags(req.TagsAll),
+		IncludeVersions:  req.IncludeVersions,
+		TwoStage:         req.TwoStage,
+		TopDocs:          req.TopDocs,
+		MaxVisits:        req.MaxVisits,
+		SearchBudget:     time.Duration(req.SearchBudgetMS) * time.Millisecond,
+		VectorWeights:    req.VectorWeights,
+		SparseQuery:      req.SparseQuery,
+		SparseWeight:     req.SparseWeight,
+	}
+
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	warning, err := checkModelTag(env, sh, req.Namespace, req.EmbeddingModel)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := env.searchContext(ctx)
+	defer cancel()
+	res, err := sh.Engine.RetrieveContext(ctx, req.Query, cfg)
+	if err != nil {
+		return nil, searchFailed("retrieval failed", err)
+	}
+	if warning != "" {
+		// res may be the engine's cached result; warn on a copy.
+		tagged := *res
+		tagged.ModelWarning = warning
+		res = &tagged
+	}
+	return res, nil
+}
+
+// parseBound parses an optional RFC3339 time-window bound.
+func parseBound(field, v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, invalid(field + " must be RFC3339")
+	}
+	return t, nil
+}
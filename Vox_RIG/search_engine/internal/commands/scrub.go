@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/tracing"
+)
+
+// ScrubChunks redacts the content of chunks in place with env.Scrub and
+// drops the token counts of the chunks it changed, so they are recounted.
+// Ingest and IngestMessage scrub on their own; callers of AppendChunks run
+// it first. It returns nil when nothing was redacted.
+func ScrubChunks(ctx context.Context, env Env, chunks []IngestChunk) (*scrub.Report, error) {
+	if len(env.Scrub) == 0 || len(chunks) == 0 {
+		return nil, nil
+	}
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Content
+	}
+	rep, err := ScrubTexts(ctx, env, texts)
+	if err != nil || rep == nil {
+		return rep, err
+	}
+	for i := range chunks {
+		if texts[i] != chunks[i].Content {
+			chunks[i].Content = texts[i]
+			chunks[i].TokenCount = 0
+		}
+	}
+	return rep, nil
+}
+
+// ScrubTexts is ScrubChunks for bare texts, e.g. before they are embedded.
+func ScrubTexts(ctx context.Context, env Env, texts []string) (*scrub.Report, error) {
+	if len(env.Scrub) == 0 || len(texts) == 0 {
+		return nil, nil
+	}
+	_, span := tracing.Start(ctx, "ingest.scrub", tracing.Int("texts", len(texts)))
+	defer span.End()
+	rep, err := env.Scrub.Scrub(ctx, texts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, &Error{Upstream, "Failed to scrub content", fmt.Errorf("scrubber=%s: %w", env.Scrub.Name(), err)}
+	}
+	if rep != nil {
+		log.Printf("[scrub] chunks=%d redactions=%d", rep.Chunks, rep.Total())
+	}
+	return rep, nil
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/types"
+)
+
+// Bounds of SimilarRequest.Limit.
+const (
+	DefaultSimilarLimit = 10
+	MaxSimilarLimit     = 100
+)
+
+// SimilarRequest finds documents near a stored document or chunk, using its
+// stored vectors as the query, so no embedding is recomputed.
+type SimilarRequest struct {
+	// Namespace locates the document or chunk and restricts the results;
+	// empty uses the namespace of the document.
+	Namespace string `json:"namespace,omitempty"`
+	// DocID queries with the mean of the document's chunk vectors.
+	DocID string `json:"doc_id,omitempty"`
+	// ChunkID queries with one chunk's vector; set exactly one of DocID and
+	// ChunkID.
+	ChunkID *uint64 `json:"chunk_id,omitempty"`
+	// Limit is how many documents to return; 0 uses DefaultSimilarLimit.
+	Limit int `json:"limit,omitempty"`
+	// IncludeVersions also returns prior versions of re-indexed files.
+	IncludeVersions bool `json:"include_versions,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+type SimilarResult struct {
+	// DocID is the document the query came from; it is never in Documents.
+	DocID string `json:"doc_id"`
+	// Vectors is how many stored vectors were averaged into the query.
+	Vectors   int                      `json:"vectors"`
+	Documents []engine.SimilarDocument `json:"documents"`
+}
+
+// Similar returns the documents nearest req's document or chunk, best first.
+func Similar(ctx context.Context, env Env, req SimilarRequest) (*SimilarResult, error) {
+	if (req.DocID == "") == (req.ChunkID == nil) {
+		return nil, invalid("exactly one of doc_id and chunk_id is required")
+	}
+	if req.Limit < 0 || req.Limit > MaxSimilarLimit {
+		return nil, invalid(fmt.Sprintf("limit must be between 0 and %d", MaxSimilarLimit))
+	}
+	if req.Limit == 0 {
+		req.Limit = DefaultSimilarLimit
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+
+	res := &SimilarResult{DocID: req.DocID}
+	var query types.Vector
+	if req.ChunkID != nil {
+		chunk, err := sh.Meta.GetChunk(*req.ChunkID)
+		if err != nil {
+			return nil, &Error{NotFound, fmt.Sprintf("chunk %d not found", *req.ChunkID), err}
+		}
+		if query, err = sh.Vectors.Get(chunk.ID); err != nil {
+			return nil, &Error{Internal, "Failed to read vector", fmt.Errorf("chunk_id=%d: %w", chunk.ID, err)}
+		}
+		res.DocID, res.Vectors = chunk.DocID, 1
+	} else {
+		if query, res.Vectors, err = sh.Engine.DocumentVector(req.DocID); err != nil {
+			return nil, &Error{Internal, "Failed to read vectors", fmt.Errorf("doc_id=%s: %w", req.DocID, err)}
+		}
+	}
+	doc, err := sh.Meta.GetDocument(res.DocID)
+	if err != nil {
+		return nil, &Error{NotFound, fmt.Sprintf("document %s not found", res.DocID), err}
+	}
+	if res.Vectors == 0 {
+		return nil, invalid(fmt.Sprintf("document %s has no chunks", res.DocID))
+	}
+
+	ns := req.Namespace
+	if ns == "" {
+		ns, _ = doc.Metadata["namespace"].(string)
+	}
+	ctx, cancel := env.searchContext(ctx)
+	defer cancel()
+	docs, err := sh.Engine.SimilarDocuments(ctx, query, engine.SimilarConfig{
+		Limit:           req.Limit,
+		Namespace:       ns,
+		ExcludeDocIDs:   []string{res.DocID},
+		IncludeVersions: req.IncludeVersions,
+	})
+	if err != nil {
+		return nil, searchFailed("similarity search failed", err)
+	}
+	res.Documents = docs
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TagsRequest edits the tags of one document. Tags, when present (even
+// empty), replaces the current set; Add and Remove are then applied to it.
+type TagsRequest struct {
+	Namespace string   `json:"namespace,omitempty"`
+	DocID     string   `json:"doc_id"`
+	Tags      []string `json:"tags,omitempty"`
+	Add       []string `json:"add,omitempty"`
+	Remove    []string `json:"remove,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+type TagsResult struct {
+	Status string   `json:"status"`
+	DocID  string   `json:"doc_id"`
+	Tags   []string `json:"tags"`
+}
+
+// NormalizeTags trims and lower-cases tags, drops empty ones and returns the
+// rest sorted without duplicates, so "Bug" and " bug" are the same tag.
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SetTags applies req to the document's tags and returns the new set.
+func SetTags(env Env, req TagsRequest) (*TagsResult, error) {
+	if req.DocID == "" {
+		return nil, invalid("doc_id is required")
+	}
+	if req.Tags == nil && len(req.Add) == 0 && len(req.Remove) == 0 {
+		return nil, invalid("one of tags, add and remove is required")
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	doc, err := sh.Meta.GetDocument(req.DocID)
+	if err != nil {
+		return nil, &Error{NotFound, fmt.Sprintf("document %s not found", req.DocID), err}
+	}
+
+	tags := doc.Tags
+	if req.Tags != nil {
+		tags = req.Tags
+	}
+	drop := map[string]bool{}
+	for _, t := range NormalizeTags(req.Remove) {
+		drop[t] = true
+	}
+	var kept []string
+	for _, t := range NormalizeTags(append(append([]string(nil), tags...), req.Add...)) {
+		if !drop[t] {
+			kept = append(kept, t)
+		}
+	}
+	tags = kept
+
+	if err := sh.Meta.SetTags(req.DocID, tags); err != nil {
+		return nil, &Error{Internal, "Failed to save tags", fmt.Errorf("doc_id=%s: %w", req.DocID, err)}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return &TagsResult{Status: "tagged", DocID: req.DocID, Tags: tags}, nil
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// TemplateRequest sets the context template of a namespace (see
+// types.ContextTemplate), e.g. a chunk template of
+//
+//	// {{.Source}}:{{.StartLine}}-{{.EndLine}}
+//	{{.Content}}
+//
+// for code and a chat template of "[{{.Role}} at {{.Timestamp}}] {{.Content}}".
+type TemplateRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	Chunk     string `json:"chunk"`
+	Chat      string `json:"chat,omitempty"`
+	Separator string `json:"separator,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// TemplateChunk is what a context template renders for each chunk: the
+// ContextSource fields plus Source (the path, or document ID), Lang (the
+// file extension) and Index (the 0-based position in the context).
+type TemplateChunk struct {
+	ContextSource
+	Source string
+	Lang   string
+	Index  int
+}
+
+// contextTemplate is a parsed types.ContextTemplate.
+type contextTemplate struct {
+	chunk, chat *template.Template
+	separator   string
+}
+
+func parseContextTemplate(t types.ContextTemplate) (*contextTemplate, error) {
+	ct := &contextTemplate{separator: t.Separator}
+	if ct.separator == "" {
+		ct.separator = "\n"
+	}
+	var err error
+	if ct.chunk, err = template.New("chunk").Parse(t.Chunk); err != nil {
+		return nil, err
+	}
+	if t.Chat != "" {
+		if ct.chat, err = template.New("chat").Parse(t.Chat); err != nil {
+			return nil, err
+		}
+	}
+	return ct, nil
+}
+
+// render formats sources with the chunk template, or the chat template for
+// chat messages when there is one.
+func (ct *contextTemplate) render(sources []ContextSource) (string, error) {
+	var b strings.Builder
+	for i, src := range sources {
+		if i > 0 {
+			b.WriteString(ct.separator)
+		}
+		tmpl := ct.chunk
+		if src.Role != "" && ct.chat != nil {
+			tmpl = ct.chat
+		}
+		data := TemplateChunk{ContextSource: src, Source: src.Path, Lang: strings.TrimPrefix(path.Ext(src.Path), "."), Index: i}
+		if err := tmpl.Execute(&b, data); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// SetTemplate validates and stores the context template of req.Namespace.
+// Both templates are tried on a sample chunk, so unknown fields are refused
+// here rather than on the next /context.
+func SetTemplate(env Env, req TemplateRequest) (*types.ContextTemplate, error) {
+	if strings.TrimSpace(req.Chunk) == "" {
+		return nil, invalid("chunk template is required")
+	}
+	t := types.ContextTemplate{Namespace: req.Namespace, Chunk: req.Chunk, Chat: req.Chat, Separator: req.Separator}
+	ct, err := parseContextTemplate(t)
+	if err != nil {
+		return nil, invalid(fmt.Sprintf("invalid template: %v", err))
+	}
+	sample := []ContextSource{
+		{DocID: "file:ns:a.go", Path: "a.go", StartLine: 1, EndLine: 2, Content: "package a"},
+		{DocID: "chat:c:m", Path: "chat:c:m", Role: "user", Timestamp: time.Now().UTC().Format(time.RFC3339), Content: "hi"},
+	}
+	if _, err := ct.render(sample); err != nil {
+		return nil, invalid(fmt.Sprintf("invalid template: %v", err))
+	}
+
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	t.UpdatedAt = time.Now().UTC()
+	if err := sh.Meta.SaveTemplate(t); err != nil {
+		return nil, &Error{Internal, "Failed to save template", err}
+	}
+	return &t, nil
+}
+
+// GetTemplate returns the context template of namespace ns.
+func GetTemplate(env Env, ns string) (*types.ContextTemplate, error) {
+	sh, err := env.Resolve(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	t, err := sh.Meta.GetTemplate(ns)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, &Error{NotFound, fmt.Sprintf("namespace %q has no context template", ns), err}
+	}
+	if err != nil {
+		return nil, &Error{Internal, "Failed to read template", err}
+	}
+	return t, nil
+}
+
+// DeleteTemplate removes the context template of namespace ns and reports
+// whether it existed; /context falls back to markdown.
+func DeleteTemplate(env Env, ns string) (bool, error) {
+	sh, err := env.Resolve(ns)
+	if err != nil {
+		return false, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	found, err := sh.Meta.DeleteTemplate(ns)
+	if err != nil {
+		return false, &Error{Internal, "Failed to delete template", err}
+	}
+	return found, nil
+}
+
+// ListTemplates returns the context templates stored in the shared stores,
+// or in the shard of ns with -isolate_namespaces.
+func ListTemplates(env Env, ns string) ([]types.ContextTemplate, error) {
+	sh, err := env.Resolve(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	out, err := sh.Meta.ListTemplates()
+	if err != nil {
+		return nil, &Error{Internal, "Failed to list templates", err}
+	}
+	if out == nil {
+		out = []types.ContextTemplate{}
+	}
+	return out, nil
+}
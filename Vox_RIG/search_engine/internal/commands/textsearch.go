@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+
+	"vox-vector-engine/internal/engine"
+)
+
+// Text search result limits.
+const (
+	defaultTextLimit = 20
+	maxTextLimit     = 200
+)
+
+// SearchTextRequest matches chunk content literally, for identifiers and
+// error strings that embeddings blur. Mode is substring (default), regex
+// (RE2 syntax) or bm25.
+type SearchTextRequest struct {
+	Query         string `json:"q"`
+	Namespace     string `json:"namespace,omitempty"`
+	Mode          string `json:"mode,omitempty"`
+	CaseSensitive bool   `json:"case_sensitive,omitempty"`
+	Limit         int    `json:"limit,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// SearchText runs a vector-free search over the chunks of req's namespace.
+func SearchText(env Env, req SearchTextRequest) (*engine.TextResult, error) {
+	if req.Query == "" {
+		return nil, invalid("q is required")
+	}
+	switch req.Mode {
+	case "", engine.TextSubstring, engine.TextBM25:
+	case engine.TextRegex:
+		if _, err := regexp.Compile(req.Query); err != nil {
+			return nil, invalid("invalid regex: " + err.Error())
+		}
+	default:
+		return nil, invalid("mode must be substring, regex or bm25")
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultTextLimit
+	}
+	req.Limit = min(req.Limit, maxTextLimit)
+
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	res, err := sh.Engine.SearchText(engine.TextQuery{
+		Query:         req.Query,
+		Mode:          req.Mode,
+		Namespace:     req.Namespace,
+		CaseSensitive: req.CaseSensitive,
+		Limit:         req.Limit,
+	})
+	if err != nil {
+		return nil, &Error{Internal, "Text search failed", err}
+	}
+	return res, nil
+}
@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// DeleteDocumentRequest removes a document. Soft moves it to the trash,
+// from which RestoreDocument brings it back until the trash janitor purges
+// it; otherwise it is deleted for good, from the trash too.
+type DeleteDocumentRequest struct {
+	// Namespace locates the document (its shard under -isolate_namespaces).
+	Namespace string `json:"namespace,omitempty"`
+	DocID     string `json:"doc_id"`
+	Soft      bool   `json:"soft,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+type DeleteDocumentResult struct {
+	// Status is "trashed" or "deleted".
+	Status string `json:"status"`
+	DocID  string `json:"doc_id"`
+	Chunks int    `json:"chunks"`
+}
+
+// DeleteDocument trashes or deletes req.DocID.
+func DeleteDocument(env Env, req DeleteDocumentRequest) (*DeleteDocumentResult, error) {
+	if req.DocID == "" {
+		return nil, invalid("doc_id is required")
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+
+	if req.Soft {
+		t, err := sh.Engine.TrashDocument(req.DocID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, &Error{NotFound, fmt.Sprintf("document %s not found", req.DocID), err}
+		}
+		if err != nil {
+			return nil, &Error{Internal, "Failed to trash document", err}
+		}
+		return &DeleteDocumentResult{Status: "trashed", DocID: req.DocID, Chunks: len(t.Chunks)}, nil
+	}
+
+	_, missing := sh.Meta.GetDocument(req.DocID)
+	n, err := sh.Engine.DeleteDocument(req.DocID)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to delete document", err}
+	}
+	trashed, err := sh.Meta.DeleteTrash(req.DocID)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to delete trashed document", err}
+	}
+	if missing != nil && n == 0 && !trashed {
+		return nil, &Error{NotFound, fmt.Sprintf("document %s not found", req.DocID), missing}
+	}
+	return &DeleteDocumentResult{Status: "deleted", DocID: req.DocID, Chunks: n}, nil
+}
+
+// RestoreDocumentRequest names a trashed document to bring back.
+type RestoreDocumentRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	DocID     string `json:"doc_id"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+type RestoreDocumentResult struct {
+	Status   string         `json:"status"`
+	Document types.Document `json:"document"`
+	Chunks   int            `json:"chunks"`
+}
+
+// RestoreDocument moves a trashed document and its chunks back into
+// retrieval. A document stored under the same ID since is not overwritten.
+func RestoreDocument(env Env, req RestoreDocumentRequest) (*RestoreDocumentResult, error) {
+	if req.DocID == "" {
+		return nil, invalid("doc_id is required")
+	}
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	t, err := sh.Engine.RestoreDocument(req.DocID)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, &Error{NotFound, fmt.Sprintf("document %s is not in the trash", req.DocID), err}
+	case errors.Is(err, storage.ErrDocumentExists):
+		return nil, &Error{Conflict, fmt.Sprintf("document %s was stored again since it was deleted; delete it first", req.DocID), err}
+	case err != nil:
+		return nil, &Error{Internal, "Failed to restore document", err}
+	}
+	return &RestoreDocumentResult{Status: "restored", Document: t.Document, Chunks: len(t.Chunks)}, nil
+}
+
+// TrashEntry summarizes a trashed document.
+type TrashEntry struct {
+	Document  types.Document `json:"document"`
+	Chunks    int            `json:"chunks"`
+	DeletedAt time.Time      `json:"deleted_at"`
+	// PurgeAt is when the janitor will delete it for good; unset when the
+	// trash is kept forever.
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
+
+// ListTrash returns the trashed documents of namespace ns, oldest first.
+// retention is the janitor's, for PurgeAt.
+func ListTrash(env Env, ns string, retention time.Duration) ([]TrashEntry, error) {
+	sh, err := env.Resolve(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", ns, err)}
+	}
+	trash, err := sh.Meta.ListTrash(ns)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to list trash", err}
+	}
+	out := make([]TrashEntry, len(trash))
+	for i, t := range trash {
+		out[i] = TrashEntry{Document: t.Document, Chunks: len(t.Chunks), DeletedAt: t.DeletedAt}
+		if retention > 0 {
+			at := t.DeletedAt.Add(retention)
+			out[i].PurgeAt = &at
+		}
+	}
+	return out, nil
+}
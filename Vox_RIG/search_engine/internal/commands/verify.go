@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"vox-vector-engine/internal/engine"
+)
+
+// VerifyIndexRequest checks, and with Repair fixes, the index of a
+// namespace (see engine.VerifyIndex).
+type VerifyIndexRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	Repair    bool   `json:"repair,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+// VerifyIndex runs engine.VerifyIndex on the shard of req.Namespace.
+func VerifyIndex(ctx context.Context, env Env, req VerifyIndexRequest) (*engine.IndexReport, error) {
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	rep, err := sh.Engine.VerifyIndex(ctx, req.Repair)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		return nil, &Error{Internal, "index verification failed", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	return rep, nil
+}
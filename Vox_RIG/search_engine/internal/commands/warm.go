@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/tracing"
+	"vox-vector-engine/internal/types"
+)
+
+// MaxWarmQueries bounds the queries of one warm request.
+const MaxWarmQueries = 256
+
+// WarmRequest names representative queries, such as the embedding of the
+// file open in the IDE, whose region of the index should be read ahead of
+// the first real query.
+type WarmRequest struct {
+	Namespace string         `json:"namespace,omitempty"`
+	Queries   []types.Vector `json:"queries,omitempty"`
+	// QueryTexts are embedded server-side (requires -embed).
+	QueryTexts []string `json:"query_texts,omitempty"`
+	// Ef is the search beam width to walk with; 0 means twice index.EfSearch.
+	Ef int `json:"ef,omitempty"`
+	// Model selects an embedding space registered with -models; empty is the default.
+	Model string `json:"model,omitempty"`
+}
+
+type WarmResult struct {
+	Status  string `json:"status"`
+	Queries int    `json:"queries"`
+	// Nodes is how many vectors were read and prefetched.
+	Nodes           int     `json:"nodes"`
+	PrefetchedBytes int64   `json:"prefetched_bytes"`
+	ElapsedMS       float64 `json:"elapsed_ms"`
+}
+
+// Warm walks the index toward each query, which reads the vectors a search
+// would, and asks the OS to prefetch the pages holding them and their
+// neighbors when the vector store supports it (storage.Prefetcher).
+func Warm(ctx context.Context, env Env, req WarmRequest) (*WarmResult, error) {
+	start := time.Now()
+	queries := append([]types.Vector(nil), req.Queries...)
+	if len(req.QueryTexts) > 0 {
+		if env.Embedder == nil {
+			return nil, invalid("query_texts requires an embedding provider (-embed)")
+		}
+		ectx, span := tracing.Start(ctx, "embed.query", tracing.String("provider", env.Embedder.Name()))
+		vecs, err := env.Embedder.Embed(ectx, req.QueryTexts)
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		if err == nil && len(vecs) != len(req.QueryTexts) {
+			err = fmt.Errorf("got %d vectors for %d queries", len(vecs), len(req.QueryTexts))
+		}
+		if err != nil {
+			return nil, &Error{Upstream, "Failed to embed query_texts", fmt.Errorf("provider=%s: %w", env.Embedder.Name(), err)}
+		}
+		queries = append(queries, vecs...)
+	}
+	switch {
+	case len(queries) == 0:
+		return nil, invalid("queries or query_texts is required")
+	case len(queries) > MaxWarmQueries:
+		return nil, invalid(fmt.Sprintf("at most %d queries per request", MaxWarmQueries))
+	case req.Ef < 0:
+		return nil, invalid("ef must not be negative")
+	}
+	for i, q := range queries {
+		if err := env.checkVector(fmt.Sprintf("queries[%d]", i), q); err != nil {
+			return nil, err
+		}
+		queries[i] = env.query(q)
+	}
+	ef := req.Ef
+	if ef == 0 {
+		ef = 2 * index.EfSearch
+	}
+
+	sh, err := env.Resolve(req.Namespace)
+	if err != nil {
+		return nil, &Error{Internal, "Failed to open namespace", fmt.Errorf("namespace=%s: %w", req.Namespace, err)}
+	}
+	_, span := tracing.Start(ctx, "index.warm", tracing.Int("queries", len(queries)), tracing.Int("ef", ef))
+	ids := sh.Index.Warm(queries, ef)
+	span.End()
+
+	res := &WarmResult{Status: "warmed", Queries: len(queries), Nodes: len(ids)}
+	if p, ok := sh.Vectors.(storage.Prefetcher); ok {
+		if res.PrefetchedBytes, err = p.Prefetch(ids); err != nil {
+			return nil, &Error{Internal, "Failed to prefetch vectors", err}
+		}
+	}
+	res.ElapsedMS = float64(time.Since(start).Microseconds()) / 1000
+	return res, nil
+}
@@ -0,0 +1,315 @@
+// Package compact keeps long-lived chat memory small: old messages of a
+// conversation are summarized by an LLM, the summary is stored as a new
+// document (metadata type=summary, listing its sources) and the originals are
+// deleted. Their vectors stay in vectors.bin but leave the index, as with
+// purge.
+package compact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/embed"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/tokens"
+	"vox-vector-engine/internal/types"
+)
+
+const (
+	// DefaultMinMessages is the smallest batch worth a summary.
+	DefaultMinMessages = 4
+	// DefaultMaxMessages caps the messages sent to the LLM in one request.
+	DefaultMaxMessages = 50
+)
+
+// Policy decides which messages are compacted. A message qualifies when it
+// is older than MaxAge or falls outside the newest KeepRecent messages of its
+// conversation; at least one of the two must be set.
+type Policy struct {
+	MaxAge      time.Duration
+	KeepRecent  int
+	MinMessages int
+	MaxMessages int
+}
+
+// Result reports what one pass did.
+type Result struct {
+	Conversations int `json:"conversations"`
+	Summaries     int `json:"summaries"`
+	Messages      int `json:"messages"`
+	// Skipped counts batches left alone because a message changed while it
+	// was being summarized.
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// Compactor summarizes old chat messages in every shard returned by Shards.
+type Compactor struct {
+	Shards     func() ([]*engine.Shard, error)
+	Summarizer Summarizer
+	Embedder   embed.Provider
+	Tokens     tokens.Counter
+	Policy     Policy
+	// Guard, if set, is read-locked around store reads and updates but not
+	// around LLM and embedding calls.
+	Guard *sync.RWMutex
+	// Normalize stores summary vectors scaled to unit length (see
+	// commands.Env.Normalize).
+	Normalize bool
+}
+
+// message is a stored chat message with its chunk contents.
+type message struct {
+	doc     types.Document
+	content string
+}
+
+func (c *Compactor) lock() func() {
+	if c.Guard == nil {
+		return func() {}
+	}
+	c.Guard.RLock()
+	return c.Guard.RUnlock
+}
+
+// Run compacts every interval until ctx is cancelled.
+func (c *Compactor) Run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			res, err := c.Compact(ctx)
+			if err != nil {
+				log.Printf("[compact] failed: %v", err)
+				continue
+			}
+			if res.Summaries > 0 || res.Skipped > 0 {
+				log.Printf("[compact] conversations=%d summaries=%d messages=%d skipped=%d",
+					res.Conversations, res.Summaries, res.Messages, res.Skipped)
+			}
+		}
+	}
+}
+
+// Compact runs one pass over every shard.
+func (c *Compactor) Compact(ctx context.Context) (Result, error) {
+	var res Result
+	if c.Policy.MaxAge <= 0 && c.Policy.KeepRecent <= 0 {
+		return res, errors.New("compaction policy needs a maximum age or a number of messages to keep")
+	}
+	if c.Summarizer == nil || c.Embedder == nil {
+		return res, errors.New("compaction needs a summarizer and an embedding provider")
+	}
+
+	unlock := c.lock()
+	shards, err := c.Shards()
+	unlock()
+	if err != nil {
+		return res, err
+	}
+	for _, sh := range shards {
+		if err := c.compactShard(ctx, sh, &res); err != nil {
+			return res, fmt.Errorf("namespace %s: %w", sh.Namespace, err)
+		}
+	}
+	return res, nil
+}
+
+func (c *Compactor) compactShard(ctx context.Context, sh *engine.Shard, res *Result) error {
+	convs, err := c.conversations(sh)
+	if err != nil {
+		return err
+	}
+
+	minN, maxN := c.Policy.MinMessages, c.Policy.MaxMessages
+	if minN <= 0 {
+		minN = DefaultMinMessages
+	}
+	if maxN <= 0 {
+		maxN = DefaultMaxMessages
+	}
+
+	for _, msgs := range convs {
+		n := c.eligible(msgs)
+		if n < minN {
+			continue
+		}
+		res.Conversations++
+		for start := 0; start+minN <= n; start += maxN {
+			end := start + maxN
+			if end > n {
+				end = n
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			done, err := c.summarize(ctx, sh, msgs[start:end])
+			if err != nil {
+				return err
+			}
+			if !done {
+				res.Skipped++
+				continue
+			}
+			res.Summaries++
+			res.Messages += end - start
+		}
+	}
+	return nil
+}
+
+// conversations returns the chat messages of sh grouped by namespace and
+// conversation, oldest first.
+func (c *Compactor) conversations(sh *engine.Shard) ([][]message, error) {
+	defer c.lock()()
+
+	byDoc := map[string]*message{}
+	groups := map[string][]*message{}
+	err := sh.Meta.ForEachDocument(func(doc types.Document) error {
+		if doc.Metadata["type"] != "chat_message" {
+			return nil
+		}
+		ns, _ := doc.Metadata["namespace"].(string)
+		conv, _ := doc.Metadata["conversation_id"].(string)
+		m := &message{doc: doc}
+		byDoc[doc.ID] = m
+		key := ns + "\x00" + conv
+		groups[key] = append(groups[key], m)
+		return nil
+	})
+	if err != nil || len(byDoc) == 0 {
+		return nil, err
+	}
+	err = sh.Meta.ForEachChunk(func(ch types.Chunk) error {
+		if m, ok := byDoc[ch.DocID]; ok {
+			if m.content != "" {
+				m.content += "\n"
+			}
+			m.content += ch.Content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([][]message, 0, len(keys))
+	for _, k := range keys {
+		g := groups[k]
+		sort.SliceStable(g, func(i, j int) bool { return g[i].doc.Timestamp.Before(g[j].doc.Timestamp) })
+		msgs := make([]message, len(g))
+		for i, m := range g {
+			msgs[i] = *m
+		}
+		out = append(out, msgs)
+	}
+	return out, nil
+}
+
+// eligible returns how many of the oldest msgs the policy compacts. Both
+// rules select a prefix of a chronologically sorted conversation.
+func (c *Compactor) eligible(msgs []message) int {
+	n := 0
+	if k := c.Policy.KeepRecent; k > 0 && len(msgs) > k {
+		n = len(msgs) - k
+	}
+	if c.Policy.MaxAge > 0 {
+		cutoff := time.Now().Add(-c.Policy.MaxAge)
+		for n < len(msgs) && msgs[n].doc.Timestamp.Before(cutoff) {
+			n++
+		}
+	}
+	return n
+}
+
+// summarize replaces msgs with one summary document. It reports false, and
+// changes nothing, when a message was edited or removed in the meantime.
+func (c *Compactor) summarize(ctx context.Context, sh *engine.Shard, msgs []message) (bool, error) {
+	var b strings.Builder
+	sources := make([]string, len(msgs))
+	for i, m := range msgs {
+		role, _ := m.doc.Metadata["role"].(string)
+		fmt.Fprintf(&b, "[%s] %s: %s\n\n", m.doc.Timestamp.UTC().Format(time.RFC3339), role, m.content)
+		sources[i] = m.doc.ID
+	}
+
+	summary, err := c.Summarizer.Summarize(ctx, b.String())
+	if err != nil {
+		return false, fmt.Errorf("summarize %d messages: %w", len(msgs), err)
+	}
+	vecs, err := c.Embedder.Embed(ctx, []string{summary})
+	if err == nil && len(vecs) != 1 {
+		err = fmt.Errorf("got %d vectors for 1 summary", len(vecs))
+	}
+	if err != nil {
+		return false, fmt.Errorf("embed summary: %w", err)
+	}
+
+	defer c.lock()()
+
+	for _, m := range msgs {
+		cur, err := sh.Meta.GetDocument(m.doc.ID)
+		if err != nil || cur.Metadata["content_sha256"] != m.doc.Metadata["content_sha256"] {
+			return false, nil
+		}
+	}
+
+	last := msgs[len(msgs)-1].doc
+	doc := types.Document{
+		ID:        ids.Summary(fmt.Sprint(last.Metadata["conversation_id"]), sources),
+		Source:    "summary",
+		Timestamp: last.Timestamp,
+		Metadata: types.Metadata{
+			"namespace":       last.Metadata["namespace"],
+			"conversation_id": last.Metadata["conversation_id"],
+			"type":            "summary",
+			"source_ids":      sources,
+			"summarizer":      c.Summarizer.Name(),
+			"first_timestamp": msgs[0].doc.Timestamp.UTC().Format(time.RFC3339),
+		},
+	}
+	if c.Normalize {
+		vecs[0], _ = engine.Unit(vecs[0])
+	}
+	id, err := sh.Vectors.Append(vecs[0])
+	if err != nil {
+		return false, fmt.Errorf("append summary vector: %w", err)
+	}
+	if err := sh.Meta.SaveDocumentWithChunks(doc, []types.Chunk{{
+		ID:         id,
+		DocID:      doc.ID,
+		Content:    summary,
+		TokenCount: c.countTokens(summary),
+	}}); err != nil {
+		return false, fmt.Errorf("save summary %s: %w", doc.ID, err)
+	}
+	sh.Index.Add(id, vecs[0])
+
+	for _, src := range sources {
+		if _, err := sh.Engine.DeleteDocument(src); err != nil {
+			return false, fmt.Errorf("delete %s: %w", src, err)
+		}
+	}
+	return true, nil
+}
+
+func (c *Compactor) countTokens(text string) int {
+	if c.Tokens == nil {
+		return tokens.Heuristic().Count(text)
+	}
+	return c.Tokens.Count(text)
+}
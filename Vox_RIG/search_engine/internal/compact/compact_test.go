@@ -0,0 +1,110 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/types"
+)
+
+// fakeEmbedder maps every text to a 2-d vector derived from its length.
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Name() string { return "fake" }
+func (fakeEmbedder) Dim() int     { return 2 }
+func (fakeEmbedder) Embed(_ context.Context, texts []string) ([]types.Vector, error) {
+	out := make([]types.Vector, len(texts))
+	for i, t := range texts {
+		out[i] = types.Vector{float32(len(t)), 1}
+	}
+	return out, nil
+}
+
+// fakeSummarizer records transcripts and returns their line count.
+type fakeSummarizer struct{ transcripts []string }
+
+func (*fakeSummarizer) Name() string { return "fake" }
+func (f *fakeSummarizer) Summarize(_ context.Context, transcript string) (string, error) {
+	f.transcripts = append(f.transcripts, transcript)
+	return fmt.Sprintf("summary of %d messages", strings.Count(transcript, "\n\n")), nil
+}
+
+func TestCompact(t *testing.T) {
+	shards, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewShardManager failed: %v", err)
+	}
+	defer shards.Close()
+	env := commands.Env{Resolve: shards.Get}
+
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 8; i++ {
+		ts := old.Add(time.Duration(i) * time.Minute)
+		if i >= 6 {
+			ts = time.Now()
+		}
+		if _, err := commands.IngestMessage(context.Background(), env, commands.IngestMessageRequest{
+			Namespace: "ns", ConversationID: "c", MessageID: fmt.Sprint(i), Role: "user",
+			Content: fmt.Sprintf("message %d", i), Vector: types.Vector{1, 0},
+			TimestampUTC: ts.UTC().Format(time.RFC3339),
+		}); err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+	}
+
+	sum := &fakeSummarizer{}
+	c := &Compactor{
+		Shards:     func() ([]*engine.Shard, error) { return shards.All() },
+		Summarizer: sum,
+		Embedder:   fakeEmbedder{},
+		Policy:     Policy{MaxAge: 24 * time.Hour},
+	}
+	res, err := c.Compact(context.Background())
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if res.Summaries != 1 || res.Messages != 6 {
+		t.Errorf("Expected 6 messages in 1 summary, got %+v", res)
+	}
+	if len(sum.transcripts) != 1 || !strings.Contains(sum.transcripts[0], "user: message 0") ||
+		strings.Contains(sum.transcripts[0], "message 6") {
+		t.Errorf("Unexpected transcript: %q", sum.transcripts)
+	}
+
+	sh, _ := shards.Get("ns")
+	if _, err := sh.Meta.GetDocument("chat:c:0"); err == nil {
+		t.Errorf("Expected compacted message to be deleted")
+	}
+	if _, err := sh.Meta.GetDocument("chat:c:7"); err != nil {
+		t.Errorf("Expected recent message to be kept: %v", err)
+	}
+
+	var summary *types.Document
+	sh.Meta.ForEachDocument(func(d types.Document) error {
+		if d.Metadata["type"] == "summary" {
+			summary = &d
+		}
+		return nil
+	})
+	if summary == nil {
+		t.Fatalf("Summary document not found")
+	}
+	if srcs, _ := summary.Metadata["source_ids"].([]any); len(srcs) != 6 || summary.Metadata["conversation_id"] != "c" {
+		t.Errorf("Unexpected summary metadata: %+v", summary.Metadata)
+	}
+
+	res, err = c.Compact(context.Background())
+	if err != nil || res.Summaries != 0 {
+		t.Errorf("Expected nothing left to compact, got %+v (%v)", res, err)
+	}
+
+	c.Policy = Policy{}
+	if _, err := c.Compact(context.Background()); err == nil {
+		t.Errorf("Expected an error for an empty policy")
+	}
+}
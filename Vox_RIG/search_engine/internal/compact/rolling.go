@@ -0,0 +1,296 @@
+package compact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/embed"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/tokens"
+	"vox-vector-engine/internal/types"
+)
+
+// TypeRollingSummary is the metadata type of rolling summary documents.
+const TypeRollingSummary = "rolling_summary"
+
+// Roller keeps one rolling summary document per conversation
+// (ids.RollingSummary), refreshed every Every new messages. A refresh sends
+// the previous summary and only the messages since to the summarizer, so
+// its cost does not grow with the conversation. Unlike compaction nothing
+// is deleted: the summary is an extra document, small enough to pin.
+type Roller struct {
+	// Resolve returns the shard that stores namespace ns.
+	Resolve    func(ns string) (*engine.Shard, error)
+	Summarizer Summarizer
+	Embedder   embed.Provider
+	Tokens     tokens.Counter
+	// Every is how many new messages of a conversation trigger a refresh.
+	Every int
+	// Guard, if set, is read-locked around store reads and updates but not
+	// around LLM and embedding calls.
+	Guard *sync.RWMutex
+	// Normalize stores summary vectors scaled to unit length (see
+	// commands.Env.Normalize).
+	Normalize bool
+
+	mu sync.Mutex
+	// pending counts the messages noted since the last refresh and running
+	// marks refreshes in flight, both by namespace and conversation.
+	pending map[string]int
+	running map[string]bool
+}
+
+// With returns a Roller with r's settings over other stores.
+func (r *Roller) With(resolve func(ns string) (*engine.Shard, error), guard *sync.RWMutex) *Roller {
+	return &Roller{Resolve: resolve, Summarizer: r.Summarizer, Embedder: r.Embedder, Tokens: r.Tokens, Every: r.Every, Guard: guard, Normalize: r.Normalize}
+}
+
+func (r *Roller) lock() func() {
+	if r.Guard == nil {
+		return func() {}
+	}
+	r.Guard.RLock()
+	return r.Guard.RUnlock
+}
+
+// Note records a new message of conversation conv in namespace ns. Every
+// Every messages it refreshes the conversation's summary in the background;
+// counts are not persisted, so a restart delays the next refresh.
+func (r *Roller) Note(ns, conv string) {
+	if r.Every <= 0 {
+		return
+	}
+	key := ns + "\x00" + conv
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending, r.running = map[string]int{}, map[string]bool{}
+	}
+	r.pending[key]++
+	if r.pending[key] < r.Every || r.running[key] {
+		return
+	}
+	r.pending[key] = 0
+	r.running[key] = true
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.running, key)
+			r.mu.Unlock()
+		}()
+		doc, err := r.Refresh(context.Background(), ns, conv)
+		if err != nil {
+			log.Printf("[summary] namespace=%s conversation_id=%s refresh failed: %v", ns, conv, err)
+			return
+		}
+		if doc != nil {
+			log.Printf("[summary] namespace=%s conversation_id=%s refreshed messages=%v", ns, conv, doc.Metadata["messages"])
+		}
+	}()
+}
+
+// RefreshPending refreshes the summaries of the conversations with messages
+// noted since their last refresh, fewer than Every, and returns how many
+// it refreshed. It stops at the first error or when ctx ends.
+func (r *Roller) RefreshPending(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	var keys []string
+	for key, n := range r.pending {
+		if n > 0 && !r.running[key] {
+			r.pending[key] = 0
+			r.running[key] = true
+			keys = append(keys, key)
+		}
+	}
+	r.mu.Unlock()
+	sort.Strings(keys)
+
+	done := 0
+	var err error
+	for i, key := range keys {
+		if err = ctx.Err(); err == nil {
+			ns, conv, _ := strings.Cut(key, "\x00")
+			_, err = r.Refresh(ctx, ns, conv)
+		}
+		r.mu.Lock()
+		delete(r.running, key)
+		if err != nil {
+			// Left for the next pass.
+			for _, k := range keys[i:] {
+				r.pending[k]++
+				delete(r.running, k)
+			}
+		}
+		r.mu.Unlock()
+		if err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+// Refresh brings the rolling summary of a conversation up to date and
+// returns it; nil when the conversation has no messages.
+func (r *Roller) Refresh(ctx context.Context, ns, conv string) (*types.Document, error) {
+	if r.Summarizer == nil || r.Embedder == nil {
+		return nil, errors.New("rolling summaries need a summarizer and an embedding provider")
+	}
+	unlock := r.lock()
+	sh, err := r.Resolve(ns)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	prev, summary, err := RollingSummary(sh, conv)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	var through time.Time
+	covered := 0
+	if prev != nil {
+		through, _ = time.Parse(time.RFC3339Nano, fmt.Sprint(prev.Metadata["through"]))
+		covered = metadataInt(prev.Metadata["messages"])
+	}
+	msgs, err := newMessages(sh, ns, conv, through)
+	unlock()
+	if err != nil || len(msgs) == 0 {
+		return prev, err
+	}
+
+	for start := 0; start < len(msgs); start += DefaultMaxMessages {
+		batch := msgs[start:min(start+DefaultMaxMessages, len(msgs))]
+		var b strings.Builder
+		if summary != "" {
+			b.WriteString("Summary of the conversation so far:\n" + summary + "\n\nNew messages:\n")
+		}
+		for _, m := range batch {
+			role, _ := m.doc.Metadata["role"].(string)
+			fmt.Fprintf(&b, "[%s] %s: %s\n\n", m.doc.Timestamp.UTC().Format(time.RFC3339), role, m.content)
+		}
+		if summary, err = r.Summarizer.Summarize(ctx, b.String()); err != nil {
+			return nil, fmt.Errorf("summarize %d messages: %w", len(batch), err)
+		}
+	}
+	vecs, err := r.Embedder.Embed(ctx, []string{summary})
+	if err == nil && len(vecs) != 1 {
+		err = fmt.Errorf("got %d vectors for 1 summary", len(vecs))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("embed summary: %w", err)
+	}
+
+	defer r.lock()()
+	last := msgs[len(msgs)-1].doc
+	doc := types.Document{
+		ID:        ids.RollingSummary(conv),
+		Source:    "summary",
+		Timestamp: last.Timestamp,
+		Metadata: types.Metadata{
+			"namespace":       ns,
+			"conversation_id": conv,
+			"type":            TypeRollingSummary,
+			"summarizer":      r.Summarizer.Name(),
+			"messages":        covered + len(msgs),
+			"through":         last.Timestamp.UTC().Format(time.RFC3339Nano),
+		},
+	}
+	if prev != nil {
+		doc.Tags = prev.Tags
+	}
+	if r.Normalize {
+		vecs[0], _ = engine.Unit(vecs[0])
+	}
+	id, err := sh.Vectors.Append(vecs[0])
+	if err != nil {
+		return nil, fmt.Errorf("append summary vector: %w", err)
+	}
+	if _, err := sh.Engine.DeleteDocument(doc.ID); err != nil {
+		return nil, fmt.Errorf("replace summary %s: %w", doc.ID, err)
+	}
+	if err := sh.Meta.SaveDocumentWithChunks(doc, []types.Chunk{{
+		ID:         id,
+		DocID:      doc.ID,
+		Content:    summary,
+		TokenCount: r.countTokens(summary),
+	}}); err != nil {
+		return nil, fmt.Errorf("save summary %s: %w", doc.ID, err)
+	}
+	sh.Index.Add(id, vecs[0])
+	return &doc, nil
+}
+
+// RollingSummary returns the rolling summary document of conv stored in sh
+// and its text; nil when there is none yet.
+func RollingSummary(sh *engine.Shard, conv string) (*types.Document, string, error) {
+	doc, err := sh.Meta.GetDocument(ids.RollingSummary(conv))
+	if err != nil {
+		return nil, "", nil
+	}
+	chunks, err := sh.Meta.DocumentChunks(doc.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	var text []string
+	for _, c := range chunks {
+		text = append(text, c.Content)
+	}
+	return doc, strings.Join(text, "\n"), nil
+}
+
+// newMessages returns the chat messages of conversation conv in namespace ns
+// stored after through, oldest first, with their content.
+func newMessages(sh *engine.Shard, ns, conv string, through time.Time) ([]message, error) {
+	var msgs []message
+	err := sh.Meta.ForEachDocument(func(doc types.Document) error {
+		if doc.Metadata["type"] == "chat_message" && doc.Metadata["namespace"] == ns &&
+			doc.Metadata["conversation_id"] == conv && doc.Timestamp.After(through) {
+			msgs = append(msgs, message{doc: doc})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].doc.Timestamp.Before(msgs[j].doc.Timestamp) })
+	for i := range msgs {
+		chunks, err := sh.Meta.DocumentChunks(msgs[i].doc.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			if msgs[i].content != "" {
+				msgs[i].content += "\n"
+			}
+			msgs[i].content += c.Content
+		}
+	}
+	return msgs, nil
+}
+
+// metadataInt reads a count stored in metadata, which comes back from JSON
+// as float64.
+func metadataInt(v any) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+func (r *Roller) countTokens(text string) int {
+	if r.Tokens == nil {
+		return tokens.Heuristic().Count(text)
+	}
+	return r.Tokens.Count(text)
+}
@@ -0,0 +1,82 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/types"
+)
+
+func TestRollingSummary(t *testing.T) {
+	shards, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewShardManager failed: %v", err)
+	}
+	defer shards.Close()
+	env := commands.Env{Resolve: shards.Get}
+
+	start := time.Now().Add(-time.Hour)
+	ingest := func(i int) {
+		if _, err := commands.IngestMessage(context.Background(), env, commands.IngestMessageRequest{
+			Namespace: "ns", ConversationID: "c", MessageID: fmt.Sprint(i), Role: "user",
+			Content: fmt.Sprintf("message %d", i), Vector: types.Vector{1, 0},
+			TimestampUTC: start.Add(time.Duration(i) * time.Minute).UTC().Format(time.RFC3339),
+		}); err != nil {
+			t.Fatalf("IngestMessage failed: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		ingest(i)
+	}
+
+	sum := &fakeSummarizer{}
+	r := &Roller{Resolve: shards.Get, Summarizer: sum, Embedder: fakeEmbedder{}, Every: 2}
+	doc, err := r.Refresh(context.Background(), "ns", "other")
+	if err != nil || doc != nil {
+		t.Fatalf("Expected no summary for an empty conversation, got %+v, %v", doc, err)
+	}
+	if doc, err = r.Refresh(context.Background(), "ns", "c"); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if doc == nil || doc.Metadata["messages"] != 3 || doc.Metadata["type"] != TypeRollingSummary {
+		t.Fatalf("Expected a summary of 3 messages, got %+v", doc)
+	}
+
+	ingest(3)
+	if doc, err = r.Refresh(context.Background(), "ns", "c"); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if len(sum.transcripts) != 2 {
+		t.Fatalf("Expected 2 summarizer calls, got %d", len(sum.transcripts))
+	}
+	incr := sum.transcripts[1]
+	if !strings.Contains(incr, "summary of 3 messages") || !strings.Contains(incr, "message 3") ||
+		strings.Contains(incr, "message 2") {
+		t.Errorf("Expected the previous summary and only the new message, got %q", incr)
+	}
+	if doc.Metadata["messages"] != 4 {
+		t.Errorf("Expected 4 messages covered, got %v", doc.Metadata["messages"])
+	}
+
+	sh, _ := shards.Get("ns")
+	stored, text, err := RollingSummary(sh, "c")
+	if err != nil || stored == nil || !strings.HasPrefix(text, "summary of ") || text == "summary of 3 messages" {
+		t.Errorf("Expected the stored summary to be replaced, got %q, %v", text, err)
+	}
+	if n := metadataInt(stored.Metadata["messages"]); n != 4 {
+		t.Errorf("Expected 4 messages in the stored summary, got %d", n)
+	}
+
+	// Nothing new: no summarizer call.
+	if _, err := r.Refresh(context.Background(), "ns", "c"); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if len(sum.transcripts) != 2 {
+		t.Errorf("Expected no summarizer call without new messages, got %d", len(sum.transcripts))
+	}
+}
@@ -0,0 +1,128 @@
+package compact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Summarizer condenses a slice of a conversation into one piece of text.
+type Summarizer interface {
+	// Name identifies the summarizer and model in logs and metadata.
+	Name() string
+	Summarize(ctx context.Context, transcript string) (string, error)
+}
+
+// Prompt is the system prompt sent with every transcript.
+const Prompt = "Summarize this excerpt of a conversation between a developer and a coding assistant " +
+	"so it can stand in for the original messages in long-term memory. Keep decisions, facts, " +
+	"file and symbol names, and open questions. Write plain prose, no preamble."
+
+// ChatSummarizer summarizes through any server that implements the OpenAI
+// POST /chat/completions shape (OpenAI, Ollama's /v1, LM Studio, llama.cpp).
+type ChatSummarizer struct {
+	name    string
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+// FromSpec builds a summarizer from a "-summarize" flag value of the form
+// "<kind>:<model>", e.g. "ollama:llama3.1" or "openai:gpt-4o-mini". baseURL
+// overrides the default endpoint. The OpenAI key is read from
+// VOX_SUMMARIZE_API_KEY, falling back to OPENAI_API_KEY.
+func FromSpec(spec, baseURL string) (*ChatSummarizer, error) {
+	kind, model, ok := strings.Cut(spec, ":")
+	if !ok || model == "" {
+		return nil, fmt.Errorf("invalid summarize spec %q: want <provider>:<model>", spec)
+	}
+	s := &ChatSummarizer{
+		name:   spec,
+		model:  model,
+		client: &http.Client{Timeout: 120 * time.Second},
+	}
+	switch kind {
+	case "ollama":
+		s.baseURL = "http://localhost:11434/v1"
+	case "openai":
+		s.baseURL = "https://api.openai.com/v1"
+		s.apiKey = os.Getenv("VOX_SUMMARIZE_API_KEY")
+		if s.apiKey == "" {
+			s.apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+	default:
+		return nil, fmt.Errorf("unknown summarize provider %q", kind)
+	}
+	if baseURL != "" {
+		s.baseURL = baseURL
+	}
+	s.baseURL = strings.TrimRight(s.baseURL, "/")
+	return s, nil
+}
+
+func (s *ChatSummarizer) Name() string { return s.name }
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (s *ChatSummarizer) Summarize(ctx context.Context, transcript string) (string, error) {
+	body, err := json.Marshal(chatRequest{
+		Model: s.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: Prompt},
+			{Role: "user", Content: transcript},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var out chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if len(out.Choices) == 0 || strings.TrimSpace(out.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("empty summary from %s", s.name)
+	}
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
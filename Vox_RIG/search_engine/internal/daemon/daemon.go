@@ -0,0 +1,258 @@
+// Package daemon runs the engine as a background service: it records the
+// server's PID in the data directory, sends the log to a rotating file there
+// and turns stop requests into a clean shutdown, the same way on Windows,
+// macOS and Linux, so an IDE or a shell script can start, find and stop it.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Files the daemon keeps in the data directory.
+const (
+	PIDFileName  = "vox.pid"
+	LogFileName  = "vox.log"
+	StopFileName = "vox.stop"
+)
+
+// Defaults for Options.
+const (
+	DefaultLogMaxBytes = 100 << 20
+	DefaultLogKeep     = 5
+	DefaultStopTimeout = 30 * time.Second
+)
+
+// stopPoll is how often a daemon looks for a stop file and Stop looks for
+// the daemon to exit.
+const stopPoll = 250 * time.Millisecond
+
+var (
+	// ErrRunning is returned by Start when the PID file names a live process.
+	ErrRunning = errors.New("engine already running")
+	// ErrNotRunning is returned by Stop when no daemon runs in the directory.
+	ErrNotRunning = errors.New("engine not running")
+)
+
+// Options configure Start.
+type Options struct {
+	// LogMaxBytes rotates the log once it would grow past this size; 0 uses
+	// DefaultLogMaxBytes.
+	LogMaxBytes int64
+	// LogKeep is how many rotated logs (vox.log.1 …) are kept; 0 uses
+	// DefaultLogKeep.
+	LogKeep int
+}
+
+// Daemon is a running background server.
+type Daemon struct {
+	dir  string
+	log  *RotatingFile
+	sigs chan os.Signal
+	stop chan struct{}
+	once sync.Once
+	quit chan struct{}
+	// svcDone is closed when the Windows service control loop has reported
+	// the service stopped; nil when not running as a service.
+	svcDone <-chan struct{}
+}
+
+// Start turns the current process into the daemon of dir: it writes the
+// PID file, points the standard logger at the rotating log and starts
+// listening for stop requests (SIGINT, SIGTERM, a stop file left by Stop,
+// or the Windows service manager when started as a service) and for log
+// reopen requests (SIGHUP, outside Windows). Call Close on exit.
+func Start(dir string, opts Options) (*Daemon, error) {
+	if pid, err := ReadPID(dir); err == nil && pid != os.Getpid() && processAlive(pid) {
+		return nil, fmt.Errorf("%w (pid %d)", ErrRunning, pid)
+	}
+	if opts.LogMaxBytes <= 0 {
+		opts.LogMaxBytes = DefaultLogMaxBytes
+	}
+	if opts.LogKeep <= 0 {
+		opts.LogKeep = DefaultLogKeep
+	}
+	lf, err := OpenRotatingFile(filepath.Join(dir, LogFileName), opts.LogMaxBytes, opts.LogKeep)
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(filepath.Join(dir, StopFileName))
+	if err := writePID(filepath.Join(dir, PIDFileName)); err != nil {
+		lf.Close()
+		return nil, err
+	}
+
+	d := &Daemon{
+		dir:  dir,
+		log:  lf,
+		sigs: make(chan os.Signal, 1),
+		stop: make(chan struct{}),
+		quit: make(chan struct{}),
+	}
+	signal.Notify(d.sigs, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, reopenSignals...)...)
+	log.SetOutput(lf)
+	go d.loop()
+	d.svcDone = runService(d)
+	return d, nil
+}
+
+// Done is closed once a stop has been requested.
+func (d *Daemon) Done() <-chan struct{} { return d.stop }
+
+// Log returns the rotating log file.
+func (d *Daemon) Log() *RotatingFile { return d.log }
+
+func (d *Daemon) loop() {
+	tick := time.NewTicker(stopPoll)
+	defer tick.Stop()
+	stopFile := filepath.Join(d.dir, StopFileName)
+	for {
+		select {
+		case sig := <-d.sigs:
+			if isReopen(sig) {
+				if err := d.log.Reopen(); err != nil {
+					log.Printf("[daemon] reopen log: %v", err)
+				} else {
+					log.Printf("[daemon] log reopened")
+				}
+				continue
+			}
+			d.requestStop(sig.String() + " received")
+		case <-tick.C:
+			if _, err := os.Stat(stopFile); err != nil {
+				continue
+			}
+			d.requestStop("stop requested")
+		case <-d.stop:
+		case <-d.quit:
+			return
+		}
+		// A second signal finds nobody listening and kills the process the
+		// usual way.
+		signal.Reset()
+		return
+	}
+}
+
+func (d *Daemon) requestStop(why string) {
+	d.once.Do(func() {
+		log.Printf("[daemon] %s, stopping", why)
+		close(d.stop)
+	})
+}
+
+// Close removes the PID and stop files, restores the standard logger and
+// closes the log.
+func (d *Daemon) Close() error {
+	signal.Stop(d.sigs)
+	close(d.quit)
+	_ = os.Remove(filepath.Join(d.dir, StopFileName))
+	err := os.Remove(filepath.Join(d.dir, PIDFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if d.svcDone != nil {
+		// Let the service manager hear that the service stopped before the
+		// process exits.
+		select {
+		case <-d.svcDone:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	log.SetOutput(os.Stderr)
+	if cerr := d.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadPID returns the PID recorded in dir's PID file.
+func ReadPID(dir string) (int, error) {
+	b, err := os.ReadFile(filepath.Join(dir, PIDFileName))
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", filepath.Join(dir, PIDFileName))
+	}
+	return pid, nil
+}
+
+// writePID writes the PID file through a temporary file, so readers never
+// see it half written.
+func writePID(path string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Stop asks the daemon of dir to shut down and waits up to timeout for it to
+// exit, returning its PID. A PID file left behind by a dead process is
+// removed and reported as ErrNotRunning.
+func Stop(dir string, timeout time.Duration) (int, error) {
+	pid, err := ReadPID(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotRunning
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !processAlive(pid) {
+		_ = os.Remove(filepath.Join(dir, PIDFileName))
+		return pid, fmt.Errorf("%w (stale PID file for pid %d removed)", ErrNotRunning, pid)
+	}
+	// The stop file works everywhere, including Windows, which cannot
+	// deliver SIGTERM; elsewhere the signal is also sent so the daemon
+	// need not wait for its next poll.
+	if err := os.WriteFile(filepath.Join(dir, StopFileName), nil, 0o644); err != nil {
+		return pid, err
+	}
+	_ = signalStop(pid)
+
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return pid, nil
+		}
+		time.Sleep(stopPoll)
+	}
+	return pid, fmt.Errorf("pid %d did not exit within %s", pid, timeout)
+}
+
+// Uninstall stops the daemon of dir, if one runs, and removes the files the
+// daemon mode leaves there: the PID and stop files and the logs. The
+// engine's data is kept.
+func Uninstall(dir string, timeout time.Duration) ([]string, error) {
+	if _, err := Stop(dir, timeout); err != nil && !errors.Is(err, ErrNotRunning) {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, LogFileName+"*"))
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, filepath.Join(dir, PIDFileName), filepath.Join(dir, StopFileName))
+	var removed []string
+	for _, p := range paths {
+		if err := os.Remove(p); err == nil {
+			removed = append(removed, p)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
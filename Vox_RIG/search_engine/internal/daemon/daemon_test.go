@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LogFileName)
+	r, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer r.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		if b, err := os.ReadFile(name); err != nil || string(b) != want {
+			t.Errorf("Expected %s to hold %q, got %q (%v)", name, want, b, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected only %d rotated logs to be kept", 2)
+	}
+
+	// An external tool moves the log aside; Reopen starts a new one.
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	r.Write([]byte("fifth\n"))
+	if b, err := os.ReadFile(path); err != nil || string(b) != "fifth\n" {
+		t.Errorf("Expected the reopened log to hold the new line, got %q (%v)", b, err)
+	}
+}
+
+func TestStartStopFile(t *testing.T) {
+	dir := t.TempDir()
+	d, err := Start(dir, Options{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if pid, err := ReadPID(dir); err != nil || pid != os.Getpid() {
+		t.Fatalf("Expected the PID file to hold %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, StopFileName), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-d.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the stop file to stop the daemon")
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for _, name := range []string{PIDFileName, StopFileName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s to be removed", name)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, LogFileName)); err != nil || !strings.Contains(string(b), "stop requested") {
+		t.Errorf("Expected the stop to be logged, got %q (%v)", b, err)
+	}
+}
+
+func TestStopNotRunning(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Stop(dir, time.Second); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning without a PID file, got %v", err)
+	}
+
+	// A PID that cannot belong to a live process.
+	if err := os.WriteFile(filepath.Join(dir, PIDFileName), []byte(strconv.Itoa(1<<30)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Stop(dir, time.Second); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning for a stale PID file, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, PIDFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the stale PID file to be removed")
+	}
+
+	os.WriteFile(filepath.Join(dir, LogFileName), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(dir, LogFileName+".1"), []byte("x"), 0o644)
+	removed, err := Uninstall(dir, time.Second)
+	if err != nil || len(removed) != 2 {
+		t.Errorf("Expected both logs removed, got %v (%v)", removed, err)
+	}
+}
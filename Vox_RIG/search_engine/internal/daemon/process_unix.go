@@ -0,0 +1,28 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reopenSignals ask the daemon to reopen its log after external rotation.
+var reopenSignals = []os.Signal{unix.SIGHUP}
+
+func isReopen(sig os.Signal) bool { return sig == unix.SIGHUP }
+
+func processAlive(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
+
+func signalStop(pid int) error {
+	return unix.Kill(pid, unix.SIGTERM)
+}
+
+// runService does nothing: outside Windows, service managers such as
+// systemd stop the daemon with SIGTERM.
+func runService(*Daemon) <-chan struct{} { return nil }
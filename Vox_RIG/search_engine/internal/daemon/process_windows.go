@@ -0,0 +1,77 @@
+//go:build windows
+
+package daemon
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+)
+
+// reopenSignals is empty: Windows has no SIGHUP, and the log rotates itself.
+var reopenSignals []os.Signal
+
+func isReopen(os.Signal) bool { return false }
+
+// stillActive is the exit code GetExitCodeProcess reports for a running
+// process.
+const stillActive = 259
+
+func processAlive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// Access denied still means the process exists.
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// signalStop does nothing: Windows cannot deliver SIGTERM to another
+// console's process, so Stop relies on the stop file alone.
+func signalStop(int) error { return nil }
+
+// runService, when the process was started by the Windows service manager,
+// answers its control requests: a stop or shutdown stops the daemon like a
+// signal would. The service is reported stopped once Close runs.
+func runService(d *Daemon) <-chan struct{} {
+	if ok, err := svc.IsWindowsService(); err != nil || !ok {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := svc.Run("", serviceHandler{d}); err != nil {
+			log.Printf("[daemon] service control: %v", err)
+		}
+	}()
+	return done
+}
+
+type serviceHandler struct{ d *Daemon }
+
+func (h serviceHandler) Execute(_ []string, req <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case c := <-req:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				h.d.requestStop("service stop requested")
+			}
+		case <-h.d.stop:
+			status <- svc.Status{State: svc.StopPending, WaitHint: uint32(DefaultStopTimeout / time.Millisecond)}
+			<-h.d.quit
+			return false, 0
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an append-only log file that rotates itself: once a write
+// would take it past maxBytes it is renamed to <path>.1 (shifting older
+// logs up to <path>.<keep>, the oldest being dropped) and a new file is
+// started. Rotating in-process works on Windows, where an open file cannot
+// be renamed by logrotate and friends.
+type RotatingFile struct {
+	path     string
+	maxBytes int64
+	keep     int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending.
+func OpenRotatingFile(path string, maxBytes int64, keep int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxBytes: maxBytes, keep: keep}
+	if err := r.openLocked(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Path returns the file being written.
+func (r *RotatingFile) Path() string { return r.path }
+
+func (r *RotatingFile) openLocked() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open log: %w", err)
+	}
+	r.file, r.size = f, fi.Size()
+	return nil
+}
+
+// Write appends p, rotating first when p would not fit. A single write is
+// never split across files.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotateLocked(); err != nil {
+			// Keep logging to the full file rather than losing lines.
+			fmt.Fprintf(os.Stderr, "rotate log: %v\n", err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate starts a new file now.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.rotateLocked()
+}
+
+func (r *RotatingFile) rotateLocked() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+	_ = os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+	for i := r.keep - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	var err error
+	if r.keep > 0 {
+		err = os.Rename(r.path, r.path+".1")
+	} else {
+		err = os.Truncate(r.path, 0)
+	}
+	if oerr := r.openLocked(); oerr != nil {
+		return oerr
+	}
+	return err
+}
+
+// Reopen closes and reopens the file by name, for external rotation tools
+// that move the log aside and then signal the process (SIGHUP).
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+	return r.openLocked()
+}
+
+// Close closes the file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
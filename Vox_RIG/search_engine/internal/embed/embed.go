@@ -0,0 +1,19 @@
+// Package embed defines how the engine turns text into vectors when callers
+// send raw text instead of precomputed embeddings.
+package embed
+
+import (
+	"context"
+
+	"vox-vector-engine/internal/types"
+)
+
+// Provider embeds text. Implementations must return exactly one vector per
+// input text, in the same order, each of length Dim().
+type Provider interface {
+	// Name identifies the provider and model in logs and responses.
+	Name() string
+	// Dim is the length of the vectors returned by Embed.
+	Dim() int
+	Embed(ctx context.Context, texts []string) ([]types.Vector, error)
+}
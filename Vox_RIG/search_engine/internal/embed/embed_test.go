@@ -0,0 +1,98 @@
+package embed
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOllamaProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embeddings" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req ollamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Bad request body: %v", err)
+		}
+		if req.Model != "nomic-embed-text" {
+			t.Errorf("Expected model nomic-embed-text, got %s", req.Model)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"embedding": []float32{float32(len(req.Prompt)), 1}})
+	}))
+	defer srv.Close()
+
+	p, err := FromSpec("ollama:nomic-embed-text", srv.URL, 2)
+	if err != nil {
+		t.Fatalf("FromSpec failed: %v", err)
+	}
+	vecs, err := p.Embed(context.Background(), []string{"a", "abc"})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][0] != 3 {
+		t.Errorf("Unexpected vectors: %v", vecs)
+	}
+
+	wrongDim := NewOllamaProvider(srv.URL, "nomic-embed-text", 3)
+	if _, err := wrongDim.Embed(context.Background(), []string{"a"}); err == nil {
+		t.Errorf("Expected dim mismatch error")
+	}
+}
+
+func TestFromSpecRejectsUnknown(t *testing.T) {
+	for _, spec := range []string{"", "ollama", "ollama:", "bogus:model"} {
+		if _, err := FromSpec(spec, "", 2); err == nil {
+			t.Errorf("FromSpec(%q) expected error", spec)
+		}
+	}
+}
+
+func TestOpenAIProviderBatchesAndRetries(t *testing.T) {
+	var calls, failures atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		// Fail the very first request once to exercise the retry path.
+		if failures.CompareAndSwap(0, 1) {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Bad request body: %v", err)
+		}
+		if len(req.Input) > 2 {
+			t.Errorf("Expected batches of at most 2, got %d", len(req.Input))
+		}
+		data := make([]map[string]any, len(req.Input))
+		// Reply out of order; the provider must use "index".
+		for i := range req.Input {
+			j := len(req.Input) - 1 - i
+			data[i] = map[string]any{"index": j, "embedding": []float32{float32(len(req.Input[j])), 0}}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider(OpenAIOptions{BaseURL: srv.URL + "/v1", Model: "m", Dim: 2, BatchSize: 2, Concurrency: 2})
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	vecs, err := p.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	for i, v := range vecs {
+		if int(v[0]) != len(texts[i]) {
+			t.Errorf("Vector %d out of order: %v", i, v)
+		}
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("Expected 3 batches + 1 retry = 4 calls, got %d", got)
+	}
+}
@@ -0,0 +1,98 @@
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+const DefaultOllamaURL = "http://localhost:11434"
+
+// OllamaProvider embeds text with a local Ollama server via POST /api/embeddings.
+// Ollama takes one prompt per request, so texts are embedded sequentially.
+type OllamaProvider struct {
+	baseURL string
+	model   string
+	dim     int
+	client  *http.Client
+}
+
+// NewOllamaProvider returns a provider for model served at baseURL (empty
+// means DefaultOllamaURL). Every returned vector is checked against dim.
+func NewOllamaProvider(baseURL, model string, dim int) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	return &OllamaProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		dim:     dim,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (p *OllamaProvider) Name() string { return "ollama:" + p.model }
+func (p *OllamaProvider) Dim() int     { return p.dim }
+
+type ollamaRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type ollamaResponse struct {
+	Embedding types.Vector `json:"embedding"`
+}
+
+func (p *OllamaProvider) Embed(ctx context.Context, texts []string) ([]types.Vector, error) {
+	out := make([]types.Vector, 0, len(texts))
+	for i, text := range texts {
+		vec, err := p.embedOne(ctx, text)
+		if err != nil {
+			return nil, fmt.Errorf("ollama embed %d/%d: %w", i+1, len(texts), err)
+		}
+		out = append(out, vec)
+	}
+	return out, nil
+}
+
+func (p *OllamaProvider) embedOne(ctx context.Context, text string) (types.Vector, error) {
+	body, err := json.Marshal(ollamaRequest{Model: p.model, Prompt: text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var out ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(out.Embedding) == 0 {
+		return nil, fmt.Errorf("empty embedding (is %q an embedding model?)", p.model)
+	}
+	if p.dim > 0 && len(out.Embedding) != p.dim {
+		return nil, fmt.Errorf("model %s returned dim=%d, server dim=%d", p.model, len(out.Embedding), p.dim)
+	}
+	return out.Embedding, nil
+}
@@ -0,0 +1,237 @@
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+const (
+	DefaultOpenAIURL         = "https://api.openai.com/v1"
+	DefaultOpenAIBatchSize   = 64
+	DefaultOpenAIMaxRetries  = 5
+	DefaultOpenAIConcurrency = 4
+
+	openAIBaseBackoff = 500 * time.Millisecond
+	openAIMaxBackoff  = 30 * time.Second
+)
+
+// OpenAIOptions configures an OpenAIProvider. Zero values select defaults.
+type OpenAIOptions struct {
+	// BaseURL is the API root that /embeddings is appended to, e.g.
+	// "https://api.openai.com/v1" or "http://localhost:1234/v1" (LM Studio).
+	BaseURL string
+	Model   string
+	// APIKey is sent as a Bearer token and as "api-key" (Azure). Optional for local servers.
+	APIKey string
+	Dim    int
+
+	BatchSize   int // inputs per request
+	MaxRetries  int // retries per batch on 429, 5xx and network errors
+	Concurrency int // batches in flight across all callers
+}
+
+// OpenAIProvider embeds text through any server that implements the OpenAI
+// POST /v1/embeddings shape (OpenAI, Azure, LM Studio, llama.cpp server).
+// Inputs are split into batches that run concurrently up to a global limit,
+// and failed batches are retried with exponential backoff.
+type OpenAIProvider struct {
+	opts   OpenAIOptions
+	client *http.Client
+	sem    chan struct{}
+}
+
+func NewOpenAIProvider(opts OpenAIOptions) *OpenAIProvider {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultOpenAIURL
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultOpenAIBatchSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultOpenAIMaxRetries
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultOpenAIConcurrency
+	}
+	return &OpenAIProvider{
+		opts:   opts,
+		client: &http.Client{Timeout: 120 * time.Second},
+		sem:    make(chan struct{}, opts.Concurrency),
+	}
+}
+
+func (p *OpenAIProvider) Name() string { return "openai:" + p.opts.Model }
+func (p *OpenAIProvider) Dim() int     { return p.opts.Dim }
+
+type openAIRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Index     int          `json:"index"`
+		Embedding types.Vector `json:"embedding"`
+	} `json:"data"`
+}
+
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([]types.Vector, error) {
+	out := make([]types.Vector, len(texts))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for start := 0; start < len(texts); start += p.opts.BatchSize {
+		end := start + p.opts.BatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			if firstErr != nil {
+				return nil, firstErr
+			}
+			return nil, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-p.sem }()
+
+			vecs, err := p.embedBatch(ctx, texts[start:end])
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("openai embed batch %d-%d: %w", start, end-1, err)
+					cancel()
+				})
+				return
+			}
+			copy(out[start:end], vecs)
+		}(start, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// retryableError marks failures worth retrying; after, if set, comes from Retry-After.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+func (p *OpenAIProvider) embedBatch(ctx context.Context, texts []string) ([]types.Vector, error) {
+	backoff := openAIBaseBackoff
+	for attempt := 0; ; attempt++ {
+		vecs, err := p.post(ctx, texts)
+		if err == nil {
+			return vecs, nil
+		}
+
+		var re *retryableError
+		if !errors.As(err, &re) || attempt >= p.opts.MaxRetries {
+			return nil, err
+		}
+
+		wait := backoff
+		if re.after > 0 {
+			wait = re.after
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		if backoff > openAIMaxBackoff {
+			backoff = openAIMaxBackoff
+		}
+	}
+}
+
+func (p *OpenAIProvider) post(ctx context.Context, texts []string) ([]types.Vector, error) {
+	body, err := json.Marshal(openAIRequest{Model: p.opts.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.opts.BaseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.opts.APIKey)
+		req.Header.Set("api-key", p.opts.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			after := time.Duration(0)
+			if secs, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && secs > 0 {
+				after = time.Duration(secs) * time.Second
+			}
+			return nil, &retryableError{err: err, after: after}
+		}
+		return nil, err
+	}
+
+	var out openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(out.Data), len(texts))
+	}
+
+	vecs := make([]types.Vector, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		if p.opts.Dim > 0 && len(d.Embedding) != p.opts.Dim {
+			return nil, fmt.Errorf("model %s returned dim=%d, server dim=%d", p.opts.Model, len(d.Embedding), p.opts.Dim)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
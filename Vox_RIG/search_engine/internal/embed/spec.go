@@ -0,0 +1,36 @@
+package embed
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FromSpec builds a provider from a "-embed" flag value of the form
+// "<kind>:<model>", e.g. "ollama:nomic-embed-text" or
+// "openai:text-embedding-3-small". baseURL overrides the provider's default
+// endpoint; dim is the server's vector dimension. The OpenAI provider reads
+// its key from VOX_EMBED_API_KEY, falling back to OPENAI_API_KEY.
+func FromSpec(spec, baseURL string, dim int) (Provider, error) {
+	kind, model, ok := strings.Cut(spec, ":")
+	if !ok || model == "" {
+		return nil, fmt.Errorf("invalid embed spec %q: want <provider>:<model>", spec)
+	}
+	switch kind {
+	case "ollama":
+		return NewOllamaProvider(baseURL, model, dim), nil
+	case "openai":
+		key := os.Getenv("VOX_EMBED_API_KEY")
+		if key == "" {
+			key = os.Getenv("OPENAI_API_KEY")
+		}
+		return NewOpenAIProvider(OpenAIOptions{
+			BaseURL: baseURL,
+			Model:   model,
+			APIKey:  key,
+			Dim:     dim,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", kind)
+	}
+}
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// The access log batches retrieval accesses in memory and writes them to
+// the metadata store once this many chunks are pending, or when a
+// retrieval finds the last write older than accessFlushInterval.
+const (
+	accessFlushChunks   = 256
+	accessFlushInterval = 5 * time.Second
+)
+
+// DefaultAccessHalfLife is how long it takes for the last access of a
+// chunk to lose half its weight in AccessScore.
+const DefaultAccessHalfLife = 7 * 24 * time.Hour
+
+// accessLog holds the accesses not yet written to the metadata store.
+// inflight is the batch being written, still counted by ChunkAccess.
+type accessLog struct {
+	mu       sync.Mutex
+	pending  map[uint64]types.ChunkAccess
+	inflight map[uint64]types.ChunkAccess
+	flushed  time.Time
+	off      bool
+	// flushMu serialises writes, so one batch is in flight at a time.
+	flushMu sync.Mutex
+}
+
+// recordAccess logs every chunk res returned on its score; pinned chunks
+// are returned regardless and do not count.
+func (e *Engine) recordAccess(res *RetrievalResult) {
+	a := e.access
+	now := time.Now().UTC()
+	a.mu.Lock()
+	if a.off {
+		a.mu.Unlock()
+		return
+	}
+	if a.pending == nil {
+		a.pending, a.flushed = map[uint64]types.ChunkAccess{}, now
+	}
+	for _, c := range res.Chunks {
+		if c.Pinned || c.ShortTerm {
+			continue
+		}
+		p := a.pending[c.Chunk.ID]
+		p.Count++
+		p.Last = now
+		a.pending[c.Chunk.ID] = p
+	}
+	due := len(a.pending) >= accessFlushChunks || now.Sub(a.flushed) >= accessFlushInterval
+	a.mu.Unlock()
+	if due {
+		if err := e.FlushAccess(); err != nil {
+			log.Printf("[access] flush failed: %v", err)
+		}
+	}
+}
+
+// SetAccessLog turns recording retrievals in the access log on (the
+// default) or off, e.g. for stores that cannot be written.
+func (e *Engine) SetAccessLog(on bool) {
+	e.access.mu.Lock()
+	defer e.access.mu.Unlock()
+	e.access.off = !on
+}
+
+// FlushAccess writes the pending accesses to the metadata store. A failed
+// batch (e.g. on a read-only store) is dropped, not retried.
+func (e *Engine) FlushAccess() error {
+	a := e.access
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+	a.mu.Lock()
+	batch := a.pending
+	a.pending, a.inflight, a.flushed = map[uint64]types.ChunkAccess{}, batch, time.Now()
+	a.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	err := e.metadata.RecordAccess(batch)
+	a.mu.Lock()
+	a.inflight = nil
+	a.mu.Unlock()
+	return err
+}
+
+// ChunkAccess returns the access log of ids, written and pending alike.
+// Chunks never retrieved are left out.
+func (e *Engine) ChunkAccess(ids []uint64) (map[uint64]types.ChunkAccess, error) {
+	out, err := e.metadata.GetAccess(ids)
+	if err != nil {
+		return nil, err
+	}
+	a := e.access
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, id := range ids {
+		for _, m := range []map[uint64]types.ChunkAccess{a.inflight, a.pending} {
+			p, ok := m[id]
+			if !ok {
+				continue
+			}
+			c := out[id]
+			c.Count += p.Count
+			if p.Last.After(c.Last) {
+				c.Last = p.Last
+			}
+			out[id] = c
+		}
+	}
+	return out, nil
+}
+
+// forgetAccess drops the access log of deleted chunks.
+func (e *Engine) forgetAccess(ids []uint64) error {
+	a := e.access
+	a.mu.Lock()
+	for _, id := range ids {
+		delete(a.pending, id)
+	}
+	a.mu.Unlock()
+	return e.metadata.DeleteAccess(ids)
+}
+
+// AccessScore maps an access log entry to [0, 1]: it saturates with the
+// retrieval count and halves every halfLife (0 means
+// DefaultAccessHalfLife) since the last retrieval.
+func AccessScore(a types.ChunkAccess, now time.Time, halfLife time.Duration) float32 {
+	if a.Count == 0 {
+		return 0
+	}
+	if halfLife <= 0 {
+		halfLife = DefaultAccessHalfLife
+	}
+	score := math.Tanh(float64(a.Count) / 8)
+	if age := now.Sub(a.Last); age > 0 {
+		score *= math.Exp2(-float64(age) / float64(halfLife))
+	}
+	return float32(score)
+}
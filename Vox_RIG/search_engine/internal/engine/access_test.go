@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func TestAccessLog(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	meta := storage.NewMemoryMetadataStore()
+	idx := index.NewHnswIndex(vecs)
+	e := NewEngine(idx, vecs, meta)
+
+	var ids []uint64
+	for i, v := range []types.Vector{{1, 0}, {0.9, 0.1}} {
+		doc := types.Document{ID: []string{"a", "b"}[i], Timestamp: time.Now()}
+		id, err := vecs.Append(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := meta.SaveDocumentWithChunks(doc, []types.Chunk{{ID: id, DocID: doc.ID, Content: doc.ID, TokenCount: 10}}); err != nil {
+			t.Fatal(err)
+		}
+		idx.Add(id, v)
+		ids = append(ids, id)
+	}
+	a, b := ids[0], ids[1]
+
+	// Only a fits the budget, three times over (the second and third from
+	// the cache); the log counts them all before anything is written.
+	cfg := RetrievalConfig{MaxTokens: 10, SimilarityWeight: 1, TopKCandidates: 2}
+	for i := 0; i < 3; i++ {
+		res, err := e.Retrieve(types.Vector{1, 0}, cfg)
+		if err != nil || len(res.Chunks) != 1 || res.Chunks[0].Chunk.ID != a {
+			t.Fatalf("Expected chunk a, got %+v, %v", res, err)
+		}
+	}
+	access, err := e.ChunkAccess(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(access) != 1 || access[a].Count != 3 || access[a].Last.IsZero() {
+		t.Errorf("Expected 3 pending accesses of a, got %+v", access)
+	}
+	if err := e.FlushAccess(); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := meta.GetAccess(ids); stored[a].Count != 3 {
+		t.Errorf("Expected the flush to write the log, got %+v", stored)
+	}
+
+	// b is nearer this query, but weighing the access log ranks the chunk
+	// retrieved more often first.
+	res, _ := e.Retrieve(types.Vector{0.9, 0.1}, cfg)
+	if res.Chunks[0].Chunk.ID != b {
+		t.Fatalf("Expected b nearest without access weight, got %+v", res.Chunks)
+	}
+	cfg.AccessWeight = 1
+	res, _ = e.Retrieve(types.Vector{0.9, 0.1}, cfg)
+	if res.Chunks[0].Chunk.ID != a {
+		t.Errorf("Expected the access log to rank a first, got %+v", res.Chunks)
+	}
+
+	if _, err := e.DeleteDocument("a"); err != nil {
+		t.Fatal(err)
+	}
+	if access, _ := e.ChunkAccess([]uint64{a}); len(access) != 0 {
+		t.Errorf("Expected deleting a to drop its access log, got %+v", access)
+	}
+
+	e.SetAccessLog(false)
+	e.Retrieve(types.Vector{0.9, 0.1}, RetrievalConfig{MaxTokens: 10, SimilarityWeight: 1, TopKCandidates: 2})
+	if access, _ := e.ChunkAccess([]uint64{b}); access[b].Count != 1 {
+		t.Errorf("Expected no accesses recorded while the log is off, got %+v", access)
+	}
+}
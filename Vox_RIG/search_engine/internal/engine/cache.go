@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+const (
+	// DefaultCacheSize is how many retrieval results an Engine keeps.
+	DefaultCacheSize = 256
+	// DefaultCacheTTL bounds how stale the recency scores of a cached result
+	// may get; the stores themselves invalidate it on every write.
+	DefaultCacheTTL = 30 * time.Second
+)
+
+// resultCache is an LRU of retrieval results. An entry is only served while
+// the metadata store, index and short-term buffers are at the generations
+// it was computed at, so any ingest, delete, pin or reset on the engine's
+// stores invalidates it.
+// With namespace isolation that is exactly the namespace's own writes.
+type resultCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // front = most recently used
+	items map[[32]byte]*list.Element
+
+	hits, misses uint64
+}
+
+type cacheEntry struct {
+	key     [32]byte
+	gen     [3]uint64
+	created time.Time
+	result  *RetrievalResult
+}
+
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[[32]byte]*list.Element),
+	}
+}
+
+// cacheKey hashes everything that influences a retrieval result. ok is
+// false when the config cannot be encoded (a NaN weight, say); such a
+// retrieval must bypass the cache rather than share a key with others.
+func cacheKey(query types.Vector, config RetrievalConfig) (key [32]byte, ok bool) {
+	h := sha256.New()
+	var buf [4]byte
+	for _, f := range query {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(f))
+		h.Write(buf[:])
+	}
+	tokenizer := ""
+	if config.Tokens != nil {
+		tokenizer = config.Tokens.Name()
+	}
+	// Maps marshal with sorted keys, so equal configs hash equally.
+	cfg, err := json.Marshal(struct {
+		RetrievalConfig
+		Tokens string
+	}{config, tokenizer})
+	if err != nil {
+		return key, false
+	}
+	h.Write(cfg)
+	copy(key[:], h.Sum(nil))
+	return key, true
+}
+
+func (c *resultCache) get(key [32]byte, gen [3]uint64) (*RetrievalResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if e.gen != gen || time.Since(e.created) > c.ttl {
+		c.order.Remove(el)
+		delete(c.items, key)
+		c.misses++
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	c.hits++
+	return e.result.clone(), true
+}
+
+func (c *resultCache) put(key [32]byte, gen [3]uint64, res *RetrievalResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &cacheEntry{key: key, gen: gen, created: time.Now(), result: res.clone()}
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*cacheEntry).key)
+	}
+}
+
+// CacheStats reports retrieval cache usage.
+type CacheStats struct {
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+func (c *resultCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: c.order.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// clone copies the chunk list so callers cannot modify a cached result.
+func (r *RetrievalResult) clone() *RetrievalResult {
+	out := *r
+	out.Chunks = append([]ScoredChunk(nil), r.Chunks...)
+	return &out
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func TestRetrieveCache(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	meta := storage.NewMemoryMetadataStore()
+	idx := index.NewHnswIndex(vecs)
+	e := NewEngine(idx, vecs, meta)
+
+	add := func(docID string, v types.Vector) uint64 {
+		t.Helper()
+		if err := meta.SaveDocument(types.Document{ID: docID}); err != nil {
+			t.Fatal(err)
+		}
+		id, err := vecs.Append(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Add(id, v)
+		if err := meta.SaveChunk(types.Chunk{ID: id, DocID: docID, Content: docID, TokenCount: 1}); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	add("a", types.Vector{1, 0})
+
+	cfg := RetrievalConfig{MaxTokens: 10, SimilarityWeight: 1, TopKCandidates: 10}
+	first, err := e.Retrieve(types.Vector{1, 0}, cfg)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	first.Chunks = nil // callers must not be able to corrupt the cache
+
+	second, _ := e.Retrieve(types.Vector{1, 0}, cfg)
+	if st := e.CacheStats(); st.Hits != 1 || st.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", st)
+	}
+	if len(second.Chunks) != 1 {
+		t.Fatalf("Expected cached result with 1 chunk, got %+v", second)
+	}
+
+	cfg.MaxTokens = 5
+	e.Retrieve(types.Vector{1, 0}, cfg)
+	if st := e.CacheStats(); st.Misses != 2 {
+		t.Errorf("Expected a different config to miss, got %+v", st)
+	}
+
+	add("b", types.Vector{0.9, 0.1})
+	third, _ := e.Retrieve(types.Vector{1, 0}, cfg)
+	if len(third.Chunks) != 2 {
+		t.Errorf("Expected ingest to invalidate the cache, got %+v", third.Chunks)
+	}
+
+	if _, err := e.DeleteDocument("b"); err != nil {
+		t.Fatal(err)
+	}
+	fourth, _ := e.Retrieve(types.Vector{1, 0}, cfg)
+	if len(fourth.Chunks) != 1 {
+		t.Errorf("Expected delete to invalidate the cache, got %+v", fourth.Chunks)
+	}
+
+	// A config JSON cannot encode bypasses the cache instead of sharing
+	// one key with every other such config.
+	before := e.CacheStats()
+	odd := cfg
+	odd.RecencyWeight = float32(math.NaN())
+	for i := 0; i < 2; i++ {
+		if _, err := e.Retrieve(types.Vector{1, 0}, odd); err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+	}
+	if st := e.CacheStats(); st.Hits != before.Hits || st.Misses != before.Misses {
+		t.Errorf("Expected an unencodable config to bypass the cache, got %+v after %+v", st, before)
+	}
+
+	e.SetCacheSize(0)
+	e.Retrieve(types.Vector{1, 0}, cfg)
+	if st := e.CacheStats(); st != (CacheStats{}) {
+		t.Errorf("Expected no stats with the cache disabled, got %+v", st)
+	}
+}
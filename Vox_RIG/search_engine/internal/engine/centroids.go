@@ -0,0 +1,383 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/tracing"
+	"vox-vector-engine/internal/types"
+)
+
+// DefaultTopDocs is how many documents the first stage of two-stage
+// retrieval keeps when RetrievalConfig.TopDocs is 0.
+const DefaultTopDocs = 20
+
+// changeBatch is how many logged changes followChanges reads at a time.
+const changeBatch = 1000
+
+// centroidCompactMin is how many replaced centroids a namespace's store
+// holds, at least, before it is rebuilt without them.
+const centroidCompactMin = 1024
+
+// centroidIndex is the secondary, per-document index behind two-stage
+// retrieval: the centroid of each document (see DocumentVector) in a small
+// HNSW graph per namespace. It follows the metadata change log instead of
+// the write paths, so ingests, replication, trash and purges are all picked
+// up by the next search. It is built on first use.
+type centroidIndex struct {
+	mu     sync.Mutex
+	built  bool
+	seq    uint64 // last change applied
+	spaces map[string]*centroidSpace
+	docs   map[string]centroidRef
+}
+
+type centroidRef struct {
+	ns    string
+	slot  uint64
+	prior bool // IsPriorVersion
+}
+
+// centroidSpace is the centroid graph of one namespace. Updated documents
+// get a new slot; the old one stays in vecs until compaction.
+type centroidSpace struct {
+	vecs  *memVectors
+	index *index.HnswIndex
+	docs  map[uint64]string // live slot -> document ID
+}
+
+func newCentroidSpace() *centroidSpace {
+	vecs := &memVectors{}
+	return &centroidSpace{vecs: vecs, index: index.NewHnswIndex(vecs), docs: map[uint64]string{}}
+}
+
+func (sp *centroidSpace) add(docID string, vec types.Vector) (uint64, error) {
+	slot, err := sp.vecs.Append(vec)
+	if err != nil {
+		return 0, err
+	}
+	sp.index.Add(slot, vec)
+	sp.docs[slot] = docID
+	return slot, nil
+}
+
+// sync brings the index up to date with e's change log.
+func (c *centroidIndex) sync(e *Engine) error {
+	if !c.built {
+		last, err := e.metadata.LastChange()
+		if err != nil {
+			return err
+		}
+		return c.build(e, last)
+	}
+	return e.followChanges(&c.seq, func(docID string) error { return c.update(e, docID) }, c.dropNamespace)
+}
+
+// followChanges applies the changes logged after *seq, advancing it:
+// document is called for every document written or deleted since, and
+// namespace for every namespace deleted. Indexes derived from metadata use
+// it to catch up with writes from any path.
+func (e *Engine) followChanges(seq *uint64, document func(docID string) error, namespace func(ns string)) error {
+	last, err := e.metadata.LastChange()
+	if err != nil {
+		return err
+	}
+	for *seq < last {
+		changes, err := e.metadata.Changes(*seq, changeBatch)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			break
+		}
+		for _, ch := range changes {
+			switch ch.Op {
+			case types.ChangeDocument, types.ChangeDeleteDocument:
+				if ch.DocID != "" {
+					if err := document(ch.DocID); err != nil {
+						return err
+					}
+				}
+			case types.ChangeChunks:
+				// A batch of chunks may span documents; DocID names the first.
+				docs, err := chunkDocuments(e, ch)
+				if err != nil {
+					return err
+				}
+				for _, id := range docs {
+					if err := document(id); err != nil {
+						return err
+					}
+				}
+			case types.ChangeDeleteNamespace:
+				namespace(ch.Namespace)
+			}
+			*seq = ch.Seq
+		}
+	}
+	return nil
+}
+
+// chunkDocuments returns the documents of the chunks in ch that still exist.
+func chunkDocuments(e *Engine, ch types.Change) ([]string, error) {
+	found, err := e.metadata.GetChunks(ch.ChunkIDs)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var out []string
+	if ch.DocID != "" {
+		seen[ch.DocID] = true
+		out = append(out, ch.DocID)
+	}
+	for _, c := range found {
+		if !seen[c.DocID] {
+			seen[c.DocID] = true
+			out = append(out, c.DocID)
+		}
+	}
+	return out, nil
+}
+
+// build indexes every stored document. Changes logged after last are
+// applied by the next sync, so none are lost to a concurrent write.
+func (c *centroidIndex) build(e *Engine, last uint64) error {
+	start := time.Now()
+	c.spaces = map[string]*centroidSpace{}
+	c.docs = map[string]centroidRef{}
+	// Chunks are read after the scan: nesting reads inside ForEachDocument
+	// would hold its transaction open across all of them.
+	var ids []string
+	err := e.metadata.ForEachDocument(func(doc types.Document) error {
+		ids = append(ids, doc.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := c.update(e, id); err != nil {
+			return err
+		}
+	}
+	c.seq, c.built = last, true
+	log.Printf("[centroids] built docs=%d namespaces=%d took=%s", len(c.docs), len(c.spaces), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// update recomputes docID's centroid, dropping it if the document is gone
+// or has no chunks.
+func (c *centroidIndex) update(e *Engine, docID string) error {
+	c.remove(docID)
+	doc, err := e.metadata.GetDocument(docID)
+	if err != nil {
+		return nil
+	}
+	vec, n, err := e.DocumentVector(docID)
+	if err != nil {
+		return fmt.Errorf("centroid of %s: %w", docID, err)
+	}
+	if n == 0 {
+		return nil
+	}
+	ns, _ := doc.Metadata["namespace"].(string)
+	sp := c.spaces[ns]
+	if sp == nil {
+		sp = newCentroidSpace()
+		c.spaces[ns] = sp
+	}
+	slot, err := sp.add(docID, vec)
+	if err != nil {
+		return fmt.Errorf("centroid of %s: %w", docID, err)
+	}
+	c.docs[docID] = centroidRef{ns: ns, slot: slot, prior: IsPriorVersion(*doc)}
+	return nil
+}
+
+func (c *centroidIndex) remove(docID string) {
+	ref, ok := c.docs[docID]
+	if !ok {
+		return
+	}
+	delete(c.docs, docID)
+	sp := c.spaces[ref.ns]
+	sp.index.Remove(ref.slot)
+	delete(sp.docs, ref.slot)
+	if len(sp.docs) == 0 {
+		delete(c.spaces, ref.ns)
+		return
+	}
+	if dead := int(sp.vecs.Count()) - len(sp.docs); dead >= centroidCompactMin && dead > len(sp.docs) {
+		c.compact(ref.ns)
+	}
+}
+
+// compact rebuilds a namespace's graph from its live centroids.
+func (c *centroidIndex) compact(ns string) {
+	old := c.spaces[ns]
+	sp := newCentroidSpace()
+	for slot, docID := range old.docs {
+		vec, _ := old.vecs.Get(slot)
+		next, _ := sp.add(docID, vec)
+		ref := c.docs[docID]
+		ref.slot = next
+		c.docs[docID] = ref
+	}
+	c.spaces[ns] = sp
+}
+
+func (c *centroidIndex) dropNamespace(ns string) {
+	sp := c.spaces[ns]
+	if sp == nil {
+		return
+	}
+	for _, docID := range sp.docs {
+		delete(c.docs, docID)
+	}
+	delete(c.spaces, ns)
+}
+
+// search returns up to k documents whose centroids are nearest query,
+// nearest first, from namespace ns or from every namespace when ns is
+// empty.
+func (c *centroidIndex) search(query types.Vector, ns string, k int, includeVersions bool) []string {
+	spaces := c.spaces
+	if ns != "" {
+		spaces = map[string]*centroidSpace{ns: c.spaces[ns]}
+	}
+	type hit struct {
+		doc  string
+		dist float32
+	}
+	// Prior versions are filtered after the search, so look further.
+	want := k
+	if !includeVersions {
+		want *= 2
+	}
+	var hits []hit
+	for _, sp := range spaces {
+		if sp == nil {
+			continue
+		}
+		slots, dists := sp.index.SearchEf(query, want, max(want, index.EfSearch))
+		for i, slot := range slots {
+			doc, ok := sp.docs[slot]
+			if !ok || (!includeVersions && c.docs[doc].prior) {
+				continue
+			}
+			hits = append(hits, hit{doc, dists[i]})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].dist < hits[j].dist })
+	out := make([]string, 0, min(k, len(hits)))
+	for _, h := range hits[:min(k, len(hits))] {
+		out = append(out, h.doc)
+	}
+	return out
+}
+
+// twoStageCandidates is the candidate stage of two-stage retrieval: the
+// config.TopDocs documents whose centroids are nearest query, then the
+// chunks of those documents ranked by exact distance, nearest first.
+func (e *Engine) twoStageCandidates(ctx context.Context, query types.Vector, config RetrievalConfig) ([]uint64, []float32, error) {
+	topDocs := config.TopDocs
+	if topDocs <= 0 {
+		topDocs = DefaultTopDocs
+	}
+	_, span := tracing.Start(ctx, "centroids.search", tracing.Int("top_docs", topDocs))
+	e.centroids.mu.Lock()
+	err := e.centroids.sync(e)
+	var docs []string
+	if err == nil {
+		docs = e.centroids.search(query, config.Namespace, topDocs, config.IncludeVersions)
+	}
+	e.centroids.mu.Unlock()
+	span.SetAttributes(tracing.Int("documents", len(docs)))
+	span.End()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, span = tracing.Start(ctx, "engine.rank_chunks", tracing.Int("documents", len(docs)))
+	defer span.End()
+	var ids []uint64
+	var dists []float32
+	for _, docID := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		chunks, err := e.metadata.DocumentChunks(docID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range chunks {
+			v, err := e.vectors.Get(c.ID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("vector of chunk %d: %w", c.ID, err)
+			}
+			ids = append(ids, c.ID)
+			dists = append(dists, index.Distance(query, v))
+		}
+	}
+	order := make([]int, len(ids))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return dists[order[a]] < dists[order[b]] })
+	n := min(len(order), config.TopKCandidates)
+	outIDs, outDists := make([]uint64, n), make([]float32, n)
+	for i, j := range order[:n] {
+		outIDs[i], outDists[i] = ids[j], dists[j]
+	}
+	span.SetAttributes(tracing.Int("results", n))
+	return outIDs, outDists, nil
+}
+
+// memVectors is an in-memory VectorStore for the centroid graphs, which
+// are rebuilt from metadata rather than persisted.
+type memVectors struct {
+	mu   sync.RWMutex
+	vecs []types.Vector
+}
+
+func (m *memVectors) Append(v types.Vector) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.vecs) > 0 && len(v) != len(m.vecs[0]) {
+		return 0, fmt.Errorf("vector has dimension %d, want %d", len(v), len(m.vecs[0]))
+	}
+	m.vecs = append(m.vecs, v)
+	return uint64(len(m.vecs) - 1), nil
+}
+
+func (m *memVectors) Get(i uint64) (types.Vector, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if i >= uint64(len(m.vecs)) {
+		return nil, fmt.Errorf("vector %d out of range", i)
+	}
+	return m.vecs[i], nil
+}
+
+func (m *memVectors) Dim() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.vecs) == 0 {
+		return 0
+	}
+	return len(m.vecs[0])
+}
+
+func (m *memVectors) Count() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return uint64(len(m.vecs))
+}
+
+func (m *memVectors) Sync() error  { return nil }
+func (m *memVectors) Close() error { return nil }
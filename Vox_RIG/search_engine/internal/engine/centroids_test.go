@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func TestTwoStageRetrieval(t *testing.T) {
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	meta := storage.NewMemoryMetadataStore()
+	idx := index.NewHnswIndex(vecs)
+	e := NewEngine(idx, vecs, meta)
+	e.SetCacheSize(0)
+
+	add := func(ns, docID string, vs ...types.Vector) {
+		t.Helper()
+		if err := meta.SaveDocument(types.Document{ID: docID, Metadata: types.Metadata{"namespace": ns}}); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range vs {
+			id, err := vecs.Append(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Add(id, v)
+			if err := meta.SaveChunk(types.Chunk{ID: id, DocID: docID, Content: docID, TokenCount: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	docsOf := func(res *RetrievalResult) string {
+		seen := map[string]bool{}
+		for _, c := range res.Chunks {
+			seen[c.Chunk.DocID] = true
+		}
+		var out []string
+		for id := range seen {
+			out = append(out, id)
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+
+	// scattered has one chunk on the query but sits far from it overall;
+	// focused is near it throughout.
+	add("p", "scattered", types.Vector{1, 0}, types.Vector{-5, 5}, types.Vector{-5, -5})
+	add("p", "focused", types.Vector{0.8, 0.1}, types.Vector{0.9, -0.1})
+	add("q", "elsewhere", types.Vector{1, 0})
+
+	query := types.Vector{1, 0}
+	cfg := RetrievalConfig{MaxTokens: 100, SimilarityWeight: 1, TopKCandidates: 10, Namespace: "p"}
+	res, err := e.Retrieve(query, cfg)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if got := docsOf(res); got != "focused,scattered" {
+		t.Errorf("Expected chunks of both documents without two-stage, got %s", got)
+	}
+
+	cfg.TwoStage, cfg.TopDocs = true, 1
+	if res, err = e.Retrieve(query, cfg); err != nil {
+		t.Fatalf("Two-stage Retrieve failed: %v", err)
+	}
+	if got := docsOf(res); got != "focused" || len(res.Chunks) != 2 {
+		t.Errorf("Expected both chunks of focused only, got %s (%d chunks)", got, len(res.Chunks))
+	}
+
+	// The index follows later writes and deletes.
+	add("p", "newer", types.Vector{1, 0.05})
+	if res, _ = e.Retrieve(query, cfg); docsOf(res) != "newer" {
+		t.Errorf("Expected the new document to lead, got %s", docsOf(res))
+	}
+	if _, err := e.DeleteDocument("newer"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.DeleteDocument("focused"); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ = e.Retrieve(query, cfg); docsOf(res) != "scattered" {
+		t.Errorf("Expected scattered after deletes, got %s", docsOf(res))
+	}
+
+	// Without a namespace every namespace's centroids compete.
+	cfg.Namespace, cfg.TopDocs = "", 5
+	if res, _ = e.Retrieve(query, cfg); docsOf(res) != "elsewhere,scattered" {
+		t.Errorf("Expected documents of both namespaces, got %s", docsOf(res))
+	}
+}
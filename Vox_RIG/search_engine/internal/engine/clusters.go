@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/types"
+)
+
+// Defaults and bounds of ClusterConfig.
+const (
+	DefaultClusterIterations = 25
+	DefaultClusterExemplars  = 3
+	MaxClusters              = 256
+	// MaxClusterSample is how many vectors k-means is fitted on; larger
+	// namespaces are sampled, then every chunk is assigned.
+	MaxClusterSample = 20000
+)
+
+// ClusterConfig configures ClusterNamespace.
+type ClusterConfig struct {
+	Namespace string
+	// K is the number of clusters; 0 picks sqrt(chunks/2), at most 50.
+	K int
+	// Iterations bounds the k-means rounds; 0 means DefaultClusterIterations.
+	Iterations int
+	// Exemplars is how many chunks nearest each centroid are kept; 0 means
+	// DefaultClusterExemplars.
+	Exemplars int
+	// Seed makes sampling and initialization repeatable.
+	Seed int64
+	// Progress, if set, is called with the share of the work done.
+	Progress func(float64)
+}
+
+// Cluster is one topic of a namespace: the chunks nearest one centroid.
+type Cluster struct {
+	ID   int `json:"id"`
+	Size int `json:"size"`
+	// Documents counts the distinct documents among the chunks.
+	Documents int `json:"documents"`
+	// Sources are the most frequent document sources, most frequent first.
+	Sources []string `json:"sources"`
+	// Exemplars are the chunks nearest the centroid, nearest first.
+	Exemplars []types.Chunk `json:"exemplars"`
+	// ChunkIDs assigns every clustered chunk, in ID order.
+	ChunkIDs []uint64 `json:"chunk_ids,omitempty"`
+}
+
+// Clustering is the stored result of ClusterNamespace.
+type Clustering struct {
+	Namespace  string    `json:"namespace"`
+	K          int       `json:"k"`
+	Chunks     int       `json:"chunks"`
+	Iterations int       `json:"iterations"`
+	CreatedAt  time.Time `json:"created_at"`
+	// ChangeSeq is the metadata change log position the clustering saw;
+	// later changes are not reflected.
+	ChangeSeq uint64    `json:"change_seq"`
+	Clusters  []Cluster `json:"clusters"`
+}
+
+// clusterSources is how many sources a Cluster lists.
+const clusterSources = 5
+
+// clusterKey is the metadata state key holding the clustering of a namespace.
+func clusterKey(ns string) string {
+	return "clusters:" + ns
+}
+
+// ClusterNamespace groups the chunks of ns (latest versions only) with
+// k-means over their stored vectors and saves the result, replacing the
+// previous one; Clusters reads it back. It stops with ctx's error when ctx
+// is canceled.
+func (e *Engine) ClusterNamespace(ctx context.Context, config ClusterConfig) (*Clustering, error) {
+	progress := config.Progress
+	if progress == nil {
+		progress = func(float64) {}
+	}
+	seq, err := e.metadata.LastChange()
+	if err != nil {
+		return nil, err
+	}
+	docs, err := e.metadata.ListDocuments(config.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]types.Document{}
+	var chunks []types.Chunk
+	for _, doc := range docs {
+		if IsPriorVersion(doc) {
+			continue
+		}
+		byID[doc.ID] = doc
+		cs, err := e.metadata.DocumentChunks(doc.ID)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, cs...)
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].ID < chunks[j].ID })
+
+	res := &Clustering{Namespace: config.Namespace, Chunks: len(chunks), CreatedAt: time.Now().UTC(), ChangeSeq: seq, Clusters: []Cluster{}}
+	if len(chunks) > 0 {
+		if err := e.cluster(ctx, config, chunks, byID, res, progress); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.metadata.SetState(clusterKey(config.Namespace), string(data)); err != nil {
+		return nil, err
+	}
+	progress(1)
+	return res, nil
+}
+
+func (e *Engine) cluster(ctx context.Context, config ClusterConfig, chunks []types.Chunk, docs map[string]types.Document, res *Clustering, progress func(float64)) error {
+	rng := rand.New(rand.NewSource(config.Seed))
+	k := config.K
+	if k <= 0 {
+		k = min(max(int(math.Round(math.Sqrt(float64(len(chunks))/2))), 1), 50)
+	}
+	k = min(k, len(chunks))
+	iterations := config.Iterations
+	if iterations <= 0 {
+		iterations = DefaultClusterIterations
+	}
+	exemplars := config.Exemplars
+	if exemplars <= 0 {
+		exemplars = DefaultClusterExemplars
+	}
+
+	sample := make([]types.Vector, 0, min(len(chunks), MaxClusterSample))
+	for _, i := range rng.Perm(len(chunks))[:min(len(chunks), MaxClusterSample)] {
+		v, err := e.vectors.Get(chunks[i].ID)
+		if err != nil {
+			return fmt.Errorf("vector of chunk %d: %w", chunks[i].ID, err)
+		}
+		sample = append(sample, v)
+	}
+	centroids := index.KMeansPlusPlus(sample, k, rng)
+
+	// Fitting is most of the work; assignment streams every vector once.
+	assign := make([]int, len(sample))
+	for it := 0; it < iterations; it++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res.Iterations = it + 1
+		moved := 0
+		for i, v := range sample {
+			if c := index.NearestCentroid(centroids, v); c != assign[i] || it == 0 {
+				assign[i] = c
+				moved++
+			}
+		}
+		centroids = index.Recenter(sample, assign, centroids)
+		progress(0.8 * float64(it+1) / float64(iterations))
+		if moved == 0 {
+			break
+		}
+	}
+
+	type member struct {
+		chunk types.Chunk
+		dist  float32
+	}
+	members := make([][]member, k)
+	for i, c := range chunks {
+		if i%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			progress(0.8 + 0.2*float64(i)/float64(len(chunks)))
+		}
+		v, err := e.vectors.Get(c.ID)
+		if err != nil {
+			return fmt.Errorf("vector of chunk %d: %w", c.ID, err)
+		}
+		n := index.NearestCentroid(centroids, v)
+		members[n] = append(members[n], member{c, index.SquaredDistance(centroids[n], v)})
+	}
+
+	for _, ms := range members {
+		if len(ms) == 0 {
+			continue
+		}
+		cl := Cluster{ID: len(res.Clusters), Size: len(ms), Sources: []string{}, Exemplars: []types.Chunk{}}
+		counts := map[string]int{}
+		seen := map[string]bool{}
+		for _, m := range ms {
+			cl.ChunkIDs = append(cl.ChunkIDs, m.chunk.ID)
+			if !seen[m.chunk.DocID] {
+				seen[m.chunk.DocID] = true
+				if src := docs[m.chunk.DocID].Source; src != "" {
+					counts[src]++
+				}
+			}
+		}
+		cl.Documents = len(seen)
+		for src := range counts {
+			cl.Sources = append(cl.Sources, src)
+		}
+		sort.Slice(cl.Sources, func(i, j int) bool {
+			a, b := cl.Sources[i], cl.Sources[j]
+			return counts[a] > counts[b] || (counts[a] == counts[b] && a < b)
+		})
+		cl.Sources = cl.Sources[:min(len(cl.Sources), clusterSources)]
+		sort.SliceStable(ms, func(i, j int) bool { return ms[i].dist < ms[j].dist })
+		for _, m := range ms[:min(len(ms), exemplars)] {
+			cl.Exemplars = append(cl.Exemplars, m.chunk)
+		}
+		res.Clusters = append(res.Clusters, cl)
+	}
+	// Largest topics first; IDs follow that order.
+	sort.SliceStable(res.Clusters, func(i, j int) bool { return res.Clusters[i].Size > res.Clusters[j].Size })
+	for i := range res.Clusters {
+		res.Clusters[i].ID = i
+	}
+	res.K = len(res.Clusters)
+	return nil
+}
+
+// Clusters returns the clustering last saved for ns by ClusterNamespace, or
+// nil if there is none.
+func (e *Engine) Clusters(ns string) (*Clustering, error) {
+	data, err := e.metadata.GetState(clusterKey(ns))
+	if err != nil || data == "" {
+		return nil, err
+	}
+	var c Clustering
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, fmt.Errorf("clusters of %q: %w", ns, err)
+	}
+	return &c, nil
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// Feedback signals the IDE reports for a retrieved chunk.
+const (
+	SignalUsed    = "used"
+	SignalIgnored = "ignored"
+	SignalHarmful = "harmful"
+)
+
+// DefaultFeedbackHalfLife is how long it takes for feedback to lose half
+// its weight.
+const DefaultFeedbackHalfLife = 30 * 24 * time.Hour
+
+// feedbackValues is what each signal adds to a chunk's feedback score.
+var feedbackValues = map[string]float64{
+	SignalUsed:    1,
+	SignalIgnored: -0.25,
+	SignalHarmful: -2,
+}
+
+// Chunk metadata keys of feedback: a counter per signal, the decayed score
+// and when it was last updated.
+const (
+	metaFeedbackPrefix = "feedback_"
+	MetaFeedbackScore  = "feedback_score"
+	MetaFeedbackAt     = "feedback_at"
+)
+
+// Feedback is the feedback recorded on a chunk.
+type Feedback struct {
+	Used    int `json:"used"`
+	Ignored int `json:"ignored"`
+	Harmful int `json:"harmful"`
+	// Score is the sum of the signal values, each decayed by its age at
+	// UpdatedAt; FeedbackScore decays it further to now.
+	Score     float64   `json:"score"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ChunkFeedback reads the feedback recorded in chunk metadata.
+func ChunkFeedback(md types.Metadata) Feedback {
+	at, _ := time.Parse(time.RFC3339Nano, fmt.Sprint(md[MetaFeedbackAt]))
+	return Feedback{
+		Used:      int(metadataFloat(md[metaFeedbackPrefix+SignalUsed])),
+		Ignored:   int(metadataFloat(md[metaFeedbackPrefix+SignalIgnored])),
+		Harmful:   int(metadataFloat(md[metaFeedbackPrefix+SignalHarmful])),
+		Score:     metadataFloat(md[MetaFeedbackScore]),
+		UpdatedAt: at,
+	}
+}
+
+// AddFeedback records signal at now in chunk metadata md, which it returns
+// (allocated when nil).
+func AddFeedback(md types.Metadata, signal string, now time.Time, halfLife time.Duration) (types.Metadata, error) {
+	value, ok := feedbackValues[signal]
+	if !ok {
+		return md, fmt.Errorf("unknown feedback signal %q (want %s, %s or %s)", signal, SignalUsed, SignalIgnored, SignalHarmful)
+	}
+	if md == nil {
+		md = types.Metadata{}
+	}
+	fb := ChunkFeedback(md)
+	md[metaFeedbackPrefix+signal] = metadataFloat(md[metaFeedbackPrefix+signal]) + 1
+	md[MetaFeedbackScore] = fb.decayed(now, halfLife) + value
+	md[MetaFeedbackAt] = now.UTC().Format(time.RFC3339Nano)
+	return md, nil
+}
+
+// FeedbackScore returns the feedback score in chunk metadata md decayed to
+// now; 0 without feedback.
+func FeedbackScore(md types.Metadata, now time.Time, halfLife time.Duration) float64 {
+	if _, ok := md[MetaFeedbackScore]; !ok {
+		return 0
+	}
+	return ChunkFeedback(md).decayed(now, halfLife)
+}
+
+func (fb Feedback) decayed(now time.Time, halfLife time.Duration) float64 {
+	if fb.Score == 0 || fb.UpdatedAt.IsZero() {
+		return fb.Score
+	}
+	if halfLife <= 0 {
+		halfLife = DefaultFeedbackHalfLife
+	}
+	age := now.Sub(fb.UpdatedAt)
+	if age <= 0 {
+		return fb.Score
+	}
+	return fb.Score * math.Exp2(-float64(age)/float64(halfLife))
+}
+
+// feedbackTerm maps a feedback score to [-1, 1], so a long history cannot
+// outweigh similarity.
+func feedbackTerm(score float64) float32 {
+	return float32(math.Tanh(score / 2))
+}
+
+// metadataFloat reads a number stored in metadata, which comes back from
+// JSON as float64.
+func metadataFloat(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	}
+	return 0
+}
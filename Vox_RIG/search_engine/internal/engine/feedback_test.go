@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFeedbackDecay(t *testing.T) {
+	start := time.Now()
+	md, err := AddFeedback(nil, SignalUsed, start, time.Hour)
+	if err != nil {
+		t.Fatalf("AddFeedback failed: %v", err)
+	}
+	if md, err = AddFeedback(md, SignalUsed, start.Add(time.Hour), time.Hour); err != nil {
+		t.Fatalf("AddFeedback failed: %v", err)
+	}
+	// The first signal has halved by the second: 0.5 + 1.
+	if got := FeedbackScore(md, start.Add(time.Hour), time.Hour); math.Abs(got-1.5) > 1e-9 {
+		t.Errorf("Expected score 1.5, got %v", got)
+	}
+	if got := FeedbackScore(md, start.Add(3*time.Hour), time.Hour); math.Abs(got-0.375) > 1e-9 {
+		t.Errorf("Expected score 0.375 two half-lives later, got %v", got)
+	}
+	if fb := ChunkFeedback(md); fb.Used != 2 || fb.Ignored != 0 || fb.Harmful != 0 {
+		t.Errorf("Expected 2 used, got %+v", fb)
+	}
+
+	if md, err = AddFeedback(md, SignalHarmful, start.Add(time.Hour), time.Hour); err != nil {
+		t.Fatalf("AddFeedback failed: %v", err)
+	}
+	if got := FeedbackScore(md, start.Add(time.Hour), time.Hour); got >= 0 {
+		t.Errorf("Expected a negative score after harmful feedback, got %v", got)
+	}
+	if _, err := AddFeedback(md, "meh", start, time.Hour); err == nil {
+		t.Error("Expected an error for an unknown signal")
+	}
+	if got := FeedbackScore(nil, start, time.Hour); got != 0 {
+		t.Errorf("Expected 0 without feedback, got %v", got)
+	}
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+)
+
+// fileRangesKey is the metadata state key listing the line-range documents
+// stored for the file whose whole-file document ID is fileID, one ID per
+// line, so a later whole-file ingest finds them without scanning every
+// document.
+func fileRangesKey(fileID string) string {
+	return "file_ranges:" + fileID
+}
+
+// FileRanges returns the line-range documents recorded for fileID.
+func (e *Engine) FileRanges(fileID string) ([]string, error) {
+	v, err := e.metadata.GetState(fileRangesKey(fileID))
+	if err != nil || v == "" {
+		return nil, err
+	}
+	return strings.Split(v, "\n"), nil
+}
+
+// AddFileRange records docID as a line-range document of fileID.
+func (e *Engine) AddFileRange(fileID, docID string) error {
+	e.rangeMu.Lock()
+	defer e.rangeMu.Unlock()
+	ranges, err := e.FileRanges(fileID)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(ranges, docID) {
+		return nil
+	}
+	return e.metadata.SetState(fileRangesKey(fileID), strings.Join(append(ranges, docID), "\n"))
+}
+
+// ForgetFileRanges removes docIDs from the line-range documents of fileID,
+// keeping any recorded since they were read.
+func (e *Engine) ForgetFileRanges(fileID string, docIDs []string) error {
+	if len(docIDs) == 0 {
+		return nil
+	}
+	e.rangeMu.Lock()
+	defer e.rangeMu.Unlock()
+	ranges, err := e.FileRanges(fileID)
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(ranges, func(id string) bool {
+		return slices.Contains(docIDs, id)
+	})
+	return e.metadata.SetState(fileRangesKey(fileID), strings.Join(kept, "\n"))
+}
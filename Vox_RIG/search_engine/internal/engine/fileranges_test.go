@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+)
+
+func TestForgetFileRangesKeepsNewRanges(t *testing.T) {
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(t.TempDir(), "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	e := NewEngine(index.NewHnswIndex(vecs), vecs, storage.NewMemoryMetadataStore())
+
+	for _, id := range []string{"f:1-2", "f:3-4", "f:1-2"} {
+		if err := e.AddFileRange("f", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read, err := e.FileRanges("f")
+	if err != nil || fmt.Sprint(read) != "[f:1-2 f:3-4]" {
+		t.Fatalf("FileRanges = %v, %v", read, err)
+	}
+
+	// Recorded after the list was read, so not retired with it.
+	if err := e.AddFileRange("f", "f:5-6"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ForgetFileRanges("f", read); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := e.FileRanges("f"); fmt.Sprint(got) != "[f:5-6]" {
+		t.Errorf("Expected only the new range to stay, got %v", got)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := e.AddFileRange("g", fmt.Sprintf("g:%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got, _ := e.FileRanges("g"); len(got) != 20 {
+		t.Errorf("Expected all 20 concurrent ranges recorded, got %d", len(got))
+	}
+}
@@ -0,0 +1,48 @@
+package engine
+
+import "vox-vector-engine/internal/types"
+
+// MetaImportance is the chunk (or document) metadata key holding an
+// importance in [0, 1]; retrieval adds it times ImportanceWeight to the
+// score, so crucial memories outrank chit-chat at equal similarity.
+const MetaImportance = "importance"
+
+// importanceKinds is the importance inferred for a chunk whose metadata
+// "type" or "kind", or whose document tags, name one of these kinds.
+var importanceKinds = map[string]float32{
+	"user_instruction": 1,
+	"decision":         0.8,
+	"error":            0.6,
+}
+
+// InferImportance returns the highest importance of the kinds named by md
+// or tags; 0 when none is.
+func InferImportance(md types.Metadata, tags []string) float32 {
+	var best float32
+	for _, key := range []string{"type", "kind"} {
+		if kind, ok := md[key].(string); ok {
+			best = max(best, importanceKinds[kind])
+		}
+	}
+	for _, tag := range tags {
+		best = max(best, importanceKinds[tag])
+	}
+	return best
+}
+
+// Importance reads the importance stored on a chunk, or else on its
+// document; 0 when neither has one. Metadata round-trips through JSON, so
+// numbers usually come back as float64.
+func Importance(chunkMeta, docMeta types.Metadata) float32 {
+	for _, md := range []types.Metadata{chunkMeta, docMeta} {
+		switch v := md[MetaImportance].(type) {
+		case float64:
+			return float32(v)
+		case float32:
+			return v
+		case int:
+			return float32(v)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ModelManifestFile records the name and dimension of a model space.
+const ModelManifestFile = "model.json"
+
+// ModelSpace is an embedding space with its own vector dimension, kept apart
+// from the default stores so vectors from several embedding models can be
+// served side by side:
+//
+//	<root>/<model>/model.json
+//	<root>/<model>/<escaped-namespace>/vectors.bin
+//	<root>/<model>/<escaped-namespace>/metadata.db
+//
+// Model spaces are always split by namespace, whether or not the server runs
+// with -isolate_namespaces, so the CLI and the server agree on the layout.
+type ModelSpace struct {
+	Name   string        `json:"name"`
+	Dim    int           `json:"dim"`
+	Shards *ShardManager `json:"-"`
+}
+
+// ValidModelName reports whether name can be used as a model space directory.
+func ValidModelName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// OpenModelSpace opens (or creates) the model space called name under root.
+// dim 0 opens an existing space with the dimension it was created with; a
+// non-zero dim must match the recorded one.
+func OpenModelSpace(root, name string, dim int) (*ModelSpace, error) {
+	if !ValidModelName(name) {
+		return nil, fmt.Errorf("invalid model name: %q", name)
+	}
+	dir := filepath.Join(root, name)
+
+	var recorded ModelSpace
+	data, err := os.ReadFile(filepath.Join(dir, ModelManifestFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &recorded); err != nil {
+			return nil, fmt.Errorf("model %q: %w", name, err)
+		}
+		if dim != 0 && dim != recorded.Dim {
+			return nil, fmt.Errorf("model %q has dim %d, not %d", name, recorded.Dim, dim)
+		}
+		dim = recorded.Dim
+	case errors.Is(err, os.ErrNotExist):
+		if dim <= 0 {
+			return nil, fmt.Errorf("unknown model: %q", name)
+		}
+	default:
+		return nil, err
+	}
+
+	shards, err := NewShardManager(dir, dim)
+	if err != nil {
+		return nil, fmt.Errorf("model %q: %w", name, err)
+	}
+	sp := &ModelSpace{Name: name, Dim: dim, Shards: shards}
+	if recorded.Dim == 0 {
+		data, _ := json.MarshalIndent(sp, "", "  ")
+		if err := os.WriteFile(filepath.Join(dir, ModelManifestFile), data, 0o644); err != nil {
+			return nil, fmt.Errorf("model %q: %w", name, err)
+		}
+	}
+	return sp, nil
+}
+
+// ListModelSpaces returns the names of the model spaces under root.
+func ListModelSpaces(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(root, e.Name(), ModelManifestFile)); e.IsDir() && err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
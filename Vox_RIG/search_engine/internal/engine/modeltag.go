@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"log"
+
+	"vox-vector-engine/internal/storage"
+)
+
+// MetaEmbeddingModel is the document metadata key holding the embedding
+// model its chunk vectors were made with, e.g. "openai:text-embedding-3-small",
+// as tagged by the client or named by the server's embedder.
+const MetaEmbeddingModel = "embedding_model"
+
+// modelTagKey is the metadata state key holding the embedding model of a
+// namespace: the first one its vectors were tagged with.
+func modelTagKey(ns string) string {
+	return "embedding_model:" + ns
+}
+
+// ModelTag returns the embedding model recorded for ns; "" when none of its
+// vectors were tagged.
+func (e *Engine) ModelTag(ns string) (string, error) {
+	return e.metadata.GetState(modelTagKey(ns))
+}
+
+// ClaimModelTag records tag as the embedding model of ns unless one is
+// recorded already, and returns the recorded one. Vectors of different
+// models are not comparable, so a namespace keeps the model it started
+// with until it is purged.
+func (e *Engine) ClaimModelTag(ns, tag string) (string, error) {
+	e.tagMu.Lock()
+	defer e.tagMu.Unlock()
+	cur, err := e.ModelTag(ns)
+	if err != nil || cur != "" || tag == "" {
+		return cur, err
+	}
+	if err := e.metadata.SetState(modelTagKey(ns), tag); err != nil {
+		return tag, err
+	}
+	// The vectors file names the model too, for tools reading it alone.
+	if vecs, ok := e.vectors.(storage.FileVectorStore); ok {
+		if err := vecs.SetFileModel(tag); err != nil {
+			log.Printf("[model] namespace=%s tagging the vectors file failed: %v", ns, err)
+		}
+	}
+	return tag, nil
+}
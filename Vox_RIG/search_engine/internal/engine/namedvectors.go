@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/types"
+)
+
+// MetaVectors is the chunk metadata key mapping the names of a chunk's
+// extra vectors (e.g. "docstring", "symbol") to their IDs in the vector
+// store. Each is stored and indexed like a chunk vector, but only the
+// chunk's own vector has the chunk's ID.
+const MetaVectors = "vectors"
+
+// ContentVector is the name the chunk's own vector goes by in
+// RetrievalConfig.VectorWeights; it cannot name an extra vector.
+const ContentVector = "content"
+
+// namedVectorKey is the metadata state key linking the extra vector id back
+// to its chunk, as "<chunk id> <name>".
+func namedVectorKey(id uint64) string {
+	return "vector_of:" + strconv.FormatUint(id, 10)
+}
+
+// NamedVectors returns the extra vectors recorded in chunk metadata md,
+// name to vector ID.
+func NamedVectors(md types.Metadata) map[string]uint64 {
+	raw, ok := md[MetaVectors].(map[string]any)
+	if !ok {
+		if typed, ok := md[MetaVectors].(map[string]uint64); ok {
+			return typed
+		}
+		return nil
+	}
+	out := make(map[string]uint64, len(raw))
+	for name, v := range raw {
+		switch id := v.(type) {
+		case uint64:
+			out[name] = id
+		case float64:
+			out[name] = uint64(id)
+		case json.Number:
+			if n, err := strconv.ParseUint(id.String(), 10, 64); err == nil {
+				out[name] = n
+			}
+		}
+	}
+	return out
+}
+
+// WithNamedVectors returns a copy of md recording the extra vectors ids
+// under MetaVectors.
+func WithNamedVectors(md types.Metadata, ids map[string]uint64) types.Metadata {
+	out := make(types.Metadata, len(md)+1)
+	for k, v := range md {
+		out[k] = v
+	}
+	named := make(map[string]any, len(ids))
+	for name, id := range ids {
+		named[name] = id
+	}
+	out[MetaVectors] = named
+	return out
+}
+
+// namedVectorIDs lists the extra vector IDs of chunks.
+func namedVectorIDs(chunks []types.Chunk) []uint64 {
+	var ids []uint64
+	for _, c := range chunks {
+		for _, id := range NamedVectors(c.Metadata) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// LinkNamedVectors records which chunk each extra vector of chunks belongs
+// to, so a search that finds the extra vector returns its chunk. It must
+// run before the vectors are indexed.
+func (e *Engine) LinkNamedVectors(chunks []types.Chunk) error {
+	for _, c := range chunks {
+		for name, id := range NamedVectors(c.Metadata) {
+			if err := e.metadata.SetState(namedVectorKey(id), fmt.Sprintf("%d %s", c.ID, name)); err != nil {
+				return fmt.Errorf("link vector %d to chunk %d: %w", id, c.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// IndexNamedVectors adds the extra vectors of chunks to the index.
+func (e *Engine) IndexNamedVectors(chunks []types.Chunk) {
+	for _, id := range namedVectorIDs(chunks) {
+		if v, err := e.vectors.Get(id); err == nil {
+			e.index.Add(id, v)
+		}
+	}
+}
+
+// unlinkNamedVectors drops the links LinkNamedVectors recorded for the
+// extra vectors ids, once their chunks are deleted for good.
+func (e *Engine) unlinkNamedVectors(ids []uint64) error {
+	for _, id := range ids {
+		if err := e.metadata.SetState(namedVectorKey(id), ""); err != nil {
+			return fmt.Errorf("unlink vector %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// unindexNamedVectors removes the extra vectors of chunks from the index.
+func (e *Engine) unindexNamedVectors(chunks []types.Chunk) {
+	for _, id := range namedVectorIDs(chunks) {
+		e.index.Remove(id)
+	}
+}
+
+// vectorHit is an index result resolved to the chunk it belongs to.
+type vectorHit struct {
+	chunk uint64
+	name  string // ContentVector or the extra vector's name
+}
+
+// resolveHits maps the index results ids that are not chunk IDs (missing
+// from found) to the chunks whose extra vectors they are, and loads those
+// chunks into found. IDs linked to no chunk are left out.
+func (e *Engine) resolveHits(ids []uint64, found map[uint64]types.Chunk) (map[uint64]vectorHit, error) {
+	hits := make(map[uint64]vectorHit, len(ids))
+	var missing []uint64
+	for _, id := range ids {
+		if _, ok := found[id]; ok {
+			hits[id] = vectorHit{chunk: id, name: ContentVector}
+			continue
+		}
+		link, err := e.metadata.GetState(namedVectorKey(id))
+		if err != nil {
+			return nil, err
+		}
+		chunkID, name, ok := strings.Cut(link, " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(chunkID, 10, 64)
+		if err != nil {
+			continue
+		}
+		hits[id] = vectorHit{chunk: n, name: name}
+		if _, ok := found[n]; !ok {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) == 0 {
+		return hits, nil
+	}
+	more, err := e.metadata.GetChunks(missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, c := range more {
+		found[id] = c
+	}
+	return hits, nil
+}
+
+// chunkDistances groups the index results by chunk: the distance of each of
+// its vectors that was found, by name, in order of each chunk's first hit.
+func chunkDistances(ids []uint64, dists []float32, hits map[uint64]vectorHit) ([]uint64, map[uint64]map[string]float32) {
+	var order []uint64
+	byChunk := map[uint64]map[string]float32{}
+	for i, id := range ids {
+		h, ok := hits[id]
+		if !ok {
+			continue
+		}
+		d := byChunk[h.chunk]
+		if d == nil {
+			d = map[string]float32{}
+			byChunk[h.chunk] = d
+			order = append(order, h.chunk)
+		}
+		d[h.name] = dists[i]
+	}
+	return order, byChunk
+}
+
+// vectorSimilarity scores chunk against query from the distances of its
+// vectors found by the index. Without weights it is the similarity of the
+// nearest one, or of the chunk's own vector when none was found. With
+// weights it is the weighted mean similarity of the chunk's weighted
+// vectors, those the index did not return being compared with query
+// directly; ok is false when the chunk has none of them.
+func (e *Engine) vectorSimilarity(query types.Vector, chunk types.Chunk, found map[string]float32, weights map[string]float32) (sim float32, ok bool, err error) {
+	if len(weights) == 0 && len(found) > 0 {
+		best := float32(-1)
+		for _, d := range found {
+			if best < 0 || d < best {
+				best = d
+			}
+		}
+		return 1 / (1 + best), true, nil
+	}
+	if len(weights) == 0 {
+		// Not found by the index, e.g. a sparse candidate.
+		weights = map[string]float32{ContentVector: 1}
+	}
+	named := NamedVectors(chunk.Metadata)
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sum, total float32
+	for _, name := range names {
+		w := weights[name]
+		if w == 0 {
+			continue
+		}
+		d, hit := found[name]
+		if !hit {
+			id, has := chunk.ID, name == ContentVector
+			if !has {
+				id, has = named[name]
+			}
+			if !has {
+				continue
+			}
+			v, err := e.vectors.Get(id)
+			if err != nil {
+				return 0, false, fmt.Errorf("vector %q of chunk %d: %w", name, chunk.ID, err)
+			}
+			d = index.Distance(query, v)
+		}
+		sum += w / (1 + d)
+		total += w
+	}
+	if total == 0 {
+		return 0, false, nil
+	}
+	return sum / total, true, nil
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"math"
+
+	"vox-vector-engine/internal/types"
+)
+
+// MetaNorm is the chunk metadata key holding the L2 norm a vector had
+// before it was normalized at ingest (see Unit).
+const MetaNorm = "norm"
+
+// Norm returns the L2 norm of v.
+func Norm(v types.Vector) float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return float32(math.Sqrt(sum))
+}
+
+// Unit returns v scaled to unit length and the norm it had. On unit
+// vectors the index's Euclidean ranking is the cosine ranking, since
+// |a-b|² = 2 - 2·cos(a,b). An all-zero v is returned unchanged with norm 0.
+func Unit(v types.Vector) (types.Vector, float32) {
+	n := Norm(v)
+	if n == 0 {
+		return v, 0
+	}
+	out := make(types.Vector, len(v))
+	for i, x := range v {
+		out[i] = x / n
+	}
+	return out, n
+}
+
+// WithNorm returns a copy of md recording norm under MetaNorm.
+func WithNorm(md types.Metadata, norm float32) types.Metadata {
+	out := make(types.Metadata, len(md)+1)
+	for k, v := range md {
+		out[k] = v
+	}
+	out[MetaNorm] = norm
+	return out
+}
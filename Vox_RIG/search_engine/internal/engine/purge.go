@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"vox-vector-engine/internal/types"
+)
+
+// PurgeResult reports what PurgeNamespace removed.
+type PurgeResult struct {
+	Namespace string `json:"namespace"`
+	Documents int    `json:"documents"`
+	Chunks    int    `json:"chunks"`
+}
+
+// PurgeConfirmToken is the token a caller must echo back to purge ns. It is
+// derived from the namespace so no server-side state is needed, but it still
+// forces a two-step request and guards against typos.
+func PurgeConfirmToken(ns string) string {
+	sum := sha256.Sum256([]byte("purge:" + ns))
+	return hex.EncodeToString(sum[:6])
+}
+
+// PurgeNamespace deletes all documents and chunks of ns from the metadata store,
+// with its saved clusters, access log, vector statistics and embedding
+// model tag, and unlinks their vectors from the index. The vectors stay in vectors.bin
+// (IDs are positional); use namespace isolation to reclaim the disk space.
+func (e *Engine) PurgeNamespace(ns string) (PurgeResult, error) {
+	ids, err := e.metadata.NamespaceChunkIDs(ns)
+	if err != nil {
+		return PurgeResult{}, err
+	}
+	named, err := e.namedVectorsOf(ids)
+	if err != nil {
+		return PurgeResult{}, err
+	}
+	docIDs, chunkIDs, err := e.metadata.DeleteNamespace(ns)
+	if err != nil {
+		return PurgeResult{}, err
+	}
+	for _, id := range chunkIDs {
+		e.index.Remove(id)
+	}
+	for _, id := range named {
+		e.index.Remove(id)
+	}
+	if err := e.unlinkNamedVectors(named); err != nil {
+		return PurgeResult{}, err
+	}
+	if err := e.forgetAccess(chunkIDs); err != nil {
+		return PurgeResult{}, err
+	}
+	if err := e.metadata.SetState(clusterKey(ns), ""); err != nil {
+		return PurgeResult{}, err
+	}
+	if err := e.metadata.SetState(modelTagKey(ns), ""); err != nil {
+		return PurgeResult{}, err
+	}
+	e.forgetVectorStats(ns)
+	e.forgetShortTerm(ns, "")
+	return PurgeResult{
+		Namespace: ns,
+		Documents: len(docIDs),
+		Chunks:    len(chunkIDs),
+	}, nil
+}
+
+// DeleteDocument removes a document with its chunks and unlinks the chunk
+// vectors and their extra vectors (see MetaVectors) from the index,
+// dropping their access log and the links of the extra vectors. It returns
+// how many chunks were removed.
+func (e *Engine) DeleteDocument(docID string) (int, error) {
+	e.forgetShortTerm("", docID)
+	chunks, err := e.metadata.DocumentChunks(docID)
+	if err != nil {
+		return 0, err
+	}
+	chunkIDs, err := e.metadata.DeleteDocument(docID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range chunkIDs {
+		e.index.Remove(id)
+	}
+	e.unindexNamedVectors(chunks)
+	if err := e.unlinkNamedVectors(namedVectorIDs(chunks)); err != nil {
+		return 0, err
+	}
+	if err := e.forgetAccess(chunkIDs); err != nil {
+		return 0, err
+	}
+	return len(chunkIDs), nil
+}
+
+// RebuildNamespace re-adds the vectors of ns to the index from disk, leaving
+// other namespaces' entries untouched. It returns how many were re-added.
+func (e *Engine) RebuildNamespace(ns string) (int, error) {
+	ids, err := e.metadata.NamespaceChunkIDs(ns)
+	if err != nil {
+		return 0, err
+	}
+	named, err := e.namedVectorsOf(ids)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range append(ids, named...) {
+		e.index.Remove(id)
+		v, err := e.vectors.Get(id)
+		if err != nil {
+			continue
+		}
+		e.index.Add(id, v)
+		n++
+	}
+	return n, nil
+}
+
+// namedVectorsOf lists the extra vector IDs of the chunks ids.
+func (e *Engine) namedVectorsOf(ids []uint64) ([]uint64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	found, err := e.metadata.GetChunks(ids)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]types.Chunk, 0, len(found))
+	for _, c := range found {
+		chunks = append(chunks, c)
+	}
+	return namedVectorIDs(chunks), nil
+}
@@ -0,0 +1,391 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// Eviction policies of a Quota: which documents go first when a namespace
+// is over it. Prior versions of re-indexed files go before any other
+// document, and pinned documents are never evicted.
+const (
+	EvictOldest         = "oldest"            // earliest document timestamp
+	EvictLowImportance  = "lowest_importance" // lowest chunk importance (see Importance)
+	EvictLeastRetrieved = "least_retrieved"   // fewest retrievals and "used" feedback
+)
+
+// EvictionPolicies lists the valid Quota.Policy values.
+var EvictionPolicies = []string{EvictOldest, EvictLowImportance, EvictLeastRetrieved}
+
+// quotasKey is the metadata state key holding every quota of a store.
+const quotasKey = "quotas"
+
+// Quota bounds what one namespace may store; 0 leaves a dimension
+// unbounded. Bytes count chunk content plus 4 bytes per vector dimension.
+type Quota struct {
+	Namespace string    `json:"namespace"`
+	MaxChunks int       `json:"max_chunks,omitempty"`
+	MaxBytes  int64     `json:"max_bytes,omitempty"`
+	MaxTokens int64     `json:"max_tokens,omitempty"`
+	Policy    string    `json:"policy"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Usage is what a namespace stores.
+type Usage struct {
+	Documents int   `json:"documents"`
+	Chunks    int   `json:"chunks"`
+	Bytes     int64 `json:"bytes"`
+	Tokens    int64 `json:"tokens"`
+}
+
+func (u Usage) within(q Quota) bool {
+	return (q.MaxChunks == 0 || u.Chunks <= q.MaxChunks) &&
+		(q.MaxBytes == 0 || u.Bytes <= q.MaxBytes) &&
+		(q.MaxTokens == 0 || u.Tokens <= q.MaxTokens)
+}
+
+// Evictions totals what quota enforcement removed from a namespace.
+type Evictions struct {
+	Documents int        `json:"documents"`
+	Chunks    int        `json:"chunks"`
+	Last      *time.Time `json:"last,omitempty"`
+}
+
+// QuotaStatus is a quota with the namespace's usage and evictions so far.
+type QuotaStatus struct {
+	Quota
+	Usage   Usage     `json:"usage"`
+	Evicted Evictions `json:"evicted"`
+}
+
+// quotaRecord is a quota as stored, with its eviction totals.
+type quotaRecord struct {
+	Quota
+	Evicted Evictions `json:"evicted"`
+}
+
+func (e *Engine) loadQuotas() (map[string]quotaRecord, error) {
+	out := map[string]quotaRecord{}
+	data, err := e.metadata.GetState(quotasKey)
+	if err != nil || data == "" {
+		return out, err
+	}
+	if err := json.Unmarshal([]byte(data), &out); err != nil {
+		return nil, fmt.Errorf("quotas: %w", err)
+	}
+	return out, nil
+}
+
+func (e *Engine) saveQuotas(quotas map[string]quotaRecord) error {
+	data, err := json.Marshal(quotas)
+	if err != nil {
+		return err
+	}
+	return e.metadata.SetState(quotasKey, string(data))
+}
+
+// SetQuota stores q, replacing the namespace's previous quota but keeping
+// its eviction totals, and enforces it at once.
+func (e *Engine) SetQuota(q Quota) (*QuotaStatus, error) {
+	e.quotaMu.Lock()
+	quotas, err := e.loadQuotas()
+	if err == nil {
+		q.UpdatedAt = time.Now().UTC()
+		quotas[q.Namespace] = quotaRecord{Quota: q, Evicted: quotas[q.Namespace].Evicted}
+		err = e.saveQuotas(quotas)
+	}
+	e.quotaMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.EnforceQuota(q.Namespace); err != nil {
+		return nil, err
+	}
+	st, err := e.Quotas(q.Namespace)
+	if err != nil || len(st) == 0 {
+		return nil, err
+	}
+	return &st[0], nil
+}
+
+// DeleteQuota removes the quota of ns and reports whether it had one.
+func (e *Engine) DeleteQuota(ns string) (bool, error) {
+	e.quotaMu.Lock()
+	defer e.quotaMu.Unlock()
+	quotas, err := e.loadQuotas()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := quotas[ns]; !ok {
+		return false, nil
+	}
+	delete(quotas, ns)
+	return true, e.saveQuotas(quotas)
+}
+
+// Quotas returns the quotas of the store with their usage, by namespace;
+// ns, if set, keeps only its own.
+func (e *Engine) Quotas(ns string) ([]QuotaStatus, error) {
+	quotas, err := e.loadQuotas()
+	if err != nil || len(quotas) == 0 {
+		return []QuotaStatus{}, err
+	}
+	e.usage.mu.Lock()
+	err = e.usage.sync(e)
+	out := []QuotaStatus{}
+	for _, rec := range quotas {
+		if ns != "" && rec.Namespace != ns {
+			continue
+		}
+		out = append(out, QuotaStatus{Quota: rec.Quota, Usage: e.usage.spaces[rec.Namespace], Evicted: rec.Evicted})
+	}
+	e.usage.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Namespace < out[j].Namespace })
+	return out, nil
+}
+
+// EvictionResult reports one EnforceQuota pass.
+type EvictionResult struct {
+	Namespace string   `json:"namespace"`
+	Documents []string `json:"documents"`
+	Chunks    int      `json:"chunks"`
+	Usage     Usage    `json:"usage"`
+}
+
+// EnforceQuota evicts documents of ns, by the quota's policy, until the
+// namespace is within its quota again. Without a quota it does nothing.
+// When only pinned documents are left the namespace may stay over it.
+func (e *Engine) EnforceQuota(ns string) (*EvictionResult, error) {
+	res := &EvictionResult{Namespace: ns, Documents: []string{}}
+	quotas, err := e.loadQuotas()
+	if err != nil {
+		return nil, err
+	}
+	rec, ok := quotas[ns]
+	if !ok {
+		return res, nil
+	}
+
+	e.usage.mu.Lock()
+	defer e.usage.mu.Unlock()
+	if err := e.usage.sync(e); err != nil {
+		return nil, err
+	}
+	res.Usage = e.usage.spaces[ns]
+	if res.Usage.within(rec.Quota) {
+		return res, nil
+	}
+
+	pins, err := e.metadata.ListPins(ns)
+	if err != nil {
+		return nil, err
+	}
+	pinned := map[string]bool{}
+	for _, p := range pins {
+		if p.DocID != "" {
+			pinned[p.DocID] = true
+		} else if p.ChunkID != nil {
+			if c, err := e.metadata.GetChunk(*p.ChunkID); err == nil {
+				pinned[c.DocID] = true
+			}
+		}
+	}
+	var candidates []string
+	for id, d := range e.usage.docs {
+		if d.ns == ns && !pinned[id] {
+			candidates = append(candidates, id)
+		}
+	}
+	if err := e.evictionOrder(candidates, rec.Policy); err != nil {
+		return nil, err
+	}
+
+	for _, id := range candidates {
+		if res.Usage.within(rec.Quota) {
+			break
+		}
+		n, err := e.DeleteDocument(id)
+		if err != nil {
+			return res, fmt.Errorf("evict %s: %w", id, err)
+		}
+		e.usage.remove(id)
+		res.Documents = append(res.Documents, id)
+		res.Chunks += n
+		res.Usage = e.usage.spaces[ns]
+	}
+	if len(res.Documents) == 0 {
+		return res, nil
+	}
+	log.Printf("[quota] evicted namespace=%s policy=%s documents=%d chunks=%d", ns, rec.Policy, len(res.Documents), res.Chunks)
+
+	e.quotaMu.Lock()
+	defer e.quotaMu.Unlock()
+	if quotas, err = e.loadQuotas(); err != nil {
+		return res, err
+	}
+	if rec, ok = quotas[ns]; ok {
+		now := time.Now().UTC()
+		rec.Evicted.Documents += len(res.Documents)
+		rec.Evicted.Chunks += res.Chunks
+		rec.Evicted.Last = &now
+		quotas[ns] = rec
+		return res, e.saveQuotas(quotas)
+	}
+	return res, nil
+}
+
+// evictionOrder sorts docIDs into eviction order under policy; ties go
+// oldest first. Callers hold e.usage.mu.
+func (e *Engine) evictionOrder(docIDs []string, policy string) error {
+	docs := e.usage.docs
+	// retrieved sums the access log of each document's chunks.
+	retrieved := map[string]int{}
+	if policy == EvictLeastRetrieved {
+		var ids []uint64
+		for _, id := range docIDs {
+			ids = append(ids, docs[id].chunkIDs...)
+		}
+		access, err := e.ChunkAccess(ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range docIDs {
+			for _, c := range docs[id].chunkIDs {
+				retrieved[id] += int(access[c].Count)
+			}
+		}
+	}
+	sort.Slice(docIDs, func(i, j int) bool {
+		a, b := docs[docIDs[i]], docs[docIDs[j]]
+		if a.prior != b.prior {
+			return a.prior
+		}
+		switch policy {
+		case EvictLowImportance:
+			if a.importance != b.importance {
+				return a.importance < b.importance
+			}
+		case EvictLeastRetrieved:
+			ra, rb := retrieved[docIDs[i]]+a.used, retrieved[docIDs[j]]+b.used
+			if ra != rb {
+				return ra < rb
+			}
+		}
+		if !a.timestamp.Equal(b.timestamp) {
+			return a.timestamp.Before(b.timestamp)
+		}
+		return docIDs[i] < docIDs[j]
+	})
+	return nil
+}
+
+// usageIndex tracks what every namespace stores, per document, following
+// the change log as centroidIndex does. It is built on first use.
+type usageIndex struct {
+	mu     sync.Mutex
+	built  bool
+	seq    uint64
+	docs   map[string]docUsage
+	spaces map[string]Usage
+}
+
+// docUsage is what one document stores, with what eviction ranks it by.
+type docUsage struct {
+	ns         string
+	chunks     int
+	chunkIDs   []uint64
+	bytes      int64
+	tokens     int64
+	importance float32 // highest of its chunks
+	used       int     // "used" feedback on its chunks
+	timestamp  time.Time
+	prior      bool
+}
+
+func (u *usageIndex) sync(e *Engine) error {
+	if u.built {
+		return e.followChanges(&u.seq, func(docID string) error { return u.update(e, docID) }, u.dropNamespace)
+	}
+	last, err := e.metadata.LastChange()
+	if err != nil {
+		return err
+	}
+	u.docs, u.spaces = map[string]docUsage{}, map[string]Usage{}
+	var ids []string
+	if err := e.metadata.ForEachDocument(func(doc types.Document) error {
+		ids = append(ids, doc.ID)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := u.update(e, id); err != nil {
+			return err
+		}
+	}
+	u.seq, u.built = last, true
+	return nil
+}
+
+func (u *usageIndex) update(e *Engine, docID string) error {
+	u.remove(docID)
+	doc, err := e.metadata.GetDocument(docID)
+	if err != nil {
+		return nil
+	}
+	chunks, err := e.metadata.DocumentChunks(docID)
+	if err != nil {
+		return err
+	}
+	ns, _ := doc.Metadata["namespace"].(string)
+	d := docUsage{ns: ns, chunks: len(chunks), timestamp: doc.Timestamp, prior: IsPriorVersion(*doc)}
+	vectorBytes := int64(4 * e.vectors.Dim())
+	for _, c := range chunks {
+		d.bytes += int64(len(c.Content)) + vectorBytes
+		d.tokens += int64(c.TokenCount)
+		d.importance = max(d.importance, Importance(c.Metadata, doc.Metadata))
+		d.used += ChunkFeedback(c.Metadata).Used
+		d.chunkIDs = append(d.chunkIDs, c.ID)
+	}
+	u.docs[docID] = d
+	sp := u.spaces[ns]
+	sp.Documents++
+	sp.Chunks += d.chunks
+	sp.Bytes += d.bytes
+	sp.Tokens += d.tokens
+	u.spaces[ns] = sp
+	return nil
+}
+
+func (u *usageIndex) remove(docID string) {
+	d, ok := u.docs[docID]
+	if !ok {
+		return
+	}
+	delete(u.docs, docID)
+	sp := u.spaces[d.ns]
+	sp.Documents--
+	sp.Chunks -= d.chunks
+	sp.Bytes -= d.bytes
+	sp.Tokens -= d.tokens
+	u.spaces[d.ns] = sp
+}
+
+func (u *usageIndex) dropNamespace(ns string) {
+	for id, d := range u.docs {
+		if d.ns == ns {
+			delete(u.docs, id)
+		}
+	}
+	delete(u.spaces, ns)
+}
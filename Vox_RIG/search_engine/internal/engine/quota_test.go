@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func TestQuotaEviction(t *testing.T) {
+	newEngine := func(t *testing.T) (*Engine, func(id string, age time.Duration, importance float64, v types.Vector), func() string) {
+		dir := t.TempDir()
+		vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { vecs.Close() })
+		meta := storage.NewMemoryMetadataStore()
+		idx := index.NewHnswIndex(vecs)
+		e := NewEngine(idx, vecs, meta)
+
+		now := time.Now()
+		add := func(id string, age time.Duration, importance float64, v types.Vector) {
+			t.Helper()
+			doc := types.Document{ID: id, Timestamp: now.Add(-age), Metadata: types.Metadata{"namespace": "ns", MetaImportance: importance}}
+			vid, err := vecs.Append(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := meta.SaveDocumentWithChunks(doc, []types.Chunk{{ID: vid, DocID: id, Content: id, TokenCount: 10}}); err != nil {
+				t.Fatal(err)
+			}
+			idx.Add(vid, v)
+		}
+		left := func() string {
+			docs, _ := meta.ListDocuments("ns")
+			var ids []string
+			for _, d := range docs {
+				ids = append(ids, d.ID)
+			}
+			sort.Strings(ids)
+			return strings.Join(ids, ",")
+		}
+		return e, add, left
+	}
+
+	t.Run("oldest", func(t *testing.T) {
+		e, add, left := newEngine(t)
+		add("old", 3*time.Hour, 1, types.Vector{1, 0})
+		add("mid", 2*time.Hour, 0, types.Vector{0, 1})
+		add("new", time.Hour, 0, types.Vector{1, 1})
+		if _, err := e.SetQuota(Quota{Namespace: "other", MaxChunks: 1, Policy: EvictOldest}); err != nil {
+			t.Fatal(err)
+		}
+		st, err := e.SetQuota(Quota{Namespace: "ns", MaxChunks: 2, Policy: EvictOldest})
+		if err != nil {
+			t.Fatalf("SetQuota failed: %v", err)
+		}
+		if left() != "mid,new" || st.Usage.Chunks != 2 || st.Evicted.Documents != 1 || st.Evicted.Last == nil {
+			t.Errorf("Expected old evicted, got %s and %+v", left(), st)
+		}
+
+		// Later writes are enforced too, and tokens count.
+		add("newest", 0, 0, types.Vector{0, 0})
+		e.SetQuota(Quota{Namespace: "ns", MaxTokens: 25, Policy: EvictOldest})
+		add("latest", 0, 0, types.Vector{0.5, 0.5})
+		res, err := e.EnforceQuota("ns")
+		if err != nil {
+			t.Fatalf("EnforceQuota failed: %v", err)
+		}
+		if left() != "latest,newest" || res.Usage.Tokens != 20 {
+			t.Errorf("Expected only the two newest left, got %s (%+v)", left(), res.Usage)
+		}
+		qs, _ := e.Quotas("ns")
+		if len(qs) != 1 || qs[0].Evicted.Documents != 3 || qs[0].Evicted.Chunks != 3 {
+			t.Errorf("Expected 3 evictions in total, got %+v", qs)
+		}
+	})
+
+	t.Run("lowest_importance", func(t *testing.T) {
+		e, add, left := newEngine(t)
+		add("old", 3*time.Hour, 1, types.Vector{1, 0})
+		add("mid", 2*time.Hour, 0.5, types.Vector{0, 1})
+		add("new", time.Hour, 0, types.Vector{1, 1})
+		if _, err := e.SetQuota(Quota{Namespace: "ns", MaxChunks: 2, Policy: EvictLowImportance}); err != nil {
+			t.Fatal(err)
+		}
+		if left() != "mid,old" {
+			t.Errorf("Expected the unimportant document evicted, got %s", left())
+		}
+	})
+
+	t.Run("least_retrieved_and_pins", func(t *testing.T) {
+		e, add, left := newEngine(t)
+		add("old", 3*time.Hour, 0, types.Vector{1, 0})
+		add("mid", 2*time.Hour, 0, types.Vector{0, 1})
+		add("new", time.Hour, 0, types.Vector{-1, 0})
+		// Retrieve old and mid, never new.
+		for _, q := range []types.Vector{{1, 0}, {0, 1}} {
+			if _, err := e.Retrieve(q, RetrievalConfig{MaxTokens: 10, SimilarityWeight: 1, TopKCandidates: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := e.SetQuota(Quota{Namespace: "ns", MaxChunks: 2, Policy: EvictLeastRetrieved}); err != nil {
+			t.Fatal(err)
+		}
+		if left() != "mid,old" {
+			t.Errorf("Expected the never retrieved document evicted first, got %s", left())
+		}
+
+		// old would go next (it is older), but pinned documents stay.
+		if err := e.metadata.SavePin(types.Pin{Namespace: "ns", DocID: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.SetQuota(Quota{Namespace: "ns", MaxChunks: 1, Policy: EvictLeastRetrieved}); err != nil {
+			t.Fatal(err)
+		}
+		if left() != "old" {
+			t.Errorf("Expected only the pinned document left, got %s", left())
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrReindexRunning is returned by Reindex while another one is building.
+var ErrReindexRunning = errors.New("a reindex is already running")
+
+// reindexProgressEvery is how many nodes Reindex adds between progress
+// reports and context checks.
+const reindexProgressEvery = 1024
+
+// ReindexResult reports a Reindex.
+type ReindexResult struct {
+	Nodes int `json:"nodes"`
+	// CaughtUp counts the nodes written to or deleted from the live index
+	// while the new one was built, applied to it before the swap.
+	CaughtUp  int     `json:"caught_up"`
+	ElapsedMS float64 `json:"elapsed_ms"`
+}
+
+// Reindex builds a new index of the same kind over the vectors the index
+// holds and swaps it in once complete (see index.HnswIndex.Replace); the old
+// one serves searches meanwhile. Graphs degrade as chunks are deleted and
+// re-added, and IVF lists as the vectors drift from the trained centroids,
+// so a fresh build restores recall without a restart. progress, if set,
+// receives the share of the build done.
+func (e *Engine) Reindex(ctx context.Context, progress func(float64)) (*ReindexResult, error) {
+	if !e.reindexing.CompareAndSwap(false, true) {
+		return nil, ErrReindexRunning
+	}
+	defer e.reindexing.Store(false)
+
+	start := time.Now()
+	ids := e.index.IDs()
+	fresh, err := e.index.Fresh()
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if i%reindexProgressEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if progress != nil {
+				progress(float64(i) / float64(len(ids)))
+			}
+		}
+		if v, err := e.vectors.Get(id); err == nil {
+			fresh.Add(id, v)
+		}
+	}
+	added, removed := e.index.Replace(fresh)
+	if progress != nil {
+		progress(1)
+	}
+	return &ReindexResult{
+		Nodes:     e.index.Len(),
+		CaughtUp:  added + removed,
+		ElapsedMS: float64(time.Since(start).Microseconds()) / 1000,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func TestReindex(t *testing.T) {
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(t.TempDir(), "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	idx := index.NewHnswIndex(vecs)
+	e := NewEngine(idx, vecs, storage.NewMemoryMetadataStore())
+	for i := 0; i < 100; i++ {
+		v := types.Vector{float32(i), 1}
+		id, err := vecs.Append(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Add(id, v)
+	}
+	idx.Remove(7)
+
+	var last float64
+	res, err := e.Reindex(context.Background(), func(f float64) { last = f })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Nodes != 99 || res.CaughtUp != 0 || last != 1 {
+		t.Errorf("Expected 99 nodes rebuilt and progress 1, got %+v %v", res, last)
+	}
+	if idx.Contains(7) {
+		t.Error("Expected the removed node to stay out of the new index")
+	}
+	if ids, _ := idx.Search(types.Vector{42, 1}, 1); len(ids) != 1 || ids[0] != 42 {
+		t.Errorf("Expected the rebuilt index to find node 42, got %v", ids)
+	}
+
+	e.reindexing.Store(true)
+	if _, err := e.Reindex(context.Background(), nil); !errors.Is(err, ErrReindexRunning) {
+		t.Errorf("Expected a second reindex to be refused, got %v", err)
+	}
+	e.reindexing.Store(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.Reindex(ctx, nil); !errors.Is(err, context.Canceled) || idx.Len() != 99 {
+		t.Errorf("Expected a canceled reindex to leave the index alone, got %v", err)
+	}
+}
@@ -1,11 +1,17 @@
 package engine
 
 import (
+	"context"
+	"fmt"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"vox-vector-engine/internal/index"
 	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/tokens"
+	"vox-vector-engine/internal/tracing"
 	"vox-vector-engine/internal/types"
 )
 
@@ -13,51 +19,455 @@ type RetrievalConfig struct {
 	MaxTokens        int
 	SimilarityWeight float32
 	RecencyWeight    float32
-	TopKCandidates   int // How many to fetch from ANN before re-ranking
+	// ImportanceWeight scales the importance of a chunk (see
+	// MetaImportance) added to its score.
+	ImportanceWeight float32
+	// FeedbackWeight scales the feedback recorded on a chunk (see
+	// AddFeedback), mapped to [-1, 1] and decayed with FeedbackHalfLife
+	// (0 means DefaultFeedbackHalfLife), added to its score.
+	FeedbackWeight   float32
+	FeedbackHalfLife time.Duration
+	// AccessWeight scales the access log of a chunk (see AccessScore,
+	// decayed with AccessHalfLife) added to its score. The log changes
+	// without invalidating cached results, so they lag by DefaultCacheTTL.
+	AccessWeight   float32
+	AccessHalfLife time.Duration
+	TopKCandidates int // How many to fetch from ANN before re-ranking
 
 	// Namespace: optional logical partition (e.g. project/workspace/repo/chat_id).
 	// If set, only chunks whose Document.Metadata["namespace"] matches will be returned.
 	Namespace string
+
+	// ConversationID, if set, only returns chunks whose
+	// Document.Metadata["conversation_id"] matches (chat messages).
+	ConversationID string
+
+	// Tokens, if set, recounts every candidate's content so MaxTokens is enforced
+	// with the same tokenizer the LLM uses instead of caller-supplied counts.
+	Tokens tokens.Counter
+
+	// Boosts multiplies the final score of a candidate by Boosts[key][value]
+	// when the chunk's (or else its document's) metadata has that value under
+	// key, e.g. {"role":{"user":1.2},"type":{"code":1.5}}. Boosts on
+	// different keys compound.
+	Boosts map[string]map[string]float32
+
+	// After and Before, when non-zero, keep only chunks whose document
+	// Timestamp lies in [After, Before).
+	After  time.Time
+	Before time.Time
+
+	// ExcludeDocIDs and ExcludeChunkIDs drop chunks the caller already has
+	// (e.g. the open file), pinned ones included, so they cost no budget.
+	ExcludeDocIDs   []string
+	ExcludeChunkIDs []uint64
+
+	// TagsAny keeps chunks whose document has at least one of these tags;
+	// TagsAll keeps chunks whose document has every one. Pinned chunks are
+	// not filtered.
+	TagsAny []string
+	TagsAll []string
+
+	// IncludeVersions also returns chunks of prior versions of re-indexed
+	// files (see ArchiveDocument); by default only the latest is searched.
+	IncludeVersions bool
+
+	// TwoStage first selects the TopDocs documents whose centroids (mean
+	// chunk vectors) are nearest the query, then ranks only their chunks.
+	// On stores holding many projects this keeps candidates from whole
+	// files instead of scattered chunks. TopDocs 0 means DefaultTopDocs.
+	TwoStage bool
+	TopDocs  int
+
+	// MaxVisits and SearchBudget bound the index search (see index.Budget);
+	// MaxVisits 0 means index.DefaultMaxVisits, SearchBudget 0 no time
+	// limit. A search that runs out returns its best candidates so far and
+	// marks the result Partial.
+	MaxVisits    int
+	SearchBudget time.Duration
+
+	// VectorWeights scores chunks with several vectors (see MetaVectors) by
+	// the weighted mean similarity of the named ones, ContentVector being
+	// the chunk's own, e.g. {"content": 1, "docstring": 0.5}; chunks with
+	// none of them are left out. Empty scores every chunk by its nearest
+	// vector.
+	VectorWeights map[string]float32
+
+	// SparseQuery adds the chunks whose sparse vectors (see MetaSparse)
+	// score highest against it to the candidates and blends the sparse
+	// score, relative to the best one, into the similarity with the share
+	// SparseWeight (0 means DefaultSparseWeight): exact terms such as
+	// identifiers then count even where the dense vectors blur them.
+	SparseQuery  types.SparseVector
+	SparseWeight float32
+}
+
+// taggedDocs resolves config's tag filters through the tag index to the set
+// of documents that pass; nil means no tag filter.
+func (e *Engine) taggedDocs(config RetrievalConfig) (map[string]bool, error) {
+	if len(config.TagsAny) == 0 && len(config.TagsAll) == 0 {
+		return nil, nil
+	}
+	var allowed map[string]bool
+	// keep narrows allowed to ids (the first call seeds it).
+	keep := func(ids []string) {
+		next := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			if allowed == nil || allowed[id] {
+				next[id] = true
+			}
+		}
+		allowed = next
+	}
+	for _, tag := range config.TagsAll {
+		ids, err := e.metadata.TaggedDocuments(tag)
+		if err != nil {
+			return nil, err
+		}
+		keep(ids)
+	}
+	if len(config.TagsAny) > 0 {
+		var anyIDs []string
+		for _, tag := range config.TagsAny {
+			ids, err := e.metadata.TaggedDocuments(tag)
+			if err != nil {
+				return nil, err
+			}
+			anyIDs = append(anyIDs, ids...)
+		}
+		keep(anyIDs)
+	}
+	return allowed, nil
+}
+
+// excluded builds the lookup for config's exclusion lists.
+func (config RetrievalConfig) excluded() func(types.Chunk) bool {
+	if len(config.ExcludeDocIDs) == 0 && len(config.ExcludeChunkIDs) == 0 {
+		return func(types.Chunk) bool { return false }
+	}
+	docs := make(map[string]bool, len(config.ExcludeDocIDs))
+	for _, id := range config.ExcludeDocIDs {
+		docs[id] = true
+	}
+	chunks := make(map[uint64]bool, len(config.ExcludeChunkIDs))
+	for _, id := range config.ExcludeChunkIDs {
+		chunks[id] = true
+	}
+	return func(c types.Chunk) bool { return chunks[c.ID] || docs[c.DocID] }
 }
 
 type RetrievalResult struct {
 	Chunks      []ScoredChunk `json:"chunks"`
 	TotalTokens int           `json:"total_tokens"`
 	Truncated   bool          `json:"truncated"`
+	// Partial is set when the index search ran out of its budget, so the
+	// chunks are the best found rather than the nearest.
+	Partial bool `json:"partial,omitempty"`
+	// ModelWarning is set when the query was tagged with another embedding
+	// model than the namespace's and the server only warns about it.
+	ModelWarning string `json:"model_warning,omitempty"`
 }
 
 type Engine struct {
-	index    *index.HnswIndex
+	index    index.Index
 	vectors  storage.VectorStore
-	metadata *storage.BoltMetadataStore
+	metadata storage.MetadataStore
+	// cache short-circuits repeated identical retrievals; nil disables it.
+	cache *resultCache
+	// centroids is the document-level index of two-stage retrieval.
+	centroids *centroidIndex
+	// sparse holds the postings of hybrid retrieval (see SparseQuery).
+	sparse *sparseIndex
+	// access batches the per-chunk retrieval log (see ChunkAccess).
+	access *accessLog
+	// usage and quotaMu serve namespace quotas (see SetQuota).
+	usage   *usageIndex
+	quotaMu sync.Mutex
+	// reindexing admits one Reindex at a time.
+	reindexing atomic.Bool
+	// vecStats tracks ingested vectors per namespace (see ObserveVectors).
+	vecStats *vectorStats
+	// tagMu serializes ClaimModelTag.
+	tagMu sync.Mutex
+	// rangeMu serializes updates of the file range lists (see AddFileRange).
+	rangeMu sync.Mutex
+	// shortTerm buffers the latest messages of each conversation (see
+	// RememberMessage).
+	shortTerm *shortTermMemory
 }
 
-func NewEngine(idx *index.HnswIndex, output storage.VectorStore, meta *storage.BoltMetadataStore) *Engine {
+func NewEngine(idx index.Index, output storage.VectorStore, meta storage.MetadataStore) *Engine {
 	return &Engine{
-		index:    idx,
-		vectors:  output,
-		metadata: meta,
+		index:     idx,
+		vectors:   output,
+		metadata:  meta,
+		cache:     newResultCache(DefaultCacheSize, DefaultCacheTTL),
+		centroids: &centroidIndex{},
+		sparse:    &sparseIndex{},
+		access:    &accessLog{},
+		usage:     &usageIndex{},
+		vecStats:  &vectorStats{},
+		shortTerm: &shortTermMemory{},
 	}
 }
 
+// SetCacheSize changes how many retrieval results are cached; 0 disables the
+// cache. Existing entries are dropped.
+func (e *Engine) SetCacheSize(n int) {
+	if n <= 0 {
+		e.cache = nil
+		return
+	}
+	e.cache = newResultCache(n, DefaultCacheTTL)
+}
+
+// CacheStats reports retrieval cache usage (zero when disabled).
+func (e *Engine) CacheStats() CacheStats {
+	if e.cache == nil {
+		return CacheStats{}
+	}
+	return e.cache.stats()
+}
+
 type ScoredChunk struct {
 	Chunk      types.Chunk `json:"chunk"`
 	Similarity float32     `json:"similarity"`
 	Recency    float32     `json:"recency"`
+	// Pinned marks chunks included because of a pin rather than their score.
+	Pinned bool `json:"pinned,omitempty"`
+	// ShortTerm marks a message still in its conversation's short-term
+	// buffer (see RememberMessage); it has no chunk ID yet.
+	ShortTerm bool `json:"short_term,omitempty"`
 }
 
+// Retrieve ranks the nearest chunks and packs them into config.MaxTokens.
+// Chunks pinned in config.Namespace come first and their token cost is
+// reserved before anything else is packed; they are always returned, even
+// when they alone exceed the budget. Results are cached until the engine's
+// stores change (see resultCache).
 func (e *Engine) Retrieve(query types.Vector, config RetrievalConfig) (*RetrievalResult, error) {
-	ids, dists := e.index.Search(query, config.TopKCandidates)
+	return e.RetrieveContext(context.Background(), query, config)
+}
 
-	candidates := make([]ScoredChunk, 0, len(ids))
+// RetrieveContext is Retrieve with the caller's context, under which it
+// records a span per stage (see package tracing).
+func (e *Engine) RetrieveContext(ctx context.Context, query types.Vector, config RetrievalConfig) (res *RetrievalResult, err error) {
+	ctx, span := tracing.Start(ctx, "engine.retrieve", tracing.String("namespace", config.Namespace))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+	defer func() {
+		if err == nil {
+			e.recordAccess(res)
+		}
+	}()
+	if e.cache == nil {
+		return e.retrieve(ctx, query, config)
+	}
+	// Read the generations first: a write that lands during retrieve makes
+	// the stored entry stale rather than serving stale results later.
+	gen := [3]uint64{e.metadata.Generation(), e.index.Generation(), e.shortTermVersion()}
+	key, ok := cacheKey(query, config)
+	if !ok {
+		return e.retrieve(ctx, query, config)
+	}
+	if res, ok := e.cache.get(key, gen); ok {
+		span.SetAttributes(tracing.Bool("cache_hit", true))
+		return res, nil
+	}
+	span.SetAttributes(tracing.Bool("cache_hit", false))
+	res, err = e.retrieve(ctx, query, config)
+	if err != nil {
+		return nil, err
+	}
+	// A partial result may be completed by the next search.
+	if !res.Partial {
+		e.cache.put(key, gen, res)
+	}
+	return res, nil
+}
+
+// Interrupted is returned when the context of a search ends before the
+// search does. It records how far the search got, so a timeout can be told
+// apart from a slow index or a slow metadata store.
+type Interrupted struct {
+	// Stage is the span of the step that was cut short.
+	Stage string
+	// Candidates is how many chunks the index search returned.
+	Candidates int
+	// Scored is how many of them were scored.
+	Scored  int
+	Elapsed time.Duration
+	// Err is the context's error: context.DeadlineExceeded or
+	// context.Canceled.
+	Err error
+}
+
+func (e *Interrupted) Error() string {
+	return fmt.Sprintf("%v after %s in %s (%d candidates, %d scored)",
+		e.Err, e.Elapsed.Round(time.Millisecond), e.Stage, e.Candidates, e.Scored)
+}
+
+func (e *Interrupted) Unwrap() error { return e.Err }
+
+// interruptCheckEvery is how many candidates are scored between checks of
+// the context; each costs a document lookup.
+const interruptCheckEvery = 32
+
+func (e *Engine) retrieve(ctx context.Context, query types.Vector, config RetrievalConfig) (*RetrievalResult, error) {
+	start := time.Now()
+	var candidateCount, scored int
+	interrupted := func(stage string) error {
+		if err := ctx.Err(); err != nil {
+			return &Interrupted{Stage: stage, Candidates: candidateCount, Scored: scored, Elapsed: time.Since(start), Err: err}
+		}
+		return nil
+	}
+
+	excluded := config.excluded()
+	_, span := tracing.Start(ctx, "metadata.pinned_chunks")
+	pinned, err := e.pinnedChunks(config)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	result := &RetrievalResult{
+		Chunks: []ScoredChunk{},
+	}
+	seen := map[uint64]bool{}
+	for _, c := range pinned {
+		seen[c.Chunk.ID] = true
+		if excluded(c.Chunk) {
+			continue
+		}
+		result.Chunks = append(result.Chunks, c)
+		result.TotalTokens += c.Chunk.TokenCount
+	}
+
+	_, span = tracing.Start(ctx, "metadata.tagged_docs")
+	tagged, err := e.taggedDocs(config)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+	var dists []float32
+	if config.TwoStage {
+		if ids, dists, err = e.twoStageCandidates(ctx, query, config); err != nil {
+			if ierr := interrupted("engine.rank_chunks"); ierr != nil {
+				return nil, ierr
+			}
+			return nil, err
+		}
+	} else {
+		if err := interrupted("index.search"); err != nil {
+			return nil, err
+		}
+		maxVisits := config.MaxVisits
+		if maxVisits == 0 {
+			maxVisits = index.DefaultMaxVisits
+		}
+		_, span = tracing.Start(ctx, "index.search", tracing.Int("k", config.TopKCandidates))
+		ids, dists, result.Partial, err = e.index.SearchBudget(ctx, query, config.TopKCandidates, index.EfSearch,
+			index.Budget{MaxVisits: maxVisits, Time: config.SearchBudget})
+		span.SetAttributes(tracing.Int("results", len(ids)), tracing.Bool("partial", result.Partial))
+		span.End()
+		if err != nil {
+			candidateCount = len(ids)
+			if ierr := interrupted("index.search"); ierr != nil {
+				return nil, ierr
+			}
+			return nil, fmt.Errorf("index search: %w", err)
+		}
+	}
+	candidateCount = len(ids)
+	if err := interrupted("metadata.get_chunks"); err != nil {
+		return nil, err
+	}
 
-	for i, id := range ids {
-		chunk, err := e.metadata.GetChunk(id)
+	_, span = tracing.Start(ctx, "metadata.get_chunks", tracing.Int("ids", len(ids)))
+	found, err := e.metadata.GetChunks(ids)
+	var hits map[uint64]vectorHit
+	if err == nil {
+		hits, err = e.resolveHits(ids, found)
+	}
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	chunkIDs, distances := chunkDistances(ids, dists, hits)
+	var sparseWeight, bestSparse float32
+	if len(config.SparseQuery) > 0 {
+		sparseWeight = config.SparseWeight
+		if sparseWeight == 0 {
+			sparseWeight = DefaultSparseWeight
+		}
+		_, span = tracing.Start(ctx, "sparse.search", tracing.Int("terms", len(config.SparseQuery)))
+		var sparseIDs []uint64
+		var sparseScores []float32
+		sparseIDs, sparseScores, err = e.SparseCandidates(config.SparseQuery, config.Namespace, config.TopKCandidates)
+		if err == nil && len(sparseIDs) > 0 {
+			bestSparse = sparseScores[0]
+			chunkIDs, err = e.addSparseCandidates(chunkIDs, sparseIDs, distances, found)
+		}
+		span.SetAttributes(tracing.Int("results", len(sparseIDs)))
+		span.End()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var access map[uint64]types.ChunkAccess
+	if config.AccessWeight != 0 {
+		_, span = tracing.Start(ctx, "metadata.get_access", tracing.Int("ids", len(chunkIDs)))
+		access, err = e.ChunkAccess(chunkIDs)
+		span.End()
 		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Scoring is dominated by one metadata document lookup per candidate.
+	_, span = tracing.Start(ctx, "engine.score")
+	candidates := make([]ScoredChunk, 0, len(chunkIDs))
+	lookups := 0
+	now := time.Now()
+
+	for i, id := range chunkIDs {
+		if i%interruptCheckEvery == 0 {
+			if err := interrupted("engine.score"); err != nil {
+				span.End()
+				return nil, err
+			}
+		}
+		scored = i
+		if seen[id] {
+			continue
+		}
+		chunk, ok := found[id]
+		if !ok || excluded(chunk) {
 			continue
 		}
+		if tagged != nil && !tagged[chunk.DocID] {
+			continue
+		}
+		if config.Tokens != nil {
+			chunk.TokenCount = config.Tokens.Count(chunk.Content)
+		}
 
 		doc, docErr := e.metadata.GetDocument(chunk.DocID)
+		lookups++
+		if !config.IncludeVersions && docErr == nil && IsPriorVersion(*doc) {
+			continue
+		}
+		if !config.After.IsZero() || !config.Before.IsZero() {
+			if docErr != nil || !inWindow(doc.Timestamp, config.After, config.Before) {
+				continue
+			}
+		}
 		if config.Namespace != "" {
 			if docErr != nil {
 				continue
@@ -70,30 +480,69 @@ func (e *Engine) Retrieve(query types.Vector, config RetrievalConfig) (*Retrieva
 				continue
 			}
 		}
+		if config.ConversationID != "" {
+			if docErr != nil {
+				continue
+			}
+			conv, ok := doc.Metadata["conversation_id"].(string)
+			if !ok || conv != config.ConversationID {
+				continue
+			}
+		}
 
-		simScore := float32(1.0 / (1.0 + dists[i]))
+		simScore, ok, err := e.vectorSimilarity(query, chunk, distances[id], config.VectorWeights)
+		if err != nil {
+			span.End()
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if sparseWeight != 0 {
+			var sparseScore float32
+			if bestSparse > 0 {
+				sparseScore = SparseScore(config.SparseQuery, Sparse(chunk.Metadata)) / bestSparse
+			}
+			simScore = (1-sparseWeight)*simScore + sparseWeight*sparseScore
+		}
 		recencyScore := float32(0.5) // default
 		if docErr == nil {
 			recencyScore = calculateRecency(doc.Timestamp)
 		}
 
+		var docMeta types.Metadata
+		if docErr == nil {
+			docMeta = doc.Metadata
+		}
 		finalScore := simScore*config.SimilarityWeight + recencyScore*config.RecencyWeight
+		if config.ImportanceWeight != 0 {
+			finalScore += Importance(chunk.Metadata, docMeta) * config.ImportanceWeight
+		}
+		if config.FeedbackWeight != 0 {
+			finalScore += feedbackTerm(FeedbackScore(chunk.Metadata, now, config.FeedbackHalfLife)) * config.FeedbackWeight
+		}
+		if config.AccessWeight != 0 {
+			finalScore += AccessScore(access[id], now, config.AccessHalfLife) * config.AccessWeight
+		}
+		if len(config.Boosts) > 0 {
+			finalScore *= boost(config.Boosts, chunk.Metadata, docMeta)
+		}
 
 		candidates = append(candidates, ScoredChunk{
-			Chunk:      *chunk,
+			Chunk:      chunk,
 			Similarity: finalScore,
 			Recency:    recencyScore,
 		})
 	}
 
+	candidates = append(candidates, e.shortTermCandidates(query, config)...)
+	span.SetAttributes(tracing.Int("document_lookups", lookups), tracing.Int("candidates", len(candidates)))
+	span.End()
+
 	sort.Slice(candidates, func(i, j int) bool {
 		return candidates[i].Similarity > candidates[j].Similarity
 	})
 
-	result := &RetrievalResult{
-		Chunks: []ScoredChunk{},
-	}
-
 	for _, cand := range candidates {
 		if result.TotalTokens+cand.Chunk.TokenCount > config.MaxTokens {
 			result.Truncated = true
@@ -106,6 +555,79 @@ func (e *Engine) Retrieve(query types.Vector, config RetrievalConfig) (*Retrieva
 	return result, nil
 }
 
+// boost returns the product of the multipliers in boosts that match the
+// metadata; chunk-level values take precedence over document-level ones.
+func boost(boosts map[string]map[string]float32, chunkMeta, docMeta types.Metadata) float32 {
+	factor := float32(1)
+	for key, byValue := range boosts {
+		v, ok := chunkMeta[key]
+		if !ok {
+			v, ok = docMeta[key]
+		}
+		if !ok {
+			continue
+		}
+		if m, ok := byValue[fmt.Sprint(v)]; ok {
+			factor *= m
+		}
+	}
+	return factor
+}
+
+// inWindow reports whether t lies in [after, before); zero bounds are open.
+func inWindow(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
+
+// pinnedChunks loads the chunks pinned in config.Namespace, in pin order.
+// Pins whose target no longer exists are skipped.
+func (e *Engine) pinnedChunks(config RetrievalConfig) ([]ScoredChunk, error) {
+	pins, err := e.metadata.ListPins(config.Namespace)
+	if err != nil || len(pins) == 0 {
+		return nil, err
+	}
+
+	var out []ScoredChunk
+	seen := map[uint64]bool{}
+	add := func(c types.Chunk) {
+		if seen[c.ID] {
+			return
+		}
+		seen[c.ID] = true
+		if config.Tokens != nil {
+			c.TokenCount = config.Tokens.Count(c.Content)
+		}
+		recency := float32(0.5)
+		if doc, err := e.metadata.GetDocument(c.DocID); err == nil {
+			recency = calculateRecency(doc.Timestamp)
+		}
+		out = append(out, ScoredChunk{Chunk: c, Recency: recency, Pinned: true})
+	}
+
+	for _, p := range pins {
+		if p.ChunkID != nil {
+			if c, err := e.metadata.GetChunk(*p.ChunkID); err == nil {
+				add(*c)
+			}
+			continue
+		}
+		chunks, err := e.metadata.DocumentChunks(p.DocID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			add(c)
+		}
+	}
+	return out, nil
+}
+
 func calculateRecency(t time.Time) float32 {
 	hours := time.Since(t).Hours()
 	return float32(1.0 / (1.0 + hours/24.0))
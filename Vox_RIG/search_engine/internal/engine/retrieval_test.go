@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// failingIndex is an index whose searches fail.
+type failingIndex struct {
+	index.Index
+	err error
+}
+
+func (f failingIndex) SearchBudget(context.Context, types.Vector, int, int, index.Budget) ([]uint64, []float32, bool, error) {
+	return nil, nil, false, f.err
+}
+
+func TestRetrieveIndexError(t *testing.T) {
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(t.TempDir(), "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	meta := storage.NewMemoryMetadataStore()
+	idx := index.NewHnswIndex(vecs)
+	id, err := vecs.Append(types.Vector{1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Add(id, types.Vector{1, 0})
+
+	boom := errors.New("boom")
+	for _, cached := range []bool{false, true} {
+		e := NewEngine(failingIndex{Index: idx, err: boom}, vecs, meta)
+		if !cached {
+			e.SetCacheSize(0)
+		}
+		res, err := e.RetrieveContext(context.Background(), types.Vector{1, 0}, RetrievalConfig{MaxTokens: 10, SimilarityWeight: 1, TopKCandidates: 10})
+		if !errors.Is(err, boom) || res != nil {
+			t.Errorf("cached=%v: expected the index error, got %v, %v", cached, res, err)
+		}
+	}
+}
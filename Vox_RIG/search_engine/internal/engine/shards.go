@@ -0,0 +1,406 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+)
+
+// DefaultNamespace is the shard used when a request does not name a namespace
+// while the server runs with per-namespace isolation.
+const DefaultNamespace = "default"
+
+// Shard bundles the stores, index and engine that serve a single namespace.
+// In shared mode the server wraps its global stores in one Shard; in isolated
+// mode every namespace gets its own directory with its own files.
+type Shard struct {
+	Namespace string
+	Dir       string
+	Vectors   storage.VectorStore
+	Meta      storage.MetadataStore
+	Index     index.Index
+	Engine    *Engine
+}
+
+// ShardManager owns one Shard per namespace under a root directory:
+//
+//	<root>/<escaped-namespace>/vectors.bin
+//	<root>/<escaped-namespace>/metadata.db
+//
+// Shards are opened lazily and their in-memory index is rebuilt from vectors.bin
+// on first use, so a namespace can be dropped or rebuilt without touching others.
+type ShardManager struct {
+	root string
+	mu   sync.Mutex
+	// cfg is what shards opened from now on are opened with.
+	cfg    shardConfig
+	shards map[string]*Shard
+	// opening holds the opens in progress, which run without mu so a cold
+	// shard does not hold up the others; callers for the same namespace
+	// wait on its latch.
+	opening map[string]*shardOpen
+}
+
+// shardConfig is how a ShardManager opens shards.
+type shardConfig struct {
+	dim     int
+	policy  storage.FlushPolicy
+	growth  storage.GrowthPolicy
+	backend storage.MetadataBackend
+	// indexConfig configures the shards' indexes.
+	indexConfig index.Config
+	// readOnly opens existing shards without write access and never creates one.
+	readOnly bool
+}
+
+// shardOpen is the latch of one shard being opened; sh and err are set
+// before done closes.
+type shardOpen struct {
+	done chan struct{}
+	sh   *Shard
+	err  error
+}
+
+func NewShardManager(root string, dim int) (*ShardManager, error) {
+	if dim <= 0 {
+		return nil, fmt.Errorf("invalid dim: %d", dim)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create shard root: %w", err)
+	}
+	return &ShardManager{
+		root:    root,
+		cfg:     shardConfig{dim: dim},
+		shards:  make(map[string]*Shard),
+		opening: make(map[string]*shardOpen),
+	}, nil
+}
+
+// Root returns the directory that holds all namespace shards.
+func (m *ShardManager) Root() string {
+	return m.root
+}
+
+// SetFlushPolicy applies p to every shard opened from now on.
+func (m *ShardManager) SetFlushPolicy(p storage.FlushPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg.policy = p
+}
+
+// SetGrowthPolicy sizes the vectors files of shards opened from now on.
+func (m *ShardManager) SetGrowthPolicy(g storage.GrowthPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg.growth = g
+}
+
+// SetReadOnly makes shards opened from now on read-only; namespaces without
+// a shard on disk then fail to open instead of being created.
+func (m *ShardManager) SetReadOnly(ro bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg.readOnly = ro
+}
+
+// SetMetadataBackend selects the metadata store for shards opened from now on.
+func (m *ShardManager) SetMetadataBackend(b storage.MetadataBackend) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg.backend = b
+}
+
+// SetIndexConfig selects the index (see index.New) of shards opened from now on.
+func (m *ShardManager) SetIndexConfig(c index.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg.indexConfig = c
+}
+
+// Get returns the shard for ns, opening (or creating) it on first use.
+// An empty namespace resolves to DefaultNamespace. Opening rebuilds the
+// shard's index, so it runs outside the manager's lock: other namespaces
+// are served meanwhile and callers for ns wait for the one open.
+func (m *ShardManager) Get(ns string) (*Shard, error) {
+	if ns == "" {
+		ns = DefaultNamespace
+	}
+
+	m.mu.Lock()
+	if sh, ok := m.shards[ns]; ok {
+		m.mu.Unlock()
+		return sh, nil
+	}
+	if op, ok := m.opening[ns]; ok {
+		m.mu.Unlock()
+		<-op.done
+		return op.sh, op.err
+	}
+	op := &shardOpen{done: make(chan struct{})}
+	m.opening[ns] = op
+	cfg := m.cfg
+	m.mu.Unlock()
+
+	op.sh, op.err = m.open(ns, cfg)
+
+	m.mu.Lock()
+	delete(m.opening, ns)
+	if op.err == nil {
+		m.shards[ns] = op.sh
+	}
+	m.mu.Unlock()
+	close(op.done)
+	return op.sh, op.err
+}
+
+// waitOpening waits until no open of ns is in progress. m.mu must be held;
+// it is released while waiting and held again on return.
+func (m *ShardManager) waitOpening(ns string) {
+	for {
+		op, ok := m.opening[ns]
+		if !ok {
+			return
+		}
+		m.mu.Unlock()
+		<-op.done
+		m.mu.Lock()
+	}
+}
+
+func (m *ShardManager) open(ns string, cfg shardConfig) (*Shard, error) {
+	dir := filepath.Join(m.root, shardDirName(ns))
+	if cfg.readOnly {
+		return m.openReadOnly(ns, dir, cfg)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create shard dir for namespace %q: %w", ns, err)
+	}
+
+	vecs, err := storage.NewMmapVectorStoreWithGrowth(filepath.Join(dir, "vectors.bin"), cfg.dim, cfg.growth)
+	if err != nil {
+		return nil, fmt.Errorf("namespace %q: %w", ns, err)
+	}
+	vecs.SetFlushPolicy(cfg.policy)
+	meta, err := cfg.backend.Open(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		_ = vecs.Close()
+		return nil, fmt.Errorf("namespace %q: %w", ns, err)
+	}
+
+	idx, err := index.New(cfg.indexConfig, vecs)
+	if err != nil {
+		_ = meta.Close()
+		_ = vecs.Close()
+		return nil, fmt.Errorf("namespace %q: %w", ns, err)
+	}
+	RebuildIndex(idx, vecs)
+
+	return &Shard{
+		Namespace: ns,
+		Dir:       dir,
+		Vectors:   vecs,
+		Meta:      meta,
+		Index:     idx,
+		Engine:    NewEngine(idx, vecs, meta),
+	}, nil
+}
+
+func (m *ShardManager) openReadOnly(ns, dir string, cfg shardConfig) (*Shard, error) {
+	vecs, err := storage.OpenMmapVectorStoreReadOnly(filepath.Join(dir, "vectors.bin"), cfg.dim)
+	if err != nil {
+		return nil, fmt.Errorf("namespace %q: %w", ns, err)
+	}
+	meta, err := cfg.backend.OpenReadOnly(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		_ = vecs.Close()
+		return nil, fmt.Errorf("namespace %q: %w", ns, err)
+	}
+	idx, err := index.New(cfg.indexConfig, vecs)
+	if err != nil {
+		_ = meta.Close()
+		_ = vecs.Close()
+		return nil, fmt.Errorf("namespace %q: %w", ns, err)
+	}
+	RebuildIndex(idx, vecs)
+	eng := NewEngine(idx, vecs, meta)
+	eng.SetAccessLog(false)
+	return &Shard{
+		Namespace: ns,
+		Dir:       dir,
+		Vectors:   vecs,
+		Meta:      meta,
+		Index:     idx,
+		Engine:    eng,
+	}, nil
+}
+
+// Namespaces lists every namespace that has a shard directory on disk,
+// including ones that have not been opened yet.
+func (m *ShardManager) Namespaces() ([]string, error) {
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		ns, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+		out = append(out, ns)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// All opens every namespace shard on disk and returns them sorted by namespace.
+func (m *ShardManager) All() ([]*Shard, error) {
+	nss, err := m.Namespaces()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Shard, 0, len(nss))
+	for _, ns := range nss {
+		sh, err := m.Get(ns)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sh)
+	}
+	return out, nil
+}
+
+// Open returns the shards opened so far, sorted by namespace, without
+// opening any: cheap enough for health checks and statistics.
+func (m *ShardManager) Open() []*Shard {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*Shard, 0, len(m.shards))
+	for _, sh := range m.shards {
+		out = append(out, sh)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Namespace < out[j].Namespace })
+	return out
+}
+
+// Rebuild discards the in-memory index of ns and re-adds every stored vector.
+func (m *ShardManager) Rebuild(ns string) error {
+	sh, err := m.Get(ns)
+	if err != nil {
+		return err
+	}
+	sh.Index.Reset()
+	RebuildIndex(sh.Index, sh.Vectors)
+	return nil
+}
+
+// Drop closes the shard for ns and deletes its directory from disk.
+func (m *ShardManager) Drop(ns string) error {
+	if ns == "" {
+		ns = DefaultNamespace
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.waitOpening(ns)
+	if sh, ok := m.shards[ns]; ok {
+		if err := closeShard(sh); err != nil {
+			return err
+		}
+		delete(m.shards, ns)
+	}
+	return os.RemoveAll(filepath.Join(m.root, shardDirName(ns)))
+}
+
+// Close closes every open shard.
+func (m *ShardManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for len(m.opening) > 0 {
+		for ns := range m.opening {
+			m.waitOpening(ns)
+			break
+		}
+	}
+	var firstErr error
+	for ns, sh := range m.shards {
+		if err := closeShard(sh); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(m.shards, ns)
+	}
+	return firstErr
+}
+
+func closeShard(sh *Shard) error {
+	if err := sh.Engine.FlushShortTerm(); err != nil {
+		log.Printf("[short-term] flush failed namespace=%s: %v", sh.Namespace, err)
+	}
+	if err := sh.Engine.FlushAccess(); err != nil {
+		log.Printf("[access] flush failed namespace=%s: %v", sh.Namespace, err)
+	}
+	_ = sh.Index.Close()
+	vErr := sh.Vectors.Close()
+	mErr := sh.Meta.Close()
+	if vErr != nil {
+		return vErr
+	}
+	return mErr
+}
+
+// RebuildIndex re-adds every vector in vecs to idx. Indexes are in-memory
+// only, so this is required whenever a store is (re)opened.
+func RebuildIndex(idx index.Index, vecs storage.VectorStore) {
+	RebuildIndexProgress(idx, vecs, nil)
+}
+
+// RebuildIndexProgress is RebuildIndex for large stores: vectors already in
+// idx are skipped, so it can run while new ones are being added, and
+// progress, if set, is called every 1024 vectors and once at the end.
+func RebuildIndexProgress(idx index.Index, vecs storage.VectorStore, progress func(done, total uint64)) {
+	count := vecs.Count()
+	for i := uint64(0); i < count; i++ {
+		if !idx.Contains(i) {
+			if v, err := vecs.Get(i); err == nil {
+				idx.Add(i, v)
+			}
+		}
+		if progress != nil && (i+1)%1024 == 0 {
+			progress(i+1, count)
+		}
+	}
+	if progress != nil {
+		progress(count, count)
+	}
+}
+
+// shardDirName maps a namespace onto a single safe path element. Characters
+// outside [A-Za-z0-9._-] are percent-encoded so url.PathUnescape reverses it.
+func shardDirName(ns string) string {
+	var b strings.Builder
+	for i := 0; i < len(ns); i++ {
+		c := ns[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		case c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/storage"
+)
+
+func TestShardManagerOpenListsOnlyOpenedShards(t *testing.T) {
+	m, err := NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for _, ns := range []string{"b", "a"} {
+		if _, err := m.Get(ns); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A namespace on disk that this manager has not opened.
+	if err := os.MkdirAll(filepath.Join(m.Root(), shardDirName("cold")), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	open := m.Open()
+	if len(open) != 2 || open[0].Namespace != "a" || open[1].Namespace != "b" {
+		t.Fatalf("Open() = %v, want shards a and b", namespacesOf(open))
+	}
+	if len(m.Open()) != 2 {
+		t.Fatal("Open() opened a shard")
+	}
+}
+
+func TestShardManagerGetOpensOutsideLock(t *testing.T) {
+	m, err := NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// Hold the metadata lock of "slow" so opening it blocks in bolt.
+	dir := filepath.Join(m.Root(), shardDirName("slow"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	held, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		sh  *Shard
+		err error
+	}
+	results := make(chan result, 2)
+	get := func() {
+		sh, err := m.Get("slow")
+		results <- result{sh, err}
+	}
+	go get()
+	// The vectors file is created just before the metadata store is opened.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "vectors.bin")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("opening slow never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go get()
+
+	if _, err := m.Get("fast"); err != nil {
+		t.Fatalf("Get(fast) while slow is opening: %v", err)
+	}
+	select {
+	case r := <-results:
+		t.Fatalf("Get(slow) returned while its metadata was locked: %v", r.err)
+	default:
+	}
+	if open := m.Open(); len(open) != 1 || open[0].Namespace != "fast" {
+		t.Fatalf("Open() = %v, want only fast", namespacesOf(open))
+	}
+
+	if err := held.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r1, r2 := <-results, <-results
+	if r1.err != nil || r2.err != nil {
+		t.Fatalf("Get(slow): %v, %v", r1.err, r2.err)
+	}
+	if r1.sh != r2.sh {
+		t.Fatal("concurrent Gets opened slow twice")
+	}
+	if len(m.Open()) != 2 {
+		t.Fatalf("Open() = %v, want fast and slow", namespacesOf(m.Open()))
+	}
+}
+
+func namespacesOf(shards []*Shard) []string {
+	out := make([]string, len(shards))
+	for i, sh := range shards {
+		out[i] = sh.Namespace
+	}
+	return out
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/types"
+)
+
+// ShortTermMessage is a chat message held in its conversation's short-term
+// buffer: its document and its single chunk, prepared for storage (vector
+// as searched, token count, importance) but without an ID yet.
+type ShortTermMessage struct {
+	Document types.Document
+	Chunk    types.Chunk
+}
+
+// shortTermMemory is the working memory of an engine: the last messages
+// of every conversation, kept in memory and searched by brute force next
+// to the index. Older messages are promoted to the stores as new ones
+// arrive, and every buffered one when the engine flushes.
+type shortTermMemory struct {
+	mu sync.Mutex
+	// convs holds each conversation's messages, oldest first, by
+	// namespace and conversation ID.
+	convs map[[2]string][]ShortTermMessage
+	// version changes with every write, for the result cache.
+	version uint64
+}
+
+func conversationKey(doc types.Document) [2]string {
+	ns, _ := doc.Metadata["namespace"].(string)
+	conv, _ := doc.Metadata["conversation_id"].(string)
+	return [2]string{ns, conv}
+}
+
+// RememberMessage adds m to the short-term buffer of its conversation,
+// replacing a buffered message with the same document ID, and keeps the
+// last size messages there. The older ones are written to the stores and
+// indexed; their stored chunks are returned.
+func (e *Engine) RememberMessage(m ShortTermMessage, size int) ([]types.Chunk, error) {
+	st := e.shortTerm
+	st.mu.Lock()
+	if st.convs == nil {
+		st.convs = map[[2]string][]ShortTermMessage{}
+	}
+	key := conversationKey(m.Document)
+	msgs := slices.DeleteFunc(st.convs[key], func(b ShortTermMessage) bool { return b.Document.ID == m.Document.ID })
+	msgs = append(msgs, m)
+	var promote []ShortTermMessage
+	if over := len(msgs) - max(size, 0); over > 0 {
+		promote = slices.Clone(msgs[:over])
+		msgs = msgs[over:]
+	}
+	st.convs[key] = msgs
+	st.version++
+	st.mu.Unlock()
+	return e.storeMessages(promote)
+}
+
+// ShortTermMessage returns the buffered message with document ID docID.
+func (e *Engine) ShortTermMessage(docID string) (*ShortTermMessage, bool) {
+	st := e.shortTerm
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, msgs := range st.convs {
+		for i := range msgs {
+			if msgs[i].Document.ID == docID {
+				m := msgs[i]
+				return &m, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// FlushShortTerm writes every buffered message to the stores, emptying the
+// short-term buffers. It runs when the engine's stores close, so working
+// memory survives a restart.
+func (e *Engine) FlushShortTerm() error {
+	st := e.shortTerm
+	st.mu.Lock()
+	var all []ShortTermMessage
+	for _, msgs := range st.convs {
+		all = append(all, msgs...)
+	}
+	if len(all) > 0 {
+		st.convs = nil
+		st.version++
+	}
+	st.mu.Unlock()
+	_, err := e.storeMessages(all)
+	return err
+}
+
+// storeMessages appends, saves and indexes promoted messages.
+func (e *Engine) storeMessages(msgs []ShortTermMessage) ([]types.Chunk, error) {
+	stored := make([]types.Chunk, 0, len(msgs))
+	for _, m := range msgs {
+		id, err := e.vectors.Append(m.Chunk.Vector)
+		if err != nil {
+			return stored, fmt.Errorf("promote %s: %w", m.Document.ID, err)
+		}
+		c := m.Chunk
+		c.ID, c.DocID = id, m.Document.ID
+		doc := m.Document
+		doc.Metadata = make(types.Metadata, len(m.Document.Metadata)+1)
+		for k, v := range m.Document.Metadata {
+			doc.Metadata[k] = v
+		}
+		doc.Metadata["chunk_id"] = id
+		if err := e.metadata.SaveDocumentWithChunks(doc, []types.Chunk{c}); err != nil {
+			return stored, fmt.Errorf("promote %s: %w", m.Document.ID, err)
+		}
+		e.index.Add(id, c.Vector)
+		stored = append(stored, c)
+	}
+	return stored, nil
+}
+
+// forgetShortTerm drops buffered messages without storing them: those of
+// namespace ns, or the one with document ID docID.
+func (e *Engine) forgetShortTerm(ns, docID string) {
+	st := e.shortTerm
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key, msgs := range st.convs {
+		if ns != "" && key[0] == ns {
+			delete(st.convs, key)
+			st.version++
+			continue
+		}
+		if docID == "" {
+			continue
+		}
+		if kept := slices.DeleteFunc(msgs, func(m ShortTermMessage) bool { return m.Document.ID == docID }); len(kept) != len(msgs) {
+			st.convs[key] = kept
+			st.version++
+		}
+	}
+}
+
+func (e *Engine) shortTermVersion() uint64 {
+	e.shortTerm.mu.Lock()
+	defer e.shortTerm.mu.Unlock()
+	return e.shortTerm.version
+}
+
+// shortTermCandidates scores the buffered messages that pass config's
+// filters against query, by exact distance and like stored chunks
+// otherwise. Having no IDs yet, they carry no feedback or access log.
+func (e *Engine) shortTermCandidates(query types.Vector, config RetrievalConfig) []ScoredChunk {
+	st := e.shortTerm
+	st.mu.Lock()
+	var msgs []ShortTermMessage
+	for key, conv := range st.convs {
+		if (config.Namespace == "" || key[0] == config.Namespace) && (config.ConversationID == "" || key[1] == config.ConversationID) {
+			msgs = append(msgs, conv...)
+		}
+	}
+	st.mu.Unlock()
+
+	excludedDocs := make(map[string]bool, len(config.ExcludeDocIDs))
+	for _, id := range config.ExcludeDocIDs {
+		excludedDocs[id] = true
+	}
+	var out []ScoredChunk
+	for _, m := range msgs {
+		doc, chunk := m.Document, m.Chunk
+		if excludedDocs[doc.ID] || !hasTags(doc.Tags, config.TagsAny, config.TagsAll) {
+			continue
+		}
+		if (!config.After.IsZero() || !config.Before.IsZero()) && !inWindow(doc.Timestamp, config.After, config.Before) {
+			continue
+		}
+		if config.Tokens != nil {
+			chunk.TokenCount = config.Tokens.Count(chunk.Content)
+		}
+		chunk.DocID = doc.ID
+		simScore := 1 / (1 + index.Distance(query, chunk.Vector))
+		recencyScore := calculateRecency(doc.Timestamp)
+		finalScore := simScore*config.SimilarityWeight + recencyScore*config.RecencyWeight
+		if config.ImportanceWeight != 0 {
+			finalScore += Importance(chunk.Metadata, doc.Metadata) * config.ImportanceWeight
+		}
+		if len(config.Boosts) > 0 {
+			finalScore *= boost(config.Boosts, chunk.Metadata, doc.Metadata)
+		}
+		out = append(out, ScoredChunk{Chunk: chunk, Similarity: finalScore, Recency: recencyScore, ShortTerm: true})
+	}
+	return out
+}
+
+// hasTags reports whether tags pass the TagsAny and TagsAll filters.
+func hasTags(tags, anyOf, allOf []string) bool {
+	for _, t := range allOf {
+		if !slices.Contains(tags, t) {
+			return false
+		}
+	}
+	if len(anyOf) == 0 {
+		return true
+	}
+	for _, t := range anyOf {
+		if slices.Contains(tags, t) {
+			return true
+		}
+	}
+	return false
+}
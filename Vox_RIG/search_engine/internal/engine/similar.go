@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/tracing"
+	"vox-vector-engine/internal/types"
+)
+
+// SimilarConfig configures SimilarDocuments.
+type SimilarConfig struct {
+	// Limit is how many documents to return.
+	Limit int
+	// Namespace, if set, keeps documents whose metadata namespace matches.
+	Namespace string
+	// ExcludeDocIDs are left out, typically the document the query came from.
+	ExcludeDocIDs []string
+	// IncludeVersions also returns prior versions of re-indexed files.
+	IncludeVersions bool
+}
+
+// SimilarDocument is a document near the query, scored by its best chunk.
+type SimilarDocument struct {
+	Document types.Document `json:"document"`
+	// Similarity is 1/(1+distance) of the best chunk, as in retrieval.
+	Similarity float32 `json:"similarity"`
+	// Chunk is the document's chunk nearest the query.
+	Chunk types.Chunk `json:"chunk"`
+	// Matches counts the document's chunks among the candidates.
+	Matches int `json:"matches"`
+}
+
+// similarCandidatesPerDoc is how many chunks are searched per requested
+// document, since a long file can fill the candidates with its own chunks.
+const similarCandidatesPerDoc = 10
+
+// DocumentVector averages the stored vectors of docID's chunks, the point
+// the document sits at in the index. It returns the number of vectors
+// averaged.
+func (e *Engine) DocumentVector(docID string) (types.Vector, int, error) {
+	chunks, err := e.metadata.DocumentChunks(docID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var sum types.Vector
+	n := 0
+	for _, c := range chunks {
+		v, err := e.vectors.Get(c.ID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("vector of chunk %d: %w", c.ID, err)
+		}
+		if sum == nil {
+			sum = make(types.Vector, len(v))
+		}
+		for i, f := range v {
+			sum[i] += f
+		}
+		n++
+	}
+	for i := range sum {
+		sum[i] /= float32(n)
+	}
+	return sum, n, nil
+}
+
+// SimilarDocuments returns the documents nearest query, best first, each
+// represented by its nearest chunk.
+func (e *Engine) SimilarDocuments(ctx context.Context, query types.Vector, config SimilarConfig) ([]SimilarDocument, error) {
+	k := max(config.Limit*similarCandidatesPerDoc, 50)
+	_, span := tracing.Start(ctx, "index.search", tracing.Int("k", k))
+	start := time.Now()
+	ids, dists, err := e.index.SearchContext(ctx, query, k, max(k, index.EfSearch))
+	span.End()
+	if err != nil {
+		return nil, &Interrupted{Stage: "index.search", Candidates: len(ids), Elapsed: time.Since(start), Err: err}
+	}
+
+	found, err := e.metadata.GetChunks(ids)
+	if err != nil {
+		return nil, err
+	}
+	excluded := map[string]bool{}
+	for _, id := range config.ExcludeDocIDs {
+		excluded[id] = true
+	}
+
+	byDoc := map[string]*SimilarDocument{}
+	var out []*SimilarDocument
+	for i, id := range ids {
+		if i%interruptCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, &Interrupted{Stage: "engine.score", Candidates: len(ids), Scored: i, Elapsed: time.Since(start), Err: err}
+			}
+		}
+		chunk, ok := found[id]
+		if !ok || excluded[chunk.DocID] {
+			continue
+		}
+		if d := byDoc[chunk.DocID]; d != nil {
+			// Search results come nearest first, so the first chunk seen
+			// is the document's best.
+			d.Matches++
+			continue
+		}
+		doc, err := e.metadata.GetDocument(chunk.DocID)
+		if err != nil || (!config.IncludeVersions && IsPriorVersion(*doc)) {
+			excluded[chunk.DocID] = true
+			continue
+		}
+		if config.Namespace != "" {
+			if ns, _ := doc.Metadata["namespace"].(string); ns != config.Namespace {
+				excluded[chunk.DocID] = true
+				continue
+			}
+		}
+		d := &SimilarDocument{Document: *doc, Similarity: 1 / (1 + dists[i]), Chunk: chunk, Matches: 1}
+		byDoc[chunk.DocID] = d
+		out = append(out, d)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Similarity > out[j].Similarity })
+	res := make([]SimilarDocument, 0, min(len(out), config.Limit))
+	for _, d := range out[:min(len(out), config.Limit)] {
+		res = append(res, *d)
+	}
+	return res, nil
+}
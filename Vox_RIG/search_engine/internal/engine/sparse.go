@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// MetaSparse is the chunk metadata key holding the chunk's sparse vector,
+// term to weight (see types.SparseVector).
+const MetaSparse = "sparse"
+
+// DefaultSparseWeight is the share of the similarity given to the sparse
+// score when RetrievalConfig.SparseQuery is set and SparseWeight is 0.
+const DefaultSparseWeight = 0.3
+
+// Sparse returns the sparse vector stored in chunk metadata md.
+func Sparse(md types.Metadata) types.SparseVector {
+	switch v := md[MetaSparse].(type) {
+	case types.SparseVector:
+		return v
+	case map[string]float32:
+		return v
+	case map[string]any:
+		out := make(types.SparseVector, len(v))
+		for term, w := range v {
+			switch w := w.(type) {
+			case float64:
+				out[term] = float32(w)
+			case float32:
+				out[term] = w
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// WithSparse returns a copy of md recording v under MetaSparse.
+func WithSparse(md types.Metadata, v types.SparseVector) types.Metadata {
+	out := make(types.Metadata, len(md)+1)
+	for k, val := range md {
+		out[k] = val
+	}
+	out[MetaSparse] = v
+	return out
+}
+
+// SparseScore is the dot product of sparse vectors a and b.
+func SparseScore(a, b types.SparseVector) float32 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var sum float32
+	for term, w := range a {
+		sum += w * b[term]
+	}
+	return sum
+}
+
+// sparseIndex holds the postings of the chunks' sparse vectors per
+// namespace: for every term, the chunks that weigh it. Like centroidIndex
+// it is derived from the metadata store, built on first use and kept up to
+// date by following the change log.
+type sparseIndex struct {
+	mu     sync.Mutex
+	built  bool
+	seq    uint64
+	spaces map[string]*sparseSpace
+	docs   map[string]sparseRef
+}
+
+type sparseRef struct {
+	ns     string
+	chunks map[uint64][]string // chunk ID -> its terms
+}
+
+type sparseSpace struct {
+	postings map[string]map[uint64]float32
+	docs     int
+}
+
+// sync brings the postings up to date with e's change log.
+func (s *sparseIndex) sync(e *Engine) error {
+	if !s.built {
+		last, err := e.metadata.LastChange()
+		if err != nil {
+			return err
+		}
+		return s.build(e, last)
+	}
+	return e.followChanges(&s.seq, func(docID string) error { return s.update(e, docID) }, s.dropNamespace)
+}
+
+// build indexes every stored chunk in one scan. Changes logged after last
+// are applied by the next sync.
+func (s *sparseIndex) build(e *Engine, last uint64) error {
+	start := time.Now()
+	s.spaces = map[string]*sparseSpace{}
+	s.docs = map[string]sparseRef{}
+	namespaces := map[string]string{}
+	err := e.metadata.ForEachDocument(func(doc types.Document) error {
+		namespaces[doc.ID], _ = doc.Metadata["namespace"].(string)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	terms := 0
+	err = e.metadata.ForEachChunk(func(c types.Chunk) error {
+		ns, ok := namespaces[c.DocID]
+		if ok {
+			terms += s.add(ns, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.seq, s.built = last, true
+	log.Printf("[sparse] built docs=%d postings=%d took=%s", len(s.docs), terms, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// update re-reads the sparse vectors of docID's chunks.
+func (s *sparseIndex) update(e *Engine, docID string) error {
+	s.remove(docID)
+	doc, err := e.metadata.GetDocument(docID)
+	if err != nil {
+		return nil
+	}
+	chunks, err := e.metadata.DocumentChunks(docID)
+	if err != nil {
+		return err
+	}
+	ns, _ := doc.Metadata["namespace"].(string)
+	for _, c := range chunks {
+		s.add(ns, c)
+	}
+	return nil
+}
+
+// add posts c's terms and returns how many it has.
+func (s *sparseIndex) add(ns string, c types.Chunk) int {
+	vec := Sparse(c.Metadata)
+	if len(vec) == 0 {
+		return 0
+	}
+	sp := s.spaces[ns]
+	if sp == nil {
+		sp = &sparseSpace{postings: map[string]map[uint64]float32{}}
+		s.spaces[ns] = sp
+	}
+	ref, ok := s.docs[c.DocID]
+	if !ok {
+		ref = sparseRef{ns: ns, chunks: map[uint64][]string{}}
+		s.docs[c.DocID] = ref
+		sp.docs++
+	}
+	terms := make([]string, 0, len(vec))
+	for term, w := range vec {
+		p := sp.postings[term]
+		if p == nil {
+			p = map[uint64]float32{}
+			sp.postings[term] = p
+		}
+		p[c.ID] = w
+		terms = append(terms, term)
+	}
+	ref.chunks[c.ID] = terms
+	return len(terms)
+}
+
+func (s *sparseIndex) remove(docID string) {
+	ref, ok := s.docs[docID]
+	if !ok {
+		return
+	}
+	delete(s.docs, docID)
+	sp := s.spaces[ref.ns]
+	for id, terms := range ref.chunks {
+		for _, term := range terms {
+			delete(sp.postings[term], id)
+			if len(sp.postings[term]) == 0 {
+				delete(sp.postings, term)
+			}
+		}
+	}
+	if sp.docs--; sp.docs == 0 {
+		delete(s.spaces, ref.ns)
+	}
+}
+
+func (s *sparseIndex) dropNamespace(ns string) {
+	for docID, ref := range s.docs {
+		if ref.ns == ns {
+			delete(s.docs, docID)
+		}
+	}
+	delete(s.spaces, ns)
+}
+
+// search returns up to k chunks with the highest sparse scores against
+// query, best first, from namespace ns or from every namespace when ns is
+// empty.
+func (s *sparseIndex) search(query types.SparseVector, ns string, k int) ([]uint64, []float32) {
+	spaces := s.spaces
+	if ns != "" {
+		spaces = map[string]*sparseSpace{ns: s.spaces[ns]}
+	}
+	scores := map[uint64]float32{}
+	for _, sp := range spaces {
+		if sp == nil {
+			continue
+		}
+		for term, qw := range query {
+			for id, w := range sp.postings[term] {
+				scores[id] += qw * w
+			}
+		}
+	}
+	ids := make([]uint64, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	ids = ids[:min(k, len(ids))]
+	out := make([]float32, len(ids))
+	for i, id := range ids {
+		out[i] = scores[id]
+	}
+	return ids, out
+}
+
+// SparseCandidates returns up to k chunks of ns (every namespace when
+// empty) whose sparse vectors score highest against query, best first,
+// with their scores.
+func (e *Engine) SparseCandidates(query types.SparseVector, ns string, k int) ([]uint64, []float32, error) {
+	e.sparse.mu.Lock()
+	defer e.sparse.mu.Unlock()
+	if err := e.sparse.sync(e); err != nil {
+		return nil, nil, err
+	}
+	ids, scores := e.sparse.search(query, ns, k)
+	return ids, scores, nil
+}
+
+// addSparseCandidates appends the sparse candidates ids the index search
+// did not find to chunkIDs, loading their chunks into found. Their dense
+// similarity is computed from their vectors (see vectorSimilarity).
+func (e *Engine) addSparseCandidates(chunkIDs, ids []uint64, distances map[uint64]map[string]float32, found map[uint64]types.Chunk) ([]uint64, error) {
+	var missing []uint64
+	for _, id := range ids {
+		if _, ok := distances[id]; ok {
+			continue
+		}
+		chunkIDs = append(chunkIDs, id)
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return chunkIDs, nil
+	}
+	more, err := e.metadata.GetChunks(missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, c := range more {
+		found[id] = c
+	}
+	return chunkIDs, nil
+}
@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"vox-vector-engine/internal/types"
+)
+
+// Text search modes.
+const (
+	TextSubstring = "substring"
+	TextRegex     = "regex"
+	TextBM25      = "bm25"
+)
+
+// BM25 parameters (the usual defaults).
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// snippetMax bounds a snippet in bytes; longer lines are cut around the match.
+const snippetMax = 240
+
+// TextQuery searches chunk content without vectors, for exact identifiers
+// and error strings.
+type TextQuery struct {
+	Query string
+	// Mode is TextSubstring (default), TextRegex or TextBM25.
+	Mode string
+	// Namespace restricts the search to documents of that namespace; empty
+	// searches every document of the store.
+	Namespace     string
+	CaseSensitive bool
+	Limit         int
+}
+
+// TextMatch is one matching chunk. Line is the file line of the first match
+// when the chunk records its line range.
+type TextMatch struct {
+	DocID     string  `json:"doc_id"`
+	ChunkID   uint64  `json:"chunk_id"`
+	Source    string  `json:"source,omitempty"`
+	StartLine int     `json:"start_line,omitempty"`
+	EndLine   int     `json:"end_line,omitempty"`
+	Line      int     `json:"line,omitempty"`
+	Score     float64 `json:"score"`
+	Snippet   string  `json:"snippet"`
+}
+
+// TextResult lists the best matches, highest score first. Scanned counts the
+// chunks searched; Total counts every match before Limit.
+type TextResult struct {
+	Mode    string      `json:"mode"`
+	Matches []TextMatch `json:"matches"`
+	Total   int         `json:"total"`
+	Scanned int         `json:"scanned"`
+}
+
+// matcher scores one chunk and returns the byte offset of its first match
+// (ok is false when the chunk does not match).
+type matcher func(content string) (score float64, at int, ok bool)
+
+// SearchText scans the chunks in q's scope. Substring and regex matches score
+// by match count; BM25 ranks by term relevance over the scanned chunks.
+func (e *Engine) SearchText(q TextQuery) (*TextResult, error) {
+	if q.Mode == "" {
+		q.Mode = TextSubstring
+	}
+	var inScope map[string]bool
+	if q.Namespace != "" {
+		docs, err := e.metadata.ListDocuments(q.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		inScope = make(map[string]bool, len(docs))
+		for _, doc := range docs {
+			inScope[doc.ID] = true
+		}
+	}
+
+	res := &TextResult{Mode: q.Mode, Matches: []TextMatch{}}
+	var matches []TextMatch
+	switch q.Mode {
+	case TextSubstring, TextRegex:
+		match, err := patternMatcher(q)
+		if err != nil {
+			return nil, err
+		}
+		err = e.metadata.ForEachChunk(func(c types.Chunk) error {
+			if inScope != nil && !inScope[c.DocID] {
+				return nil
+			}
+			res.Scanned++
+			if score, at, ok := match(c.Content); ok {
+				matches = append(matches, newTextMatch(c, score, at))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case TextBM25:
+		var err error
+		if matches, res.Scanned, err = e.bm25(q, inScope); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown text search mode %q", q.Mode)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	res.Total = len(matches)
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	for i := range matches {
+		if doc, err := e.metadata.GetDocument(matches[i].DocID); err == nil {
+			matches[i].Source = doc.Source
+		}
+	}
+	if matches != nil {
+		res.Matches = matches
+	}
+	return res, nil
+}
+
+// patternMatcher builds the matcher of a substring or regex query.
+func patternMatcher(q TextQuery) (matcher, error) {
+	pattern := q.Query
+	if q.Mode == TextSubstring {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !q.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return func(content string) (float64, int, bool) {
+		locs := re.FindAllStringIndex(content, -1)
+		if len(locs) == 0 {
+			return 0, 0, false
+		}
+		return float64(len(locs)), locs[0][0], true
+	}, nil
+}
+
+// bm25 scores every chunk in scope containing a query term. Document
+// frequencies come from the same scan, so scores are relative to the scope.
+func (e *Engine) bm25(q TextQuery, inScope map[string]bool) ([]TextMatch, int, error) {
+	terms := textTerms(q.Query, q.CaseSensitive)
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+	type hit struct {
+		chunk types.Chunk
+		tf    map[string]int
+		len   int
+		at    int
+	}
+	var (
+		hits     []hit
+		df       = map[string]int{}
+		scanned  int
+		totalLen int
+	)
+	err := e.metadata.ForEachChunk(func(c types.Chunk) error {
+		if inScope != nil && !inScope[c.DocID] {
+			return nil
+		}
+		scanned++
+		words := textWords(c.Content, q.CaseSensitive)
+		totalLen += len(words)
+		var h *hit
+		for _, w := range words {
+			if !terms[w.text] {
+				continue
+			}
+			if h == nil {
+				h = &hit{chunk: c, tf: map[string]int{}, len: len(words), at: w.at}
+			}
+			if h.tf[w.text] == 0 {
+				df[w.text]++
+			}
+			h.tf[w.text]++
+		}
+		if h != nil {
+			hits = append(hits, *h)
+		}
+		return nil
+	})
+	if err != nil || len(hits) == 0 {
+		return nil, scanned, err
+	}
+
+	avgLen := float64(totalLen) / float64(scanned)
+	out := make([]TextMatch, 0, len(hits))
+	for _, h := range hits {
+		var score float64
+		for term, tf := range h.tf {
+			idf := math.Log(1 + (float64(scanned)-float64(df[term])+0.5)/(float64(df[term])+0.5))
+			norm := float64(tf) + bm25K1*(1-bm25B+bm25B*float64(h.len)/avgLen)
+			score += idf * float64(tf) * (bm25K1 + 1) / norm
+		}
+		out = append(out, newTextMatch(h.chunk, score, h.at))
+	}
+	return out, scanned, nil
+}
+
+type textWord struct {
+	text string
+	at   int
+}
+
+// textWords splits content into identifier-like words (letters, digits and
+// underscores) with their byte offsets.
+func textWords(content string, caseSensitive bool) []textWord {
+	var words []textWord
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			w := content[start:end]
+			if !caseSensitive {
+				w = strings.ToLower(w)
+			}
+			words = append(words, textWord{w, start})
+			start = -1
+		}
+	}
+	for i, r := range content {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(content))
+	return words
+}
+
+func textTerms(query string, caseSensitive bool) map[string]bool {
+	terms := map[string]bool{}
+	for _, w := range textWords(query, caseSensitive) {
+		terms[w.text] = true
+	}
+	return terms
+}
+
+// newTextMatch locates the match at byte offset at within c.
+func newTextMatch(c types.Chunk, score float64, at int) TextMatch {
+	m := TextMatch{
+		DocID:     c.DocID,
+		ChunkID:   c.ID,
+		StartLine: c.StartLine,
+		EndLine:   c.EndLine,
+		Score:     score,
+		Snippet:   snippet(c.Content, at),
+	}
+	if c.StartLine > 0 {
+		m.Line = c.StartLine + strings.Count(c.Content[:at], "\n")
+	}
+	return m
+}
+
+// snippet returns the line of content containing byte offset at, trimmed and
+// cut to snippetMax bytes around it.
+func snippet(content string, at int) string {
+	start := strings.LastIndexByte(content[:at], '\n') + 1
+	end := len(content)
+	if i := strings.IndexByte(content[at:], '\n'); i >= 0 {
+		end = at + i
+	}
+	if end-start > snippetMax {
+		from := max(start, at-snippetMax/3)
+		to := min(end, from+snippetMax)
+		for from > start && !utf8.RuneStart(content[from]) {
+			from--
+		}
+		for to < end && !utf8.RuneStart(content[to]) {
+			to--
+		}
+		start, end = from, to
+	}
+	return strings.TrimSpace(content[start:end])
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// TrashDocument soft-deletes a document: it moves to the metadata store's
+// trash with its chunks, whose vectors leave the index until RestoreDocument.
+func (e *Engine) TrashDocument(docID string) (*types.TrashedDocument, error) {
+	t, err := e.metadata.TrashDocument(docID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range t.Chunks {
+		e.index.Remove(c.ID)
+	}
+	e.unindexNamedVectors(t.Chunks)
+	return t, nil
+}
+
+// RestoreDocument brings a trashed document back and re-indexes its chunk
+// vectors, which never left the vector store.
+func (e *Engine) RestoreDocument(docID string) (*types.TrashedDocument, error) {
+	t, err := e.metadata.RestoreDocument(docID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range t.Chunks {
+		if v, err := e.vectors.Get(c.ID); err == nil {
+			e.index.Add(c.ID, v)
+		}
+	}
+	e.IndexNamedVectors(t.Chunks)
+	return t, nil
+}
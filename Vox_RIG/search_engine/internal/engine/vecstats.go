@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// Drift detection compares each ingested batch against the running
+// statistics of its namespace once they rest on DriftMinVectors vectors.
+// A batch drifts when its mean norm is off the namespace's by more than
+// DriftNormShift (a fraction of the mean) and DriftNormSigmas standard
+// deviations, or when its vectors sit more than DriftDimScore times further
+// from the per-dimension means than the namespace's own vectors do.
+// Vectors from one embedding model score about 1; another model's vectors,
+// spread over different dimensions, score many times that.
+const (
+	DriftMinVectors = 50
+	DriftNormShift  = 0.25
+	DriftNormSigmas = 4
+	DriftDimScore   = 4
+)
+
+// VectorStats are the running statistics of the vectors ingested into a
+// namespace since the engine started.
+type VectorStats struct {
+	Namespace string `json:"namespace"`
+	// Model is the model space the namespace belongs to; empty for the
+	// default space. EmbeddingModel is the model its vectors are tagged
+	// with (see ModelTag).
+	Model          string  `json:"model,omitempty"`
+	EmbeddingModel string  `json:"embedding_model,omitempty"`
+	Count          uint64  `json:"count"`
+	Dim            int     `json:"dim"`
+	MeanNorm       float64 `json:"mean_norm"`
+	NormStddev     float64 `json:"norm_stddev"`
+	// MeanVariance is the per-dimension variance averaged over dimensions;
+	// Variance lists it by dimension when asked for.
+	MeanVariance float64   `json:"mean_variance"`
+	Variance     []float64 `json:"variance,omitempty"`
+	// DriftWarnings counts the batches that looked like another model's.
+	DriftWarnings uint64        `json:"drift_warnings"`
+	LastDrift     *DriftWarning `json:"last_drift,omitempty"`
+	Since         time.Time     `json:"since"`
+}
+
+// DriftWarning describes a batch of vectors whose distribution does not
+// match the namespace it was ingested into, which usually means the
+// embedder that produced it changed.
+type DriftWarning struct {
+	Namespace string    `json:"namespace"`
+	Time      time.Time `json:"time"`
+	Vectors   int       `json:"vectors"`
+	// BatchNorm is the mean norm of the batch, ExpectedNorm the namespace's.
+	BatchNorm    float64 `json:"batch_norm"`
+	ExpectedNorm float64 `json:"expected_norm"`
+	// DimScore is the batch's mean squared per-dimension z-score; about 1
+	// for vectors from the namespace's model.
+	DimScore float64 `json:"dim_score"`
+	Message  string  `json:"message"`
+}
+
+// vectorStats holds the running statistics of every namespace an engine
+// has ingested into.
+type vectorStats struct {
+	mu   sync.Mutex
+	byNS map[string]*runningStats
+}
+
+// runningStats accumulates norms and per-dimension moments with Welford's
+// method, so the mean and variance never need the vectors again.
+type runningStats struct {
+	dim           int
+	count         uint64
+	normMean      float64
+	normM2        float64
+	mean, m2      []float64
+	driftWarnings uint64
+	lastDrift     *DriftWarning
+	since         time.Time
+}
+
+// ObserveVectors adds chunks, just stored in namespace ns, to its running
+// statistics and returns a warning when they do not look like the vectors
+// stored before them. The norm of a chunk normalized at ingest is its
+// original one (MetaNorm), so normalization does not hide a model change.
+func (e *Engine) ObserveVectors(ns string, chunks []types.Chunk) *DriftWarning {
+	if len(chunks) == 0 {
+		return nil
+	}
+	st := e.vecStats
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.byNS == nil {
+		st.byNS = map[string]*runningStats{}
+	}
+	rs := st.byNS[ns]
+	if dim := len(chunks[0].Vector); rs == nil || rs.dim != dim {
+		rs = &runningStats{dim: dim, mean: make([]float64, dim), m2: make([]float64, dim), since: time.Now().UTC()}
+		st.byNS[ns] = rs
+	}
+
+	drift := rs.check(ns, chunks)
+	for _, c := range chunks {
+		if len(c.Vector) == rs.dim {
+			rs.add(c.Vector, ingestedNorm(c))
+		}
+	}
+	if drift != nil {
+		rs.driftWarnings++
+		rs.lastDrift = drift
+	}
+	return drift
+}
+
+// ingestedNorm is the norm c's vector had when it was sent.
+func ingestedNorm(c types.Chunk) float64 {
+	switch v := c.Metadata[MetaNorm].(type) {
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return float64(Norm(c.Vector))
+}
+
+func (rs *runningStats) add(v types.Vector, norm float64) {
+	rs.count++
+	n := float64(rs.count)
+	d := norm - rs.normMean
+	rs.normMean += d / n
+	rs.normM2 += d * (norm - rs.normMean)
+	for i, x := range v {
+		d := float64(x) - rs.mean[i]
+		rs.mean[i] += d / n
+		rs.m2[i] += d * (float64(x) - rs.mean[i])
+	}
+}
+
+func (rs *runningStats) variance(i int) float64 {
+	if rs.count < 2 {
+		return 0
+	}
+	return rs.m2[i] / float64(rs.count-1)
+}
+
+func (rs *runningStats) meanVariance() float64 {
+	if len(rs.m2) == 0 {
+		return 0
+	}
+	var sum float64
+	for i := range rs.m2 {
+		sum += rs.variance(i)
+	}
+	return sum / float64(len(rs.m2))
+}
+
+// check compares a batch with the statistics gathered before it; nil when
+// there are too few to judge or the batch fits.
+func (rs *runningStats) check(ns string, chunks []types.Chunk) *DriftWarning {
+	if rs.count < DriftMinVectors {
+		return nil
+	}
+	// Dimensions that barely vary would turn rounding into drift, so every
+	// variance is floored at a hundredth of the average one.
+	floor := rs.meanVariance() / 100
+	if floor == 0 {
+		return nil
+	}
+	var normSum, scoreSum float64
+	n := 0
+	for _, c := range chunks {
+		if len(c.Vector) != len(rs.mean) {
+			continue
+		}
+		normSum += ingestedNorm(c)
+		var z float64
+		for i, x := range c.Vector {
+			d := float64(x) - rs.mean[i]
+			z += d * d / max(rs.variance(i), floor)
+		}
+		scoreSum += z / float64(len(c.Vector))
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	w := &DriftWarning{
+		Namespace:    ns,
+		Time:         time.Now().UTC(),
+		Vectors:      n,
+		BatchNorm:    normSum / float64(n),
+		ExpectedNorm: rs.normMean,
+		DimScore:     scoreSum / float64(n),
+	}
+	normStddev := math.Sqrt(rs.normM2 / float64(rs.count-1))
+	shift := math.Abs(w.BatchNorm - rs.normMean)
+	switch {
+	case shift > DriftNormShift*rs.normMean && shift > DriftNormSigmas*normStddev:
+		w.Message = fmt.Sprintf("mean vector norm %.3g differs from the namespace's %.3g; were these vectors made by another embedding model?", w.BatchNorm, rs.normMean)
+	case w.DimScore > DriftDimScore:
+		w.Message = fmt.Sprintf("vectors lie %.1fx further from the namespace's per-dimension means than its own do; were they made by another embedding model?", w.DimScore)
+	default:
+		return nil
+	}
+	return w
+}
+
+// VectorStats returns the running statistics of namespace ns, or of every
+// namespace when ns is empty, sorted by namespace. dims adds the variance
+// of every dimension.
+func (e *Engine) VectorStats(ns string, dims bool) []VectorStats {
+	st := e.vecStats
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	out := []VectorStats{}
+	for name, rs := range st.byNS {
+		if ns != "" && name != ns {
+			continue
+		}
+		vs := VectorStats{
+			Namespace:     name,
+			Count:         rs.count,
+			Dim:           rs.dim,
+			MeanNorm:      rs.normMean,
+			MeanVariance:  rs.meanVariance(),
+			DriftWarnings: rs.driftWarnings,
+			LastDrift:     rs.lastDrift,
+			Since:         rs.since,
+		}
+		vs.EmbeddingModel, _ = e.ModelTag(name)
+		if rs.count > 1 {
+			vs.NormStddev = math.Sqrt(rs.normM2 / float64(rs.count-1))
+		}
+		if dims {
+			vs.Variance = make([]float64, len(rs.m2))
+			for i := range rs.m2 {
+				vs.Variance[i] = rs.variance(i)
+			}
+		}
+		out = append(out, vs)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Namespace < out[j].Namespace })
+	return out
+}
+
+// forgetVectorStats drops the statistics of a purged namespace.
+func (e *Engine) forgetVectorStats(ns string) {
+	e.vecStats.mu.Lock()
+	defer e.vecStats.mu.Unlock()
+	delete(e.vecStats.byNS, ns)
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func TestVectorStatsDrift(t *testing.T) {
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(t.TempDir(), "vectors.bin"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	e := NewEngine(index.NewHnswIndex(vecs), vecs, storage.NewMemoryMetadataStore())
+	rng := rand.New(rand.NewSource(1))
+	// model spreads its vectors over the dimensions in [lo, lo+4), scaled by
+	// scale; the others get a little noise.
+	model := func(n, lo int, scale float32) []types.Chunk {
+		out := make([]types.Chunk, n)
+		for i := range out {
+			v := make(types.Vector, 8)
+			for d := range v {
+				sd := float32(0.05)
+				if d >= lo && d < lo+4 {
+					sd = 1
+				}
+				v[d] = float32(rng.NormFloat64()) * sd * scale
+			}
+			out[i] = types.Chunk{Vector: v}
+		}
+		return out
+	}
+
+	if w := e.ObserveVectors("ns", model(DriftMinVectors-1, 0, 1)); w != nil {
+		t.Fatalf("Expected no judgement before %d vectors, got %+v", DriftMinVectors, w)
+	}
+	e.ObserveVectors("ns", model(200, 0, 1))
+	if w := e.ObserveVectors("ns", model(10, 0, 1)); w != nil {
+		t.Errorf("Expected vectors of the same model to fit, got %+v", w)
+	}
+	if w := e.ObserveVectors("ns", model(10, 4, 1)); w == nil || w.DimScore <= DriftDimScore {
+		t.Errorf("Expected a dimension drift warning, got %+v", w)
+	}
+	if w := e.ObserveVectors("ns", model(10, 0, 10)); w == nil || w.BatchNorm < 5*w.ExpectedNorm {
+		t.Errorf("Expected a norm drift warning, got %+v", w)
+	}
+	// Normalized vectors are judged by the norm they were sent with.
+	unit := model(10, 0, 10)
+	for i, c := range unit {
+		v, n := Unit(c.Vector)
+		unit[i] = types.Chunk{Vector: v, Metadata: WithNorm(nil, n)}
+	}
+	if w := e.ObserveVectors("ns", unit); w == nil {
+		t.Errorf("Expected a norm drift warning for normalized vectors")
+	}
+
+	stats := e.VectorStats("", true)
+	if len(stats) != 1 || stats[0].Namespace != "ns" || stats[0].Count != DriftMinVectors-1+200+40 || stats[0].DriftWarnings != 3 || len(stats[0].Variance) != 8 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats[0].LastDrift == nil || stats[0].MeanVariance == 0 {
+		t.Errorf("Expected the last drift and a mean variance, got %+v", stats[0])
+	}
+
+	if _, err := e.PurgeNamespace("ns"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := e.VectorStats("ns", false); len(stats) != 0 {
+		t.Errorf("Expected purge to drop the statistics, got %+v", stats)
+	}
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"context"
+
+	"vox-vector-engine/internal/index"
+)
+
+// verifyBatch is how many vector IDs VerifyIndex looks up in metadata at once.
+const verifyBatch = 1024
+
+// IndexReport is the result of VerifyIndex: the graph checks of
+// index.Verify plus the vectors the graph is missing.
+type IndexReport struct {
+	index.Report
+	Vectors uint64 `json:"vectors"`
+	// VectorsWithoutNodes are stored vectors of live chunks that no search
+	// can reach. Vectors of deleted chunks are left out of the graph on
+	// purpose and not counted.
+	VectorsWithoutNodes int  `json:"vectors_without_nodes"`
+	OK                  bool `json:"ok"`
+	// Repaired is set when the problems counted were also fixed.
+	Repaired bool `json:"repaired"`
+}
+
+// VerifyIndex checks the HNSW graph against itself and against the stores.
+// Long-running processes can drift: a crash between appending a vector and
+// linking it, or a graph saved by an older build, leaves vectors the graph
+// does not hold. With repair the graph is fixed (see index.Verify) and the
+// missing vectors are inserted again.
+func (e *Engine) VerifyIndex(ctx context.Context, repair bool) (*IndexReport, error) {
+	rep := &IndexReport{Report: e.index.Verify(repair), Vectors: e.vectors.Count(), Repaired: repair}
+
+	var missing []uint64
+	for id := uint64(0); id < rep.Vectors; id++ {
+		if !e.index.Contains(id) {
+			missing = append(missing, id)
+		}
+	}
+	for len(missing) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch := missing[:min(len(missing), verifyBatch)]
+		missing = missing[len(batch):]
+		found, err := e.metadata.GetChunks(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range batch {
+			if _, ok := found[id]; !ok {
+				continue
+			}
+			rep.VectorsWithoutNodes++
+			if !repair {
+				continue
+			}
+			v, err := e.vectors.Get(id)
+			if err != nil {
+				return nil, err
+			}
+			e.index.Add(id, v)
+		}
+	}
+	rep.OK = rep.Report.OK() && rep.VectorsWithoutNodes == 0
+	return rep, nil
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+func TestVerifyIndex(t *testing.T) {
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(t.TempDir(), "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	meta := storage.NewMemoryMetadataStore()
+	idx := index.NewHnswIndex(vecs)
+	e := NewEngine(idx, vecs, meta)
+
+	// Chunk a is indexed, b was stored but never linked (a crash between
+	// the two), and the third vector belongs to a deleted chunk.
+	for i, v := range []types.Vector{{1, 0}, {0, 1}, {1, 1}} {
+		id, err := vecs.Append(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 {
+			continue
+		}
+		doc := types.Document{ID: []string{"a", "b"}[i], Timestamp: time.Now()}
+		if err := meta.SaveDocumentWithChunks(doc, []types.Chunk{{ID: id, DocID: doc.ID, Content: doc.ID}}); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			idx.Add(id, v)
+		}
+	}
+
+	rep, err := e.VerifyIndex(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.OK || rep.Vectors != 3 || rep.Nodes != 1 || rep.VectorsWithoutNodes != 1 || idx.Contains(1) {
+		t.Errorf("Expected chunk b reported missing, got %+v", rep)
+	}
+	if rep, err = e.VerifyIndex(context.Background(), true); err != nil || !rep.Repaired || rep.VectorsWithoutNodes != 1 {
+		t.Fatalf("Expected the repair to report chunk b, got %+v %v", rep, err)
+	}
+	if !idx.Contains(1) || idx.Contains(2) {
+		t.Error("Expected chunk b re-inserted and the deleted chunk left out")
+	}
+	if rep, err = e.VerifyIndex(context.Background(), false); err != nil || !rep.OK {
+		t.Errorf("Expected a healthy index after the repair, got %+v %v", rep, err)
+	}
+}
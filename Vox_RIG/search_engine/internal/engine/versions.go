@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"sort"
+
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/types"
+)
+
+// Document metadata keys of versioned documents. The live document keeps
+// its ID and carries MetaVersion; each prior version is kept as
+// ids.Version(id, n) and also carries MetaVersionOf, the live ID.
+const (
+	MetaVersion   = "version"
+	MetaVersionOf = "version_of"
+)
+
+// DocumentVersion reads the version number a document was saved with; 1
+// for documents stored before versioning. Metadata round-trips through
+// JSON, so numbers come back as float64.
+func DocumentVersion(doc types.Document) int {
+	switch v := doc.Metadata[MetaVersion].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 1
+}
+
+// IsPriorVersion reports whether doc is a kept prior version rather than a
+// live document.
+func IsPriorVersion(doc types.Document) bool {
+	_, ok := doc.Metadata[MetaVersionOf]
+	return ok
+}
+
+// ArchiveDocument keeps the stored document docID as a prior version before
+// it is replaced: its chunks move to the copy ids.Version(docID, n) and stay
+// indexed, so retrieval with IncludeVersions still finds them. Prior
+// versions beyond the newest keep are deleted. It returns the version the
+// replacement should carry, 1 when nothing was stored.
+func (e *Engine) ArchiveDocument(docID string, keep int) (int, error) {
+	doc, err := e.metadata.GetDocument(docID)
+	if err != nil {
+		return 1, nil
+	}
+	n := DocumentVersion(*doc)
+	chunks, err := e.metadata.DocumentChunks(docID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := e.archive(*doc, chunks); err != nil {
+		return 0, err
+	}
+	if err := e.pruneVersions(docID, n, keep); err != nil {
+		return 0, err
+	}
+	return n + 1, nil
+}
+
+// SupersedeChunks retires chunks, the chunks prev was stored with, once a
+// new version of the document has been stored under the same ID. With keep
+// > 0 they are kept as a prior version, as by ArchiveDocument; otherwise
+// they are deleted. Storing the new version first means a failed ingest
+// leaves the old chunks searchable.
+func (e *Engine) SupersedeChunks(prev types.Document, chunks []types.Chunk, keep int) error {
+	priorID, err := e.archive(prev, chunks)
+	if err != nil {
+		return err
+	}
+	if keep <= 0 {
+		_, err := e.DeleteDocument(priorID)
+		return err
+	}
+	return e.pruneVersions(prev.ID, DocumentVersion(prev), keep)
+}
+
+// archive stores doc with chunks as its prior version and returns its ID.
+func (e *Engine) archive(doc types.Document, chunks []types.Chunk) (string, error) {
+	n := DocumentVersion(doc)
+	prior := doc
+	prior.ID = ids.Version(doc.ID, n)
+	prior.Metadata = types.Metadata{}
+	for k, v := range doc.Metadata {
+		prior.Metadata[k] = v
+	}
+	prior.Metadata[MetaVersion] = n
+	prior.Metadata[MetaVersionOf] = doc.ID
+	moved := make([]types.Chunk, len(chunks))
+	for i, c := range chunks {
+		c.DocID = prior.ID
+		moved[i] = c
+	}
+	return prior.ID, e.metadata.SaveDocumentWithChunks(prior, moved)
+}
+
+// pruneVersions deletes the prior versions of docID beyond the newest keep,
+// n being the newest archived.
+func (e *Engine) pruneVersions(docID string, n, keep int) error {
+	// Versions are archived one at a time, so older ones form a run that
+	// ends at the first missing ID.
+	for old := n - keep; old >= 1; old-- {
+		id := ids.Version(docID, old)
+		if _, err := e.metadata.GetDocument(id); err != nil {
+			break
+		}
+		if _, err := e.DeleteDocument(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DocumentVersions returns docID and its kept prior versions, newest first.
+// ns is the namespace the document is stored in.
+func (e *Engine) DocumentVersions(ns, docID string) ([]types.Document, error) {
+	docs, err := e.metadata.ListDocuments(ns)
+	if err != nil {
+		return nil, err
+	}
+	var out []types.Document
+	for _, doc := range docs {
+		if doc.ID == docID || doc.Metadata[MetaVersionOf] == docID {
+			out = append(out, doc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return DocumentVersion(out[i]) > DocumentVersion(out[j]) })
+	return out, nil
+}
@@ -0,0 +1,82 @@
+// Package ids builds every document and message ID the engine stores, so the
+// HTTP API, the CLIs and the file indexer always agree on them.
+//
+//	chat:<conversation_id>:<message_id>            chat message
+//	file:<namespace>:<path>                        whole file (indexer, watcher)
+//	file:<namespace>:<path>:<start_line>-<end_line> single file chunk (ingest_document)
+//	summary:<conversation_id>:<uuid>               compacted chat messages
+//	summary:<conversation_id>:rolling              rolling summary of a conversation
+//	<doc_id>@v<n>                                  prior version n of a re-indexed file
+package ids
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// namespaceVox is the UUIDv5 namespace for IDs generated by this engine.
+var namespaceVox = [16]byte{
+	0x6f, 0x1c, 0x2a, 0x4e, 0x93, 0x7d, 0x4b, 0x2f,
+	0xa4, 0x58, 0x0e, 0x61, 0xc3, 0x9b, 0x7a, 0x15,
+}
+
+// UUIDv5 returns the RFC 4122 version 5 (SHA-1) UUID of name within ns.
+func UUIDv5(ns [16]byte, name string) string {
+	h := sha1.New()
+	h.Write(ns[:])
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// ContentHash is the hex SHA-256 of content.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// MessageID derives a stable message ID from where a message lives and what it
+// says. Sending the same content to the same conversation twice yields the
+// same ID, which makes message ingest idempotent across retries.
+func MessageID(namespace, conversationID, content string) string {
+	return UUIDv5(namespaceVox, namespace+"\x00"+conversationID+"\x00"+ContentHash(content))
+}
+
+// Message is the document ID of a chat message.
+func Message(conversationID, messageID string) string {
+	return fmt.Sprintf("chat:%s:%s", conversationID, messageID)
+}
+
+// File is the document ID of a whole file.
+func File(namespace, path string) string {
+	return fmt.Sprintf("file:%s:%s", namespace, path)
+}
+
+// FileRange is the document ID of one line range of a file.
+func FileRange(namespace, path string, startLine, endLine int) string {
+	return fmt.Sprintf("%s:%d-%d", File(namespace, path), startLine, endLine)
+}
+
+// RollingSummary is the document ID of the continuously refreshed summary
+// of a conversation.
+func RollingSummary(conversationID string) string {
+	return fmt.Sprintf("summary:%s:rolling", conversationID)
+}
+
+// Version is the document ID under which version n of docID is kept once
+// a newer version replaces it.
+func Version(docID string, n int) string {
+	return fmt.Sprintf("%s@v%d", docID, n)
+}
+
+// Summary is the document ID of a summary that replaces the given source
+// documents of a conversation; the same sources always yield the same ID.
+func Summary(conversationID string, sourceIDs []string) string {
+	return fmt.Sprintf("summary:%s:%s", conversationID, UUIDv5(namespaceVox, strings.Join(sourceIDs, "\x00")))
+}
@@ -0,0 +1,49 @@
+package ids
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUUIDv5(t *testing.T) {
+	// RFC 4122 DNS namespace; reference value from Python's uuid.uuid5.
+	dns := [16]byte{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+	if got, want := UUIDv5(dns, "python.org"), "886313e1-3b8a-5372-9b90-0c9aee199e5d"; got != want {
+		t.Errorf("UUIDv5 = %s, want %s", got, want)
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	a := MessageID("ns", "conv", "hello")
+	if a != MessageID("ns", "conv", "hello") {
+		t.Errorf("MessageID is not deterministic")
+	}
+	for _, other := range []string{
+		MessageID("ns2", "conv", "hello"),
+		MessageID("ns", "conv2", "hello"),
+		MessageID("ns", "conv", "hello!"),
+	} {
+		if other == a {
+			t.Errorf("MessageID collision: %s", a)
+		}
+	}
+}
+
+func TestDocIDs(t *testing.T) {
+	if got := Message("c", "m"); got != "chat:c:m" {
+		t.Errorf("Message = %s", got)
+	}
+	if got := FileRange("ns", "a/b.go", 3, 9); got != "file:ns:a/b.go:3-9" {
+		t.Errorf("FileRange = %s", got)
+	}
+	if got := RollingSummary("c"); got != "summary:c:rolling" {
+		t.Errorf("RollingSummary = %s", got)
+	}
+	if got := Version("file:ns:a.go", 2); got != "file:ns:a.go@v2" {
+		t.Errorf("Version = %s", got)
+	}
+	a, b := Summary("c", []string{"x", "y"}), Summary("c", []string{"x", "y"})
+	if a != b || !strings.HasPrefix(a, "summary:c:") || a == Summary("c", []string{"x"}) {
+		t.Errorf("Summary = %s, %s", a, b)
+	}
+}
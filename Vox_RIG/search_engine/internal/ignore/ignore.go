@@ -0,0 +1,145 @@
+// Package ignore implements gitignore-style path matching for .voxignore and
+// .gitignore files.
+//
+// Supported syntax: blank lines and "#" comments, "!" negation, a trailing
+// "/" for directory-only patterns, a leading or inner "/" to anchor a
+// pattern to the file's directory, and the wildcards "*", "?", "[...]" and
+// "**". As in git, the last matching pattern wins.
+package ignore
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+type rule struct {
+	base     string   // directory (slash-separated, relative to root) the pattern came from
+	segments []string // pattern split on "/"
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// Matcher holds rules from any number of ignore files.
+type Matcher struct {
+	rules []rule
+}
+
+// New returns a matcher with no rules.
+func New() *Matcher {
+	return &Matcher{}
+}
+
+// Add parses patterns read from r. base is the slash-separated directory,
+// relative to the matching root, that holds the ignore file ("" for the root).
+func (m *Matcher) Add(base string, r io.Reader) error {
+	base = strings.Trim(base, "/")
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		m.AddPattern(base, sc.Text())
+	}
+	return sc.Err()
+}
+
+// AddFile loads an ignore file if it exists; a missing file is not an error.
+func (m *Matcher) AddFile(base, filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.Add(base, f)
+}
+
+// AddPattern adds a single pattern line.
+func (m *Matcher) AddPattern(base, line string) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	r := rule{base: strings.Trim(base, "/")}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return
+	}
+	r.segments = strings.Split(line, "/")
+	m.rules = append(m.rules, r)
+}
+
+// Match reports whether the slash-separated path rel (relative to the root)
+// is ignored. isDir tells whether rel names a directory. Callers walking a
+// tree should skip ignored directories, which also hides their contents.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	rel = strings.Trim(rel, "/")
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.matches(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (r rule) matches(rel string) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	parts := strings.Split(rel, "/")
+	if r.anchored {
+		return matchSegments(r.segments, parts)
+	}
+	// Unanchored patterns match the last path element.
+	ok, _ := path.Match(r.segments[0], parts[len(parts)-1])
+	return ok
+}
+
+// matchSegments matches pattern segments against path segments, where a "**"
+// segment matches zero or more path segments.
+func matchSegments(pat, parts []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pat[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], parts[0]); !ok {
+			return false
+		}
+		pat, parts = pat[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,47 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	m := New()
+	if err := m.Add("", strings.NewReader(`
+# comment
+*.log
+build/
+/vendor
+docs/**/*.png
+!keep.log
+`)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	m.AddPattern("sub", "tmp")
+
+	cases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"a/b/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build", true, true},
+		{"vendor", true, true},
+		{"src/vendor", true, false},
+		{"docs/img/x.png", false, true},
+		{"docs/x.png", false, true},
+		{"img/x.png", false, false},
+		{"sub/tmp", false, true},
+		{"tmp", false, false},
+		{"main.go", false, false},
+	}
+	for _, c := range cases {
+		if got := m.Match(c.path, c.isDir); got != c.want {
+			t.Errorf("Match(%q, dir=%v) = %v, want %v", c.path, c.isDir, got, c.want)
+		}
+	}
+}
@@ -1,11 +1,14 @@
-
 package index
 
 import (
+	"context"
+	"encoding/gob"
+	"io"
 	"math"
 	"math/rand"
 	"sort"
 	"sync"
+	"time"
 	"vox-vector-engine/internal/storage"
 	"vox-vector-engine/internal/types"
 )
@@ -24,22 +27,82 @@ type Node struct {
 	Neighbors [][]uint64 // [level][neighbors]
 }
 
+// HnswIndex is an HNSW graph over the vectors of a VectorStore. Its nodes
+// live in memory, or with NewDiskHnswIndex in an adjacency file with a cache
+// of the nodes in use.
+//
+// It is safe for concurrent use. Search, Contains, Len, Generation and Save
+// share a read lock; Add, Remove, Reset and Load take the write lock, so a
+// search never sees a half-linked node. Add is idempotent per ID: a vector
+// store ID names one immutable vector, so adding it again (as a background
+// rebuild racing live ingest may) is a no-op. The VectorStore must itself be
+// safe for concurrent Get and Append.
+//
+// Node levels come from the index's own random source. With a seed set by
+// SetSeed, the same vectors added and removed in the same order build the
+// same graph, so searches return the same results, whether the nodes live
+// in memory or on disk; Fresh passes the seed on, so a reindex rebuilds the
+// same graph too. Adds that race each other (live ingest during a rebuild)
+// reach the source in a different order each run and void that guarantee.
 type HnswIndex struct {
-	nodes           map[uint64]*Node
+	nodes           nodeStore
 	vecs            storage.VectorStore // Source of truth for vectors
 	entryPointID    uint64
 	maxLevel        int
 	currentMaxLevel int
-	mu              sync.RWMutex
+	// rng draws node levels under the write lock; seed is 0 unless set.
+	rng  *rand.Rand
+	seed int64
+	// diskDir and cacheNodes are set for a disk-backed graph, so Fresh
+	// builds another.
+	diskDir    string
+	cacheNodes int
+	// gen is bumped by every change to the graph (see Generation).
+	gen uint64
+	mu  sync.RWMutex
 }
 
 func NewHnswIndex(vecs storage.VectorStore) *HnswIndex {
 	return &HnswIndex{
-		nodes:           make(map[uint64]*Node),
+		nodes:           memNodes{},
 		vecs:            vecs,
 		maxLevel:        MaxLevel,
 		currentMaxLevel: -1,
+		rng:             rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// SetSeed restarts the source of node levels from seed, making builds
+// reproducible; 0 picks a random seed. Set it before adding nodes.
+func (idx *HnswIndex) SetSeed(seed int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.seed = seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	idx.rng = rand.New(rand.NewSource(seed))
+}
+
+// NewDiskHnswIndex is NewHnswIndex with the neighbor lists in an adjacency
+// file created in dir (see storage.AdjacencyFile) and at most cacheNodes
+// nodes (DefaultCacheNodes if 0) decoded in memory, for graphs too large to
+// hold. Close deletes the file.
+func NewDiskHnswIndex(vecs storage.VectorStore, dir string, cacheNodes int) (*HnswIndex, error) {
+	nodes, err := newDiskNodes(dir, cacheNodes)
+	if err != nil {
+		return nil, err
 	}
+	idx := NewHnswIndex(vecs)
+	idx.nodes, idx.diskDir, idx.cacheNodes = nodes, dir, cacheNodes
+	return idx, nil
+}
+
+// Close releases the adjacency file of a disk-backed graph.
+func (idx *HnswIndex) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.nodes.close()
 }
 
 // Reset clears the in-memory graph. It does NOT modify the underlying vector store.
@@ -48,14 +111,119 @@ func (idx *HnswIndex) Reset() {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	idx.nodes = make(map[uint64]*Node)
+	idx.nodes.reset()
 	idx.entryPointID = 0
 	idx.currentMaxLevel = -1
+	idx.gen++
+}
+
+// Generation changes whenever the graph does, so callers can tell whether a
+// cached search result is still current.
+func (idx *HnswIndex) Generation() uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.gen
+}
+
+// Contains reports whether id is in the graph.
+func (idx *HnswIndex) Contains(id uint64) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.nodes.has(id)
+}
+
+// Len returns the number of nodes in the graph.
+func (idx *HnswIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.nodes.len()
+}
+
+// IDs returns the IDs in the graph, in ascending order.
+func (idx *HnswIndex) IDs() []uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ids := idx.nodes.ids()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Fresh returns an empty HnswIndex over the same vector store with the
+// same seed, disk-backed in the same directory if idx is.
+func (idx *HnswIndex) Fresh() (Index, error) {
+	fresh := NewHnswIndex(idx.vecs)
+	if idx.diskDir != "" {
+		var err error
+		if fresh, err = NewDiskHnswIndex(idx.vecs, idx.diskDir, idx.cacheNodes); err != nil {
+			return nil, err
+		}
+	}
+	fresh.SetSeed(idx.seed)
+	return fresh, nil
 }
 
+// Replace swaps in the graph of fresh, built over the same vector store, as
+// one step: searches see either the old graph or the new one. Engines and
+// shards keep their *HnswIndex, so the swap moves the graph rather than the
+// pointer. Nodes added to or removed from idx since fresh was built are
+// applied to fresh first, mostly under the read lock so searches only wait
+// for the final few. fresh must come from idx.Fresh and not be used
+// afterwards. It returns how many nodes that catch-up added and removed.
+func (idx *HnswIndex) Replace(next Index) (added, removed int) {
+	fresh := next.(*HnswIndex)
+	// diff lists what fresh lacks and what it has that idx does not.
+	diff := func() (add, drop []uint64) {
+		for _, id := range idx.nodes.ids() {
+			if !fresh.Contains(id) {
+				add = append(add, id)
+			}
+		}
+		for _, id := range fresh.IDs() {
+			if !idx.nodes.has(id) {
+				drop = append(drop, id)
+			}
+		}
+		return add, drop
+	}
+	apply := func(add, drop []uint64) {
+		for _, id := range add {
+			if v, err := idx.vecs.Get(id); err == nil {
+				fresh.Add(id, v)
+				added++
+			}
+		}
+		for _, id := range drop {
+			fresh.Remove(id)
+			removed++
+		}
+	}
+
+	idx.mu.RLock()
+	add, drop := diff()
+	idx.mu.RUnlock()
+	apply(add, drop)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	apply(diff())
+	old := idx.nodes
+	idx.nodes = fresh.nodes
+	idx.entryPointID = fresh.entryPointID
+	idx.currentMaxLevel = fresh.currentMaxLevel
+	idx.gen++
+	_ = old.close()
+	return added, removed
+}
+
+// Add links vector into the graph under id. IDs already present are left
+// alone; re-adding one would orphan the edges pointing at the old node.
 func (idx *HnswIndex) Add(id uint64, vector types.Vector) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
+	if idx.nodes.has(id) {
+		return
+	}
+	idx.gen++
 
 	level := idx.randomLevel()
 	node := &Node{
@@ -63,7 +231,7 @@ func (idx *HnswIndex) Add(id uint64, vector types.Vector) {
 		Level:     level,
 		Neighbors: make([][]uint64, level+1),
 	}
-	idx.nodes[id] = node
+	idx.nodes.put(node)
 
 	if idx.currentMaxLevel == -1 {
 		idx.entryPointID = id
@@ -82,7 +250,7 @@ func (idx *HnswIndex) Add(id uint64, vector types.Vector) {
 	// 2. Insert into layers from top-down
 	for l := min(level, idx.currentMaxLevel); l >= 0; l-- {
 		// Find neighbors at this level
-		nearestIDs, _ := idx.searchLayerK(vector, currEntryPoint, EfConstruction, l)
+		nearestIDs, _, _, _ := idx.searchLayerK(context.Background(), vector, currEntryPoint, EfConstruction, l, Budget{})
 
 		// Select M neighbors (simplified: just take top M)
 		m := M
@@ -95,9 +263,14 @@ func (idx *HnswIndex) Add(id uint64, vector types.Vector) {
 
 		// Connect bidirectionally
 		node.Neighbors[l] = nearestIDs
+		idx.nodes.put(node)
 		for _, neighborID := range nearestIDs {
-			neighbor := idx.nodes[neighborID]
+			neighbor := idx.nodes.get(neighborID)
+			if neighbor == nil || l >= len(neighbor.Neighbors) {
+				continue
+			}
 			neighbor.Neighbors[l] = append(neighbor.Neighbors[l], id)
+			idx.nodes.put(neighbor)
 		}
 
 		// Update entry point for next level
@@ -113,27 +286,103 @@ func (idx *HnswIndex) Add(id uint64, vector types.Vector) {
 }
 
 func (idx *HnswIndex) Search(query types.Vector, k int) ([]uint64, []float32) {
+	return idx.SearchEf(query, k, EfSearch)
+}
+
+// SearchEf is Search with an explicit beam width for the bottom layer. Larger
+// ef trades latency for recall; at most ef results are returned.
+func (idx *HnswIndex) SearchEf(query types.Vector, k, ef int) ([]uint64, []float32) {
+	ids, dists, _ := idx.SearchContext(context.Background(), query, k, ef)
+	return ids, dists
+}
+
+// SearchContext is SearchEf that gives up once ctx is done, returning the
+// nearest nodes found so far together with ctx.Err(). The context is checked
+// between layers and every searchCheckEvery expanded nodes, so a slow
+// traversal releases the index lock soon after its deadline.
+func (idx *HnswIndex) SearchContext(ctx context.Context, query types.Vector, k, ef int) ([]uint64, []float32, error) {
+	ids, dists, _, err := idx.SearchBudget(ctx, query, k, ef, Budget{})
+	return ids, dists, err
+}
+
+// DefaultMaxVisits bounds the bottom-layer search when a Budget sets no
+// MaxVisits. A healthy graph visits a few thousand nodes at EfSearch; one
+// degraded by removals or a bad load can wander through all of them.
+const DefaultMaxVisits = 20000
+
+// Budget bounds the bottom-layer traversal of one search. A search that
+// spends it stops with the best results found so far, which are then only
+// approximately the nearest.
+type Budget struct {
+	// MaxVisits caps the distance computations; 0 means unbounded.
+	MaxVisits int
+	// Time caps the traversal; 0 means unbounded.
+	Time time.Duration
+}
+
+// SearchBudget is SearchContext within b. partial reports whether the
+// budget ran out before the search converged.
+func (idx *HnswIndex) SearchBudget(ctx context.Context, query types.Vector, k, ef int, b Budget) (ids []uint64, dists []float32, partial bool, err error) {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
 	if idx.currentMaxLevel == -1 {
-		return nil, nil
+		return nil, nil, false, nil
 	}
 
 	currEP := idx.entryPointID
 	for l := idx.currentMaxLevel; l > 0; l-- {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, false, err
+		}
 		epVec, _ := idx.vecs.Get(currEP)
 		currEP, _ = idx.searchLayer(query, currEP, epVec, 1, l)
 	}
 
-	ids, dists := idx.searchLayerK(query, currEP, EfSearch, 0)
+	ids, dists, partial, err = idx.searchLayerK(ctx, query, currEP, ef, 0, b)
 
 	count := k
 	if len(ids) < k {
 		count = len(ids)
 	}
 
-	return ids[:count], dists[:count]
+	return ids[:count], dists[:count], partial, err
+}
+
+// Warm runs a search with beam width ef for each query, which reads the
+// vectors along the way, and returns the IDs a similar search will read:
+// the entry points it passed through, the results and their bottom-layer
+// neighbors, in ID order. The caller can prefetch those vectors.
+func (idx *HnswIndex) Warm(queries []types.Vector, ef int) []uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.currentMaxLevel == -1 {
+		return nil
+	}
+	seen := map[uint64]bool{}
+	for _, query := range queries {
+		currEP := idx.entryPointID
+		seen[currEP] = true
+		for l := idx.currentMaxLevel; l > 0; l-- {
+			epVec, _ := idx.vecs.Get(currEP)
+			currEP, _ = idx.searchLayer(query, currEP, epVec, 1, l)
+			seen[currEP] = true
+		}
+		ids, _, _, _ := idx.searchLayerK(context.Background(), query, currEP, ef, 0, Budget{})
+		for _, id := range ids {
+			seen[id] = true
+			for _, n := range idx.neighbors(id, 0) {
+				seen[n] = true
+			}
+		}
+	}
+	out := make([]uint64, 0, len(seen))
+	for id := range seen {
+		out = append(out, id)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
 }
 
 // searchLayer finds the single nearest node at a level (greedy search)
@@ -144,8 +393,7 @@ func (idx *HnswIndex) searchLayer(query types.Vector, entryPoint uint64, epVec t
 	changed := true
 	for changed {
 		changed = false
-		node := idx.nodes[curr]
-		for _, neighborID := range node.Neighbors[level] {
+		for _, neighborID := range idx.neighbors(curr, level) {
 			nVec, _ := idx.vecs.Get(neighborID)
 			d := euclideanDistance(query, nVec)
 			if d < currDist {
@@ -158,19 +406,50 @@ func (idx *HnswIndex) searchLayer(query types.Vector, entryPoint uint64, epVec t
 	return curr, currDist
 }
 
+// neighbors returns the links of id at level, or nil if the node is gone or
+// does not reach that level (a graph loaded from an older snapshot may hold
+// such edges).
+func (idx *HnswIndex) neighbors(id uint64, level int) []uint64 {
+	node := idx.nodes.get(id)
+	if node == nil || level >= len(node.Neighbors) {
+		return nil
+	}
+	return node.Neighbors[level]
+}
+
 type neighborResult struct {
 	id   uint64
 	dist float32
 }
 
-// searchLayerK finds K nearest neighbors at a level
-func (idx *HnswIndex) searchLayerK(query types.Vector, entryPoint uint64, k int, level int) ([]uint64, []float32) {
+// searchCheckEvery is how many nodes searchLayerK expands between checks of
+// its context and time budget.
+const searchCheckEvery = 64
+
+// searchLayerK finds K nearest neighbors at a level. When ctx is done it
+// stops early with the results so far and ctx.Err(); when b runs out it
+// stops early with the results so far and partial set.
+func (idx *HnswIndex) searchLayerK(ctx context.Context, query types.Vector, entryPoint uint64, k int, level int, b Budget) (ids []uint64, dists []float32, partial bool, err error) {
+	var deadline time.Time
+	if b.Time > 0 {
+		deadline = time.Now().Add(b.Time)
+	}
 	epVec, _ := idx.vecs.Get(entryPoint)
 	visited := map[uint64]bool{entryPoint: true}
 	candidates := []neighborResult{{entryPoint, euclideanDistance(query, epVec)}}
 	results := []neighborResult{candidates[0]}
+	visits := 1
 
-	for len(candidates) > 0 {
+	for expanded := 0; len(candidates) > 0 && !partial; expanded++ {
+		if expanded%searchCheckEvery == 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if !deadline.IsZero() && time.Now().After(deadline) {
+				partial = true
+				break
+			}
+		}
 		c := candidates[0]
 		candidates = candidates[1:]
 
@@ -178,9 +457,13 @@ func (idx *HnswIndex) searchLayerK(query types.Vector, entryPoint uint64, k int,
 			continue
 		}
 
-		node := idx.nodes[c.id]
-		for _, neighborID := range node.Neighbors[level] {
+		for _, neighborID := range idx.neighbors(c.id, level) {
 			if !visited[neighborID] {
+				if b.MaxVisits > 0 && visits >= b.MaxVisits {
+					partial = true
+					break
+				}
+				visits++
 				visited[neighborID] = true
 				nVec, _ := idx.vecs.Get(neighborID)
 				d := euclideanDistance(query, nVec)
@@ -200,13 +483,13 @@ func (idx *HnswIndex) searchLayerK(query types.Vector, entryPoint uint64, k int,
 		}
 	}
 
-	ids := make([]uint64, len(results))
-	dists := make([]float32, len(results))
+	ids = make([]uint64, len(results))
+	dists = make([]float32, len(results))
 	for i := range results {
 		ids[i] = results[i].id
 		dists[i] = results[i].dist
 	}
-	return ids, dists
+	return ids, dists, partial, err
 }
 
 func min(a, b int) int {
@@ -218,12 +501,18 @@ func min(a, b int) int {
 
 func (idx *HnswIndex) randomLevel() int {
 	lvl := 0
-	for rand.Float64() < 0.5 && lvl < idx.maxLevel {
+	for idx.rng.Float64() < 0.5 && lvl < idx.maxLevel {
 		lvl++
 	}
 	return lvl
 }
 
+// Distance is the metric the index ranks by, for callers that rank vectors
+// outside it.
+func Distance(a, b types.Vector) float32 {
+	return euclideanDistance(a, b)
+}
+
 func euclideanDistance(a, b types.Vector) float32 {
 	var sum float32
 	for i := range a {
@@ -232,3 +521,99 @@ func euclideanDistance(a, b types.Vector) float32 {
 	}
 	return float32(math.Sqrt(float64(sum)))
 }
+
+// Remove deletes a node and every edge pointing at it. Links are bidirectional,
+// so only the node's own neighbor lists need to be visited. The vector itself
+// stays in the vector store.
+func (idx *HnswIndex) Remove(id uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	node := idx.nodes.get(id)
+	if node == nil {
+		return
+	}
+	idx.nodes.del(id)
+	idx.gen++
+
+	for l, neighbors := range node.Neighbors {
+		for _, neighborID := range neighbors {
+			neighbor := idx.nodes.get(neighborID)
+			if neighbor == nil || l >= len(neighbor.Neighbors) {
+				continue
+			}
+			neighbor.Neighbors[l] = removeID(neighbor.Neighbors[l], id)
+			idx.nodes.put(neighbor)
+		}
+	}
+
+	if idx.entryPointID != id {
+		return
+	}
+
+	// Promote the highest remaining node to entry point, the lowest ID on
+	// ties so the choice does not depend on map order.
+	idx.entryPointID = 0
+	idx.currentMaxLevel = -1
+	for _, nid := range idx.nodes.ids() {
+		if n := idx.nodes.get(nid); n.Level > idx.currentMaxLevel || (n.Level == idx.currentMaxLevel && nid < idx.entryPointID) {
+			idx.entryPointID = nid
+			idx.currentMaxLevel = n.Level
+		}
+	}
+}
+
+func removeID(ids []uint64, id uint64) []uint64 {
+	out := ids[:0]
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// graphSnapshot is the on-disk form of the graph written by Save.
+type graphSnapshot struct {
+	Nodes           []Node
+	EntryPointID    uint64
+	CurrentMaxLevel int
+}
+
+// Save serializes the graph (not the vectors) to w.
+func (idx *HnswIndex) Save(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	snap := graphSnapshot{
+		Nodes:           make([]Node, 0, idx.nodes.len()),
+		EntryPointID:    idx.entryPointID,
+		CurrentMaxLevel: idx.currentMaxLevel,
+	}
+	for _, id := range idx.nodes.ids() {
+		snap.Nodes = append(snap.Nodes, *idx.nodes.get(id))
+	}
+	sort.Slice(snap.Nodes, func(i, j int) bool { return snap.Nodes[i].ID < snap.Nodes[j].ID })
+	return gob.NewEncoder(w).Encode(&snap)
+}
+
+// Load replaces the graph with one previously written by Save. The vector
+// store passed to NewHnswIndex must hold the same vectors as when it was saved.
+func (idx *HnswIndex) Load(r io.Reader) error {
+	var snap graphSnapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.nodes.reset()
+	for i := range snap.Nodes {
+		idx.nodes.put(&snap.Nodes[i])
+	}
+	idx.entryPointID = snap.EntryPointID
+	idx.currentMaxLevel = snap.CurrentMaxLevel
+	idx.gen++
+	return nil
+}
@@ -0,0 +1,432 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// newStore returns a vector store holding n random vectors of dim dimensions.
+func newStore(t *testing.T, rng *rand.Rand, n, dim int) *storage.MmapVectorStore {
+	t.Helper()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(t.TempDir(), "vectors.bin"), dim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vecs.Close() })
+	for i := 0; i < n; i++ {
+		if _, err := vecs.Append(randomVector(rng, dim)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vecs
+}
+
+func randomVector(rng *rand.Rand, dim int) types.Vector {
+	v := make(types.Vector, dim)
+	for i := range v {
+		v[i] = rng.Float32()*2 - 1
+	}
+	return v
+}
+
+func buildIndex(t *testing.T, vecs *storage.MmapVectorStore) *HnswIndex {
+	t.Helper()
+	idx := NewHnswIndex(vecs)
+	for i := uint64(0); i < vecs.Count(); i++ {
+		v, err := vecs.Get(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Add(i, v)
+	}
+	return idx
+}
+
+// bruteForce returns the k IDs of live nearest to q.
+func bruteForce(vecs *storage.MmapVectorStore, live map[uint64]bool, q types.Vector, k int) []uint64 {
+	var ids []uint64
+	for id := range live {
+		ids = append(ids, id)
+	}
+	dist := func(id uint64) float32 {
+		v, _ := vecs.Get(id)
+		return euclideanDistance(q, v)
+	}
+	sort.Slice(ids, func(i, j int) bool { return dist(ids[i]) < dist(ids[j]) })
+	return ids[:min(k, len(ids))]
+}
+
+// checkSearch verifies the invariants of one search result: only live IDs,
+// no duplicates, distances ascending and matching the stored vectors.
+func checkSearch(t *testing.T, vecs *storage.MmapVectorStore, live map[uint64]bool, q types.Vector, ids []uint64, dists []float32) {
+	t.Helper()
+	if len(ids) != len(dists) {
+		t.Fatalf("Got %d ids but %d distances", len(ids), len(dists))
+	}
+	seen := map[uint64]bool{}
+	for i, id := range ids {
+		if !live[id] {
+			t.Fatalf("Search returned id %d, which is not in the index", id)
+		}
+		if seen[id] {
+			t.Fatalf("Search returned id %d twice", id)
+		}
+		seen[id] = true
+		if i > 0 && dists[i] < dists[i-1] {
+			t.Fatalf("Distances not ascending: %v", dists)
+		}
+		v, _ := vecs.Get(id)
+		if d := euclideanDistance(q, v); d != dists[i] {
+			t.Fatalf("Distance of id %d is %v, stored vector gives %v", id, dists[i], d)
+		}
+	}
+}
+
+func TestSearchRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vecs := newStore(t, rng, 1000, 8)
+	idx := buildIndex(t, vecs)
+	live := map[uint64]bool{}
+	for i := uint64(0); i < vecs.Count(); i++ {
+		live[i] = true
+	}
+	if idx.Len() != 1000 {
+		t.Fatalf("Expected 1000 nodes, got %d", idx.Len())
+	}
+
+	const k = 10
+	var hits, total int
+	for i := 0; i < 50; i++ {
+		q := randomVector(rng, 8)
+		ids, dists := idx.SearchEf(q, k, 100)
+		checkSearch(t, vecs, live, q, ids, dists)
+		want := map[uint64]bool{}
+		for _, id := range bruteForce(vecs, live, q, k) {
+			want[id] = true
+		}
+		for _, id := range ids {
+			if want[id] {
+				hits++
+			}
+		}
+		total += k
+	}
+	if recall := float64(hits) / float64(total); recall < 0.9 {
+		t.Errorf("Expected recall@%d >= 0.9 at ef=100, got %.3f", k, recall)
+	}
+}
+
+func TestAddIsIdempotent(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	vecs := newStore(t, rng, 200, 4)
+	idx := buildIndex(t, vecs)
+	gen := idx.Generation()
+
+	// Re-adding used to replace the node, possibly at a lower level, leaving
+	// edges to levels it no longer had and panicking later searches.
+	for i := uint64(0); i < vecs.Count(); i++ {
+		v, _ := vecs.Get(i)
+		idx.Add(i, v)
+	}
+	if idx.Len() != 200 || idx.Generation() != gen {
+		t.Errorf("Expected re-adding to change nothing, got %d nodes, generation %d -> %d", idx.Len(), gen, idx.Generation())
+	}
+	for i := 0; i < 20; i++ {
+		idx.Search(randomVector(rng, 4), 5)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	vecs := newStore(t, rng, 300, 4)
+	if got := NewHnswIndex(vecs).Warm([]types.Vector{randomVector(rng, 4)}, 10); got != nil {
+		t.Errorf("Expected nothing to warm in an empty index, got %v", got)
+	}
+	idx := buildIndex(t, vecs)
+
+	q := randomVector(rng, 4)
+	ids := idx.Warm([]types.Vector{q}, 20)
+	if !sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i] < ids[j] }) {
+		t.Errorf("Expected IDs in order, got %v", ids)
+	}
+	warmed := map[uint64]bool{}
+	for _, id := range ids {
+		warmed[id] = true
+	}
+	results, _ := idx.SearchEf(q, 10, 20)
+	for _, id := range results {
+		if !warmed[id] {
+			t.Errorf("Expected search result %d among the warmed nodes", id)
+		}
+	}
+	if len(ids) <= len(results) || len(ids) >= 300 {
+		t.Errorf("Expected the results and their neighbors, not the whole graph, got %d nodes", len(ids))
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	vecs := newStore(t, rng, 300, 4)
+	idx := buildIndex(t, vecs)
+	q := randomVector(rng, 4)
+
+	want, _ := idx.SearchEf(q, 10, 20)
+	got, _, err := idx.SearchContext(context.Background(), q, 10, 20)
+	if err != nil || !equalIDs(got, want) {
+		t.Errorf("Expected %v, got %v %v", want, got, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if ids, _, err := idx.SearchContext(ctx, q, 10, 20); err != context.Canceled || len(ids) > 10 {
+		t.Errorf("Expected a canceled search to stop, got %v %v", ids, err)
+	}
+}
+
+func TestSearchBudget(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	vecs := newStore(t, rng, 300, 4)
+	idx := buildIndex(t, vecs)
+	q := randomVector(rng, 4)
+
+	want, _ := idx.SearchEf(q, 10, 20)
+	got, _, partial, err := idx.SearchBudget(context.Background(), q, 10, 20, Budget{MaxVisits: DefaultMaxVisits})
+	if err != nil || partial || !equalIDs(got, want) {
+		t.Errorf("Expected a full search within the default budget, got %v partial=%v %v", got, partial, err)
+	}
+
+	got, dists, partial, err := idx.SearchBudget(context.Background(), q, 10, 20, Budget{MaxVisits: 5})
+	if err != nil || !partial || len(got) == 0 || len(got) > 5 {
+		t.Fatalf("Expected at most 5 best-effort results, got %v partial=%v %v", got, partial, err)
+	}
+	if !sort.SliceIsSorted(dists, func(i, j int) bool { return dists[i] < dists[j] }) {
+		t.Errorf("Expected partial results nearest first, got %v", dists)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	vecs := newStore(t, rng, 300, 4)
+	idx := NewHnswIndex(vecs)
+	for i := uint64(0); i < 200; i++ {
+		v, _ := vecs.Get(i)
+		idx.Add(i, v)
+	}
+
+	fresh := NewHnswIndex(vecs)
+	for _, id := range idx.IDs() {
+		v, _ := vecs.Get(id)
+		fresh.Add(id, v)
+	}
+	// Writes that land while fresh is being built.
+	for i := uint64(200); i < 250; i++ {
+		v, _ := vecs.Get(i)
+		idx.Add(i, v)
+	}
+	for i := uint64(0); i < 20; i++ {
+		idx.Remove(i)
+	}
+
+	gen := idx.Generation()
+	added, removed := idx.Replace(fresh)
+	if added != 50 || removed != 20 {
+		t.Errorf("Expected 50 added and 20 removed by the catch-up, got %d and %d", added, removed)
+	}
+	if ids := idx.IDs(); len(ids) != 230 || ids[0] != 20 || ids[len(ids)-1] != 249 {
+		t.Errorf("Expected nodes 20-249 after the swap, got %d nodes", len(ids))
+	}
+	if idx.Generation() == gen {
+		t.Error("Expected the swap to bump the generation")
+	}
+	if rep := idx.Verify(false); !rep.OK() {
+		t.Errorf("Expected a healthy graph after the swap, got %+v", rep)
+	}
+	live := map[uint64]bool{}
+	for _, id := range idx.IDs() {
+		live[id] = true
+	}
+	q := randomVector(rng, 4)
+	ids, dists := idx.Search(q, 10)
+	checkSearch(t, vecs, live, q, ids, dists)
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRemoveAndReload(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	vecs := newStore(t, rng, 300, 4)
+	idx := buildIndex(t, vecs)
+	live := map[uint64]bool{}
+	for i := uint64(0); i < vecs.Count(); i++ {
+		live[i] = true
+	}
+
+	// Remove half the nodes in random order, including (likely) the entry point.
+	for _, p := range rng.Perm(300)[:150] {
+		idx.Remove(uint64(p))
+		delete(live, uint64(p))
+	}
+	if idx.Len() != 150 {
+		t.Fatalf("Expected 150 nodes after removal, got %d", idx.Len())
+	}
+	queries := make([]types.Vector, 20)
+	for i := range queries {
+		queries[i] = randomVector(rng, 4)
+		ids, dists := idx.Search(queries[i], 10)
+		checkSearch(t, vecs, live, queries[i], ids, dists)
+		if len(ids) == 0 {
+			t.Fatalf("Expected results from the remaining nodes")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewHnswIndex(vecs)
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range queries {
+		a, _ := idx.Search(q, 10)
+		b, _ := loaded.Search(q, 10)
+		if len(a) != len(b) {
+			t.Fatalf("Loaded index returned %v, original %v", b, a)
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				t.Fatalf("Loaded index returned %v, original %v", b, a)
+			}
+		}
+	}
+}
+
+// TestConcurrentAddSearchRemove hammers one index from several goroutines.
+// Run with -race to check the locking as well as the absence of panics.
+func TestConcurrentAddSearchRemove(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	const n, dim = 600, 4
+	vecs := newStore(t, rng, n, dim)
+	idx := NewHnswIndex(vecs)
+
+	var wg sync.WaitGroup
+	// Two writers add overlapping ranges, as a warm-up rebuild racing live
+	// ingest does.
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				id := uint64((i + offset) % n)
+				if !idx.Contains(id) {
+					v, _ := vecs.Get(id)
+					idx.Add(id, v)
+				}
+			}
+		}(w * n / 3)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i += 7 {
+			idx.Remove(uint64(i))
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < 200; i++ {
+				ids, dists := idx.Search(randomVector(rng, dim), 5)
+				if len(ids) != len(dists) {
+					t.Errorf("Got %d ids but %d distances", len(ids), len(dists))
+					return
+				}
+				_ = idx.Generation()
+			}
+		}(int64(r))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			var buf bytes.Buffer
+			if err := idx.Save(&buf); err != nil {
+				t.Errorf("Save failed: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if got := idx.Len(); got > n || got < n-n/7-1 {
+		t.Errorf("Unexpected node count %d after concurrent adds and removes", got)
+	}
+	for i := 0; i < 20; i++ {
+		idx.Search(randomVector(rng, dim), 5)
+	}
+}
+
+func TestSeededBuild(t *testing.T) {
+	rng := rand.New(rand.NewSource(15))
+	vecs := newStore(t, rng, 500, 4)
+	save := func(idx Index) []byte {
+		t.Helper()
+		for i := uint64(0); i < vecs.Count(); i++ {
+			v, _ := vecs.Get(i)
+			idx.Add(i, v)
+		}
+		for i := uint64(0); i < 500; i += 7 {
+			idx.Remove(i)
+		}
+		var buf bytes.Buffer
+		if err := idx.Save(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	mem, err := New(Config{Seed: 42}, vecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := save(mem)
+	disk, err := New(Config{Seed: 42, DiskDir: t.TempDir(), CacheNodes: 16}, vecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	if !bytes.Equal(save(disk), want) {
+		t.Error("Expected the same seed to build the same graph on disk as in memory")
+	}
+	fresh, err := mem.Fresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(save(fresh), want) {
+		t.Error("Expected Fresh to keep the seed")
+	}
+	other, _ := New(Config{Seed: 43}, vecs)
+	if bytes.Equal(save(other), want) {
+		t.Error("Expected another seed to build another graph")
+	}
+}
@@ -0,0 +1,102 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// Index kinds accepted by New and the -index flag.
+const (
+	KindHNSW = "hnsw"
+	KindIVF  = "ivf"
+)
+
+// Index is an approximate nearest-neighbor index over the vectors of a
+// VectorStore. It holds IDs only; vectors are read from the store.
+// Implementations are safe for concurrent use and Add is idempotent per ID.
+type Index interface {
+	Add(id uint64, vector types.Vector)
+	Remove(id uint64)
+	Reset()
+	Contains(id uint64) bool
+	Len() int
+	// IDs returns the indexed IDs in ascending order.
+	IDs() []uint64
+	// Generation changes whenever the index does.
+	Generation() uint64
+
+	Search(query types.Vector, k int) ([]uint64, []float32)
+	SearchEf(query types.Vector, k, ef int) ([]uint64, []float32)
+	SearchContext(ctx context.Context, query types.Vector, k, ef int) ([]uint64, []float32, error)
+	SearchBudget(ctx context.Context, query types.Vector, k, ef int, b Budget) (ids []uint64, dists []float32, partial bool, err error)
+	Warm(queries []types.Vector, ef int) []uint64
+
+	Verify(repair bool) Report
+	// Fresh returns an empty index of the same kind over the same store,
+	// for building a replacement to pass to Replace.
+	Fresh() (Index, error)
+	Replace(fresh Index) (added, removed int)
+
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+	// Close releases what the index holds outside memory. The vector store
+	// is left open.
+	Close() error
+}
+
+// Config selects the index New builds.
+type Config struct {
+	// Kind is KindHNSW (also "") or KindIVF.
+	Kind string
+	// DiskDir, when set, keeps the neighbor lists of an HNSW graph in an
+	// adjacency file created in this directory instead of in memory (see
+	// NewDiskHnswIndex).
+	DiskDir string
+	// CacheNodes is how many nodes a disk-backed graph keeps decoded in
+	// memory; 0 means DefaultCacheNodes.
+	CacheNodes int
+	// Seed makes HNSW builds reproducible (see HnswIndex.SetSeed); 0 picks
+	// a random seed per index. IVF builds are reproducible regardless.
+	Seed int64
+}
+
+// Validate rejects unknown kinds, negative cache sizes and a DiskDir for
+// an index other than HNSW.
+func (c Config) Validate() error {
+	switch c.Kind {
+	case "", KindHNSW:
+	case KindIVF:
+		if c.DiskDir != "" {
+			return fmt.Errorf("a disk-backed index needs kind %s, not %s", KindHNSW, c.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown index kind %q (want %s or %s)", c.Kind, KindHNSW, KindIVF)
+	}
+	if c.CacheNodes < 0 {
+		return fmt.Errorf("invalid index cache size %d", c.CacheNodes)
+	}
+	return nil
+}
+
+// New returns an empty index configured by c over vecs.
+func New(c Config, vecs storage.VectorStore) (Index, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.Kind == KindIVF {
+		return NewIVFIndex(vecs), nil
+	}
+	idx := NewHnswIndex(vecs)
+	if c.DiskDir != "" {
+		var err error
+		if idx, err = NewDiskHnswIndex(vecs, c.DiskDir, c.CacheNodes); err != nil {
+			return nil, err
+		}
+	}
+	idx.SetSeed(c.Seed)
+	return idx, nil
+}
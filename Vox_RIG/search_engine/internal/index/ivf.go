@@ -0,0 +1,456 @@
+package index
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+const (
+	// DefaultNProbe is how many lists a search at EfSearch scans.
+	DefaultNProbe = 8
+	// IVFTrainSize is how many vectors an IVFIndex holds before it trains
+	// its quantizer; below it every search is an exact scan.
+	IVFTrainSize = 1024
+	// IVFMaxLists caps the number of lists, which is otherwise about the
+	// square root of the number of vectors.
+	IVFMaxLists = 4096
+
+	ivfTrainSample     = 16384
+	ivfTrainIterations = 10
+)
+
+// IVFIndex is an inverted-file index: a k-means coarse quantizer splits the
+// vectors into lists, and a search scans the lists nearest the query
+// exactly. Adding a vector costs one distance per list rather than a graph
+// search, so bulk builds run an order of magnitude faster than HnswIndex, and
+// it holds only IDs and centroids, at the cost of some recall at the edges of
+// the lists.
+//
+// The quantizer is trained on a sample of the vectors once IVFTrainSize are
+// present and again whenever the count has doubled since, so the lists stay
+// balanced as the store grows; every vector is reassigned then, under the
+// write lock. It is safe for concurrent use like HnswIndex.
+type IVFIndex struct {
+	vecs      storage.VectorStore
+	centroids []types.Vector
+	lists     [][]uint64
+	// list maps each ID to the list holding it.
+	list map[uint64]int
+	// trained is how many vectors the quantizer was last trained on.
+	trained int
+	gen     uint64
+	mu      sync.RWMutex
+}
+
+func NewIVFIndex(vecs storage.VectorStore) *IVFIndex {
+	return &IVFIndex{vecs: vecs, lists: make([][]uint64, 1), list: map[uint64]int{}}
+}
+
+// Reset clears the lists and the quantizer. It does NOT modify the
+// underlying vector store.
+func (idx *IVFIndex) Reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.centroids = nil
+	idx.lists = make([][]uint64, 1)
+	idx.list = map[uint64]int{}
+	idx.trained = 0
+	idx.gen++
+}
+
+// Generation changes whenever the index does.
+func (idx *IVFIndex) Generation() uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.gen
+}
+
+// Contains reports whether id is indexed.
+func (idx *IVFIndex) Contains(id uint64) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	_, ok := idx.list[id]
+	return ok
+}
+
+// Len returns the number of indexed vectors.
+func (idx *IVFIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.list)
+}
+
+// IDs returns the indexed IDs in ascending order.
+func (idx *IVFIndex) IDs() []uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ids := make([]uint64, 0, len(idx.list))
+	for id := range idx.list {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Add files vector under id in the list of its nearest centroid. IDs
+// already present are left alone.
+func (idx *IVFIndex) Add(id uint64, vector types.Vector) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, ok := idx.list[id]; ok {
+		return
+	}
+	l := 0
+	if len(idx.centroids) > 0 {
+		l = NearestCentroid(idx.centroids, vector)
+	}
+	idx.lists[l] = append(idx.lists[l], id)
+	idx.list[id] = l
+	idx.gen++
+
+	if n := len(idx.list); n >= IVFTrainSize && n >= 2*idx.trained {
+		idx.train()
+	}
+}
+
+// train fits the quantizer to a sample of the indexed vectors and
+// reassigns every vector to its nearest centroid. The sample is drawn with
+// a seed fixed by the count, so a rebuild over the same vectors gives the
+// same lists. The caller holds the write lock.
+func (idx *IVFIndex) train() {
+	ids := make([]uint64, 0, len(idx.list))
+	for id := range idx.list {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	rng := rand.New(rand.NewSource(int64(len(ids))))
+	sample := make([]types.Vector, 0, min(len(ids), ivfTrainSample))
+	for _, i := range rng.Perm(len(ids))[:min(len(ids), ivfTrainSample)] {
+		if v, err := idx.vecs.Get(ids[i]); err == nil {
+			sample = append(sample, v)
+		}
+	}
+	if len(sample) == 0 {
+		return
+	}
+	k := min(min(int(math.Sqrt(float64(len(ids)))), IVFMaxLists), len(sample))
+	centroids := KMeansPlusPlus(sample, k, rng)
+	assign := make([]int, len(sample))
+	for it := 0; it < ivfTrainIterations; it++ {
+		for i, v := range sample {
+			assign[i] = NearestCentroid(centroids, v)
+		}
+		centroids = Recenter(sample, assign, centroids)
+	}
+
+	idx.centroids = centroids
+	idx.assignAll(ids)
+	idx.trained = len(ids)
+	idx.gen++
+}
+
+// assignAll rebuilds the lists from ids under the current centroids. IDs
+// without a vector go to list 0, where Verify finds them.
+func (idx *IVFIndex) assignAll(ids []uint64) {
+	idx.lists = make([][]uint64, max(len(idx.centroids), 1))
+	idx.list = make(map[uint64]int, len(ids))
+	for _, id := range ids {
+		l := 0
+		if v, err := idx.vecs.Get(id); err == nil && len(idx.centroids) > 0 {
+			l = NearestCentroid(idx.centroids, v)
+		}
+		idx.lists[l] = append(idx.lists[l], id)
+		idx.list[id] = l
+	}
+}
+
+// Remove drops id from its list. The vector itself stays in the vector
+// store.
+func (idx *IVFIndex) Remove(id uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	l, ok := idx.list[id]
+	if !ok {
+		return
+	}
+	delete(idx.list, id)
+	idx.lists[l] = removeID(idx.lists[l], id)
+	idx.gen++
+}
+
+func (idx *IVFIndex) Search(query types.Vector, k int) ([]uint64, []float32) {
+	return idx.SearchEf(query, k, EfSearch)
+}
+
+// SearchEf is Search with an explicit effort: ef scales the number of lists
+// scanned, DefaultNProbe at EfSearch.
+func (idx *IVFIndex) SearchEf(query types.Vector, k, ef int) ([]uint64, []float32) {
+	ids, dists, _ := idx.SearchContext(context.Background(), query, k, ef)
+	return ids, dists
+}
+
+// SearchContext is SearchEf that gives up once ctx is done, returning the
+// nearest vectors scanned so far together with ctx.Err().
+func (idx *IVFIndex) SearchContext(ctx context.Context, query types.Vector, k, ef int) ([]uint64, []float32, error) {
+	ids, dists, _, err := idx.SearchBudget(ctx, query, k, ef, Budget{})
+	return ids, dists, err
+}
+
+// SearchBudget is SearchContext within b, where a visit is one vector
+// scanned. partial reports whether the budget ran out before every probed
+// list was scanned.
+func (idx *IVFIndex) SearchBudget(ctx context.Context, query types.Vector, k, ef int, b Budget) (ids []uint64, dists []float32, partial bool, err error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var deadline time.Time
+	if b.Time > 0 {
+		deadline = time.Now().Add(b.Time)
+	}
+	var results []neighborResult
+	visits := 0
+scan:
+	for _, l := range idx.probe(query, ef) {
+		for _, id := range idx.lists[l] {
+			if visits%searchCheckEvery == 0 {
+				if err = ctx.Err(); err != nil {
+					break scan
+				}
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					partial = true
+					break scan
+				}
+			}
+			if b.MaxVisits > 0 && visits >= b.MaxVisits {
+				partial = true
+				break scan
+			}
+			visits++
+			v, verr := idx.vecs.Get(id)
+			if verr != nil {
+				continue
+			}
+			results = append(results, neighborResult{id, euclideanDistance(query, v)})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].dist < results[j].dist })
+	results = results[:min(len(results), k)]
+	ids = make([]uint64, len(results))
+	dists = make([]float32, len(results))
+	for i := range results {
+		ids[i] = results[i].id
+		dists[i] = results[i].dist
+	}
+	return ids, dists, partial, err
+}
+
+// probe returns the lists a search with effort ef scans, nearest centroid
+// first. The caller holds the lock.
+func (idx *IVFIndex) probe(query types.Vector, ef int) []int {
+	if len(idx.centroids) == 0 {
+		return []int{0}
+	}
+	n := min(max(DefaultNProbe*ef/EfSearch, 1), len(idx.centroids))
+	order := make([]neighborResult, len(idx.centroids))
+	for i, c := range idx.centroids {
+		order[i] = neighborResult{uint64(i), SquaredDistance(query, c)}
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].dist < order[j].dist })
+	lists := make([]int, n)
+	for i := range lists {
+		lists[i] = int(order[i].id)
+	}
+	return lists
+}
+
+// Warm returns the IDs a search with effort ef for each query scans, in ID
+// order, so the caller can prefetch their vectors.
+func (idx *IVFIndex) Warm(queries []types.Vector, ef int) []uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.list) == 0 {
+		return nil
+	}
+	seen := map[uint64]bool{}
+	for _, query := range queries {
+		for _, l := range idx.probe(query, ef) {
+			for _, id := range idx.lists[l] {
+				seen[id] = true
+			}
+		}
+	}
+	out := make([]uint64, 0, len(seen))
+	for id := range seen {
+		out = append(out, id)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Verify checks that every ID sits in exactly the list recorded for it and
+// has a vector. In the Report, list entries the record disagrees with (or
+// records missing from their list) count as DanglingLinks and repeated
+// entries as DuplicateLinks; the graph-only checks stay zero. With repair
+// the lists are rebuilt from the recorded IDs that have vectors.
+func (idx *IVFIndex) Verify(repair bool) Report {
+	if repair {
+		idx.mu.Lock()
+		defer idx.mu.Unlock()
+	} else {
+		idx.mu.RLock()
+		defer idx.mu.RUnlock()
+	}
+
+	var rep Report
+	count := idx.vecs.Count()
+	listed := make(map[uint64]bool, len(idx.list))
+	for l, ids := range idx.lists {
+		for _, id := range ids {
+			if rec, ok := idx.list[id]; listed[id] {
+				rep.DuplicateLinks++
+			} else if !ok || rec != l {
+				rep.DanglingLinks++
+			}
+			listed[id] = true
+		}
+	}
+	var keep []uint64
+	for id := range idx.list {
+		if !listed[id] {
+			rep.DanglingLinks++
+		}
+		if _, err := idx.vecs.Get(id); id >= count || err != nil {
+			rep.NodesWithoutVectors++
+			continue
+		}
+		keep = append(keep, id)
+	}
+	rep.Nodes = len(keep)
+
+	if repair && !rep.OK() {
+		sort.Slice(keep, func(i, j int) bool { return keep[i] < keep[j] })
+		idx.assignAll(keep)
+		idx.gen++
+	}
+	return rep
+}
+
+// Fresh returns an empty IVFIndex over the same vector store.
+func (idx *IVFIndex) Fresh() (Index, error) {
+	return NewIVFIndex(idx.vecs), nil
+}
+
+// Close does nothing; the lists live in memory.
+func (idx *IVFIndex) Close() error {
+	return nil
+}
+
+// Replace swaps in the lists of fresh, built over the same vector store, as
+// one step; see HnswIndex.Replace. fresh must come from idx.Fresh.
+func (idx *IVFIndex) Replace(next Index) (added, removed int) {
+	fresh := next.(*IVFIndex)
+	diff := func() (add, drop []uint64) {
+		for id := range idx.list {
+			if !fresh.Contains(id) {
+				add = append(add, id)
+			}
+		}
+		for _, id := range fresh.IDs() {
+			if _, ok := idx.list[id]; !ok {
+				drop = append(drop, id)
+			}
+		}
+		return add, drop
+	}
+	apply := func(add, drop []uint64) {
+		for _, id := range add {
+			if v, err := idx.vecs.Get(id); err == nil {
+				fresh.Add(id, v)
+				added++
+			}
+		}
+		for _, id := range drop {
+			fresh.Remove(id)
+			removed++
+		}
+	}
+
+	idx.mu.RLock()
+	add, drop := diff()
+	idx.mu.RUnlock()
+	apply(add, drop)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	apply(diff())
+	idx.centroids = fresh.centroids
+	idx.lists = fresh.lists
+	idx.list = fresh.list
+	idx.trained = fresh.trained
+	idx.gen++
+	return added, removed
+}
+
+// ivfSnapshot is the on-disk form of the lists written by Save. Kind keeps
+// a graph saved by HnswIndex from loading as lists, and the reverse.
+type ivfSnapshot struct {
+	Kind      string
+	Centroids []types.Vector
+	Lists     [][]uint64
+	Trained   int
+}
+
+// Save serializes the quantizer and lists (not the vectors) to w.
+func (idx *IVFIndex) Save(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	snap := ivfSnapshot{Kind: KindIVF, Centroids: idx.centroids, Lists: idx.lists, Trained: idx.trained}
+	return gob.NewEncoder(w).Encode(&snap)
+}
+
+// Load replaces the lists with ones previously written by Save.
+func (idx *IVFIndex) Load(r io.Reader) error {
+	var snap ivfSnapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return err
+	}
+	if snap.Kind != KindIVF {
+		return fmt.Errorf("index snapshot is not an %s index", KindIVF)
+	}
+	if len(snap.Lists) == 0 || (len(snap.Centroids) > 0 && len(snap.Centroids) != len(snap.Lists)) {
+		return fmt.Errorf("index snapshot has %d centroids for %d lists", len(snap.Centroids), len(snap.Lists))
+	}
+
+	list := map[uint64]int{}
+	for l, ids := range snap.Lists {
+		for _, id := range ids {
+			list[id] = l
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.centroids = snap.Centroids
+	idx.lists = snap.Lists
+	idx.list = list
+	idx.trained = snap.Trained
+	idx.gen++
+	return nil
+}
@@ -0,0 +1,139 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestIVFRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	vecs := newStore(t, rng, 5000, 8)
+	idx := NewIVFIndex(vecs)
+	live := map[uint64]bool{}
+	for i := uint64(0); i < vecs.Count(); i++ {
+		v, _ := vecs.Get(i)
+		idx.Add(i, v)
+		live[i] = true
+	}
+	if idx.Len() != 5000 || len(idx.centroids) < 2 || idx.trained != 4096 {
+		t.Fatalf("Expected 5000 vectors in trained lists, got %d in %d lists (trained on %d)", idx.Len(), len(idx.centroids), idx.trained)
+	}
+	if rep := idx.Verify(false); !rep.OK() || rep.Nodes != 5000 {
+		t.Fatalf("Expected healthy lists, got %+v", rep)
+	}
+
+	const k = 10
+	var hits, total int
+	for i := 0; i < 50; i++ {
+		q := randomVector(rng, 8)
+		ids, dists := idx.SearchEf(q, k, 200)
+		checkSearch(t, vecs, live, q, ids, dists)
+		want := map[uint64]bool{}
+		for _, id := range bruteForce(vecs, live, q, k) {
+			want[id] = true
+		}
+		for _, id := range ids {
+			if want[id] {
+				hits++
+			}
+		}
+		total += k
+	}
+	if recall := float64(hits) / float64(total); recall < 0.9 {
+		t.Errorf("Expected recall@%d >= 0.9 at ef=200, got %.3f", k, recall)
+	}
+
+	// A visit budget smaller than one list cuts the scan short.
+	ids, _, partial, err := idx.SearchBudget(context.Background(), randomVector(rng, 8), k, EfSearch, Budget{MaxVisits: 5})
+	if err != nil || !partial || len(ids) != 5 {
+		t.Errorf("Expected 5 partial results, got %v partial=%v err=%v", ids, partial, err)
+	}
+}
+
+func TestIVFRemoveAndReload(t *testing.T) {
+	rng := rand.New(rand.NewSource(12))
+	vecs := newStore(t, rng, 2000, 4)
+	idx := NewIVFIndex(vecs)
+	for i := uint64(0); i < vecs.Count(); i++ {
+		v, _ := vecs.Get(i)
+		idx.Add(i, v)
+	}
+	live := map[uint64]bool{}
+	for i := uint64(0); i < vecs.Count(); i++ {
+		if i%3 == 0 {
+			idx.Remove(i)
+		} else {
+			live[i] = true
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewHnswIndex(vecs).Load(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("Expected an HNSW index to refuse IVF lists")
+	}
+	loaded := NewIVFIndex(vecs)
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != len(live) {
+		t.Fatalf("Expected %d vectors after reload, got %d", len(live), loaded.Len())
+	}
+	q := randomVector(rng, 4)
+	ids, dists := loaded.Search(q, 10)
+	checkSearch(t, vecs, live, q, ids, dists)
+	if !equalIDs(ids, func() []uint64 { ids, _ := idx.Search(q, 10); return ids }()) {
+		t.Error("Expected the reloaded lists to answer like the saved ones")
+	}
+}
+
+func TestIVFVerify(t *testing.T) {
+	rng := rand.New(rand.NewSource(13))
+	vecs := newStore(t, rng, 1500, 4)
+	idx := NewIVFIndex(vecs)
+	for i := uint64(0); i < vecs.Count(); i++ {
+		v, _ := vecs.Get(i)
+		idx.Add(i, v)
+	}
+	// A repeated entry, an entry in the wrong list and an ID past the store.
+	idx.lists[0] = append(idx.lists[0], idx.lists[0][0])
+	moved := idx.lists[1][0]
+	idx.lists[1] = idx.lists[1][1:]
+	idx.lists[0] = append(idx.lists[0], moved)
+	idx.lists[0] = append(idx.lists[0], 9999)
+	idx.list[9999] = 0
+
+	rep := idx.Verify(true)
+	if rep.DuplicateLinks != 1 || rep.DanglingLinks != 1 || rep.NodesWithoutVectors != 1 || rep.Nodes != 1500 {
+		t.Errorf("Expected 1 duplicate, 1 misfiled and 1 vectorless entry, got %+v", rep)
+	}
+	if rep := idx.Verify(false); !rep.OK() || idx.Len() != 1500 || idx.Contains(9999) {
+		t.Errorf("Expected repaired lists, got %+v with %d vectors", rep, idx.Len())
+	}
+}
+
+func TestNew(t *testing.T) {
+	vecs := newStore(t, rand.New(rand.NewSource(14)), 0, 4)
+	for kind, want := range map[string]string{"": "*index.HnswIndex", KindHNSW: "*index.HnswIndex", KindIVF: "*index.IVFIndex"} {
+		idx, err := New(Config{Kind: kind}, vecs)
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", kind, err)
+		}
+		if got := fmt.Sprintf("%T", idx); got != want {
+			t.Errorf("New(%q) = %s, want %s", kind, got, want)
+		}
+		if fresh, _ := idx.Fresh(); fmt.Sprintf("%T", fresh) != want {
+			t.Errorf("New(%q).Fresh() = %T, want %s", kind, fresh, want)
+		}
+	}
+	for _, c := range []Config{{Kind: "lsh"}, {Kind: KindIVF, DiskDir: t.TempDir()}, {CacheNodes: -1}} {
+		if _, err := New(c, vecs); err == nil {
+			t.Errorf("Expected %+v to fail", c)
+		}
+	}
+}
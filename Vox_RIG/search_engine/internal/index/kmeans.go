@@ -0,0 +1,91 @@
+package index
+
+import (
+	"math/rand"
+
+	"vox-vector-engine/internal/types"
+)
+
+// KMeansPlusPlus picks k initial centroids from vecs, each new one with
+// probability proportional to its squared distance from the nearest chosen.
+func KMeansPlusPlus(vecs []types.Vector, k int, rng *rand.Rand) []types.Vector {
+	centroids := []types.Vector{clone(vecs[rng.Intn(len(vecs))])}
+	dists := make([]float64, len(vecs))
+	for len(centroids) < k {
+		var total float64
+		last := centroids[len(centroids)-1]
+		for i, v := range vecs {
+			d := float64(SquaredDistance(last, v))
+			if len(centroids) == 1 || d < dists[i] {
+				dists[i] = d
+			}
+			total += dists[i]
+		}
+		if total == 0 {
+			// Fewer distinct vectors than k.
+			break
+		}
+		r := rng.Float64() * total
+		pick := len(vecs) - 1
+		for i, d := range dists {
+			if r -= d; r <= 0 {
+				pick = i
+				break
+			}
+		}
+		centroids = append(centroids, clone(vecs[pick]))
+	}
+	return centroids
+}
+
+// Recenter moves each centroid to the mean of its vectors; a centroid left
+// without any keeps its place.
+func Recenter(vecs []types.Vector, assign []int, centroids []types.Vector) []types.Vector {
+	sums := make([]types.Vector, len(centroids))
+	counts := make([]int, len(centroids))
+	for i, v := range vecs {
+		c := assign[i]
+		if sums[c] == nil {
+			sums[c] = make(types.Vector, len(v))
+		}
+		for j, f := range v {
+			sums[c][j] += f
+		}
+		counts[c]++
+	}
+	for c, sum := range sums {
+		if counts[c] == 0 {
+			sums[c] = centroids[c]
+			continue
+		}
+		for j := range sum {
+			sum[j] /= float32(counts[c])
+		}
+	}
+	return sums
+}
+
+// NearestCentroid returns the index of the centroid nearest v.
+func NearestCentroid(centroids []types.Vector, v types.Vector) int {
+	best, bestDist := 0, float32(-1)
+	for i, c := range centroids {
+		if d := SquaredDistance(c, v); bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// SquaredDistance is the squared Euclidean distance between a and b.
+func SquaredDistance(a, b types.Vector) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+func clone(v types.Vector) types.Vector {
+	return append(types.Vector(nil), v...)
+}
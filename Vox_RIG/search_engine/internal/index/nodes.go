@@ -0,0 +1,181 @@
+package index
+
+import (
+	"container/list"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"vox-vector-engine/internal/storage"
+)
+
+// DefaultCacheNodes is how many nodes a disk-backed graph keeps decoded in
+// memory when Config.CacheNodes is 0.
+const DefaultCacheNodes = 100000
+
+// nodeStore holds the nodes of an HnswIndex. The graph calls it under its
+// own lock: get and has under the read lock, the rest under the write lock.
+// A node get returns may be shared with other callers, so the graph puts a
+// node back whenever it changes one.
+type nodeStore interface {
+	get(id uint64) *Node
+	has(id uint64) bool
+	put(n *Node)
+	del(id uint64)
+	len() int
+	// ids returns the node IDs in no particular order.
+	ids() []uint64
+	reset()
+	close() error
+}
+
+// memNodes keeps every node in a map; put is free since get hands out the
+// stored node itself.
+type memNodes map[uint64]*Node
+
+func (m memNodes) get(id uint64) *Node { return m[id] }
+
+func (m memNodes) has(id uint64) bool {
+	_, ok := m[id]
+	return ok
+}
+
+func (m memNodes) put(n *Node)   { m[n.ID] = n }
+func (m memNodes) del(id uint64) { delete(m, id) }
+func (m memNodes) len() int      { return len(m) }
+func (m memNodes) close() error  { return nil }
+func (m memNodes) reset()        { clear(m) }
+func (m memNodes) ids() []uint64 {
+	ids := make([]uint64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// diskNodes keeps the link lists in a storage.AdjacencyFile and the most
+// recently used nodes decoded in an LRU cache, so memory follows the part
+// of the graph searches visit rather than its size. Every put writes
+// through, which keeps evicting a node free.
+type diskNodes struct {
+	file *storage.AdjacencyFile
+	// mu guards the cache, which readers sharing the graph's read lock
+	// update too.
+	mu    sync.Mutex
+	max   int
+	cache map[uint64]*list.Element
+	lru   *list.List // of *Node, most recently used first
+	// failed is set once an I/O error has been logged, so only the first is.
+	failed atomic.Bool
+}
+
+func newDiskNodes(dir string, cacheNodes int) (*diskNodes, error) {
+	f, err := storage.CreateAdjacencyFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	if cacheNodes <= 0 {
+		cacheNodes = DefaultCacheNodes
+	}
+	return &diskNodes{file: f, max: cacheNodes, cache: map[uint64]*list.Element{}, lru: list.New()}, nil
+}
+
+func (d *diskNodes) get(id uint64) *Node {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.cache[id]; ok {
+		d.lru.MoveToFront(e)
+		return e.Value.(*Node)
+	}
+	level, links, ok, err := d.file.Read(id)
+	if err != nil {
+		d.fail(err)
+	}
+	if !ok {
+		return nil
+	}
+	n := &Node{ID: id, Level: level, Neighbors: links}
+	d.cacheLocked(n)
+	return n
+}
+
+func (d *diskNodes) has(id uint64) bool {
+	d.mu.Lock()
+	_, ok := d.cache[id]
+	d.mu.Unlock()
+	if ok {
+		return true
+	}
+	ok, err := d.file.Has(id)
+	if err != nil {
+		d.fail(err)
+	}
+	return ok
+}
+
+func (d *diskNodes) put(n *Node) {
+	if err := d.file.Write(n.ID, n.Level, n.Neighbors); err != nil {
+		d.fail(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.cache[n.ID]; ok {
+		e.Value = n
+		d.lru.MoveToFront(e)
+		return
+	}
+	d.cacheLocked(n)
+}
+
+func (d *diskNodes) cacheLocked(n *Node) {
+	d.cache[n.ID] = d.lru.PushFront(n)
+	for d.lru.Len() > d.max {
+		old := d.lru.Remove(d.lru.Back()).(*Node)
+		delete(d.cache, old.ID)
+	}
+}
+
+func (d *diskNodes) del(id uint64) {
+	if err := d.file.Delete(id); err != nil {
+		d.fail(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.cache[id]; ok {
+		d.lru.Remove(e)
+		delete(d.cache, id)
+	}
+}
+
+func (d *diskNodes) len() int { return d.file.Len() }
+
+func (d *diskNodes) ids() []uint64 {
+	ids, err := d.file.IDs()
+	if err != nil {
+		d.fail(err)
+	}
+	return ids
+}
+
+func (d *diskNodes) reset() {
+	if err := d.file.Reset(); err != nil {
+		d.fail(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cache = map[uint64]*list.Element{}
+	d.lru.Init()
+}
+
+func (d *diskNodes) close() error {
+	return d.file.Close()
+}
+
+// fail logs the first I/O error of the adjacency file. The graph has no
+// way to return one from Add or Search; the node concerned reads as
+// missing, which Verify then reports.
+func (d *diskNodes) fail(err error) {
+	if d.failed.CompareAndSwap(false, true) {
+		log.Printf("hnsw adjacency file %s: %v", d.file.Path(), err)
+	}
+}
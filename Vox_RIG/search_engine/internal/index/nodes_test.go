@@ -0,0 +1,99 @@
+package index
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskHnswIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	vecs := newStore(t, rng, 1000, 8)
+	dir := t.TempDir()
+	idx, err := NewDiskHnswIndex(vecs, dir, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := map[uint64]bool{}
+	for i := uint64(0); i < vecs.Count(); i++ {
+		v, _ := vecs.Get(i)
+		idx.Add(i, v)
+		live[i] = true
+	}
+	for i := uint64(0); i < 100; i++ {
+		idx.Remove(i)
+		delete(live, i)
+	}
+	if idx.Len() != 900 {
+		t.Fatalf("Expected 900 nodes, got %d", idx.Len())
+	}
+	if d := idx.nodes.(*diskNodes); d.lru.Len() > 64 {
+		t.Errorf("Expected at most 64 cached nodes, got %d", d.lru.Len())
+	}
+	if rep := idx.Verify(false); !rep.OK() {
+		t.Fatalf("Expected a healthy graph, got %+v", rep)
+	}
+
+	const k = 10
+	var hits, total int
+	for i := 0; i < 30; i++ {
+		q := randomVector(rng, 8)
+		ids, dists := idx.SearchEf(q, k, 100)
+		checkSearch(t, vecs, live, q, ids, dists)
+		want := map[uint64]bool{}
+		for _, id := range bruteForce(vecs, live, q, k) {
+			want[id] = true
+		}
+		for _, id := range ids {
+			if want[id] {
+				hits++
+			}
+		}
+		total += k
+	}
+	if recall := float64(hits) / float64(total); recall < 0.9 {
+		t.Errorf("Expected recall@%d >= 0.9 at ef=100, got %.3f", k, recall)
+	}
+
+	// The graph saves like an in-memory one and loads into either.
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mem := NewHnswIndex(vecs)
+	if err := mem.Load(bytes.NewReader(buf.Bytes())); err != nil || mem.Len() != 900 {
+		t.Fatalf("Expected 900 nodes loaded in memory, got %d %v", mem.Len(), err)
+	}
+	q := randomVector(rng, 8)
+	want, _ := idx.Search(q, k)
+	if got, _ := mem.Search(q, k); !equalIDs(got, want) {
+		t.Errorf("Expected the loaded graph to answer like the disk one, got %v want %v", got, want)
+	}
+
+	// Replace swaps in a fresh file and deletes the old one.
+	old := idx.nodes.(*diskNodes).file.Path()
+	next, err := idx.Fresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range idx.IDs() {
+		v, _ := vecs.Get(id)
+		next.Add(id, v)
+	}
+	idx.Replace(next)
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected the replaced adjacency file to be deleted, got %v", err)
+	}
+	if rep := idx.Verify(false); !rep.OK() || rep.Nodes != 900 {
+		t.Errorf("Expected a healthy graph after the swap, got %+v", rep)
+	}
+
+	if err := idx.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Errorf("Expected Close to delete the adjacency files, found %v", left)
+	}
+}
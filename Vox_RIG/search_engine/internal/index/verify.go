@@ -0,0 +1,158 @@
+package index
+
+import "sort"
+
+// Report is what Verify found wrong with the graph. After a repair the
+// counts describe what was fixed.
+type Report struct {
+	Nodes int `json:"nodes"`
+	// DanglingLinks point at nodes that are gone or do not reach the
+	// link's level.
+	DanglingLinks int `json:"dangling_links"`
+	// AsymmetricLinks have no link back at the same level.
+	AsymmetricLinks int `json:"asymmetric_links"`
+	// DuplicateLinks repeat a neighbor or point a node at itself.
+	DuplicateLinks int `json:"duplicate_links"`
+	// LevelMismatches are nodes whose Level disagrees with their link lists.
+	LevelMismatches int `json:"level_mismatches"`
+	// NodesWithoutVectors cannot be searched: the vector store does not
+	// hold their ID.
+	NodesWithoutVectors int `json:"nodes_without_vectors"`
+	// BadEntryPoint is set when the entry point is gone or not on the top
+	// level, which cuts searches off from part of the graph.
+	BadEntryPoint bool `json:"bad_entry_point,omitempty"`
+}
+
+// OK reports whether the graph passed every check.
+func (r Report) OK() bool {
+	return r.DanglingLinks == 0 && r.AsymmetricLinks == 0 && r.DuplicateLinks == 0 &&
+		r.LevelMismatches == 0 && r.NodesWithoutVectors == 0 && !r.BadEntryPoint
+}
+
+// Verify checks the invariants searches rely on: every link points at a
+// node that reaches its level and links back, each node has one link list
+// per level, every node has a vector, and the entry point is a node on the
+// top level. With repair it also fixes what it finds: nodes without vectors
+// are removed, bad links pruned, missing back links added, link lists
+// resized to the node's level and the entry point re-elected.
+func (idx *HnswIndex) Verify(repair bool) Report {
+	if repair {
+		idx.mu.Lock()
+		defer idx.mu.Unlock()
+	} else {
+		idx.mu.RLock()
+		defer idx.mu.RUnlock()
+	}
+
+	var rep Report
+	count := idx.vecs.Count()
+	// In ID order, so a repair adds back links the same way every run.
+	ids := idx.nodes.ids()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	gone := map[uint64]bool{}
+	for _, id := range ids {
+		n := idx.nodes.get(id)
+		if _, err := idx.vecs.Get(id); id >= count || err != nil {
+			gone[id] = true
+			rep.NodesWithoutVectors++
+			continue
+		}
+		if len(n.Neighbors) != n.Level+1 {
+			rep.LevelMismatches++
+			if repair {
+				links := make([][]uint64, n.Level+1)
+				copy(links, n.Neighbors)
+				n.Neighbors = links
+				idx.nodes.put(n)
+			}
+		}
+	}
+	rep.Nodes = len(ids) - len(gone)
+	if repair {
+		for id := range gone {
+			idx.nodes.del(id)
+		}
+	}
+
+	// reaches reports whether id is a live node with links at level l.
+	reaches := func(id uint64, l int) bool {
+		n := idx.nodes.get(id)
+		return n != nil && !gone[id] && l < len(n.Neighbors) && l <= n.Level
+	}
+	type link struct {
+		from, to uint64
+		level    int
+	}
+	var backLinks []link
+	for _, id := range ids {
+		if gone[id] {
+			continue
+		}
+		n := idx.nodes.get(id)
+		for l, links := range n.Neighbors {
+			seen := make(map[uint64]bool, len(links))
+			kept := links[:0]
+			for _, to := range links {
+				switch {
+				case to == id || seen[to]:
+					rep.DuplicateLinks++
+					continue
+				case !reaches(id, l) || !reaches(to, l):
+					rep.DanglingLinks++
+					continue
+				}
+				seen[to] = true
+				if !linksTo(idx.nodes.get(to).Neighbors[l], id) {
+					rep.AsymmetricLinks++
+					backLinks = append(backLinks, link{to, id, l})
+				}
+				if repair {
+					kept = append(kept, to)
+				}
+			}
+			if repair {
+				n.Neighbors[l] = kept
+			}
+		}
+		if repair {
+			idx.nodes.put(n)
+		}
+	}
+
+	top := -1
+	for _, id := range ids {
+		if n := idx.nodes.get(id); !gone[id] && n != nil && n.Level > top {
+			top = n.Level
+		}
+	}
+	if ep := idx.nodes.get(idx.entryPointID); top != idx.currentMaxLevel || (top >= 0 && (ep == nil || gone[ep.ID] || ep.Level != top)) {
+		rep.BadEntryPoint = true
+	}
+
+	if repair && !rep.OK() {
+		for _, b := range backLinks {
+			n := idx.nodes.get(b.from)
+			n.Neighbors[b.level] = append(n.Neighbors[b.level], b.to)
+			idx.nodes.put(n)
+		}
+		if rep.BadEntryPoint {
+			idx.entryPointID, idx.currentMaxLevel = 0, -1
+			for _, id := range idx.nodes.ids() {
+				if n := idx.nodes.get(id); n.Level > idx.currentMaxLevel || (n.Level == idx.currentMaxLevel && id < idx.entryPointID) {
+					idx.entryPointID, idx.currentMaxLevel = id, n.Level
+				}
+			}
+		}
+		idx.gen++
+	}
+	return rep
+}
+
+func linksTo(links []uint64, id uint64) bool {
+	for _, v := range links {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package index
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	vecs := newStore(t, rng, 200, 4)
+	idx := buildIndex(t, vecs)
+	if rep := idx.Verify(false); !rep.OK() || rep.Nodes != 200 {
+		t.Fatalf("Expected a healthy graph of 200 nodes, got %+v", rep)
+	}
+
+	// Break one of each invariant by hand, on nodes other than the entry
+	// point, which goes last.
+	ep := idx.entryPointID
+	var picked []uint64
+	for id := uint64(0); len(picked) < 3; id++ {
+		if id != ep && (len(picked) > 0 || idx.nodes.get(id).Neighbors[0][0] != ep) {
+			picked = append(picked, id)
+		}
+	}
+	a, c, d := idx.nodes.get(picked[0]), idx.nodes.get(picked[1]), idx.nodes.get(picked[2])
+	b := idx.nodes.get(a.Neighbors[0][0])
+	b.Neighbors[0] = removeID(b.Neighbors[0], a.ID)               // asymmetric
+	a.Neighbors[0] = append(a.Neighbors[0], 5000)                 // dangling
+	a.Neighbors[0] = append(a.Neighbors[0], a.ID)                 // duplicate
+	c.Neighbors = append(c.Neighbors, nil)                        // level mismatch
+	idx.nodes.put(&Node{ID: 9000, Neighbors: [][]uint64{{d.ID}}}) // no vector
+	d.Neighbors[0] = append(d.Neighbors[0], 9000)
+	idx.nodes.del(ep) // bad entry point (and its links dangle)
+
+	rep := idx.Verify(false)
+	if rep.OK() || rep.AsymmetricLinks == 0 || rep.DanglingLinks < 2 || rep.DuplicateLinks != 1 ||
+		rep.LevelMismatches != 1 || rep.NodesWithoutVectors != 1 || !rep.BadEntryPoint {
+		t.Fatalf("Expected every problem reported, got %+v", rep)
+	}
+	if again := idx.Verify(false); again != rep {
+		t.Errorf("Expected verification alone to change nothing, got %+v then %+v", rep, again)
+	}
+
+	gen := idx.Generation()
+	if fixed := idx.Verify(true); fixed != rep {
+		t.Errorf("Expected the repair to report what it found, got %+v", fixed)
+	}
+	if rep := idx.Verify(false); !rep.OK() || rep.Nodes != 199 {
+		t.Errorf("Expected a healthy graph after the repair, got %+v", rep)
+	}
+	if idx.Generation() == gen {
+		t.Error("Expected the repair to bump the generation")
+	}
+	if ids, _ := idx.Search(randomVector(rng, 4), 10); len(ids) != 10 {
+		t.Errorf("Expected the repaired graph to be searchable, got %v", ids)
+	}
+}
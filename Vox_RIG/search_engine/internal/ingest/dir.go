@@ -0,0 +1,157 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"vox-vector-engine/internal/ignore"
+)
+
+const (
+	// IgnoreFile lists gitignore-style patterns excluded from indexing, on top
+	// of any .gitignore files in the tree.
+	IgnoreFile = ".voxignore"
+
+	// MaxFileSize skips files larger than this (generated bundles, dumps).
+	MaxFileSize = 2 << 20
+)
+
+// DefaultIgnores are always excluded when crawling or watching a directory.
+var DefaultIgnores = []string{".git/", ".hg/", ".svn/", "node_modules/", ".vox/", "__pycache__/", IgnoreFile}
+
+// DirProgress is reported once per file visited by IndexDir.
+type DirProgress struct {
+	Done   int    // files handled so far, including this one
+	Total  int    // files found by the crawl
+	Path   string // relative path of this file
+	Status string // "indexed", "unchanged", "skipped" or "error"
+	Chunks int
+	Err    error
+}
+
+// DirResult summarises one IndexDir run.
+type DirResult struct {
+	Namespace string   `json:"namespace"`
+	Root      string   `json:"root"`
+	Files     int      `json:"files"`
+	Indexed   int      `json:"indexed"`
+	Unchanged int      `json:"unchanged"`
+	Skipped   int      `json:"skipped"`
+	Chunks    int      `json:"chunks"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// IndexDir walks root and indexes every text file into ns. Paths matched by
+// DefaultIgnores, root/.voxignore or any .gitignore in the tree are skipped,
+// as are binary files and files over MaxFileSize. Files whose stored version
+// is at least as new as the file on disk are left alone. progress, if not
+// nil, is called after every file.
+func (ix *Indexer) IndexDir(ctx context.Context, ns, root string, progress func(DirProgress)) (DirResult, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return DirResult{}, err
+	}
+	res := DirResult{Namespace: ns, Root: abs}
+	if fi, err := os.Stat(abs); err != nil || !fi.IsDir() {
+		return res, fmt.Errorf("not a directory: %s", root)
+	}
+	if ix.Embedder == nil {
+		return res, ErrNoEmbedder
+	}
+
+	files, err := crawl(abs)
+	if err != nil {
+		return res, err
+	}
+	res.Files = len(files)
+
+	for i, rel := range files {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		p := DirProgress{Done: i + 1, Total: len(files), Path: rel}
+		p.Status, p.Chunks, p.Err = ix.indexDirFile(ctx, ns, abs, rel)
+		switch p.Status {
+		case "indexed":
+			res.Indexed++
+			res.Chunks += p.Chunks
+		case "unchanged":
+			res.Unchanged++
+		case "skipped":
+			res.Skipped++
+		default:
+			res.Errors = append(res.Errors, fmt.Sprintf("%s: %v", rel, p.Err))
+		}
+		if progress != nil {
+			progress(p)
+		}
+	}
+	return res, nil
+}
+
+func (ix *Indexer) indexDirFile(ctx context.Context, ns, root, rel string) (string, int, error) {
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "error", 0, err
+	}
+	if fi.Size() > MaxFileSize {
+		return "skipped", 0, nil
+	}
+	if ix.IsCurrent(ns, rel, fi.ModTime()) {
+		return "unchanged", 0, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "error", 0, err
+	}
+	r, err := ix.IndexFile(ctx, ns, rel, content, fi.ModTime())
+	if err != nil {
+		return "error", 0, err
+	}
+	if r.Skipped != "" {
+		return "skipped", 0, nil
+	}
+	return "indexed", r.Chunks, nil
+}
+
+// crawl lists the regular files under root that are not ignored, as sorted
+// slash-separated relative paths. .gitignore files are loaded as their
+// directories are entered, so they only affect paths below them.
+func crawl(root string) ([]string, error) {
+	m := ignore.New()
+	for _, p := range DefaultIgnores {
+		m.AddPattern("", p)
+	}
+	if err := m.AddFile("", filepath.Join(root, IgnoreFile)); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // vanished or unreadable; skip
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == "." {
+				rel = ""
+			} else if m.Match(rel, true) {
+				return filepath.SkipDir
+			}
+			return m.AddFile(rel, filepath.Join(path, ".gitignore"))
+		}
+		if d.Type().IsRegular() && !m.Match(rel, false) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,87 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"vox-vector-engine/internal/engine"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCrawlRespectsIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":        "*.log\nbuild/\n",
+		"main.go":           "package main\n",
+		"debug.log":         "noise\n",
+		"build/out.txt":     "artifact\n",
+		"sub/.gitignore":    "secret.txt\n",
+		"sub/secret.txt":    "hidden\n",
+		"sub/readme.md":     "# sub\n",
+		"secret.txt":        "top-level secret is not covered by sub/.gitignore\n",
+		".git/HEAD":         "ref: refs/heads/main\n",
+		"node_modules/x.js": "x\n",
+		".voxignore":        "*.md\n!sub/readme.md\n",
+		"docs/skipped.md":   "# skipped\n",
+	})
+
+	files, err := crawl(root)
+	if err != nil {
+		t.Fatalf("crawl failed: %v", err)
+	}
+	want := []string{".gitignore", "main.go", "secret.txt", "sub/.gitignore", "sub/readme.md"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("crawl = %v, want %v", files, want)
+	}
+}
+
+func TestIndexDir(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.md":    "# A\n\nalpha\n",
+		"b.go":    "package b\n\nfunc B() {}\n",
+		"bin.dat": "\x00\x01\x02",
+	})
+
+	shards, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewShardManager failed: %v", err)
+	}
+	defer shards.Close()
+	ix := &Indexer{Resolve: shards.Get, Embedder: fakeEmbedder{}}
+
+	var seen []DirProgress
+	res, err := ix.IndexDir(context.Background(), "proj", root, func(p DirProgress) { seen = append(seen, p) })
+	if err != nil {
+		t.Fatalf("IndexDir failed: %v", err)
+	}
+	if res.Files != 3 || res.Indexed != 2 || res.Skipped != 1 || len(res.Errors) != 0 {
+		t.Errorf("IndexDir = %+v, want 3 files, 2 indexed, 1 skipped", res)
+	}
+	if len(seen) != 3 || seen[2].Done != 3 || seen[2].Total != 3 {
+		t.Errorf("Progress = %+v, want 3 reports ending at 3/3", seen)
+	}
+
+	res, err = ix.IndexDir(context.Background(), "proj", root, nil)
+	if err != nil {
+		t.Fatalf("Second IndexDir failed: %v", err)
+	}
+	if res.Unchanged != 2 || res.Indexed != 0 {
+		t.Errorf("Second IndexDir = %+v, want 2 unchanged", res)
+	}
+}
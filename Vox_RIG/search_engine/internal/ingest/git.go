@@ -0,0 +1,193 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ignore"
+)
+
+// gitCommitKey is the metadata state key holding the last indexed commit of a namespace.
+func gitCommitKey(ns string) string {
+	return "git_commit:" + ns
+}
+
+// GitResult summarises one ReindexGit run.
+type GitResult struct {
+	Namespace string   `json:"namespace"`
+	From      string   `json:"from,omitempty"` // previous indexed commit ("" on first run)
+	To        string   `json:"to"`
+	Indexed   int      `json:"indexed"`
+	Deleted   int      `json:"deleted"`
+	Skipped   int      `json:"skipped"`
+	Chunks    int      `json:"chunks"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// ReindexGit brings namespace ns up to date with HEAD of the git repository
+// at repo. On the first run every tracked file is indexed; afterwards only the
+// files reported by `git diff --name-status <last> HEAD` are re-chunked or
+// deleted. File contents are read from the commit, not the working tree. The
+// commit is recorded only if every file succeeded, so a failed run is retried
+// in full next time.
+func (ix *Indexer) ReindexGit(ctx context.Context, ns, repo string) (GitResult, error) {
+	res := GitResult{Namespace: ns}
+
+	top, err := git(ctx, repo, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return res, err
+	}
+	top = strings.TrimSpace(top)
+	head, err := git(ctx, top, "rev-parse", "HEAD")
+	if err != nil {
+		return res, err
+	}
+	res.To = strings.TrimSpace(head)
+
+	when := time.Now()
+	if ct, err := git(ctx, top, "log", "-1", "--format=%ct", res.To); err == nil {
+		if secs, err := strconv.ParseInt(strings.TrimSpace(ct), 10, 64); err == nil {
+			when = time.Unix(secs, 0)
+		}
+	}
+
+	sh, err := ix.resolveLocked(ns)
+	if err != nil {
+		return res, err
+	}
+	last, err := sh.Meta.GetState(gitCommitKey(ns))
+	if err != nil {
+		return res, err
+	}
+	res.From = last
+	if last == res.To {
+		return res, nil
+	}
+
+	ign := ignore.New()
+	if err := ign.AddFile("", filepath.Join(top, ".voxignore")); err != nil {
+		return res, err
+	}
+
+	var toIndex, toDelete []string
+	if last == "" {
+		out, err := git(ctx, top, "ls-tree", "-r", "--name-only", res.To)
+		if err != nil {
+			return res, err
+		}
+		toIndex = nonEmptyLines(out)
+	} else {
+		out, err := git(ctx, top, "diff", "--name-status", "-M", last, res.To)
+		if err != nil {
+			return res, fmt.Errorf("diff against last indexed commit %s: %w", last, err)
+		}
+		toIndex, toDelete = parseNameStatus(out)
+	}
+
+	for _, p := range toDelete {
+		n, err := ix.RemoveFile(ns, p)
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("delete %s: %v", p, err))
+			continue
+		}
+		res.Deleted++
+		res.Chunks += n
+	}
+
+	for _, p := range toIndex {
+		if ign.Match(p, false) {
+			res.Skipped++
+			continue
+		}
+		content, err := gitBlob(ctx, top, res.To, p)
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("read %s: %v", p, err))
+			continue
+		}
+		r, err := ix.IndexFile(ctx, ns, p, content, when)
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("index %s: %v", p, err))
+			continue
+		}
+		if r.Skipped != "" {
+			res.Skipped++
+			continue
+		}
+		res.Indexed++
+		res.Chunks += r.Chunks
+	}
+
+	if len(res.Errors) > 0 {
+		return res, fmt.Errorf("%d file(s) failed; last indexed commit left at %q", len(res.Errors), last)
+	}
+	defer ix.lock()()
+	if err := sh.Meta.SetState(gitCommitKey(ns), res.To); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func (ix *Indexer) resolveLocked(ns string) (*engine.Shard, error) {
+	defer ix.lock()()
+	return ix.Resolve(ns)
+}
+
+// parseNameStatus splits `git diff --name-status -M` output into paths to
+// (re)index and paths to delete. Renames delete the old path and index the new.
+func parseNameStatus(out string) (index, del []string) {
+	for _, line := range nonEmptyLines(out) {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		switch status := fields[0]; {
+		case strings.HasPrefix(status, "D"):
+			del = append(del, fields[1])
+		case strings.HasPrefix(status, "R") && len(fields) >= 3:
+			del = append(del, fields[1])
+			index = append(index, fields[2])
+		case strings.HasPrefix(status, "C") && len(fields) >= 3:
+			index = append(index, fields[2])
+		default: // A, M, T
+			index = append(index, fields[1])
+		}
+	}
+	return index, del
+}
+
+func nonEmptyLines(s string) []string {
+	var out []string
+	sc := bufio.NewScanner(strings.NewReader(s))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		if l := strings.TrimRight(sc.Text(), "\r"); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "core.quotepath=off"}, args...)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+func gitBlob(ctx context.Context, dir, commit, path string) ([]byte, error) {
+	out, err := git(ctx, dir, "show", commit+":"+path)
+	return []byte(out), err
+}
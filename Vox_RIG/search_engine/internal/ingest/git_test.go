@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/types"
+)
+
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Name() string { return "fake" }
+func (fakeEmbedder) Dim() int     { return 2 }
+func (fakeEmbedder) Embed(_ context.Context, texts []string) ([]types.Vector, error) {
+	out := make([]types.Vector, len(texts))
+	for i, t := range texts {
+		out[i] = types.Vector{float32(len(t)), 1}
+	}
+	return out, nil
+}
+
+func TestParseNameStatus(t *testing.T) {
+	out := "M\ta.go\nA\tb.md\nD\tc.txt\nR087\told.go\tnew.go\nC100\tsrc.go\tcopy.go\n"
+	index, del := parseNameStatus(out)
+	if want := []string{"a.go", "b.md", "new.go", "copy.go"}; !reflect.DeepEqual(index, want) {
+		t.Errorf("index = %v, want %v", index, want)
+	}
+	if want := []string{"c.txt", "old.go"}; !reflect.DeepEqual(del, want) {
+		t.Errorf("delete = %v, want %v", del, want)
+	}
+}
+
+func TestReindexGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+			"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "-q")
+	write("a.md", "# A\n\nalpha\n")
+	write("b.md", "# B\n\nbeta\n")
+	run("add", ".")
+	run("commit", "-q", "-m", "one")
+
+	shards, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewShardManager failed: %v", err)
+	}
+	defer shards.Close()
+	ix := &Indexer{Resolve: shards.Get, Embedder: fakeEmbedder{}}
+	ctx := context.Background()
+
+	res, err := ix.ReindexGit(ctx, "proj", repo)
+	if err != nil {
+		t.Fatalf("First ReindexGit failed: %v", err)
+	}
+	if res.From != "" || res.Indexed != 2 {
+		t.Errorf("First run = %+v, want 2 files indexed from scratch", res)
+	}
+
+	write("a.md", "# A\n\nalpha two\n")
+	run("rm", "-q", "b.md")
+	write("c.md", "# C\n\ngamma\n")
+	run("add", ".")
+	run("commit", "-q", "-m", "two")
+
+	res2, err := ix.ReindexGit(ctx, "proj", repo)
+	if err != nil {
+		t.Fatalf("Second ReindexGit failed: %v", err)
+	}
+	if res2.From != res.To || res2.Indexed != 2 || res2.Deleted != 1 {
+		t.Errorf("Second run = %+v, want 2 indexed and 1 deleted since %s", res2, res.To)
+	}
+
+	sh, _ := shards.Get("proj")
+	if _, err := sh.Meta.GetDocument(DocID("proj", "b.md")); err == nil {
+		t.Errorf("b.md should have been deleted")
+	}
+	if _, err := sh.Meta.GetDocument(DocID("proj", "c.md")); err != nil {
+		t.Errorf("c.md should have been indexed: %v", err)
+	}
+	if last, _ := sh.Meta.GetState(gitCommitKey("proj")); last != res2.To {
+		t.Errorf("Stored commit = %q, want %q", last, res2.To)
+	}
+
+	res3, err := ix.ReindexGit(ctx, "proj", repo)
+	if err != nil || res3.Indexed != 0 || res3.Deleted != 0 {
+		t.Errorf("Third run = %+v (err %v), want no-op", res3, err)
+	}
+}
@@ -0,0 +1,259 @@
+// Package ingest turns files on disk into stored, embedded chunks. It is the
+// shared pipeline behind the file watcher and the directory/git ingest commands.
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"vox-vector-engine/internal/chunker"
+	"vox-vector-engine/internal/embed"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/tokens"
+	"vox-vector-engine/internal/types"
+)
+
+// DefaultKeepVersions is how many prior versions of a re-indexed file the
+// servers and CLIs keep unless told otherwise (-keep_versions).
+const DefaultKeepVersions = 10
+
+// ErrNoEmbedder is returned when a file must be embedded but no provider is set.
+var ErrNoEmbedder = errors.New("no embedding provider configured (use -embed)")
+
+// Indexer chunks, embeds and stores whole files.
+type Indexer struct {
+	// Resolve returns the shard that stores namespace ns.
+	Resolve  func(ns string) (*engine.Shard, error)
+	Embedder embed.Provider
+	Tokens   tokens.Counter
+	Chunking chunker.Options
+	// Scrub redacts chunk content before it is embedded and stored.
+	Scrub scrub.Chain
+	// Guard, if set, is read-locked around every store update (the HTTP server
+	// passes its store lock so snapshots and restores see whole files).
+	Guard *sync.RWMutex
+	// KeepVersions is how many prior versions of a changed file stay
+	// searchable as <doc_id>@v<n> (see engine.ArchiveDocument); 0 replaces
+	// files in place.
+	KeepVersions int
+	// Normalize stores vectors scaled to unit length, keeping each chunk's
+	// original norm under engine.MetaNorm (see commands.Env.Normalize).
+	Normalize bool
+}
+
+// Result describes what IndexFile did with one file.
+type Result struct {
+	DocID  string `json:"doc_id"`
+	Chunks int    `json:"chunks"`
+	// Removed counts chunks of the previous version that were replaced.
+	Removed int `json:"removed,omitempty"`
+	// Version is the file's version number when KeepVersions is set.
+	Version int `json:"version,omitempty"`
+	// Skipped is set (with a reason) when the file was not indexed.
+	Skipped string `json:"skipped,omitempty"`
+	// Scrubbed reports what Indexer.Scrub redacted.
+	Scrubbed *scrub.Report `json:"scrubbed,omitempty"`
+}
+
+// DocID is the document ID of a file: "file:<namespace>:<relative path>".
+func DocID(ns, relPath string) string {
+	return ids.File(ns, relPath)
+}
+
+// IsBinary reports whether content looks like a binary file: a NUL byte or
+// invalid UTF-8 in the first 8 KiB.
+func IsBinary(content []byte) bool {
+	head := content
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	if len(head) < len(content) {
+		// Drop a multi-byte rune cut in half by the sniff boundary.
+		for i := 0; i < utf8.UTFMax && len(head) > 0; i++ {
+			if r, _ := utf8.DecodeLastRune(head); r != utf8.RuneError {
+				break
+			}
+			head = head[:len(head)-1]
+		}
+	}
+	return !utf8.Valid(head)
+}
+
+func (ix *Indexer) lock() func() {
+	if ix.Guard == nil {
+		return func() {}
+	}
+	ix.Guard.RLock()
+	return ix.Guard.RUnlock
+}
+
+// IsCurrent reports whether relPath is stored with a timestamp at or after modTime.
+func (ix *Indexer) IsCurrent(ns, relPath string, modTime time.Time) bool {
+	defer ix.lock()()
+	sh, err := ix.Resolve(ns)
+	if err != nil {
+		return false
+	}
+	doc, err := sh.Meta.GetDocument(DocID(ns, relPath))
+	if err != nil {
+		return false
+	}
+	return !doc.Timestamp.Before(modTime.UTC().Truncate(time.Second))
+}
+
+// IndexFile replaces every chunk of relPath with freshly chunked and embedded
+// content. Embedding happens before anything is deleted, so a failed embed
+// leaves the previous version searchable. With KeepVersions, a previous
+// version with different content is kept instead of deleted.
+func (ix *Indexer) IndexFile(ctx context.Context, ns, relPath string, content []byte, modTime time.Time) (Result, error) {
+	res := Result{DocID: DocID(ns, relPath)}
+	if IsBinary(content) {
+		res.Skipped = "binary"
+		return res, nil
+	}
+	if ix.Embedder == nil {
+		return res, ErrNoEmbedder
+	}
+
+	pieces := chunker.ForPath(relPath, ix.Chunking).Chunk(string(content))
+	texts := make([]string, len(pieces))
+	for i, p := range pieces {
+		texts[i] = p.Content
+	}
+	rep, err := ix.Scrub.Scrub(ctx, texts)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", relPath, err)
+	}
+	res.Scrubbed = rep
+
+	var vecs []types.Vector
+	if len(texts) > 0 {
+		vecs, err = ix.Embedder.Embed(ctx, texts)
+		if err != nil {
+			return res, fmt.Errorf("embed %s: %w", relPath, err)
+		}
+		if len(vecs) != len(texts) {
+			return res, fmt.Errorf("embed %s: got %d vectors for %d chunks", relPath, len(vecs), len(texts))
+		}
+	}
+
+	defer ix.lock()()
+
+	sh, err := ix.Resolve(ns)
+	if err != nil {
+		return res, err
+	}
+
+	// Tags are set by users, not derived from the file; keep them.
+	var tags []string
+	hash := ids.ContentHash(string(content))
+	version := 1
+	if prev, err := sh.Meta.GetDocument(res.DocID); err == nil {
+		tags = prev.Tags
+		version = engine.DocumentVersion(*prev)
+		if ix.KeepVersions > 0 && prev.Metadata["content_sha256"] != hash {
+			if version, err = sh.Engine.ArchiveDocument(res.DocID, ix.KeepVersions); err != nil {
+				return res, fmt.Errorf("archive previous %s: %w", res.DocID, err)
+			}
+		}
+	}
+	removed, err := sh.Engine.DeleteDocument(res.DocID)
+	if err != nil {
+		return res, fmt.Errorf("delete previous %s: %w", res.DocID, err)
+	}
+	res.Removed = removed
+
+	doc := types.Document{
+		ID:        res.DocID,
+		Source:    relPath,
+		Timestamp: modTime.UTC().Truncate(time.Second),
+		Metadata: types.Metadata{
+			"namespace":      ns,
+			"file_path":      relPath,
+			"type":           "code",
+			"content_sha256": hash,
+		},
+		Tags: tags,
+	}
+	tag := ix.Embedder.Name()
+	doc.Metadata[engine.MetaEmbeddingModel] = tag
+	if ix.KeepVersions > 0 {
+		doc.Metadata[engine.MetaVersion] = version
+		res.Version = version
+	}
+	chunks := make([]types.Chunk, 0, len(pieces))
+	for i, p := range pieces {
+		vec, norm := vecs[i], float32(0)
+		if ix.Normalize {
+			vec, norm = engine.Unit(vec)
+		}
+		id, err := sh.Vectors.Append(vec)
+		if err != nil {
+			return res, fmt.Errorf("append vector %s: %w", res.DocID, err)
+		}
+
+		chunk := types.Chunk{
+			ID:         id,
+			DocID:      res.DocID,
+			Vector:     vec,
+			Content:    texts[i],
+			StartLine:  p.StartLine,
+			EndLine:    p.EndLine,
+			TokenCount: ix.countTokens(texts[i]),
+		}
+		if p.Symbol != "" {
+			chunk.Metadata = types.Metadata{"symbol": p.Symbol, "kind": p.Kind}
+		}
+		if ix.Normalize {
+			chunk.Metadata = engine.WithNorm(chunk.Metadata, norm)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err := sh.Meta.SaveDocumentWithChunks(doc, chunks); err != nil {
+		return res, fmt.Errorf("save document %s: %w", res.DocID, err)
+	}
+	for _, c := range chunks {
+		sh.Index.Add(c.ID, c.Vector)
+	}
+	res.Chunks = len(chunks)
+	if cur, err := sh.Engine.ClaimModelTag(ns, tag); err != nil {
+		log.Printf("[model] namespace=%s: recording embedding model %q failed: %v", ns, tag, err)
+	} else if cur != tag {
+		log.Printf("[model] namespace=%s was ingested with %q, %s is embedded with %q", ns, cur, relPath, tag)
+	}
+	if w := sh.Engine.ObserveVectors(ns, chunks); w != nil {
+		log.Printf("[drift] namespace=%s file=%s: %s", ns, relPath, w.Message)
+	}
+	if _, err := sh.Engine.EnforceQuota(ns); err != nil {
+		log.Printf("[quota] namespace=%s enforcement failed: %v", ns, err)
+	}
+	return res, nil
+}
+
+// RemoveFile deletes the document of relPath and its chunks.
+func (ix *Indexer) RemoveFile(ns, relPath string) (int, error) {
+	defer ix.lock()()
+	sh, err := ix.Resolve(ns)
+	if err != nil {
+		return 0, err
+	}
+	return sh.Engine.DeleteDocument(DocID(ns, relPath))
+}
+
+func (ix *Indexer) countTokens(text string) int {
+	if ix.Tokens == nil {
+		return tokens.Heuristic().Count(text)
+	}
+	return ix.Tokens.Count(text)
+}
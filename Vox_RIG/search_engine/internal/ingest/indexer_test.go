@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ids"
+	"vox-vector-engine/internal/types"
+)
+
+func TestIndexFileVersions(t *testing.T) {
+	shards, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewShardManager failed: %v", err)
+	}
+	defer shards.Close()
+	ix := &Indexer{Resolve: shards.Get, Embedder: fakeEmbedder{}, KeepVersions: 2}
+
+	now := time.Now()
+	for i, content := range []string{"one\n", "two two\n", "three three\n", "four four four\n", "four four four\n"} {
+		res, err := ix.IndexFile(context.Background(), "proj", "a.txt", []byte(content), now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatalf("IndexFile failed: %v", err)
+		}
+		if want := min(i+1, 4); res.Version != want {
+			t.Errorf("Expected version %d after write %d (unchanged content is not a new version), got %d", want, i+1, res.Version)
+		}
+	}
+
+	sh, _ := shards.Get("proj")
+	docID := DocID("proj", "a.txt")
+	versions, err := sh.Engine.DocumentVersions("proj", docID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range versions {
+		got = append(got, d.ID)
+	}
+	want := []string{docID, ids.Version(docID, 3), ids.Version(docID, 2)}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("Expected versions %v (v1 pruned), got %v", want, got)
+	}
+	if chunks, _ := sh.Meta.DocumentChunks(ids.Version(docID, 3)); len(chunks) != 1 || chunks[0].Content != "three three" {
+		t.Errorf("Expected v3 to keep its chunk, got %+v", chunks)
+	}
+
+	cfg := engine.RetrievalConfig{MaxTokens: 1000, SimilarityWeight: 1, TopKCandidates: 10, Namespace: "proj"}
+	query := types.Vector{15, 1}
+	res, err := sh.Engine.Retrieve(query, cfg)
+	if err != nil || len(res.Chunks) != 1 || res.Chunks[0].Chunk.DocID != docID {
+		t.Fatalf("Expected only the latest version retrieved, got %+v, %v", res, err)
+	}
+	cfg.IncludeVersions = true
+	if res, _ := sh.Engine.Retrieve(query, cfg); len(res.Chunks) != 3 {
+		t.Errorf("Expected every kept version with include_versions, got %+v", res.Chunks)
+	}
+}
@@ -0,0 +1,415 @@
+// Package jobs runs long operations (large ingests, directory indexing,
+// compaction, namespace purges, index rebuilds) in the background and keeps
+// a record of each, with its progress, so a client that got 202 Accepted can
+// poll GET /jobs/{id} and cancel it with DELETE /jobs/{id}.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is where a job is in its life.
+type Status string
+
+const (
+	Queued   Status = "queued"
+	Running  Status = "running"
+	Done     Status = "done"
+	Failed   Status = "failed"
+	Canceled Status = "canceled"
+)
+
+// Finished reports whether a job in status st has ended.
+func (st Status) Finished() bool {
+	return st == Done || st == Failed || st == Canceled
+}
+
+// Defaults for zero Queue fields.
+const (
+	DefaultWorkers = 2
+	DefaultBacklog = 64
+	DefaultKeep    = 1000
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the backlog is at capacity;
+	// the client should retry later.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrClosed is returned by Submit and Start after Close.
+	ErrClosed = errors.New("job queue is closed")
+	// ErrNotFound is returned by Cancel for an unknown job.
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned by Cancel for a job that has already ended.
+	ErrFinished = errors.New("job already finished")
+)
+
+// Job is the record of one background operation.
+type Job struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Namespace string     `json:"namespace,omitempty"`
+	Status    Status     `json:"status"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	// Progress is the share of the work done, in percent; jobs that cannot
+	// tell stay at 0 until they finish at 100.
+	Progress float64 `json:"progress"`
+	// Result is what the operation returned once Done; Error why it Failed.
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Func is the work of a job. It should return soon after ctx is canceled
+// and may report progress with SetProgress.
+type Func func(ctx context.Context) (any, error)
+
+type entry struct {
+	job    Job
+	fn     Func
+	cancel context.CancelFunc
+}
+
+// Queue runs submitted jobs on a fixed number of workers, holding at most
+// Backlog jobs that wait for one. The zero value is usable; workers start
+// on the first Submit, so the fields may be set until then.
+type Queue struct {
+	// Workers run queued jobs (DefaultWorkers when 0).
+	Workers int
+	// Backlog is how many jobs may wait for a worker (DefaultBacklog when 0).
+	Backlog int
+	// Keep is how many finished jobs are remembered (DefaultKeep when 0).
+	Keep int
+
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	closed   bool
+	work     chan *entry // nil until the first Submit
+	jobs     map[string]*entry
+	finished []string // IDs in the order they finished
+	// path, when set, receives every record after each change of status
+	// (see Persist).
+	path string
+}
+
+// NewQueue returns a queue of workers workers (at least one) holding up to
+// backlog waiting jobs.
+func NewQueue(workers, backlog int) *Queue {
+	return &Queue{Workers: max(workers, 1), Backlog: max(backlog, 1)}
+}
+
+// startLocked starts the workers on first use.
+func (q *Queue) startLocked() {
+	if q.work != nil {
+		return
+	}
+	backlog := q.Backlog
+	if backlog <= 0 {
+		backlog = DefaultBacklog
+	}
+	workers := q.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	q.work = make(chan *entry, backlog)
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// Persist loads the records kept in the JSON file path, if any, and saves
+// every record there from now on, so finished jobs survive a restart. Jobs
+// that were queued or running when the process stopped are recorded as
+// failed.
+func (q *Queue) Persist(path string) error {
+	var saved []Job
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.jobs == nil {
+		q.jobs = map[string]*entry{}
+	}
+	sort.Slice(saved, func(i, j int) bool { return finishedAt(saved[i]).Before(finishedAt(saved[j])) })
+	for _, job := range saved {
+		if _, ok := q.jobs[job.ID]; ok {
+			continue
+		}
+		if !job.Status.Finished() {
+			at := time.Now().UTC()
+			job.Status, job.Error, job.Finished = Failed, "interrupted by a restart", &at
+		}
+		q.jobs[job.ID] = &entry{job: job}
+		q.finished = append(q.finished, job.ID)
+	}
+	q.pruneLocked()
+	q.path = path
+	return q.saveLocked()
+}
+
+func finishedAt(job Job) time.Time {
+	if job.Finished != nil {
+		return *job.Finished
+	}
+	return job.Submitted
+}
+
+// Submit queues fn and returns its record without waiting. It fails with
+// ErrQueueFull when the backlog is at capacity.
+func (q *Queue) Submit(kind, ns string, fn Func) (Job, error) {
+	e := q.newEntry(kind, ns, fn)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Job{}, ErrClosed
+	}
+	q.startLocked()
+	select {
+	case q.work <- e:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.addLocked(e)
+	return e.job, nil
+}
+
+// Start runs fn at once on a goroutine of its own, outside the workers and
+// the backlog, for work that must not wait behind other jobs (the index
+// rebuild at startup).
+func (q *Queue) Start(kind, ns string, fn Func) (Job, error) {
+	e := q.newEntry(kind, ns, fn)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Job{}, ErrClosed
+	}
+	q.addLocked(e)
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		q.run(e)
+	}()
+	return e.job, nil
+}
+
+func (q *Queue) newEntry(kind, ns string, fn Func) *entry {
+	return &entry{job: Job{ID: newID(), Kind: kind, Namespace: ns, Status: Queued, Submitted: time.Now().UTC()}, fn: fn}
+}
+
+func (q *Queue) addLocked(e *entry) {
+	if q.jobs == nil {
+		q.jobs = map[string]*entry{}
+	}
+	q.jobs[e.job.ID] = e
+	q.saveLocked()
+}
+
+// Get returns the record of job id.
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job, true
+}
+
+// List returns every remembered job, newest first.
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	out := make([]Job, 0, len(q.jobs))
+	for _, e := range q.jobs {
+		out = append(out, e.job)
+	}
+	q.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Submitted.After(out[j].Submitted) })
+	return out
+}
+
+// Cancel stops job id: a queued job is canceled at once, a running one is
+// asked to stop through its context and is marked canceled when it returns.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.jobs[id]
+	switch {
+	case !ok:
+		return Job{}, ErrNotFound
+	case e.job.Status.Finished():
+		return e.job, ErrFinished
+	case e.job.Status == Queued:
+		q.finishLocked(e, nil, context.Canceled)
+	case e.cancel != nil:
+		e.cancel()
+	}
+	return e.job, nil
+}
+
+// Pending returns how many jobs wait for a worker.
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.work)
+}
+
+// Close stops accepting jobs, fails the ones still waiting, cancels the
+// running ones and waits for them to return.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	if q.work != nil {
+		close(q.work)
+	}
+	for _, e := range q.jobs {
+		if e.cancel != nil {
+			e.cancel()
+		}
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for e := range q.work {
+		q.run(e)
+	}
+}
+
+// progressKey carries the entry of the running job in its context.
+type progressKey struct{}
+
+// SetProgress records the fraction (0 to 1) of the job running under ctx
+// that is complete; a no-op outside a job.
+func SetProgress(ctx context.Context, fraction float64) {
+	p, ok := ctx.Value(progressKey{}).(*progress)
+	if !ok {
+		return
+	}
+	p.q.mu.Lock()
+	defer p.q.mu.Unlock()
+	p.e.job.Progress = max(0, min(100, 100*fraction))
+}
+
+type progress struct {
+	q *Queue
+	e *entry
+}
+
+func (q *Queue) run(e *entry) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q.mu.Lock()
+	if e.job.Status != Queued {
+		// Canceled while it waited.
+		q.mu.Unlock()
+		return
+	}
+	if q.closed {
+		q.finishLocked(e, nil, errors.New("server shutting down"))
+		q.mu.Unlock()
+		return
+	}
+	now := time.Now().UTC()
+	e.job.Status, e.job.Started, e.cancel = Running, &now, cancel
+	q.saveLocked()
+	q.mu.Unlock()
+
+	res, err := e.fn(context.WithValue(ctx, progressKey{}, &progress{q, e}))
+	if ctx.Err() != nil && err != nil {
+		err = context.Canceled
+	}
+	q.mu.Lock()
+	q.finishLocked(e, res, err)
+	q.mu.Unlock()
+}
+
+func (q *Queue) finishLocked(e *entry, res any, err error) {
+	now := time.Now().UTC()
+	e.job.Finished, e.cancel = &now, nil
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.job.Status = Canceled
+	case err != nil:
+		e.job.Status, e.job.Error = Failed, err.Error()
+	default:
+		e.job.Status, e.job.Result, e.job.Progress = Done, res, 100
+	}
+	q.finished = append(q.finished, e.job.ID)
+	q.pruneLocked()
+	q.saveLocked()
+}
+
+func (q *Queue) pruneLocked() {
+	keep := q.Keep
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	for len(q.finished) > keep {
+		delete(q.jobs, q.finished[0])
+		q.finished = q.finished[1:]
+	}
+}
+
+// saveLocked writes every record to q.path (write, then rename), logging
+// nothing: a failed save only loses history.
+func (q *Queue) saveLocked() error {
+	if q.path == "" {
+		return nil
+	}
+	all := make([]Job, 0, len(q.jobs))
+	for _, e := range q.jobs {
+		all = append(all, e.job)
+	}
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), ".jobs-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
+
+func newID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(1, 1)
+	q.Keep = 1
+	block, started := make(chan struct{}), make(chan struct{})
+
+	first, err := q.Submit("test", "ns", func(context.Context) (any, error) {
+		close(started)
+		<-block
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	<-started
+	if job, _ := q.Get(first.ID); job.Status != Running || job.Started == nil {
+		t.Errorf("Expected the first job running, got %+v", job)
+	}
+
+	second, err := q.Submit("test", "ns", func(context.Context) (any, error) { return nil, errors.New("boom") })
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if _, err := q.Submit("test", "ns", func(context.Context) (any, error) { return nil, nil }); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull with a full backlog, got %v", err)
+	}
+
+	close(block)
+	for {
+		if job, _ := q.Get(second.ID); job.Finished != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.Close()
+	if job, ok := q.Get(second.ID); !ok || job.Status != Failed || job.Error != "boom" {
+		t.Errorf("Expected the second job failed with boom, got %+v", job)
+	}
+	// Keep = 1: the first job has been forgotten.
+	if _, ok := q.Get(first.ID); ok {
+		t.Error("Expected the oldest finished job to be dropped")
+	}
+	if _, err := q.Submit("test", "ns", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	q := NewQueue(1, 2)
+	defer q.Close()
+	started, progressed := make(chan struct{}), make(chan struct{})
+
+	running, err := q.Submit("test", "", func(ctx context.Context) (any, error) {
+		close(started)
+		SetProgress(ctx, 0.25)
+		close(progressed)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	waiting, err := q.Submit("test", "", func(context.Context) (any, error) {
+		t.Error("Expected a canceled job never to run")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	<-started
+	<-progressed
+	if job, _ := q.Get(running.ID); job.Progress != 25 {
+		t.Errorf("Expected progress 25, got %v", job.Progress)
+	}
+
+	if job, err := q.Cancel(waiting.ID); err != nil || job.Status != Canceled {
+		t.Errorf("Expected the queued job canceled at once, got %+v %v", job, err)
+	}
+	if _, err := q.Cancel(running.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	for {
+		if job, _ := q.Get(running.ID); job.Status.Finished() {
+			if job.Status != Canceled {
+				t.Errorf("Expected the running job canceled, got %+v", job)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := q.Cancel(running.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Expected ErrFinished for a finished job, got %v", err)
+	}
+	if _, err := q.Cancel("nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown job, got %v", err)
+	}
+	if list := q.List(); len(list) != 2 || list[0].ID != waiting.ID {
+		t.Errorf("Expected both jobs listed newest first, got %+v", list)
+	}
+}
+
+func TestQueuePersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+
+	q := &Queue{}
+	if err := q.Persist(path); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	block := make(chan struct{})
+	done, _ := q.Start("test", "ns", func(context.Context) (any, error) { return 7, nil })
+	for {
+		if job, _ := q.Get(done.ID); job.Status.Finished() {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	running, _ := q.Start("test", "ns", func(context.Context) (any, error) {
+		<-block
+		return nil, nil
+	})
+	// Simulate a crash: reload the file while the second job still runs.
+	q2 := &Queue{}
+	if err := q2.Persist(path); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	close(block)
+	q.Close()
+
+	if job, ok := q2.Get(done.ID); !ok || job.Status != Done || job.Progress != 100 {
+		t.Errorf("Expected the finished job to survive a restart, got %+v", job)
+	}
+	if job, ok := q2.Get(running.ID); !ok || job.Status != Failed || job.Error == "" {
+		t.Errorf("Expected the interrupted job to be failed, got %+v", job)
+	}
+}
@@ -0,0 +1,100 @@
+package listen
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiscoveryFile is the file in the data directory that tells local clients
+// where the engine listens, so an IDE need not assume port 8080.
+const DiscoveryFile = "engine.json"
+
+// Discovery is the content of DiscoveryFile.
+type Discovery struct {
+	PID int `json:"pid"`
+	// Addr is where the server actually listens: host:port for TCP, the
+	// -listen spec for sockets and pipes.
+	Addr string `json:"addr"`
+	// URL is the base URL of a TCP listener, with a wildcard host replaced
+	// by the loopback address.
+	URL string `json:"url,omitempty"`
+	// Token is the bearer token of -auth_token.
+	Token   string    `json:"token,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+// NewDiscovery describes ln, opened from spec.
+func NewDiscovery(spec string, ln net.Listener, tls bool, token string) Discovery {
+	d := Discovery{PID: os.Getpid(), Addr: spec, Token: token, Started: time.Now().UTC()}
+	tcp, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		return d
+	}
+	d.Addr = tcp.String()
+	host := tcp.IP.String()
+	if tcp.IP == nil || tcp.IP.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	d.URL = scheme + "://" + net.JoinHostPort(host, strconv.Itoa(tcp.Port))
+	return d
+}
+
+// WriteDiscovery writes d to dir's DiscoveryFile, readable only by the
+// current user as it holds the token.
+func WriteDiscovery(dir string, d Discovery) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, DiscoveryFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RemoveDiscovery removes dir's DiscoveryFile on shutdown.
+func RemoveDiscovery(dir string) error {
+	err := os.Remove(filepath.Join(dir, DiscoveryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ListenFallback is Listen, except that when the port of a TCP address is
+// taken it listens on a free port of the same host instead; fellBack reports
+// whether it did. Port 0 always picks a free port.
+func ListenFallback(spec string) (ln net.Listener, fellBack bool, err error) {
+	ln, err = Listen(spec)
+	if err == nil || !isAddrInUse(err) {
+		return ln, false, err
+	}
+	addr := spec
+	if scheme, rest, ok := strings.Cut(spec, "://"); ok {
+		if scheme != "tcp" {
+			return nil, false, err
+		}
+		addr = rest
+	}
+	host, _, serr := net.SplitHostPort(addr)
+	if serr != nil {
+		return nil, false, err
+	}
+	ln, ferr := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if ferr != nil {
+		return nil, false, err
+	}
+	return ln, true, nil
+}
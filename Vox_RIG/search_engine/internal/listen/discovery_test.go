@@ -0,0 +1,49 @@
+package listen
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenFallback(t *testing.T) {
+	taken, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer taken.Close()
+
+	ln, fellBack, err := ListenFallback(taken.Addr().String())
+	if err != nil || !fellBack {
+		t.Fatalf("Expected a fallback to a free port, got %v (fell back: %v)", err, fellBack)
+	}
+	defer ln.Close()
+	if ln.Addr().String() == taken.Addr().String() {
+		t.Errorf("Expected a different port than %s", taken.Addr())
+	}
+
+	dir := t.TempDir()
+	d := NewDiscovery(":0", ln, false, "secret")
+	if d.Addr != ln.Addr().String() || !strings.HasPrefix(d.URL, "http://127.0.0.1:") || d.PID != os.Getpid() {
+		t.Errorf("Unexpected discovery %+v", d)
+	}
+	if err := WriteDiscovery(dir, d); err != nil {
+		t.Fatalf("WriteDiscovery failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, DiscoveryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Discovery
+	if err := json.Unmarshal(data, &got); err != nil || got.URL != d.URL || got.Token != "secret" {
+		t.Errorf("Unexpected discovery file %s (%v)", data, err)
+	}
+	if err := RemoveDiscovery(dir); err != nil {
+		t.Errorf("RemoveDiscovery failed: %v", err)
+	}
+	if err := RemoveDiscovery(dir); err != nil {
+		t.Errorf("Expected removing a missing file to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package listen
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+func isAddrInUse(err error) bool {
+	return errors.Is(err, windows.WSAEADDRINUSE)
+}
@@ -0,0 +1,79 @@
+// Package listen opens the server's listening socket from a -listen spec:
+//
+//	tcp://127.0.0.1:8080 or 127.0.0.1:8080  TCP
+//	unix:///tmp/vox.sock                   Unix domain socket (mode 0600)
+//	npipe:////./pipe/vox or npipe://vox    Windows named pipe (current user only)
+//
+// Sockets and pipes let the IDE reach the engine without a TCP port, and
+// leave access control to filesystem permissions or the pipe's ACL.
+// WrapTLS adds HTTPS, and optionally mutual TLS, for shared deployments.
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Listen opens the listener described by spec.
+func Listen(spec string) (net.Listener, error) {
+	scheme, rest, ok := strings.Cut(spec, "://")
+	if !ok {
+		return net.Listen("tcp", spec)
+	}
+	switch scheme {
+	case "tcp":
+		return net.Listen("tcp", rest)
+	case "unix":
+		return listenUnix(rest)
+	case "npipe":
+		return listenPipe(PipeName(rest))
+	default:
+		return nil, fmt.Errorf("unsupported listen scheme %q (want tcp, unix or npipe)", scheme)
+	}
+}
+
+// PipeName turns the path of an npipe:// URL into a Windows pipe name:
+// "//./pipe/vox" becomes `\\.\pipe\vox`, and a bare "vox" is taken as a
+// local pipe name.
+func PipeName(path string) string {
+	name := strings.ReplaceAll(path, "/", `\`)
+	if strings.HasPrefix(name, `\\`) {
+		return name
+	}
+	return `\\.\pipe\` + strings.TrimLeft(name, `\`)
+}
+
+// listenUnix listens on a Unix socket readable only by the current user. A
+// stale socket file left by a crashed server is removed; a live one is an
+// error so two servers never share a path.
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("unix listen address needs a socket path")
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return l, nil
+}
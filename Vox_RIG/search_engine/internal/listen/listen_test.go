@@ -0,0 +1,68 @@
+//go:build !windows
+
+package listen
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPipeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"//./pipe/vox": `\\.\pipe\vox`,
+		"vox":          `\\.\pipe\vox`,
+		"/vox":         `\\.\pipe\vox`,
+	} {
+		if got := PipeName(in); got != want {
+			t.Errorf("PipeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vox.sock")
+	l, err := Listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Socket missing: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected socket mode 0600, got %o", perm)
+	}
+
+	if _, err := Listen("unix://" + path); err == nil {
+		t.Errorf("Expected an error listening on a socket in use")
+	}
+
+	// A socket file left behind by a crashed server is replaced.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = Listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced, got %v", err)
+	}
+	l.Close()
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("unix://" + path); err == nil {
+		t.Errorf("Expected an error when the path is a regular file")
+	}
+}
+
+func TestListenScheme(t *testing.T) {
+	if _, err := Listen("udp://127.0.0.1:0"); err == nil {
+		t.Errorf("Expected an error for an unsupported scheme")
+	}
+	l, err := Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen tcp failed: %v", err)
+	}
+	l.Close()
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package listen
+
+import (
+	"errors"
+	"net"
+)
+
+func listenPipe(name string) (net.Listener, error) {
+	return nil, errors.New("named pipes are only supported on Windows; use unix:// instead")
+}
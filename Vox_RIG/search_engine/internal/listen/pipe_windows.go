@@ -0,0 +1,340 @@
+//go:build windows
+
+package listen
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const pipeBufferSize = 64 << 10
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeListener accepts connections on a named pipe. One instance is always
+// created ahead of Accept so the name is claimed for the server's lifetime.
+type pipeListener struct {
+	name string
+	sa   *windows.SecurityAttributes
+	done windows.Handle // manual-reset event set by Close
+
+	mu     sync.Mutex
+	next   windows.Handle
+	closed bool
+	active sync.WaitGroup
+}
+
+func listenPipe(name string) (net.Listener, error) {
+	sa, err := currentUserOnly()
+	if err != nil {
+		return nil, err
+	}
+	done, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	l := &pipeListener{name: name, sa: sa, done: done}
+	if l.next, err = l.create(true); err != nil {
+		windows.CloseHandle(done)
+		return nil, err
+	}
+	return l, nil
+}
+
+// currentUserOnly grants the pipe to SYSTEM and the user running the server,
+// so other accounts on the machine cannot connect.
+func currentUserOnly() (*windows.SecurityAttributes, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;SY)(A;;GA;;;" + user.User.Sid.String() + ")")
+	if err != nil {
+		return nil, err
+	}
+	return &windows.SecurityAttributes{
+		Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+		SecurityDescriptor: sd,
+	}, nil
+}
+
+func (l *pipeListener) create(first bool) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.name)
+	if err != nil {
+		return 0, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	return windows.CreateNamedPipe(name, flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, l.sa)
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := l.next
+	l.next = 0
+	l.active.Add(1)
+	l.mu.Unlock()
+	defer l.active.Done()
+
+	var err error
+	if h == 0 {
+		if h, err = l.create(false); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.connect(h); err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	return newPipeConn(h, l.name)
+}
+
+// connect waits for a client on h, or for Close.
+func (l *pipeListener) connect(h windows.Handle) error {
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(ev)
+
+	ov := windows.Overlapped{HEvent: ev}
+	switch err := windows.ConnectNamedPipe(h, &ov); err {
+	case nil, windows.ERROR_PIPE_CONNECTED:
+		return nil
+	case windows.ERROR_IO_PENDING:
+	default:
+		return err
+	}
+
+	ret, err := windows.WaitForMultipleObjects([]windows.Handle{ev, l.done}, false, windows.INFINITE)
+	var n uint32
+	if err != nil || ret != windows.WAIT_OBJECT_0 {
+		windows.CancelIoEx(h, &ov)
+		windows.GetOverlappedResult(h, &ov, &n, true)
+		if err != nil {
+			return err
+		}
+		return net.ErrClosed
+	}
+	return windows.GetOverlappedResult(h, &ov, &n, false)
+}
+
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	if l.next != 0 {
+		windows.CloseHandle(l.next)
+		l.next = 0
+	}
+	l.mu.Unlock()
+
+	windows.SetEvent(l.done)
+	l.active.Wait()
+	return windows.CloseHandle(l.done)
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr(l.name) }
+
+// deadline is one direction's I/O deadline. wake is an auto-reset event
+// signalled whenever the deadline changes, so a pending operation can
+// re-check it (net/http aborts background reads with a past deadline).
+type deadline struct {
+	mu   sync.Mutex
+	t    time.Time
+	wake windows.Handle
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	d.t = t
+	d.mu.Unlock()
+	windows.SetEvent(d.wake)
+}
+
+// wait returns the milliseconds left before the deadline, or false once it
+// has passed.
+func (d *deadline) wait() (uint32, bool) {
+	d.mu.Lock()
+	t := d.t
+	d.mu.Unlock()
+	if t.IsZero() {
+		return windows.INFINITE, true
+	}
+	left := time.Until(t)
+	if left <= 0 {
+		return 0, false
+	}
+	ms := (left + time.Millisecond - 1) / time.Millisecond
+	if ms >= windows.INFINITE {
+		ms = windows.INFINITE - 1
+	}
+	return uint32(ms), true
+}
+
+// pipeConn is the server end of one connected pipe instance, using
+// overlapped I/O so reads and writes can run concurrently and honour
+// deadlines.
+type pipeConn struct {
+	h      windows.Handle
+	name   string
+	rd, wd deadline
+
+	mu     sync.Mutex
+	closed bool
+	active sync.WaitGroup
+}
+
+func newPipeConn(h windows.Handle, name string) (*pipeConn, error) {
+	c := &pipeConn{h: h, name: name}
+	var err error
+	if c.rd.wake, err = windows.CreateEvent(nil, 0, 0, nil); err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	if c.wd.wake, err = windows.CreateEvent(nil, 0, 0, nil); err != nil {
+		windows.CloseHandle(c.rd.wake)
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	return c, nil
+}
+
+// do runs one overlapped operation, cancelling it when the deadline passes
+// or the connection is closed.
+func (c *pipeConn) do(d *deadline, op func(*windows.Overlapped, *uint32) error) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	c.active.Add(1)
+	c.mu.Unlock()
+	defer c.active.Done()
+
+	if _, ok := d.wait(); !ok {
+		return 0, os.ErrDeadlineExceeded
+	}
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(ev)
+
+	ov := windows.Overlapped{HEvent: ev}
+	var n uint32
+	err = op(&ov, &n)
+	if err != windows.ERROR_IO_PENDING {
+		return int(n), err
+	}
+	for {
+		ms, ok := d.wait()
+		if ok {
+			ret, werr := windows.WaitForMultipleObjects([]windows.Handle{ev, d.wake}, false, ms)
+			if werr == nil && ret == windows.WAIT_OBJECT_0 {
+				return int(n), windows.GetOverlappedResult(c.h, &ov, &n, false)
+			}
+			if werr == nil && ret != uint32(windows.WAIT_TIMEOUT) {
+				continue // deadline changed or connection closing; re-check
+			}
+			err = werr
+		}
+		windows.CancelIoEx(c.h, &ov)
+		if windows.GetOverlappedResult(c.h, &ov, &n, true) == nil {
+			return int(n), nil // completed before the cancel took effect
+		}
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		switch {
+		case closed:
+			return int(n), net.ErrClosed
+		case err != nil:
+			return int(n), err
+		default:
+			return int(n), os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	n, err := c.do(&c.rd, func(ov *windows.Overlapped, n *uint32) error {
+		return windows.ReadFile(c.h, b, n, ov)
+	})
+	if errors.Is(err, windows.ERROR_BROKEN_PIPE) || errors.Is(err, windows.ERROR_PIPE_NOT_CONNECTED) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := c.do(&c.wd, func(ov *windows.Overlapped, n *uint32) error {
+			return windows.WriteFile(c.h, b[written:], n, ov)
+		})
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	windows.CancelIoEx(c.h, nil)
+	windows.SetEvent(c.rd.wake)
+	windows.SetEvent(c.wd.wake)
+	c.active.Wait()
+	windows.CloseHandle(c.rd.wake)
+	windows.CloseHandle(c.wd.wake)
+	return windows.CloseHandle(c.h)
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr(c.name) }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr(c.name) }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.rd.set(t)
+	c.wd.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.rd.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.wd.set(t)
+	return nil
+}
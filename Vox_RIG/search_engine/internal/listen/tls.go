@@ -0,0 +1,64 @@
+package listen
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// TLSOptions configure HTTPS on the listener. ClientCA turns on mutual TLS:
+// clients must present a certificate signed by one of its CAs.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	ClientCA string
+}
+
+// Enabled reports whether any TLS option is set.
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.ClientCA != ""
+}
+
+// Config builds the server TLS configuration.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, errors.New("TLS needs both a certificate and a key")
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.ClientCA != "" {
+		pem, err := os.ReadFile(o.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.ClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// WrapTLS returns l serving TLS as configured by o, or l itself when o is
+// empty.
+func WrapTLS(l net.Listener, o TLSOptions) (net.Listener, error) {
+	if !o.Enabled() {
+		return l, nil
+	}
+	cfg, err := o.Config()
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(l, cfg), nil
+}
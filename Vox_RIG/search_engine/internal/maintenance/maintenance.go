@@ -0,0 +1,244 @@
+// Package maintenance runs housekeeping (chat compaction, rolling summaries,
+// snapshots, index rebuilds) in a window of idle hours given by a cron
+// schedule, instead of waiting for someone to trigger each one. A task only
+// starts once no query has arrived for a while, and is cancelled when one
+// does; it starts over after the next quiet spell, until the window closes.
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindow is how long a maintenance window stays open.
+	DefaultWindow = time.Hour
+	// DefaultQuiet is how long no query may arrive before a task starts.
+	DefaultQuiet = time.Minute
+)
+
+// Task is one maintenance operation. Run should return soon after ctx is
+// cancelled; a task that ignores ctx finishes before the next one starts.
+type Task struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Task outcomes in a TaskReport.
+const (
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+	TaskSkipped = "skipped" // the window closed before it could finish
+)
+
+// TaskReport is what became of one task in a window.
+type TaskReport struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Pauses counts the runs cut short by query traffic.
+	Pauses    int     `json:"pauses,omitempty"`
+	ElapsedMS float64 `json:"elapsed_ms"`
+}
+
+// Report describes one maintenance window.
+type Report struct {
+	Start time.Time    `json:"start"`
+	End   time.Time    `json:"end"`
+	Tasks []TaskReport `json:"tasks"`
+}
+
+// Status is the state of a Scheduler, as served by GET /maintenance.
+type Status struct {
+	Schedule string   `json:"schedule"`
+	WindowMS float64  `json:"window_ms"`
+	QuietMS  float64  `json:"quiet_ms"`
+	Tasks    []string `json:"tasks"`
+	// Next is when the next window opens; zero while one is open.
+	Next time.Time `json:"next,omitempty"`
+	// Open is set during a window; Current names the task being run or
+	// waiting for quiet, and Paused is set while it waits after a query.
+	Open    bool    `json:"open"`
+	Current string  `json:"current,omitempty"`
+	Paused  bool    `json:"paused,omitempty"`
+	Last    *Report `json:"last,omitempty"`
+}
+
+// Scheduler opens a maintenance window at every time Schedule matches and
+// runs Tasks in order inside it.
+type Scheduler struct {
+	Schedule *Schedule
+	// Window is how long each window stays open; DefaultWindow when 0.
+	Window time.Duration
+	// Quiet is how long no query may arrive before a task starts or starts
+	// over; DefaultQuiet when 0.
+	Quiet time.Duration
+	Tasks []Task
+	// LastQuery returns when the last query arrived; zero if none has.
+	LastQuery func() time.Time
+
+	mu     sync.Mutex
+	status Status
+}
+
+func (s *Scheduler) window() time.Duration {
+	if s.Window <= 0 {
+		return DefaultWindow
+	}
+	return s.Window
+}
+
+func (s *Scheduler) quiet() time.Duration {
+	if s.Quiet <= 0 {
+		return DefaultQuiet
+	}
+	return s.Quiet
+}
+
+func (s *Scheduler) lastQuery() time.Time {
+	if s.LastQuery == nil {
+		return time.Time{}
+	}
+	return s.LastQuery()
+}
+
+// Status returns the scheduler's state and the report of its last window.
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.status
+	st.Schedule = s.Schedule.String()
+	st.WindowMS = float64(s.window()) / float64(time.Millisecond)
+	st.QuietMS = float64(s.quiet()) / float64(time.Millisecond)
+	st.Tasks = make([]string, len(s.Tasks))
+	for i, t := range s.Tasks {
+		st.Tasks[i] = t.Name
+	}
+	return st
+}
+
+func (s *Scheduler) update(f func(st *Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.status)
+}
+
+// Run opens a window at every time the schedule matches until ctx is
+// cancelled. A window still open when the next one is due absorbs it.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		next := s.Schedule.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("schedule %q never matches", s.Schedule)
+		}
+		s.update(func(st *Status) { st.Next = next })
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		s.RunWindow(ctx, next.Add(s.window()))
+	}
+}
+
+// RunWindow runs the tasks in order until they are done or end passes, and
+// returns what became of each.
+func (s *Scheduler) RunWindow(ctx context.Context, end time.Time) Report {
+	ctx, cancel := context.WithDeadline(ctx, end)
+	defer cancel()
+
+	rep := Report{Start: time.Now().UTC(), Tasks: make([]TaskReport, 0, len(s.Tasks))}
+	s.update(func(st *Status) { st.Open, st.Next = true, time.Time{} })
+	log.Printf("[maintenance] window open until %s tasks=%d", end.Format(time.RFC3339), len(s.Tasks))
+	for _, task := range s.Tasks {
+		tr := s.runTask(ctx, task)
+		log.Printf("[maintenance] task=%s status=%s pauses=%d elapsed_ms=%.0f %s", tr.Name, tr.Status, tr.Pauses, tr.ElapsedMS, tr.Error)
+		rep.Tasks = append(rep.Tasks, tr)
+	}
+	rep.End = time.Now().UTC()
+	s.update(func(st *Status) {
+		st.Open, st.Current, st.Paused = false, "", false
+		last := rep
+		st.Last = &last
+	})
+	return rep
+}
+
+// runTask runs task once no query has arrived for Quiet, and again after
+// every run a query interrupts, until it returns or ctx ends.
+func (s *Scheduler) runTask(ctx context.Context, task Task) TaskReport {
+	tr := TaskReport{Name: task.Name}
+	start := time.Now()
+	defer func() { tr.ElapsedMS = float64(time.Since(start).Microseconds()) / 1000 }()
+	s.update(func(st *Status) { st.Current, st.Paused = task.Name, false })
+
+	poll := min(max(s.quiet()/4, 10*time.Millisecond), time.Second)
+	for {
+		if !s.waitQuiet(ctx, poll) {
+			tr.Status = TaskSkipped
+			return tr
+		}
+		s.update(func(st *Status) { st.Paused = false })
+		runCtx, cancel := context.WithCancel(ctx)
+		began := time.Now()
+		interrupted := make(chan bool, 1)
+		go func() {
+			t := time.NewTicker(poll)
+			defer t.Stop()
+			for {
+				select {
+				case <-runCtx.Done():
+					interrupted <- false
+					return
+				case <-t.C:
+					if s.lastQuery().After(began) {
+						interrupted <- true
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+		err := task.Run(runCtx)
+		cancel()
+		paused := <-interrupted
+		switch {
+		case err == nil:
+			tr.Status = TaskDone
+			return tr
+		case ctx.Err() != nil:
+			tr.Status, tr.Error = TaskSkipped, err.Error()
+			return tr
+		case paused && errors.Is(err, context.Canceled):
+			tr.Pauses++
+			s.update(func(st *Status) { st.Paused = true })
+		default:
+			tr.Status, tr.Error = TaskFailed, err.Error()
+			return tr
+		}
+	}
+}
+
+// waitQuiet returns once no query has arrived for Quiet, checking every
+// poll; false when ctx ends first.
+func (s *Scheduler) waitQuiet(ctx context.Context, poll time.Duration) bool {
+	for {
+		idle := time.Since(s.lastQuery())
+		if idle >= s.quiet() {
+			return true
+		}
+		t := time.NewTimer(min(s.quiet()-idle, poll))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	cases := []struct {
+		spec, after, want string
+	}{
+		{"0 2 * * *", "2024-03-10 01:59", "2024-03-10 02:00"},
+		{"0 2 * * *", "2024-03-10 02:00", "2024-03-11 02:00"},
+		{"*/15 * * * *", "2024-03-10 10:07", "2024-03-10 10:15"},
+		{"30 1 * * 1-5", "2024-03-09 12:00", "2024-03-11 01:30"}, // Saturday -> Monday
+		{"0 0 1 * 0", "2024-03-05 00:00", "2024-03-10 00:00"},    // either day field
+		{"0 3,4 29 2 *", "2023-03-01 00:00", "2024-02-29 03:00"},
+		{"0 0 * * 7", "2024-03-05 00:00", "2024-03-10 00:00"},
+	}
+	for _, c := range cases {
+		s, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", c.spec, err)
+		}
+		if got := s.Next(at(c.after)); !got.Equal(at(c.want)) {
+			t.Errorf("%q after %s: got %s, want %s", c.spec, c.after, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("ParseSchedule(%q) accepted", bad)
+		}
+	}
+	never, _ := ParseSchedule("0 0 31 2 *")
+	if got := never.Next(at("2024-01-01 00:00")); !got.IsZero() {
+		t.Errorf("Feb 31 matched %s", got)
+	}
+}
+
+func TestRunWindowPausesOnQueries(t *testing.T) {
+	var lastQuery atomic.Int64
+	query := func() { lastQuery.Store(time.Now().UnixNano()) }
+	sched, _ := ParseSchedule("0 2 * * *")
+
+	var runs, interrupted atomic.Int32
+	s := &Scheduler{
+		Schedule:  sched,
+		Quiet:     40 * time.Millisecond,
+		LastQuery: func() time.Time { return time.Unix(0, lastQuery.Load()) },
+		Tasks: []Task{
+			{Name: "slow", Run: func(ctx context.Context) error {
+				// The first run is cut short by a query.
+				if runs.Add(1) == 1 {
+					query()
+					<-ctx.Done()
+					interrupted.Add(1)
+					return ctx.Err()
+				}
+				return nil
+			}},
+			{Name: "broken", Run: func(context.Context) error { return errors.New("boom") }},
+			{Name: "endless", Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}},
+		},
+	}
+	query()
+	start := time.Now()
+	rep := s.RunWindow(context.Background(), time.Now().Add(time.Second))
+
+	if time.Since(start) < s.Quiet {
+		t.Error("tasks started before the quiet period")
+	}
+	if runs.Load() != 2 || interrupted.Load() != 1 {
+		t.Errorf("slow task ran %d times, interrupted %d", runs.Load(), interrupted.Load())
+	}
+	want := []struct {
+		status string
+		pauses int
+	}{{TaskDone, 1}, {TaskFailed, 0}, {TaskSkipped, 0}}
+	if len(rep.Tasks) != len(want) {
+		t.Fatalf("report has %d tasks: %+v", len(rep.Tasks), rep.Tasks)
+	}
+	for i, w := range want {
+		if got := rep.Tasks[i]; got.Status != w.status || got.Pauses != w.pauses {
+			t.Errorf("task %s: status=%s pauses=%d, want %s/%d", got.Name, got.Status, got.Pauses, w.status, w.pauses)
+		}
+	}
+	st := s.Status()
+	if st.Open || st.Last == nil || len(st.Tasks) != 3 || st.Schedule != "0 2 * * *" {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
@@ -0,0 +1,193 @@
+// Package migrate rebuilds a data directory with a different embedding model.
+// Only metadata is read from the source: every stored chunk is re-embedded
+// from its content, so the old vectors (and their dimension) do not matter.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"vox-vector-engine/internal/embed"
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// DefaultBatchSize is how many chunks are sent to the provider per request.
+const DefaultBatchSize = 64
+
+// Progress is reported after every embedded batch.
+type Progress struct {
+	Store string // "" for the default stores, else "namespaces/<dir>"
+	Done  int
+	Total int
+}
+
+// Result summarises a migration.
+type Result struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Model     string `json:"model"`
+	Dim       int    `json:"dim"`
+	Stores    int    `json:"stores"`
+	Documents int    `json:"documents"`
+	Chunks    int    `json:"chunks"`
+	// Skipped counts chunks without content, which cannot be re-embedded.
+	Skipped int `json:"skipped"`
+}
+
+// Options tunes Embeddings.
+type Options struct {
+	BatchSize int
+	Progress  func(Progress)
+	// Backend opens the source and target metadata stores (Bolt by default).
+	Backend storage.MetadataBackend
+}
+
+// Embeddings re-embeds every chunk under from (the default stores and any
+// namespace shards) with p and writes fresh stores under to. to must not
+// already hold a vector store. The source must not be in use by a server.
+// Model spaces (<from>/models) are left alone; they belong to other models.
+func Embeddings(ctx context.Context, from, to string, p embed.Provider, opts Options) (Result, error) {
+	res := Result{From: from, To: to, Model: p.Name(), Dim: p.Dim()}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if _, err := os.Stat(filepath.Join(from, "metadata.db")); err != nil {
+		return res, fmt.Errorf("no metadata.db in %s", from)
+	}
+	if _, err := os.Stat(filepath.Join(to, "vectors.bin")); err == nil {
+		return res, fmt.Errorf("%s already holds a vector store", to)
+	}
+
+	stores := []string{""}
+	shardDirs, err := os.ReadDir(filepath.Join(from, "namespaces"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return res, err
+	}
+	for _, e := range shardDirs {
+		if e.IsDir() {
+			stores = append(stores, filepath.Join("namespaces", e.Name()))
+		}
+	}
+
+	for _, rel := range stores {
+		docs, chunks, skipped, err := migrateStore(ctx, filepath.Join(from, rel), filepath.Join(to, rel), rel, p, opts)
+		if err != nil {
+			if rel == "" {
+				rel = "default stores"
+			}
+			return res, fmt.Errorf("%s: %w", rel, err)
+		}
+		res.Stores++
+		res.Documents += docs
+		res.Chunks += chunks
+		res.Skipped += skipped
+	}
+	return res, nil
+}
+
+// migrateStore re-embeds one vectors.bin/metadata.db pair.
+func migrateStore(ctx context.Context, src, dst, name string, p embed.Provider, opts Options) (docs, chunks, skipped int, err error) {
+	oldMeta, err := opts.Backend.Open(filepath.Join(src, "metadata.db"))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer oldMeta.Close()
+
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return 0, 0, 0, err
+	}
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dst, "vectors.bin"), p.Dim())
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer vecs.Close()
+	meta, err := opts.Backend.Open(filepath.Join(dst, "metadata.db"))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer meta.Close()
+
+	total, err := oldMeta.ChunkCount()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// Chunk IDs are vector offsets, so they change; message documents record
+	// theirs under "chunk_id" and are rewritten from this map.
+	newIDs := map[uint64]uint64{}
+	var batch []types.Chunk
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.Content
+		}
+		vs, err := p.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		if len(vs) != len(batch) {
+			return fmt.Errorf("provider returned %d vectors for %d chunks", len(vs), len(batch))
+		}
+		for i := range batch {
+			id, err := vecs.Append(vs[i])
+			if err != nil {
+				return err
+			}
+			newIDs[batch[i].ID] = id
+			batch[i].ID = id
+		}
+		if err := meta.SaveChunks(batch); err != nil {
+			return err
+		}
+		chunks += len(batch)
+		batch = batch[:0]
+		if opts.Progress != nil {
+			opts.Progress(Progress{Store: name, Done: chunks + skipped, Total: total})
+		}
+		return nil
+	}
+
+	err = oldMeta.ForEachChunk(func(c types.Chunk) error {
+		if c.Content == "" {
+			skipped++
+			return nil
+		}
+		batch = append(batch, c)
+		if len(batch) < opts.BatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return docs, chunks, skipped, err
+	}
+
+	err = oldMeta.ForEachDocument(func(doc types.Document) error {
+		if old, ok := doc.Metadata["chunk_id"].(float64); ok {
+			if id, ok := newIDs[uint64(old)]; ok {
+				doc.Metadata["chunk_id"] = id
+			} else {
+				delete(doc.Metadata, "chunk_id")
+			}
+		}
+		docs++
+		return meta.SaveDocument(doc)
+	})
+	if err != nil {
+		return docs, chunks, skipped, err
+	}
+
+	// The HNSW index is in-memory and is rebuilt from vectors.bin whenever the
+	// new stores are opened, so there is nothing else to write.
+	return docs, chunks, skipped, vecs.Sync()
+}
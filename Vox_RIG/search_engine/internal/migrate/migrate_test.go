@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/storage"
+	"vox-vector-engine/internal/types"
+)
+
+// fakeEmbedder maps every text to a 3-d vector derived from its length.
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Name() string { return "fake" }
+func (fakeEmbedder) Dim() int     { return 3 }
+func (fakeEmbedder) Embed(_ context.Context, texts []string) ([]types.Vector, error) {
+	out := make([]types.Vector, len(texts))
+	for i, t := range texts {
+		out[i] = types.Vector{float32(len(t)), 1, 0}
+	}
+	return out, nil
+}
+
+// seed writes a 2-d store with one message document and two chunks, one of
+// them without content.
+func seed(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vecs.Close()
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meta.Close()
+
+	vecs.Append(types.Vector{0, 0})
+	id, _ := vecs.Append(types.Vector{1, 0})
+	empty, _ := vecs.Append(types.Vector{0, 1})
+	meta.SaveDocument(types.Document{ID: "chat:c:m", Metadata: types.Metadata{"chunk_id": id}})
+	meta.SaveChunk(types.Chunk{ID: id, DocID: "chat:c:m", Content: "hello", TokenCount: 2})
+	meta.SaveChunk(types.Chunk{ID: empty, DocID: "chat:c:m"})
+}
+
+func TestEmbeddings(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	seed(t, from)
+	seed(t, filepath.Join(from, "namespaces", "proj"))
+
+	var reports int
+	res, err := Embeddings(context.Background(), from, to, fakeEmbedder{}, Options{
+		Progress: func(Progress) { reports++ },
+	})
+	if err != nil {
+		t.Fatalf("Embeddings failed: %v", err)
+	}
+	if res.Stores != 2 || res.Documents != 2 || res.Chunks != 2 || res.Skipped != 2 {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if reports != 2 {
+		t.Errorf("Expected 2 progress reports, got %d", reports)
+	}
+
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(to, "vectors.bin"), 3)
+	if err != nil {
+		t.Fatalf("Failed to open migrated vectors: %v", err)
+	}
+	defer vecs.Close()
+	if vecs.Count() != 1 {
+		t.Errorf("Expected 1 migrated vector, got %d", vecs.Count())
+	}
+	v, _ := vecs.Get(0)
+	if v[0] != 5 {
+		t.Errorf("Expected vector re-embedded from content, got %v", v)
+	}
+
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(to, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meta.Close()
+	doc, err := meta.GetDocument("chat:c:m")
+	if err != nil {
+		t.Fatalf("Document not migrated: %v", err)
+	}
+	if id, _ := doc.Metadata["chunk_id"].(float64); id != 0 {
+		t.Errorf("Expected chunk_id remapped to 0, got %v", doc.Metadata["chunk_id"])
+	}
+	c, err := meta.GetChunk(0)
+	if err != nil || c.Content != "hello" || c.TokenCount != 2 {
+		t.Errorf("Unexpected migrated chunk: %+v (%v)", c, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(to, "namespaces", "proj", "vectors.bin")); err != nil {
+		t.Errorf("Namespace shard not migrated: %v", err)
+	}
+
+	if _, err := Embeddings(context.Background(), from, to, fakeEmbedder{}, Options{}); err == nil {
+		t.Errorf("Expected an error when the target already holds a store")
+	}
+}
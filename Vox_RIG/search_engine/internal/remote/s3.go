@@ -0,0 +1,337 @@
+// Package remote copies snapshots to and from S3-compatible object storage,
+// so a fresh machine can start from the memory another one built.
+//
+// Objects are laid out as
+//
+//	<prefix>/snapshots/<name>/<file>    (every file of the snapshot directory)
+//
+// and a snapshot's manifest.json is uploaded last: a snapshot without one is
+// incomplete and never picked by Latest.
+package remote
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// unsignedPayload skips hashing request bodies, which S3 and its clones
+// accept over HTTPS; a snapshot's vectors file can be gigabytes.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// emptySHA256 is the hash of an empty body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Config locates a bucket and the credentials for it.
+type Config struct {
+	// Endpoint is the service URL, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://localhost:9000 for MinIO.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every key ("" = bucket root).
+	Prefix string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// ParseURL fills Bucket and Prefix from s3://bucket/prefix.
+func (c *Config) ParseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return fmt.Errorf("invalid remote %q (want s3://bucket/prefix)", raw)
+	}
+	c.Bucket = u.Host
+	c.Prefix = strings.Trim(u.Path, "/")
+	return nil
+}
+
+// FromEnv fills unset fields from the standard AWS environment variables.
+func (c *Config) FromEnv() {
+	set := func(dst *string, keys ...string) {
+		for _, k := range keys {
+			if *dst == "" {
+				*dst = os.Getenv(k)
+			}
+		}
+	}
+	set(&c.AccessKey, "AWS_ACCESS_KEY_ID")
+	set(&c.SecretKey, "AWS_SECRET_ACCESS_KEY")
+	set(&c.SessionToken, "AWS_SESSION_TOKEN")
+	set(&c.Region, "AWS_REGION", "AWS_DEFAULT_REGION")
+	set(&c.Endpoint, "AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+}
+
+// Client talks to one bucket. Requests use path-style URLs
+// (<endpoint>/<bucket>/<key>), which every S3-compatible service accepts.
+type Client struct {
+	cfg  Config
+	base *url.URL
+	http *http.Client
+	now  func() time.Time
+}
+
+// ErrNotFound is returned by Get for a missing object.
+var ErrNotFound = errors.New("object not found")
+
+// New validates cfg and returns a client for it.
+func New(cfg Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("remote: bucket is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("remote: credentials are required (AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY)")
+	}
+	base, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("remote: invalid endpoint %q", cfg.Endpoint)
+	}
+	return &Client{cfg: cfg, base: base, http: &http.Client{}, now: time.Now}, nil
+}
+
+// String names the remote for logs, without credentials.
+func (c *Client) String() string {
+	return "s3://" + strings.TrimRight(c.cfg.Bucket+"/"+c.cfg.Prefix, "/")
+}
+
+// key prepends the configured prefix to name.
+func (c *Client) key(name string) string {
+	if c.cfg.Prefix == "" {
+		return name
+	}
+	return c.cfg.Prefix + "/" + name
+}
+
+func (c *Client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.base
+	u.Path = u.Path + "/" + c.cfg.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// Put uploads size bytes from body as key (relative to the prefix).
+func (c *Client) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(c.key(key), nil).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := c.do(req, unsignedPayload)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads key; the caller closes the body.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(c.key(key), nil).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, emptySHA256)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return resp.Body, nil
+}
+
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys under prefix (relative to the configured prefix),
+// sorted.
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {c.key(prefix)}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u := c.objectURL("", q)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req, emptySHA256)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, o := range res.Contents {
+			k := o.Key
+			if c.cfg.Prefix != "" {
+				k = strings.TrimPrefix(k, c.cfg.Prefix+"/")
+			}
+			keys = append(keys, k)
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// do signs and sends req, turning non-2xx answers into errors.
+func (c *Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	c.sign(req, payloadHash, c.now().UTC())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, strings.TrimSpace(string(msg)))
+	}
+	return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "range" || strings.HasPrefix(lk, "x-amz-") || lk == "content-type" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + c.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex(canonical)
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), day)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.cfg.AccessKey, scope, signed, sig))
+}
+
+// escapePath URI-encodes every path byte except unreserved characters and '/'.
+func escapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		ch := p[i]
+		if ch == '/' || isUnreserved(ch) {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, escapeQuery(k)+"="+escapeQuery(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escapeQuery(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if ch := s[i]; isUnreserved(ch) {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func isUnreserved(ch byte) bool {
+	return ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+		ch == '-' || ch == '_' || ch == '.' || ch == '~'
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
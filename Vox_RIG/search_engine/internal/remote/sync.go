@@ -0,0 +1,195 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"vox-vector-engine/internal/snapshot"
+	"vox-vector-engine/internal/storage"
+)
+
+const snapshotsPrefix = "snapshots/"
+
+// PushResult summarizes an upload.
+type PushResult struct {
+	Files int
+	Bytes int64
+}
+
+// Push uploads every file of the snapshot directory dir as snapshot name.
+// The manifest goes last, so a push that fails halfway is never restored.
+func Push(ctx context.Context, c *Client, dir, name string) (PushResult, error) {
+	var res PushResult
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel != snapshot.ManifestFile {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	files = append(files, snapshot.ManifestFile)
+
+	for _, rel := range files {
+		n, err := putFile(ctx, c, snapshotsPrefix+name+"/"+rel, filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return res, err
+		}
+		res.Files++
+		res.Bytes += n
+	}
+	return res, nil
+}
+
+func putFile(ctx context.Context, c *Client, key, p string) (int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), c.Put(ctx, key, f, info.Size())
+}
+
+// Latest returns the name of the newest complete remote snapshot, or "" if
+// there is none. Snapshot names are UTC timestamps, so they sort by age.
+func Latest(ctx context.Context, c *Client) (string, error) {
+	keys, err := c.List(ctx, snapshotsPrefix)
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, k := range keys {
+		name, file, ok := strings.Cut(strings.TrimPrefix(k, snapshotsPrefix), "/")
+		if ok && file == snapshot.ManifestFile && name > latest {
+			latest = name
+		}
+	}
+	return latest, nil
+}
+
+// Pull downloads remote snapshot name into snapRoot/name and returns that
+// directory. A partial download is removed.
+func Pull(ctx context.Context, c *Client, name, snapRoot string) (string, error) {
+	dir, err := snapshotDir(snapRoot, name)
+	if err != nil {
+		return "", err
+	}
+	prefix := snapshotsPrefix + name + "/"
+	keys, err := c.List(ctx, prefix)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("remote snapshot %s: %w", name, ErrNotFound)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	for _, k := range keys {
+		rel := strings.TrimPrefix(k, prefix)
+		// Keys come from the bucket; never let one escape the snapshot.
+		if rel == "" || !fs.ValidPath(rel) {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("remote snapshot %s: invalid key %q", name, k)
+		}
+		if err := getFile(ctx, c, k, filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshot.ManifestFile)); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("remote snapshot %s is incomplete (no %s)", name, snapshot.ManifestFile)
+	}
+	return dir, nil
+}
+
+func snapshotDir(snapRoot, name string) (string, error) {
+	if name == "" || path.Base(name) != name || name == "." || name == ".." || strings.Contains(name, `\`) {
+		return "", fmt.Errorf("invalid snapshot name: %q", name)
+	}
+	return filepath.Join(snapRoot, name), nil
+}
+
+func getFile(ctx context.Context, c *Client, key, p string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	body, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return fmt.Errorf("download %s: %w", key, err)
+	}
+	return f.Close()
+}
+
+// Bootstrap fills an empty data directory from the newest remote snapshot,
+// which is also kept under <dataDir>/snapshots. It returns the snapshot name,
+// or "" when dataDir already has stores or the remote has no snapshot. A
+// snapshot of another dimension is an error. The stores of dataDir must not
+// be open.
+func Bootstrap(ctx context.Context, c *Client, dataDir string, dim int) (string, error) {
+	for _, f := range []string{storage.VectorsFile, storage.SegmentsDir, snapshot.MetadataFile} {
+		if _, err := os.Stat(filepath.Join(dataDir, f)); err == nil {
+			return "", nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	name, err := Latest(ctx, c)
+	if err != nil || name == "" {
+		return "", err
+	}
+	snapRoot := filepath.Join(dataDir, "snapshots")
+	dir := filepath.Join(snapRoot, name)
+	if _, err := os.Stat(filepath.Join(dir, snapshot.ManifestFile)); err != nil {
+		if dir, err = Pull(ctx, c, name, snapRoot); err != nil {
+			return "", err
+		}
+	}
+	m, err := snapshot.ReadManifest(dir)
+	if err != nil {
+		return "", err
+	}
+	if m.Dim != 0 && m.Dim != dim {
+		return "", fmt.Errorf("remote snapshot %s has dim=%d, want dim=%d", name, m.Dim, dim)
+	}
+	if err := snapshot.RestoreFiles(dir, dataDir); err != nil {
+		return "", err
+	}
+	if err := snapshot.RestoreShards(dir, filepath.Join(dataDir, snapshot.ShardsDir)); err != nil {
+		return "", err
+	}
+	if err := snapshot.RestoreModels(dir, filepath.Join(dataDir, snapshot.ModelsDir)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,422 @@
+// Package replication keeps a replica server current with a primary over
+// HTTP. The primary serves its vectors file and the change log of its
+// metadata store under /replication/; a Follower on the replica appends the
+// vectors it is missing, then replays the change log by fetching the current
+// state of every document it names.
+//
+// Vector IDs are positions in vectors.bin, so the replica's file must stay a
+// prefix of the primary's: a replica whose vectors differ has diverged and
+// must be re-seeded from a snapshot. Only the shared stores replicate;
+// namespace shards, model spaces and tenants do not.
+package replication
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/types"
+)
+
+const (
+	// DefaultInterval is how often a Follower polls the primary.
+	DefaultInterval = 2 * time.Second
+	// DefaultVectorBatch and MaxVectorBatch size GET /replication/vectors.
+	DefaultVectorBatch = 1024
+	MaxVectorBatch     = 16384
+	// SeqStateKey holds the primary change log Seq applied last.
+	SeqStateKey = "replication_seq"
+)
+
+// Status is served by GET /replication/status.
+type Status struct {
+	VecCount   uint64 `json:"vec_count"`
+	LastChange uint64 `json:"last_change"`
+	Dim        int    `json:"dim"`
+}
+
+// ChangesPage is served by GET /replication/changes.
+type ChangesPage struct {
+	Changes    []types.Change `json:"changes"`
+	LastChange uint64         `json:"last_change"`
+}
+
+// DocumentState is served by GET /replication/document: a document with
+// every chunk pointing at it.
+type DocumentState struct {
+	Document types.Document `json:"document"`
+	Chunks   []types.Chunk  `json:"chunks"`
+}
+
+// ChunksPage is served by GET /replication/chunks; missing IDs are left out.
+type ChunksPage struct {
+	Chunks []types.Chunk `json:"chunks"`
+}
+
+// EncodeVectors writes vectors as little-endian float32s, back to back.
+func EncodeVectors(w io.Writer, vectors []types.Vector) error {
+	var buf []byte
+	for _, v := range vectors {
+		for _, f := range v {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// DecodeVectors reverses EncodeVectors for vectors of length dim.
+func DecodeVectors(data []byte, dim int) ([]types.Vector, error) {
+	size := dim * 4
+	if dim <= 0 || len(data)%size != 0 {
+		return nil, fmt.Errorf("vector payload of %d bytes is not a multiple of dim=%d", len(data), dim)
+	}
+	out := make([]types.Vector, len(data)/size)
+	for i := range out {
+		v := make(types.Vector, dim)
+		for j := range v {
+			v[j] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*size+j*4:]))
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// ErrDiverged means the replica's vectors are not a prefix of the primary's.
+var ErrDiverged = errors.New("replica diverged from the primary")
+
+// Result reports what one Sync did.
+type Result struct {
+	Vectors int    `json:"vectors"`
+	Changes int    `json:"changes"`
+	Seq     uint64 `json:"seq"`
+}
+
+// Follower replicates a primary into Shard.
+type Follower struct {
+	// Primary is the base URL of the primary server.
+	Primary string
+	Shard   *engine.Shard
+	// Guard, if set, is read-locked around store updates (the HTTP server
+	// passes its store lock so snapshots see whole files).
+	Guard  *sync.RWMutex
+	Client *http.Client
+	// Token is sent as a bearer token to a primary started with
+	// -auth_token.
+	Token string
+}
+
+func (f *Follower) lock() func() {
+	if f.Guard == nil {
+		return func() {}
+	}
+	f.Guard.RLock()
+	return f.Guard.RUnlock
+}
+
+// Run syncs every interval until ctx is cancelled.
+func (f *Follower) Run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		res, err := f.Sync(ctx)
+		if err != nil {
+			log.Printf("[replica] sync failed: %v", err)
+		} else if res.Vectors > 0 || res.Changes > 0 {
+			log.Printf("[replica] vectors=%d changes=%d seq=%d", res.Vectors, res.Changes, res.Seq)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sync copies the vectors the replica is missing, then applies the change
+// log entries it has not seen, until it has caught up with the primary's
+// status at the start of the call.
+func (f *Follower) Sync(ctx context.Context) (Result, error) {
+	var res Result
+	var st Status
+	if err := f.getJSON(ctx, "/v1/replication/status", nil, &st); err != nil {
+		return res, err
+	}
+	sh := f.Shard
+	if st.Dim != sh.Vectors.Dim() {
+		return res, fmt.Errorf("primary has dim=%d, replica has dim=%d", st.Dim, sh.Vectors.Dim())
+	}
+	if n := sh.Vectors.Count(); n > st.VecCount {
+		return res, fmt.Errorf("%w: replica has %d vectors, primary %d", ErrDiverged, n, st.VecCount)
+	}
+
+	for sh.Vectors.Count() < st.VecCount {
+		n, err := f.pullVectors(ctx, st.VecCount)
+		res.Vectors += n
+		if err != nil {
+			return res, err
+		}
+	}
+	if res.Vectors > 0 {
+		if err := sh.Vectors.Sync(); err != nil {
+			return res, err
+		}
+	}
+
+	seq, err := f.appliedSeq()
+	if err != nil {
+		return res, err
+	}
+	res.Seq = seq
+	for seq < st.LastChange {
+		var page ChangesPage
+		q := url.Values{"since": {strconv.FormatUint(seq, 10)}}
+		if err := f.getJSON(ctx, "/v1/replication/changes", q, &page); err != nil {
+			return res, err
+		}
+		if len(page.Changes) == 0 {
+			break
+		}
+		for _, c := range page.Changes {
+			if err := f.apply(ctx, c); err != nil {
+				return res, fmt.Errorf("change %d (%s): %w", c.Seq, c.Op, err)
+			}
+			seq = c.Seq
+			res.Changes++
+			res.Seq = seq
+			unlock := f.lock()
+			err := sh.Meta.SetState(SeqStateKey, strconv.FormatUint(seq, 10))
+			unlock()
+			if err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+func (f *Follower) appliedSeq() (uint64, error) {
+	v, err := f.Shard.Meta.GetState(SeqStateKey)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+// pullVectors appends one batch of the primary's vectors and indexes them.
+func (f *Follower) pullVectors(ctx context.Context, upTo uint64) (int, error) {
+	sh := f.Shard
+	from := sh.Vectors.Count()
+	limit := min(upTo-from, DefaultVectorBatch)
+	q := url.Values{"from": {strconv.FormatUint(from, 10)}, "limit": {strconv.FormatUint(limit, 10)}}
+	data, err := f.get(ctx, "/v1/replication/vectors", q)
+	if err != nil {
+		return 0, err
+	}
+	vectors, err := DecodeVectors(data, sh.Vectors.Dim())
+	if err != nil {
+		return 0, err
+	}
+	if len(vectors) == 0 {
+		return 0, fmt.Errorf("primary returned no vectors from %d", from)
+	}
+
+	defer f.lock()()
+	for i, v := range vectors {
+		id, err := sh.Vectors.Append(v)
+		if err != nil {
+			return i, err
+		}
+		if id != from+uint64(i) {
+			return i, fmt.Errorf("%w: vector %d was stored as %d", ErrDiverged, from+uint64(i), id)
+		}
+		sh.Index.Add(id, v)
+	}
+	return len(vectors), nil
+}
+
+// apply replays one change log entry.
+func (f *Follower) apply(ctx context.Context, c types.Change) error {
+	sh := f.Shard
+	switch c.Op {
+	case types.ChangeDocument:
+		var doc DocumentState
+		err := f.getJSON(ctx, "/v1/replication/document", url.Values{"id": {c.DocID}}, &doc)
+		if errors.Is(err, errNotFound) {
+			// Deleted since; a later entry says so too.
+			defer f.lock()()
+			_, err = sh.Engine.DeleteDocument(c.DocID)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		return f.replaceDocument(doc)
+
+	case types.ChangeChunks:
+		for start := 0; start < len(c.ChunkIDs); start += DefaultVectorBatch {
+			ids := c.ChunkIDs[start:min(start+DefaultVectorBatch, len(c.ChunkIDs))]
+			var page ChunksPage
+			if err := f.getJSON(ctx, "/v1/replication/chunks", url.Values{"ids": {joinIDs(ids)}}, &page); err != nil {
+				return err
+			}
+			unlock := f.lock()
+			err := sh.Meta.SaveChunks(page.Chunks)
+			if err == nil {
+				err = sh.Engine.LinkNamedVectors(page.Chunks)
+			}
+			if err == nil {
+				f.indexChunks(page.Chunks)
+			}
+			unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case types.ChangeDeleteDocument:
+		defer f.lock()()
+		_, err := sh.Engine.DeleteDocument(c.DocID)
+		return err
+
+	case types.ChangeDeleteNamespace:
+		defer f.lock()()
+		_, err := sh.Engine.PurgeNamespace(c.Namespace)
+		return err
+
+	case types.ChangePin, types.ChangeUnpin:
+		if c.Pin == nil {
+			return errors.New("pin change without a pin")
+		}
+		defer f.lock()()
+		if c.Op == types.ChangePin {
+			return sh.Meta.SavePin(*c.Pin)
+		}
+		_, err := sh.Meta.DeletePin(*c.Pin)
+		return err
+
+	case types.ChangeTemplate:
+		if c.Template == nil {
+			return errors.New("template change without a template")
+		}
+		defer f.lock()()
+		return sh.Meta.SaveTemplate(*c.Template)
+
+	case types.ChangeDeleteTemplate:
+		defer f.lock()()
+		_, err := sh.Meta.DeleteTemplate(c.Namespace)
+		return err
+	}
+	return fmt.Errorf("unknown change op %q", c.Op)
+}
+
+// replaceDocument stores doc in place of the local copy, unlinking chunks it
+// no longer has from the index.
+func (f *Follower) replaceDocument(doc DocumentState) error {
+	sh := f.Shard
+	defer f.lock()()
+	old, err := sh.Meta.DeleteDocument(doc.Document.ID)
+	if err != nil {
+		return err
+	}
+	if err := sh.Meta.SaveDocumentWithChunks(doc.Document, doc.Chunks); err != nil {
+		return err
+	}
+	if err := sh.Engine.LinkNamedVectors(doc.Chunks); err != nil {
+		return err
+	}
+	keep := make(map[uint64]bool, len(doc.Chunks))
+	for _, c := range doc.Chunks {
+		keep[c.ID] = true
+	}
+	for _, id := range old {
+		if !keep[id] {
+			sh.Index.Remove(id)
+		}
+	}
+	f.indexChunks(doc.Chunks)
+	return nil
+}
+
+// indexChunks links chunks whose vectors are stored but not indexed, as
+// after a purge and re-ingest of the same vectors. Chunks whose vectors
+// have not arrived yet are indexed by pullVectors.
+func (f *Follower) indexChunks(chunks []types.Chunk) {
+	sh := f.Shard
+	for _, c := range chunks {
+		if c.ID >= sh.Vectors.Count() || sh.Index.Contains(c.ID) {
+			continue
+		}
+		if v, err := sh.Vectors.Get(c.ID); err == nil {
+			sh.Index.Add(c.ID, v)
+		}
+	}
+}
+
+func joinIDs(ids []uint64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+var errNotFound = errors.New("not found on the primary")
+
+func (f *Follower) get(ctx context.Context, path string, q url.Values) ([]byte, error) {
+	u := strings.TrimRight(f.Primary, "/") + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.Token)
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("GET %s: %w", path, errNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func (f *Follower) getJSON(ctx context.Context, path string, q url.Values, v any) error {
+	data, err := f.get(ctx, path, q)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package scrub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Remote is an external scrubber reached over HTTP. It is sent
+//
+//	POST <url> {"texts": ["...", ...]}
+//
+// and must answer with the same number of texts, rewritten, and what it
+// redacted:
+//
+//	{"texts": ["...", ...], "redactions": [{"rule": "name", "count": 1}]}
+type Remote struct {
+	url    string
+	client *http.Client
+}
+
+// NewRemote returns a scrubber posting to url.
+func NewRemote(url string) *Remote {
+	return &Remote{url: url, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (r *Remote) Name() string { return "remote:" + r.url }
+
+type remoteRequest struct {
+	Texts []string `json:"texts"`
+}
+
+type remoteResponse struct {
+	Texts      []string    `json:"texts"`
+	Redactions []Redaction `json:"redactions"`
+}
+
+func (r *Remote) Scrub(ctx context.Context, texts []string) ([]Redaction, error) {
+	body, err := json.Marshal(remoteRequest{Texts: texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var out remoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(out.Texts) != len(texts) {
+		return nil, fmt.Errorf("got %d texts for %d", len(out.Texts), len(texts))
+	}
+	copy(texts, out.Texts)
+	return out.Redactions, nil
+}
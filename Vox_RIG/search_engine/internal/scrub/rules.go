@@ -0,0 +1,136 @@
+package scrub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule replaces every match of Pattern with Replacement, which may refer to
+// submatches ($1); empty means "[REDACTED:<name>]".
+type Rule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"`
+	re          *regexp.Regexp
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule %q has no name", r.Pattern)
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", r.Name, err)
+	}
+	r.re = re
+	if r.Replacement == "" {
+		r.Replacement = "[REDACTED:" + r.Name + "]"
+	}
+	return nil
+}
+
+// Rules is a Filter applying each rule in order.
+type Rules struct {
+	name  string
+	rules []Rule
+}
+
+func (rs *Rules) Name() string { return rs.name }
+
+func (rs *Rules) Scrub(_ context.Context, texts []string) ([]Redaction, error) {
+	var out []Redaction
+	for _, r := range rs.rules {
+		n := 0
+		for i, t := range texts {
+			m := len(r.re.FindAllStringIndex(t, -1))
+			if m == 0 {
+				continue
+			}
+			texts[i] = r.re.ReplaceAllString(t, r.Replacement)
+			n += m
+		}
+		if n > 0 {
+			out = append(out, Redaction{Rule: r.Name, Count: n})
+		}
+	}
+	return out, nil
+}
+
+// placeholder keeps assignment values that are already redacted from
+// matching again.
+const placeholder = `[^\s"'\[]`
+
+// builtin are the rule sets selectable by name. Specific token formats come
+// before the generic ones so they are reported under their own rule.
+var builtin = map[string][]Rule{
+	"secrets": {
+		{Name: "private_key", Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+		{Name: "aws_access_key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+		{Name: "github_token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`},
+		{Name: "openai_key", Pattern: `\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}`},
+		{Name: "slack_token", Pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+		{Name: "google_api_key", Pattern: `\bAIza[0-9A-Za-z_-]{35}\b`},
+		{Name: "stripe_key", Pattern: `\b[rs]k_live_[0-9A-Za-z]{24,}\b`},
+		{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`},
+		{Name: "bearer_token", Pattern: `(?i)\b(bearer\s+)` + placeholder + `[A-Za-z0-9._~+/-]{19,}=*`, Replacement: "${1}[REDACTED:bearer_token]"},
+		{Name: "secret_assignment",
+			Pattern:     `(?i)\b((?:api[_-]?key|secret|token|password|passwd|access[_-]?key)["']?\s*[:=]\s*["']?)` + placeholder + `[^\s"']{7,}`,
+			Replacement: "${1}[REDACTED:secret_assignment]"},
+	},
+	"emails": {
+		{Name: "email", Pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`},
+	},
+}
+
+// BuiltinSets lists the names Builtin accepts.
+func BuiltinSets() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtin returns the named built-in rule sets ("secrets", "emails") as one
+// filter.
+func Builtin(sets ...string) (*Rules, error) {
+	rs := &Rules{name: "builtin:" + strings.Join(sets, "+")}
+	for _, set := range sets {
+		rules, ok := builtin[set]
+		if !ok {
+			return nil, fmt.Errorf("unknown scrub rule set %q (want one of %s)", set, strings.Join(BuiltinSets(), ", "))
+		}
+		for _, r := range rules {
+			if err := r.compile(); err != nil {
+				return nil, err
+			}
+			rs.rules = append(rs.rules, r)
+		}
+	}
+	return rs, nil
+}
+
+// LoadRules reads custom rules from a JSON array of
+// {"name", "pattern", "replacement"} objects.
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return &Rules{name: "rules:" + path, rules: rules}, nil
+}
@@ -0,0 +1,144 @@
+// Package scrub redacts secrets and personal data from chunk content before
+// it is stored: API keys, tokens and emails pasted into chat should never
+// land in a persistent memory store.
+//
+// A Chain runs its filters in order over a batch of texts. Rules are regular
+// expressions (the built-in sets, or a JSON file of custom ones); Remote hands
+// the texts to an external scrubber over HTTP.
+package scrub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Redaction counts what one rule replaced.
+type Redaction struct {
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+}
+
+// Report is what a Chain redacted from a batch of texts.
+type Report struct {
+	// Chunks counts the texts that changed.
+	Chunks     int         `json:"chunks"`
+	Redactions []Redaction `json:"redactions"`
+}
+
+// Total is the number of redactions of every rule.
+func (r *Report) Total() int {
+	if r == nil {
+		return 0
+	}
+	n := 0
+	for _, red := range r.Redactions {
+		n += red.Count
+	}
+	return n
+}
+
+// Merge adds o to r.
+func (r *Report) Merge(o *Report) {
+	if o == nil {
+		return
+	}
+	r.Chunks += o.Chunks
+	r.add(o.Redactions)
+}
+
+func (r *Report) add(reds []Redaction) {
+	for _, red := range reds {
+		if red.Count <= 0 {
+			continue
+		}
+		i := sort.Search(len(r.Redactions), func(i int) bool { return r.Redactions[i].Rule >= red.Rule })
+		if i < len(r.Redactions) && r.Redactions[i].Rule == red.Rule {
+			r.Redactions[i].Count += red.Count
+			continue
+		}
+		r.Redactions = append(r.Redactions, Redaction{})
+		copy(r.Redactions[i+1:], r.Redactions[i:])
+		r.Redactions[i] = red
+	}
+}
+
+// Filter rewrites texts in place and reports what it redacted.
+type Filter interface {
+	Name() string
+	Scrub(ctx context.Context, texts []string) ([]Redaction, error)
+}
+
+// Chain runs its filters in order; an empty Chain changes nothing.
+type Chain []Filter
+
+// Name lists the filters, for logs.
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, f := range c {
+		names[i] = f.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Scrub rewrites texts in place. It returns nil when nothing was redacted.
+// A failing filter fails the whole batch, so nothing unscrubbed is stored
+// by a caller that stops on the error.
+func (c Chain) Scrub(ctx context.Context, texts []string) (*Report, error) {
+	if len(c) == 0 || len(texts) == 0 {
+		return nil, nil
+	}
+	orig := append([]string(nil), texts...)
+	rep := &Report{}
+	for _, f := range c {
+		reds, err := f.Scrub(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("scrub %s: %w", f.Name(), err)
+		}
+		rep.add(reds)
+	}
+	for i := range texts {
+		if texts[i] != orig[i] {
+			rep.Chunks++
+		}
+	}
+	if rep.Chunks == 0 {
+		return nil, nil
+	}
+	return rep, nil
+}
+
+// Options configure New; every part is optional.
+type Options struct {
+	// Builtin names built-in rule sets (see Builtin).
+	Builtin []string
+	// RulesFile is a JSON file of extra rules (see LoadRules).
+	RulesFile string
+	// URL is an external scrubber run after the rules (see Remote).
+	URL string
+}
+
+// New builds the chain described by opts: built-in rules, then custom
+// rules, then the external scrubber. It is empty when opts is.
+func New(opts Options) (Chain, error) {
+	var c Chain
+	if len(opts.Builtin) > 0 {
+		rules, err := Builtin(opts.Builtin...)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, rules)
+	}
+	if opts.RulesFile != "" {
+		rules, err := LoadRules(opts.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, rules)
+	}
+	if opts.URL != "" {
+		c = append(c, NewRemote(opts.URL))
+	}
+	return c, nil
+}
@@ -0,0 +1,97 @@
+// Package service registers the engine with the operating system's service
+// manager, so it starts at boot and outlives the IDE that launched it: a
+// Windows service on Windows and a systemd unit on Linux. The service runs
+// the engine with -daemon, which gives it a PID file, a rotating log and a
+// clean shutdown when the manager stops it.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultName is the service name used when Config.Name is empty.
+const DefaultName = "vox-engine"
+
+// ErrUnsupported is returned on systems without a supported service
+// manager; run the engine with -daemon from the system's own startup
+// mechanism there (e.g. a launchd agent on macOS).
+var ErrUnsupported = errors.New("service management is only supported on Windows and Linux (systemd)")
+
+// Config describes the engine service.
+type Config struct {
+	// Name identifies the service; empty means DefaultName.
+	Name string
+	// Exe is the engine binary and DataDir its -data directory. Both are
+	// made absolute, as services do not start in the caller's directory.
+	Exe     string
+	DataDir string
+	// Args are further engine flags, e.g. -addr 127.0.0.1:8080 -dim 768.
+	Args []string
+	// User installs a systemd user unit (systemctl --user) instead of a
+	// system one, which needs no root but only runs while the user is
+	// logged in unless lingering is enabled. Ignored on Windows.
+	User bool
+}
+
+func (c Config) name() string {
+	if c.Name == "" {
+		return DefaultName
+	}
+	return c.Name
+}
+
+// Resolve checks c, fills in the default name and makes its paths
+// absolute.
+func Resolve(c Config) (Config, error) {
+	c.Name = c.name()
+	if c.Exe == "" || c.DataDir == "" {
+		return c, errors.New("the engine binary and data directory are required")
+	}
+	var err error
+	if c.Exe, err = filepath.Abs(c.Exe); err != nil {
+		return c, err
+	}
+	if c.DataDir, err = filepath.Abs(c.DataDir); err != nil {
+		return c, err
+	}
+	for _, a := range c.Args {
+		flag, _, _ := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		switch {
+		case !strings.HasPrefix(a, "-"):
+		case flag == "data", flag == "daemon", flag == "cmd":
+			return c, fmt.Errorf("-%s is set by the service and cannot be passed as an engine flag", flag)
+		}
+	}
+	return c, nil
+}
+
+// EngineArgs returns the engine's command line without the binary.
+func (c Config) EngineArgs() []string {
+	return append([]string{"-daemon", "-data", c.DataDir}, c.Args...)
+}
+
+// Install registers the service, enabled to start at boot, and returns
+// where it was registered (the unit file on Linux).
+func Install(c Config) (string, error) {
+	c, err := Resolve(c)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(c.Exe); err != nil {
+		return "", fmt.Errorf("engine binary: %w", err)
+	}
+	return install(c)
+}
+
+// Uninstall stops the service if it runs and removes it.
+func Uninstall(c Config) error { return uninstall(Config{Name: c.name(), User: c.User}) }
+
+// Start starts the installed service.
+func Start(c Config) error { return start(Config{Name: c.name(), User: c.User}) }
+
+// Stop stops the service and waits for the engine to exit.
+func Stop(c Config) error { return stop(Config{Name: c.name(), User: c.User}) }
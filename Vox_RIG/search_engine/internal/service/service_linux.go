@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// unitPath is where the unit file of c lives.
+func unitPath(c Config) (string, error) {
+	if !c.User {
+		return filepath.Join("/etc/systemd/system", c.Name+".service"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", c.Name+".service"), nil
+}
+
+func systemctl(c Config, args ...string) error {
+	if c.User {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func install(c Config) (string, error) {
+	path, err := unitPath(c)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(SystemdUnit(c)), 0o644); err != nil {
+		return "", err
+	}
+	if err := systemctl(c, "daemon-reload"); err != nil {
+		return path, err
+	}
+	return path, systemctl(c, "enable", c.Name)
+}
+
+func uninstall(c Config) error {
+	path, err := unitPath(c)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed: %w", c.Name, err)
+	}
+	// Stopping or disabling a unit that is already stopped or disabled
+	// succeeds, so failures here are real.
+	if err := systemctl(c, "disable", "--now", c.Name); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return systemctl(c, "daemon-reload")
+}
+
+func start(c Config) error { return systemctl(c, "start", c.Name) }
+
+func stop(c Config) error { return systemctl(c, "stop", c.Name) }
@@ -0,0 +1,11 @@
+//go:build !windows && !linux
+
+package service
+
+func install(Config) (string, error) { return "", ErrUnsupported }
+
+func uninstall(Config) error { return ErrUnsupported }
+
+func start(Config) error { return ErrUnsupported }
+
+func stop(Config) error { return ErrUnsupported }
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	c, err := Resolve(Config{Exe: "/opt/vox/vox-vector-engine", DataDir: "/var/lib/vox data", Args: []string{"-addr", "127.0.0.1:8080", "-embed", "ollama:50%"}})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	unit := SystemdUnit(c)
+	want := `ExecStart=/opt/vox/vox-vector-engine -daemon -data "/var/lib/vox data" -addr 127.0.0.1:8080 -embed ollama:50%%`
+	if !strings.Contains(unit, want+"\n") {
+		t.Errorf("Expected %q in unit:\n%s", want, unit)
+	}
+	if !strings.Contains(unit, "Description=Vox vector memory engine (vox-engine)") || !strings.Contains(unit, "WantedBy=multi-user.target") {
+		t.Errorf("Unexpected unit:\n%s", unit)
+	}
+	c.User = true
+	if unit := SystemdUnit(c); !strings.Contains(unit, "WantedBy=default.target") {
+		t.Errorf("Expected a user unit to be wanted by default.target:\n%s", unit)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	if _, err := Resolve(Config{Exe: "vox"}); err == nil {
+		t.Errorf("Expected an error without a data directory")
+	}
+	for _, arg := range []string{"-data", "--data=/x", "-daemon", "-cmd=stats"} {
+		if _, err := Resolve(Config{Exe: "vox", DataDir: "d", Args: []string{arg}}); err == nil {
+			t.Errorf("Expected %s to be rejected", arg)
+		}
+	}
+	c, err := Resolve(Config{Exe: "vox", DataDir: "d", Args: []string{"-dim", "768"}})
+	if err != nil || !strings.HasPrefix(c.DataDir, "/") || c.Name != DefaultName {
+		t.Errorf("Expected an absolute data dir and the default name, got %+v (%v)", c, err)
+	}
+}
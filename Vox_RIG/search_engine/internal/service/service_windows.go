@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"vox-vector-engine/internal/daemon"
+)
+
+func open(name string) (*mgr.Mgr, *mgr.Service, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to the service manager (run as administrator): %w", err)
+	}
+	s, err := m.OpenService(name)
+	if err != nil {
+		m.Disconnect()
+		return nil, nil, fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	return m, s, nil
+}
+
+func install(c Config) (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", fmt.Errorf("connect to the service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(c.Name); err == nil {
+		s.Close()
+		return "", fmt.Errorf("service %s already exists", c.Name)
+	}
+	s, err := m.CreateService(c.Name, c.Exe, mgr.Config{
+		DisplayName: "Vox vector memory engine (" + c.Name + ")",
+		Description: "Vector memory engine serving " + c.DataDir,
+		StartType:   mgr.StartAutomatic,
+	}, c.EngineArgs()...)
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+	// Restart after a crash, backing off, like Restart=on-failure does for
+	// the systemd unit.
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return "service " + c.Name, fmt.Errorf("set recovery actions: %w", err)
+	}
+	return "service " + c.Name, nil
+}
+
+func uninstall(c Config) error {
+	m, s, err := open(c.Name)
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+	if err := stopService(s); err != nil {
+		return err
+	}
+	return s.Delete()
+}
+
+func start(c Config) error {
+	m, s, err := open(c.Name)
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+	return s.Start()
+}
+
+func stop(c Config) error {
+	m, s, err := open(c.Name)
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+	return stopService(s)
+}
+
+// stopService stops s, if it runs, and waits until it has.
+func stopService(s *mgr.Service) error {
+	st, err := s.Control(svc.Stop)
+	if errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(daemon.DefaultStopTimeout + 15*time.Second)
+	for st.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not stop within %s", daemon.DefaultStopTimeout+15*time.Second)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if st, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"vox-vector-engine/internal/daemon"
+)
+
+// SystemdUnit returns the systemd unit file that runs c. It is generated on
+// every system so that it can be produced for another host.
+func SystemdUnit(c Config) string {
+	cmd := make([]string, 0, len(c.Args)+4)
+	for _, a := range append([]string{c.Exe}, c.EngineArgs()...) {
+		cmd = append(cmd, systemdQuote(a))
+	}
+	wantedBy := "multi-user.target"
+	if c.User {
+		wantedBy = "default.target"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=Vox vector memory engine (%s)\n", c.name())
+	fmt.Fprintf(&b, "After=network.target\n\n")
+	fmt.Fprintf(&b, "[Service]\n")
+	fmt.Fprintf(&b, "Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(cmd, " "))
+	fmt.Fprintf(&b, "Restart=on-failure\n")
+	fmt.Fprintf(&b, "RestartSec=5\n")
+	// The engine stops within daemon.DefaultStopTimeout; leave it time to
+	// close its stores before systemd kills it.
+	fmt.Fprintf(&b, "TimeoutStopSec=%d\n\n", int((daemon.DefaultStopTimeout).Seconds())+15)
+	fmt.Fprintf(&b, "[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=%s\n", wantedBy)
+	return b.String()
+}
+
+// systemdQuote quotes s for an ExecStart line: specifiers (%) and variable
+// expansion ($) are escaped, and words with spaces or quotes are quoted.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,426 @@
+// Package snapshot writes and restores point-in-time copies of a data directory.
+//
+// A snapshot is a directory named after its UTC creation time:
+//
+//	<data>/snapshots/20060102T150405Z/
+//	    manifest.json
+//	    vectors.bin    (used part of the mmap file)
+//	    metadata.db    (Bolt backup via tx.WriteTo)
+//	    index.hnsw     (gob-encoded index: HNSW graph or IVF lists)
+//	    namespaces/    (isolated namespace shards, same layout)
+//	    models/        (extra embedding spaces: <model>/model.json + namespaces/)
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+)
+
+const (
+	VectorsFile  = "vectors.bin"
+	MetadataFile = "metadata.db"
+	IndexFile    = "index.hnsw"
+	ManifestFile = "manifest.json"
+	ShardsDir    = "namespaces"
+	ModelsDir    = "models"
+)
+
+// Manifest describes a snapshot.
+type Manifest struct {
+	Name        string   `json:"name"`
+	CreatedUTC  string   `json:"created_utc"`
+	Dim         int      `json:"dim"`
+	VectorCount uint64   `json:"vector_count"`
+	Namespaces  []string `json:"namespaces,omitempty"`
+	// Models maps each embedding space in the snapshot to its dimension.
+	Models map[string]int `json:"models,omitempty"`
+}
+
+// NewDir creates a fresh timestamped snapshot directory under root.
+func NewDir(root string, now time.Time) (string, string, error) {
+	name := now.UTC().Format("20060102T150405Z")
+	dir := filepath.Join(root, name)
+	if _, err := os.Stat(dir); err == nil {
+		return "", "", fmt.Errorf("snapshot %s already exists", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	return dir, name, nil
+}
+
+// Write copies one set of stores into dir. Callers must block writers for the
+// duration so that vectors, metadata and graph agree with each other.
+func Write(dir string, vecs *storage.MmapVectorStore, meta storage.MetadataStore, idx index.Index) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, VectorsFile), func(w io.Writer) error {
+		_, err := vecs.WriteTo(w)
+		return err
+	}); err != nil {
+		return fmt.Errorf("snapshot vectors: %w", err)
+	}
+	if err := writeFile(filepath.Join(dir, MetadataFile), func(w io.Writer) error {
+		_, err := meta.Backup(w)
+		return err
+	}); err != nil {
+		return fmt.Errorf("snapshot metadata: %w", err)
+	}
+	if err := writeFile(filepath.Join(dir, IndexFile), idx.Save); err != nil {
+		return fmt.Errorf("snapshot index: %w", err)
+	}
+	return nil
+}
+
+// WriteManifest stores m as manifest.json in dir.
+func WriteManifest(dir string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFile), data, 0o644)
+}
+
+// ReadManifest loads manifest.json from dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Resolve returns the directory of the snapshot called name under root.
+// Names are single path elements; anything else is rejected.
+func Resolve(root, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid snapshot name: %q", name)
+	}
+	dir := filepath.Join(root, name)
+	if _, err := os.Stat(filepath.Join(dir, ManifestFile)); err != nil {
+		return "", fmt.Errorf("snapshot %s not found", name)
+	}
+	return dir, nil
+}
+
+// List returns the names of all snapshots under root, oldest first.
+func List(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, e.Name(), ManifestFile)); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RestoreFiles copies vectors.bin and metadata.db from snapDir into dataDir.
+// The stores for dataDir must be closed while this runs. Both files are
+// copied next to their targets and synced before either target is replaced,
+// and a failure at any point leaves dataDir as it was.
+func RestoreFiles(snapDir, dataDir string) error {
+	names := []string{VectorsFile, MetadataFile}
+	staged := make([]string, 0, len(names))
+	defer func() {
+		for _, tmp := range staged {
+			_ = os.Remove(tmp)
+		}
+	}()
+	for _, name := range names {
+		tmp, err := stageCopy(filepath.Join(snapDir, name), filepath.Join(dataDir, name))
+		if err != nil {
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+		staged = append(staged, tmp)
+	}
+
+	// Move each target aside before replacing it, so the ones already
+	// replaced can be put back if a later rename fails.
+	type swapped struct{ dst, old string }
+	var done []swapped
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if done[i].old == "" {
+				_ = os.Remove(done[i].dst)
+			} else {
+				_ = os.Rename(done[i].old, done[i].dst)
+			}
+		}
+	}
+	for i, name := range names {
+		dst := filepath.Join(dataDir, name)
+		sw := swapped{dst: dst}
+		if _, err := os.Lstat(dst); err == nil {
+			sw.old = dst + ".restore-old"
+			if err := os.Rename(dst, sw.old); err != nil {
+				rollback()
+				return fmt.Errorf("restore %s: %w", name, err)
+			}
+		}
+		if err := os.Rename(staged[i], dst); err != nil {
+			if sw.old != "" {
+				_ = os.Rename(sw.old, dst)
+			}
+			rollback()
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+		done = append(done, sw)
+	}
+	for _, sw := range done {
+		if sw.old != "" {
+			_ = os.RemoveAll(sw.old)
+		}
+	}
+	staged = nil
+	syncDir(dataDir)
+	return nil
+}
+
+// RestoreShards replaces shardRoot with the namespace shards stored in snapDir.
+// All shards must be closed while this runs. The shards are restored into a
+// sibling directory first, so a failure leaves shardRoot as it was.
+func RestoreShards(snapDir, shardRoot string) error {
+	return replaceDir(shardRoot, func(dir string) error {
+		return copyShards(snapDir, dir)
+	})
+}
+
+// copyShards copies the namespace shards stored in snapDir into shardRoot,
+// which must not be in use.
+func copyShards(snapDir, shardRoot string) error {
+	src := filepath.Join(snapDir, ShardsDir)
+	if err := os.MkdirAll(shardRoot, 0o755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dst := filepath.Join(shardRoot, e.Name())
+		if err := os.MkdirAll(dst, 0o755); err != nil {
+			return err
+		}
+		for _, name := range []string{VectorsFile, MetadataFile} {
+			if err := copyFile(filepath.Join(src, e.Name(), name), filepath.Join(dst, name)); err != nil {
+				return fmt.Errorf("namespace shard %s: restore %s: %w", e.Name(), name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteModel copies every namespace shard of sp, plus its model.json, into
+// dir/models/<model>. Callers must block writers as for Write.
+func WriteModel(dir string, sp *engine.ModelSpace) error {
+	modelDir := filepath.Join(dir, ModelsDir, sp.Name)
+	if err := os.MkdirAll(modelDir, 0o755); err != nil {
+		return err
+	}
+	if err := copyFile(filepath.Join(sp.Shards.Root(), engine.ModelManifestFile), filepath.Join(modelDir, engine.ModelManifestFile)); err != nil {
+		return fmt.Errorf("model %q: %w", sp.Name, err)
+	}
+	shards, err := sp.Shards.All()
+	if err != nil {
+		return fmt.Errorf("model %q: %w", sp.Name, err)
+	}
+	for _, sh := range shards {
+		vecs, ok := sh.Vectors.(*storage.MmapVectorStore)
+		if !ok {
+			return fmt.Errorf("model %q namespace %q: vector store %T does not support snapshots", sp.Name, sh.Namespace, sh.Vectors)
+		}
+		if err := Write(filepath.Join(modelDir, ShardsDir, filepath.Base(sh.Dir)), vecs, sh.Meta, sh.Index); err != nil {
+			return fmt.Errorf("model %q namespace %q: %w", sp.Name, sh.Namespace, err)
+		}
+	}
+	return nil
+}
+
+// RestoreModels replaces modelsRoot with the model spaces stored in snapDir.
+// All model spaces must be closed while this runs. As with RestoreShards, a
+// failure leaves modelsRoot as it was.
+func RestoreModels(snapDir, modelsRoot string) error {
+	names, err := engine.ListModelSpaces(filepath.Join(snapDir, ModelsDir))
+	if err != nil {
+		return err
+	}
+	return replaceDir(modelsRoot, func(dir string) error {
+		for _, name := range names {
+			src := filepath.Join(snapDir, ModelsDir, name)
+			dst := filepath.Join(dir, name)
+			if err := copyShards(src, dst); err != nil {
+				return fmt.Errorf("model %q: %w", name, err)
+			}
+			if err := copyFile(filepath.Join(src, engine.ModelManifestFile), filepath.Join(dst, engine.ModelManifestFile)); err != nil {
+				return fmt.Errorf("model %q: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// replaceDir fills a fresh sibling of dst with fill and then swaps it in
+// for dst. If fill or the swap fails, dst is left untouched.
+func replaceDir(dst string, fill func(dir string) error) error {
+	parent := filepath.Dir(dst)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(dst)+".restore-*")
+	if err != nil {
+		return err
+	}
+	if err := fill(tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+
+	old := ""
+	if _, err := os.Lstat(dst); err == nil {
+		old = tmp + "-old"
+		if err := os.Rename(dst, old); err != nil {
+			_ = os.RemoveAll(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		if old != "" {
+			_ = os.Rename(old, dst)
+		}
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	if old != "" {
+		_ = os.RemoveAll(old)
+	}
+	syncDir(parent)
+	return nil
+}
+
+// LoadIndex loads index.hnsw from snapDir into idx. It reports false when the
+// snapshot has no index file, in which case the caller should rebuild.
+func LoadIndex(snapDir string, idx index.Index) (bool, error) {
+	f, err := os.Open(filepath.Join(snapDir, IndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if err := idx.Load(f); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeFile writes path atomically: fn writes a temporary file in the same
+// directory, which is synced and then renamed over path. On error path is
+// left as it was and the temporary file is removed.
+func writeFile(path string, fn func(w io.Writer) error) error {
+	tmp, err := writeTemp(path, fn)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// writeTemp writes and syncs a temporary file next to path and returns its
+// name; the caller renames it into place or removes it.
+func writeTemp(path string, fn func(w io.Writer) error) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	err = fn(f)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// stageCopy copies src to a synced temporary file next to dst and returns
+// its name.
+func stageCopy(src, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	return writeTemp(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// syncDir makes renames in dir durable. Directories cannot be synced on
+// every platform (Windows refuses), so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,136 @@
+package snapshot
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkDir fails unless dir holds exactly the given files.
+func checkDir(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("%s holds %v, want %d files", dir, names, len(want))
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+}
+
+func TestRestoreFiles(t *testing.T) {
+	snap, data := t.TempDir(), t.TempDir()
+	writeFiles(t, snap, map[string]string{VectorsFile: "new vectors", MetadataFile: "new metadata"})
+	writeFiles(t, data, map[string]string{VectorsFile: "old vectors", MetadataFile: "old metadata"})
+
+	if err := RestoreFiles(snap, data); err != nil {
+		t.Fatal(err)
+	}
+	checkDir(t, data, map[string]string{VectorsFile: "new vectors", MetadataFile: "new metadata"})
+}
+
+func TestRestoreFilesMissingFileKeepsData(t *testing.T) {
+	snap, data := t.TempDir(), t.TempDir()
+	writeFiles(t, snap, map[string]string{VectorsFile: "new vectors"})
+	old := map[string]string{VectorsFile: "old vectors", MetadataFile: "old metadata"}
+	writeFiles(t, data, old)
+
+	if err := RestoreFiles(snap, data); err == nil {
+		t.Fatal("expected an error for a snapshot without metadata")
+	}
+	checkDir(t, data, old)
+}
+
+func TestRestoreFilesRollsBackAfterPartialSwap(t *testing.T) {
+	snap, data := t.TempDir(), t.TempDir()
+	writeFiles(t, snap, map[string]string{VectorsFile: "new vectors", MetadataFile: "new metadata"})
+	old := map[string]string{VectorsFile: "old vectors", MetadataFile: "old metadata"}
+	writeFiles(t, data, old)
+	// metadata.db cannot be moved aside onto a non-empty directory, so the
+	// restore fails after vectors.bin was already replaced.
+	blocker := filepath.Join(data, MetadataFile+".restore-old")
+	writeFiles(t, blocker, map[string]string{"x": ""})
+
+	if err := RestoreFiles(snap, data); err == nil {
+		t.Fatal("expected the metadata swap to fail")
+	}
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	checkDir(t, data, old)
+}
+
+func TestRestoreShardsFailureKeepsShards(t *testing.T) {
+	snap, data := t.TempDir(), t.TempDir()
+	root := filepath.Join(data, ShardsDir)
+	writeFiles(t, snap, map[string]string{
+		filepath.Join(ShardsDir, "a", VectorsFile):  "new a vectors",
+		filepath.Join(ShardsDir, "a", MetadataFile): "new a metadata",
+		filepath.Join(ShardsDir, "b", VectorsFile):  "new b vectors",
+	})
+	old := map[string]string{VectorsFile: "old vectors", MetadataFile: "old metadata"}
+	writeFiles(t, filepath.Join(root, "old"), old)
+
+	if err := RestoreShards(snap, root); err == nil {
+		t.Fatal("expected an error for a shard without metadata")
+	}
+	checkDir(t, filepath.Join(root, "old"), old)
+	if entries, _ := os.ReadDir(data); len(entries) != 1 {
+		t.Errorf("expected only %s in the data dir, got %d entries", ShardsDir, len(entries))
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("expected only the old shard, got %d entries", len(entries))
+	}
+
+	writeFiles(t, snap, map[string]string{filepath.Join(ShardsDir, "b", MetadataFile): "new b metadata"})
+	if err := RestoreShards(snap, root); err != nil {
+		t.Fatal(err)
+	}
+	checkDir(t, filepath.Join(root, "b"), map[string]string{VectorsFile: "new b vectors", MetadataFile: "new b metadata"})
+	if _, err := os.Stat(filepath.Join(root, "old")); !os.IsNotExist(err) {
+		t.Errorf("expected the old shard to be replaced, got %v", err)
+	}
+}
+
+func TestWriteFileFailureKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"f": "old"})
+
+	failed := errors.New("write failed")
+	err := writeFile(filepath.Join(dir, "f"), func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("writeFile = %v, want %v", err, failed)
+	}
+	checkDir(t, dir, map[string]string{"f": "old"})
+}
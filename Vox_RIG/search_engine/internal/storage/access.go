@@ -0,0 +1,13 @@
+package storage
+
+import "vox-vector-engine/internal/types"
+
+// mergeAccess adds a newly recorded access to the logged one: counts add up
+// and Last only moves forward.
+func mergeAccess(prev, a types.ChunkAccess) types.ChunkAccess {
+	prev.Count += a.Count
+	if a.Last.After(prev.Last) {
+		prev.Last = a.Last
+	}
+	return prev
+}
@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	// adjSlotSize is the size of one slot: record offset (uint64), record
+	// length and capacity (uint32 each). Offset 0 marks an empty slot.
+	adjSlotSize = 16
+	// adjHeaderSize is the magic at the start of the records file, which
+	// also keeps every record offset above 0.
+	adjHeaderSize = 8
+	// adjWindow is the span of the read windows of both files.
+	adjWindow = 1 << 20
+	// adjMappedRecord is the largest record read through a window; longer
+	// ones, nodes with thousands of links, are read with pread.
+	adjMappedRecord = 16 << 10
+	// adjScanChunk is how many slots IDs reads at once.
+	adjScanChunk = 4096
+)
+
+var adjMagic = [adjHeaderSize]byte{'V', 'O', 'X', 'A', 'D', 'J', '0', '1'}
+
+// AdjacencyFile keeps the link lists of graph nodes on disk so an index
+// over a huge store holds only the nodes it is using in memory. It is
+// scratch space, not a durable format: CreateAdjacencyFile makes a new pair
+// of files and Close deletes them.
+//
+// A slots file holds one fixed-size slot per ID (IDs are vector store IDs,
+// so dense), pointing into a records file of variable-length records. A
+// record is rewritten in place while it fits its capacity and otherwise
+// moved to the end of the file with room to grow, since link lists grow as
+// neighbors are inserted. The space of moved and deleted records is only
+// reclaimed by building a new file. Both files are read through windowMap
+// and written with pwrite, as MmapVectorStore does with MapWindow.
+//
+// It is safe for concurrent use.
+type AdjacencyFile struct {
+	mu        sync.RWMutex
+	slots     *os.File
+	records   *os.File
+	slotWin   *windowMap
+	recordWin *windowMap
+	slotsSize int64
+	tail      int64
+	count     int
+	// garbage is the size of records no slot points at any more.
+	garbage int64
+}
+
+// CreateAdjacencyFile creates an empty adjacency file in dir under a unique
+// name, so processes sharing dir do not collide.
+func CreateAdjacencyFile(dir string) (*AdjacencyFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create adjacency dir: %w", err)
+	}
+	records, err := os.CreateTemp(dir, "hnsw-*.adj")
+	if err != nil {
+		return nil, fmt.Errorf("create adjacency file: %w", err)
+	}
+	slots, err := os.Create(records.Name() + ".slots")
+	if err != nil {
+		_ = records.Close()
+		_ = os.Remove(records.Name())
+		return nil, fmt.Errorf("create adjacency file: %w", err)
+	}
+	a := &AdjacencyFile{
+		slots:     slots,
+		records:   records,
+		slotWin:   newWindowMap(slots, adjWindow, adjSlotSize, DefaultMapWindows),
+		recordWin: newWindowMap(records, adjWindow, adjMappedRecord, DefaultMapWindows),
+	}
+	if err := a.resetLocked(); err != nil {
+		_ = a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Path returns the path of the records file; the slots file is next to it.
+func (a *AdjacencyFile) Path() string {
+	return a.records.Name()
+}
+
+// Len returns how many IDs have a record.
+func (a *AdjacencyFile) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.count
+}
+
+// Size returns the bytes the records file takes and how many of them
+// belong to moved or deleted records.
+func (a *AdjacencyFile) Size() (size, garbage int64) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.tail, a.garbage
+}
+
+type adjSlot struct {
+	off       int64
+	len, size uint32
+}
+
+// slot reads the slot of id; the zero slot means no record.
+func (a *AdjacencyFile) slot(id uint64) (adjSlot, error) {
+	off := int64(id) * adjSlotSize
+	if off+adjSlotSize > a.slotsSize {
+		return adjSlot{}, nil
+	}
+	var b [adjSlotSize]byte
+	if err := a.slotWin.read(off, b[:], a.slotsSize); err != nil {
+		return adjSlot{}, err
+	}
+	return adjSlot{
+		off:  int64(binary.LittleEndian.Uint64(b[0:])),
+		len:  binary.LittleEndian.Uint32(b[8:]),
+		size: binary.LittleEndian.Uint32(b[12:]),
+	}, nil
+}
+
+func (a *AdjacencyFile) setSlot(id uint64, s adjSlot) error {
+	var b [adjSlotSize]byte
+	binary.LittleEndian.PutUint64(b[0:], uint64(s.off))
+	binary.LittleEndian.PutUint32(b[8:], s.len)
+	binary.LittleEndian.PutUint32(b[12:], s.size)
+	off := int64(id) * adjSlotSize
+	if _, err := a.slots.WriteAt(b[:], off); err != nil {
+		return fmt.Errorf("write adjacency slot %d: %w", id, err)
+	}
+	a.slotsSize = max(a.slotsSize, off+adjSlotSize)
+	return nil
+}
+
+// Has reports whether id has a record.
+func (a *AdjacencyFile) Has(id uint64) (bool, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	s, err := a.slot(id)
+	return s.off != 0, err
+}
+
+// Read returns the level and link lists stored for id; ok is false when
+// it has none.
+func (a *AdjacencyFile) Read(id uint64) (level int, links [][]uint64, ok bool, err error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	s, err := a.slot(id)
+	if err != nil || s.off == 0 {
+		return 0, nil, false, err
+	}
+	buf := make([]byte, s.len)
+	if len(buf) <= adjMappedRecord {
+		err = a.recordWin.read(s.off, buf, a.tail)
+	} else {
+		_, err = a.records.ReadAt(buf, s.off)
+	}
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("read adjacency record %d: %w", id, err)
+	}
+	level, links, err = decodeAdjacency(buf)
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("adjacency record %d: %w", id, err)
+	}
+	return level, links, true, nil
+}
+
+// Write stores the level and link lists of id, replacing any record.
+func (a *AdjacencyFile) Write(id uint64, level int, links [][]uint64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	buf := encodeAdjacency(level, links)
+	s, err := a.slot(id)
+	if err != nil {
+		return err
+	}
+	if s.off == 0 {
+		a.count++
+	} else if len(buf) > int(s.size) {
+		a.garbage += int64(s.size)
+		s.off = 0
+	}
+	s.len = uint32(len(buf))
+	if s.off == 0 {
+		// Leave room for the back links later inserts add. The room is
+		// written too, so windows never map past the end of the file.
+		s.off, s.size = a.tail, uint32(len(buf)+len(buf)/2)
+		buf = append(buf, make([]byte, int(s.size)-len(buf))...)
+		a.tail += int64(s.size)
+	}
+	if _, err := a.records.WriteAt(buf, s.off); err != nil {
+		return fmt.Errorf("write adjacency record %d: %w", id, err)
+	}
+	return a.setSlot(id, s)
+}
+
+// Delete drops the record of id, if any.
+func (a *AdjacencyFile) Delete(id uint64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, err := a.slot(id)
+	if err != nil || s.off == 0 {
+		return err
+	}
+	a.count--
+	a.garbage += int64(s.size)
+	return a.setSlot(id, adjSlot{})
+}
+
+// IDs returns the IDs with a record, in ascending order.
+func (a *AdjacencyFile) IDs() ([]uint64, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ids := make([]uint64, 0, a.count)
+	buf := make([]byte, adjScanChunk*adjSlotSize)
+	for off := int64(0); off < a.slotsSize; off += int64(len(buf)) {
+		n, err := a.slots.ReadAt(buf[:min(int64(len(buf)), a.slotsSize-off)], off)
+		if err != nil {
+			return nil, fmt.Errorf("read adjacency slots: %w", err)
+		}
+		for i := 0; i+adjSlotSize <= n; i += adjSlotSize {
+			if binary.LittleEndian.Uint64(buf[i:]) != 0 {
+				ids = append(ids, uint64(off+int64(i))/adjSlotSize)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Reset drops every record and truncates both files.
+func (a *AdjacencyFile) Reset() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.resetLocked()
+}
+
+func (a *AdjacencyFile) resetLocked() error {
+	a.slotWin.close()
+	a.recordWin.close()
+	if err := a.slots.Truncate(0); err != nil {
+		return fmt.Errorf("truncate adjacency slots: %w", err)
+	}
+	if err := a.records.Truncate(0); err != nil {
+		return fmt.Errorf("truncate adjacency file: %w", err)
+	}
+	if _, err := a.records.WriteAt(adjMagic[:], 0); err != nil {
+		return fmt.Errorf("write adjacency header: %w", err)
+	}
+	a.slotsSize, a.tail, a.count, a.garbage = 0, adjHeaderSize, 0, 0
+	return nil
+}
+
+// Close unmaps, closes and deletes both files.
+func (a *AdjacencyFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.records == nil {
+		return nil
+	}
+	a.slotWin.close()
+	a.recordWin.close()
+	var errs []error
+	for _, f := range []*os.File{a.slots, a.records} {
+		errs = append(errs, f.Close(), os.Remove(f.Name()))
+	}
+	a.slots, a.records = nil, nil
+	return errors.Join(errs...)
+}
+
+// encodeAdjacency lays out a record: level and list count (uint32 each),
+// then each list as its length (uint32) and IDs (uint64).
+func encodeAdjacency(level int, links [][]uint64) []byte {
+	n := 8
+	for _, l := range links {
+		n += 4 + 8*len(l)
+	}
+	buf := make([]byte, n)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(level))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(links)))
+	off := 8
+	for _, l := range links {
+		binary.LittleEndian.PutUint32(buf[off:], uint32(len(l)))
+		off += 4
+		for _, id := range l {
+			binary.LittleEndian.PutUint64(buf[off:], id)
+			off += 8
+		}
+	}
+	return buf
+}
+
+func decodeAdjacency(buf []byte) (int, [][]uint64, error) {
+	if len(buf) < 8 {
+		return 0, nil, fmt.Errorf("truncated record")
+	}
+	level := int(binary.LittleEndian.Uint32(buf[0:]))
+	links := make([][]uint64, binary.LittleEndian.Uint32(buf[4:]))
+	off := 8
+	for i := range links {
+		if off+4 > len(buf) {
+			return 0, nil, fmt.Errorf("truncated record")
+		}
+		n := int(binary.LittleEndian.Uint32(buf[off:]))
+		off += 4
+		if off+8*n > len(buf) {
+			return 0, nil, fmt.Errorf("truncated record")
+		}
+		links[i] = make([]uint64, n)
+		for j := range links[i] {
+			links[i][j] = binary.LittleEndian.Uint64(buf[off:])
+			off += 8
+		}
+	}
+	return level, links, nil
+}
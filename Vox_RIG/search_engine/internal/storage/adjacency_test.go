@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAdjacencyFile(t *testing.T) {
+	dir := t.TempDir()
+	a, err := CreateAdjacencyFile(dir)
+	if err != nil {
+		t.Fatalf("Failed to create adjacency file: %v", err)
+	}
+
+	want := map[uint64][][]uint64{}
+	for id := uint64(0); id < 3000; id += 3 {
+		links := [][]uint64{{id + 1, id + 2}}
+		if id%2 == 0 {
+			links = append(links, []uint64{id + 4})
+		}
+		if err := a.Write(id, len(links)-1, links); err != nil {
+			t.Fatalf("Write %d failed: %v", id, err)
+		}
+		want[id] = links
+	}
+	// Grow a record past its room, so it moves, and one beyond a window.
+	want[3] = append(want[3], make([]uint64, 40))
+	long := make([]uint64, 3000)
+	for i := range long {
+		long[i] = uint64(i)
+	}
+	want[6] = [][]uint64{long}
+	for _, id := range []uint64{3, 6} {
+		if err := a.Write(id, len(want[id])-1, want[id]); err != nil {
+			t.Fatalf("Write %d failed: %v", id, err)
+		}
+	}
+	if err := a.Delete(9); err != nil {
+		t.Fatal(err)
+	}
+	delete(want, 9)
+
+	if a.Len() != len(want) {
+		t.Errorf("Expected %d records, got %d", len(want), a.Len())
+	}
+	if _, garbage := a.Size(); garbage == 0 {
+		t.Error("Expected the moved and deleted records to count as garbage")
+	}
+	for id, links := range want {
+		level, got, ok, err := a.Read(id)
+		if err != nil || !ok || level != len(links)-1 || !reflect.DeepEqual(got, links) {
+			t.Fatalf("Read %d = %d %v %v %v, want %v", id, level, got, ok, err, links)
+		}
+	}
+	for _, id := range []uint64{1, 9, 1 << 20} {
+		if ok, err := a.Has(id); ok || err != nil {
+			t.Errorf("Expected no record for %d, got %v %v", id, ok, err)
+		}
+	}
+	ids, err := a.IDs()
+	if err != nil || len(ids) != len(want) || ids[0] != 0 || ids[1] != 3 || ids[3] != 12 {
+		t.Errorf("Expected the IDs in order without 9, got %d IDs %v", len(ids), err)
+	}
+
+	if err := a.Reset(); err != nil || a.Len() != 0 {
+		t.Fatalf("Expected an empty file after Reset, got %d records %v", a.Len(), err)
+	}
+	if _, _, ok, _ := a.Read(0); ok {
+		t.Error("Expected Reset to drop every record")
+	}
+
+	path := a.Path()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{path, path + ".slots"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Expected Close to delete %s, got %v", p, err)
+		}
+	}
+}
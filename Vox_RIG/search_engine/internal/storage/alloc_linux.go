@@ -0,0 +1,28 @@
+//go:build linux
+
+package storage
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocate grows f to size bytes with its blocks reserved (fallocate), so
+// the file is laid out in few extents rather than wherever pages are first
+// written. Filesystems without fallocate get a sparse extension instead.
+func allocate(f *os.File, size int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size <= fi.Size() {
+		return f.Truncate(size)
+	}
+	err = unix.Fallocate(int(f.Fd()), 0, fi.Size(), size-fi.Size())
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+		return f.Truncate(size)
+	}
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package storage
+
+import "os"
+
+// allocate grows f to size bytes. This platform has no portable way to
+// reserve blocks, so the file is extended sparsely.
+func allocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
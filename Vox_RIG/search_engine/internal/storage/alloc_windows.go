@@ -0,0 +1,50 @@
+//go:build windows
+
+package storage
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocate grows f to size bytes with its clusters reserved (the file's
+// allocation size), so NTFS can lay it out in few extents instead of
+// growing it as pages are first written. SetFileValidData would also skip
+// zero-filling, but it needs SeManageVolumePrivilege and would expose the
+// disk's previous contents, so the valid data length is left to NTFS.
+func allocate(f *os.File, size int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size > fi.Size() {
+		reserveClusters(f, size)
+	}
+	return f.Truncate(size)
+}
+
+// reserveClusters sets the allocation size of f to size bytes. A filesystem
+// that cannot reserve clusters still gets the extension, so errors are
+// ignored.
+func reserveClusters(f *os.File, size int64) {
+	info := struct{ AllocationSize int64 }{size}
+	_ = windows.SetFileInformationByHandle(windows.Handle(f.Fd()), windows.FileAllocationInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+}
+
+// diskUsage returns the bytes f occupies on disk (its allocation size),
+// which is less than its length for a sparse or compressed file.
+func diskUsage(f *os.File) (int64, error) {
+	var info struct {
+		AllocationSize int64
+		EndOfFile      int64
+		NumberOfLinks  uint32
+		DeletePending  bool
+		Directory      bool
+	}
+	if err := windows.GetFileInformationByHandleEx(windows.Handle(f.Fd()), windows.FileStandardInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		return 0, err
+	}
+	return info.AllocationSize, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import "fmt"
+
+// MetadataBackend selects the MetadataStore implementation (the -meta flag).
+// The zero value is Bolt.
+type MetadataBackend string
+
+const (
+	BoltBackend   MetadataBackend = "bolt"
+	SQLiteBackend MetadataBackend = "sqlite"
+)
+
+// ParseMetadataBackend validates a -meta value; "" means Bolt.
+func ParseMetadataBackend(s string) (MetadataBackend, error) {
+	switch b := MetadataBackend(s); b {
+	case "", BoltBackend:
+		return BoltBackend, nil
+	case SQLiteBackend:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unknown metadata backend %q (want bolt or sqlite)", s)
+	}
+}
+
+// Open opens (or creates) the store at path. Both backends use the same
+// file name (metadata.db), so snapshots and shards keep one layout; opening
+// a file written by the other backend fails rather than corrupting it.
+func (b MetadataBackend) Open(path string) (MetadataStore, error) {
+	switch b {
+	case "", BoltBackend:
+		s, err := NewBoltMetadataStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case SQLiteBackend:
+		s, err := NewSQLiteMetadataStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown metadata backend %q", string(b))
+	}
+}
+
+// OpenReadOnly opens an existing store at path without write access; see
+// NewBoltMetadataStoreReadOnly for Bolt's locking caveat.
+func (b MetadataBackend) OpenReadOnly(path string) (MetadataStore, error) {
+	switch b {
+	case "", BoltBackend:
+		s, err := NewBoltMetadataStoreReadOnly(path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case SQLiteBackend:
+		s, err := NewSQLiteMetadataStoreReadOnly(path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown metadata backend %q", string(b))
+	}
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// TestMetadataBackends runs the same checks against every backend compiled
+// into the binary and the in-memory fake; SQLite is skipped unless built
+// with -tags sqlite.
+func TestMetadataBackends(t *testing.T) {
+	for _, b := range []MetadataBackend{BoltBackend, SQLiteBackend} {
+		t.Run(string(b), func(t *testing.T) {
+			if b == SQLiteBackend && !slices.Contains(sql.Drivers(), sqliteDriver) {
+				t.Skip("sqlite driver not compiled in (-tags sqlite)")
+			}
+			s, err := b.Open(filepath.Join(t.TempDir(), "metadata.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			testMetadataStore(t, s)
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testMetadataStore(t, NewMemoryMetadataStore())
+	})
+}
+
+func testMetadataStore(t *testing.T, s MetadataStore) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	doc := types.Document{ID: "a.go", Source: "src/a.go", Timestamp: ts, Metadata: map[string]interface{}{"namespace": "proj"}, Tags: []string{"bug", "decision"}}
+	chunks := []types.Chunk{
+		{ID: 10, DocID: "a.go", Content: "ten", StartLine: 1, EndLine: 5},
+		{ID: 2, DocID: "a.go", Content: "two", Metadata: map[string]interface{}{"k": "v"}},
+	}
+	gen := s.Generation()
+	if err := s.SaveDocumentWithChunks(doc, chunks); err != nil {
+		t.Fatal(err)
+	}
+	if s.Generation() == gen {
+		t.Errorf("Expected generation to change after a write")
+	}
+	if err := s.SaveDocumentWithChunks(types.Document{ID: "b.go", Metadata: map[string]interface{}{"namespace": "other"}},
+		[]types.Chunk{{ID: 5, DocID: "b.go", Content: "five"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetDocument("a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Source != "src/a.go" || !got.Timestamp.Equal(ts) || got.Metadata["namespace"] != "proj" || fmt.Sprint(got.Tags) != "[bug decision]" {
+		t.Errorf("GetDocument = %+v", got)
+	}
+	if _, err := s.GetDocument("missing"); err == nil {
+		t.Errorf("Expected error for missing document")
+	}
+	c, err := s.GetChunk(2)
+	if err != nil || c.Content != "two" || c.Metadata["k"] != "v" {
+		t.Errorf("GetChunk(2) = %+v, %v", c, err)
+	}
+	if _, err := s.GetChunk(99); err == nil {
+		t.Errorf("Expected error for missing chunk")
+	}
+
+	ids := func(cs []types.Chunk) string {
+		var out []uint64
+		for _, c := range cs {
+			out = append(out, c.ID)
+		}
+		return fmt.Sprint(out)
+	}
+	if cs, _ := s.DocumentChunks("a.go"); ids(cs) != "[2 10]" {
+		t.Errorf("DocumentChunks = %s", ids(cs))
+	}
+	if cs, _ := s.GetChunkRange(3, 11); ids(cs) != "[5 10]" {
+		t.Errorf("GetChunkRange(3, 11) = %s", ids(cs))
+	}
+	if got, _ := s.GetChunks([]uint64{10, 99, 5}); len(got) != 2 || got[10].Content != "ten" || got[5].Content != "five" {
+		t.Errorf("GetChunks = %+v", got)
+	}
+	if docs, _ := s.ListDocuments("proj"); len(docs) != 1 || docs[0].ID != "a.go" {
+		t.Errorf("ListDocuments(proj) = %+v", docs)
+	}
+	if err := s.SetTags("b.go", []string{"bug"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTags("missing", []string{"bug"}); err == nil {
+		t.Errorf("Expected error tagging a missing document")
+	}
+	if ids, _ := s.TaggedDocuments("bug"); fmt.Sprint(ids) != "[a.go b.go]" {
+		t.Errorf("TaggedDocuments(bug) = %v", ids)
+	}
+	// Re-saving a document replaces its index entries.
+	doc.Tags = []string{"decision"}
+	if err := s.SaveDocument(doc); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := s.TaggedDocuments("bug"); fmt.Sprint(ids) != "[b.go]" {
+		t.Errorf("TaggedDocuments(bug) after re-save = %v", ids)
+	}
+	if id, ok, _ := s.MaxChunkID(); !ok || id != 10 {
+		t.Errorf("MaxChunkID = %d, %v", id, ok)
+	}
+	var all []types.Chunk
+	s.ForEachChunk(func(c types.Chunk) error {
+		all = append(all, c)
+		return nil
+	})
+	if ids(all) != "[2 5 10]" {
+		t.Errorf("ForEachChunk order = %s", ids(all))
+	}
+	if n, _ := s.ChunkCount(); n != 3 {
+		t.Errorf("ChunkCount = %d", n)
+	}
+
+	chunkID := uint64(5)
+	if err := s.SavePin(types.Pin{Namespace: "other", ChunkID: &chunkID, CreatedAt: ts}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetState("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.GetState("k"); v != "v" {
+		t.Errorf("GetState = %q", v)
+	}
+
+	gen = s.Generation()
+	later := ts.Add(time.Hour)
+	if err := s.RecordAccess(map[uint64]types.ChunkAccess{2: {Count: 2, Last: later}, 10: {Count: 1, Last: ts}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordAccess(map[uint64]types.ChunkAccess{2: {Count: 1, Last: ts}}); err != nil {
+		t.Fatal(err)
+	}
+	access, err := s.GetAccess([]uint64{2, 10, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(access) != 2 || access[2].Count != 3 || !access[2].Last.Equal(later) || access[10].Count != 1 {
+		t.Errorf("GetAccess = %+v", access)
+	}
+	if s.Generation() != gen {
+		t.Errorf("Expected the access log to leave the generation alone")
+	}
+	if err := s.DeleteAccess([]uint64{10}); err != nil {
+		t.Fatal(err)
+	}
+	if access, _ := s.GetAccess([]uint64{10}); len(access) != 0 {
+		t.Errorf("Expected the access log of chunk 10 to be gone, got %+v", access)
+	}
+
+	if nsIDs, _ := s.NamespaceChunkIDs("proj"); fmt.Sprint(nsIDs) != "[2 10]" {
+		t.Errorf("NamespaceChunkIDs = %v", nsIDs)
+	}
+	docIDs, chunkIDs, err := s.DeleteNamespace("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(docIDs) != "[b.go]" || fmt.Sprint(chunkIDs) != "[5]" {
+		t.Errorf("DeleteNamespace = %v, %v", docIDs, chunkIDs)
+	}
+	if pins, _ := s.ListPins("other"); len(pins) != 0 {
+		t.Errorf("Expected pins of the deleted namespace to be gone, got %v", pins)
+	}
+	removed, err := s.DeleteDocument("a.go")
+	if err != nil || fmt.Sprint(removed) != "[2 10]" {
+		t.Errorf("DeleteDocument = %v, %v", removed, err)
+	}
+	for _, tag := range []string{"bug", "decision"} {
+		if ids, _ := s.TaggedDocuments(tag); len(ids) != 0 {
+			t.Errorf("Expected no documents tagged %s after deletes, got %v", tag, ids)
+		}
+	}
+
+	var buf bytes.Buffer
+	if n, err := s.Backup(&buf); err != nil || n == 0 || int64(buf.Len()) != n {
+		t.Errorf("Backup = %d, %v (buffer %d)", n, err, buf.Len())
+	}
+}
+
+func TestParseMetadataBackend(t *testing.T) {
+	if b, err := ParseMetadataBackend(""); err != nil || b != BoltBackend {
+		t.Errorf("ParseMetadataBackend(\"\") = %q, %v", b, err)
+	}
+	if b, err := ParseMetadataBackend("sqlite"); err != nil || b != SQLiteBackend {
+		t.Errorf("ParseMetadataBackend(sqlite) = %q, %v", b, err)
+	}
+	if _, err := ParseMetadataBackend("postgres"); err == nil {
+		t.Errorf("Expected error for unknown backend")
+	}
+}
@@ -0,0 +1,48 @@
+package storage
+
+import "vox-vector-engine/internal/types"
+
+// DefaultChangesLimit caps Changes calls that pass limit <= 0.
+const DefaultChangesLimit = 1000
+
+func changesLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultChangesLimit
+	}
+	return limit
+}
+
+// documentChange records a saved document, with the chunks saved alongside.
+func documentChange(doc types.Document, chunks []types.Chunk) types.Change {
+	ns, _ := doc.Metadata["namespace"].(string)
+	return types.Change{Op: types.ChangeDocument, DocID: doc.ID, Namespace: ns, ChunkIDs: chunkIDsOf(chunks)}
+}
+
+// chunksChange records chunks saved without their document; ns is the
+// namespace of the document they point at, if it is stored.
+func chunksChange(ns string, chunks []types.Chunk) types.Change {
+	c := types.Change{Op: types.ChangeChunks, Namespace: ns, ChunkIDs: chunkIDsOf(chunks)}
+	if len(chunks) > 0 {
+		c.DocID = chunks[0].DocID
+	}
+	return c
+}
+
+func pinChange(op string, p types.Pin) types.Change {
+	return types.Change{Op: op, Namespace: p.Namespace, DocID: p.DocID, Pin: &p}
+}
+
+func templateChange(t types.ContextTemplate) types.Change {
+	return types.Change{Op: types.ChangeTemplate, Namespace: t.Namespace, Template: &t}
+}
+
+func chunkIDsOf(chunks []types.Chunk) []uint64 {
+	if len(chunks) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(chunks))
+	for i, c := range chunks {
+		ids[i] = c.ID
+	}
+	return ids
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrTornTail is returned by CheckVectorFile for a file whose header counts
+// more vectors than the file holds, e.g. after a crash during growth or a
+// copy cut short. Opening such a file fails; TruncateTornTail repairs it.
+var ErrTornTail = errors.New("header counts vectors past the end of the file")
+
+// VectorFileCheck describes the header of one vectors file.
+type VectorFileCheck struct {
+	Path string `json:"path"`
+	Dim  int    `json:"dim"`
+	// Count is the vector count in the header; Holds is how many whole
+	// vectors the file has room for, which is more for a file with spare
+	// capacity and less for a torn one.
+	Count uint64 `json:"count"`
+	Holds uint64 `json:"holds"`
+	Bytes int64  `json:"bytes"`
+	// Meta is the header's metadata block (implied for version 1 files).
+	Meta FileMeta `json:"meta"`
+}
+
+// CheckVectorFile reads and validates the header of the vectors file path
+// without mapping it, so it also works on files the stores refuse to open.
+// dim, when not 0, is the dimension the file must have.
+func CheckVectorFile(path string, dim int) (VectorFileCheck, error) {
+	c := VectorFileCheck{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return c, err
+	}
+	c.Bytes = fi.Size()
+
+	h, err := readHeader(f)
+	if err != nil {
+		return c, err
+	}
+	c.Dim, c.Count, c.Meta = int(h.dim), h.count, h.meta
+	c.Holds = uint64(c.Bytes-h.size) / uint64(c.Dim*vectorSize)
+	if dim != 0 && c.Dim != dim {
+		return c, fmt.Errorf("vector dimension mismatch: file dim=%d, requested dim=%d", c.Dim, dim)
+	}
+	if c.Count > c.Holds {
+		return c, fmt.Errorf("%w: count=%d holds=%d", ErrTornTail, c.Count, c.Holds)
+	}
+	return c, nil
+}
+
+// TruncateTornTail lowers the header count of a torn vectors file to the
+// vectors it holds. The vectors past the end are lost; chunks that pointed
+// at them must be re-ingested. A file that is not torn is left alone.
+func TruncateTornTail(path string) (VectorFileCheck, error) {
+	c, err := CheckVectorFile(path, 0)
+	if !errors.Is(err, ErrTornTail) {
+		return c, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return c, err
+	}
+	var count [8]byte
+	binary.LittleEndian.PutUint64(count[:], c.Holds)
+	if _, err := f.WriteAt(count[:], 16); err != nil {
+		f.Close()
+		return c, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return c, err
+	}
+	if err := f.Close(); err != nil {
+		return c, err
+	}
+	c.Count = c.Holds
+	return c, nil
+}
+
+// VectorFiles returns the vectors files of the stores in dir: vectors.bin,
+// or the segment files of a segment directory, in ID order.
+func VectorFiles(dir string) ([]string, error) {
+	segDir := filepath.Join(dir, SegmentsDir)
+	if _, err := os.Stat(filepath.Join(segDir, SegmentManifestFile)); err != nil {
+		path := filepath.Join(dir, VectorsFile)
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(segDir)
+	if err != nil {
+		return nil, err
+	}
+	idx := map[string]int{}
+	var paths []string
+	for _, e := range entries {
+		if i, ok := parseSegmentFileName(e.Name()); ok {
+			p := filepath.Join(segDir, e.Name())
+			idx[p] = i
+			paths = append(paths, p)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return idx[paths[i]] < idx[paths[j]] })
+	return paths, nil
+}
+
+// IndexChecker is implemented by metadata stores that keep secondary
+// indexes next to their records: Bolt's tag index and SQLite's SQL indexes.
+// (Bolt has no document-to-chunks index; DocumentChunks scans the chunks.)
+type IndexChecker interface {
+	// CheckIndexes describes the index entries that disagree with the
+	// records they index; none means the indexes are sound.
+	CheckIndexes() ([]string, error)
+	// RebuildIndexes rebuilds every secondary index from the records.
+	RebuildIndexes() error
+}
+
+var (
+	_ IndexChecker = (*BoltMetadataStore)(nil)
+	_ IndexChecker = (*SQLiteMetadataStore)(nil)
+)
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FormatVersion is the version of the vectors files this build writes.
+// Version 1 files (a 24-byte header of magic, dim and count) are migrated
+// to it when opened for writing and read as they are otherwise.
+const FormatVersion = 2
+
+// Values of FileMeta.Metric and FileMeta.Codec.
+const (
+	MetricL2     = "l2"
+	CodecFloat32 = "float32"
+	// MixedModels is FileMeta.Model for a file holding the vectors of
+	// namespaces tagged with different embedding models.
+	MixedModels = "mixed"
+)
+
+// FileMeta is the metadata block of a version 2 vectors file, stored as JSON
+// in its header so tools can interpret the file on their own.
+type FileMeta struct {
+	FormatVersion int `json:"format_version"`
+	Dim           int `json:"dim"`
+	// Metric is the distance the vectors are ranked by and Codec how each
+	// vector is encoded: dim little-endian float32s.
+	Metric string `json:"metric"`
+	Codec  string `json:"codec"`
+	// Model is the embedding model the vectors were tagged with (see
+	// SetFileModel); empty until one is.
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// MigratedFrom is the format version the file was converted from;
+	// CreatedAt is then the time of the migration.
+	MigratedFrom int `json:"migrated_from,omitempty"`
+}
+
+func newFileMeta(dim int) FileMeta {
+	return FileMeta{FormatVersion: FormatVersion, Dim: dim, Metric: MetricL2, Codec: CodecFloat32, CreatedAt: time.Now().UTC()}
+}
+
+// encodeHeader returns the HeaderSize-byte header of a version 2 file.
+func encodeHeader(meta FileMeta, count uint64) ([]byte, error) {
+	block, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if len(block) > HeaderSize-metaOffset {
+		return nil, fmt.Errorf("vectors file metadata is %d bytes, more than the %d the header holds", len(block), HeaderSize-metaOffset)
+	}
+	header := make([]byte, HeaderSize)
+	copy(header[:8], fileMagic[:])
+	binary.LittleEndian.PutUint64(header[8:16], uint64(meta.Dim))
+	binary.LittleEndian.PutUint64(header[16:24], count)
+	binary.LittleEndian.PutUint32(header[24:28], uint32(len(block)))
+	copy(header[metaOffset:], block)
+	return header, nil
+}
+
+// fileHeader is a decoded vectors file header.
+type fileHeader struct {
+	version int
+	dim     uint64
+	count   uint64
+	// size is where the vectors start.
+	size int64
+	meta FileMeta
+}
+
+// decodeHeader parses the header at the start of data, which holds at least
+// headerSizeV1 bytes and, for a version 2 file, all HeaderSize of them.
+// Version 1 files get the metadata their format implies.
+func decodeHeader(data []byte) (fileHeader, error) {
+	var h fileHeader
+	if len(data) < headerSizeV1 {
+		return h, fmt.Errorf("vectors file too small for header: %d < %d", len(data), headerSizeV1)
+	}
+	switch [8]byte(data[:8]) {
+	case fileMagic:
+		h.version, h.size = FormatVersion, HeaderSize
+	case fileMagicV1:
+		h.version, h.size = 1, headerSizeV1
+	default:
+		return h, errors.New("invalid vectors file header (magic mismatch)")
+	}
+	h.dim = binary.LittleEndian.Uint64(data[8:16])
+	h.count = binary.LittleEndian.Uint64(data[16:24])
+	if h.dim == 0 {
+		return h, errors.New("invalid vectors file header (dim=0)")
+	}
+	h.meta = FileMeta{FormatVersion: h.version, Dim: int(h.dim), Metric: MetricL2, Codec: CodecFloat32}
+	if h.version == 1 {
+		return h, nil
+	}
+	if len(data) < HeaderSize {
+		return h, fmt.Errorf("vectors file too small for header: %d < %d", len(data), HeaderSize)
+	}
+	// The block only describes the file; an unreadable one must not keep the
+	// vectors from opening, so it is replaced by the implied metadata.
+	n := int(binary.LittleEndian.Uint32(data[24:28]))
+	var meta FileMeta
+	if n <= HeaderSize-metaOffset && json.Unmarshal(data[metaOffset:metaOffset+n], &meta) == nil {
+		meta.FormatVersion, meta.Dim = h.version, int(h.dim)
+		h.meta = meta
+	}
+	return h, nil
+}
+
+// readHeader reads and decodes the header of f.
+func readHeader(f *os.File) (fileHeader, error) {
+	data := make([]byte, HeaderSize)
+	n, err := f.ReadAt(data, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fileHeader{}, fmt.Errorf("read header: %w", err)
+	}
+	return decodeHeader(data[:n])
+}
+
+// ReadFileMeta returns the metadata of the vectors file path, as recorded
+// in a version 2 header or implied by a version 1 one.
+func ReadFileMeta(path string) (FileMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	defer f.Close()
+	h, err := readHeader(f)
+	return h.meta, err
+}
+
+// MigrateVectorFile converts the version 1 vectors file path to the current
+// format and reports whether it did; other files are left alone. The file
+// is rewritten next to itself and renamed over the original, so a crash
+// leaves one or the other intact, and needs room for a second copy.
+func MigrateVectorFile(path string) (bool, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+	h, err := readHeader(src)
+	if err != nil || h.version != 1 {
+		// The store reports a bad header when it opens the file.
+		return false, nil
+	}
+	fi, err := src.Stat()
+	if err != nil {
+		return false, err
+	}
+	used := int64(h.count) * int64(h.dim) * vectorSize
+	if headerSizeV1+used > fi.Size() {
+		return false, fmt.Errorf("vectors file %s is truncated: header count=%d needs %d bytes but the file has %d (restore a snapshot)", path, h.count, headerSizeV1+used, fi.Size())
+	}
+
+	meta := newFileMeta(int(h.dim))
+	meta.MigratedFrom = 1
+	header, err := encodeHeader(meta, h.count)
+	if err != nil {
+		return false, err
+	}
+	tmp := path + ".migrate"
+	dst, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return false, err
+	}
+	fail := func(err error) (bool, error) {
+		_ = dst.Close()
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("migrate %s to format %d: %w", path, FormatVersion, err)
+	}
+	if _, err := dst.Write(header); err != nil {
+		return fail(err)
+	}
+	if _, err := io.Copy(dst, io.NewSectionReader(src, headerSizeV1, used)); err != nil {
+		return fail(err)
+	}
+	// Keep the spare capacity the file had.
+	if err := dst.Truncate(HeaderSize + fi.Size() - headerSizeV1); err != nil {
+		return fail(err)
+	}
+	if err := dst.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return false, err
+	}
+	_ = src.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return false, err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	return true, nil
+}
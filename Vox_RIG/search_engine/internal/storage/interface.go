@@ -1,6 +1,11 @@
 package storage
 
-import "vox-vector-engine/internal/types"
+import (
+	"io"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
 
 // VectorStore defines the interface for storing and retrieving raw vectors.
 type VectorStore interface {
@@ -10,9 +15,133 @@ type VectorStore interface {
 	// Get retrieves a vector by its index.
 	Get(index uint64) (types.Vector, error)
 
+	// Dim returns the length every stored vector must have.
+	Dim() int
+
 	// Count returns the number of vectors in the store.
 	Count() uint64
 
+	// Sync flushes appended vectors to stable storage.
+	Sync() error
+
 	// Close flushes and closes the store.
 	Close() error
 }
+
+// FileVectorStore is a VectorStore kept in files under a data directory:
+// a single MmapVectorStore or a SegmentedVectorStore.
+type FileVectorStore interface {
+	VectorStore
+	SetFlushPolicy(p FlushPolicy)
+	FlushPolicy() FlushPolicy
+	GrowthPolicy() GrowthPolicy
+	// Refresh re-reads a read-only store and returns its new Count.
+	Refresh() (uint64, error)
+	// FileMeta returns the metadata recorded in the file header and
+	// SetFileModel tags it with the vectors' embedding model.
+	FileMeta() FileMeta
+	SetFileModel(model string) error
+}
+
+// MetadataStore holds documents, chunks, pins and small bookkeeping values.
+// Chunk IDs are the positions of their vectors in the VectorStore. Engine,
+// API and command code only use this interface, so backends (Bolt, SQLite)
+// and test fakes (MemoryMetadataStore) are interchangeable.
+type MetadataStore interface {
+	SaveDocument(doc types.Document) error
+	GetDocument(id string) (*types.Document, error)
+	// SaveDocumentWithChunks writes a document and its chunks atomically.
+	SaveDocumentWithChunks(doc types.Document, chunks []types.Chunk) error
+	SaveChunk(chunk types.Chunk) error
+	SaveChunks(chunks []types.Chunk) error
+	GetChunk(id uint64) (*types.Chunk, error)
+	// UpdateChunk applies fn to a stored chunk and saves the result
+	// atomically; an error from fn aborts the update. A missing chunk fails
+	// with ErrNotFound.
+	UpdateChunk(id uint64, fn func(*types.Chunk) error) (*types.Chunk, error)
+	// GetChunks looks up many chunks at once; missing IDs are left out.
+	GetChunks(ids []uint64) (map[uint64]types.Chunk, error)
+	// GetChunkRange returns the chunks with from <= ID < to, in ID order.
+	GetChunkRange(from, to uint64) ([]types.Chunk, error)
+	// DocumentChunks returns the chunks of a document, in ID order.
+	DocumentChunks(docID string) ([]types.Chunk, error)
+	MaxChunkID() (id uint64, ok bool, err error)
+	ChunkCount() (int, error)
+	// ListDocuments returns the documents of a namespace, in ID order.
+	ListDocuments(ns string) ([]types.Document, error)
+	// SetTags replaces a document's tags; TaggedDocuments lists the IDs of
+	// the documents carrying a tag, in ID order.
+	SetTags(id string, tags []string) error
+	// UpdateDocument applies fn to a stored document and saves the result
+	// atomically; an error from fn aborts the update.
+	UpdateDocument(id string, fn func(*types.Document) error) (*types.Document, error)
+	TaggedDocuments(tag string) ([]string, error)
+
+	// ForEachDocument and ForEachChunk visit every record (chunks in ID order).
+	ForEachDocument(fn func(types.Document) error) error
+	ForEachChunk(fn func(types.Chunk) error) error
+
+	// DeleteDocument removes a document and its chunks, returning the chunk IDs.
+	DeleteDocument(id string) ([]uint64, error)
+	// DeleteNamespace removes every document of ns with its chunks and pins.
+	DeleteNamespace(ns string) (docIDs []string, chunkIDs []uint64, err error)
+	NamespaceChunkIDs(ns string) ([]uint64, error)
+
+	SavePin(p types.Pin) error
+	DeletePin(p types.Pin) (bool, error)
+	ListPins(ns string) ([]types.Pin, error)
+
+	// TrashDocument moves a document and its chunks to the trash, out of
+	// retrieval, and RestoreDocument moves them back (both fail with
+	// ErrNotFound). ListTrash returns the trashed documents of ns, oldest
+	// first; DeleteTrash drops one for good and PurgeTrash every one trashed
+	// before the given time, returning their IDs. DeleteNamespace empties
+	// the namespace's trash too.
+	TrashDocument(id string, at time.Time) (*types.TrashedDocument, error)
+	RestoreDocument(id string) (*types.TrashedDocument, error)
+	ListTrash(ns string) ([]types.TrashedDocument, error)
+	DeleteTrash(id string) (bool, error)
+	PurgeTrash(before time.Time) ([]string, error)
+
+	// SaveTemplate stores the context template of t.Namespace, replacing
+	// any previous one; GetTemplate fails with ErrNotFound when ns has none.
+	SaveTemplate(t types.ContextTemplate) error
+	GetTemplate(ns string) (*types.ContextTemplate, error)
+	DeleteTemplate(ns string) (bool, error)
+	ListTemplates() ([]types.ContextTemplate, error)
+
+	// GetState returns the bookkeeping value under key, "" when unset;
+	// SetState with an empty value deletes key.
+	GetState(key string) (string, error)
+	SetState(key, value string) error
+
+	// RecordAccess adds each entry's Count to the access log of its chunk
+	// and moves Last forward; GetAccess reads the log, leaving out chunks
+	// never retrieved, and DeleteAccess drops entries. Access writes are
+	// neither logged nor change Generation, so retrieval does not invalidate
+	// results derived from the store.
+	RecordAccess(access map[uint64]types.ChunkAccess) error
+	GetAccess(ids []uint64) (map[uint64]types.ChunkAccess, error)
+	DeleteAccess(ids []uint64) error
+
+	// Changes returns up to limit change log entries with Seq > since,
+	// oldest first; LastChange returns the newest Seq (0 for none). Every
+	// write except SetState is logged.
+	Changes(since uint64, limit int) ([]types.Change, error)
+	LastChange() (uint64, error)
+
+	// Generation changes after every write.
+	Generation() uint64
+	// Backup writes a consistent copy of the store in its native file format.
+	Backup(w io.Writer) (int64, error)
+	Close() error
+}
+
+var (
+	_ FileVectorStore = (*MmapVectorStore)(nil)
+	_ FileVectorStore = (*SegmentedVectorStore)(nil)
+
+	_ MetadataStore = (*BoltMetadataStore)(nil)
+	_ MetadataStore = (*SQLiteMetadataStore)(nil)
+	_ MetadataStore = (*MemoryMetadataStore)(nil)
+)
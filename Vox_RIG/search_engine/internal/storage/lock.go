@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LockFileName is the file in a data directory that its writer holds locked.
+const LockFileName = "vox.lock"
+
+// ErrLocked is returned by LockDir when another process holds the lock.
+var ErrLocked = errors.New("data directory is locked by another process")
+
+// DirLock is an exclusive advisory lock on a data directory. Two writers on
+// one directory would interleave appends to vectors.bin and fight over the
+// metadata store, so every process that opens a directory for writing takes
+// it first. The OS drops the lock when the holder exits, even by crashing;
+// the file itself stays behind and only records the last holder's PID.
+type DirLock struct {
+	file *os.File
+}
+
+// LockDir takes the lock for dir without waiting. If another process holds
+// it the error wraps ErrLocked and names that process when it is known.
+func LockDir(dir string) (*DirLock, error) {
+	path := filepath.Join(dir, LockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		holder := ""
+		if b, rerr := os.ReadFile(path); rerr == nil {
+			if pid, perr := strconv.Atoi(strings.TrimSpace(string(b))); perr == nil {
+				holder = fmt.Sprintf(" (pid %d)", pid)
+			}
+		}
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%s: %w%s", dir, ErrLocked, holder)
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	// Record the holder for the error message above; the lock is what counts,
+	// so failing to write the PID is not fatal.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &DirLock{file: f}, nil
+}
+
+// Close releases the lock.
+func (l *DirLock) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	l, err := LockDir(dir)
+	if err != nil {
+		t.Fatalf("LockDir failed: %v", err)
+	}
+
+	// The lock belongs to the open file, so a second open in this process
+	// conflicts just as another process would.
+	_, err = LockDir(dir)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked while held, got %v", err)
+	}
+	if want := fmt.Sprintf("pid %d", os.Getpid()); !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected the error to name the holder (%s), got %q", want, err)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	l2, err := LockDir(dir)
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after Close, got %v", err)
+	}
+	l2.Close()
+}
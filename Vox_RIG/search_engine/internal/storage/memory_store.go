@@ -0,0 +1,783 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// MemoryMetadataStore is an in-memory MetadataStore for tests and throwaway
+// engines. Records are stored as JSON, like the on-disk backends, so callers
+// see the same round-trip behaviour (e.g. numbers come back as float64).
+type MemoryMetadataStore struct {
+	mu     sync.RWMutex
+	docs   map[string][]byte
+	chunks map[uint64][]byte
+	pins   map[string][]byte // keyed by pinKey
+	state  map[string]string
+	trash  map[string][]byte // types.TrashedDocument by document ID
+	tmpls  map[string][]byte // types.ContextTemplate by namespace
+	access map[uint64]types.ChunkAccess
+	// changes is the change log, oldest first.
+	changes []types.Change
+	gen     atomic.Uint64
+}
+
+func NewMemoryMetadataStore() *MemoryMetadataStore {
+	return &MemoryMetadataStore{
+		docs:   map[string][]byte{},
+		chunks: map[uint64][]byte{},
+		pins:   map[string][]byte{},
+		state:  map[string]string{},
+		trash:  map[string][]byte{},
+		tmpls:  map[string][]byte{},
+		access: map[uint64]types.ChunkAccess{},
+	}
+}
+
+// update runs fn under the write lock and bumps the generation.
+func (s *MemoryMetadataStore) update(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.gen.Add(1)
+	return fn()
+}
+
+func (s *MemoryMetadataStore) Generation() uint64 {
+	return s.gen.Load()
+}
+
+// logChange appends c to the change log; callers hold s.mu.
+func (s *MemoryMetadataStore) logChange(c types.Change) {
+	c.Seq, c.Time = uint64(len(s.changes))+1, time.Now().UTC()
+	s.changes = append(s.changes, c)
+}
+
+func (s *MemoryMetadataStore) Changes(since uint64, limit int) ([]types.Change, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if since >= uint64(len(s.changes)) {
+		return nil, nil
+	}
+	out := s.changes[since:]
+	if limit = changesLimit(limit); len(out) > limit {
+		out = out[:limit]
+	}
+	return append([]types.Change(nil), out...), nil
+}
+
+func (s *MemoryMetadataStore) LastChange() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.changes)), nil
+}
+
+func (s *MemoryMetadataStore) Close() error {
+	return nil
+}
+
+func (s *MemoryMetadataStore) SaveDocument(doc types.Document) error {
+	return s.SaveDocumentWithChunks(doc, nil)
+}
+
+func (s *MemoryMetadataStore) SaveDocumentWithChunks(doc types.Document, chunks []types.Chunk) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	encoded, err := encodeChunks(chunks)
+	if err != nil {
+		return err
+	}
+	return s.update(func() error {
+		s.docs[doc.ID] = data
+		for id, c := range encoded {
+			s.chunks[id] = c
+		}
+		s.logChange(documentChange(doc, chunks))
+		return nil
+	})
+}
+
+// SetTags replaces the tags of document id.
+func (s *MemoryMetadataStore) SetTags(id string, tags []string) error {
+	return s.update(func() error {
+		data, ok := s.docs[id]
+		if !ok {
+			return fmt.Errorf("document not found: %s", id)
+		}
+		var doc types.Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		doc.Tags = tags
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		s.docs[id] = data
+		s.logChange(documentChange(doc, nil))
+		return nil
+	})
+}
+
+func (s *MemoryMetadataStore) UpdateDocument(id string, fn func(*types.Document) error) (*types.Document, error) {
+	var doc types.Document
+	err := s.update(func() error {
+		data, ok := s.docs[id]
+		if !ok {
+			return fmt.Errorf("document not found: %s", id)
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if err := fn(&doc); err != nil {
+			return err
+		}
+		doc.ID = id
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		s.docs[id] = data
+		s.logChange(documentChange(doc, nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// TaggedDocuments returns the IDs of the documents tagged tag, in ID order.
+func (s *MemoryMetadataStore) TaggedDocuments(tag string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs, err := s.sortedDocuments(func(doc types.Document) bool {
+		for _, t := range doc.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+func encodeChunks(chunks []types.Chunk) (map[uint64][]byte, error) {
+	out := make(map[uint64][]byte, len(chunks))
+	for _, c := range chunks {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		out[c.ID] = data
+	}
+	return out, nil
+}
+
+func (s *MemoryMetadataStore) GetDocument(id string) (*types.Document, error) {
+	s.mu.RLock()
+	data, ok := s.docs[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("document not found: %s", id)
+	}
+	var doc types.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (s *MemoryMetadataStore) SaveChunk(chunk types.Chunk) error {
+	return s.SaveChunks([]types.Chunk{chunk})
+}
+
+func (s *MemoryMetadataStore) SaveChunks(chunks []types.Chunk) error {
+	encoded, err := encodeChunks(chunks)
+	if err != nil {
+		return err
+	}
+	return s.update(func() error {
+		for id, c := range encoded {
+			s.chunks[id] = c
+		}
+		if len(chunks) > 0 {
+			s.logChange(chunksChange(documentNamespace(s.docs[chunks[0].DocID]), chunks))
+		}
+		return nil
+	})
+}
+
+func (s *MemoryMetadataStore) GetChunk(id uint64) (*types.Chunk, error) {
+	s.mu.RLock()
+	data, ok := s.chunks[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("chunk not found: %d", id)
+	}
+	var c types.Chunk
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *MemoryMetadataStore) UpdateChunk(id uint64, fn func(*types.Chunk) error) (*types.Chunk, error) {
+	var c types.Chunk
+	err := s.update(func() error {
+		data, ok := s.chunks[id]
+		if !ok {
+			return fmt.Errorf("chunk %d: %w", id, ErrNotFound)
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		if err := fn(&c); err != nil {
+			return err
+		}
+		c.ID = id
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		s.chunks[id] = data
+		s.logChange(chunksChange(documentNamespace(s.docs[c.DocID]), []types.Chunk{c}))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *MemoryMetadataStore) GetChunks(ids []uint64) (map[uint64]types.Chunk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[uint64]types.Chunk, len(ids))
+	for _, id := range ids {
+		data, ok := s.chunks[id]
+		if !ok {
+			continue
+		}
+		var c types.Chunk
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		out[id] = c
+	}
+	return out, nil
+}
+
+// sortedChunks decodes the chunks accepted by keep, in ID order. The caller
+// holds s.mu.
+func (s *MemoryMetadataStore) sortedChunks(keep func(types.Chunk) bool) ([]types.Chunk, error) {
+	var out []types.Chunk
+	for _, data := range s.chunks {
+		var c types.Chunk
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		if keep(c) {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// sortedDocuments decodes the documents accepted by keep, in ID order. The
+// caller holds s.mu.
+func (s *MemoryMetadataStore) sortedDocuments(keep func(types.Document) bool) ([]types.Document, error) {
+	var out []types.Document
+	for _, data := range s.docs {
+		var doc types.Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if keep(doc) {
+			out = append(out, doc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func inNamespace(doc types.Document, ns string) bool {
+	docNS, _ := doc.Metadata["namespace"].(string)
+	return docNS == ns
+}
+
+func (s *MemoryMetadataStore) GetChunkRange(from, to uint64) ([]types.Chunk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedChunks(func(c types.Chunk) bool { return c.ID >= from && c.ID < to })
+}
+
+func (s *MemoryMetadataStore) DocumentChunks(docID string) ([]types.Chunk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedChunks(func(c types.Chunk) bool { return c.DocID == docID })
+}
+
+func (s *MemoryMetadataStore) MaxChunkID() (uint64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var max uint64
+	for id := range s.chunks {
+		if id > max {
+			max = id
+		}
+	}
+	return max, len(s.chunks) > 0, nil
+}
+
+func (s *MemoryMetadataStore) ChunkCount() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.chunks), nil
+}
+
+func (s *MemoryMetadataStore) ListDocuments(ns string) ([]types.Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedDocuments(func(doc types.Document) bool { return inNamespace(doc, ns) })
+}
+
+// ForEachDocument calls fn on a snapshot taken before the first call, so fn
+// may write to the store.
+func (s *MemoryMetadataStore) ForEachDocument(fn func(types.Document) error) error {
+	s.mu.RLock()
+	docs, err := s.sortedDocuments(func(types.Document) bool { return true })
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachChunk calls fn on a snapshot taken before the first call, in ID
+// order.
+func (s *MemoryMetadataStore) ForEachChunk(fn func(types.Chunk) error) error {
+	s.mu.RLock()
+	chunks, err := s.sortedChunks(func(types.Chunk) bool { return true })
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryMetadataStore) DeleteDocument(id string) ([]uint64, error) {
+	var removed []uint64
+	err := s.update(func() error {
+		chunks, err := s.sortedChunks(func(c types.Chunk) bool { return c.DocID == id })
+		if err != nil {
+			return err
+		}
+		for _, c := range chunks {
+			delete(s.chunks, c.ID)
+			removed = append(removed, c.ID)
+		}
+		data, ok := s.docs[id]
+		if !ok && len(removed) == 0 {
+			return nil
+		}
+		delete(s.docs, id)
+		s.logChange(types.Change{Op: types.ChangeDeleteDocument, DocID: id, Namespace: documentNamespace(data), ChunkIDs: removed})
+		return nil
+	})
+	return removed, err
+}
+
+func (s *MemoryMetadataStore) TrashDocument(id string, at time.Time) (*types.TrashedDocument, error) {
+	var t types.TrashedDocument
+	err := s.update(func() error {
+		data, ok := s.docs[id]
+		if !ok {
+			return fmt.Errorf("document %s: %w", id, ErrNotFound)
+		}
+		if err := json.Unmarshal(data, &t.Document); err != nil {
+			return err
+		}
+		chunks, err := s.sortedChunks(func(c types.Chunk) bool { return c.DocID == id })
+		if err != nil {
+			return err
+		}
+		t.Chunks, t.DeletedAt = chunks, at.UTC()
+		trashed, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		for _, c := range chunks {
+			delete(s.chunks, c.ID)
+		}
+		delete(s.docs, id)
+		s.trash[id] = trashed
+		s.logChange(types.Change{Op: types.ChangeDeleteDocument, DocID: id, Namespace: trashNamespace(t), ChunkIDs: chunkIDsOf(chunks)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *MemoryMetadataStore) RestoreDocument(id string) (*types.TrashedDocument, error) {
+	var t types.TrashedDocument
+	err := s.update(func() error {
+		data, ok := s.trash[id]
+		if !ok {
+			return fmt.Errorf("trashed document %s: %w", id, ErrNotFound)
+		}
+		if _, ok := s.docs[id]; ok {
+			return fmt.Errorf("document %s: %w", id, ErrDocumentExists)
+		}
+		if err := json.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		doc, err := json.Marshal(t.Document)
+		if err != nil {
+			return err
+		}
+		encoded, err := encodeChunks(t.Chunks)
+		if err != nil {
+			return err
+		}
+		s.docs[id] = doc
+		for cid, c := range encoded {
+			s.chunks[cid] = c
+		}
+		delete(s.trash, id)
+		s.logChange(documentChange(t.Document, t.Chunks))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *MemoryMetadataStore) ListTrash(ns string) ([]types.TrashedDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []types.TrashedDocument
+	for _, data := range s.trash {
+		var t types.TrashedDocument
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		if trashNamespace(t) == ns {
+			out = append(out, t)
+		}
+	}
+	sortTrash(out)
+	return out, nil
+}
+
+func (s *MemoryMetadataStore) DeleteTrash(id string) (bool, error) {
+	var found bool
+	err := s.update(func() error {
+		_, found = s.trash[id]
+		delete(s.trash, id)
+		return nil
+	})
+	return found, err
+}
+
+func (s *MemoryMetadataStore) PurgeTrash(before time.Time) ([]string, error) {
+	var ids []string
+	err := s.update(func() error {
+		for id, data := range s.trash {
+			var t types.TrashedDocument
+			if err := json.Unmarshal(data, &t); err != nil {
+				return err
+			}
+			if t.DeletedAt.Before(before) {
+				delete(s.trash, id)
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	sort.Strings(ids)
+	return ids, err
+}
+
+func (s *MemoryMetadataStore) DeleteNamespace(ns string) ([]string, []uint64, error) {
+	var docIDs []string
+	var chunkIDs []uint64
+	err := s.update(func() error {
+		var err error
+		if chunkIDs, err = s.namespaceChunkIDs(ns); err != nil {
+			return err
+		}
+		docs, err := s.sortedDocuments(func(doc types.Document) bool { return inNamespace(doc, ns) })
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			delete(s.docs, doc.ID)
+			docIDs = append(docIDs, doc.ID)
+		}
+		for _, id := range chunkIDs {
+			delete(s.chunks, id)
+		}
+		for key, data := range s.pins {
+			var p types.Pin
+			if err := json.Unmarshal(data, &p); err != nil {
+				return err
+			}
+			if p.Namespace == ns {
+				delete(s.pins, key)
+			}
+		}
+		for id, data := range s.trash {
+			var t types.TrashedDocument
+			if err := json.Unmarshal(data, &t); err != nil {
+				return err
+			}
+			if trashNamespace(t) == ns {
+				delete(s.trash, id)
+			}
+		}
+		s.logChange(types.Change{Op: types.ChangeDeleteNamespace, Namespace: ns})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return docIDs, chunkIDs, nil
+}
+
+func (s *MemoryMetadataStore) NamespaceChunkIDs(ns string) ([]uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.namespaceChunkIDs(ns)
+}
+
+// namespaceChunkIDs is NamespaceChunkIDs for callers holding s.mu.
+func (s *MemoryMetadataStore) namespaceChunkIDs(ns string) ([]uint64, error) {
+	docs, err := s.sortedDocuments(func(doc types.Document) bool { return inNamespace(doc, ns) })
+	if err != nil {
+		return nil, err
+	}
+	inNS := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		inNS[doc.ID] = true
+	}
+	chunks, err := s.sortedChunks(func(c types.Chunk) bool { return inNS[c.DocID] })
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, len(chunks))
+	for i, c := range chunks {
+		ids[i] = c.ID
+	}
+	return ids, nil
+}
+
+func (s *MemoryMetadataStore) SavePin(p types.Pin) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.update(func() error {
+		s.pins[string(pinKey(p))] = data
+		s.logChange(pinChange(types.ChangePin, p))
+		return nil
+	})
+}
+
+func (s *MemoryMetadataStore) DeletePin(p types.Pin) (bool, error) {
+	var found bool
+	err := s.update(func() error {
+		key := string(pinKey(p))
+		_, found = s.pins[key]
+		if found {
+			delete(s.pins, key)
+			s.logChange(pinChange(types.ChangeUnpin, p))
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (s *MemoryMetadataStore) ListPins(ns string) ([]types.Pin, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.pins))
+	for key := range s.pins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pins []types.Pin
+	for _, key := range keys {
+		var p types.Pin
+		if err := json.Unmarshal(s.pins[key], &p); err != nil {
+			return nil, err
+		}
+		if p.Namespace == ns {
+			pins = append(pins, p)
+		}
+	}
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].CreatedAt.Before(pins[j].CreatedAt) })
+	return pins, nil
+}
+
+func (s *MemoryMetadataStore) SaveTemplate(t types.ContextTemplate) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.update(func() error {
+		s.tmpls[t.Namespace] = data
+		s.logChange(templateChange(t))
+		return nil
+	})
+}
+
+func (s *MemoryMetadataStore) GetTemplate(ns string) (*types.ContextTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.tmpls[ns]
+	if !ok {
+		return nil, fmt.Errorf("template of namespace %q: %w", ns, ErrNotFound)
+	}
+	var t types.ContextTemplate
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *MemoryMetadataStore) DeleteTemplate(ns string) (bool, error) {
+	var found bool
+	err := s.update(func() error {
+		_, found = s.tmpls[ns]
+		if found {
+			delete(s.tmpls, ns)
+			s.logChange(types.Change{Op: types.ChangeDeleteTemplate, Namespace: ns})
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (s *MemoryMetadataStore) ListTemplates() ([]types.ContextTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	namespaces := make([]string, 0, len(s.tmpls))
+	for ns := range s.tmpls {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	var out []types.ContextTemplate
+	for _, ns := range namespaces {
+		var t types.ContextTemplate
+		if err := json.Unmarshal(s.tmpls[ns], &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (s *MemoryMetadataStore) GetState(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state[key], nil
+}
+
+func (s *MemoryMetadataStore) SetState(key, value string) error {
+	return s.update(func() error {
+		if value == "" {
+			delete(s.state, key)
+			return nil
+		}
+		s.state[key] = value
+		return nil
+	})
+}
+
+// RecordAccess merges access into the access log without changing
+// Generation.
+func (s *MemoryMetadataStore) RecordAccess(access map[uint64]types.ChunkAccess) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, a := range access {
+		s.access[id] = mergeAccess(s.access[id], a)
+	}
+	return nil
+}
+
+func (s *MemoryMetadataStore) GetAccess(ids []uint64) (map[uint64]types.ChunkAccess, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[uint64]types.ChunkAccess)
+	for _, id := range ids {
+		if a, ok := s.access[id]; ok {
+			out[id] = a
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryMetadataStore) DeleteAccess(ids []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.access, id)
+	}
+	return nil
+}
+
+// Backup writes the store as one JSON object; there is no native file format
+// to restore it from.
+func (s *MemoryMetadataStore) Backup(w io.Writer) (int64, error) {
+	s.mu.RLock()
+	data, err := json.Marshal(struct {
+		Documents map[string]json.RawMessage `json:"documents"`
+		Chunks    map[uint64]json.RawMessage `json:"chunks"`
+		Pins      map[string]json.RawMessage `json:"pins"`
+		State     map[string]string          `json:"state"`
+	}{rawValues(s.docs), rawValues(s.chunks), rawValues(s.pins), s.state})
+	s.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+func rawValues[K comparable](m map[K][]byte) map[K]json.RawMessage {
+	out := make(map[K]json.RawMessage, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
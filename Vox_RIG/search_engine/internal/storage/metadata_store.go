@@ -1,8 +1,17 @@
 package storage
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"vox-vector-engine/internal/types"
@@ -13,10 +22,42 @@ import (
 var (
 	bucketDocs   = []byte("documents")
 	bucketChunks = []byte("chunks")
+	// bucketState holds small engine bookkeeping values (e.g. last indexed git commit).
+	bucketState = []byte("state")
+	// bucketPins holds types.Pin values keyed by pinKey.
+	bucketPins = []byte("pins")
+	// bucketTags indexes Document.Tags: one empty value per tagKey.
+	bucketTags = []byte("tags")
+	// bucketChanges is the change log: types.Change values keyed by
+	// chunkKey(Seq).
+	bucketChanges = []byte("changes")
+	// bucketTrash holds types.TrashedDocument values keyed by document ID.
+	bucketTrash = []byte("trash")
+	// bucketTemplates holds types.ContextTemplate values keyed by namespace.
+	bucketTemplates = []byte("templates")
+	// bucketAccess holds types.ChunkAccess values keyed by chunkKey.
+	bucketAccess = []byte("access")
 )
 
+// stateChunkKeys records the chunk key encoding in bucketState. Databases
+// without it use decimal-string keys and are migrated on open.
+const (
+	stateChunkKeys    = "chunk_key_format"
+	chunkKeysUint64BE = "uint64be"
+)
+
+// chunkKey encodes a chunk ID as 8 big-endian bytes, so cursor order is
+// numeric order.
+func chunkKey(id uint64) []byte {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], id)
+	return k[:]
+}
+
 type BoltMetadataStore struct {
 	db *bbolt.DB
+	// gen counts committed write transactions (see Generation).
+	gen atomic.Uint64
 }
 
 func NewBoltMetadataStore(path string) (*BoltMetadataStore, error) {
@@ -32,7 +73,28 @@ func NewBoltMetadataStore(path string) (*BoltMetadataStore, error) {
 		if _, err := tx.CreateBucketIfNotExists(bucketChunks); err != nil {
 			return err
 		}
-		return nil
+		if _, err := tx.CreateBucketIfNotExists(bucketState); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketPins); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketTags); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketChanges); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketTrash); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketTemplates); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketAccess); err != nil {
+			return err
+		}
+		return migrateChunkKeys(tx)
 	})
 	if err != nil {
 		db.Close()
@@ -42,14 +104,331 @@ func NewBoltMetadataStore(path string) (*BoltMetadataStore, error) {
 	return &BoltMetadataStore{db: db}, nil
 }
 
+// NewBoltMetadataStoreReadOnly opens an existing database without write
+// access. Bolt takes a shared file lock for this, which excludes a writer:
+// it works alongside other readers or a stopped writer, and fails fast while
+// a server has the database open read-write (-meta=sqlite allows both).
+func NewBoltMetadataStoreReadOnly(path string) (*BoltMetadataStore, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is locked by a writer; bolt allows read-only access only while no writer has it open (use -meta=sqlite for concurrent readers)", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.View(func(tx *bbolt.Tx) error {
+		for _, b := range [][]byte{bucketDocs, bucketChunks, bucketState, bucketPins, bucketTags} {
+			if tx.Bucket(b) == nil {
+				return fmt.Errorf("%s has no %s bucket; open it read-write once to upgrade it", path, b)
+			}
+		}
+		if string(tx.Bucket(bucketState).Get([]byte(stateChunkKeys))) != chunkKeysUint64BE {
+			return fmt.Errorf("%s uses the old chunk key format; open it read-write once to upgrade it", path)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltMetadataStore{db: db}, nil
+}
+
+// migrateChunkKeys rewrites decimal-string chunk keys as chunkKey. Chunks
+// are staged in a temporary bucket so memory use stays flat; the whole
+// rewrite is one transaction, so a crash leaves the old keys intact.
+func migrateChunkKeys(tx *bbolt.Tx) error {
+	state := tx.Bucket(bucketState)
+	if string(state.Get([]byte(stateChunkKeys))) == chunkKeysUint64BE {
+		return nil
+	}
+
+	tmpName := []byte("chunks.migrate")
+	if tx.Bucket(tmpName) != nil {
+		if err := tx.DeleteBucket(tmpName); err != nil {
+			return err
+		}
+	}
+	tmp, err := tx.CreateBucket(tmpName)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketChunks).ForEach(func(k, v []byte) error {
+		id, err := strconv.ParseUint(string(k), 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrate chunk key %q: %w", k, err)
+		}
+		return tmp.Put(chunkKey(id), v)
+	}); err != nil {
+		return err
+	}
+	if err := tx.DeleteBucket(bucketChunks); err != nil {
+		return err
+	}
+	chunks, err := tx.CreateBucket(bucketChunks)
+	if err != nil {
+		return err
+	}
+	// Keys arrive in order, so fill pages completely.
+	chunks.FillPercent = 1
+	if err := tmp.ForEach(func(k, v []byte) error {
+		return chunks.Put(k, v)
+	}); err != nil {
+		return err
+	}
+	if err := tx.DeleteBucket(tmpName); err != nil {
+		return err
+	}
+	return state.Put([]byte(stateChunkKeys), []byte(chunkKeysUint64BE))
+}
+
+// update runs fn in a write transaction and bumps the generation.
+func (s *BoltMetadataStore) update(fn func(*bbolt.Tx) error) error {
+	err := s.db.Update(fn)
+	s.gen.Add(1)
+	return err
+}
+
+// Generation changes after every write, so callers can tell whether a
+// result derived from the store is still current.
+func (s *BoltMetadataStore) Generation() uint64 {
+	return s.gen.Load()
+}
+
 func (s *BoltMetadataStore) SaveDocument(doc types.Document) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketDocs)
-		data, err := json.Marshal(doc)
+	return s.update(func(tx *bbolt.Tx) error {
+		if err := putDocument(tx, doc); err != nil {
+			return err
+		}
+		return logChange(tx, documentChange(doc, nil))
+	})
+}
+
+// logChange appends c to the change log inside tx.
+func logChange(tx *bbolt.Tx, c types.Change) error {
+	b := tx.Bucket(bucketChanges)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	c.Seq, c.Time = seq, time.Now().UTC()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return b.Put(chunkKey(seq), data)
+}
+
+// Changes returns up to limit change log entries after since, oldest first.
+func (s *BoltMetadataStore) Changes(since uint64, limit int) ([]types.Change, error) {
+	limit = changesLimit(limit)
+	var out []types.Change
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketChanges)
+		if b == nil {
+			// A read-only database from before the change log.
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(chunkKey(since + 1)); k != nil && len(out) < limit; k, v = c.Next() {
+			var ch types.Change
+			if err := json.Unmarshal(v, &ch); err != nil {
+				return err
+			}
+			out = append(out, ch)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// LastChange returns the Seq of the newest change log entry.
+func (s *BoltMetadataStore) LastChange() (uint64, error) {
+	var seq uint64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(bucketChanges); b != nil {
+			seq = b.Sequence()
+		}
+		return nil
+	})
+	return seq, err
+}
+
+// tagKey orders the tag index by tag; the NUL separator keeps one tag's
+// keys from prefixing another's.
+func tagKey(tag, docID string) []byte {
+	return []byte(tag + "\x00" + docID)
+}
+
+// putDocument stores doc and keeps bucketTags in step with its tags.
+func putDocument(tx *bbolt.Tx, doc types.Document) error {
+	docs := tx.Bucket(bucketDocs)
+	if err := unindexTags(tx, doc.ID, docs.Get([]byte(doc.ID))); err != nil {
+		return err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := docs.Put([]byte(doc.ID), data); err != nil {
+		return err
+	}
+	tags := tx.Bucket(bucketTags)
+	for _, tag := range doc.Tags {
+		if err := tags.Put(tagKey(tag, doc.ID), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexTags removes the tag index entries of the stored document data
+// (nil when there is none).
+func unindexTags(tx *bbolt.Tx, id string, data []byte) error {
+	if data == nil {
+		return nil
+	}
+	var doc struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	tags := tx.Bucket(bucketTags)
+	for _, tag := range doc.Tags {
+		if err := tags.Delete(tagKey(tag, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTags replaces the tags of document id.
+func (s *BoltMetadataStore) SetTags(id string, tags []string) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bucketDocs).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("document not found: %s", id)
+		}
+		var doc types.Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		doc.Tags = tags
+		if err := putDocument(tx, doc); err != nil {
+			return err
+		}
+		return logChange(tx, documentChange(doc, nil))
+	})
+}
+
+// UpdateDocument applies fn to document id and saves the result in the same
+// transaction.
+func (s *BoltMetadataStore) UpdateDocument(id string, fn func(*types.Document) error) (*types.Document, error) {
+	var doc types.Document
+	err := s.update(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bucketDocs).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("document not found: %s", id)
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if err := fn(&doc); err != nil {
+			return err
+		}
+		doc.ID = id
+		if err := putDocument(tx, doc); err != nil {
+			return err
+		}
+		return logChange(tx, documentChange(doc, nil))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// TaggedDocuments returns the IDs of the documents tagged tag, in ID order.
+func (s *BoltMetadataStore) TaggedDocuments(tag string) ([]string, error) {
+	var ids []string
+	prefix := tagKey(tag, "")
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketTags).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ids = append(ids, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// CheckIndexes compares the tag index with the tags of the stored documents.
+func (s *BoltMetadataStore) CheckIndexes() ([]string, error) {
+	var problems []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		want := map[string]bool{}
+		if err := tx.Bucket(bucketDocs).ForEach(func(k, v []byte) error {
+			var doc struct {
+				Tags []string `json:"tags"`
+			}
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return fmt.Errorf("document %s: %w", k, err)
+			}
+			for _, tag := range doc.Tags {
+				want[string(tagKey(tag, string(k)))] = true
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketTags).ForEach(func(k, _ []byte) error {
+			if !want[string(k)] {
+				tag, id, _ := strings.Cut(string(k), "\x00")
+				problems = append(problems, fmt.Sprintf("tag index lists document %s under %q, which it does not carry", id, tag))
+			}
+			delete(want, string(k))
+			return nil
+		}); err != nil {
+			return err
+		}
+		for k := range want {
+			tag, id, _ := strings.Cut(k, "\x00")
+			problems = append(problems, fmt.Sprintf("tag index misses document %s under %q", id, tag))
+		}
+		return nil
+	})
+	sort.Strings(problems)
+	return problems, err
+}
+
+// RebuildIndexes rebuilds the tag index from the stored documents.
+func (s *BoltMetadataStore) RebuildIndexes() error {
+	return s.update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(bucketTags); err != nil {
+			return err
+		}
+		tags, err := tx.CreateBucket(bucketTags)
 		if err != nil {
 			return err
 		}
-		return b.Put([]byte(doc.ID), data)
+		return tx.Bucket(bucketDocs).ForEach(func(k, v []byte) error {
+			var doc struct {
+				Tags []string `json:"tags"`
+			}
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return fmt.Errorf("document %s: %w", k, err)
+			}
+			for _, tag := range doc.Tags {
+				if err := tags.Put(tagKey(tag, string(k)), []byte{}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	})
 }
 
@@ -70,22 +449,56 @@ func (s *BoltMetadataStore) GetDocument(id string) (*types.Document, error) {
 }
 
 func (s *BoltMetadataStore) SaveChunk(chunk types.Chunk) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketChunks)
+	return s.SaveChunks([]types.Chunk{chunk})
+}
+
+// SaveChunks stores chunks in a single transaction (one fsync for the batch).
+func (s *BoltMetadataStore) SaveChunks(chunks []types.Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	return s.update(func(tx *bbolt.Tx) error {
+		if err := putChunks(tx, chunks); err != nil {
+			return err
+		}
+		ns := documentNamespace(tx.Bucket(bucketDocs).Get([]byte(chunks[0].DocID)))
+		return logChange(tx, chunksChange(ns, chunks))
+	})
+}
+
+// SaveDocumentWithChunks stores a document and its chunks in a single
+// transaction, so readers never see the document without its chunks.
+func (s *BoltMetadataStore) SaveDocumentWithChunks(doc types.Document, chunks []types.Chunk) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		if err := putDocument(tx, doc); err != nil {
+			return err
+		}
+		if err := putChunks(tx, chunks); err != nil {
+			return err
+		}
+		return logChange(tx, documentChange(doc, chunks))
+	})
+}
+
+func putChunks(tx *bbolt.Tx, chunks []types.Chunk) error {
+	b := tx.Bucket(bucketChunks)
+	for _, chunk := range chunks {
 		data, err := json.Marshal(chunk)
 		if err != nil {
 			return err
 		}
-		// Use uint64 ID as key
-		return b.Put([]byte(fmt.Sprintf("%d", chunk.ID)), data)
-	})
+		if err := b.Put(chunkKey(chunk.ID), data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *BoltMetadataStore) GetChunk(id uint64) (*types.Chunk, error) {
 	var chunk types.Chunk
 	err := s.db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucketChunks)
-		data := b.Get([]byte(fmt.Sprintf("%d", id)))
+		data := b.Get(chunkKey(id))
 		if data == nil {
 			return fmt.Errorf("chunk not found: %d", id)
 		}
@@ -97,6 +510,716 @@ func (s *BoltMetadataStore) GetChunk(id uint64) (*types.Chunk, error) {
 	return &chunk, nil
 }
 
+// UpdateChunk applies fn to chunk id and saves the result in the same
+// transaction.
+func (s *BoltMetadataStore) UpdateChunk(id uint64, fn func(*types.Chunk) error) (*types.Chunk, error) {
+	var chunk types.Chunk
+	err := s.update(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bucketChunks).Get(chunkKey(id))
+		if data == nil {
+			return fmt.Errorf("chunk %d: %w", id, ErrNotFound)
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return err
+		}
+		if err := fn(&chunk); err != nil {
+			return err
+		}
+		chunk.ID = id
+		if err := putChunks(tx, []types.Chunk{chunk}); err != nil {
+			return err
+		}
+		ns := documentNamespace(tx.Bucket(bucketDocs).Get([]byte(chunk.DocID)))
+		return logChange(tx, chunksChange(ns, []types.Chunk{chunk}))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+// GetChunks returns the stored chunks among ids, keyed by ID; missing IDs
+// are left out. All lookups share one read transaction.
+func (s *BoltMetadataStore) GetChunks(ids []uint64) (map[uint64]types.Chunk, error) {
+	out := make(map[uint64]types.Chunk, len(ids))
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketChunks)
+		for _, id := range ids {
+			data := b.Get(chunkKey(id))
+			if data == nil {
+				continue
+			}
+			var c types.Chunk
+			if err := json.Unmarshal(data, &c); err != nil {
+				return err
+			}
+			out[id] = c
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListDocuments returns the documents of namespace ns, in ID order.
+func (s *BoltMetadataStore) ListDocuments(ns string) ([]types.Document, error) {
+	var docs []types.Document
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketDocs).ForEach(func(_, v []byte) error {
+			if documentNamespace(v) != ns {
+				return nil
+			}
+			var doc types.Document
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return err
+			}
+			docs = append(docs, doc)
+			return nil
+		})
+	})
+	return docs, err
+}
+
+// ForEachDocument calls fn for every stored document, in ID order.
+func (s *BoltMetadataStore) ForEachDocument(fn func(types.Document) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketDocs).ForEach(func(_, v []byte) error {
+			var doc types.Document
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return err
+			}
+			return fn(doc)
+		})
+	})
+}
+
+// ForEachChunk calls fn for every stored chunk, in ID order.
+func (s *BoltMetadataStore) ForEachChunk(fn func(types.Chunk) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketChunks).ForEach(func(_, v []byte) error {
+			var c types.Chunk
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			return fn(c)
+		})
+	})
+}
+
+// GetChunkRange returns the stored chunks with from <= ID < to, in ID order.
+// IDs without a chunk (e.g. purged ones) are skipped.
+func (s *BoltMetadataStore) GetChunkRange(from, to uint64) ([]types.Chunk, error) {
+	var chunks []types.Chunk
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketChunks).Cursor()
+		for k, v := c.Seek(chunkKey(from)); k != nil && binary.BigEndian.Uint64(k) < to; k, v = c.Next() {
+			var chunk types.Chunk
+			if err := json.Unmarshal(v, &chunk); err != nil {
+				return err
+			}
+			chunks = append(chunks, chunk)
+		}
+		return nil
+	})
+	return chunks, err
+}
+
+// MaxChunkID returns the highest stored chunk ID; ok is false when there are
+// no chunks.
+func (s *BoltMetadataStore) MaxChunkID() (id uint64, ok bool, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		if k, _ := tx.Bucket(bucketChunks).Cursor().Last(); k != nil {
+			id, ok = binary.BigEndian.Uint64(k), true
+		}
+		return nil
+	})
+	return id, ok, err
+}
+
+// ChunkCount returns the number of stored chunks.
+func (s *BoltMetadataStore) ChunkCount() (int, error) {
+	var n int
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket(bucketChunks).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// Backup writes a consistent copy of the whole database to w using a
+// read-only transaction, so it can run while the store is in use.
+func (s *BoltMetadataStore) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
 func (s *BoltMetadataStore) Close() error {
 	return s.db.Close()
 }
+
+// Path returns the database file.
+func (s *BoltMetadataStore) Path() string {
+	return s.db.Path()
+}
+
+// GetState returns the bookkeeping value stored under key, or "" if unset.
+func (s *BoltMetadataStore) GetState(key string) (string, error) {
+	var val string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		val = string(tx.Bucket(bucketState).Get([]byte(key)))
+		return nil
+	})
+	return val, err
+}
+
+// SetState stores a bookkeeping value under key; an empty one deletes it.
+func (s *BoltMetadataStore) SetState(key, value string) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		if value == "" {
+			return tx.Bucket(bucketState).Delete([]byte(key))
+		}
+		return tx.Bucket(bucketState).Put([]byte(key), []byte(value))
+	})
+}
+
+// RecordAccess merges access into the access log in one transaction. It
+// bypasses update, so Generation is unchanged.
+func (s *BoltMetadataStore) RecordAccess(access map[uint64]types.ChunkAccess) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAccess)
+		for id, a := range access {
+			var prev types.ChunkAccess
+			if data := b.Get(chunkKey(id)); data != nil {
+				if err := json.Unmarshal(data, &prev); err != nil {
+					return err
+				}
+			}
+			data, err := json.Marshal(mergeAccess(prev, a))
+			if err != nil {
+				return err
+			}
+			if err := b.Put(chunkKey(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetAccess reads the access log of ids. Databases opened read-only from
+// before the log existed have none.
+func (s *BoltMetadataStore) GetAccess(ids []uint64) (map[uint64]types.ChunkAccess, error) {
+	out := make(map[uint64]types.ChunkAccess)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAccess)
+		if b == nil {
+			return nil
+		}
+		for _, id := range ids {
+			data := b.Get(chunkKey(id))
+			if data == nil {
+				continue
+			}
+			var a types.ChunkAccess
+			if err := json.Unmarshal(data, &a); err != nil {
+				return err
+			}
+			out[id] = a
+		}
+		return nil
+	})
+	return out, err
+}
+
+// DeleteAccess drops the access log entries of ids.
+func (s *BoltMetadataStore) DeleteAccess(ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAccess)
+		for _, id := range ids {
+			if err := b.Delete(chunkKey(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// documentNamespace extracts Document.Metadata["namespace"] from a stored document.
+func documentNamespace(data []byte) string {
+	var doc types.Document
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Metadata == nil {
+		return ""
+	}
+	ns, _ := doc.Metadata["namespace"].(string)
+	return ns
+}
+
+// DeleteNamespace removes every document whose metadata namespace equals ns,
+// together with all chunks pointing at those documents, in one transaction.
+// It returns the removed document IDs and chunk IDs.
+func (s *BoltMetadataStore) DeleteNamespace(ns string) ([]string, []uint64, error) {
+	var docIDs []string
+	var chunkIDs []uint64
+
+	err := s.update(func(tx *bbolt.Tx) error {
+		docs := tx.Bucket(bucketDocs)
+		owned := map[string]bool{}
+		if err := docs.ForEach(func(k, v []byte) error {
+			if documentNamespace(v) == ns {
+				owned[string(k)] = true
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		chunks := tx.Bucket(bucketChunks)
+		var chunkKeys [][]byte
+		if err := chunks.ForEach(func(k, v []byte) error {
+			var c types.Chunk
+			if err := json.Unmarshal(v, &c); err != nil {
+				return nil
+			}
+			if owned[c.DocID] {
+				chunkKeys = append(chunkKeys, append([]byte(nil), k...))
+				chunkIDs = append(chunkIDs, c.ID)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range chunkKeys {
+			if err := chunks.Delete(k); err != nil {
+				return err
+			}
+		}
+		for id := range owned {
+			if err := unindexTags(tx, id, docs.Get([]byte(id))); err != nil {
+				return err
+			}
+			if err := docs.Delete([]byte(id)); err != nil {
+				return err
+			}
+			docIDs = append(docIDs, id)
+		}
+		if err := deletePins(tx, ns); err != nil {
+			return err
+		}
+		if err := deleteTrash(tx, ns); err != nil {
+			return err
+		}
+		return logChange(tx, types.Change{Op: types.ChangeDeleteNamespace, Namespace: ns})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return docIDs, chunkIDs, nil
+}
+
+// NamespaceChunkIDs returns the IDs of every chunk belonging to a document
+// of namespace ns.
+func (s *BoltMetadataStore) NamespaceChunkIDs(ns string) ([]uint64, error) {
+	var ids []uint64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		owned := map[string]bool{}
+		if err := tx.Bucket(bucketDocs).ForEach(func(k, v []byte) error {
+			if documentNamespace(v) == ns {
+				owned[string(k)] = true
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketChunks).ForEach(func(_, v []byte) error {
+			var c types.Chunk
+			if err := json.Unmarshal(v, &c); err == nil && owned[c.DocID] {
+				ids = append(ids, c.ID)
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// DeleteDocument removes a document and all chunks pointing at it, returning
+// the removed chunk IDs. Deleting a missing document is not an error.
+func (s *BoltMetadataStore) DeleteDocument(id string) ([]uint64, error) {
+	var chunkIDs []uint64
+	err := s.update(func(tx *bbolt.Tx) error {
+		chunks := tx.Bucket(bucketChunks)
+		var keys [][]byte
+		if err := chunks.ForEach(func(k, v []byte) error {
+			var c types.Chunk
+			if err := json.Unmarshal(v, &c); err != nil {
+				return nil
+			}
+			if c.DocID == id {
+				keys = append(keys, append([]byte(nil), k...))
+				chunkIDs = append(chunkIDs, c.ID)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := chunks.Delete(k); err != nil {
+				return err
+			}
+		}
+		docs := tx.Bucket(bucketDocs)
+		data := docs.Get([]byte(id))
+		if data == nil && len(keys) == 0 {
+			return nil
+		}
+		if err := unindexTags(tx, id, data); err != nil {
+			return err
+		}
+		if err := docs.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return logChange(tx, types.Change{Op: types.ChangeDeleteDocument, DocID: id, Namespace: documentNamespace(data), ChunkIDs: chunkIDs})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunkIDs, nil
+}
+
+// TrashDocument moves document id and its chunks into bucketTrash.
+func (s *BoltMetadataStore) TrashDocument(id string, at time.Time) (*types.TrashedDocument, error) {
+	var t types.TrashedDocument
+	err := s.update(func(tx *bbolt.Tx) error {
+		docs := tx.Bucket(bucketDocs)
+		data := docs.Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("document %s: %w", id, ErrNotFound)
+		}
+		if err := json.Unmarshal(data, &t.Document); err != nil {
+			return err
+		}
+		chunks := tx.Bucket(bucketChunks)
+		var keys [][]byte
+		if err := chunks.ForEach(func(k, v []byte) error {
+			var c types.Chunk
+			if err := json.Unmarshal(v, &c); err == nil && c.DocID == id {
+				keys = append(keys, append([]byte(nil), k...))
+				t.Chunks = append(t.Chunks, c)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := chunks.Delete(k); err != nil {
+				return err
+			}
+		}
+		if err := unindexTags(tx, id, data); err != nil {
+			return err
+		}
+		if err := docs.Delete([]byte(id)); err != nil {
+			return err
+		}
+		t.DeletedAt = at.UTC()
+		trashed, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketTrash).Put([]byte(id), trashed); err != nil {
+			return err
+		}
+		return logChange(tx, types.Change{Op: types.ChangeDeleteDocument, DocID: id, Namespace: trashNamespace(t), ChunkIDs: chunkIDsOf(t.Chunks)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// RestoreDocument moves document id and its chunks out of bucketTrash.
+func (s *BoltMetadataStore) RestoreDocument(id string) (*types.TrashedDocument, error) {
+	var t types.TrashedDocument
+	err := s.update(func(tx *bbolt.Tx) error {
+		trash := tx.Bucket(bucketTrash)
+		data := trash.Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("trashed document %s: %w", id, ErrNotFound)
+		}
+		if tx.Bucket(bucketDocs).Get([]byte(id)) != nil {
+			return fmt.Errorf("document %s: %w", id, ErrDocumentExists)
+		}
+		if err := json.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		if err := putDocument(tx, t.Document); err != nil {
+			return err
+		}
+		if err := putChunks(tx, t.Chunks); err != nil {
+			return err
+		}
+		if err := trash.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return logChange(tx, documentChange(t.Document, t.Chunks))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTrash returns the trashed documents of namespace ns, oldest first.
+func (s *BoltMetadataStore) ListTrash(ns string) ([]types.TrashedDocument, error) {
+	var out []types.TrashedDocument
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketTrash)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var t types.TrashedDocument
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			if trashNamespace(t) == ns {
+				out = append(out, t)
+			}
+			return nil
+		})
+	})
+	sortTrash(out)
+	return out, err
+}
+
+// DeleteTrash drops trashed document id and reports whether there was one.
+func (s *BoltMetadataStore) DeleteTrash(id string) (bool, error) {
+	var found bool
+	err := s.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketTrash)
+		found = b.Get([]byte(id)) != nil
+		return b.Delete([]byte(id))
+	})
+	return found, err
+}
+
+// PurgeTrash drops every document trashed before the given time.
+func (s *BoltMetadataStore) PurgeTrash(before time.Time) ([]string, error) {
+	var ids []string
+	err := s.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketTrash)
+		if err := b.ForEach(func(k, v []byte) error {
+			var t struct {
+				DeletedAt time.Time `json:"deleted_at"`
+			}
+			if err := json.Unmarshal(v, &t); err == nil && t.DeletedAt.Before(before) {
+				ids = append(ids, string(k))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// deleteTrash drops the trashed documents of namespace ns.
+func deleteTrash(tx *bbolt.Tx, ns string) error {
+	b := tx.Bucket(bucketTrash)
+	var ids [][]byte
+	if err := b.ForEach(func(k, v []byte) error {
+		var t types.TrashedDocument
+		if err := json.Unmarshal(v, &t); err == nil && trashNamespace(t) == ns {
+			ids = append(ids, append([]byte(nil), k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range ids {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pinKey orders pins by namespace; the NUL separator keeps one namespace's
+// keys from prefixing another's.
+func pinKey(p types.Pin) []byte {
+	return []byte(p.Namespace + "\x00" + pinTarget(p))
+}
+
+// pinTarget names what p pins: "chunk:<id>" or "doc:<id>".
+func pinTarget(p types.Pin) string {
+	if p.ChunkID != nil {
+		return fmt.Sprintf("chunk:%d", *p.ChunkID)
+	}
+	return "doc:" + p.DocID
+}
+
+// SavePin stores p, replacing an existing pin on the same target.
+func (s *BoltMetadataStore) SavePin(p types.Pin) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketPins).Put(pinKey(p), data); err != nil {
+			return err
+		}
+		return logChange(tx, pinChange(types.ChangePin, p))
+	})
+}
+
+// DeletePin removes the pin on p's target and reports whether there was one.
+func (s *BoltMetadataStore) DeletePin(p types.Pin) (bool, error) {
+	var found bool
+	err := s.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketPins)
+		key := pinKey(p)
+		found = b.Get(key) != nil
+		if !found {
+			return nil
+		}
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+		return logChange(tx, pinChange(types.ChangeUnpin, p))
+	})
+	return found, err
+}
+
+// ListPins returns the pins of namespace ns, oldest first.
+func (s *BoltMetadataStore) ListPins(ns string) ([]types.Pin, error) {
+	var pins []types.Pin
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		prefix := []byte(ns + "\x00")
+		c := tx.Bucket(bucketPins).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var p types.Pin
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			pins = append(pins, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].CreatedAt.Before(pins[j].CreatedAt) })
+	return pins, nil
+}
+
+// deletePins removes every pin of namespace ns inside tx.
+func deletePins(tx *bbolt.Tx, ns string) error {
+	prefix := []byte(ns + "\x00")
+	c := tx.Bucket(bucketPins).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveTemplate stores t under its namespace.
+func (s *BoltMetadataStore) SaveTemplate(t types.ContextTemplate) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketTemplates).Put([]byte(t.Namespace), data); err != nil {
+			return err
+		}
+		return logChange(tx, templateChange(t))
+	})
+}
+
+// GetTemplate returns the context template of namespace ns.
+func (s *BoltMetadataStore) GetTemplate(ns string) (*types.ContextTemplate, error) {
+	var t *types.ContextTemplate
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var data []byte
+		if b := tx.Bucket(bucketTemplates); b != nil {
+			data = b.Get([]byte(ns))
+		}
+		if data == nil {
+			return fmt.Errorf("template of namespace %q: %w", ns, ErrNotFound)
+		}
+		t = &types.ContextTemplate{}
+		return json.Unmarshal(data, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeleteTemplate removes the template of ns and reports whether there was one.
+func (s *BoltMetadataStore) DeleteTemplate(ns string) (bool, error) {
+	var found bool
+	err := s.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketTemplates)
+		found = b.Get([]byte(ns)) != nil
+		if !found {
+			return nil
+		}
+		if err := b.Delete([]byte(ns)); err != nil {
+			return err
+		}
+		return logChange(tx, types.Change{Op: types.ChangeDeleteTemplate, Namespace: ns})
+	})
+	return found, err
+}
+
+// ListTemplates returns every stored template, by namespace.
+func (s *BoltMetadataStore) ListTemplates() ([]types.ContextTemplate, error) {
+	var out []types.ContextTemplate
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketTemplates)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var t types.ContextTemplate
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			out = append(out, t)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// DocumentChunks returns the chunks of document id, in ID order.
+func (s *BoltMetadataStore) DocumentChunks(id string) ([]types.Chunk, error) {
+	var chunks []types.Chunk
+	err := s.ForEachChunk(func(c types.Chunk) error {
+		if c.DocID == id {
+			chunks = append(chunks, c)
+		}
+		return nil
+	})
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].ID < chunks[j].ID })
+	return chunks, err
+}
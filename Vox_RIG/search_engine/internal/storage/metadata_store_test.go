@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/types"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestChunkKeyMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+
+	// Write a database the way older versions did: decimal-string keys and
+	// no key-format marker.
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket(bucketChunks)
+		if err != nil {
+			return err
+		}
+		for _, id := range []uint64{2, 10, 1} {
+			data, _ := json.Marshal(types.Chunk{ID: id, DocID: "d", Content: fmt.Sprint(id)})
+			if err := b.Put([]byte(fmt.Sprintf("%d", id)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := NewBoltMetadataStore(path)
+	if err != nil {
+		t.Fatalf("Open with migration failed: %v", err)
+	}
+	var order []uint64
+	s.ForEachChunk(func(c types.Chunk) error {
+		order = append(order, c.ID)
+		return nil
+	})
+	if fmt.Sprint(order) != "[1 2 10]" {
+		t.Errorf("Expected numeric order after migration, got %v", order)
+	}
+	if c, err := s.GetChunk(10); err != nil || c.Content != "10" {
+		t.Errorf("GetChunk(10) after migration = %+v, %v", c, err)
+	}
+	if err := s.SaveChunk(types.Chunk{ID: 3, DocID: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Reopening must not migrate again.
+	s, err = NewBoltMetadataStore(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer s.Close()
+	chunks, err := s.GetChunkRange(2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || chunks[0].ID != 2 || chunks[1].ID != 3 {
+		t.Errorf("Expected chunks 2 and 3 in [2,10), got %+v", chunks)
+	}
+	if id, ok, err := s.MaxChunkID(); err != nil || !ok || id != 10 {
+		t.Errorf("MaxChunkID = %d %v %v, want 10", id, ok, err)
+	}
+}
+
+func TestSaveDocumentWithChunks(t *testing.T) {
+	s, err := NewBoltMetadataStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	gen := s.Generation()
+	doc := types.Document{ID: "d", Metadata: types.Metadata{"namespace": "ns"}}
+	if err := s.SaveDocumentWithChunks(doc, []types.Chunk{{ID: 0, DocID: "d"}, {ID: 1, DocID: "d"}}); err != nil {
+		t.Fatalf("SaveDocumentWithChunks failed: %v", err)
+	}
+	if s.Generation() != gen+1 {
+		t.Errorf("Expected one write transaction, generation went %d -> %d", gen, s.Generation())
+	}
+	if _, err := s.GetDocument("d"); err != nil {
+		t.Errorf("Document not saved: %v", err)
+	}
+	if chunks, _ := s.DocumentChunks("d"); len(chunks) != 2 {
+		t.Errorf("Expected 2 chunks, got %+v", chunks)
+	}
+
+	if err := s.SaveChunks([]types.Chunk{{ID: 2, DocID: "d"}, {ID: 3, DocID: "d"}}); err != nil {
+		t.Fatalf("SaveChunks failed: %v", err)
+	}
+	if n, _ := s.ChunkCount(); n != 4 {
+		t.Errorf("Expected 4 chunks, got %d", n)
+	}
+}
+
+func TestBoltReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	if _, err := NewBoltMetadataStoreReadOnly(path); err == nil {
+		t.Fatalf("Expected an error opening a missing database read-only")
+	}
+
+	s, err := NewBoltMetadataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveDocument(types.Document{ID: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	// Bolt's file lock keeps readers out while a writer has the file open.
+	if _, err := NewBoltMetadataStoreReadOnly(path); err == nil || !strings.Contains(err.Error(), "locked by a writer") {
+		t.Fatalf("Expected a locked-by-writer error, got %v", err)
+	}
+	s.Close()
+
+	ro, err := NewBoltMetadataStoreReadOnly(path)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer ro.Close()
+	if _, err := ro.GetDocument("d"); err != nil {
+		t.Errorf("Expected to read the document, got %v", err)
+	}
+	if err := ro.SaveDocument(types.Document{ID: "e"}); err == nil {
+		t.Errorf("Expected a write to a read-only store to fail")
+	}
+}
+
+func TestChangeLog(t *testing.T) {
+	bolt, err := NewBoltMetadataStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+
+	for name, s := range map[string]MetadataStore{"bolt": bolt, "memory": NewMemoryMetadataStore()} {
+		t.Run(name, func(t *testing.T) {
+			doc := types.Document{ID: "d", Metadata: types.Metadata{"namespace": "ns"}}
+			if err := s.SaveDocumentWithChunks(doc, []types.Chunk{{ID: 0, DocID: "d"}, {ID: 1, DocID: "d"}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SavePin(types.Pin{Namespace: "ns", DocID: "d"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.DeleteDocument("missing"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.DeleteDocument("d"); err != nil {
+				t.Fatal(err)
+			}
+
+			changes, err := s.Changes(0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{types.ChangeDocument, types.ChangePin, types.ChangeDeleteDocument}
+			if len(changes) != len(want) {
+				t.Fatalf("Expected %d changes (deleting a missing document is not one), got %+v", len(want), changes)
+			}
+			for i, c := range changes {
+				if c.Op != want[i] || c.Seq != uint64(i+1) || c.DocID != "d" || c.Namespace != "ns" {
+					t.Errorf("Expected change %d to be %s of d in ns, got %+v", i+1, want[i], c)
+				}
+			}
+			if ids := changes[2].ChunkIDs; len(ids) != 2 || ids[1] != 1 {
+				t.Errorf("Expected the delete to name chunks 0 and 1, got %v", ids)
+			}
+
+			if last, err := s.LastChange(); err != nil || last != 3 {
+				t.Errorf("Expected last change 3, got %d, %v", last, err)
+			}
+			if tail, _ := s.Changes(1, 1); len(tail) != 1 || tail[0].Seq != 2 {
+				t.Errorf("Expected one change after 1, got %+v", tail)
+			}
+		})
+	}
+}
+
+func TestTrash(t *testing.T) {
+	bolt, err := NewBoltMetadataStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, s := range map[string]MetadataStore{"bolt": bolt, "memory": NewMemoryMetadataStore()} {
+		t.Run(name, func(t *testing.T) {
+			for i, id := range []string{"a", "b"} {
+				doc := types.Document{ID: id, Metadata: types.Metadata{"namespace": "ns"}}
+				if err := s.SaveDocumentWithChunks(doc, []types.Chunk{{ID: uint64(i), DocID: id}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.TrashDocument("missing", at); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound for a missing document, got %v", err)
+			}
+			trashed, err := s.TrashDocument("a", at)
+			if err != nil || len(trashed.Chunks) != 1 {
+				t.Fatalf("Expected a with one chunk in the trash, got %+v, %v", trashed, err)
+			}
+			if _, err := s.GetDocument("a"); err == nil {
+				t.Errorf("Expected a trashed document to be gone from the store")
+			}
+			if _, err := s.TrashDocument("b", at.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if trash, _ := s.ListTrash("ns"); len(trash) != 2 || trash[0].Document.ID != "a" {
+				t.Errorf("Expected a and b in the trash, oldest first, got %+v", trash)
+			}
+			if trash, _ := s.ListTrash("other"); len(trash) != 0 {
+				t.Errorf("Expected no trash in another namespace, got %+v", trash)
+			}
+
+			restored, err := s.RestoreDocument("a")
+			if err != nil || restored.Document.ID != "a" {
+				t.Fatalf("Restore failed: %+v, %v", restored, err)
+			}
+			if chunks, _ := s.DocumentChunks("a"); len(chunks) != 1 {
+				t.Errorf("Expected the restored chunk back, got %+v", chunks)
+			}
+			if _, err := s.RestoreDocument("a"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound restoring twice, got %v", err)
+			}
+
+			if ids, err := s.PurgeTrash(at.Add(time.Minute)); err != nil || len(ids) != 0 {
+				t.Errorf("Expected nothing trashed before the cutoff, got %v, %v", ids, err)
+			}
+			if ids, err := s.PurgeTrash(at.Add(2 * time.Hour)); err != nil || len(ids) != 1 || ids[0] != "b" {
+				t.Errorf("Expected b purged, got %v, %v", ids, err)
+			}
+			if ok, _ := s.DeleteTrash("b"); ok {
+				t.Errorf("Expected b to be gone after the purge")
+			}
+		})
+	}
+}
+
+func TestBoltIndexes(t *testing.T) {
+	s, err := NewBoltMetadataStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.SaveDocument(types.Document{ID: "d", Tags: []string{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := s.CheckIndexes(); err != nil || len(problems) != 0 {
+		t.Fatalf("Expected sound indexes, got %v %v", problems, err)
+	}
+
+	// Drift the tag index: a stale entry and a missing one.
+	if err := s.db.Update(func(tx *bbolt.Tx) error {
+		tags := tx.Bucket(bucketTags)
+		if err := tags.Put(tagKey("gone", "d"), []byte{}); err != nil {
+			return err
+		}
+		return tags.Delete(tagKey("b", "d"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := s.CheckIndexes(); err != nil || len(problems) != 2 {
+		t.Fatalf("Expected 2 index problems, got %v %v", problems, err)
+	}
+
+	if err := s.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+	if problems, err := s.CheckIndexes(); err != nil || len(problems) != 0 {
+		t.Errorf("Expected sound indexes after a rebuild, got %v %v", problems, err)
+	}
+	if ids, _ := s.TaggedDocuments("b"); len(ids) != 1 {
+		t.Errorf("Expected the missing entry restored, got %v", ids)
+	}
+}
@@ -1,12 +1,15 @@
-
 package storage
 
 import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"vox-vector-engine/internal/types"
@@ -15,14 +18,33 @@ import (
 const (
 	vectorSize = 4 // float32 is 4 bytes
 
-	// File header (v1):
-	//   0..7   magic "VOXVEC01"
+	// File header (v2):
+	//   0..7   magic "VOXVEC02"
 	//   8..15  dim (uint64)
 	//   16..23 count (uint64)
-	HeaderSize = 24
+	//   24..27 length of the metadata block (uint32)
+	//   28..31 reserved
+	//   32..   metadata block: FileMeta as JSON, zero padded
+	// The vectors start a page in, so the block can be rewritten in place
+	// and every page of vectors is aligned.
+	HeaderSize = 4096
+	metaOffset = 32
+
+	// headerSizeV1 is the header of version 1 files: magic "VOXVEC01",
+	// dim and count, with the vectors right after.
+	headerSizeV1 = 24
+)
+
+var (
+	fileMagic   = [8]byte{'V', 'O', 'X', 'V', 'E', 'C', '0', '2'}
+	fileMagicV1 = [8]byte{'V', 'O', 'X', 'V', 'E', 'C', '0', '1'}
 )
 
-var fileMagic = [8]byte{'V', 'O', 'X', 'V', 'E', 'C', '0', '1'}
+// ErrReadOnly is returned by writes to a store opened read-only.
+var ErrReadOnly = errors.New("store is open read-only")
+
+// ErrClosed is returned by reads from a store after Close.
+var ErrClosed = errors.New("store is closed")
 
 // MmapVectorStore implements VectorStore using memory-mapped files.
 // Note: This is a Windows-specific implementation using syscall.
@@ -33,15 +55,137 @@ type MmapVectorStore struct {
 	mapped     []byte
 	dim        int
 	count      uint64
-	capacity   uint64
 	mapHandle  uintptr // syscall.Handle on Windows
 	viewHandle uintptr // MapViewOfFile address
+	// offset is where the vectors start: HeaderSize, or headerSizeV1 for a
+	// version 1 file opened read-only. meta is the header's metadata block.
+	offset int64
+	meta   FileMeta
+	// wmu serializes Append and Close, which take it before mu, so a growing
+	// file is mapped again without holding mu (see grow). epoch counts the
+	// swaps.
+	wmu   sync.Mutex
+	epoch atomic.Uint64
+	// state is what Get reads, in place of taking mu. cur wraps mapped;
+	// retired holds the views swapped out while a Get was still reading
+	// them, guarded by rmu (see swapView).
+	state   atomic.Pointer[mapState]
+	cur     *mapping
+	rmu     sync.Mutex
+	retired []*mapping
+
+	policy   FlushPolicy
+	growth   GrowthPolicy
+	readOnly bool
+	// win, set by GrowthPolicy.MapWindow, replaces mapped for reads; the
+	// file is then fileSize bytes long.
+	win      *windowMap
+	fileSize int64
+	// published is the count last written to the header; it trails count
+	// by up to FlushPolicy.CountEvery-1 appends.
+	published uint64
+	unsynced  atomic.Uint64 // appends since the last successful Sync
+	stopSync  chan struct{} // closes the interval flusher, if any
+}
+
+// FlushPolicy controls when appended vectors are forced to disk. The zero
+// value leaves durability to the OS page cache until Sync or Close. Either
+// way the vectors' bytes are flushed before the header count that covers
+// them, so a crash can lose recent vectors but never expose torn ones.
+type FlushPolicy struct {
+	// EveryAppends syncs after this many appends (0 disables).
+	EveryAppends int
+	// Interval syncs in the background at this period if anything changed (0 disables).
+	Interval time.Duration
+	// CountEvery writes the header count once per this many appends rather
+	// than after each one (0 or 1 = every append), flushing the vectors it
+	// covers with one msync instead of one per vector. Sync, Close and the
+	// interval flusher write it too. Until then the newest vectors are
+	// served by this process but invisible to -readonly followers, and a
+	// crash loses them even though the metadata store may hold their chunks.
+	CountEvery int
+}
+
+// Growth defaults, used for zero GrowthPolicy fields.
+const (
+	DefaultInitialCapacity = 1024
+	DefaultGrowthFactor    = 0.5
+)
+
+// GrowthPolicy sizes the vectors file. Growing it truncates and remaps the
+// file under the write lock, stalling every reader, so a store expected to
+// hold many vectors should start big rather than grow in steps.
+type GrowthPolicy struct {
+	// InitialCapacity is how many vectors a new file has room for.
+	InitialCapacity int
+	// Factor is the fraction of its room for vectors a full file grows by.
+	Factor float64
+	// Preallocate grows the file on open until it holds this many vectors
+	// (0 disables).
+	Preallocate int
+	// Sparse extends the file without reserving its disk blocks, which
+	// costs no disk up front (e.g. for a large Preallocate) but lets the
+	// filesystem scatter the file as it fills. By default growth reserves
+	// them where the OS allows (fallocate, F_PREALLOCATE, the NTFS
+	// allocation size).
+	Sparse bool
+	// MapWindow, when set, maps the file in read-only windows of this many
+	// bytes (rounded up to 64 KiB) instead of as one view, and writes it
+	// with pwrite. At most MapWindows windows (DefaultMapWindows if 0) stay
+	// mapped, which bounds the address space a huge store needs at the cost
+	// of a map call on each window miss. Growth then never remaps.
+	MapWindow  int64
+	MapWindows int
+}
+
+// Validate rejects negative sizes and factors.
+func (g GrowthPolicy) Validate() error {
+	if g.InitialCapacity < 0 || g.Factor < 0 || g.Preallocate < 0 || g.MapWindow < 0 || g.MapWindows < 0 {
+		return fmt.Errorf("invalid growth policy: initial capacity, factor, preallocate and map window sizes must not be negative")
+	}
+	return nil
+}
+
+func (g GrowthPolicy) mapWindows() int {
+	if g.MapWindows > 0 {
+		return g.MapWindows
+	}
+	return DefaultMapWindows
+}
+
+func (g GrowthPolicy) initialCapacity() int {
+	if g.InitialCapacity > 0 {
+		return g.InitialCapacity
+	}
+	return DefaultInitialCapacity
+}
+
+func (g GrowthPolicy) factor() float64 {
+	if g.Factor > 0 {
+		return g.Factor
+	}
+	return DefaultGrowthFactor
 }
 
 func NewMmapVectorStore(filename string, dim int) (*MmapVectorStore, error) {
+	return NewMmapVectorStoreWithGrowth(filename, dim, GrowthPolicy{})
+}
+
+// NewMmapVectorStoreWithGrowth is NewMmapVectorStore with a growth policy
+// other than the defaults.
+func NewMmapVectorStoreWithGrowth(filename string, dim int, growth GrowthPolicy) (*MmapVectorStore, error) {
 	if dim <= 0 {
 		return nil, fmt.Errorf("invalid dim: %d", dim)
 	}
+	if err := growth.Validate(); err != nil {
+		return nil, err
+	}
+
+	if migrated, err := MigrateVectorFile(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if migrated {
+		log.Printf("[storage] migrated %s to format version %d", filename, FormatVersion)
+	}
 
 	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
@@ -58,6 +202,10 @@ func NewMmapVectorStore(filename string, dim int) (*MmapVectorStore, error) {
 		filename: filename,
 		file:     f,
 		dim:      dim,
+		growth:   growth,
+	}
+	if growth.MapWindow > 0 {
+		store.win = newWindowMap(f, growth.MapWindow, dim*vectorSize, growth.mapWindows())
 	}
 
 	size := info.Size()
@@ -75,75 +223,202 @@ func NewMmapVectorStore(filename string, dim int) (*MmapVectorStore, error) {
 		return nil, err
 	}
 
-	// Read + validate header (and set count/dim from disk)
-	onDiskDim, onDiskCount, err := store.readAndValidateHeader()
-	if err != nil {
+	if err := store.loadHeader(); err != nil {
 		_ = store.Close()
 		return nil, err
 	}
 
+	if want := store.offset + int64(growth.Preallocate*dim*vectorSize); growth.Preallocate > 0 && want > store.length() {
+		if err := store.resize(want); err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("preallocate failed: %w", err)
+		}
+		if err := store.remap(); err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("preallocate failed: %w", err)
+		}
+	}
+
+	store.publishState()
+	return store, nil
+}
+
+// loadHeader validates the mapped header against s.dim and the file size and
+// sets s.count from it.
+func (s *MmapVectorStore) loadHeader() error {
+	h, err := s.readAndValidateHeader()
+	if err != nil {
+		return err
+	}
+	onDiskDim, onDiskCount := h.dim, h.count
+
 	// Enforce "proper" configuration: dim is stored in the file and must match CLI dim.
-	if int(onDiskDim) != store.dim {
-		_ = store.Close()
-		return nil, fmt.Errorf("vector dimension mismatch: file dim=%d, requested dim=%d (delete %s to reset)", onDiskDim, store.dim, filename)
+	if int(onDiskDim) != s.dim {
+		return fmt.Errorf("vector dimension mismatch: file dim=%d, requested dim=%d (delete %s to reset)", onDiskDim, s.dim, s.filename)
+	}
+	// A count the file cannot hold means the file was truncated (or the
+	// header written without its data); refuse it rather than read garbage.
+	if need := uint64(h.size) + onDiskCount*onDiskDim*vectorSize; need > uint64(s.length()) {
+		return fmt.Errorf("vectors file %s is truncated: header count=%d needs %d bytes but the file has %d (restore a snapshot)", s.filename, onDiskCount, need, s.length())
 	}
-	store.count = onDiskCount
+	s.count = onDiskCount
+	s.published = onDiskCount
+	s.offset, s.meta = h.size, h.meta
+	return nil
+}
 
+// OpenMmapVectorStoreReadOnly maps an existing vectors file without write
+// access, so another process may own it. Append fails with ErrReadOnly;
+// Refresh picks up vectors the writer has appended since.
+func OpenMmapVectorStoreReadOnly(filename string, dim int) (*MmapVectorStore, error) {
+	if dim <= 0 {
+		return nil, fmt.Errorf("invalid dim: %d", dim)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	store := &MmapVectorStore{
+		filename: filename,
+		file:     f,
+		dim:      dim,
+		readOnly: true,
+	}
+	if err := store.remap(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := store.loadHeader(); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	store.publishState()
 	return store, nil
 }
 
+// Refresh re-reads the vector count from the file header, remapping if the
+// file has grown. Read-only stores use it to follow a writer in another
+// process; for a writable store it is a no-op. It returns the new count.
+func (s *MmapVectorStore) Refresh() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.readOnly || s.file == nil {
+		return s.count, nil
+	}
+	count := binary.LittleEndian.Uint64(s.mapped[16:24])
+	if uint64(s.offset)+count*uint64(s.dim*vectorSize) > uint64(len(s.mapped)) {
+		if err := s.remapGrown(); err != nil {
+			return s.count, fmt.Errorf("remap failed: %w", err)
+		}
+		if int64(len(s.mapped)) < s.offset {
+			return s.count, fmt.Errorf("vectors file %s shrank below its header", s.filename)
+		}
+		count = binary.LittleEndian.Uint64(s.mapped[16:24])
+		if uint64(s.offset)+count*uint64(s.dim*vectorSize) > uint64(len(s.mapped)) {
+			return s.count, nil // the writer is mid-growth; try again later
+		}
+	}
+	s.count = count
+	s.publishState()
+	return count, nil
+}
+
 func (s *MmapVectorStore) initNew() error {
-	// initial capacity: header + space for 1024 vectors
-	initialSize := int64(HeaderSize + 1024*s.dim*vectorSize)
+	initialSize := int64(HeaderSize + s.growth.initialCapacity()*s.dim*vectorSize)
 	if err := s.resize(initialSize); err != nil {
 		return err
 	}
 	if err := s.remap(); err != nil {
 		return err
 	}
-	s.writeHeader(uint64(s.dim), 0)
+	s.offset, s.meta = HeaderSize, newFileMeta(s.dim)
+	if err := s.writeHeader(0); err != nil {
+		return err
+	}
 	s.count = 0
+	s.published = 0
 	return nil
 }
 
-func (s *MmapVectorStore) readAndValidateHeader() (dim uint64, count uint64, err error) {
-	if len(s.mapped) < HeaderSize {
-		return 0, 0, fmt.Errorf("vectors file too small for header: %d < %d", len(s.mapped), HeaderSize)
+// length returns the size of the file as mapped.
+func (s *MmapVectorStore) length() int64 {
+	if s.win != nil {
+		return s.fileSize
 	}
+	return int64(len(s.mapped))
+}
 
-	var mg [8]byte
-	copy(mg[:], s.mapped[:8])
-	if mg != fileMagic {
-		return 0, 0, errors.New("invalid vectors file header (magic mismatch): delete vectors.bin to reset")
+func (s *MmapVectorStore) readAndValidateHeader() (fileHeader, error) {
+	var h fileHeader
+	var err error
+	if s.win != nil {
+		h, err = readHeader(s.file)
+	} else {
+		h, err = decodeHeader(s.mapped)
+	}
+	if err != nil {
+		return h, fmt.Errorf("%w: delete %s to reset", err, s.filename)
 	}
+	return h, nil
+}
 
-	dim = binary.LittleEndian.Uint64(s.mapped[8:16])
-	count = binary.LittleEndian.Uint64(s.mapped[16:24])
-	if dim == 0 {
-		return 0, 0, errors.New("invalid vectors file header (dim=0): delete vectors.bin to reset")
+// writeHeader writes the whole header: s.meta and count.
+func (s *MmapVectorStore) writeHeader(count uint64) error {
+	header, err := encodeHeader(s.meta, count)
+	if err != nil {
+		return err
+	}
+	if s.win != nil {
+		_, err := s.file.WriteAt(header, 0)
+		return err
 	}
-	return dim, count, nil
+	copy(s.mapped, header)
+	return nil
 }
 
-func (s *MmapVectorStore) writeHeader(dim uint64, count uint64) {
-	copy(s.mapped[:8], fileMagic[:])
-	binary.LittleEndian.PutUint64(s.mapped[8:16], dim)
-	binary.LittleEndian.PutUint64(s.mapped[16:24], count)
+// FileMeta returns the metadata block of the file's header.
+func (s *MmapVectorStore) FileMeta() FileMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.meta
 }
 
-func (s *MmapVectorStore) resize(newSize int64) error {
-	if err := s.munmap(); err != nil {
-		return err
+// SetFileModel records model as the embedding model of the file's vectors;
+// a file already tagged with another one becomes MixedModels. The header
+// is rewritten in place and flushed with the vectors.
+func (s *MmapVectorStore) SetFileModel(model string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	switch {
+	case model == "" || s.meta.Model == model || s.meta.Model == MixedModels:
+		return nil
+	case s.meta.Model != "":
+		model = MixedModels
 	}
-	if err := s.file.Truncate(newSize); err != nil {
+	prev := s.meta
+	s.meta.Model = model
+	// The count bytes are rewritten as published, so a batched count is
+	// not exposed ahead of its vectors.
+	if err := s.writeHeader(s.published); err != nil {
+		s.meta = prev
 		return err
 	}
 	return nil
 }
 
+func (s *MmapVectorStore) resize(newSize int64) error {
+	if err := s.munmap(); err != nil {
+		return err
+	}
+	return s.extend(newSize)
+}
+
 func (s *MmapVectorStore) remap() error {
 	// Always unmap any existing view before mapping a new one.
-	// Append() may call remap() after resize(), but NewMmapVectorStore() calls remap()
+	// grow() may call remap() after resize(), but NewMmapVectorStore() calls remap()
 	// without a prior munmap(). Re-mapping without unmapping leaks handles and can
 	// cause MapViewOfFile/CreateFileMapping failures on Windows.
 	if err := s.munmap(); err != nil {
@@ -155,6 +430,12 @@ func (s *MmapVectorStore) remap() error {
 		return err
 	}
 	size := fi.Size()
+	if s.win != nil {
+		// Windows are mapped on demand; one mapped before the file grew is
+		// remapped when a read falls past its end.
+		s.fileSize = size
+		return nil
+	}
 	if size == 0 {
 		return nil
 	}
@@ -163,76 +444,369 @@ func (s *MmapVectorStore) remap() error {
 }
 
 func (s *MmapVectorStore) Append(vector types.Vector) (uint64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if s.readOnly {
+		return 0, ErrReadOnly
+	}
 
 	if len(vector) != s.dim {
 		return 0, fmt.Errorf("vector dimension mismatch: expected %d, got %d", s.dim, len(vector))
 	}
 
+	// count and the file's size only change under wmu, so they can be read
+	// here without mu.
 	// Compute required bytes for header + N vectors
-	requiredSize := int64(HeaderSize + (int(s.count)+1)*s.dim*vectorSize)
-	if requiredSize > int64(len(s.mapped)) {
-		// Grow by 50% or at least required size
-		newSize := int64(len(s.mapped)) + int64(len(s.mapped))/2
+	requiredSize := s.offset + int64((int(s.count)+1)*s.dim*vectorSize)
+	if requiredSize > s.length() {
+		// Grow the room for vectors by the policy's factor, or at least to
+		// the required size
+		room := s.length() - s.offset
+		newSize := s.length() + int64(float64(room)*s.growth.factor())
 		if newSize < requiredSize {
 			newSize = requiredSize
 		}
-
-		if err := s.resize(newSize); err != nil {
-			return 0, fmt.Errorf("resize failed: %w", err)
-		}
-		if err := s.remap(); err != nil {
-			return 0, fmt.Errorf("remap failed: %w", err)
+		if err := s.grow(newSize); err != nil {
+			return 0, err
 		}
-		// After remap, header must still exist; ensure it's correct
-		s.writeHeader(uint64(s.dim), s.count)
+		// The header lives in the file, so the new mapping already holds it.
 	}
 
-	offset := HeaderSize + int(s.count)*s.dim*vectorSize
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset := int(s.offset) + int(s.count)*s.dim*vectorSize
 
 	// Write vector
-	for i, v := range vector {
-		bits := *(*uint32)(unsafe.Pointer(&v))
-		binary.LittleEndian.PutUint32(s.mapped[offset+i*4:], bits)
+	if s.win != nil {
+		buf := make([]byte, s.dim*vectorSize)
+		encodeVector(buf, vector)
+		if _, err := s.file.WriteAt(buf, int64(offset)); err != nil {
+			return 0, fmt.Errorf("write vector: %w", err)
+		}
+	} else {
+		encodeVector(s.mapped[offset:], vector)
 	}
 
 	s.count++
-	// Update count header (and keep magic/dim stable)
-	s.writeHeader(uint64(s.dim), s.count)
+	s.publishState()
+	if s.count-s.published >= uint64(max(s.policy.CountEvery, 1)) {
+		if err := s.publishLocked(); err != nil {
+			return s.count - 1, err
+		}
+	}
+
+	n := s.unsynced.Add(1)
+	if every := s.policy.EveryAppends; every > 0 && n >= uint64(every) {
+		if err := s.publishLocked(); err != nil {
+			return s.count - 1, err
+		}
+		if err := s.syncLocked(); err != nil {
+			return s.count - 1, fmt.Errorf("sync failed: %w", err)
+		}
+	}
 
 	return s.count - 1, nil
 }
 
+// publishLocked flushes the vectors appended since the last publish and then
+// writes the header count that covers them; only the count bytes change, so
+// the rest of the first page is never rewritten. The kernel writes dirty
+// pages back in any order, so without the flush a crash could persist the
+// new count ahead of the bytes it points at. s.mu must be held for writing.
+func (s *MmapVectorStore) publishLocked() error {
+	if s.published == s.count || s.readOnly {
+		return nil
+	}
+	if s.win != nil {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+		var count [8]byte
+		binary.LittleEndian.PutUint64(count[:], s.count)
+		if _, err := s.file.WriteAt(count[:], 16); err != nil {
+			return err
+		}
+		s.published = s.count
+		return nil
+	}
+	offset := int(s.offset) + int(s.published)*s.dim*vectorSize
+	if err := s.flushRange(offset, int(s.count-s.published)*s.dim*vectorSize); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(s.mapped[16:24], s.count)
+	s.published = s.count
+	return nil
+}
+
+// SetFlushPolicy replaces the flush policy and (re)starts the interval
+// flusher if p.Interval is set.
+func (s *MmapVectorStore) SetFlushPolicy(p FlushPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		_ = s.publishLocked() // a smaller CountEvery applies from now on
+	}
+
+	if s.stopSync != nil {
+		close(s.stopSync)
+		s.stopSync = nil
+	}
+	s.policy = p
+	if p.Interval > 0 {
+		s.stopSync = make(chan struct{})
+		go s.syncLoop(p.Interval, s.stopSync)
+	}
+}
+
+// ReadOnly reports whether the store was opened with OpenMmapVectorStoreReadOnly.
+func (s *MmapVectorStore) ReadOnly() bool {
+	return s.readOnly
+}
+
+// GrowthPolicy returns the policy the store was opened with.
+func (s *MmapVectorStore) GrowthPolicy() GrowthPolicy {
+	return s.growth
+}
+
+// FlushPolicy returns the policy set by SetFlushPolicy.
+func (s *MmapVectorStore) FlushPolicy() FlushPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+func (s *MmapVectorStore) syncLoop(every time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if s.unsynced.Load() == 0 {
+				continue
+			}
+			_ = s.Sync()
+		}
+	}
+}
+
+// Sync writes any batched header count and flushes the mapping and the file
+// to stable storage (msync on Unix, FlushViewOfFile + FlushFileBuffers on
+// Windows). Only the count update takes the write lock; readers keep going
+// while the file is flushed.
+func (s *MmapVectorStore) Sync() error {
+	s.mu.Lock()
+	err := s.publishLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.syncLocked()
+}
+
+// syncLocked requires s.mu to be held (read or write). It does not write a
+// batched count; callers holding the write lock call publishLocked first.
+func (s *MmapVectorStore) syncLocked() error {
+	if s.file == nil || s.readOnly {
+		return nil
+	}
+	pending := s.unsynced.Load()
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.unsynced.Add(-pending)
+	return nil
+}
+
+// Get reads vector index from the current state snapshot without taking a
+// lock, so concurrent searches do not contend with each other or wait on
+// Append; pinning the snapshot's view keeps a concurrent grow from
+// unmapping it mid-read. Windowed stores read through their windows under
+// the read lock.
 func (s *MmapVectorStore) Get(index uint64) (types.Vector, error) {
+	for {
+		st := s.state.Load()
+		if st == nil || st.m == nil {
+			return s.getLocked(index)
+		}
+		if st.m.pin() {
+			v, err := st.get(index)
+			s.unpin(st.m)
+			return v, err
+		}
+		// Swapped out since the load; the next state has its successor.
+		s.unpin(st.m)
+	}
+}
+
+// getLocked is Get under the read lock, as every read was before the state
+// snapshot.
+func (s *MmapVectorStore) getLocked(index uint64) (types.Vector, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	if s.file == nil {
+		return nil, ErrClosed
+	}
 	if index >= s.count {
 		return nil, fmt.Errorf("index out of bounds: %d >= %d", index, s.count)
 	}
 
-	offset := HeaderSize + int(index)*s.dim*vectorSize
-	vec := make(types.Vector, s.dim)
+	offset := int(s.offset) + int(index)*s.dim*vectorSize
+	var data []byte
+	if s.win != nil {
+		data = make([]byte, s.dim*vectorSize)
+		if err := s.win.read(int64(offset), data, s.fileSize); err != nil {
+			return nil, err
+		}
+	} else {
+		data = s.mapped[offset:]
+	}
 
+	vec := make(types.Vector, s.dim)
 	for i := 0; i < s.dim; i++ {
-		bits := binary.LittleEndian.Uint32(s.mapped[offset+i*4:])
+		bits := binary.LittleEndian.Uint32(data[i*4:])
 		vec[i] = *(*float32)(unsafe.Pointer(&bits))
 	}
 
 	return vec, nil
 }
 
+// encodeVector writes v little-endian into dst.
+func encodeVector(dst []byte, v types.Vector) {
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(dst[i*4:], *(*uint32)(unsafe.Pointer(&f)))
+	}
+}
+
 func (s *MmapVectorStore) Count() uint64 {
+	if st := s.state.Load(); st != nil {
+		return st.count
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.count
 }
 
 func (s *MmapVectorStore) Close() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_ = s.munmap()
-	return s.file.Close()
+	if s.file == nil {
+		return nil
+	}
+	if s.stopSync != nil {
+		close(s.stopSync)
+		s.stopSync = nil
+	}
+	syncErr := s.publishLocked()
+	if err := s.syncLocked(); syncErr == nil {
+		syncErr = err
+	}
+	// A Get racing Close finishes on the view it pinned, which is unmapped
+	// when it is done; later ones find the store closed.
+	s.state.Store(nil)
+	if old := s.cur; old != nil {
+		s.setView(view{})
+		s.retire(old)
+	} else {
+		_ = s.munmap()
+	}
+	if s.win != nil {
+		s.win.close()
+	}
+	err := s.file.Close()
+	if err == nil {
+		err = syncErr
+	}
+	s.file = nil
+	return err
+}
+
+// WriteTo copies the header and all stored vectors to w, in the current
+// format whatever the file's. The copy is taken under the read lock, so it
+// is consistent with Count() at the time of the call.
+func (s *MmapVectorStore) WriteTo(w io.Writer) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// The copy carries the live count, which a batched header may trail.
+	meta := s.meta
+	if meta.FormatVersion != FormatVersion {
+		meta = newFileMeta(s.dim)
+		meta.MigratedFrom = s.meta.FormatVersion
+	}
+	header, err := encodeHeader(meta, s.count)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	used := s.offset + int64(s.count)*int64(s.dim*vectorSize)
+	if s.win != nil {
+		m, err := io.Copy(w, io.NewSectionReader(s.file, s.offset, used-s.offset))
+		return int64(n) + m, err
+	}
+	m, err := w.Write(s.mapped[s.offset:used])
+	return int64(n + m), err
+}
+
+// Capacity returns how many vectors fit in the mapped file before it grows.
+func (s *MmapVectorStore) Capacity() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.length() < s.offset {
+		return 0
+	}
+	return uint64(s.length()-s.offset) / uint64(s.dim*vectorSize)
+}
+
+// MappedBytes returns how much of the file is mapped: all of it, or in
+// windowed mode only the windows currently open.
+func (s *MmapVectorStore) MappedBytes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.win != nil {
+		return s.win.mapped()
+	}
+	return int64(len(s.mapped)) + s.retiredBytes()
+}
+
+// DiskUsage returns the file's length and the bytes it occupies on disk,
+// less than its length while it is sparse.
+func (s *MmapVectorStore) DiskUsage() (apparent, allocated int64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.file == nil {
+		return 0, 0, os.ErrClosed
+	}
+	fi, err := s.file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	allocated, err = diskUsage(s.file)
+	return fi.Size(), allocated, err
+}
+
+// Path returns the file backing the store.
+func (s *MmapVectorStore) Path() string {
+	return s.filename
+}
+
+// Dim returns the vector dimension stored in the file header.
+func (s *MmapVectorStore) Dim() int {
+	return s.dim
 }
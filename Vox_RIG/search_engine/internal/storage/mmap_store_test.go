@@ -1,9 +1,18 @@
-
 package storage
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"vox-vector-engine/internal/types"
 )
@@ -98,3 +107,651 @@ func TestMmapVectorStore_DimMismatch(t *testing.T) {
 		t.Fatalf("Expected error on dim mismatch, got nil")
 	}
 }
+
+func TestMmapVectorStore_FlushPolicy(t *testing.T) {
+	tmpFile := "test_vectors_flush.bin"
+	defer os.Remove(tmpFile)
+
+	store, err := NewMmapVectorStore(tmpFile, 2)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	store.SetFlushPolicy(FlushPolicy{EveryAppends: 2})
+
+	if _, err := store.Append(types.Vector{1, 2}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if n := store.unsynced.Load(); n != 1 {
+		t.Errorf("Expected 1 unsynced append, got %d", n)
+	}
+
+	if _, err := store.Append(types.Vector{3, 4}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if n := store.unsynced.Load(); n != 0 {
+		t.Errorf("Expected policy to sync after 2 appends, %d still unsynced", n)
+	}
+
+	if _, err := store.Append(types.Vector{5, 6}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := store.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if n := store.unsynced.Load(); n != 0 {
+		t.Errorf("Expected explicit Sync to clear unsynced count, got %d", n)
+	}
+}
+
+func TestMmapVectorStore_CountBeyondFile(t *testing.T) {
+	tmpFile := "test_vectors_truncated.bin"
+	defer os.Remove(tmpFile)
+
+	store, err := NewMmapVectorStore(tmpFile, 2)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if _, err := store.Append(types.Vector{1, 2}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	_ = store.Close()
+
+	// A header count past the end of the file must not be trusted.
+	f, err := os.OpenFile(tmpFile, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count [8]byte
+	binary.LittleEndian.PutUint64(count[:], 1<<20)
+	if _, err := f.WriteAt(count[:], 16); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := NewMmapVectorStore(tmpFile, 2); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("Expected a truncated file error, got %v", err)
+	}
+}
+
+func TestMmapVectorStore_CountEvery(t *testing.T) {
+	tmpFile := "test_vectors_count_every.bin"
+	defer os.Remove(tmpFile)
+
+	store, err := NewMmapVectorStore(tmpFile, 2)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.SetFlushPolicy(FlushPolicy{CountEvery: 4})
+	headerCount := func() uint64 {
+		t.Helper()
+		data, err := os.ReadFile(tmpFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return binary.LittleEndian.Uint64(data[16:24])
+	}
+	appendN := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := store.Append(types.Vector{float32(i), 1}); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+	}
+
+	appendN(3)
+	if store.Count() != 3 || headerCount() != 0 {
+		t.Fatalf("Expected 3 live vectors and an unwritten header, got count=%d header=%d", store.Count(), headerCount())
+	}
+	appendN(1)
+	if headerCount() != 4 {
+		t.Fatalf("Expected the 4th append to write the header count, got %d", headerCount())
+	}
+
+	appendN(1)
+	var buf bytes.Buffer
+	if _, err := store.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.LittleEndian.Uint64(buf.Bytes()[16:24]); got != 5 || buf.Len() != HeaderSize+5*2*4 {
+		t.Errorf("Expected WriteTo to carry the live count 5, got %d (%d bytes)", got, buf.Len())
+	}
+	if err := store.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if headerCount() != 5 {
+		t.Errorf("Expected Sync to write the batched count, got %d", headerCount())
+	}
+
+	appendN(2)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewMmapVectorStore(tmpFile, 2)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.Count() != 7 {
+		t.Errorf("Expected Close to write the batched count, reopened with %d vectors", reopened.Count())
+	}
+}
+
+func TestMmapVectorStore_GrowthPolicy(t *testing.T) {
+	tmpFile := "test_vectors_growth.bin"
+	defer os.Remove(tmpFile)
+
+	if _, err := NewMmapVectorStoreWithGrowth(tmpFile, 2, GrowthPolicy{Factor: -1}); err == nil {
+		t.Fatalf("Expected a negative growth factor to be rejected")
+	}
+
+	store, err := NewMmapVectorStoreWithGrowth(tmpFile, 2, GrowthPolicy{InitialCapacity: 4, Factor: 2})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if c := store.Capacity(); c != 4 {
+		t.Errorf("Expected room for 4 vectors, got %d", c)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := store.Append(types.Vector{float32(i), 0}); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	// Room for 4 vectors grown by a factor of 2 is room for 12.
+	if c := store.Capacity(); c != 12 {
+		t.Errorf("Expected the file to triple to room for 12 vectors, got %d", c)
+	}
+	_ = store.Close()
+
+	store, err = NewMmapVectorStoreWithGrowth(tmpFile, 2, GrowthPolicy{Preallocate: 1000})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	if c := store.Capacity(); c != 1000 || store.Count() != 5 {
+		t.Errorf("Expected room for 1000 vectors with 5 kept, got capacity %d count %d", c, store.Count())
+	}
+	if v, err := store.Get(4); err != nil || v[0] != 4 {
+		t.Errorf("Expected vector 4 to survive preallocation, got %v, %v", v, err)
+	}
+}
+
+func TestMmapVectorStore_GrowWhileReading(t *testing.T) {
+	tmpFile := "test_vectors_grow_reading.bin"
+	defer os.Remove(tmpFile)
+
+	store, err := NewMmapVectorStoreWithGrowth(tmpFile, 4, GrowthPolicy{InitialCapacity: 2, Factor: 0.25})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.Append(types.Vector{0, 0, 0, 0}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	// Readers hammer the vectors already stored while every few appends
+	// grow the file and swap the mapping under them.
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				n := store.Count()
+				i := uint64(rand.Intn(int(n)))
+				v, err := store.Get(i)
+				if err == nil && v[0] != float32(i) {
+					err = fmt.Errorf("vector %d reads %v", i, v)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for i := 1; i < 500; i++ {
+		if _, err := store.Append(types.Vector{float32(i), 1, 2, 3}); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if store.MapEpoch() == 0 {
+		t.Error("Expected the file to be remapped as it grew")
+	}
+}
+
+func TestMmapVectorStore_RetiredViewsUnmapped(t *testing.T) {
+	store, err := NewMmapVectorStoreWithGrowth(filepath.Join(t.TempDir(), "vectors.bin"), 4, GrowthPolicy{InitialCapacity: 2, Factor: 0.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	appendN := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := store.Append(types.Vector{float32(store.Count()), 0, 0, 0}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	retired := func() int {
+		store.rmu.Lock()
+		defer store.rmu.Unlock()
+		return len(store.retired)
+	}
+
+	// Without readers a swapped-out view is unmapped straight away.
+	appendN(10)
+	if store.MapEpoch() == 0 || retired() != 0 || store.MappedBytes() != store.length() {
+		t.Fatalf("Expected only the current view mapped, got epoch=%d retired=%d mapped=%d length=%d",
+			store.MapEpoch(), retired(), store.MappedBytes(), store.length())
+	}
+
+	// A reader pinned across a grow keeps its view mapped until it is done.
+	st := store.state.Load()
+	if !st.m.pin() {
+		t.Fatal("Expected the current view to pin")
+	}
+	epoch := store.MapEpoch()
+	for store.MapEpoch() == epoch {
+		appendN(1)
+	}
+	if retired() != 1 {
+		t.Fatalf("Expected the pinned view to be retired but mapped, got %d retired", retired())
+	}
+	if v, err := st.get(3); err != nil || v[0] != 3 {
+		t.Fatalf("Expected the pinned view to stay readable, got %v %v", v, err)
+	}
+	store.unpin(st.m)
+	if retired() != 0 || store.MappedBytes() != store.length() {
+		t.Errorf("Expected the view to be unmapped by its last reader, got %d retired", retired())
+	}
+}
+
+// TestMmapVectorStore_GetDuringGrows is meant for -race: lock-free Gets
+// run against an appender that keeps growing the file, then against Close.
+// Every retired view must be unmapped once the readers are done.
+func TestMmapVectorStore_GetDuringGrows(t *testing.T) {
+	store, err := NewMmapVectorStoreWithGrowth(filepath.Join(t.TempDir(), "vectors.bin"), 4, GrowthPolicy{InitialCapacity: 2, Factor: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Append(types.Vector{0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stop atomic.Bool
+	read := func(closing bool) error {
+		for !stop.Load() {
+			i := uint64(rand.Intn(int(store.Count())))
+			v, err := store.Get(i)
+			if closing && errors.Is(err, ErrClosed) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if v[0] != float32(i) {
+				return fmt.Errorf("vector %d reads %v", i, v)
+			}
+		}
+		return nil
+	}
+	run := func(closing bool, during func()) {
+		t.Helper()
+		stop.Store(false)
+		errs := make(chan error, 8)
+		for r := 0; r < cap(errs); r++ {
+			go func() { errs <- read(closing) }()
+		}
+		during()
+		stop.Store(true)
+		for r := 0; r < cap(errs); r++ {
+			if err := <-errs; err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	run(false, func() {
+		for i := 1; i < 2000; i++ {
+			if _, err := store.Append(types.Vector{float32(i), 0, 0, 0}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	store.rmu.Lock()
+	retired := len(store.retired)
+	store.rmu.Unlock()
+	if store.MapEpoch() < 10 || retired != 0 || store.MappedBytes() != store.length() {
+		t.Errorf("Expected many grows and no view left retired, got epoch=%d retired=%d mapped=%d length=%d",
+			store.MapEpoch(), retired, store.MappedBytes(), store.length())
+	}
+
+	run(true, func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	store.rmu.Lock()
+	retired = len(store.retired)
+	store.rmu.Unlock()
+	if retired != 0 {
+		t.Errorf("Expected the closed store's view to be unmapped, %d still retired", retired)
+	}
+}
+
+func TestMmapVectorStore_Windowed(t *testing.T) {
+	tmpFile := "test_vectors_windowed.bin"
+	defer os.Remove(tmpFile)
+
+	// 512-byte vectors in 64 KiB windows: 128 per window, so 1000 vectors
+	// span 8 windows of which at most 2 stay mapped.
+	const dim, n = 128, 1000
+	growth := GrowthPolicy{InitialCapacity: 16, MapWindow: 1, MapWindows: 2}
+	store, err := NewMmapVectorStoreWithGrowth(tmpFile, dim, growth)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	vec := func(i int) types.Vector {
+		v := make(types.Vector, dim)
+		v[0], v[dim-1] = float32(i), float32(-i)
+		return v
+	}
+	for i := 0; i < n; i++ {
+		if _, err := store.Append(vec(i)); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	for _, i := range []int{0, 999, 127, 128, 500, 0, 640} {
+		v, err := store.Get(uint64(i))
+		if err != nil || v[0] != float32(i) || v[dim-1] != float32(-i) {
+			t.Fatalf("Expected vector %d back, got %v, %v", i, err, v[:1])
+		}
+	}
+	if m := store.MappedBytes(); m > 2*(windowAlign+dim*4) {
+		t.Errorf("Expected at most 2 windows mapped, got %d bytes", m)
+	}
+	var buf bytes.Buffer
+	if _, err := store.WriteTo(&buf); err != nil || buf.Len() != HeaderSize+n*dim*4 {
+		t.Fatalf("Expected WriteTo to copy %d vectors, got %d bytes, %v", n, buf.Len(), err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	whole, err := NewMmapVectorStore(tmpFile, dim)
+	if err != nil {
+		t.Fatalf("Failed to reopen without windows: %v", err)
+	}
+	defer whole.Close()
+	if whole.Count() != n {
+		t.Fatalf("Expected %d vectors after reopening, got %d", n, whole.Count())
+	}
+	if v, err := whole.Get(777); err != nil || v[0] != 777 {
+		t.Errorf("Expected vector 777 in the whole-file view, got %v", err)
+	}
+	if !bytes.Equal(buf.Bytes()[HeaderSize:], mustReadFile(t, tmpFile)[HeaderSize:HeaderSize+n*dim*4]) {
+		t.Errorf("Expected WriteTo to match the file contents")
+	}
+}
+
+func TestMmapVectorStore_Prefetch(t *testing.T) {
+	for _, growth := range []GrowthPolicy{{}, {MapWindow: 1, MapWindows: 2}} {
+		store, err := NewMmapVectorStoreWithGrowth(filepath.Join(t.TempDir(), "vectors.bin"), 128, growth)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		for i := 0; i < 1000; i++ {
+			if _, err := store.Append(make(types.Vector, 128)); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+		}
+		n, err := store.Prefetch([]uint64{999, 0, 1, 5000})
+		if err != nil {
+			t.Fatalf("Prefetch failed (window=%d): %v", growth.MapWindow, err)
+		}
+		// Three 512-byte records: two share the first page(s), 5000 is out
+		// of range.
+		if n < 3*512 || n > 4*int64(os.Getpagesize()) {
+			t.Errorf("Unexpected prefetched bytes %d (window=%d)", n, growth.MapWindow)
+		}
+		if n, err := store.Prefetch(nil); err != nil || n != 0 {
+			t.Errorf("Expected nothing to prefetch, got %d, %v", n, err)
+		}
+		store.Close()
+	}
+}
+
+func mustReadFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMmapVectorStore_ReadOnly(t *testing.T) {
+	tmpFile := "test_vectors_readonly.bin"
+	defer os.Remove(tmpFile)
+
+	writer, err := NewMmapVectorStoreWithGrowth(tmpFile, 2, GrowthPolicy{InitialCapacity: 2})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer writer.Close()
+	if _, err := writer.Append(types.Vector{1, 2}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	reader, err := OpenMmapVectorStoreReadOnly(tmpFile, 2)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer reader.Close()
+	if reader.Count() != 1 || !reader.ReadOnly() {
+		t.Fatalf("Expected a read-only store with 1 vector, got %d", reader.Count())
+	}
+	if _, err := reader.Append(types.Vector{3, 4}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+
+	// The writer grows the file past the reader's mapping.
+	for i := 0; i < 10; i++ {
+		if _, err := writer.Append(types.Vector{float32(i), 0}); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	if n, err := reader.Refresh(); err != nil || n != 11 {
+		t.Fatalf("Expected Refresh to see 11 vectors, got %d, %v", n, err)
+	}
+	if v, err := reader.Get(10); err != nil || v[0] != 9 {
+		t.Errorf("Expected the last appended vector, got %v, %v", v, err)
+	}
+
+	if _, err := OpenMmapVectorStoreReadOnly("missing_vectors.bin", 2); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestMmapVectorStore_FormatV2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bin")
+
+	// A version 1 file: 24-byte header, 3 vectors of dim 2, room for 5.
+	v1 := make([]byte, headerSizeV1+5*2*4)
+	copy(v1, fileMagicV1[:])
+	binary.LittleEndian.PutUint64(v1[8:16], 2)
+	binary.LittleEndian.PutUint64(v1[16:24], 3)
+	for i := 0; i < 3; i++ {
+		encodeVector(v1[headerSizeV1+i*8:], types.Vector{float32(i), float32(i + 10)})
+	}
+	if err := os.WriteFile(path, v1, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only stores read version 1 files as they are.
+	reader, err := OpenMmapVectorStoreReadOnly(path, 2)
+	if err != nil {
+		t.Fatalf("Failed to open a v1 file read-only: %v", err)
+	}
+	if v, err := reader.Get(2); err != nil || v[1] != 12 || reader.FileMeta().FormatVersion != 1 {
+		t.Errorf("Expected vector 2 of a v1 file, got %v, %v, %+v", v, err, reader.FileMeta())
+	}
+	_ = reader.Close()
+
+	store, err := NewMmapVectorStore(path, 2)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	meta := store.FileMeta()
+	if meta.FormatVersion != FormatVersion || meta.MigratedFrom != 1 || meta.Dim != 2 || meta.Metric != MetricL2 || meta.Codec != CodecFloat32 || meta.CreatedAt.IsZero() {
+		t.Errorf("Unexpected metadata after migration: %+v", meta)
+	}
+	if store.Count() != 3 || store.Capacity() != 5 {
+		t.Errorf("Expected 3 vectors with room for 5, got %d and %d", store.Count(), store.Capacity())
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := store.Get(uint64(i)); err != nil || v[0] != float32(i) || v[1] != float32(i+10) {
+			t.Errorf("Vector %d changed in migration: %v, %v", i, v, err)
+		}
+	}
+	if _, err := os.Stat(path + ".migrate"); !os.IsNotExist(err) {
+		t.Errorf("Expected the migration file to be gone, got %v", err)
+	}
+
+	if err := store.SetFileModel("ollama:nomic-embed-text"); err != nil {
+		t.Fatalf("SetFileModel failed: %v", err)
+	}
+	if _, err := store.Append(types.Vector{3, 13}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := CheckVectorFile(path, 2)
+	if err != nil || c.Count != 4 || c.Meta.Model != "ollama:nomic-embed-text" || c.Meta.MigratedFrom != 1 {
+		t.Fatalf("Unexpected check of the migrated file: %+v, %v", c, err)
+	}
+
+	store, err = NewMmapVectorStore(path, 2)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer store.Close()
+	if err := store.SetFileModel("openai:text-embedding-3-small"); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.FileMeta().Model; got != MixedModels {
+		t.Errorf("Expected a second model to make the file %q, got %q", MixedModels, got)
+	}
+	if v, err := store.Get(3); err != nil || v[1] != 13 {
+		t.Errorf("Expected the appended vector after reopening, got %v, %v", v, err)
+	}
+}
+
+func TestMmapVectorStore_DiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	const n = 4096
+	sparse, err := NewMmapVectorStoreWithGrowth(filepath.Join(dir, "sparse.bin"), 8, GrowthPolicy{Preallocate: n, Sparse: true})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer sparse.Close()
+	apparent, allocated, err := sparse.DiskUsage()
+	if err != nil {
+		t.Fatalf("DiskUsage failed: %v", err)
+	}
+	if apparent != HeaderSize+n*8*4 || allocated >= apparent {
+		t.Errorf("Expected a sparse file of %d bytes, got %d bytes using %d", HeaderSize+n*8*4, apparent, allocated)
+	}
+
+	dense, err := NewMmapVectorStoreWithGrowth(filepath.Join(dir, "dense.bin"), 8, GrowthPolicy{Preallocate: n})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer dense.Close()
+	apparent, _, err = dense.DiskUsage()
+	if err != nil || apparent != HeaderSize+n*8*4 {
+		t.Errorf("Expected a file of %d bytes, got %d, %v", HeaderSize+n*8*4, apparent, err)
+	}
+}
+
+func TestMmapHazard(t *testing.T) {
+	if h := MmapHazard(filepath.Join(t.TempDir(), "OneDrive - Contoso", "vox")); !strings.Contains(h, "OneDrive") {
+		t.Errorf("Expected a OneDrive folder to be flagged, got %q", h)
+	}
+	t.Setenv("OneDrive", filepath.Join(t.TempDir(), "cloud"))
+	if h := MmapHazard(filepath.Join(os.Getenv("OneDrive"), "data")); h == "" {
+		t.Errorf("Expected a folder under %%OneDrive%% to be flagged")
+	}
+}
+
+// BenchmarkMmapVectorStore_Get measures parallel reads through the state
+// snapshot against the read-locked path they replaced, with an appender
+// running alongside.
+func BenchmarkMmapVectorStore_Get(b *testing.B) {
+	tmpFile := filepath.Join(b.TempDir(), "vectors.bin")
+	store, err := NewMmapVectorStoreWithGrowth(tmpFile, 384, GrowthPolicy{InitialCapacity: 1 << 14})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.Close()
+	vec := make(types.Vector, 384)
+	for i := 0; i < 10000; i++ {
+		if _, err := store.Append(vec); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, bc := range []struct {
+		name string
+		get  func(uint64) (types.Vector, error)
+	}{
+		{"snapshot", store.Get},
+		{"rwmutex", store.getLocked},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					select {
+					case <-stop:
+						return
+					case <-time.After(50 * time.Microsecond):
+						_, _ = store.Append(vec)
+					}
+				}
+			}()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					if _, err := bc.get(uint64(r.Intn(10000))); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			close(stop)
+			<-done
+		})
+	}
+}
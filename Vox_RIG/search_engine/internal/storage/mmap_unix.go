@@ -4,23 +4,78 @@ package storage
 
 import (
 	"fmt"
+	"os"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
-func (s *MmapVectorStore) mmap(size int64) error {
-	data, err := syscall.Mmap(int(s.file.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+// mapView maps the first size bytes of f, writable unless readOnly.
+func mapView(f *os.File, size int64, readOnly bool) (view, error) {
+	prot := syscall.PROT_READ | syscall.PROT_WRITE
+	if readOnly {
+		prot = syscall.PROT_READ
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), prot, syscall.MAP_SHARED)
 	if err != nil {
-		return fmt.Errorf("mmap failed: %w", err)
+		return view{}, fmt.Errorf("mmap failed: %w", err)
+	}
+	return view{data: data}, nil
+}
+
+func unmapView(v view) error {
+	if v.data == nil {
+		return nil
+	}
+	return syscall.Munmap(v.data)
+}
+
+// extendMapped grows the file to size bytes while a view of it is mapped.
+// Views of a MAP_SHARED mapping survive the file growing under them.
+func (s *MmapVectorStore) extendMapped(size int64) error {
+	return s.extend(size)
+}
+
+// flush writes dirty pages of the mapping back to the file (msync MS_SYNC).
+func (s *MmapVectorStore) flush() error {
+	if s.mapped == nil {
+		return nil
+	}
+	if err := unix.Msync(s.mapped, unix.MS_SYNC); err != nil {
+		return fmt.Errorf("msync failed: %w", err)
 	}
-	s.mapped = data
 	return nil
 }
 
-func (s *MmapVectorStore) munmap() error {
-	if s.mapped != nil {
-		err := syscall.Munmap(s.mapped)
-		s.mapped = nil
-		return err
+// flushRange writes back the pages covering mapped[off:off+n] (msync MS_SYNC).
+func (s *MmapVectorStore) flushRange(off, n int) error {
+	start := off &^ (os.Getpagesize() - 1)
+	if err := unix.Msync(s.mapped[start:off+n], unix.MS_SYNC); err != nil {
+		return fmt.Errorf("msync failed: %w", err)
+	}
+	return nil
+}
+
+// mapWindow maps n bytes of f at off (page-aligned) read-only.
+func mapWindow(f *os.File, off int64, n int) ([]byte, uintptr, error) {
+	data, err := syscall.Mmap(int(f.Fd()), off, n, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, 0, fmt.Errorf("mmap failed: %w", err)
+	}
+	return data, 0, nil
+}
+
+func unmapWindow(data []byte, _ uintptr) error {
+	return syscall.Munmap(data)
+}
+
+// adviseWillNeed asks the kernel to read the pages of b ahead of use.
+func adviseWillNeed(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	if err := unix.Madvise(b, unix.MADV_WILLNEED); err != nil {
+		return fmt.Errorf("madvise failed: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"vox-vector-engine/internal/types"
+)
+
+// view is one mapping of the vectors file. On Windows mapHandle is the file
+// mapping object and addr the MapViewOfFile address; elsewhere only data is
+// set.
+type view struct {
+	data      []byte
+	mapHandle uintptr
+	addr      uintptr
+}
+
+// mapping is a view Get may be reading without a lock. readers counts the
+// Gets inside it; once retired (no longer the store's mapping) it is
+// unmapped as soon as readers drops to zero.
+type mapping struct {
+	view
+	readers atomic.Int64
+	retired atomic.Bool
+}
+
+func (s *MmapVectorStore) mmap(size int64) error {
+	v, err := mapView(s.file, size, s.readOnly)
+	if err != nil {
+		return err
+	}
+	s.setView(v)
+	return nil
+}
+
+// munmap unmaps the current view at once; only for views no Get can have
+// seen (see swapView and Close for those).
+func (s *MmapVectorStore) munmap() error {
+	v := view{data: s.mapped, mapHandle: s.mapHandle, addr: s.viewHandle}
+	s.setView(view{})
+	return unmapView(v)
+}
+
+// setView makes v the store's mapping, with no reader yet.
+func (s *MmapVectorStore) setView(v view) {
+	s.mapped, s.mapHandle, s.viewHandle = v.data, v.mapHandle, v.addr
+	s.cur = nil
+	if v.data != nil {
+		s.cur = &mapping{view: v}
+	}
+}
+
+// extend grows the unmapped file to size bytes as the growth policy says.
+func (s *MmapVectorStore) extend(size int64) error {
+	if s.growth.Sparse {
+		return s.file.Truncate(size)
+	}
+	return allocate(s.file, size)
+}
+
+// mapState is an immutable snapshot of what Get needs, swapped atomically
+// whenever the count or the mapping changes so reads take no lock. Get pins
+// m while it copies out of mapped, which keeps the view mapped even if a
+// swap retires it meanwhile.
+type mapState struct {
+	m      *mapping
+	mapped []byte
+	count  uint64
+	dim    int
+	offset int64
+}
+
+// publishState makes the current mapping and count visible to Get and
+// Count. s.mu must be held for writing, or the store not yet shared.
+// Windowed stores leave mapped nil, which sends Get down the locked path.
+func (s *MmapVectorStore) publishState() {
+	s.state.Store(&mapState{m: s.cur, mapped: s.mapped, count: s.count, dim: s.dim, offset: s.offset})
+}
+
+// swapView makes next the store's mapping and retires the old one, which
+// lock-free readers may still be copying out of. s.mu must be held for
+// writing.
+func (s *MmapVectorStore) swapView(next view) {
+	old := s.cur
+	s.setView(next)
+	s.epoch.Add(1)
+	s.publishState()
+	if old != nil {
+		s.retire(old)
+	}
+}
+
+// retire queues m to be unmapped once no Get is reading it. The state
+// that pointed at m must already have been replaced.
+func (s *MmapVectorStore) retire(m *mapping) {
+	m.retired.Store(true)
+	s.rmu.Lock()
+	s.retired = append(s.retired, m)
+	s.rmu.Unlock()
+	s.reclaim()
+}
+
+// reclaim unmaps the retired views that no Get is reading. A Get that pins
+// one after this check sees it retired and backs off without reading it.
+func (s *MmapVectorStore) reclaim() {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	kept := s.retired[:0]
+	for _, m := range s.retired {
+		if m.readers.Load() > 0 {
+			kept = append(kept, m)
+			continue
+		}
+		_ = unmapView(m.view)
+	}
+	clear(s.retired[len(kept):])
+	s.retired = kept
+}
+
+// pin marks a Get as reading m and reports whether m is still current;
+// either way the caller must unpin it.
+func (m *mapping) pin() bool {
+	m.readers.Add(1)
+	return !m.retired.Load()
+}
+
+// unpin ends a Get's read of m, unmapping m if it was the last reader of a
+// retired view.
+func (s *MmapVectorStore) unpin(m *mapping) {
+	if m.readers.Add(-1) == 0 && m.retired.Load() {
+		s.reclaim()
+	}
+}
+
+// retiredBytes is the size of the retired views still mapped.
+func (s *MmapVectorStore) retiredBytes() int64 {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	var n int64
+	for _, m := range s.retired {
+		n += int64(len(m.data))
+	}
+	return n
+}
+
+// get reads vector index out of st without locking.
+func (st *mapState) get(index uint64) (types.Vector, error) {
+	if index >= st.count {
+		return nil, fmt.Errorf("index out of bounds: %d >= %d", index, st.count)
+	}
+	data := st.mapped[int(st.offset)+int(index)*st.dim*vectorSize:]
+	vec := make(types.Vector, st.dim)
+	for i := range vec {
+		bits := binary.LittleEndian.Uint32(data[i*4:])
+		vec[i] = *(*float32)(unsafe.Pointer(&bits))
+	}
+	return vec, nil
+}
+
+// grow extends the file to newSize bytes and maps it again. The new view is
+// mapped next to the old one, which keeps serving reads until they are
+// swapped under a brief write lock, so a Get never waits on the map calls
+// or finds the store unmapped; each swap advances MapEpoch. s.wmu must be
+// held and s.mu not.
+func (s *MmapVectorStore) grow(newSize int64) error {
+	if s.win != nil {
+		// Windowed stores never map the whole file; their windows are
+		// remapped on demand.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.resize(newSize); err != nil {
+			return fmt.Errorf("resize failed: %w", err)
+		}
+		if err := s.remap(); err != nil {
+			return fmt.Errorf("remap failed: %w", err)
+		}
+		s.epoch.Add(1)
+		s.publishState()
+		return nil
+	}
+
+	if err := s.extendMapped(newSize); err != nil {
+		return fmt.Errorf("resize failed: %w", err)
+	}
+	next, err := mapView(s.file, newSize, false)
+	if err != nil {
+		return fmt.Errorf("remap failed: %w", err)
+	}
+	s.mu.Lock()
+	s.swapView(next)
+	s.mu.Unlock()
+	return nil
+}
+
+// remapGrown maps a read-only store's file again after the writer grew it.
+// s.mu must be held for writing.
+func (s *MmapVectorStore) remapGrown() error {
+	if s.win != nil {
+		return s.remap()
+	}
+	fi, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	next, err := mapView(s.file, fi.Size(), s.readOnly)
+	if err != nil {
+		return err
+	}
+	s.swapView(next)
+	return nil
+}
+
+// MapEpoch counts the times the file has grown and been mapped again.
+func (s *MmapVectorStore) MapEpoch() uint64 {
+	return s.epoch.Load()
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// windowAlign is the granularity of window offsets. Windows maps views at
+// multiples of its 64 KiB allocation granularity, which is also a multiple
+// of every page size.
+const windowAlign = 64 << 10
+
+// DefaultMapWindows is how many windows stay mapped when
+// GrowthPolicy.MapWindows is 0.
+const DefaultMapWindows = 16
+
+// windowMap maps a vectors file in fixed-size read-only windows on demand
+// and unmaps the least recently used one past max, so the address space a
+// store needs is bounded by span*max however large the file grows. Writes
+// go through the file (pwrite), which shares the page cache with the views.
+type windowMap struct {
+	mu   sync.Mutex
+	file *os.File
+	// span is the file range each window starts in; every window also maps
+	// extra bytes past it, so a record that starts inside it is never split.
+	span  int64
+	extra int64
+	max   int
+
+	byIndex map[int64]*window
+	lru     *list.List // of *window, most recently used first
+}
+
+type window struct {
+	index  int64
+	data   []byte
+	handle uintptr // view address on Windows
+	elem   *list.Element
+}
+
+func newWindowMap(f *os.File, span int64, recordSize, max int) *windowMap {
+	span = (span + windowAlign - 1) / windowAlign * windowAlign
+	return &windowMap{
+		file:    f,
+		span:    span,
+		extra:   int64(recordSize),
+		max:     max,
+		byIndex: map[int64]*window{},
+		lru:     list.New(),
+	}
+}
+
+// read copies len(dst) bytes at off into dst. fileSize bounds the mapping:
+// a window is never mapped past the end of the file, and one mapped before
+// the file grew is remapped when a record falls beyond its end.
+func (m *windowMap) read(off int64, dst []byte, fileSize int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := off / m.span
+	start := k * m.span
+	end := off + int64(len(dst))
+	w := m.byIndex[k]
+	if w != nil && end > start+int64(len(w.data)) {
+		m.drop(w)
+		w = nil
+	}
+	if w == nil {
+		n := min(m.span+m.extra, fileSize-start)
+		if end > start+n {
+			return fmt.Errorf("read of [%d, %d) is past the end of the file (%d bytes)", off, end, fileSize)
+		}
+		data, handle, err := mapWindow(m.file, start, int(n))
+		if err != nil {
+			return fmt.Errorf("map window at %d: %w", start, err)
+		}
+		w = &window{index: k, data: data, handle: handle}
+		w.elem = m.lru.PushFront(w)
+		m.byIndex[k] = w
+		for m.lru.Len() > m.max {
+			m.drop(m.lru.Back().Value.(*window))
+		}
+	} else {
+		m.lru.MoveToFront(w.elem)
+	}
+	copy(dst, w.data[off-start:])
+	return nil
+}
+
+// mapped returns how many bytes the open windows map.
+func (m *windowMap) mapped() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, w := range m.byIndex {
+		n += int64(len(w.data))
+	}
+	return n
+}
+
+func (m *windowMap) drop(w *window) {
+	_ = unmapWindow(w.data, w.handle)
+	m.lru.Remove(w.elem)
+	delete(m.byIndex, w.index)
+}
+
+// close unmaps every window.
+func (m *windowMap) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, w := range m.byIndex {
+		m.drop(w)
+	}
+}
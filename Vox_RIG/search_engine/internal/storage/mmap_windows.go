@@ -1,63 +1,131 @@
-
 //go:build windows
 
 package storage
 
 import (
 	"fmt"
+	"os"
+	"sync/atomic"
 	"syscall"
 	"unsafe"
 )
 
-func (s *MmapVectorStore) mmap(size int64) error {
+// mapView maps the first size bytes of f, writable unless readOnly.
+func mapView(f *os.File, size int64, readOnly bool) (view, error) {
 	// Map the full current file length. On Windows, passing a mapping length of 0
 	// maps the entire *mapping object*, which was previously created with max size 0
 	// (current file size at that moment). After file growth, that results in a view
 	// that may not cover the new bytes and causes append writes to fail.
 	//
 	// Therefore we always create the mapping with the explicit file length (size),
-	// and map exactly that many bytes.
+	// and map exactly that many bytes. A writable mapping larger than the file
+	// extends the file to its size.
 	if size <= 0 {
-		return fmt.Errorf("invalid mmap size: %d", size)
+		return view{}, fmt.Errorf("invalid mmap size: %d", size)
 	}
 
 	hi := uint32(uint64(size) >> 32)
 	lo := uint32(uint64(size) & 0xffffffff)
 
+	protect, access := uint32(syscall.PAGE_READWRITE), uint32(syscall.FILE_MAP_WRITE)
+	if readOnly {
+		protect, access = syscall.PAGE_READONLY, syscall.FILE_MAP_READ
+	}
 	h, err := syscall.CreateFileMapping(
-		syscall.Handle(s.file.Fd()),
+		syscall.Handle(f.Fd()),
 		nil,
-		syscall.PAGE_READWRITE,
+		protect,
 		hi,
 		lo,
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("CreateFileMapping failed: %w", err)
+		return view{}, fmt.Errorf("CreateFileMapping failed: %w", err)
 	}
-	s.mapHandle = uintptr(h)
 
-	addr, err := syscall.MapViewOfFile(h, syscall.FILE_MAP_WRITE, 0, 0, uintptr(size))
+	addr, err := syscall.MapViewOfFile(h, access, 0, 0, uintptr(size))
 	if err != nil {
 		syscall.CloseHandle(h)
-		s.mapHandle = 0
-		return fmt.Errorf("MapViewOfFile failed: %w", err)
+		return view{}, fmt.Errorf("MapViewOfFile failed: %w", err)
+	}
+	return view{data: unsafe.Slice((*byte)(unsafe.Pointer(addr)), int(size)), mapHandle: uintptr(h), addr: addr}, nil
+}
+
+func unmapView(v view) error {
+	if v.addr != 0 {
+		_ = syscall.UnmapViewOfFile(v.addr)
+	}
+	if v.mapHandle != 0 {
+		_ = syscall.CloseHandle(syscall.Handle(v.mapHandle))
+	}
+	return nil
+}
+
+// extendMapped grows the file to size bytes while a view of it is mapped.
+// SetEndOfFile is not to be called on a file with mapped views, so only
+// the clusters are reserved here; mapping the new view (a writable mapping
+// object larger than the file) extends the file itself.
+func (s *MmapVectorStore) extendMapped(size int64) error {
+	if !s.growth.Sparse {
+		reserveClusters(s.file, size)
 	}
+	return nil
+}
 
-	s.viewHandle = addr
-	s.mapped = unsafe.Slice((*byte)(unsafe.Pointer(addr)), int(size))
+// flush writes dirty pages of the view back to the file. FlushViewOfFile only
+// queues the writes; FlushFileBuffers (via Sync in the caller) makes them durable.
+func (s *MmapVectorStore) flush() error {
+	if s.viewHandle == 0 {
+		return nil
+	}
+	if err := syscall.FlushViewOfFile(s.viewHandle, uintptr(len(s.mapped))); err != nil {
+		return fmt.Errorf("FlushViewOfFile failed: %w", err)
+	}
 	return nil
 }
 
-func (s *MmapVectorStore) munmap() error {
-	if s.viewHandle != 0 {
-		_ = syscall.UnmapViewOfFile(s.viewHandle)
-		s.viewHandle = 0
+// flushRange writes back the pages covering mapped[off:off+n]. The writes are
+// queued in order; Sync makes them durable.
+func (s *MmapVectorStore) flushRange(off, n int) error {
+	if s.viewHandle == 0 {
+		return nil
 	}
-	if s.mapHandle != 0 {
-		_ = syscall.CloseHandle(syscall.Handle(s.mapHandle))
-		s.mapHandle = 0
+	if err := syscall.FlushViewOfFile(s.viewHandle+uintptr(off), uintptr(n)); err != nil {
+		return fmt.Errorf("FlushViewOfFile failed: %w", err)
+	}
+	return nil
+}
+
+// mapWindow maps n bytes of f at off (a multiple of the allocation
+// granularity) read-only. The view keeps the mapping object alive, so its
+// handle is closed straight away.
+func mapWindow(f *os.File, off int64, n int) ([]byte, uintptr, error) {
+	h, err := syscall.CreateFileMapping(syscall.Handle(f.Fd()), nil, syscall.PAGE_READONLY, 0, 0, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("CreateFileMapping failed: %w", err)
+	}
+	addr, err := syscall.MapViewOfFile(h, syscall.FILE_MAP_READ, uint32(uint64(off)>>32), uint32(uint64(off)&0xffffffff), uintptr(n))
+	_ = syscall.CloseHandle(h)
+	if err != nil {
+		return nil, 0, fmt.Errorf("MapViewOfFile failed: %w", err)
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(addr)), n), addr, nil
+}
+
+func unmapWindow(_ []byte, addr uintptr) error {
+	return syscall.UnmapViewOfFile(addr)
+}
+
+// touched keeps the reads in adviseWillNeed from being optimized away.
+var touched atomic.Uint32
+
+// adviseWillNeed faults in the pages of b by reading a byte of each.
+func adviseWillNeed(b []byte) error {
+	page := os.Getpagesize()
+	var sum byte
+	for i := 0; i < len(b); i += page {
+		sum += b[i]
 	}
-	s.mapped = nil
+	touched.Add(uint32(sum))
 	return nil
 }
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// syncedFolders are path components of folders that sync clients (OneDrive,
+// Dropbox, Google Drive, iCloud) upload, lock and may replace with
+// placeholders behind the process's back.
+var syncedFolders = []string{"onedrive", "dropbox", "google drive", "googledrive", "icloud drive", "icloud~", "mobile documents", "cloudstorage"}
+
+// MmapHazard describes why memory-mapping files under dir is unsafe, or
+// returns "" when nothing suggests it is. Network filesystems (NFS, SMB,
+// 9p, FUSE mounts) do not keep shared mappings coherent and can fail a
+// page fault with SIGBUS when the server goes away, and synced folders
+// rewrite files under the mapping. It is a heuristic: it inspects the
+// filesystem type where the OS reports one, and the path otherwise.
+func MmapHazard(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	if h := filesystemHazard(abs); h != "" {
+		return h
+	}
+	for _, env := range []string{"OneDrive", "OneDriveConsumer", "OneDriveCommercial"} {
+		if root := os.Getenv(env); root != "" && within(abs, root) {
+			return "it is inside the OneDrive folder " + root + ", which syncs and may offload files while they are mapped"
+		}
+	}
+	for _, part := range strings.Split(filepath.ToSlash(abs), "/") {
+		lower := strings.ToLower(part)
+		for _, synced := range syncedFolders {
+			if strings.HasPrefix(lower, synced) {
+				return "it looks like a cloud-synced folder (" + part + "), whose client may lock, rewrite or offload files while they are mapped"
+			}
+		}
+	}
+	return ""
+}
+
+// within reports whether path is root or below it.
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
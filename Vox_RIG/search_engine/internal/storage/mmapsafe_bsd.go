@@ -0,0 +1,27 @@
+//go:build darwin || freebsd
+
+package storage
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// networkFilesystems are the statfs type names of filesystems on which
+// shared mappings are not safe.
+var networkFilesystems = []string{"nfs", "smbfs", "afpfs", "webdav", "cifs", "macfuse", "osxfuse", "fusefs"}
+
+func filesystemHazard(dir string) string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	name := unix.ByteSliceToString(st.Fstypename[:])
+	for _, fs := range networkFilesystems {
+		if strings.HasPrefix(name, fs) {
+			return "it is on a " + name + " filesystem, where memory-mapped files are not kept coherent and reads can crash the process if the connection drops"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package storage
+
+import "golang.org/x/sys/unix"
+
+// networkFilesystems are the statfs types of filesystems on which shared
+// mappings are not safe.
+var networkFilesystems = map[uint32]string{
+	unix.NFS_SUPER_MAGIC:  "NFS",
+	unix.SMB_SUPER_MAGIC:  "SMB",
+	0xFF534D42:            "CIFS",
+	0xFE534D42:            "SMB2",
+	unix.V9FS_MAGIC:       "9p (e.g. a Windows drive in WSL)",
+	unix.FUSE_SUPER_MAGIC: "FUSE (e.g. sshfs or a sync client)",
+	0x00C36400:            "Ceph",
+	0x5346414F:            "AFS",
+}
+
+func filesystemHazard(dir string) string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	if name, ok := networkFilesystems[uint32(st.Type)]; ok {
+		return "it is on a " + name + " filesystem, where memory-mapped files are not kept coherent and reads can crash the process if the connection drops"
+	}
+	return ""
+}
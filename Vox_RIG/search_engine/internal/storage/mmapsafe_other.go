@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package storage
+
+// filesystemHazard cannot tell filesystems apart on this platform.
+func filesystemHazard(string) string {
+	return ""
+}
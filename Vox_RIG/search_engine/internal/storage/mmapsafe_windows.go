@@ -0,0 +1,30 @@
+//go:build windows
+
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// cloudAttributes mark files and folders a cloud sync client (OneDrive's
+// Files On-Demand) may turn into placeholders fetched on access.
+const cloudAttributes = windows.FILE_ATTRIBUTE_RECALL_ON_OPEN | windows.FILE_ATTRIBUTE_RECALL_ON_DATA_ACCESS | 0x00080000 /* PINNED */ | 0x00100000 /* UNPINNED */
+
+func filesystemHazard(dir string) string {
+	if strings.HasPrefix(dir, `\\`) {
+		return "it is on a network share (" + dir + "), where mapped views are not kept coherent and reads fail if the connection drops"
+	}
+	root := filepath.VolumeName(dir) + `\`
+	if p, err := windows.UTF16PtrFromString(root); err == nil && windows.GetDriveType(p) == windows.DRIVE_REMOTE {
+		return "it is on the network drive " + root + ", where mapped views are not kept coherent and reads fail if the connection drops"
+	}
+	if p, err := windows.UTF16PtrFromString(dir); err == nil {
+		if attrs, err := windows.GetFileAttributes(p); err == nil && attrs&cloudAttributes != 0 {
+			return "it is managed by a cloud sync client (OneDrive Files On-Demand), which may offload files while they are mapped"
+		}
+	}
+	return ""
+}
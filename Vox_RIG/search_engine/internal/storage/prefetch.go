@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"os"
+	"sort"
+)
+
+// Prefetcher is implemented by vector stores that can have the OS read the
+// pages holding some vectors ahead of use (see POST /warm).
+type Prefetcher interface {
+	// Prefetch hints that the vectors with these IDs will be read soon and
+	// returns how many bytes of the file the hint covered. IDs out of range
+	// are ignored.
+	Prefetch(ids []uint64) (int64, error)
+}
+
+var (
+	_ Prefetcher = (*MmapVectorStore)(nil)
+	_ Prefetcher = (*SegmentedVectorStore)(nil)
+)
+
+// Prefetch advises the kernel to read the pages holding ids (MADV_WILLNEED;
+// on Windows they are touched). With GrowthPolicy.MapWindow the records are
+// read instead, which also maps their windows.
+func (s *MmapVectorStore) Prefetch(ids []uint64) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page := int64(os.Getpagesize())
+	rec := int64(s.dim * vectorSize)
+	sorted := append([]uint64(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// Coalesce the page-aligned ranges of the records.
+	var ranges [][2]int64
+	for _, id := range sorted {
+		if id >= s.count {
+			break
+		}
+		off := s.offset + int64(id)*rec
+		start, end := off&^(page-1), (off+rec+page-1)&^(page-1)
+		if n := len(ranges); n > 0 && start <= ranges[n-1][1] {
+			ranges[n-1][1] = max(ranges[n-1][1], end)
+			continue
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+
+	var total int64
+	if s.win != nil {
+		buf := make([]byte, rec)
+		for _, id := range sorted {
+			if id >= s.count {
+				break
+			}
+			if err := s.win.read(s.offset+int64(id)*rec, buf, s.fileSize); err != nil {
+				return total, err
+			}
+			total += rec
+		}
+		return total, nil
+	}
+	for _, r := range ranges {
+		end := min(r[1], int64(len(s.mapped)))
+		if err := adviseWillNeed(s.mapped[r[0]:end]); err != nil {
+			return total, err
+		}
+		total += end - r[0]
+	}
+	return total, nil
+}
+
+// Prefetch prefetches ids in the segments holding them; unavailable
+// segments are skipped.
+func (s *SegmentedVectorStore) Prefetch(ids []uint64) (int64, error) {
+	s.mu.RLock()
+	bySegment := map[uint64][]uint64{}
+	for _, id := range ids {
+		if i := id / s.perSegment; i < uint64(len(s.segs)) && s.segs[i].err == nil {
+			bySegment[i] = append(bySegment[i], id%s.perSegment)
+		}
+	}
+	segs := s.segs
+	s.mu.RUnlock()
+
+	var total int64
+	for i, local := range bySegment {
+		n, err := segs[i].vecs.Prefetch(local)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,539 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"vox-vector-engine/internal/types"
+)
+
+const (
+	// VectorsFile is the single vectors file of a data directory, and
+	// SegmentsDir the segment directory used instead with -segment_vectors.
+	VectorsFile = "vectors.bin"
+	SegmentsDir = "vectors"
+	// SegmentManifestFile records the layout of a segment directory.
+	SegmentManifestFile = "segments.json"
+)
+
+// ErrSegmentUnavailable is wrapped by Get for a vector whose segment file is
+// missing or failed to open.
+var ErrSegmentUnavailable = errors.New("vector segment unavailable")
+
+// segmentManifest is the on-disk form of SegmentManifestFile. SegmentVectors
+// fixes the ID layout, so it can never change for a directory.
+type segmentManifest struct {
+	Dim            int    `json:"dim"`
+	SegmentVectors uint64 `json:"segment_vectors"`
+}
+
+// SegmentedVectorStore keeps vectors in a directory of segment files,
+// vectors.000.bin, vectors.001.bin, ..., each an MmapVectorStore holding at
+// most SegmentVectors vectors. Global IDs are segment*SegmentVectors+offset,
+// so they stay stable while segments are backed up, compacted or replaced
+// one at a time. A segment that fails to open is kept as unavailable: Get
+// fails for its IDs and the other segments keep serving.
+type SegmentedVectorStore struct {
+	dir        string
+	dim        int
+	perSegment uint64
+	growth     GrowthPolicy
+	readOnly   bool
+
+	mu     sync.RWMutex
+	policy FlushPolicy
+	segs   []*segment
+}
+
+type segment struct {
+	path string
+	vecs *MmapVectorStore
+	err  error
+}
+
+// SegmentInfo describes one segment of a SegmentedVectorStore.
+type SegmentInfo struct {
+	Index int
+	Path  string
+	// FirstID is the global ID of the segment's first vector.
+	FirstID uint64
+	Count   uint64
+	// Err is set for a segment that could not be opened.
+	Err error
+}
+
+// SegmentFileName returns the name of segment i.
+func SegmentFileName(i int) string {
+	return fmt.Sprintf("vectors.%03d.bin", i)
+}
+
+// parseSegmentFileName is the inverse of SegmentFileName.
+func parseSegmentFileName(name string) (int, bool) {
+	rest, ok := strings.CutPrefix(name, "vectors.")
+	if !ok {
+		return 0, false
+	}
+	num, ok := strings.CutSuffix(rest, ".bin")
+	if !ok || len(num) < 3 {
+		return 0, false
+	}
+	i, err := strconv.Atoi(num)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
+
+// NewSegmentedVectorStore opens (or creates) the segment directory dir.
+// perSegment is the number of vectors per segment for a new directory; an
+// existing one keeps the value it was created with, and a different non-zero
+// perSegment is an error. growth applies to each segment file.
+func NewSegmentedVectorStore(dir string, dim int, perSegment uint64, growth GrowthPolicy) (*SegmentedVectorStore, error) {
+	if err := growth.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m, err := readSegmentManifest(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if perSegment == 0 {
+			return nil, fmt.Errorf("segment directory %s: segment size must be positive", dir)
+		}
+		m = segmentManifest{Dim: dim, SegmentVectors: perSegment}
+		if err := writeSegmentManifest(dir, m); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+	if err := m.check(dir, dim, perSegment); err != nil {
+		return nil, err
+	}
+
+	s := &SegmentedVectorStore{dir: dir, dim: dim, perSegment: m.SegmentVectors, growth: growth}
+	if err := s.openSegments(); err != nil {
+		return nil, err
+	}
+	if len(s.segs) == 0 {
+		if err := s.addSegmentLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// OpenSegmentedVectorStoreReadOnly opens an existing segment directory
+// without write access; Refresh picks up vectors and segments the writer
+// has added since.
+func OpenSegmentedVectorStoreReadOnly(dir string, dim int) (*SegmentedVectorStore, error) {
+	m, err := readSegmentManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.check(dir, dim, 0); err != nil {
+		return nil, err
+	}
+	s := &SegmentedVectorStore{dir: dir, dim: dim, perSegment: m.SegmentVectors, readOnly: true}
+	if err := s.openSegments(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenVectorFiles opens the vectors of dataDir. A directory that already
+// has a segment directory keeps using it; otherwise segmentVectors > 0 starts
+// one and 0 uses the single vectors.bin. A vectors.bin that already holds
+// vectors is never switched over, since segmenting it would need a migration.
+func OpenVectorFiles(dataDir string, dim int, segmentVectors uint64, growth GrowthPolicy, readOnly bool) (FileVectorStore, error) {
+	segDir := filepath.Join(dataDir, SegmentsDir)
+	_, err := os.Stat(filepath.Join(segDir, SegmentManifestFile))
+	segmented := err == nil
+	if !segmented && segmentVectors > 0 {
+		if n, err := vectorsFileCount(filepath.Join(dataDir, VectorsFile)); err == nil && n > 0 {
+			return nil, fmt.Errorf("%s already holds %d vectors in %s; segment directories can only be started in an empty data directory", dataDir, n, VectorsFile)
+		}
+		segmented = true
+	}
+
+	var store FileVectorStore
+	switch {
+	case segmented && readOnly:
+		store, err = OpenSegmentedVectorStoreReadOnly(segDir, dim)
+	case segmented:
+		store, err = NewSegmentedVectorStore(segDir, dim, segmentVectors, growth)
+	case readOnly:
+		store, err = OpenMmapVectorStoreReadOnly(filepath.Join(dataDir, VectorsFile), dim)
+	default:
+		store, err = NewMmapVectorStoreWithGrowth(filepath.Join(dataDir, VectorsFile), dim, growth)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// vectorsFileCount reads the vector count from the header of a vectors file.
+func vectorsFileCount(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h, err := readHeader(f)
+	return h.count, err
+}
+
+func (m segmentManifest) check(dir string, dim int, perSegment uint64) error {
+	if m.Dim != dim {
+		return fmt.Errorf("segment directory %s has dim=%d, requested dim=%d", dir, m.Dim, dim)
+	}
+	if m.SegmentVectors == 0 {
+		return fmt.Errorf("segment directory %s: invalid %s (segment_vectors=0)", dir, SegmentManifestFile)
+	}
+	if perSegment != 0 && perSegment != m.SegmentVectors {
+		return fmt.Errorf("segment directory %s holds %d vectors per segment, requested %d (the size cannot change once vectors have IDs)", dir, m.SegmentVectors, perSegment)
+	}
+	return nil
+}
+
+func readSegmentManifest(dir string) (segmentManifest, error) {
+	var m segmentManifest
+	data, err := os.ReadFile(filepath.Join(dir, SegmentManifestFile))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("invalid %s in %s: %w", SegmentManifestFile, dir, err)
+	}
+	return m, nil
+}
+
+func writeSegmentManifest(dir string, m segmentManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, SegmentManifestFile), data, 0o644)
+}
+
+// openSegments opens every segment file in the directory. Numbering gaps
+// become unavailable segments, so the IDs after them keep their places.
+func (s *SegmentedVectorStore) openSegments() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, e := range entries {
+		if i, ok := parseSegmentFileName(e.Name()); ok && !e.IsDir() && i+1 > n {
+			n = i + 1
+		}
+	}
+	for i := 0; i < n; i++ {
+		s.segs = append(s.segs, s.openSegment(i))
+	}
+	return nil
+}
+
+func (s *SegmentedVectorStore) openSegment(i int) *segment {
+	seg := &segment{path: filepath.Join(s.dir, SegmentFileName(i))}
+	if _, err := os.Stat(seg.path); err != nil {
+		seg.err = err
+		return seg
+	}
+	if s.readOnly {
+		seg.vecs, seg.err = OpenMmapVectorStoreReadOnly(seg.path, s.dim)
+	} else {
+		seg.vecs, seg.err = NewMmapVectorStoreWithGrowth(seg.path, s.dim, s.growth)
+	}
+	if seg.err == nil && seg.vecs.Count() > s.perSegment {
+		seg.err = fmt.Errorf("holds %d vectors, more than the segment size %d", seg.vecs.Count(), s.perSegment)
+		_ = seg.vecs.Close()
+		seg.vecs = nil
+	}
+	if seg.vecs != nil {
+		seg.vecs.SetFlushPolicy(s.policy)
+	}
+	return seg
+}
+
+// addSegmentLocked creates the next segment file and makes it the one
+// appended to.
+func (s *SegmentedVectorStore) addSegmentLocked() error {
+	seg := s.openSegment(len(s.segs))
+	if errors.Is(seg.err, os.ErrNotExist) {
+		seg.vecs, seg.err = NewMmapVectorStoreWithGrowth(seg.path, s.dim, s.growth)
+		if seg.err == nil {
+			seg.vecs.SetFlushPolicy(s.policy)
+		}
+	}
+	if seg.err != nil {
+		return fmt.Errorf("create segment %s: %w", seg.path, seg.err)
+	}
+	if model := s.fileMetaLocked().Model; model != "" {
+		if err := seg.vecs.SetFileModel(model); err != nil {
+			return fmt.Errorf("create segment %s: %w", seg.path, err)
+		}
+	}
+	s.segs = append(s.segs, seg)
+	return nil
+}
+
+// Append adds vector to the last segment, starting a new one when it is
+// full. A last segment that is unavailable blocks appends, since its count
+// (and so the next ID) is unknown.
+func (s *SegmentedVectorStore) Append(vector types.Vector) (uint64, error) {
+	if s.readOnly {
+		return 0, ErrReadOnly
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.segs[len(s.segs)-1]
+	if last.err != nil {
+		return 0, fmt.Errorf("segment %s: %w: %v", last.path, ErrSegmentUnavailable, last.err)
+	}
+	if last.vecs.Count() >= s.perSegment {
+		// Publish the full segment's count before moving on from it.
+		if err := last.vecs.Sync(); err != nil {
+			return 0, err
+		}
+		if err := s.addSegmentLocked(); err != nil {
+			return 0, err
+		}
+		last = s.segs[len(s.segs)-1]
+	}
+	local, err := last.vecs.Append(vector)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(s.segs)-1)*s.perSegment + local, nil
+}
+
+// Get returns the vector with global ID id.
+func (s *SegmentedVectorStore) Get(id uint64) (types.Vector, error) {
+	s.mu.RLock()
+	i := id / s.perSegment
+	if i >= uint64(len(s.segs)) {
+		s.mu.RUnlock()
+		return nil, fmt.Errorf("index out of bounds: %d", id)
+	}
+	seg := s.segs[i]
+	s.mu.RUnlock()
+	if seg.err != nil {
+		return nil, fmt.Errorf("vector %d: %w (%s: %v)", id, ErrSegmentUnavailable, seg.path, seg.err)
+	}
+	return seg.vecs.Get(id % s.perSegment)
+}
+
+// Count returns one past the highest ID in use. Unavailable segments count
+// as full, so it only drops if the last segment is lost.
+func (s *SegmentedVectorStore) Count() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.segs) == 0 {
+		return 0
+	}
+	n := uint64(len(s.segs)-1) * s.perSegment
+	if last := s.segs[len(s.segs)-1]; last.err == nil {
+		n += last.vecs.Count()
+	}
+	return n
+}
+
+// Dim returns the vector dimension.
+func (s *SegmentedVectorStore) Dim() int {
+	return s.dim
+}
+
+// SegmentVectors returns the number of vectors per segment.
+func (s *SegmentedVectorStore) SegmentVectors() uint64 {
+	return s.perSegment
+}
+
+// Dir returns the segment directory.
+func (s *SegmentedVectorStore) Dir() string {
+	return s.dir
+}
+
+// Segments describes every segment, in ID order.
+func (s *SegmentedVectorStore) Segments() []SegmentInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]SegmentInfo, len(s.segs))
+	for i, seg := range s.segs {
+		out[i] = SegmentInfo{Index: i, Path: seg.path, FirstID: uint64(i) * s.perSegment, Err: seg.err}
+		if seg.vecs != nil {
+			out[i].Count = seg.vecs.Count()
+		}
+	}
+	return out
+}
+
+// Segment returns the store of segment i, or its open error.
+func (s *SegmentedVectorStore) Segment(i int) (*MmapVectorStore, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i < 0 || i >= len(s.segs) {
+		return nil, fmt.Errorf("no segment %d", i)
+	}
+	if seg := s.segs[i]; seg.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSegmentUnavailable, seg.err)
+	}
+	return s.segs[i].vecs, nil
+}
+
+// DiskUsage sums the DiskUsage of the available segments.
+func (s *SegmentedVectorStore) DiskUsage() (apparent, allocated int64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, seg := range s.segs {
+		if seg.vecs == nil {
+			continue
+		}
+		a, b, err := seg.vecs.DiskUsage()
+		if err != nil {
+			return apparent, allocated, err
+		}
+		apparent += a
+		allocated += b
+	}
+	return apparent, allocated, nil
+}
+
+// FileMeta returns the metadata block of the last available segment.
+func (s *SegmentedVectorStore) FileMeta() FileMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fileMetaLocked()
+}
+
+func (s *SegmentedVectorStore) fileMetaLocked() FileMeta {
+	for i := len(s.segs) - 1; i >= 0; i-- {
+		if s.segs[i].vecs != nil {
+			return s.segs[i].vecs.FileMeta()
+		}
+	}
+	return FileMeta{}
+}
+
+// SetFileModel records model in the header of every available segment,
+// including ones created later (see MmapVectorStore.SetFileModel).
+func (s *SegmentedVectorStore) SetFileModel(model string) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, seg := range s.segs {
+		if seg.vecs == nil {
+			continue
+		}
+		if err := seg.vecs.SetFileModel(model); err != nil {
+			return fmt.Errorf("segment %s: %w", seg.path, err)
+		}
+	}
+	return nil
+}
+
+// SetFlushPolicy applies p to every segment, including ones created later.
+func (s *SegmentedVectorStore) SetFlushPolicy(p FlushPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+	for _, seg := range s.segs {
+		if seg.vecs != nil {
+			seg.vecs.SetFlushPolicy(p)
+		}
+	}
+}
+
+// FlushPolicy returns the policy set by SetFlushPolicy.
+func (s *SegmentedVectorStore) FlushPolicy() FlushPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// GrowthPolicy returns the policy each segment file is sized by.
+func (s *SegmentedVectorStore) GrowthPolicy() GrowthPolicy {
+	return s.growth
+}
+
+// ReadOnly reports whether the store was opened read-only.
+func (s *SegmentedVectorStore) ReadOnly() bool {
+	return s.readOnly
+}
+
+// Refresh re-reads the segments the writer may still be appending to and
+// opens the ones it has started since, returning the new Count. Only
+// read-only stores need it.
+func (s *SegmentedVectorStore) Refresh() (uint64, error) {
+	s.mu.Lock()
+	from := max(len(s.segs)-1, 0)
+	for {
+		path := filepath.Join(s.dir, SegmentFileName(len(s.segs)))
+		if _, err := os.Stat(path); err != nil {
+			break
+		}
+		s.segs = append(s.segs, &segment{path: path, err: os.ErrNotExist})
+	}
+	for i := from; i < len(s.segs); i++ {
+		seg := s.segs[i]
+		if seg.vecs == nil {
+			// Not opened yet, or caught before the writer finished its header.
+			s.segs[i] = s.openSegment(i)
+			continue
+		}
+		if _, err := seg.vecs.Refresh(); err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+	}
+	s.mu.Unlock()
+	return s.Count(), nil
+}
+
+// Sync flushes every segment.
+func (s *SegmentedVectorStore) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var first error
+	for _, seg := range s.segs {
+		if seg.vecs == nil {
+			continue
+		}
+		if err := seg.vecs.Sync(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close flushes and closes every segment.
+func (s *SegmentedVectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	for _, seg := range s.segs {
+		if seg.vecs == nil {
+			continue
+		}
+		if err := seg.vecs.Close(); err != nil && first == nil {
+			first = err
+		}
+		seg.vecs = nil
+		if seg.err == nil {
+			seg.err = errors.New("store closed")
+		}
+	}
+	return first
+}
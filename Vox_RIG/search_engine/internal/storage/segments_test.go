@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/types"
+)
+
+func TestSegmentedVectorStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewSegmentedVectorStore(dir, 2, 3, GrowthPolicy{})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		id, err := store.Append(types.Vector{float32(i), 1})
+		if err != nil || id != uint64(i) {
+			t.Fatalf("Expected ID %d, got %d, %v", i, id, err)
+		}
+	}
+	if n := len(store.Segments()); n != 3 {
+		t.Fatalf("Expected 8 vectors in 3 segments of 3, got %d segments", n)
+	}
+	if v, err := store.Get(7); err != nil || v[0] != 7 {
+		t.Fatalf("Expected vector 7 from the third segment, got %v, %v", v, err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewSegmentedVectorStore(dir, 2, 4, GrowthPolicy{}); err == nil {
+		t.Fatalf("Expected a different segment size to be rejected")
+	}
+
+	// Break the middle segment: the others keep serving and IDs stay put.
+	if err := os.WriteFile(filepath.Join(dir, SegmentFileName(1)), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewSegmentedVectorStore(dir, 2, 0, GrowthPolicy{})
+	if err != nil {
+		t.Fatalf("Failed to reopen with a corrupt segment: %v", err)
+	}
+	defer store.Close()
+	if store.Count() != 8 {
+		t.Errorf("Expected count 8 with a corrupt middle segment, got %d", store.Count())
+	}
+	if _, err := store.Get(4); !errors.Is(err, ErrSegmentUnavailable) {
+		t.Errorf("Expected ErrSegmentUnavailable for a vector in the corrupt segment, got %v", err)
+	}
+	if v, err := store.Get(6); err != nil || v[0] != 6 {
+		t.Errorf("Expected vector 6 to survive, got %v, %v", v, err)
+	}
+	if id, err := store.Append(types.Vector{8, 1}); err != nil || id != 8 {
+		t.Errorf("Expected the next append to get ID 8, got %d, %v", id, err)
+	}
+
+	ro, err := OpenSegmentedVectorStoreReadOnly(dir, 2)
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer ro.Close()
+	if _, err := ro.Append(types.Vector{0, 0}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if _, err := store.Append(types.Vector{9, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ro.Refresh(); err != nil || n != 10 {
+		t.Errorf("Expected the reader to follow the writer into a new segment, got %d, %v", n, err)
+	}
+}
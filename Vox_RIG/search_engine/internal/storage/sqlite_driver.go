@@ -0,0 +1,9 @@
+//go:build sqlite
+
+package storage
+
+// The SQLite backend is opt-in so default builds do not compile the driver
+// in; go.mod pins it for tagged builds:
+//
+//	go build -tags sqlite .
+import _ "modernc.org/sqlite"
@@ -0,0 +1,1192 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vox-vector-engine/internal/types"
+)
+
+// sqliteDriver is the database/sql driver name registered by
+// modernc.org/sqlite (see sqlite_driver.go).
+const sqliteDriver = "sqlite"
+
+// sqliteSchema keeps the fields callers filter on in real columns; the rest
+// of the metadata stays JSON, so SQL such as
+//
+//	SELECT d.source, c.start_line, c.content FROM chunks c
+//	JOIN documents d ON d.id = c.doc_id WHERE d.namespace = 'proj'
+//
+// works from any SQLite shell.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS documents (
+		id              TEXT PRIMARY KEY,
+		source          TEXT NOT NULL DEFAULT '',
+		timestamp       TEXT NOT NULL DEFAULT '',
+		namespace       TEXT NOT NULL DEFAULT '',
+		conversation_id TEXT NOT NULL DEFAULT '',
+		type            TEXT NOT NULL DEFAULT '',
+		metadata        TEXT NOT NULL DEFAULT 'null'
+	)`,
+	`CREATE INDEX IF NOT EXISTS documents_namespace ON documents (namespace, type)`,
+	`CREATE INDEX IF NOT EXISTS documents_conversation ON documents (namespace, conversation_id, timestamp)`,
+	`CREATE TABLE IF NOT EXISTS chunks (
+		id          INTEGER PRIMARY KEY,
+		doc_id      TEXT NOT NULL,
+		content     TEXT NOT NULL DEFAULT '',
+		start_line  INTEGER NOT NULL DEFAULT 0,
+		end_line    INTEGER NOT NULL DEFAULT 0,
+		token_count INTEGER NOT NULL DEFAULT 0,
+		metadata    TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS chunks_doc ON chunks (doc_id)`,
+	`CREATE TABLE IF NOT EXISTS document_tags (
+		tag    TEXT NOT NULL,
+		doc_id TEXT NOT NULL,
+		PRIMARY KEY (tag, doc_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS document_tags_doc ON document_tags (doc_id)`,
+	`CREATE TABLE IF NOT EXISTS pins (
+		namespace  TEXT NOT NULL,
+		target     TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		data       TEXT NOT NULL,
+		PRIMARY KEY (namespace, target)
+	)`,
+	`CREATE TABLE IF NOT EXISTS state (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS changes (
+		seq  INTEGER PRIMARY KEY AUTOINCREMENT,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS trash (
+		doc_id     TEXT PRIMARY KEY,
+		namespace  TEXT NOT NULL,
+		deleted_at INTEGER NOT NULL,
+		data       TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS templates (
+		namespace TEXT PRIMARY KEY,
+		data      TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS access (
+		chunk_id INTEGER PRIMARY KEY,
+		count    INTEGER NOT NULL,
+		last     INTEGER NOT NULL
+	)`,
+	`CREATE VIEW IF NOT EXISTS namespaces AS
+		SELECT d.namespace AS namespace, COUNT(DISTINCT d.id) AS documents, COUNT(c.id) AS chunks
+		FROM documents d LEFT JOIN chunks c ON c.doc_id = d.id
+		GROUP BY d.namespace`,
+	`CREATE VIEW IF NOT EXISTS conversations AS
+		SELECT namespace, conversation_id, COUNT(*) AS messages,
+			MIN(timestamp) AS first_timestamp, MAX(timestamp) AS last_timestamp
+		FROM documents WHERE conversation_id != ''
+		GROUP BY namespace, conversation_id`,
+}
+
+const (
+	documentColumns = `id, source, timestamp, metadata,
+		(SELECT json_group_array(tag) FROM (SELECT tag FROM document_tags WHERE doc_id = documents.id ORDER BY tag))`
+	chunkColumns = "id, doc_id, content, start_line, end_line, token_count, metadata"
+	// sqlitePage bounds the rows ForEach* hold at once; callbacks run
+	// between pages so they may use the store themselves.
+	sqlitePage = 256
+	// sqliteTime is fixed-width UTC so timestamps sort as text.
+	sqliteTime = "2006-01-02T15:04:05.000000000Z"
+)
+
+// SQLiteMetadataStore is a MetadataStore on SQLite (-meta=sqlite).
+type SQLiteMetadataStore struct {
+	db   *sql.DB
+	path string
+	// wmu serializes write transactions; SQLite allows one writer anyway and
+	// this avoids lock-upgrade failures between deferred transactions.
+	wmu sync.Mutex
+	gen atomic.Uint64
+}
+
+// NewSQLiteMetadataStore opens (or creates) a SQLite metadata database.
+func NewSQLiteMetadataStore(path string) (*SQLiteMetadataStore, error) {
+	if !slices.Contains(sql.Drivers(), sqliteDriver) {
+		return nil, errors.New("sqlite metadata backend not compiled in; rebuild with -tags sqlite")
+	}
+	db, err := sql.Open(sqliteDriver, "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("sqlite schema: %w", err)
+		}
+	}
+	return &SQLiteMetadataStore{db: db, path: path}, nil
+}
+
+// NewSQLiteMetadataStoreReadOnly opens an existing database without write
+// access. In WAL mode it can run next to a writer in another process and
+// sees each of its commits.
+func NewSQLiteMetadataStoreReadOnly(path string) (*SQLiteMetadataStore, error) {
+	if !slices.Contains(sql.Drivers(), sqliteDriver) {
+		return nil, errors.New("sqlite metadata backend not compiled in; rebuild with -tags sqlite")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(sqliteDriver, "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)&_pragma=query_only(1)")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteMetadataStore{db: db, path: path}, nil
+}
+
+// update runs fn in a write transaction and bumps the generation.
+func (s *SQLiteMetadataStore) update(fn func(*sql.Tx) error) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	defer s.gen.Add(1)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Generation changes after every write.
+func (s *SQLiteMetadataStore) Generation() uint64 {
+	return s.gen.Load()
+}
+
+// logSQLiteChange appends c to the change log inside tx. The row is
+// inserted first so Seq comes from the AUTOINCREMENT key, which never
+// reuses a value.
+func logSQLiteChange(tx *sql.Tx, c types.Change) error {
+	res, err := tx.Exec(`INSERT INTO changes (data) VALUES ('')`)
+	if err != nil {
+		return err
+	}
+	seq, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.Seq, c.Time = uint64(seq), time.Now().UTC()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE changes SET data = ? WHERE seq = ?`, string(data), seq)
+	return err
+}
+
+// Changes returns up to limit change log entries after since, oldest first.
+func (s *SQLiteMetadataStore) Changes(since uint64, limit int) ([]types.Change, error) {
+	rows, err := s.db.Query(`SELECT data FROM changes WHERE seq > ? ORDER BY seq LIMIT ?`, sqlID(since), changesLimit(limit))
+	if err != nil {
+		if s.missingTable("changes") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	var out []types.Change
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var c types.Change
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LastChange returns the Seq of the newest change log entry.
+func (s *SQLiteMetadataStore) LastChange() (uint64, error) {
+	var seq sql.NullInt64
+	if err := s.db.QueryRow(`SELECT MAX(seq) FROM changes`).Scan(&seq); err != nil {
+		if s.missingTable("changes") {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return uint64(seq.Int64), nil
+}
+
+// missingTable reports whether the database predates table name, as one
+// opened read-only may.
+func (s *SQLiteMetadataStore) missingTable(name string) bool {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n)
+	return err == nil && n == 0
+}
+
+func (s *SQLiteMetadataStore) Close() error {
+	return s.db.Close()
+}
+
+// Path returns the database file; its write-ahead log sits next to it as
+// Path()+"-wal".
+func (s *SQLiteMetadataStore) Path() string {
+	return s.path
+}
+
+// sqlID converts a chunk ID to SQLite's signed INTEGER, saturating.
+func sqlID(id uint64) int64 {
+	if id > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(id)
+}
+
+func formatSQLiteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(sqliteTime)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDocument(r rowScanner) (types.Document, error) {
+	var doc types.Document
+	var ts, md, tags string
+	if err := r.Scan(&doc.ID, &doc.Source, &ts, &md, &tags); err != nil {
+		return doc, err
+	}
+	if tags != "[]" {
+		if err := json.Unmarshal([]byte(tags), &doc.Tags); err != nil {
+			return doc, fmt.Errorf("document %s: %w", doc.ID, err)
+		}
+	}
+	if ts != "" {
+		t, err := time.Parse(sqliteTime, ts)
+		if err != nil {
+			return doc, fmt.Errorf("document %s: %w", doc.ID, err)
+		}
+		doc.Timestamp = t
+	}
+	if err := json.Unmarshal([]byte(md), &doc.Metadata); err != nil {
+		return doc, fmt.Errorf("document %s: %w", doc.ID, err)
+	}
+	return doc, nil
+}
+
+func scanChunk(r rowScanner) (types.Chunk, error) {
+	var c types.Chunk
+	var id int64
+	var md sql.NullString
+	if err := r.Scan(&id, &c.DocID, &c.Content, &c.StartLine, &c.EndLine, &c.TokenCount, &md); err != nil {
+		return c, err
+	}
+	c.ID = uint64(id)
+	if md.Valid && md.String != "" {
+		if err := json.Unmarshal([]byte(md.String), &c.Metadata); err != nil {
+			return c, fmt.Errorf("chunk %d: %w", c.ID, err)
+		}
+	}
+	return c, nil
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func queryChunks(q querier, query string, args ...any) ([]types.Chunk, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []types.Chunk
+	for rows.Next() {
+		c, err := scanChunk(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func queryIDs(q querier, query string, args ...any) ([]uint64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []uint64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, uint64(id))
+	}
+	return out, rows.Err()
+}
+
+func putSQLiteDocument(tx *sql.Tx, doc types.Document) error {
+	md, err := json.Marshal(doc.Metadata)
+	if err != nil {
+		return err
+	}
+	ns, _ := doc.Metadata["namespace"].(string)
+	conv, _ := doc.Metadata["conversation_id"].(string)
+	typ, _ := doc.Metadata["type"].(string)
+	_, err = tx.Exec(`INSERT OR REPLACE INTO documents (id, source, timestamp, namespace, conversation_id, type, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		doc.ID, doc.Source, formatSQLiteTime(doc.Timestamp), ns, conv, typ, string(md))
+	if err != nil {
+		return err
+	}
+	return putSQLiteTags(tx, doc.ID, doc.Tags)
+}
+
+// putSQLiteTags replaces the rows of document_tags for document id.
+func putSQLiteTags(tx *sql.Tx, id string, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM document_tags WHERE doc_id = ?`, id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO document_tags (tag, doc_id) VALUES (?, ?)`, tag, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTags replaces the tags of document id.
+func (s *SQLiteMetadataStore) SetTags(id string, tags []string) error {
+	return s.update(func(tx *sql.Tx) error {
+		var ns string
+		err := tx.QueryRow(`SELECT namespace FROM documents WHERE id = ?`, id).Scan(&ns)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("document not found: %s", id)
+		}
+		if err != nil {
+			return err
+		}
+		if err := putSQLiteTags(tx, id, tags); err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, types.Change{Op: types.ChangeDocument, DocID: id, Namespace: ns})
+	})
+}
+
+// UpdateDocument applies fn to document id and saves the result in the same
+// transaction.
+func (s *SQLiteMetadataStore) UpdateDocument(id string, fn func(*types.Document) error) (*types.Document, error) {
+	var doc types.Document
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		doc, err = scanDocument(tx.QueryRow(`SELECT `+documentColumns+` FROM documents WHERE id = ?`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("document not found: %s", id)
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(&doc); err != nil {
+			return err
+		}
+		doc.ID = id
+		if err := putSQLiteDocument(tx, doc); err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, documentChange(doc, nil))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// TaggedDocuments returns the IDs of the documents tagged tag, in ID order.
+func (s *SQLiteMetadataStore) TaggedDocuments(tag string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT doc_id FROM document_tags WHERE tag = ? ORDER BY doc_id`, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CheckIndexes runs SQLite's integrity check, which covers every table and
+// index in the file.
+func (s *SQLiteMetadataStore) CheckIndexes() ([]string, error) {
+	rows, err := s.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// RebuildIndexes rebuilds every SQL index from its table.
+func (s *SQLiteMetadataStore) RebuildIndexes() error {
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`REINDEX`)
+		return err
+	})
+}
+
+func putSQLiteChunks(tx *sql.Tx, chunks []types.Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO chunks (` + chunkColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range chunks {
+		var md any
+		if len(c.Metadata) > 0 {
+			data, err := json.Marshal(c.Metadata)
+			if err != nil {
+				return err
+			}
+			md = string(data)
+		}
+		if _, err := stmt.Exec(sqlID(c.ID), c.DocID, c.Content, c.StartLine, c.EndLine, c.TokenCount, md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteMetadataStore) SaveDocument(doc types.Document) error {
+	return s.update(func(tx *sql.Tx) error {
+		if err := putSQLiteDocument(tx, doc); err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, documentChange(doc, nil))
+	})
+}
+
+func (s *SQLiteMetadataStore) GetDocument(id string) (*types.Document, error) {
+	doc, err := scanDocument(s.db.QueryRow(`SELECT `+documentColumns+` FROM documents WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("document not found: %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListDocuments returns the documents of namespace ns, in ID order.
+func (s *SQLiteMetadataStore) ListDocuments(ns string) ([]types.Document, error) {
+	rows, err := s.db.Query(`SELECT `+documentColumns+` FROM documents WHERE namespace = ? ORDER BY id`, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var docs []types.Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// SaveDocumentWithChunks stores a document and its chunks in one transaction.
+func (s *SQLiteMetadataStore) SaveDocumentWithChunks(doc types.Document, chunks []types.Chunk) error {
+	return s.update(func(tx *sql.Tx) error {
+		if err := putSQLiteDocument(tx, doc); err != nil {
+			return err
+		}
+		if err := putSQLiteChunks(tx, chunks); err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, documentChange(doc, chunks))
+	})
+}
+
+func (s *SQLiteMetadataStore) SaveChunk(chunk types.Chunk) error {
+	return s.SaveChunks([]types.Chunk{chunk})
+}
+
+// SaveChunks stores chunks in a single transaction.
+func (s *SQLiteMetadataStore) SaveChunks(chunks []types.Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	return s.update(func(tx *sql.Tx) error {
+		if err := putSQLiteChunks(tx, chunks); err != nil {
+			return err
+		}
+		var ns string
+		err := tx.QueryRow(`SELECT namespace FROM documents WHERE id = ?`, chunks[0].DocID).Scan(&ns)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return logSQLiteChange(tx, chunksChange(ns, chunks))
+	})
+}
+
+func (s *SQLiteMetadataStore) GetChunk(id uint64) (*types.Chunk, error) {
+	c, err := scanChunk(s.db.QueryRow(`SELECT `+chunkColumns+` FROM chunks WHERE id = ?`, sqlID(id)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("chunk not found: %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateChunk applies fn to chunk id and saves the result in the same
+// transaction.
+func (s *SQLiteMetadataStore) UpdateChunk(id uint64, fn func(*types.Chunk) error) (*types.Chunk, error) {
+	var c types.Chunk
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		c, err = scanChunk(tx.QueryRow(`SELECT `+chunkColumns+` FROM chunks WHERE id = ?`, sqlID(id)))
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("chunk %d: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(&c); err != nil {
+			return err
+		}
+		c.ID = id
+		if err := putSQLiteChunks(tx, []types.Chunk{c}); err != nil {
+			return err
+		}
+		var ns string
+		err = tx.QueryRow(`SELECT namespace FROM documents WHERE id = ?`, c.DocID).Scan(&ns)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return logSQLiteChange(tx, chunksChange(ns, []types.Chunk{c}))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetChunks returns the stored chunks among ids, keyed by ID; missing IDs
+// are left out.
+func (s *SQLiteMetadataStore) GetChunks(ids []uint64) (map[uint64]types.Chunk, error) {
+	out := make(map[uint64]types.Chunk, len(ids))
+	// Stay well under SQLite's bound-parameter limit.
+	for len(ids) > 0 {
+		n := min(len(ids), sqlitePage)
+		args := make([]any, n)
+		for i, id := range ids[:n] {
+			args[i] = sqlID(id)
+		}
+		ids = ids[n:]
+		placeholders := strings.Repeat("?, ", n-1) + "?"
+		chunks, err := queryChunks(s.db, `SELECT `+chunkColumns+` FROM chunks WHERE id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			out[c.ID] = c
+		}
+	}
+	return out, nil
+}
+
+// GetChunkRange returns the stored chunks with from <= ID < to, in ID order.
+func (s *SQLiteMetadataStore) GetChunkRange(from, to uint64) ([]types.Chunk, error) {
+	return queryChunks(s.db, `SELECT `+chunkColumns+` FROM chunks WHERE id >= ? AND id < ? ORDER BY id`, sqlID(from), sqlID(to))
+}
+
+// DocumentChunks returns the chunks of document id, in ID order.
+func (s *SQLiteMetadataStore) DocumentChunks(id string) ([]types.Chunk, error) {
+	return queryChunks(s.db, `SELECT `+chunkColumns+` FROM chunks WHERE doc_id = ? ORDER BY id`, id)
+}
+
+// MaxChunkID returns the highest stored chunk ID; ok is false when there are
+// no chunks.
+func (s *SQLiteMetadataStore) MaxChunkID() (uint64, bool, error) {
+	var id sql.NullInt64
+	if err := s.db.QueryRow(`SELECT MAX(id) FROM chunks`).Scan(&id); err != nil {
+		return 0, false, err
+	}
+	return uint64(id.Int64), id.Valid, nil
+}
+
+func (s *SQLiteMetadataStore) ChunkCount() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&n)
+	return n, err
+}
+
+// ForEachDocument calls fn for every stored document, in ID order.
+func (s *SQLiteMetadataStore) ForEachDocument(fn func(types.Document) error) error {
+	after, first := "", true
+	for {
+		rows, err := s.db.Query(`SELECT `+documentColumns+` FROM documents WHERE ? OR id > ? ORDER BY id LIMIT ?`, first, after, sqlitePage)
+		if err != nil {
+			return err
+		}
+		var page []types.Document
+		for rows.Next() {
+			doc, err := scanDocument(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			page = append(page, doc)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, doc := range page {
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+		if len(page) < sqlitePage {
+			return nil
+		}
+		after, first = page[len(page)-1].ID, false
+	}
+}
+
+// ForEachChunk calls fn for every stored chunk, in ID order.
+func (s *SQLiteMetadataStore) ForEachChunk(fn func(types.Chunk) error) error {
+	after := int64(-1)
+	for {
+		page, err := queryChunks(s.db, `SELECT `+chunkColumns+` FROM chunks WHERE id > ? ORDER BY id LIMIT ?`, after, sqlitePage)
+		if err != nil {
+			return err
+		}
+		for _, c := range page {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		if len(page) < sqlitePage {
+			return nil
+		}
+		after = sqlID(page[len(page)-1].ID)
+	}
+}
+
+// DeleteDocument removes a document and all chunks pointing at it, returning
+// the removed chunk IDs. Deleting a missing document is not an error.
+func (s *SQLiteMetadataStore) DeleteDocument(id string) ([]uint64, error) {
+	var chunkIDs []uint64
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		if chunkIDs, err = queryIDs(tx, `SELECT id FROM chunks WHERE doc_id = ? ORDER BY id`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM chunks WHERE doc_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM document_tags WHERE doc_id = ?`, id); err != nil {
+			return err
+		}
+		var ns string
+		err = tx.QueryRow(`DELETE FROM documents WHERE id = ? RETURNING namespace`, id).Scan(&ns)
+		if errors.Is(err, sql.ErrNoRows) && len(chunkIDs) == 0 {
+			return nil
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return logSQLiteChange(tx, types.Change{Op: types.ChangeDeleteDocument, DocID: id, Namespace: ns, ChunkIDs: chunkIDs})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunkIDs, nil
+}
+
+// DeleteNamespace removes every document of ns, its chunks and its pins in
+// one transaction, returning the removed document and chunk IDs.
+func (s *SQLiteMetadataStore) DeleteNamespace(ns string) ([]string, []uint64, error) {
+	var docIDs []string
+	var chunkIDs []uint64
+	err := s.update(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id FROM documents WHERE namespace = ?`, ns)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			docIDs = append(docIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if chunkIDs, err = queryIDs(tx, namespaceChunksQuery, ns); err != nil {
+			return err
+		}
+		for _, stmt := range []string{
+			`DELETE FROM chunks WHERE doc_id IN (SELECT id FROM documents WHERE namespace = ?)`,
+			`DELETE FROM document_tags WHERE doc_id IN (SELECT id FROM documents WHERE namespace = ?)`,
+			`DELETE FROM documents WHERE namespace = ?`,
+			`DELETE FROM pins WHERE namespace = ?`,
+			`DELETE FROM trash WHERE namespace = ?`,
+		} {
+			if _, err := tx.Exec(stmt, ns); err != nil {
+				return err
+			}
+		}
+		return logSQLiteChange(tx, types.Change{Op: types.ChangeDeleteNamespace, Namespace: ns})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return docIDs, chunkIDs, nil
+}
+
+const namespaceChunksQuery = `SELECT c.id FROM chunks c JOIN documents d ON d.id = c.doc_id WHERE d.namespace = ? ORDER BY c.id`
+
+// NamespaceChunkIDs returns the IDs of every chunk belonging to a document
+// of namespace ns.
+func (s *SQLiteMetadataStore) NamespaceChunkIDs(ns string) ([]uint64, error) {
+	return queryIDs(s.db, namespaceChunksQuery, ns)
+}
+
+// SavePin stores p, replacing an existing pin on the same target.
+func (s *SQLiteMetadataStore) SavePin(p types.Pin) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO pins (namespace, target, created_at, data) VALUES (?, ?, ?, ?)`,
+			p.Namespace, pinTarget(p), p.CreatedAt.UnixNano(), string(data))
+		if err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, pinChange(types.ChangePin, p))
+	})
+}
+
+// DeletePin removes the pin on p's target and reports whether there was one.
+func (s *SQLiteMetadataStore) DeletePin(p types.Pin) (bool, error) {
+	var found bool
+	err := s.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM pins WHERE namespace = ? AND target = ?`, p.Namespace, pinTarget(p))
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		found = true
+		return logSQLiteChange(tx, pinChange(types.ChangeUnpin, p))
+	})
+	return found, err
+}
+
+// TrashDocument moves document id and its chunks into the trash table.
+func (s *SQLiteMetadataStore) TrashDocument(id string, at time.Time) (*types.TrashedDocument, error) {
+	var t types.TrashedDocument
+	err := s.update(func(tx *sql.Tx) error {
+		doc, err := scanDocument(tx.QueryRow(`SELECT `+documentColumns+` FROM documents WHERE id = ?`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("document %s: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		chunks, err := queryChunks(tx, `SELECT `+chunkColumns+` FROM chunks WHERE doc_id = ? ORDER BY id`, id)
+		if err != nil {
+			return err
+		}
+		t = types.TrashedDocument{Document: doc, Chunks: chunks, DeletedAt: at.UTC()}
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range []string{
+			`DELETE FROM chunks WHERE doc_id = ?`,
+			`DELETE FROM document_tags WHERE doc_id = ?`,
+			`DELETE FROM documents WHERE id = ?`,
+		} {
+			if _, err := tx.Exec(stmt, id); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO trash (doc_id, namespace, deleted_at, data) VALUES (?, ?, ?, ?)`,
+			id, trashNamespace(t), t.DeletedAt.UnixNano(), string(data)); err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, types.Change{Op: types.ChangeDeleteDocument, DocID: id, Namespace: trashNamespace(t), ChunkIDs: chunkIDsOf(chunks)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// RestoreDocument moves document id and its chunks out of the trash table.
+func (s *SQLiteMetadataStore) RestoreDocument(id string) (*types.TrashedDocument, error) {
+	var t types.TrashedDocument
+	err := s.update(func(tx *sql.Tx) error {
+		var data string
+		err := tx.QueryRow(`SELECT data FROM trash WHERE doc_id = ?`, id).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("trashed document %s: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM documents WHERE id = ?`, id).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("document %s: %w", id, ErrDocumentExists)
+		}
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return err
+		}
+		if err := putSQLiteDocument(tx, t.Document); err != nil {
+			return err
+		}
+		if err := putSQLiteChunks(tx, t.Chunks); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM trash WHERE doc_id = ?`, id); err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, documentChange(t.Document, t.Chunks))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTrash returns the trashed documents of namespace ns, oldest first.
+func (s *SQLiteMetadataStore) ListTrash(ns string) ([]types.TrashedDocument, error) {
+	rows, err := s.db.Query(`SELECT data FROM trash WHERE namespace = ? ORDER BY deleted_at, doc_id`, ns)
+	if err != nil {
+		if s.missingTable("trash") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	var out []types.TrashedDocument
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var t types.TrashedDocument
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// DeleteTrash drops trashed document id and reports whether there was one.
+func (s *SQLiteMetadataStore) DeleteTrash(id string) (bool, error) {
+	var found bool
+	err := s.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM trash WHERE doc_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		found = n > 0
+		return err
+	})
+	return found, err
+}
+
+// PurgeTrash drops every document trashed before the given time.
+func (s *SQLiteMetadataStore) PurgeTrash(before time.Time) ([]string, error) {
+	var ids []string
+	err := s.update(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`DELETE FROM trash WHERE deleted_at < ? RETURNING doc_id`, before.UnixNano())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	slices.Sort(ids)
+	return ids, err
+}
+
+// ListPins returns the pins of namespace ns, oldest first.
+func (s *SQLiteMetadataStore) ListPins(ns string) ([]types.Pin, error) {
+	rows, err := s.db.Query(`SELECT data FROM pins WHERE namespace = ? ORDER BY created_at, target`, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pins []types.Pin
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var p types.Pin
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			return nil, err
+		}
+		pins = append(pins, p)
+	}
+	return pins, rows.Err()
+}
+
+// SaveTemplate stores t under its namespace.
+func (s *SQLiteMetadataStore) SaveTemplate(t types.ContextTemplate) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO templates (namespace, data) VALUES (?, ?)`, t.Namespace, string(data)); err != nil {
+			return err
+		}
+		return logSQLiteChange(tx, templateChange(t))
+	})
+}
+
+// GetTemplate returns the context template of namespace ns.
+func (s *SQLiteMetadataStore) GetTemplate(ns string) (*types.ContextTemplate, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM templates WHERE namespace = ?`, ns).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) || (err != nil && s.missingTable("templates")) {
+		return nil, fmt.Errorf("template of namespace %q: %w", ns, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t types.ContextTemplate
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteTemplate removes the template of ns and reports whether there was one.
+func (s *SQLiteMetadataStore) DeleteTemplate(ns string) (bool, error) {
+	var found bool
+	err := s.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM templates WHERE namespace = ?`, ns)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		found = true
+		return logSQLiteChange(tx, types.Change{Op: types.ChangeDeleteTemplate, Namespace: ns})
+	})
+	return found, err
+}
+
+// ListTemplates returns every stored template, by namespace.
+func (s *SQLiteMetadataStore) ListTemplates() ([]types.ContextTemplate, error) {
+	rows, err := s.db.Query(`SELECT data FROM templates ORDER BY namespace`)
+	if err != nil {
+		if s.missingTable("templates") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	var out []types.ContextTemplate
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var t types.ContextTemplate
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// GetState returns the bookkeeping value stored under key, or "" if unset.
+func (s *SQLiteMetadataStore) GetState(key string) (string, error) {
+	var val string
+	err := s.db.QueryRow(`SELECT value FROM state WHERE key = ?`, key).Scan(&val)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return val, err
+}
+
+// SetState stores a bookkeeping value under key; an empty one deletes it.
+func (s *SQLiteMetadataStore) SetState(key, value string) error {
+	return s.update(func(tx *sql.Tx) error {
+		if value == "" {
+			_, err := tx.Exec(`DELETE FROM state WHERE key = ?`, key)
+			return err
+		}
+		_, err := tx.Exec(`INSERT OR REPLACE INTO state (key, value) VALUES (?, ?)`, key, value)
+		return err
+	})
+}
+
+// RecordAccess merges access into the access log in one transaction. It
+// bypasses update, so Generation is unchanged.
+func (s *SQLiteMetadataStore) RecordAccess(access map[uint64]types.ChunkAccess) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for id, a := range access {
+		_, err := tx.Exec(`INSERT INTO access (chunk_id, count, last) VALUES (?, ?, ?)
+			ON CONFLICT (chunk_id) DO UPDATE SET count = count + excluded.count, last = MAX(last, excluded.last)`,
+			sqlID(id), int64(a.Count), a.Last.UnixNano())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAccess reads the access log of ids.
+func (s *SQLiteMetadataStore) GetAccess(ids []uint64) (map[uint64]types.ChunkAccess, error) {
+	out := make(map[uint64]types.ChunkAccess)
+	for len(ids) > 0 {
+		n := min(len(ids), sqlitePage)
+		args := make([]any, n)
+		for i, id := range ids[:n] {
+			args[i] = sqlID(id)
+		}
+		ids = ids[n:]
+		placeholders := strings.Repeat("?, ", n-1) + "?"
+		rows, err := s.db.Query(`SELECT chunk_id, count, last FROM access WHERE chunk_id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id, count, last int64
+			if err := rows.Scan(&id, &count, &last); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			out[uint64(id)] = types.ChunkAccess{Count: uint64(count), Last: time.Unix(0, last)}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// DeleteAccess drops the access log entries of ids.
+func (s *SQLiteMetadataStore) DeleteAccess(ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM access WHERE chunk_id = ?`, sqlID(id)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Backup writes a consistent copy of the database to w. SQLite can only
+// VACUUM INTO a file, so the copy is staged in a temporary directory.
+func (s *SQLiteMetadataStore) Backup(w io.Writer) (int64, error) {
+	dir, err := os.MkdirTemp("", "vox-sqlite-backup-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metadata.db")
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
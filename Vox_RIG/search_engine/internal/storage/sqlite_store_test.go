@@ -0,0 +1,130 @@
+//go:build sqlite
+
+package storage
+
+// These tests need the SQLite driver and only build with it:
+//
+//	go test -tags sqlite ./internal/storage/
+//
+// The shared MetadataStore checks in backend_test.go also run against
+// SQLite under the tag instead of being skipped.
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vox-vector-engine/internal/types"
+)
+
+func TestSQLiteSchemaIsQueryable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	s, err := NewSQLiteMetadataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	doc := types.Document{ID: "a.go", Source: "src/a.go", Metadata: types.Metadata{"namespace": "proj"}, Tags: []string{"bug"}}
+	if err := s.SaveDocumentWithChunks(doc, []types.Chunk{
+		{ID: 1, DocID: "a.go", Content: "one", StartLine: 1, EndLine: 2},
+		{ID: 2, DocID: "a.go", Content: "two", StartLine: 3, EndLine: 4},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// What a user would run from a SQLite shell.
+	db, err := sql.Open(sqliteDriver, "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var (
+		source    string
+		startLine int
+		content   string
+	)
+	err = db.QueryRow(`SELECT d.source, c.start_line, c.content FROM chunks c
+		JOIN documents d ON d.id = c.doc_id WHERE d.namespace = 'proj' ORDER BY c.id DESC LIMIT 1`).Scan(&source, &startLine, &content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "src/a.go" || startLine != 3 || content != "two" {
+		t.Errorf("Unexpected row %q %d %q", source, startLine, content)
+	}
+	var docs, chunks int
+	if err := db.QueryRow(`SELECT documents, chunks FROM namespaces WHERE namespace = 'proj'`).Scan(&docs, &chunks); err != nil {
+		t.Fatal(err)
+	}
+	if docs != 1 || chunks != 2 {
+		t.Errorf("namespaces view: %d documents, %d chunks; want 1 and 2", docs, chunks)
+	}
+}
+
+func TestSQLiteReadOnlyFollowsWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	w, err := NewSQLiteMetadataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	r, err := MetadataBackend(SQLiteBackend).OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := w.SaveDocumentWithChunks(types.Document{ID: "d"}, []types.Chunk{{ID: 7, DocID: "d", Content: "seven"}}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.GetChunk(7)
+	if err != nil || c.Content != "seven" {
+		t.Fatalf("Expected the reader to see the writer's commit, got %v %v", c, err)
+	}
+	if err := r.SaveDocumentWithChunks(types.Document{ID: "e"}, nil); err == nil {
+		t.Error("Expected a write through the read-only store to fail")
+	}
+}
+
+func TestSQLiteBackupRestores(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSQLiteMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.SaveDocumentWithChunks(types.Document{ID: "d"}, []types.Chunk{{ID: 1, DocID: "d", Content: "one"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	copyPath := filepath.Join(dir, "copy.db")
+	if err := os.WriteFile(copyPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewSQLiteMetadataStore(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if c, err := restored.GetChunk(1); err != nil || c.Content != "one" {
+		t.Errorf("Expected the backup to hold chunk 1, got %v %v", c, err)
+	}
+}
+
+func TestSQLiteRejectsBoltFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	b, err := NewBoltMetadataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if s, err := MetadataBackend(SQLiteBackend).Open(path); err == nil {
+		s.Close()
+		t.Fatal("Expected opening a Bolt file as SQLite to fail")
+	}
+}
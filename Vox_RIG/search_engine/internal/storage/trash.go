@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+
+	"vox-vector-engine/internal/types"
+)
+
+var (
+	// ErrNotFound is returned by TrashDocument for a missing document and by
+	// RestoreDocument for one that is not in the trash.
+	ErrNotFound = errors.New("not found")
+	// ErrDocumentExists is returned by RestoreDocument when a document with
+	// the same ID was stored since it was trashed.
+	ErrDocumentExists = errors.New("a document with this ID exists")
+)
+
+// trashNamespace is the namespace of a trashed document.
+func trashNamespace(t types.TrashedDocument) string {
+	ns, _ := t.Document.Metadata["namespace"].(string)
+	return ns
+}
+
+// sortTrash orders trashed documents oldest first, then by ID.
+func sortTrash(out []types.TrashedDocument) {
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].DeletedAt.Equal(out[j].DeletedAt) {
+			return out[i].DeletedAt.Before(out[j].DeletedAt)
+		}
+		return out[i].Document.ID < out[j].Document.ID
+	})
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// diskUsage returns the bytes f occupies on disk (its allocated 512-byte
+// blocks), which is less than its length for a sparse file.
+func diskUsage(f *os.File) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no block count for %s", f.Name())
+	}
+	return int64(st.Blocks) * 512, nil
+}
@@ -0,0 +1,103 @@
+package tokens
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type bpe struct {
+	name  string
+	ranks map[string]int
+}
+
+// LoadBPE reads a tiktoken vocabulary file (e.g. cl100k_base.tiktoken, one
+// "<base64 token> <rank>" pair per line). The encoding is named after the file.
+func LoadBPE(path string) (Counter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return NewBPE(name, f)
+}
+
+// NewBPE builds a byte-pair-encoding counter from a tiktoken vocabulary.
+func NewBPE(name string, r io.Reader) (Counter, error) {
+	ranks := make(map[string]int)
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		tok, rankStr, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"<base64> <rank>\"", name, lineNo)
+		}
+		raw, err := base64.StdEncoding.DecodeString(tok)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNo, err)
+		}
+		rank, err := strconv.Atoi(rankStr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNo, err)
+		}
+		ranks[string(raw)] = rank
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty vocabulary", name)
+	}
+	return &bpe{name: name, ranks: ranks}, nil
+}
+
+func (b *bpe) Name() string { return b.name }
+
+func (b *bpe) Count(text string) int {
+	n := 0
+	for _, piece := range pretokenize(text) {
+		if _, ok := b.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += b.mergeCount(piece)
+	}
+	return n
+}
+
+// mergeCount runs byte-level BPE on piece and returns the number of resulting
+// tokens: start from single bytes and repeatedly merge the adjacent pair whose
+// concatenation has the lowest rank.
+func (b *bpe) mergeCount(piece string) int {
+	// parts holds the start offset of each current token; len(piece) closes the last one.
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+
+	for len(parts) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(parts); i++ {
+			if rank, ok := b.ranks[piece[parts[i]:parts[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts) - 1
+}
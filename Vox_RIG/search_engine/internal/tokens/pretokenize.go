@@ -0,0 +1,157 @@
+package tokens
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// pretokenize splits text the way the cl100k_base regex does:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// Go's regexp has no lookahead, so the alternatives are matched by hand, in
+// the same order of preference.
+func pretokenize(text string) []string {
+	var out []string
+	for i := 0; i < len(text); {
+		n := matchAt(text, i)
+		out = append(out, text[i:i+n])
+		i += n
+	}
+	return out
+}
+
+func runeAt(s string, i int) (rune, int) {
+	if i >= len(s) {
+		return utf8.RuneError, 0
+	}
+	return utf8.DecodeRuneInString(s[i:])
+}
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+func isLetter(r rune) bool  { return unicode.IsLetter(r) }
+func isNumber(r rune) bool  { return unicode.IsNumber(r) }
+func isSpace(r rune) bool   { return unicode.IsSpace(r) }
+
+// matchAt returns the byte length of the token starting at i (always > 0).
+func matchAt(s string, i int) int {
+	r, w := runeAt(s, i)
+
+	// 's 't 're 've 'm 'll 'd
+	if r == '\'' {
+		if n := contraction(s[i+1:]); n > 0 {
+			return 1 + n
+		}
+	}
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if isLetter(r) {
+		return w + letters(s, i+w)
+	}
+	if !isNewline(r) && !isNumber(r) {
+		if r2, _ := runeAt(s, i+w); isLetter(r2) {
+			return w + letters(s, i+w)
+		}
+	}
+
+	// \p{N}{1,3}
+	if isNumber(r) {
+		n := w
+		for k := 1; k < 3; k++ {
+			r2, w2 := runeAt(s, i+n)
+			if w2 == 0 || !isNumber(r2) {
+				break
+			}
+			n += w2
+		}
+		return n
+	}
+
+	// ' ?[^\s\p{L}\p{N}]+[\r\n]*'
+	start := i
+	if r == ' ' {
+		start = i + w
+	}
+	if n := punct(s, start); n > 0 {
+		end := start + n
+		for {
+			r2, w2 := runeAt(s, end)
+			if w2 == 0 || !isNewline(r2) {
+				break
+			}
+			end += w2
+		}
+		return end - i
+	}
+
+	// Whitespace alternatives. r is whitespace here.
+	end := i
+	lastNL := -1
+	for {
+		r2, w2 := runeAt(s, end)
+		if w2 == 0 || !isSpace(r2) {
+			break
+		}
+		end += w2
+		if isNewline(r2) {
+			lastNL = end
+		}
+	}
+	// \s*[\r\n]+
+	if lastNL > 0 {
+		return lastNL - i
+	}
+	// \s+(?!\S): leave the last space to prefix the next word.
+	if end < len(s) && end-i > 1 {
+		_, lw := utf8.DecodeLastRuneInString(s[i:end])
+		return end - i - lw
+	}
+	// \s+
+	if end > i {
+		return end - i
+	}
+	return w
+}
+
+func contraction(s string) int {
+	lower := func(i int) byte {
+		if i >= len(s) {
+			return 0
+		}
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		return c
+	}
+	switch a, b := lower(0), lower(1); {
+	case (a == 'r' && b == 'e') || (a == 'v' && b == 'e') || (a == 'l' && b == 'l'):
+		return 2
+	case a == 's' || a == 't' || a == 'm' || a == 'd':
+		return 1
+	}
+	return 0
+}
+
+func letters(s string, i int) int {
+	n := 0
+	for {
+		r, w := runeAt(s, i+n)
+		if w == 0 || !isLetter(r) {
+			return n
+		}
+		n += w
+	}
+}
+
+func punct(s string, i int) int {
+	n := 0
+	for {
+		r, w := runeAt(s, i+n)
+		if w == 0 || isSpace(r) || isLetter(r) || isNumber(r) {
+			return n
+		}
+		n += w
+	}
+}
@@ -0,0 +1,36 @@
+// Package tokens counts tokens the way the downstream LLM will, so chunk
+// TokenCount values and the retrieve max_tokens budget mean the same thing
+// on both sides.
+package tokens
+
+import "strings"
+
+// Counter counts tokens in a piece of text.
+type Counter interface {
+	// Name identifies the encoding (e.g. "cl100k_base" or "heuristic").
+	Name() string
+	Count(text string) int
+}
+
+type heuristic struct{}
+
+// Heuristic returns a counter that needs no vocabulary file. It splits text
+// with the cl100k pre-tokenizer and charges one token per started 6 bytes of
+// each piece (ignoring the leading space BPE folds into words), which tracks
+// real cl100k counts closely for English prose and code.
+func Heuristic() Counter {
+	return heuristic{}
+}
+
+func (heuristic) Name() string { return "heuristic" }
+
+func (heuristic) Count(text string) int {
+	n := 0
+	for _, piece := range pretokenize(text) {
+		if trimmed := strings.TrimPrefix(piece, " "); trimmed != "" {
+			piece = trimmed
+		}
+		n += (len(piece) + 5) / 6
+	}
+	return n
+}
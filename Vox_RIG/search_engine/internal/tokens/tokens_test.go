@@ -0,0 +1,59 @@
+package tokens
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPretokenize(t *testing.T) {
+	got := pretokenize("Hello world  it's\n\nx = 123456;")
+	want := []string{"Hello", " world", " ", " it", "'s", "\n\n", "x", " =", " ", "123", "456", ";"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pretokenize mismatch:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestBPEMerges(t *testing.T) {
+	// Vocabulary: every single byte used below, plus merges "ab" < "abc" < " x".
+	var vocab strings.Builder
+	rank := 0
+	add := func(tok string) {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), rank)
+		rank++
+	}
+	for _, c := range "abcdx " {
+		add(string(c))
+	}
+	add("ab")
+	add("abc")
+
+	c, err := NewBPE("test", strings.NewReader(vocab.String()))
+	if err != nil {
+		t.Fatalf("NewBPE failed: %v", err)
+	}
+
+	cases := map[string]int{
+		"abc":   1, // whole piece is in the vocabulary
+		"abcd":  2, // "abc" + "d"
+		"abdab": 3, // "ab" + "d" + "ab"
+		"":      0,
+	}
+	for text, want := range cases {
+		if got := c.Count(text); got != want {
+			t.Errorf("Count(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestHeuristic(t *testing.T) {
+	h := Heuristic()
+	if got := h.Count(""); got != 0 {
+		t.Errorf("Count(\"\") = %d, want 0", got)
+	}
+	if got := h.Count("the quick brown fox"); got != 4 {
+		t.Errorf("Count(four short words) = %d, want 4", got)
+	}
+}
@@ -0,0 +1,109 @@
+//go:build otel
+
+package tracing
+
+// OpenTelemetry export is opt-in so default builds need no extra modules:
+//
+//	go get go.opentelemetry.io/otel go.opentelemetry.io/otel/sdk \
+//		go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp
+//	go build -tags otel .
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	var opts []otlptracehttp.Option
+	if strings.Contains(cfg.Endpoint, "://") {
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+		}
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	}
+	exp, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("OTLP exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.Service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	prop := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(prop)
+	SetTracer(&otelTracer{tracer: tp.Tracer("vox-vector-engine"), prop: prop})
+	return tp.Shutdown, nil
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+	prop   propagation.TextMapPropagator
+}
+
+func (t *otelTracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(otelAttrs(attrs)...))
+	return ctx, otelSpan{span}
+}
+
+func (t *otelTracer) StartServer(ctx context.Context, h http.Header, name string, attrs ...Attr) (context.Context, Span) {
+	ctx = t.prop.Extract(ctx, propagation.HeaderCarrier(h))
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(otelAttrs(attrs)...))
+	return ctx, otelSpan{span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttributes(attrs ...Attr) { s.span.SetAttributes(otelAttrs(attrs)...) }
+func (s otelSpan) End()                        { s.span.End() }
+
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func otelAttrs(attrs []Attr) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			out[i] = attribute.String(a.Key, v)
+		case int:
+			out[i] = attribute.Int(a.Key, v)
+		case int64:
+			out[i] = attribute.Int64(a.Key, v)
+		case float64:
+			out[i] = attribute.Float64(a.Key, v)
+		case bool:
+			out[i] = attribute.Bool(a.Key, v)
+		default:
+			out[i] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	return out
+}
@@ -0,0 +1,12 @@
+//go:build !otel
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+)
+
+func setup(_ context.Context, cfg Config) (func(context.Context) error, error) {
+	return nil, fmt.Errorf("exporting traces to %s needs a binary built with -tags otel", cfg.Endpoint)
+}
@@ -0,0 +1,102 @@
+// Package tracing records spans along the ingest and retrieve paths so a
+// slow request can be broken down into index search, metadata lookups and
+// response encoding. Default builds record nothing; a binary built with
+// -tags otel exports the spans to an OTLP collector (see Setup).
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Attr is a span attribute. Values are strings, ints, int64s, float64s or
+// bools; anything else is exported as its fmt.Sprint form.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, v string) Attr    { return Attr{key, v} }
+func Int(key string, v int) Attr   { return Attr{key, v} }
+func Bool(key string, v bool) Attr { return Attr{key, v} }
+
+// Span is one timed operation.
+type Span interface {
+	SetAttributes(attrs ...Attr)
+	// RecordError marks the span as failed.
+	RecordError(err error)
+	End()
+}
+
+// Tracer creates spans.
+type Tracer interface {
+	// Start begins a span that is a child of the span in ctx, if any.
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+	// StartServer begins the span of an incoming request, continuing the
+	// caller's trace when h carries a W3C traceparent.
+	StartServer(ctx context.Context, h http.Header, name string, attrs ...Attr) (context.Context, Span)
+}
+
+var tracer Tracer = noop{}
+
+// SetTracer replaces the tracer and returns the previous one. Call it before
+// serving requests; it is not synchronized with Start.
+func SetTracer(t Tracer) Tracer {
+	prev := tracer
+	if t == nil {
+		t = noop{}
+	}
+	tracer = t
+	return prev
+}
+
+// Start begins a span; callers must End it.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	return tracer.Start(ctx, name, attrs...)
+}
+
+// StartServer begins the span of an incoming HTTP request.
+func StartServer(ctx context.Context, h http.Header, name string, attrs ...Attr) (context.Context, Span) {
+	return tracer.StartServer(ctx, h, name, attrs...)
+}
+
+// Config selects where spans are exported.
+type Config struct {
+	// Endpoint is the OTLP/HTTP collector, as host:port (HTTPS) or an
+	// http:// or https:// URL. Empty disables export.
+	Endpoint string
+	// Service is reported as service.name.
+	Service string
+	// SampleRatio is the fraction of new traces recorded; requests that
+	// arrive with a sampled traceparent are always recorded.
+	SampleRatio float64
+}
+
+// Setup starts exporting spans as cfg describes and returns a function that
+// flushes and stops the exporter. With an empty Endpoint it does nothing.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio %g is outside [0, 1]", cfg.SampleRatio)
+	}
+	return setup(ctx, cfg)
+}
+
+type noop struct{}
+
+func (noop) Start(ctx context.Context, _ string, _ ...Attr) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noop) StartServer(ctx context.Context, _ http.Header, _ string, _ ...Attr) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attr) {}
+func (noopSpan) RecordError(error)     {}
+func (noopSpan) End()                  {}
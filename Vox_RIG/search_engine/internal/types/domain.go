@@ -5,6 +5,10 @@ import "time"
 // Vector represents a high-dimensional float32 vector.
 type Vector []float32
 
+// SparseVector maps terms, words or tokenizer IDs, to their weights, as
+// learned sparse models such as SPLADE produce them.
+type SparseVector map[string]float32
+
 // Metadata stores associated key-value pairs for a document or chunk.
 type Metadata map[string]interface{}
 
@@ -14,6 +18,9 @@ type Document struct {
 	Source    string    `json:"source"`    // e.g., file path
 	Timestamp time.Time `json:"timestamp"` // Modification time
 	Metadata  Metadata  `json:"metadata"`
+	// Tags are user labels such as "architecture" or "decision"; retrieval
+	// can be restricted to them (tags_any / tags_all).
+	Tags []string `json:"tags,omitempty"`
 }
 
 // Chunk represents a segment of a document with its vector embedding.
@@ -25,4 +32,73 @@ type Chunk struct {
 	StartLine  int    `json:"start_line"`
 	EndLine    int    `json:"end_line"`
 	TokenCount int    `json:"token_count"`
+	// Metadata holds chunk-level attributes such as the code symbol it covers.
+	Metadata Metadata `json:"metadata,omitempty"`
+}
+
+// Pin marks a document (all of its chunks) or a single chunk as always
+// included in retrieval results for a namespace. Exactly one of DocID and
+// ChunkID is set.
+type Pin struct {
+	Namespace string    `json:"namespace"`
+	DocID     string    `json:"doc_id,omitempty"`
+	ChunkID   *uint64   `json:"chunk_id,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TrashedDocument is a soft-deleted document with the chunks it had. It is
+// out of retrieval until restored or purged.
+type TrashedDocument struct {
+	Document  Document  `json:"document"`
+	Chunks    []Chunk   `json:"chunks"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ContextTemplate formats the /context output of a namespace with Go
+// text/template. Chunk renders each retrieved chunk; Chat, when set, renders
+// chat messages instead. Separator goes between rendered chunks.
+type ContextTemplate struct {
+	Namespace string    `json:"namespace"`
+	Chunk     string    `json:"chunk"`
+	Chat      string    `json:"chat,omitempty"`
+	Separator string    `json:"separator,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ChunkAccess is the retrieval access log of a chunk: how often retrieval
+// returned it and when it last did.
+type ChunkAccess struct {
+	Count uint64    `json:"count"`
+	Last  time.Time `json:"last"`
 }
+
+// Change is one entry of a metadata store's change log, written in the same
+// transaction as the write it records. It names what the write touched
+// rather than carrying it; readers fetch the current state.
+type Change struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Op        string    `json:"op"`
+	DocID     string    `json:"doc_id,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	// ChunkIDs are the chunks saved (document, chunks) or removed
+	// (delete_document) by the write.
+	ChunkIDs []uint64 `json:"chunk_ids,omitempty"`
+	Pin      *Pin     `json:"pin,omitempty"`
+	// Template is the saved template (template); delete_template names
+	// only the namespace.
+	Template *ContextTemplate `json:"template,omitempty"`
+}
+
+// Change.Op values.
+const (
+	ChangeDocument        = "document" // saved, retagged or updated
+	ChangeChunks          = "chunks"   // saved without their document
+	ChangeDeleteDocument  = "delete_document"
+	ChangeDeleteNamespace = "delete_namespace"
+	ChangePin             = "pin"
+	ChangeUnpin           = "unpin"
+	ChangeTemplate        = "template"
+	ChangeDeleteTemplate  = "delete_template"
+)
@@ -0,0 +1,280 @@
+// Package watch keeps a namespace in sync with a project directory: files
+// that are created or modified are re-chunked, re-embedded and upserted, and
+// deleted files have their chunks removed.
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"vox-vector-engine/internal/ignore"
+	"vox-vector-engine/internal/ingest"
+)
+
+const (
+	// IgnoreFile lists gitignore-style patterns excluded from indexing.
+	IgnoreFile = ingest.IgnoreFile
+
+	// DefaultDebounce is how long a path must stay quiet before it is reindexed,
+	// so editors that write a file in several steps trigger one update.
+	DefaultDebounce = 500 * time.Millisecond
+
+	// MaxFileSize skips files larger than this (generated bundles, dumps).
+	MaxFileSize = ingest.MaxFileSize
+)
+
+// Watcher mirrors Root into Namespace through Indexer.
+type Watcher struct {
+	Root      string
+	Namespace string
+	Indexer   *ingest.Indexer
+	Debounce  time.Duration
+
+	ignore *ignore.Matcher
+	fsw    *fsnotify.Watcher
+
+	mu      sync.Mutex
+	known   map[string]bool        // relative paths currently indexed
+	pending map[string]*time.Timer // debounced updates by relative path
+}
+
+// New prepares a watcher for root. Call Run to start it.
+func New(root, ns string, ix *ingest.Indexer) (*Watcher, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(abs); err != nil || !fi.IsDir() {
+		return nil, errors.New("watch root must be an existing directory: " + root)
+	}
+	if ix.Embedder == nil {
+		return nil, ingest.ErrNoEmbedder
+	}
+	return &Watcher{
+		Root:      abs,
+		Namespace: ns,
+		Indexer:   ix,
+		Debounce:  DefaultDebounce,
+		known:     map[string]bool{},
+		pending:   map[string]*time.Timer{},
+	}, nil
+}
+
+// Run indexes files that changed since they were last stored, then follows
+// filesystem events until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := w.loadIgnore(); err != nil {
+		return err
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	w.fsw = fsw
+
+	if err := w.scan(ctx, w.Root); err != nil {
+		return err
+	}
+	log.Printf("[watch] watching %s namespace=%s files=%d", w.Root, w.Namespace, len(w.known))
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			for _, t := range w.pending {
+				t.Stop()
+			}
+			w.mu.Unlock()
+			return ctx.Err()
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("[watch] error: %v", err)
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(ctx, ev)
+		}
+	}
+}
+
+func (w *Watcher) loadIgnore() error {
+	m := ignore.New()
+	for _, p := range ingest.DefaultIgnores {
+		m.AddPattern("", p)
+	}
+	if err := m.AddFile("", filepath.Join(w.Root, IgnoreFile)); err != nil {
+		return err
+	}
+	w.ignore = m
+	return nil
+}
+
+func (w *Watcher) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(w.Root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// scan adds watches for every directory under dir and indexes files whose
+// stored version is older than the file on disk.
+func (w *Watcher) scan(ctx context.Context, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // vanished or unreadable; skip
+		}
+		rel, ok := w.rel(path)
+		if d.IsDir() {
+			if ok && w.ignore.Match(rel, true) {
+				return filepath.SkipDir
+			}
+			if err := w.fsw.Add(path); err != nil {
+				log.Printf("[watch] cannot watch %s: %v", path, err)
+			}
+			return nil
+		}
+		if !ok || !d.Type().IsRegular() || w.ignore.Match(rel, false) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		w.mu.Lock()
+		w.known[rel] = true
+		w.mu.Unlock()
+		if !w.Indexer.IsCurrent(w.Namespace, rel, info.ModTime()) {
+			w.update(ctx, rel)
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) handle(ctx context.Context, ev fsnotify.Event) {
+	rel, ok := w.rel(ev.Name)
+	if !ok {
+		return
+	}
+
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		// The path is gone (a rename shows up as Create for the new name).
+		w.schedule(ctx, rel)
+		return
+	}
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return
+	}
+
+	fi, err := os.Stat(ev.Name)
+	if err != nil {
+		return
+	}
+	if fi.IsDir() {
+		if ev.Has(fsnotify.Create) && !w.ignore.Match(rel, true) {
+			if err := w.scan(ctx, ev.Name); err != nil {
+				log.Printf("[watch] scan %s: %v", rel, err)
+			}
+		}
+		return
+	}
+	if rel == IgnoreFile {
+		if err := w.loadIgnore(); err != nil {
+			log.Printf("[watch] reload %s: %v", IgnoreFile, err)
+		}
+		return
+	}
+	if w.ignore.Match(rel, false) {
+		return
+	}
+	w.schedule(ctx, rel)
+}
+
+// schedule debounces updates to rel.
+func (w *Watcher) schedule(ctx context.Context, rel string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t, ok := w.pending[rel]; ok {
+		t.Stop()
+	}
+	w.pending[rel] = time.AfterFunc(w.Debounce, func() {
+		w.mu.Lock()
+		delete(w.pending, rel)
+		w.mu.Unlock()
+		if ctx.Err() == nil {
+			w.update(ctx, rel)
+		}
+	})
+}
+
+// update brings the stored state of rel in line with the disk: reindex it if
+// it is a file, or remove it (and everything below it, for directories) if
+// it no longer exists.
+func (w *Watcher) update(ctx context.Context, rel string) {
+	abs := filepath.Join(w.Root, filepath.FromSlash(rel))
+	fi, err := os.Stat(abs)
+	if err != nil {
+		w.removeUnder(rel)
+		return
+	}
+	if fi.IsDir() || !fi.Mode().IsRegular() {
+		return
+	}
+	if fi.Size() > MaxFileSize {
+		log.Printf("[watch] skip %s: %d bytes exceeds %d", rel, fi.Size(), MaxFileSize)
+		return
+	}
+
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		log.Printf("[watch] read %s: %v", rel, err)
+		return
+	}
+	res, err := w.Indexer.IndexFile(ctx, w.Namespace, rel, content, fi.ModTime())
+	if err != nil {
+		log.Printf("[watch] index %s: %v", rel, err)
+		return
+	}
+	if res.Skipped != "" {
+		return
+	}
+	w.mu.Lock()
+	w.known[rel] = true
+	w.mu.Unlock()
+	log.Printf("[watch] indexed %s chunks=%d replaced=%d", rel, res.Chunks, res.Removed)
+}
+
+func (w *Watcher) removeUnder(rel string) {
+	w.mu.Lock()
+	var gone []string
+	for k := range w.known {
+		if k == rel || strings.HasPrefix(k, rel+"/") {
+			gone = append(gone, k)
+			delete(w.known, k)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, k := range gone {
+		n, err := w.Indexer.RemoveFile(w.Namespace, k)
+		if err != nil {
+			log.Printf("[watch] remove %s: %v", k, err)
+			continue
+		}
+		log.Printf("[watch] removed %s chunks=%d", k, n)
+	}
+}
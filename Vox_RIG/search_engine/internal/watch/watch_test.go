@@ -0,0 +1,92 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/ingest"
+	"vox-vector-engine/internal/types"
+)
+
+// fakeEmbedder maps every text to a 2-d vector derived from its length.
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Name() string { return "fake" }
+func (fakeEmbedder) Dim() int     { return 2 }
+func (fakeEmbedder) Embed(_ context.Context, texts []string) ([]types.Vector, error) {
+	out := make([]types.Vector, len(texts))
+	for i, t := range texts {
+		out[i] = types.Vector{float32(len(t)), 1}
+	}
+	return out, nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWatcherIndexesAndRemovesFiles(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "existing.md"), []byte("# Hello\n\nworld\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, IgnoreFile), []byte("*.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	shards, err := engine.NewShardManager(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewShardManager failed: %v", err)
+	}
+	defer shards.Close()
+
+	ix := &ingest.Indexer{Resolve: shards.Get, Embedder: fakeEmbedder{}}
+	w, err := New(root, "proj", ix)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	w.Debounce = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	sh, _ := shards.Get("proj")
+	indexed := func(rel string) func() bool {
+		return func() bool {
+			_, err := sh.Meta.GetDocument(ingest.DocID("proj", rel))
+			return err == nil
+		}
+	}
+
+	waitFor(t, "initial scan", indexed("existing.md"))
+
+	src := filepath.Join(root, "main.go")
+	if err := os.WriteFile(src, []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "debug.log"), []byte("noise\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "new file", indexed("main.go"))
+
+	if err := os.Remove(src); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "removal", func() bool { return !indexed("main.go")() })
+
+	if indexed("debug.log")() {
+		t.Errorf("Expected debug.log to be ignored via %s", IgnoreFile)
+	}
+}
@@ -0,0 +1,310 @@
+// Package client is the Go SDK of the engine's HTTP API. It wraps every
+// endpoint with the server's own request and response types, retries
+// requests the server turned away or never saw, applies a per-request
+// timeout, decodes binary vector pages and streams /ingest_stream.
+//
+//	c, err := client.Discover("data") // or client.New("http://127.0.0.1:8080", nil)
+//	res, err := c.Retrieve(ctx, client.RetrieveRequest{Query: q, MaxTokens: 2000})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"vox-vector-engine/internal/listen"
+)
+
+// Defaults for Options.
+const (
+	DefaultTimeout = 30 * time.Second
+	DefaultRetries = 3
+	DefaultBackoff = 200 * time.Millisecond
+)
+
+// maxRetryAfter caps how long a Retry-After header makes the client wait.
+const maxRetryAfter = 30 * time.Second
+
+// Options configure a Client. The zero value uses the defaults.
+type Options struct {
+	// Token is sent as "Authorization: Bearer <token>" to a server started
+	// with -auth_token.
+	Token string
+	// Timeout bounds each attempt of a request; streams are bounded by
+	// their context only. 0 uses DefaultTimeout, a negative value none.
+	Timeout time.Duration
+	// Retries is how many times a request is retried after a 429 or 503
+	// answer, or after a connection error for requests that are safe to
+	// repeat. 0 uses DefaultRetries, a negative value none.
+	Retries int
+	// Backoff is the wait before the first retry, doubled for each further
+	// one; a Retry-After header takes precedence. 0 uses DefaultBackoff.
+	Backoff time.Duration
+	// HTTPClient sends the requests; nil uses http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Client calls one engine. It is safe for concurrent use.
+type Client struct {
+	base string
+	opts Options
+}
+
+// New returns a client of the engine at baseURL, e.g.
+// "http://127.0.0.1:8080". opts may be nil.
+func New(baseURL string, opts *Options) (*Client, error) {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return nil, fmt.Errorf("base URL must be http:// or https://, got %q", baseURL)
+	}
+	c := &Client{base: strings.TrimRight(baseURL, "/")}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Timeout == 0 {
+		c.opts.Timeout = DefaultTimeout
+	}
+	if c.opts.Retries == 0 {
+		c.opts.Retries = DefaultRetries
+	}
+	if c.opts.Backoff <= 0 {
+		c.opts.Backoff = DefaultBackoff
+	}
+	if c.opts.HTTPClient == nil {
+		c.opts.HTTPClient = http.DefaultClient
+	}
+	return c, nil
+}
+
+// Discover returns a client of the engine serving dataDir, found through
+// the engine.json it writes there, with its auth token.
+func Discover(dataDir string) (*Client, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, listen.DiscoveryFile))
+	if err != nil {
+		return nil, fmt.Errorf("no engine found for %s: %w", dataDir, err)
+	}
+	var d listen.Discovery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", listen.DiscoveryFile, err)
+	}
+	if d.URL == "" {
+		return nil, fmt.Errorf("engine for %s listens on %s, which has no HTTP URL", dataDir, d.Addr)
+	}
+	return New(d.URL, &Options{Token: d.Token})
+}
+
+// BaseURL returns the URL the client sends requests to.
+func (c *Client) BaseURL() string { return c.base }
+
+// Error is a non-2xx answer of the server.
+type Error struct {
+	StatusCode int
+	// Code is the machine-readable "error" of JSON error bodies, e.g.
+	// "rate_limited"; empty for plain-text errors.
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("engine: %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("engine: %d: %s", e.StatusCode, e.Message)
+}
+
+// IsStatus reports whether err is an *Error with the given status code.
+func IsStatus(err error, code int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == code
+}
+
+func newError(status int, body []byte) *Error {
+	e := &Error{StatusCode: status, Message: strings.TrimSpace(string(body))}
+	var structured struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &structured) == nil && structured.Error != "" {
+		e.Code, e.Message = structured.Error, structured.Message
+	}
+	return e
+}
+
+// request is one API call.
+type request struct {
+	method string
+	path   string
+	// query parameters; empty values are left out.
+	query map[string]string
+	body  any
+	// idempotent requests are also retried after connection errors.
+	idempotent bool
+	// accept lists the non-2xx statuses whose body is decoded into out
+	// rather than returned as an *Error (e.g. 412 confirm_required).
+	accept []int
+}
+
+func (r request) url(base string) string {
+	q := url.Values{}
+	for k, v := range r.query {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if len(q) == 0 {
+		return base + r.path
+	}
+	return base + r.path + "?" + q.Encode()
+}
+
+// do sends r, retrying as Options say, and decodes the answer into out
+// (which may be nil or a *[]byte for the raw body). It returns the status.
+func (c *Client) do(ctx context.Context, r request, out any) (int, error) {
+	var payload []byte
+	if r.body != nil {
+		var err error
+		if payload, err = json.Marshal(r.body); err != nil {
+			return 0, err
+		}
+	}
+	if r.method == http.MethodGet || r.method == http.MethodPut || r.method == http.MethodDelete {
+		r.idempotent = true
+	}
+	retries := max(c.opts.Retries, 0)
+	for attempt := 0; ; attempt++ {
+		status, body, wait, err := c.attempt(ctx, r, payload)
+		retry := false
+		switch {
+		case err != nil:
+			var netErr net.Error
+			retry = r.idempotent && ctx.Err() == nil && (errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF))
+		case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+			// The server turned the request away without acting on it.
+			retry = true
+			err = newError(status, body)
+		case status >= 300 && !contains(r.accept, status):
+			return status, newError(status, body)
+		default:
+			return status, decode(body, out)
+		}
+		if !retry || attempt >= retries {
+			return status, err
+		}
+		if wait <= 0 {
+			wait = c.backoffFor(attempt)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return status, ctx.Err()
+		}
+	}
+}
+
+// attempt sends r once and returns the status, the body and how long a
+// Retry-After header asks to wait.
+func (c *Client) attempt(ctx context.Context, r request, payload []byte) (int, []byte, time.Duration, error) {
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url(c.base), body)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	return resp.StatusCode, data, retryAfter(resp), nil
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+}
+
+func decode(body []byte, out any) error {
+	switch v := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*v = body
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return min(time.Duration(secs)*time.Second, maxRetryAfter)
+}
+
+func contains(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// formatUint renders query numbers; 0 is left out like an empty string.
+func formatUint(v uint64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func formatInt(v int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
+func formatBool(v bool) string {
+	if !v {
+		return ""
+	}
+	return "true"
+}
+
+// backoffFor is the wait before retry attempt n (from 0) without a
+// Retry-After header, capped like Retry-After is.
+func (c *Client) backoffFor(n int) time.Duration {
+	return min(c.opts.Backoff<<min(n, 16), maxRetryAfter)
+}
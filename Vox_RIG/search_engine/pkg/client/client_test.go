@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"vox-vector-engine/internal/api"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/index"
+	"vox-vector-engine/internal/storage"
+)
+
+func newTestClient(t *testing.T, token string) *Client {
+	t.Helper()
+	dir := t.TempDir()
+	vecs, err := storage.NewMmapVectorStore(filepath.Join(dir, "vectors.bin"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vecs.Close() })
+	meta, err := storage.NewBoltMetadataStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	idx := index.NewHnswIndex(vecs)
+	s := api.NewServer(engine.NewEngine(idx, vecs, meta), idx, meta, vecs)
+	s.SetRequestLog(nil)
+	s.SetAuthToken(token)
+	ts := httptest.NewServer(s.Router())
+	t.Cleanup(ts.Close)
+	c, err := New(ts.URL, &Options{Token: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestIngestRetrieve(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "secret")
+
+	res, err := c.Ingest(ctx, IngestRequest{
+		Document: Document{ID: "doc", Source: "a.go"},
+		Chunks: []IngestChunk{
+			{Content: "alpha", Vector: Vector{1, 0}},
+			{Content: "beta", Vector: Vector{0, 1}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected ingest to succeed, got %v", err)
+	}
+	if len(res.ChunkIDs) != 2 {
+		t.Errorf("Expected 2 chunk IDs, got %v", res.ChunkIDs)
+	}
+
+	out, err := c.Retrieve(ctx, RetrieveRequest{Query: Vector{1, 0}, MaxTokens: 1})
+	if err != nil {
+		t.Fatalf("Expected retrieve to succeed, got %v", err)
+	}
+	if len(out.Chunks) != 1 || out.Chunks[0].Chunk.Content != "alpha" {
+		t.Errorf("Expected the alpha chunk, got %+v", out.Chunks)
+	}
+
+	st, err := c.ReplicationStatus(ctx)
+	if err != nil {
+		t.Fatalf("Expected replication status, got %v", err)
+	}
+	vecs, err := c.ReplicationVectors(ctx, 0, 0, st.Dim)
+	if err != nil {
+		t.Fatalf("Expected vectors, got %v", err)
+	}
+	if len(vecs) != 2 || vecs[1][1] != 1 {
+		t.Errorf("Expected the 2 ingested vectors, got %v", vecs)
+	}
+
+	_, err = c.DocumentVersions(ctx, "missing", DocumentQuery{})
+	if !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("Expected a 404 *Error for a missing document, got %v", err)
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	c := newTestClient(t, "secret")
+	bad, _ := New(c.BaseURL(), nil)
+	if err := bad.Healthz(context.Background()); err != nil {
+		t.Errorf("Expected /healthz without a token to succeed, got %v", err)
+	}
+	_, err := bad.Stats(context.Background())
+	if !IsStatus(err, http.StatusUnauthorized) {
+		t.Errorf("Expected 401 without a token, got %v", err)
+	}
+	if _, err := c.Stats(context.Background()); err != nil {
+		t.Errorf("Expected stats with the token to succeed, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":"overloaded","message":"busy"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer ts.Close()
+
+	c, _ := New(ts.URL, &Options{Backoff: time.Millisecond})
+	if _, err := c.Stats(context.Background()); err != nil {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+
+	calls.Store(0)
+	c, _ = New(ts.URL, &Options{Retries: -1})
+	_, err := c.Stats(context.Background())
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusServiceUnavailable || e.Code != "overloaded" {
+		t.Errorf("Expected a 503 overloaded error without retries, got %v", err)
+	}
+}
+
+func TestIngestStream(t *testing.T) {
+	c := newTestClient(t, "")
+	recs := make(chan IngestStreamRecord)
+	go func() {
+		defer close(recs)
+		recs <- IngestStreamRecord{Document: &Document{ID: "doc", Source: "a.go"}}
+		recs <- IngestStreamRecord{Chunk: &IngestChunk{Content: "alpha", Vector: Vector{1, 0}}}
+		recs <- IngestStreamRecord{Chunk: &IngestChunk{Content: "bad", Vector: Vector{1}}}
+	}()
+	var statuses []IngestStreamStatus
+	sum, err := c.IngestStream(context.Background(), recs, func(st IngestStreamStatus) {
+		statuses = append(statuses, st)
+	})
+	if err != nil {
+		t.Fatalf("Expected the stream to succeed, got %v", err)
+	}
+	if sum.Records != 3 || sum.Chunks != 1 || sum.Errors != 1 || sum.VectorCount != 1 {
+		t.Errorf("Expected 3 records, 1 chunk and 1 error, got %+v", sum)
+	}
+	if len(statuses) != 4 || statuses[2].Status != "error" {
+		t.Errorf("Expected a status per record plus done, got %+v", statuses)
+	}
+}
+
+func TestPurgeEscapedNamespace(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "")
+	if _, err := c.IngestMessage(ctx, IngestMessageRequest{Namespace: "org/repo", ConversationID: "c", Role: "user", Content: "hi", Vector: Vector{1, 0}}); err != nil {
+		t.Fatalf("Expected ingest to succeed, got %v", err)
+	}
+	out, err := c.PurgeNamespace(ctx, "org/repo", "", false)
+	if err != nil || out["status"] != "confirm_required" {
+		t.Fatalf("Expected a confirm token, got %v, %v", out, err)
+	}
+	out, err = c.PurgeNamespace(ctx, "org/repo", out["confirm_token"].(string), false)
+	if err != nil || out["status"] != "purged" {
+		t.Errorf("Expected org/repo purged, got %v, %v", out, err)
+	}
+}
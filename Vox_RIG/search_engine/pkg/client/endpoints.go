@@ -0,0 +1,546 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"vox-vector-engine/internal/api"
+	"vox-vector-engine/internal/jobs"
+)
+
+// v1 is the prefix of the versioned API.
+const v1 = api.APIVersion
+
+// DefaultJobPoll is how often WaitJob asks for a job's status.
+const DefaultJobPoll = 500 * time.Millisecond
+
+func (c *Client) get(ctx context.Context, path string, query map[string]string, out any) error {
+	_, err := c.do(ctx, request{method: http.MethodGet, path: path, query: query}, out)
+	return err
+}
+
+// post sends an operation that may be repeated safely when idempotent.
+func (c *Client) post(ctx context.Context, path string, body any, idempotent bool, out any) error {
+	_, err := c.do(ctx, request{method: http.MethodPost, path: path, body: body, idempotent: idempotent}, out)
+	return err
+}
+
+// ── Probes and info ──
+
+// Info returns the service info and endpoint list (GET /).
+func (c *Client) Info(ctx context.Context) (Object, error) {
+	var out Object
+	return out, c.get(ctx, v1+"/", nil, &out)
+}
+
+// Health returns the vector count and dimension (GET /health).
+func (c *Client) Health(ctx context.Context) (Object, error) {
+	var out Object
+	return out, c.get(ctx, "/health", nil, &out)
+}
+
+// Healthz reports whether the server answers at all (GET /healthz).
+func (c *Client) Healthz(ctx context.Context) error {
+	return c.get(ctx, "/healthz", nil, nil)
+}
+
+// Ready reports whether the server is ready to serve queries (GET
+// /readyz): nil when ready, otherwise an *Error with status 503 whose
+// Message describes what is still warming. It is not retried.
+func (c *Client) Ready(ctx context.Context) error {
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/readyz"}, nil)
+	return err
+}
+
+// Stats returns store, index and memory statistics (GET /stats).
+func (c *Client) Stats(ctx context.Context) (Object, error) {
+	var out Object
+	return out, c.get(ctx, v1+"/stats", nil, &out)
+}
+
+// VectorStats returns the running statistics of the vectors ingested into
+// namespace, or into every namespace when it is empty, with the batches that
+// drifted from them (GET /stats/vectors).
+func (c *Client) VectorStats(ctx context.Context, namespace string) ([]VectorStats, error) {
+	var out struct {
+		Namespaces []VectorStats `json:"namespaces"`
+	}
+	err := c.get(ctx, v1+"/stats/vectors", map[string]string{"namespace": namespace}, &out)
+	return out.Namespaces, err
+}
+
+// OpenAPI returns the OpenAPI document of the API (GET /openapi.json).
+func (c *Client) OpenAPI(ctx context.Context) (Object, error) {
+	var out Object
+	return out, c.get(ctx, v1+"/openapi.json", nil, &out)
+}
+
+// Reset clears the in-memory indexes, rebuilds or wipes one namespace
+// (POST /reset). Wiping data answers with a confirm token first, like
+// PurgeNamespace.
+func (c *Client) Reset(ctx context.Context, req ResetRequest) (Object, error) {
+	var out Object
+	_, err := c.do(ctx, request{method: http.MethodPost, path: v1 + "/reset", body: req, accept: []int{http.StatusPreconditionFailed}}, &out)
+	return out, err
+}
+
+// ── Ingest ──
+
+// Ingest stores a document with pre-embedded chunks (POST /ingest). When
+// the server queues a large batch (202, -ingest_workers) Ingest waits for
+// the job and returns its result, so callers see the same answer either
+// way.
+func (c *Client) Ingest(ctx context.Context, req IngestRequest) (*IngestResult, error) {
+	var raw []byte
+	status, err := c.do(ctx, request{method: http.MethodPost, path: v1 + "/ingest", body: req}, &raw)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusAccepted {
+		var acc Accepted
+		if err := json.Unmarshal(raw, &acc); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		job, err := c.WaitJob(ctx, acc.JobID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if raw, err = json.Marshal(job.Result); err != nil {
+			return nil, err
+		}
+	}
+	var out IngestResult
+	return &out, decode(raw, &out)
+}
+
+// IngestMessage stores one chat message (POST /ingest_message). It is
+// idempotent, so it is retried after connection errors too.
+func (c *Client) IngestMessage(ctx context.Context, req IngestMessageRequest) (*IngestMessageResult, error) {
+	var out IngestMessageResult
+	return &out, c.post(ctx, v1+"/ingest_message", req, true, &out)
+}
+
+// IngestDocument stores one embedded chunk of a file (POST
+// /ingest_document). Storing the same range twice adds a second chunk, so
+// it is not retried.
+func (c *Client) IngestDocument(ctx context.Context, req IngestDocumentRequest) (*IngestResult, error) {
+	var out IngestResult
+	return &out, c.post(ctx, v1+"/ingest_document", req, false, &out)
+}
+
+// IngestText chunks a whole file on the server and, with -embed, embeds
+// and stores it (POST /ingest_text).
+func (c *Client) IngestText(ctx context.Context, req IngestTextRequest) (Object, error) {
+	var out Object
+	return out, c.post(ctx, v1+"/ingest_text", req, false, &out)
+}
+
+// IngestDir indexes a directory on the server's machine as a job (POST
+// /ingest_dir).
+func (c *Client) IngestDir(ctx context.Context, req IngestDirRequest) (*Accepted, error) {
+	var out Accepted
+	return &out, c.post(ctx, v1+"/ingest_dir", req, false, &out)
+}
+
+// ── Retrieval ──
+
+// Retrieve returns the nearest chunks packed into a token budget (POST
+// /retrieve).
+func (c *Client) Retrieve(ctx context.Context, req RetrieveRequest) (*RetrievalResult, error) {
+	var out RetrievalResult
+	return &out, c.post(ctx, v1+"/retrieve", req, true, &out)
+}
+
+// Context retrieves and formats chunks as a prompt-ready block (POST
+// /context).
+func (c *Client) Context(ctx context.Context, req ContextRequest) (*ContextResult, error) {
+	var out ContextResult
+	return &out, c.post(ctx, v1+"/context", req, true, &out)
+}
+
+// Warm pre-walks the index and prefetches vector pages (POST /warm).
+func (c *Client) Warm(ctx context.Context, req WarmRequest) (*WarmResult, error) {
+	var out WarmResult
+	return &out, c.post(ctx, v1+"/warm", req, true, &out)
+}
+
+// Similar returns the documents nearest a stored document or chunk (POST
+// /similar).
+func (c *Client) Similar(ctx context.Context, req SimilarRequest) (*SimilarResult, error) {
+	var out SimilarResult
+	return &out, c.post(ctx, v1+"/similar", req, true, &out)
+}
+
+// Cluster starts a k-means clustering job over a namespace (POST
+// /clusters); follow it with WaitJob, then read it with Clusters.
+func (c *Client) Cluster(ctx context.Context, req ClusterRequest) (*Accepted, error) {
+	var out Accepted
+	return &out, c.post(ctx, v1+"/clusters", req, false, &out)
+}
+
+// Clusters returns the saved clustering of a namespace (GET /clusters); a
+// namespace never clustered is a 404 *Error.
+func (c *Client) Clusters(ctx context.Context, req ClustersRequest) (*Clustering, error) {
+	var out Clustering
+	return &out, c.get(ctx, v1+"/clusters", map[string]string{
+		"namespace": req.Namespace,
+		"chunk_ids": formatBool(req.ChunkIDs),
+		"model":     req.Model,
+	}, &out)
+}
+
+// VerifyIndex checks the index of a namespace and, with req.Repair, fixes
+// it (POST /index/verify).
+func (c *Client) VerifyIndex(ctx context.Context, req VerifyIndexRequest) (*IndexReport, error) {
+	var out IndexReport
+	return &out, c.post(ctx, v1+"/index/verify", req, true, &out)
+}
+
+// Reindex starts a rebuild of the index of a namespace (POST /reindex);
+// follow it with WaitJob, whose result is a ReindexResult.
+func (c *Client) Reindex(ctx context.Context, req ReindexRequest) (*Accepted, error) {
+	var out Accepted
+	return &out, c.post(ctx, v1+"/reindex", req, false, &out)
+}
+
+// SearchText matches chunk content without vectors (GET /search_text).
+func (c *Client) SearchText(ctx context.Context, req SearchTextRequest) (*TextResult, error) {
+	var out TextResult
+	return &out, c.get(ctx, v1+"/search_text", map[string]string{
+		"q":              req.Query,
+		"namespace":      req.Namespace,
+		"mode":           req.Mode,
+		"case_sensitive": formatBool(req.CaseSensitive),
+		"limit":          formatInt(req.Limit),
+		"model":          req.Model,
+	}, &out)
+}
+
+// Feedback reports whether a retrieved chunk was used (POST /feedback).
+func (c *Client) Feedback(ctx context.Context, req FeedbackRequest) (*FeedbackResult, error) {
+	var out FeedbackResult
+	return &out, c.post(ctx, v1+"/feedback", req, false, &out)
+}
+
+// ── Pins and templates ──
+
+// Pins lists the pins of a namespace (GET /pins).
+func (c *Client) Pins(ctx context.Context, namespace, model string) ([]Pin, error) {
+	var out struct {
+		Pins []Pin `json:"pins"`
+	}
+	return out.Pins, c.get(ctx, v1+"/pins", map[string]string{"namespace": namespace, "model": model}, &out)
+}
+
+// Pin pins a document or chunk (POST /pins).
+func (c *Client) Pin(ctx context.Context, req PinRequest) (*Pin, error) {
+	var out struct {
+		Pin Pin `json:"pin"`
+	}
+	return &out.Pin, c.post(ctx, v1+"/pins", req, true, &out)
+}
+
+// Unpin removes a pin (DELETE /pins); a missing pin is a 404 *Error.
+func (c *Client) Unpin(ctx context.Context, req PinRequest) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: v1 + "/pins", body: req}, nil)
+	return err
+}
+
+// Templates lists the context templates of every namespace (GET
+// /templates).
+func (c *Client) Templates(ctx context.Context, model string) ([]ContextTemplate, error) {
+	var out struct {
+		Templates []ContextTemplate `json:"templates"`
+	}
+	return out.Templates, c.get(ctx, v1+"/templates", map[string]string{"model": model}, &out)
+}
+
+// Template returns the context template of namespace (GET /templates).
+func (c *Client) Template(ctx context.Context, namespace, model string) (*ContextTemplate, error) {
+	var out ContextTemplate
+	return &out, c.get(ctx, v1+"/templates", map[string]string{"namespace": namespace, "model": model}, &out)
+}
+
+// SetTemplate sets the context template of a namespace (PUT /templates).
+func (c *Client) SetTemplate(ctx context.Context, req TemplateRequest) (*ContextTemplate, error) {
+	var out struct {
+		Template ContextTemplate `json:"template"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPut, path: v1 + "/templates", body: req}, &out)
+	return &out.Template, err
+}
+
+// DeleteTemplate removes the context template of a namespace (DELETE
+// /templates).
+func (c *Client) DeleteTemplate(ctx context.Context, req TemplateRequest) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: v1 + "/templates", body: req}, nil)
+	return err
+}
+
+// Quotas lists the namespace quotas with their usage and evictions (GET
+// /quotas).
+func (c *Client) Quotas(ctx context.Context, model string) ([]QuotaStatus, error) {
+	var out struct {
+		Quotas []QuotaStatus `json:"quotas"`
+	}
+	return out.Quotas, c.get(ctx, v1+"/quotas", map[string]string{"model": model}, &out)
+}
+
+// Quota returns the quota of namespace (GET /quotas).
+func (c *Client) Quota(ctx context.Context, namespace, model string) (*QuotaStatus, error) {
+	var out QuotaStatus
+	return &out, c.get(ctx, v1+"/quotas", map[string]string{"namespace": namespace, "model": model}, &out)
+}
+
+// SetQuota sets the quota of a namespace, evicting what is over it (PUT
+// /quotas).
+func (c *Client) SetQuota(ctx context.Context, req QuotaRequest) (*QuotaStatus, error) {
+	var out struct {
+		Quota QuotaStatus `json:"quota"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPut, path: v1 + "/quotas", body: req}, &out)
+	return &out.Quota, err
+}
+
+// DeleteQuota removes the quota of a namespace (DELETE /quotas).
+func (c *Client) DeleteQuota(ctx context.Context, req QuotaRequest) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: v1 + "/quotas", body: req}, nil)
+	return err
+}
+
+// ── Documents ──
+
+func documentPath(id, action string) string {
+	return v1 + "/documents/" + url.PathEscape(id) + action
+}
+
+// Document returns a stored document with all its chunks in line order
+// (GET /documents/{id}).
+func (c *Client) Document(ctx context.Context, id string, q DocumentQuery) (*DocumentResult, error) {
+	var out DocumentResult
+	return &out, c.get(ctx, documentPath(id, ""), map[string]string{"namespace": q.Namespace, "model": q.Model}, &out)
+}
+
+// Chunk returns a stored chunk with its document (GET /chunks/{id}).
+func (c *Client) Chunk(ctx context.Context, id uint64, q DocumentQuery) (*ChunkResult, error) {
+	var out ChunkResult
+	return &out, c.get(ctx, v1+"/chunks/"+strconv.FormatUint(id, 10), map[string]string{"namespace": q.Namespace, "model": q.Model}, &out)
+}
+
+// UpdateDocument merges document metadata (PATCH /documents/{id}).
+func (c *Client) UpdateDocument(ctx context.Context, id string, req UpdateDocumentRequest) (*UpdateDocumentResult, error) {
+	var out UpdateDocumentResult
+	_, err := c.do(ctx, request{method: http.MethodPatch, path: documentPath(id, ""), body: req}, &out)
+	return &out, err
+}
+
+// SetTags replaces, adds or removes document tags (PATCH
+// /documents/{id}/tags).
+func (c *Client) SetTags(ctx context.Context, id string, req TagsRequest) (*TagsResult, error) {
+	var out TagsResult
+	_, err := c.do(ctx, request{method: http.MethodPatch, path: documentPath(id, "/tags"), body: req}, &out)
+	return &out, err
+}
+
+// DeleteDocument deletes a document, or moves it to the trash when soft
+// (DELETE /documents/{id}).
+func (c *Client) DeleteDocument(ctx context.Context, id string, q DocumentQuery, soft bool) (*DeleteDocumentResult, error) {
+	var out DeleteDocumentResult
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: documentPath(id, ""), query: map[string]string{
+		"namespace": q.Namespace, "model": q.Model, "soft": formatBool(soft),
+	}}, &out)
+	return &out, err
+}
+
+// RestoreDocument brings a document back from the trash (POST
+// /documents/{id}/restore).
+func (c *Client) RestoreDocument(ctx context.Context, id string, q DocumentQuery) (*RestoreDocumentResult, error) {
+	var out RestoreDocumentResult
+	_, err := c.do(ctx, request{method: http.MethodPost, path: documentPath(id, "/restore"), query: map[string]string{
+		"namespace": q.Namespace, "model": q.Model,
+	}, idempotent: true}, &out)
+	return &out, err
+}
+
+// DocumentVersions returns the kept versions of a re-indexed file (GET
+// /documents/{id}/versions).
+func (c *Client) DocumentVersions(ctx context.Context, id string, q DocumentQuery) (*DocumentVersionsResult, error) {
+	var out DocumentVersionsResult
+	return &out, c.get(ctx, documentPath(id, "/versions"), map[string]string{"namespace": q.Namespace, "model": q.Model}, &out)
+}
+
+// Trash lists the soft-deleted documents of a namespace (GET /trash).
+func (c *Client) Trash(ctx context.Context, q DocumentQuery) ([]TrashEntry, error) {
+	var out struct {
+		Trash []TrashEntry `json:"trash"`
+	}
+	return out.Trash, c.get(ctx, v1+"/trash", map[string]string{"namespace": q.Namespace, "model": q.Model}, &out)
+}
+
+// Changes returns one page of the change feed (GET /changes).
+func (c *Client) Changes(ctx context.Context, req ChangesRequest) (*ChangesResult, error) {
+	var out ChangesResult
+	return &out, c.get(ctx, v1+"/changes", map[string]string{
+		"since":     formatUint(req.Since),
+		"limit":     formatInt(req.Limit),
+		"namespace": req.Namespace,
+		"model":     req.Model,
+	}, &out)
+}
+
+// ── Namespaces, conversations ──
+
+// PurgeNamespace deletes a namespace (DELETE /namespaces/{ns}). Called
+// without confirm it deletes nothing and returns {"status":
+// "confirm_required", "confirm_token": ...}; call again with that token.
+// With async the purge runs as a job whose ID is in "job_id".
+func (c *Client) PurgeNamespace(ctx context.Context, namespace, confirm string, async bool) (Object, error) {
+	var out Object
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: v1 + "/namespaces/" + url.PathEscape(namespace), query: map[string]string{
+		"confirm": confirm, "async": formatBool(async),
+	}, accept: []int{http.StatusPreconditionFailed}}, &out)
+	return out, err
+}
+
+// ConversationSummary returns the rolling summary of a conversation (GET
+// /conversations/{id}/summary).
+func (c *Client) ConversationSummary(ctx context.Context, id, namespace string) (*ConversationSummary, error) {
+	var out ConversationSummary
+	return &out, c.get(ctx, v1+"/conversations/"+url.PathEscape(id)+"/summary", map[string]string{"namespace": namespace}, &out)
+}
+
+// RefreshConversationSummary refreshes the rolling summary of a
+// conversation now (POST /conversations/{id}/summary).
+func (c *Client) RefreshConversationSummary(ctx context.Context, id, namespace string) (*ConversationSummary, error) {
+	var out ConversationSummary
+	_, err := c.do(ctx, request{method: http.MethodPost, path: v1 + "/conversations/" + url.PathEscape(id) + "/summary", query: map[string]string{"namespace": namespace}, idempotent: true}, &out)
+	return &out, err
+}
+
+// ── Storage ──
+
+// Flush fsyncs every vector store (POST /flush).
+func (c *Client) Flush(ctx context.Context) error {
+	return c.post(ctx, v1+"/flush", nil, true, nil)
+}
+
+// Snapshots lists the snapshots (GET /snapshot).
+func (c *Client) Snapshots(ctx context.Context) ([]string, error) {
+	var out struct {
+		Snapshots []string `json:"snapshots"`
+	}
+	return out.Snapshots, c.get(ctx, v1+"/snapshot", nil, &out)
+}
+
+// Snapshot creates a snapshot (POST /snapshot).
+func (c *Client) Snapshot(ctx context.Context) (Object, error) {
+	var out Object
+	return out, c.post(ctx, v1+"/snapshot", nil, false, &out)
+}
+
+// Restore replaces the stores with a snapshot (POST /restore).
+func (c *Client) Restore(ctx context.Context, snapshot string) (Object, error) {
+	var out Object
+	return out, c.post(ctx, v1+"/restore", map[string]string{"snapshot": snapshot}, false, &out)
+}
+
+// Compact runs one chat compaction pass as a job (POST /compact).
+func (c *Client) Compact(ctx context.Context) (*Accepted, error) {
+	var out Accepted
+	return &out, c.post(ctx, v1+"/compact", nil, false, &out)
+}
+
+// Maintenance returns the maintenance schedule and what the last window did
+// (GET /maintenance).
+func (c *Client) Maintenance(ctx context.Context) (*MaintenanceStatus, error) {
+	var out MaintenanceStatus
+	return &out, c.get(ctx, v1+"/maintenance", nil, &out)
+}
+
+// ── Jobs ──
+
+// Jobs lists background jobs, newest first (GET /jobs); kind and status
+// filter them when set.
+func (c *Client) Jobs(ctx context.Context, kind string, status JobStatus) ([]Job, error) {
+	var out struct {
+		Jobs []Job `json:"jobs"`
+	}
+	return out.Jobs, c.get(ctx, v1+"/jobs", map[string]string{"kind": kind, "status": string(status)}, &out)
+}
+
+// Job returns the status, progress and result of a job (GET /jobs/{id}).
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var out Job
+	return &out, c.get(ctx, v1+"/jobs/"+url.PathEscape(id), nil, &out)
+}
+
+// CancelJob cancels a queued or running job (DELETE /jobs/{id}).
+func (c *Client) CancelJob(ctx context.Context, id string) (*Job, error) {
+	var out Job
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: v1 + "/jobs/" + url.PathEscape(id)}, &out)
+	return &out, err
+}
+
+// WaitJob polls a job every poll (DefaultJobPoll when 0) until it
+// finishes. A job that failed or was canceled is returned with an error.
+func (c *Client) WaitJob(ctx context.Context, id string, poll time.Duration) (*Job, error) {
+	if poll <= 0 {
+		poll = DefaultJobPoll
+	}
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch job.Status {
+		case jobs.Done:
+			return job, nil
+		case jobs.Failed, jobs.Canceled:
+			return job, fmt.Errorf("job %s %s: %s", id, job.Status, job.Error)
+		}
+		select {
+		case <-time.After(poll):
+		case <-ctx.Done():
+			return job, ctx.Err()
+		}
+	}
+}
+
+// ── Replication ──
+
+// ReplicationStatus returns the primary's vector count, dimension and
+// newest change (GET /replication/status).
+func (c *Client) ReplicationStatus(ctx context.Context) (*ReplicationStatus, error) {
+	var out ReplicationStatus
+	return &out, c.get(ctx, v1+"/replication/status", nil, &out)
+}
+
+// ReplicationChanges returns change log entries after since (GET
+// /replication/changes).
+func (c *Client) ReplicationChanges(ctx context.Context, since uint64, limit int) (*ChangesPage, error) {
+	var out ChangesPage
+	return &out, c.get(ctx, v1+"/replication/changes", map[string]string{"since": formatUint(since), "limit": formatInt(limit)}, &out)
+}
+
+// ReplicationDocument returns a document with all its chunks (GET
+// /replication/document).
+func (c *Client) ReplicationDocument(ctx context.Context, id string) (*DocumentState, error) {
+	var out DocumentState
+	return &out, c.get(ctx, v1+"/replication/document", map[string]string{"id": id}, &out)
+}
+
+// ReplicationChunks returns chunks by ID (GET /replication/chunks).
+func (c *Client) ReplicationChunks(ctx context.Context, ids []uint64) (*ChunksPage, error) {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(id, 10)
+	}
+	var out ChunksPage
+	return &out, c.get(ctx, v1+"/replication/chunks", map[string]string{"ids": strings.Join(parts, ",")}, &out)
+}
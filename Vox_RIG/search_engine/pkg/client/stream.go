@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// IngestStreamStatus is the server's answer to one record of a stream.
+// The final "done" status carries the Summary.
+type IngestStreamStatus struct {
+	Line    int                  `json:"line"`
+	Status  string               `json:"status"`
+	DocID   string               `json:"doc_id,omitempty"`
+	ChunkID *uint64              `json:"chunk_id,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	Summary *IngestStreamSummary `json:"summary,omitempty"`
+}
+
+// IngestStreamSummary totals a stream.
+type IngestStreamSummary struct {
+	Records     int    `json:"records"`
+	Documents   int    `json:"documents"`
+	Chunks      int    `json:"chunks"`
+	Errors      int    `json:"errors"`
+	VectorCount uint64 `json:"vector_count"`
+}
+
+// IngestStream sends records to POST /ingest_stream as they arrive on recs,
+// until recs is closed, and calls onStatus (if not nil) with the server's
+// answer to each one as it comes back. A record the server rejects does not
+// end the stream; it is counted in the summary's Errors.
+//
+// A stream is bounded by ctx alone and is never retried, since the server
+// may already have stored part of it.
+func (c *Client) IngestStream(ctx context.Context, recs <-chan IngestStreamRecord, onStatus func(IngestStreamStatus)) (*IngestStreamSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(pw)
+		for {
+			select {
+			case rec, ok := <-recs:
+				if !ok {
+					pw.Close()
+					return
+				}
+				if err := enc.Encode(rec); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+				return
+			}
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+v1+"/ingest_stream", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	c.authorize(req)
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newError(resp.StatusCode, body)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		var st IngestStreamStatus
+		if err := json.Unmarshal(sc.Bytes(), &st); err != nil {
+			return nil, fmt.Errorf("decode stream status: %w", err)
+		}
+		if onStatus != nil {
+			onStatus(st)
+		}
+		if st.Summary != nil {
+			return st.Summary, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("ingest stream ended without a summary")
+}
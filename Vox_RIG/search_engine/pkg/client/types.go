@@ -0,0 +1,115 @@
+package client
+
+import (
+	"vox-vector-engine/internal/api"
+	"vox-vector-engine/internal/commands"
+	"vox-vector-engine/internal/engine"
+	"vox-vector-engine/internal/jobs"
+	"vox-vector-engine/internal/maintenance"
+	"vox-vector-engine/internal/replication"
+	"vox-vector-engine/internal/scrub"
+	"vox-vector-engine/internal/types"
+)
+
+// The request and response types are the server's own, so the SDK cannot
+// drift from the API (the OpenAPI document is generated from them too).
+type (
+	Vector          = types.Vector
+	Document        = types.Document
+	Chunk           = types.Chunk
+	Metadata        = types.Metadata
+	Pin             = types.Pin
+	ContextTemplate = types.ContextTemplate
+	Change          = types.Change
+	ChunkAccess     = types.ChunkAccess
+
+	IngestRequest          = commands.IngestRequest
+	IngestChunk            = commands.IngestChunk
+	IngestResult           = commands.IngestResult
+	IngestMessageRequest   = commands.IngestMessageRequest
+	IngestMessageResult    = commands.IngestMessageResult
+	IngestDocumentRequest  = commands.IngestDocumentRequest
+	RetrieveRequest        = commands.RetrieveRequest
+	ContextRequest         = commands.ContextRequest
+	ContextResult          = commands.ContextResult
+	WarmRequest            = commands.WarmRequest
+	WarmResult             = commands.WarmResult
+	PinRequest             = commands.PinRequest
+	FeedbackRequest        = commands.FeedbackRequest
+	FeedbackResult         = commands.FeedbackResult
+	TemplateRequest        = commands.TemplateRequest
+	UpdateDocumentRequest  = commands.UpdateDocumentRequest
+	UpdateDocumentResult   = commands.UpdateDocumentResult
+	TagsRequest            = commands.TagsRequest
+	TagsResult             = commands.TagsResult
+	DeleteDocumentResult   = commands.DeleteDocumentResult
+	RestoreDocumentResult  = commands.RestoreDocumentResult
+	DocumentVersionsResult = commands.DocumentVersionsResult
+	DocumentResult         = commands.DocumentResult
+	DocumentChunk          = commands.DocumentChunk
+	SimilarRequest         = commands.SimilarRequest
+	SimilarResult          = commands.SimilarResult
+	ClusterRequest         = commands.ClusterRequest
+	ClustersRequest        = commands.ClustersRequest
+	QuotaRequest           = commands.QuotaRequest
+	VerifyIndexRequest     = commands.VerifyIndexRequest
+	ReindexRequest         = commands.ReindexRequest
+	ChunkResult            = commands.ChunkResult
+	ChangesResult          = commands.ChangesResult
+	TrashEntry             = commands.TrashEntry
+	SearchTextRequest      = commands.SearchTextRequest
+	ChangesRequest         = commands.ChangesRequest
+
+	RetrievalResult = engine.RetrievalResult
+	ScoredChunk     = engine.ScoredChunk
+	TextResult      = engine.TextResult
+	Clustering      = engine.Clustering
+	Cluster         = engine.Cluster
+	QuotaStatus     = engine.QuotaStatus
+	IndexReport     = engine.IndexReport
+	ReindexResult   = engine.ReindexResult
+	VectorStats     = engine.VectorStats
+	DriftWarning    = engine.DriftWarning
+
+	IngestStreamRecord  = api.IngestStreamRecord
+	IngestTextRequest   = api.IngestTextRequest
+	IngestDirRequest    = api.IngestDirRequest
+	ConversationSummary = api.ConversationSummary
+
+	Job       = jobs.Job
+	JobStatus = jobs.Status
+
+	MaintenanceStatus = maintenance.Status
+
+	ReplicationStatus = replication.Status
+	ChangesPage       = replication.ChangesPage
+	DocumentState     = replication.DocumentState
+	ChunksPage        = replication.ChunksPage
+
+	ScrubReport = scrub.Report
+	Redaction   = scrub.Redaction
+)
+
+// Object is a free-form JSON object, for endpoints without a response type.
+type Object = map[string]any
+
+// ResetRequest is the optional body of POST /reset.
+type ResetRequest struct {
+	Namespace string `json:"namespace,omitempty"`
+	WipeData  bool   `json:"wipe_data,omitempty"`
+	Confirm   string `json:"confirm,omitempty"`
+}
+
+// DocumentQuery selects the namespace and model space of a document for
+// the document endpoints that take them in the query.
+type DocumentQuery struct {
+	Namespace string
+	Model     string
+}
+
+// Accepted answers a request run as a background job (HTTP 202); follow it
+// with Job or WaitJob.
+type Accepted struct {
+	Status string `json:"status"`
+	JobID  string `json:"job_id"`
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"vox-vector-engine/internal/replication"
+)
+
+// EncodeVectors writes vectors in the engine's binary form: little-endian
+// float32s, one vector after the other, with no header.
+func EncodeVectors(w io.Writer, vectors []Vector) error {
+	return replication.EncodeVectors(w, vectors)
+}
+
+// DecodeVectors splits a binary vector payload into vectors of dim floats.
+func DecodeVectors(data []byte, dim int) ([]Vector, error) {
+	return replication.DecodeVectors(data, dim)
+}
+
+// ReplicationVectors returns up to limit stored vectors starting at ID
+// from (GET /replication/vectors), decoded with the dimension dim given by
+// ReplicationStatus. limit 0 uses the server's default batch.
+func (c *Client) ReplicationVectors(ctx context.Context, from uint64, limit, dim int) ([]Vector, error) {
+	var raw []byte
+	_, err := c.do(ctx, request{method: http.MethodGet, path: v1 + "/replication/vectors", query: map[string]string{
+		"from": formatUint(from), "limit": formatInt(limit),
+	}}, &raw)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeVectors(raw, dim)
+}
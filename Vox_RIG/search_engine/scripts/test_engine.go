@@ -2,62 +2,20 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"vox-vector-engine/internal/types"
+	"vox-vector-engine/pkg/client"
 )
 
 const baseURL = "http://localhost:8080"
 
-type ingestChunk struct {
-	DocID      string       `json:"doc_id"`
-	Vector     types.Vector `json:"vector"`
-	Content    string       `json:"content"`
-	StartLine  int          `json:"start_line"`
-	EndLine    int          `json:"end_line"`
-	TokenCount int          `json:"token_count"`
-}
-
-type ingestRequest struct {
-	Document types.Document `json:"document"`
-	Chunks   []ingestChunk  `json:"chunks"`
-}
-
-type ingestResponse struct {
-	Status      string   `json:"status"`
-	DocID       string   `json:"doc_id"`
-	ChunkIDs    []uint64 `json:"chunk_ids"`
-	VectorCount int      `json:"vector_count"`
-}
-
-type retrieveRequest struct {
-	Query     types.Vector `json:"query"`
-	MaxTokens int          `json:"max_tokens"`
-}
-
-type retrieveChunk struct {
-	ID         uint64 `json:"id"`
-	DocID      string `json:"doc_id"`
-	Content    string `json:"content"`
-	StartLine  int    `json:"start_line"`
-	EndLine    int    `json:"end_line"`
-	TokenCount int    `json:"token_count"`
-}
-
-type retrieveResponse struct {
-	Chunks      []retrieveChunk `json:"Chunks"`
-	TotalTokens int             `json:"TotalTokens"`
-	Truncated   bool            `json:"Truncated"`
-}
-
 // Cache formats: compact + stable keys for easy AI parsing.
 type cacheFile struct {
 	Schema   int       `json:"schema"`
@@ -122,8 +80,17 @@ func main() {
 		fmt.Println("doc_new:", docNewID)
 	}
 
+	ctx := context.Background()
+	c, err := client.New(baseURL, &client.Options{Token: os.Getenv("VOX_TOKEN")})
+	if err != nil {
+		fail("server_reachable", err.Error())
+		writeCache(cache, dumpRaw)
+		printSummary(cache, human)
+		return
+	}
+
 	// Wait for server
-	if err := waitForServer(baseURL, 5*time.Second); err != nil {
+	if err := waitForServer(ctx, c, 5*time.Second); err != nil {
 		fail("server_reachable", err.Error())
 		writeCache(cache, dumpRaw)
 		printSummary(cache, human)
@@ -155,15 +122,18 @@ func main() {
 	if human {
 		fmt.Println("1) ingest old")
 	}
-	req1 := ingestRequest{
+	// Retrieval recounts tokens from the content, so the old chunk has to
+	// really be long to miss the 150-token budget.
+	oldContent := "This is old content that is very long..." + strings.Repeat(" padding", 200)
+	req1 := client.IngestRequest{
 		Document: docOld,
-		Chunks: []ingestChunk{
-			{DocID: docOldID, Content: "This is old content that is very long...", TokenCount: 200, Vector: vec1},
+		Chunks: []client.IngestChunk{
+			{DocID: docOldID, Content: oldContent, TokenCount: 200, Vector: vec1},
 		},
 	}
-	raw1, status, err := sendRequest("/ingest", req1)
+	ing1, err := c.Ingest(ctx, req1)
 	if dumpRaw {
-		cache.Raw.IngestOld = raw1
+		cache.Raw.IngestOld = rawJSON(ing1)
 	}
 	if err != nil {
 		fail("ingest_old", "request_error: "+err.Error())
@@ -171,19 +141,6 @@ func main() {
 		printSummary(cache, human)
 		return
 	}
-	if status < 200 || status >= 300 {
-		fail("ingest_old", fmt.Sprintf("http_%d", status))
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
-	var ing1 ingestResponse
-	if err := json.Unmarshal([]byte(raw1), &ing1); err != nil {
-		fail("ingest_old", "json_parse_error: "+err.Error())
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
 	if ing1.Status != "ingested" || ing1.DocID != docOldID || len(ing1.ChunkIDs) == 0 {
 		fail("ingest_old", "unexpected_payload")
 		writeCache(cache, dumpRaw)
@@ -196,15 +153,15 @@ func main() {
 	if human {
 		fmt.Println("2) ingest new")
 	}
-	req2 := ingestRequest{
+	req2 := client.IngestRequest{
 		Document: docNew,
-		Chunks: []ingestChunk{
+		Chunks: []client.IngestChunk{
 			{DocID: docNewID, Content: "This is new content, slightly less similar but more recent.", TokenCount: 100, Vector: vec2},
 		},
 	}
-	raw2, status, err := sendRequest("/ingest", req2)
+	ing2, err := c.Ingest(ctx, req2)
 	if dumpRaw {
-		cache.Raw.IngestNew = raw2
+		cache.Raw.IngestNew = rawJSON(ing2)
 	}
 	if err != nil {
 		fail("ingest_new", "request_error: "+err.Error())
@@ -212,19 +169,6 @@ func main() {
 		printSummary(cache, human)
 		return
 	}
-	if status < 200 || status >= 300 {
-		fail("ingest_new", fmt.Sprintf("http_%d", status))
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
-	var ing2 ingestResponse
-	if err := json.Unmarshal([]byte(raw2), &ing2); err != nil {
-		fail("ingest_new", "json_parse_error: "+err.Error())
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
 	if ing2.Status != "ingested" || ing2.DocID != docNewID || len(ing2.ChunkIDs) == 0 {
 		fail("ingest_new", "unexpected_payload")
 		writeCache(cache, dumpRaw)
@@ -239,9 +183,9 @@ func main() {
 	}
 	query := make(types.Vector, dim)
 	query[0] = 1.0
-	rawR1, status, err := sendRequest("/retrieve", retrieveRequest{Query: query, MaxTokens: 150})
+	r1, err := c.Retrieve(ctx, client.RetrieveRequest{Query: query, MaxTokens: 150})
 	if dumpRaw {
-		cache.Raw.R150 = rawR1
+		cache.Raw.R150 = rawJSON(r1)
 	}
 	if err != nil {
 		fail("retrieve_150", "request_error: "+err.Error())
@@ -249,19 +193,6 @@ func main() {
 		printSummary(cache, human)
 		return
 	}
-	if status < 200 || status >= 300 {
-		fail("retrieve_150", fmt.Sprintf("http_%d", status))
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
-	var r1 retrieveResponse
-	if err := json.Unmarshal([]byte(rawR1), &r1); err != nil {
-		fail("retrieve_150", "json_parse_error: "+err.Error())
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
 	if r1.TotalTokens > 150 {
 		fail("retrieve_150", fmt.Sprintf("budget_exceeded tokens=%d", r1.TotalTokens))
 		writeCache(cache, dumpRaw)
@@ -287,9 +218,9 @@ func main() {
 	if human {
 		fmt.Println("4) retrieve 500")
 	}
-	rawR2, status, err := sendRequest("/retrieve", retrieveRequest{Query: query, MaxTokens: 500})
+	r2, err := c.Retrieve(ctx, client.RetrieveRequest{Query: query, MaxTokens: 500})
 	if dumpRaw {
-		cache.Raw.R500 = rawR2
+		cache.Raw.R500 = rawJSON(r2)
 	}
 	if err != nil {
 		fail("retrieve_500", "request_error: "+err.Error())
@@ -297,19 +228,6 @@ func main() {
 		printSummary(cache, human)
 		return
 	}
-	if status < 200 || status >= 300 {
-		fail("retrieve_500", fmt.Sprintf("http_%d", status))
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
-	var r2 retrieveResponse
-	if err := json.Unmarshal([]byte(rawR2), &r2); err != nil {
-		fail("retrieve_500", "json_parse_error: "+err.Error())
-		writeCache(cache, dumpRaw)
-		printSummary(cache, human)
-		return
-	}
 	if r2.TotalTokens > 500 {
 		fail("retrieve_500", fmt.Sprintf("budget_exceeded tokens=%d", r2.TotalTokens))
 		writeCache(cache, dumpRaw)
@@ -400,55 +318,40 @@ func writeCache(cache cacheFile, includeRaw bool) {
 	_ = os.WriteFile(path, b, 0o644)
 }
 
-func containsDocID(r retrieveResponse, docID string) bool {
+func containsDocID(r *client.RetrievalResult, docID string) bool {
 	for _, c := range r.Chunks {
-		if c.DocID == docID {
+		if c.Chunk.DocID == docID {
 			return true
 		}
 	}
 	return false
 }
 
-func firstIndexOfDocID(r retrieveResponse, docID string) int {
+func firstIndexOfDocID(r *client.RetrievalResult, docID string) int {
 	for i, c := range r.Chunks {
-		if c.DocID == docID {
+		if c.Chunk.DocID == docID {
 			return i
 		}
 	}
 	return -1
 }
 
-func docsPresent(r retrieveResponse, newID, oldID string) string {
+func docsPresent(r *client.RetrievalResult, newID, oldID string) string {
 	hasNew := containsDocID(r, newID)
 	hasOld := containsDocID(r, oldID)
 	return fmt.Sprintf("new=%v old=%v", hasNew, hasOld)
 }
 
-func sendRequest(endpoint string, data interface{}) (string, int, error) {
-	b, err := json.Marshal(data)
-	if err != nil {
-		return "", 0, err
-	}
-
-	resp, err := http.Post(baseURL+endpoint, "application/json", bytes.NewBuffer(b))
-	if err != nil {
-		return "", 0, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	return string(body), resp.StatusCode, nil
+// rawJSON keeps a response in the cache when RAW is set.
+func rawJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
 }
 
-func waitForServer(url string, timeout time.Duration) error {
+func waitForServer(ctx context.Context, c *client.Client, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
-	client := &http.Client{Timeout: 1 * time.Second}
-
 	for time.Now().Before(deadline) {
-		req, _ := http.NewRequest(http.MethodGet, url, nil)
-		resp, err := client.Do(req)
-		if err == nil {
-			_ = resp.Body.Close()
+		if c.Healthz(ctx) == nil {
 			return nil
 		}
 		time.Sleep(200 * time.Millisecond)
@@ -285,7 +285,7 @@ class RAGClient:
             "max_tokens": token_budget,
         }
 
-        resp = self._http_post("/retrieve", payload) or self._run_cli("retrieve", payload)
+        resp = self._http_post("/v1/retrieve", payload) or self._run_cli("retrieve", payload)
         
         chunks: List[RetrievedChunk] = []
         if not resp:
@@ -389,7 +389,7 @@ class RAGClient:
                 "source": "ide_chat",
             }
 
-            resp = self._http_post("/ingest_message", payload) or self._run_cli("ingest_message", payload)
+            resp = self._http_post("/v1/ingest_message", payload) or self._run_cli("ingest_message", payload)
             if resp is None:
                 log.debug("RAG ingest_message: both transports returned None")
                 return False
@@ -417,38 +417,18 @@ class RAGClient:
             vec = vectors[0]
 
             token_count = len(content.split())
-            doc_id = f"file:{namespace}:{file_path}:{start_line}-{end_line}"
-
-            # Try HTTP first — requires Document+Chunks wrapper
-            http_payload = {
+            # Same payload for HTTP and CLI; both derive the document ID
+            # file:<namespace>:<path>:<start>-<end> from it.
+            payload = {
                 "namespace": namespace,
-                "document": {
-                    "id": doc_id,
-                    "source": "code",
-                    "metadata": {"namespace": namespace, "file_path": file_path},
-                },
-                "chunks": [{
-                    "doc_id": doc_id,
-                    "vector": vec,
-                    "content": content,
-                    "start_line": start_line,
-                    "end_line": end_line,
-                    "token_count": token_count,
-                }],
+                "file_path": file_path,
+                "content": content,
+                "vector": vec,
+                "token_count": token_count,
+                "start_line": start_line,
+                "end_line": end_line,
             }
-            res = self._http_post("/ingest", http_payload)
-
-            if not res:
-                cli_payload = {
-                    "namespace": namespace,
-                    "file_path": file_path,
-                    "content": content,
-                    "vector": vec,
-                    "token_count": token_count,
-                    "start_line": start_line,
-                    "end_line": end_line,
-                }
-                res = self._run_cli("ingest_document", cli_payload)
+            res = self._http_post("/v1/ingest_document", payload) or self._run_cli("ingest_document", payload)
 
             ok = res is not None and (res.get("status") in ("ok", "ingested"))
             return ok